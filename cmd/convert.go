@@ -0,0 +1,926 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lion7/ingress2httproute/internal/controller"
+	"github.com/lion7/ingress2httproute/internal/schema"
+)
+
+// convert reads Ingresses, Routes of OpenShift, IngressRoutes of Traefik, HTTPProxies of Contour, VirtualServices of
+// Istio, Mappings of Emissary, Gateways and Services from files or clusters and prints the HTTPRoutes the controller
+// would create for them. The HTTPRoutes are validated against the bundled Gateway API schemas first, so invalid output
+// fails in CI rather than when it is applied. They can be compared against the ones in a target cluster, or written to
+// it, instead.
+func convert(args []string) error {
+	var files []string
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.Func("f", "File containing Ingresses, Routes of OpenShift, IngressRoutes of Traefik, HTTPProxies of "+
+		"Contour, VirtualServices of Istio, Mappings of Emissary, Gateways and Services, or - for stdin. Can be repeated.", func(value string) error {
+		files = append(files, value)
+		return nil
+	})
+	var contexts []string
+	flags.Func("context", "The kubeconfig context to read Ingresses, the resources of other ingress controllers and "+
+		"Services from, besides the files. Can be repeated to convert the Ingresses of several clusters.", func(value string) error {
+		contexts = append(contexts, value)
+		return nil
+	})
+	targetContext := flags.String("target-context", "", "The kubeconfig context to read Gateways from and to compare "+
+		"or write the generated objects against. If not set, the single --context is used.")
+	diff := flags.Bool("diff", false, "If set, only the generated objects that are missing from the target cluster or "+
+		"differ from the ones in it are printed, and the command fails if there are any")
+	apply := flags.Bool("apply", false, "If set, the generated objects are written to the target cluster with "+
+		"server-side apply instead of printed")
+	impersonate := impersonationFlags(flags)
+	var ingressClasses []string
+	flags.Func("ingress-class", "Only convert the Ingresses of this IngressClass. Can be repeated. "+
+		"All Ingresses are converted if unset.", func(value string) error {
+		ingressClasses = append(ingressClasses, value)
+		return nil
+	})
+	var gatewayClasses []gatewayv1.ObjectName
+	flags.Func("gateway-class", "Only attach HTTPRoutes to the Gateways of this GatewayClass. Can be repeated. "+
+		"All Gateways are candidates if unset.", func(value string) error {
+		gatewayClasses = append(gatewayClasses, gatewayv1.ObjectName(value))
+		return nil
+	})
+	var hostnameRewrites map[string]string
+	flags.Func("hostname-rewrites", "Comma-separated list of old=new pairs rewriting the hostnames of Ingresses in "+
+		"their HTTPRoutes, e.g. app.example.com=app.example.net", func(value string) error {
+		var err error
+		hostnameRewrites, err = controller.ParseHostnameRewrites(value)
+		return err
+	})
+	var annotationPrefix string
+	flags.Func("annotation-prefix", "Prefix of the annotations the controller recognizes on Ingresses and Namespaces, "+
+		"e.g. to pin a Gateway, "+controller.DefaultAnnotationPrefix+" if unset", func(value string) error {
+		var err error
+		annotationPrefix, err = controller.ParseAnnotationPrefix(value)
+		return err
+	})
+	supportedFeatures := flags.Bool("supported-features", false,
+		"If set, the HTTPRoutes are adapted to the status.supportedFeatures of the GatewayClasses of their Gateways, "+
+			"leaving out what the Gateways do not support")
+	requireReadyGateways := flags.Bool("require-ready-gateways", false,
+		"If set, HTTPRoutes only attach to the Gateways reporting both the Accepted and Programmed conditions")
+	defaultGateway := flags.String("default-gateway", "", "Attach the HTTPRoutes of a hostname that matches no listener to this Gateway, as namespace/name or "+
+		"namespace/name/listener, instead of skipping them")
+	channel := flags.String("channel", string(schema.Standard),
+		"Gateway API channel to validate the HTTPRoutes against: standard or experimental")
+	validate := flags.Bool("validate", true, "If set, the HTTPRoutes are validated before they are printed")
+	collapseParentRefs := flags.Bool("collapse-parent-refs", false,
+		"If set, listeners of a Gateway are referenced by a single parentRef when all of them match a hostname")
+	parentRefStrategy := flags.String("parent-ref-strategy", string(controller.ParentRefStrategyListener),
+		"How HTTPRoutes reference the Gateways they attach to: listener, port or gateway")
+	routePerParent := flags.Bool("route-per-parent", false,
+		"If set, one HTTPRoute is created per hostname and Gateway instead of one HTTPRoute per hostname")
+	canaryBackends := flags.Bool("canary-backends", false,
+		"If set, traffic to a Service managed by Argo Rollouts or Flagger is split over its stable and canary Services")
+	tlsListeners := flags.Bool("tls-listeners", false,
+		"If set, the hostnames listed under spec.tls are only attached to HTTPS listeners, "+
+			"preferring the listeners using the Secret of the Ingress")
+	tlsRedirect := flags.Bool("tls-redirect", false,
+		"If set, the HTTP listeners of the hostnames listed under spec.tls redirect to HTTPS. Implies --tls-listeners.")
+	defaultBackendRule := flags.Bool("default-backend-rule", false,
+		"If set, the default backend of an Ingress receives the requests no path matches, through a catch-all rule")
+	ruleNames := flags.Bool("rule-names", false,
+		"If set, every generated rule is named after the Ingress, hostname and index of its path. "+
+			"Rule names are part of the experimental channel.")
+	consolidateRules := flags.Bool("consolidate-rules", false,
+		"If set, the rules of paths with the same backends and filters are merged into one rule with multiple matches")
+	implementationSpecificPathType := flags.String("implementation-specific-path-type", string(controller.PathTypeRegex),
+		"The path match type of ImplementationSpecific Ingress paths: prefix, exact or regex")
+	var implementationSpecificPathTypeOverrides map[string]controller.PathTypePolicy
+	flags.Func("implementation-specific-path-type-overrides", "Comma-separated list of class=type pairs overriding "+
+		"--implementation-specific-path-type for the Ingresses of an IngressClass, e.g. gce=prefix", func(value string) error {
+		var err error
+		implementationSpecificPathTypeOverrides, err = controller.ParsePathTypePolicyOverrides(value)
+		return err
+	})
+	strictPrefixMatching := flags.Bool("strict-prefix-matching", false,
+		"If set, Prefix paths with a trailing slash also match the path without it exactly, like an Ingress does")
+	backendWeight := flags.Int("backend-weight", 1, "The weight of the backendRefs of Ingress paths")
+	omitBackendWeights := flags.Bool("omit-backend-weights", false,
+		"If set, the backendRefs of Ingress paths have no weight, so the Gateway API default of 1 applies")
+	omitTimeouts := flags.Bool("omit-timeouts", false,
+		"If set, the nginx proxy timeout annotations are not converted, for Gateways that do not support HTTPRoute timeouts")
+	sessionPersistence := flags.Bool("session-persistence", false,
+		"If set, the nginx cookie affinity is converted to the sessionPersistence of the experimental channel")
+	retryPolicies := flags.Bool("retry-policies", false,
+		"If set, the retry policies of HTTPProxies and Mappings and the retries of VirtualServices are converted to "+
+			"the retry of the experimental channel")
+	traefikMiddlewareFilters := flags.Bool("traefik-middleware-filters", false,
+		"If set, the Traefik Middlewares in the namespace of an Ingress are referenced by ExtensionRef filters, for the Traefik Gateway provider")
+	conversionProfiles := flags.Bool("conversion-profiles", false,
+		"If set, the Ingresses of the nginx, Traefik, AWS load balancer, Azure Application Gateway and GKE Ingress "+
+			"controllers are converted with a profile for that controller, selected by their IngressClass")
+	var profileGatewayClasses map[string]gatewayv1.ObjectName
+	flags.Func("profile-gateway-classes", "Comma-separated list of profile=gatewayclass pairs limiting the Gateways "+
+		"the HTTPRoutes of a conversion profile attach to, e.g. nginx=internal", func(value string) error {
+		var err error
+		profileGatewayClasses, err = controller.ParseProfileGatewayClasses(value)
+		return err
+	})
+	mergeHosts := flags.Bool("merge-hosts", false,
+		"If set, the rules of all Ingresses in a namespace with the same hostname are merged into one HTTPRoute per hostname")
+	appProtocolBackends := flags.Bool("app-protocol-backends", false,
+		"If set, HTTPRoutes whose backends all serve gRPC according to the appProtocol of their Service ports are "+
+			"converted to GRPCRoutes, and a BackendTLSPolicy is generated for Services serving HTTPS")
+	tlsPassthroughRoutes := flags.Bool("tls-passthrough-routes", false,
+		"If set, the hosts of Ingresses with the nginx ssl-passthrough annotation are converted to TLSRoutes of the "+
+			"experimental channel, attached to TLS listeners in Passthrough mode, instead of HTTPRoutes")
+	backendTLSCACertificates := flags.String("backend-tls-ca-certificates", "",
+		"ConfigMap in the namespace of each Service serving HTTPS with the CA certificates its BackendTLSPolicy "+
+			"validates against, the system CAs if empty")
+	convertAcmeSolvers := flags.Bool("convert-acme-solvers", false,
+		"If set, the HTTP01 solver Ingresses of cert-manager are converted too")
+	crossNamespaceBackends := flags.Bool("cross-namespace-backends", false,
+		"If set, an ExternalName Service pointing at a Service in another namespace is replaced by that Service, "+
+			"when a ReferenceGrant in the given files allows it")
+	gatewayNamespaceRoutes := flags.Bool("gateway-namespace-routes", false,
+		"If set, HTTPRoutes are created in the namespaces of their Gateways")
+	extensionRefMappingsFile := flags.String("extension-ref-mappings", "",
+		"File mapping Ingress annotations to ExtensionRef filters")
+	sourceRangePolicyTemplateFile := flags.String("source-range-policy-template", "",
+		"File with a Go template of the vendor policy restricting the source ranges of an HTTPRoute")
+	rateLimitPolicyTemplateFile := flags.String("rate-limit-policy-template", "",
+		"File with a Go template of the vendor policy limiting the requests to an HTTPRoute")
+	backendConfigPolicyTemplateFile := flags.String("backend-config-policy-template", "",
+		"File with a Go template of the vendor policy for the GKE BackendConfig of a Service port of an HTTPRoute")
+	annotationPoliciesFile := flags.String("annotation-policies", "",
+		"File with Go templates of vendor policies for the HTTPRoutes, keyed by Ingress annotation")
+	var externalDNSAnnotations []string
+	flags.Func("external-dns-annotation", "Copy this external-dns annotation, e.g. ttl for external-dns.alpha.kubernetes.io/ttl, "+
+		"from the Ingresses onto their HTTPRoutes. Can be repeated.", func(value string) error {
+		externalDNSAnnotations = append(externalDNSAnnotations, value)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 && len(contexts) == 0 {
+		return errors.New("at least one file must be given with -f, or a context with --context")
+	}
+	if *diff && *apply {
+		return errors.New("--diff cannot be used with --apply")
+	}
+	if impersonate.UserName == "" && len(impersonate.Groups) > 0 {
+		return errors.New("--as-group requires --as to be set")
+	}
+	if (*diff || *apply) && *targetContext == "" && len(contexts) != 1 {
+		return errors.New("--diff and --apply need a --target-context, or a single --context")
+	}
+
+	implementationSpecificPolicy, err := controller.ParsePathTypePolicy(*implementationSpecificPathType)
+	if err != nil {
+		return err
+	}
+	parentRefStrategyValue, err := controller.ParseParentRefStrategy(*parentRefStrategy)
+	if err != nil {
+		return err
+	}
+	if *defaultGateway != "" {
+		if _, err := controller.ParseGatewayReference(*defaultGateway); err != nil {
+			return fmt.Errorf("invalid --default-gateway: %w", err)
+		}
+	}
+	if *gatewayNamespaceRoutes && (*appProtocolBackends || *tlsPassthroughRoutes) {
+		return errors.New("--gateway-namespace-routes cannot be used with --app-protocol-backends or --tls-passthrough-routes")
+	}
+
+	var extensionRefMappings []controller.ExtensionRefMapping
+	if *extensionRefMappingsFile != "" {
+		var err error
+		if extensionRefMappings, err = controller.LoadExtensionRefMappings(*extensionRefMappingsFile); err != nil {
+			return err
+		}
+	}
+
+	var sourceRangePolicyTemplate *template.Template
+	if *sourceRangePolicyTemplateFile != "" {
+		var err error
+		if sourceRangePolicyTemplate, err = controller.LoadPolicyTemplate(*sourceRangePolicyTemplateFile); err != nil {
+			return err
+		}
+	}
+	var rateLimitPolicyTemplate *template.Template
+	if *rateLimitPolicyTemplateFile != "" {
+		var err error
+		if rateLimitPolicyTemplate, err = controller.LoadPolicyTemplate(*rateLimitPolicyTemplateFile); err != nil {
+			return err
+		}
+	}
+	var backendConfigPolicyTemplate *template.Template
+	if *backendConfigPolicyTemplateFile != "" {
+		var err error
+		if backendConfigPolicyTemplate, err = controller.LoadPolicyTemplate(*backendConfigPolicyTemplateFile); err != nil {
+			return err
+		}
+	}
+	var annotationPolicies []controller.AnnotationPolicy
+	if *annotationPoliciesFile != "" {
+		var err error
+		if annotationPolicies, err = controller.LoadAnnotationPolicies(*annotationPoliciesFile); err != nil {
+			return err
+		}
+	}
+
+	var validator *schema.Validator
+	if *validate {
+		var err error
+		if validator, err = schema.NewValidator(schema.Channel(*channel)); err != nil {
+			return err
+		}
+	}
+
+	// Conversion logs would mix with the output
+	ctrl.SetLogger(logr.Discard())
+
+	ctx := context.Background()
+	var objects []client.Object
+	for _, file := range files {
+		fileObjects, err := readObjects(file)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+		objects = append(objects, fileObjects...)
+	}
+	// The Gateways are read from the target cluster if there is one, else from the clusters of the Ingresses
+	var targetClient client.Client
+	for _, kubeContext := range contexts {
+		c, err := newContextClient(kubeContext, *impersonate)
+		if err != nil {
+			return err
+		}
+		lists := sourceClusterLists()
+		if *targetContext == "" {
+			lists = append(lists, targetClusterLists()...)
+			targetClient = c
+		}
+		clusterObjects, err := listClusterObjects(ctx, c, lists)
+		if err != nil {
+			return fmt.Errorf("cannot read context %s: %w", kubeContext, err)
+		}
+		objects = append(objects, clusterObjects...)
+	}
+	if *targetContext != "" {
+		var err error
+		if targetClient, err = newContextClient(*targetContext, *impersonate); err != nil {
+			return err
+		}
+		clusterObjects, err := listClusterObjects(ctx, targetClient, targetClusterLists())
+		if err != nil {
+			return fmt.Errorf("cannot read context %s: %w", *targetContext, err)
+		}
+		objects = append(objects, clusterObjects...)
+	}
+	if err := checkDuplicateObjects(objects); err != nil {
+		return err
+	}
+
+	var ingresses []*networkingv1.Ingress
+	var gateways gatewayv1.GatewayList
+	var openShiftRoutes []*unstructured.Unstructured
+	var traefikIngressRoutes []*unstructured.Unstructured
+	var contourHTTPProxies []*unstructured.Unstructured
+	var istioVirtualServices []*unstructured.Unstructured
+	var ambassadorMappings []*unstructured.Unstructured
+	var typed []client.Object
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *networkingv1.Ingress:
+			ingresses = append(ingresses, o)
+		case *gatewayv1.Gateway:
+			gateways.Items = append(gateways.Items, *o)
+		case *unstructured.Unstructured:
+			switch o.GroupVersionKind() {
+			case controller.OpenShiftRouteGVK:
+				openShiftRoutes = append(openShiftRoutes, o)
+			case controller.TraefikIngressRouteGVK:
+				traefikIngressRoutes = append(traefikIngressRoutes, o)
+			case controller.ContourHTTPProxyGVK:
+				// The HTTPProxies a root HTTPProxy includes are read from the client
+				contourHTTPProxies = append(contourHTTPProxies, o)
+				typed = append(typed, obj)
+			case controller.IstioVirtualServiceGVK:
+				istioVirtualServices = append(istioVirtualServices, o)
+			case controller.AmbassadorMappingGVK:
+				// The Mappings a Mapping is grouped with are read from the client
+				ambassadorMappings = append(ambassadorMappings, o)
+				typed = append(typed, obj)
+			}
+			continue
+		}
+		typed = append(typed, obj)
+	}
+
+	// Named Service ports are resolved from the Services in the given files
+	reconciler := &controller.IngressReconciler{
+		Client:                                  fake.NewClientBuilder().WithScheme(scheme).WithObjects(typed...).Build(),
+		Scheme:                                  scheme,
+		CollapseParentRefs:                      *collapseParentRefs,
+		ParentRefStrategy:                       parentRefStrategyValue,
+		RoutePerParent:                          *routePerParent,
+		CanaryBackends:                          *canaryBackends,
+		TLSListeners:                            *tlsListeners,
+		TLSRedirect:                             *tlsRedirect,
+		DefaultBackendRule:                      *defaultBackendRule,
+		RuleNames:                               *ruleNames,
+		ConsolidateRules:                        *consolidateRules,
+		StrictPrefixMatching:                    *strictPrefixMatching,
+		MergeHosts:                              *mergeHosts,
+		GatewayClasses:                          gatewayClasses,
+		HostnameRewrites:                        hostnameRewrites,
+		AnnotationPrefix:                        annotationPrefix,
+		DefaultGateway:                          *defaultGateway,
+		RequireReadyGateways:                    *requireReadyGateways,
+		SupportedFeatures:                       *supportedFeatures,
+		ConversionProfiles:                      *conversionProfiles,
+		ProfileGatewayClasses:                   profileGatewayClasses,
+		IngressClasses:                          ingressClasses,
+		AppProtocolBackends:                     *appProtocolBackends,
+		TLSPassthroughRoutes:                    *tlsPassthroughRoutes,
+		BackendTLSCACertificates:                *backendTLSCACertificates,
+		BackendWeight:                           ptr.To(int32(*backendWeight)),
+		OmitBackendWeights:                      *omitBackendWeights,
+		OmitTimeouts:                            *omitTimeouts,
+		SessionPersistence:                      *sessionPersistence,
+		RetryPolicies:                           *retryPolicies,
+		TraefikMiddlewareFilters:                *traefikMiddlewareFilters,
+		ImplementationSpecificPathType:          implementationSpecificPolicy,
+		ImplementationSpecificPathTypeOverrides: implementationSpecificPathTypeOverrides,
+		ConvertAcmeSolvers:                      *convertAcmeSolvers,
+		ExtensionRefMappings:                    extensionRefMappings,
+		SourceRangePolicyTemplate:               sourceRangePolicyTemplate,
+		RateLimitPolicyTemplate:                 rateLimitPolicyTemplate,
+		BackendConfigPolicyTemplate:             backendConfigPolicyTemplate,
+		AnnotationPolicies:                      annotationPolicies,
+		ExternalDNSAnnotations:                  externalDNSAnnotations,
+		CrossNamespaceBackends:                  *crossNamespaceBackends,
+		GatewayNamespaceRoutes:                  *gatewayNamespaceRoutes,
+	}
+
+	var routes []gatewayv1.HTTPRoute
+	var tlsRoutes []gatewayv1alpha2.TLSRoute
+	var backendTLSPolicies, vendorPolicies []client.Object
+	converted := make(map[string]bool)
+	for _, ingress := range ingresses {
+		matches, err := reconciler.MatchesIngressClass(ctx, *ingress)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+		ingressRoutes, err := reconciler.Convert(ctx, *ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, *ingress, ingressRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		for i := range tlsPolicies {
+			// The policy of a Service shared by several Ingresses is generated for each of them
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		policies, err := reconciler.SourceRangePolicies(*ingress, ingressRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		rateLimitPolicies, err := reconciler.RateLimitPolicies(*ingress, ingressRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		backendConfigPolicies, err := reconciler.BackendConfigPolicies(ctx, *ingress, ingressRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		annotationPolicies, err := reconciler.RenderAnnotationPolicies(*ingress, ingressRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		for _, policy := range slices.Concat(policies, rateLimitPolicies, backendConfigPolicies, annotationPolicies) {
+			key := policy.GetKind() + "/" + policy.GetNamespace() + "/" + policy.GetName()
+			if converted[key] {
+				continue
+			}
+			converted[key] = true
+
+			policy.SetOwnerReferences(slices.DeleteFunc(policy.GetOwnerReferences(), func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			}))
+			vendorPolicies = append(vendorPolicies, policy)
+		}
+		for _, route := range ingressRoutes {
+			// Merged HTTPRoutes are generated for each Ingress sharing the hostname
+			key := route.Namespace + "/" + route.Name
+			if converted[key] {
+				continue
+			}
+			converted[key] = true
+
+			// Without a UID the owner reference would be rejected by the API server
+			route.OwnerReferences = slices.DeleteFunc(route.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, route)
+		}
+		ingressTLSRoutes, err := reconciler.TLSRoutes(ctx, *ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s/%s: %w", ingress.Namespace, ingress.Name, err)
+		}
+		for _, route := range ingressTLSRoutes {
+			route.OwnerReferences = slices.DeleteFunc(route.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			tlsRoutes = append(tlsRoutes, route)
+		}
+	}
+
+	// The Routes of OpenShift are converted by the Ingresses they are mapped to
+	openShiftReconciler := &controller.OpenShiftRouteReconciler{IngressReconciler: reconciler}
+	for _, route := range openShiftRoutes {
+		ingress, err := openShiftReconciler.OpenShiftRouteIngress(ctx, route)
+		if err != nil {
+			return fmt.Errorf("cannot convert Route %s/%s: %w", route.GetNamespace(), route.GetName(), err)
+		}
+		routeHTTPRoutes, routeTLSRoutes, err := openShiftReconciler.ConvertOpenShiftRoute(ctx, route, ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert Route %s/%s: %w", route.GetNamespace(), route.GetName(), err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, ingress, routeHTTPRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Route %s/%s: %w", route.GetNamespace(), route.GetName(), err)
+		}
+		for i := range tlsPolicies {
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		for _, httpRoute := range routeHTTPRoutes {
+			httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, httpRoute)
+		}
+		for _, tlsRoute := range routeTLSRoutes {
+			tlsRoute.OwnerReferences = slices.DeleteFunc(tlsRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			tlsRoutes = append(tlsRoutes, tlsRoute)
+		}
+	}
+
+	// The IngressRoutes of Traefik are converted by the Ingresses they are mapped to
+	traefikReconciler := &controller.TraefikIngressRouteReconciler{IngressReconciler: reconciler}
+	for _, ingressRoute := range traefikIngressRoutes {
+		ingress, err := traefikReconciler.TraefikIngressRouteIngress(ingressRoute)
+		if err != nil {
+			return fmt.Errorf("cannot convert IngressRoute %s/%s: %w", ingressRoute.GetNamespace(), ingressRoute.GetName(), err)
+		}
+		ingressRouteHTTPRoutes, err := traefikReconciler.ConvertTraefikIngressRoute(ctx, ingressRoute, ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert IngressRoute %s/%s: %w", ingressRoute.GetNamespace(), ingressRoute.GetName(), err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, ingress, ingressRouteHTTPRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert IngressRoute %s/%s: %w", ingressRoute.GetNamespace(), ingressRoute.GetName(), err)
+		}
+		for i := range tlsPolicies {
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		for _, httpRoute := range ingressRouteHTTPRoutes {
+			httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, httpRoute)
+		}
+	}
+
+	// The root HTTPProxies of Contour are converted by the Ingresses they are mapped to
+	contourReconciler := &controller.ContourHTTPProxyReconciler{IngressReconciler: reconciler}
+	for _, proxy := range contourHTTPProxies {
+		ingress, err := contourReconciler.ContourHTTPProxyIngress(ctx, proxy)
+		if err != nil {
+			return fmt.Errorf("cannot convert HTTPProxy %s/%s: %w", proxy.GetNamespace(), proxy.GetName(), err)
+		}
+		proxyHTTPRoutes, err := contourReconciler.ConvertContourHTTPProxy(ctx, proxy, ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert HTTPProxy %s/%s: %w", proxy.GetNamespace(), proxy.GetName(), err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, ingress, proxyHTTPRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert HTTPProxy %s/%s: %w", proxy.GetNamespace(), proxy.GetName(), err)
+		}
+		for i := range tlsPolicies {
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		for _, httpRoute := range proxyHTTPRoutes {
+			httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, httpRoute)
+		}
+	}
+
+	// The VirtualServices of Istio bound to gateways are converted by the Ingresses they are mapped to
+	istioReconciler := &controller.IstioVirtualServiceReconciler{IngressReconciler: reconciler}
+	for _, virtualService := range istioVirtualServices {
+		ingress, err := istioReconciler.IstioVirtualServiceIngress(virtualService)
+		if err != nil {
+			return fmt.Errorf("cannot convert VirtualService %s/%s: %w", virtualService.GetNamespace(), virtualService.GetName(), err)
+		}
+		virtualServiceHTTPRoutes, err := istioReconciler.ConvertIstioVirtualService(ctx, virtualService, ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert VirtualService %s/%s: %w", virtualService.GetNamespace(), virtualService.GetName(), err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, ingress, virtualServiceHTTPRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert VirtualService %s/%s: %w", virtualService.GetNamespace(), virtualService.GetName(), err)
+		}
+		for i := range tlsPolicies {
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		for _, httpRoute := range virtualServiceHTTPRoutes {
+			httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, httpRoute)
+		}
+	}
+
+	// The Mappings of Emissary are converted by the Ingresses they are mapped to, a group by its first Mapping
+	ambassadorReconciler := &controller.AmbassadorMappingReconciler{IngressReconciler: reconciler}
+	for _, mapping := range ambassadorMappings {
+		ingress, err := ambassadorReconciler.AmbassadorMappingIngress(ctx, mapping)
+		if err != nil {
+			return fmt.Errorf("cannot convert Mapping %s/%s: %w", mapping.GetNamespace(), mapping.GetName(), err)
+		}
+		mappingHTTPRoutes, err := ambassadorReconciler.ConvertAmbassadorMapping(ctx, mapping, ingress, gateways)
+		if err != nil {
+			return fmt.Errorf("cannot convert Mapping %s/%s: %w", mapping.GetNamespace(), mapping.GetName(), err)
+		}
+		tlsPolicies, err := reconciler.BackendTLSPolicies(ctx, ingress, mappingHTTPRoutes)
+		if err != nil {
+			return fmt.Errorf("cannot convert Mapping %s/%s: %w", mapping.GetNamespace(), mapping.GetName(), err)
+		}
+		for i := range tlsPolicies {
+			key := "BackendTLSPolicy/" + tlsPolicies[i].Namespace + "/" + tlsPolicies[i].Name
+			if !converted[key] {
+				converted[key] = true
+				backendTLSPolicies = append(backendTLSPolicies, &tlsPolicies[i])
+			}
+		}
+		for _, httpRoute := range mappingHTTPRoutes {
+			httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(owner metav1.OwnerReference) bool {
+				return owner.UID == ""
+			})
+			routes = append(routes, httpRoute)
+		}
+	}
+
+	routes, grpcRoutes, err := reconciler.SplitGRPCRoutes(ctx, routes)
+	if err != nil {
+		return err
+	}
+	var output []client.Object
+	for i := range routes {
+		output = append(output, &routes[i])
+	}
+	for i := range grpcRoutes {
+		output = append(output, &grpcRoutes[i])
+	}
+	for i := range tlsRoutes {
+		output = append(output, &tlsRoutes[i])
+	}
+	output = append(output, backendTLSPolicies...)
+
+	if validator != nil {
+		var invalid bool
+		for _, obj := range output {
+			errs, err := validator.Validate(ctx, obj)
+			if err != nil {
+				return err
+			}
+			for _, e := range errs {
+				invalid = true
+				fmt.Fprintf(os.Stderr, "%s %s/%s: %v\n", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetNamespace(), obj.GetName(), e)
+			}
+		}
+		if invalid {
+			return fmt.Errorf("generated objects are invalid for the %s channel", *channel)
+		}
+	}
+
+	// The schemas of vendor policies are unknown, they are not validated
+	output = append(output, vendorPolicies...)
+
+	// Owner references cannot point to the Ingresses in another cluster
+	if *targetContext != "" && !slices.Equal(contexts, []string{*targetContext}) {
+		for _, obj := range output {
+			controller.AnnotateOwner(obj)
+		}
+	}
+	switch {
+	case *apply:
+		return applyObjects(ctx, targetClient, output, os.Stderr)
+	case *diff:
+		changed, err := diffObjects(ctx, targetClient, output, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if err := printObjects(os.Stdout, changed); err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			return fmt.Errorf("%d generated objects differ from the target cluster", len(changed))
+		}
+		return nil
+	}
+	return printObjects(os.Stdout, output)
+}
+
+// impersonationFlags adds the --as and --as-group flags of the controller to the flags of a command reading clusters
+func impersonationFlags(flags *flag.FlagSet) *rest.ImpersonationConfig {
+	impersonate := &rest.ImpersonationConfig{}
+	flags.StringVar(&impersonate.UserName, "as", "",
+		"Username to impersonate for all requests to the API server, e.g. system:serviceaccount:ns:name")
+	flags.Func("as-group", "Group to impersonate for all requests to the API server. "+
+		"Can be repeated to specify multiple groups.", func(value string) error {
+		impersonate.Groups = append(impersonate.Groups, value)
+		return nil
+	})
+	return impersonate
+}
+
+// newContextClient returns a client of the cluster of the kubeconfig context, acting as the impersonated identity
+func newContextClient(kubeContext string, impersonate rest.ImpersonationConfig) (client.Client, error) {
+	restConfig, err := config.GetConfigWithContext(kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load context %s: %w", kubeContext, err)
+	}
+	restConfig.Impersonate = impersonate
+	return client.New(restConfig, client.Options{Scheme: scheme})
+}
+
+// sourceClusterLists returns the lists of the objects read from the clusters of the Ingresses
+func sourceClusterLists() []client.ObjectList {
+	lists := []client.ObjectList{&networkingv1.IngressList{}, &networkingv1.IngressClassList{}, &corev1.ServiceList{}}
+	for _, gvk := range controller.SourceKinds() {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		lists = append(lists, list)
+	}
+	return lists
+}
+
+// targetClusterLists returns the lists of the objects read from the cluster the generated objects are written to
+func targetClusterLists() []client.ObjectList {
+	return []client.ObjectList{
+		&corev1.NamespaceList{},
+		&gatewayv1.GatewayList{},
+		&gatewayv1.GatewayClassList{},
+		&gatewayv1beta1.ReferenceGrantList{},
+	}
+}
+
+// listClusterObjects lists the objects of the lists in the cluster. The kinds whose CRDs are not installed are
+// skipped, like the resources of the ingress controllers that are not used.
+func listClusterObjects(ctx context.Context, c client.Client, lists []client.ObjectList) ([]client.Object, error) {
+	var objects []client.Object
+	for _, list := range lists {
+		if err := c.List(ctx, list); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if obj, ok := item.(client.Object); ok {
+				objects = append(objects, obj)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// checkDuplicateObjects returns an error if an object is read twice, e.g. an Ingress with the same namespace and
+// name from two clusters, as only one of them could be converted
+func checkDuplicateObjects(objects []client.Object) error {
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return err
+		}
+		key := gvk.Kind + " " + client.ObjectKeyFromObject(obj).String()
+		if seen[key] {
+			return fmt.Errorf("%s is read more than once", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// clusterObject returns the object as unstructured, with its kind set and without the fields the API server owns
+func clusterObject(obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	u.SetCreationTimestamp(metav1.Time{})
+	u.SetResourceVersion("")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, nil
+}
+
+// applyObjects writes the generated objects to the cluster with server-side apply, taking over the fields other
+// managers set
+func applyObjects(ctx context.Context, c client.Client, objects []client.Object, w io.Writer) error {
+	for _, obj := range objects {
+		u, err := clusterObject(obj)
+		if err != nil {
+			return err
+		}
+		if err := c.Patch(ctx, u, client.Apply, client.FieldOwner("ingress2httproute"), client.ForceOwnership); err != nil {
+			return fmt.Errorf("cannot apply %s %s: %w", u.GetKind(), client.ObjectKeyFromObject(u), err)
+		}
+		_, _ = fmt.Fprintf(w, "%s %s applied\n", u.GetKind(), client.ObjectKeyFromObject(u))
+	}
+	return nil
+}
+
+// diffObjects returns the generated objects that are missing from the cluster, or whose spec differs from the one
+// in it, and writes why to w. The fields the API server defaults are not compared.
+func diffObjects(ctx context.Context, c client.Client, objects []client.Object, w io.Writer) ([]client.Object, error) {
+	var changed []client.Object
+	for _, obj := range objects {
+		desired, err := clusterObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(desired.GroupVersionKind())
+		if err := c.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			_, _ = fmt.Fprintf(w, "%s %s is missing\n", desired.GetKind(), client.ObjectKeyFromObject(desired))
+			changed = append(changed, obj)
+			continue
+		}
+		if !equality.Semantic.DeepDerivative(desired.Object["spec"], current.Object["spec"]) {
+			_, _ = fmt.Fprintf(w, "%s %s differs\n", desired.GetKind(), client.ObjectKeyFromObject(desired))
+			changed = append(changed, obj)
+		}
+	}
+	return changed, nil
+}
+
+// readObjects decodes all objects from a multi-document YAML or JSON file
+func readObjects(file string) ([]client.Object, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	var objects []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc) == 0 {
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			// The sources converted besides Ingresses have no types of their own,
+			// other kinds of objects are irrelevant for the conversion
+			source := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(doc, &source.Object); err != nil {
+				return nil, err
+			}
+			if controller.IsSourceKind(source.GroupVersionKind()) {
+				objects = append(objects, source)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if clientObj, ok := obj.(client.Object); ok {
+			objects = append(objects, clientObj)
+		}
+	}
+}
+
+// printObjects writes the generated objects as a multi-document YAML stream, without status
+func printObjects(w io.Writer, objects []client.Object) error {
+	for _, object := range objects {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+		if err != nil {
+			return err
+		}
+		delete(obj, "status")
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "creationTimestamp")
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
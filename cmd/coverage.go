@@ -0,0 +1,267 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/lion7/ingress2httproute/internal/controller"
+)
+
+// coverage reports which annotations the Ingresses use, how often, and whether the conversion supports them,
+// so the unsupported annotations used by the most Ingresses can be dealt with first.
+func coverage(args []string) error {
+	var files []string
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	flags.Func("f", "File containing Ingresses, or - for stdin. Can be repeated. "+
+		"If not set, the Ingresses are read from the cluster.", func(value string) error {
+		files = append(files, value)
+		return nil
+	})
+	kubeContext := flags.String("context", "", "The kubeconfig context to read Ingresses from")
+	namespace := flags.String("namespace", "", "Only report the Ingresses in this namespace")
+	extensionRefMappingsFile := flags.String("extension-ref-mappings", "",
+		"File mapping Ingress annotations to ExtensionRef filters, these annotations are reported as converted")
+	annotationPoliciesFile := flags.String("annotation-policies", "",
+		"File with vendor policies keyed by Ingress annotation, these annotations are reported as converted")
+	var externalDNSAnnotations []string
+	flags.Func("external-dns-annotation", "Name of an external-dns annotation copied onto the HTTPRoutes, e.g. ttl, "+
+		"these annotations are reported as converted. Can be repeated.", func(value string) error {
+		externalDNSAnnotations = append(externalDNSAnnotations, value)
+		return nil
+	})
+	sourceRangePolicyTemplateFile := flags.String("source-range-policy-template", "",
+		"File with a Go template of the vendor policy restricting the source ranges of an HTTPRoute, "+
+			"the nginx allowlist annotations are reported as converted")
+	rateLimitPolicyTemplateFile := flags.String("rate-limit-policy-template", "",
+		"File with a Go template of the vendor policy limiting the requests to an HTTPRoute, "+
+			"the nginx rate limit annotations are reported as converted")
+	sessionPersistence := flags.Bool("session-persistence", false,
+		"If set, the nginx cookie affinity annotations are reported as converted")
+	traefikMiddlewareFilters := flags.Bool("traefik-middleware-filters", false,
+		"If set, the Traefik router middlewares annotation is reported as converted")
+	tlsPassthroughRoutes := flags.Bool("tls-passthrough-routes", false,
+		"If set, the nginx ssl-passthrough annotation is reported as converted")
+	omitTimeouts := flags.Bool("omit-timeouts", false,
+		"If set, the proxy timeout annotations are reported as unsupported")
+	conversionProfiles := flags.Bool("conversion-profiles", false,
+		"If set, the annotations of other Ingress controllers than the one of the IngressClass of an Ingress are "+
+			"reported as ignored, like the conversion profiles do not translate them")
+	var ingressClasses []string
+	flags.Func("ingress-class", "Only report the Ingresses of this IngressClass. Can be repeated. "+
+		"All Ingresses are reported if unset.", func(value string) error {
+		ingressClasses = append(ingressClasses, value)
+		return nil
+	})
+	var annotationPrefix string
+	flags.Func("annotation-prefix", "Prefix of the annotations of the controller, "+
+		controller.DefaultAnnotationPrefix+" if unset", func(value string) error {
+		var err error
+		annotationPrefix, err = controller.ParseAnnotationPrefix(value)
+		return err
+	})
+	impersonate := impersonationFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if impersonate.UserName == "" && len(impersonate.Groups) > 0 {
+		return errors.New("--as-group requires --as to be set")
+	}
+
+	reconciler := &controller.IngressReconciler{
+		Scheme:                   scheme,
+		SessionPersistence:       *sessionPersistence,
+		TraefikMiddlewareFilters: *traefikMiddlewareFilters,
+		TLSPassthroughRoutes:     *tlsPassthroughRoutes,
+		OmitTimeouts:             *omitTimeouts,
+		ConversionProfiles:       *conversionProfiles,
+		IngressClasses:           ingressClasses,
+		AnnotationPrefix:         annotationPrefix,
+		ExternalDNSAnnotations:   externalDNSAnnotations,
+	}
+	if *sourceRangePolicyTemplateFile != "" {
+		var err error
+		if reconciler.SourceRangePolicyTemplate, err = controller.LoadPolicyTemplate(*sourceRangePolicyTemplateFile); err != nil {
+			return err
+		}
+	}
+	if *rateLimitPolicyTemplateFile != "" {
+		var err error
+		if reconciler.RateLimitPolicyTemplate, err = controller.LoadPolicyTemplate(*rateLimitPolicyTemplateFile); err != nil {
+			return err
+		}
+	}
+	if *extensionRefMappingsFile != "" {
+		var err error
+		if reconciler.ExtensionRefMappings, err = controller.LoadExtensionRefMappings(*extensionRefMappingsFile); err != nil {
+			return err
+		}
+	}
+	if *annotationPoliciesFile != "" {
+		var err error
+		if reconciler.AnnotationPolicies, err = controller.LoadAnnotationPolicies(*annotationPoliciesFile); err != nil {
+			return err
+		}
+	}
+
+	// The IngressClasses select the Ingresses in scope and their conversion profiles
+	ctx := context.Background()
+	var ingresses []networkingv1.Ingress
+	if len(files) > 0 {
+		var ingressClassObjects []client.Object
+		for _, file := range files {
+			objects, err := readObjects(file)
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %w", file, err)
+			}
+			for _, obj := range objects {
+				switch o := obj.(type) {
+				case *networkingv1.Ingress:
+					if *namespace == "" || o.Namespace == *namespace {
+						ingresses = append(ingresses, *o)
+					}
+				case *networkingv1.IngressClass:
+					ingressClassObjects = append(ingressClassObjects, o)
+				}
+			}
+		}
+		reconciler.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(ingressClassObjects...).Build()
+	} else {
+		var err error
+		if reconciler.Client, err = newContextClient(*kubeContext, *impersonate); err != nil {
+			return err
+		}
+		var ingressList networkingv1.IngressList
+		if err := reconciler.List(ctx, &ingressList, client.InNamespace(*namespace)); err != nil {
+			return err
+		}
+		ingresses = ingressList.Items
+	}
+
+	report, err := aggregateCoverage(ctx, reconciler, ingresses)
+	if err != nil {
+		return err
+	}
+	printCoverage(os.Stdout, report)
+	return nil
+}
+
+// annotationCoverage is the usage of a single annotation key
+type annotationCoverage struct {
+	key        string
+	support    controller.AnnotationSupport
+	ingresses  int
+	namespaces map[string]struct{}
+}
+
+type coverageReport struct {
+	ingresses   int
+	namespaces  int
+	convertible int
+	annotations []*annotationCoverage
+}
+
+// supportPriority orders the annotations that need attention first
+var supportPriority = map[controller.AnnotationSupport]int{
+	controller.AnnotationUnconvertible: 0,
+	controller.AnnotationUnsupported:   1,
+	controller.AnnotationConverted:     2,
+	controller.AnnotationIgnored:       3,
+}
+
+// aggregateCoverage reports the annotations of the Ingresses in scope. With conversion profiles, an annotation can
+// be treated differently depending on the IngressClass, it is reported once for every kind of support.
+func aggregateCoverage(ctx context.Context, reconciler *controller.IngressReconciler, ingresses []networkingv1.Ingress) (coverageReport, error) {
+	var report coverageReport
+	namespaces := make(map[string]struct{})
+	annotations := make(map[string]*annotationCoverage)
+	for _, ingress := range ingresses {
+		matches, err := reconciler.MatchesIngressClass(ctx, ingress)
+		if err != nil {
+			return report, err
+		}
+		if !matches {
+			continue
+		}
+		support, err := reconciler.IngressAnnotationSupport(ctx, ingress)
+		if err != nil {
+			return report, err
+		}
+		report.ingresses++
+		namespaces[ingress.Namespace] = struct{}{}
+		convertible := true
+		for key := range ingress.Annotations {
+			annotation, ok := annotations[key+" "+string(support[key])]
+			if !ok {
+				annotation = &annotationCoverage{
+					key:        key,
+					support:    support[key],
+					namespaces: make(map[string]struct{}),
+				}
+				annotations[key+" "+string(support[key])] = annotation
+				report.annotations = append(report.annotations, annotation)
+			}
+			annotation.ingresses++
+			annotation.namespaces[ingress.Namespace] = struct{}{}
+			if annotation.support == controller.AnnotationUnsupported || annotation.support == controller.AnnotationUnconvertible {
+				convertible = false
+			}
+		}
+		if convertible {
+			report.convertible++
+		}
+	}
+	report.namespaces = len(namespaces)
+
+	slices.SortFunc(report.annotations, func(a, b *annotationCoverage) int {
+		return cmp.Or(
+			cmp.Compare(supportPriority[a.support], supportPriority[b.support]),
+			cmp.Compare(b.ingresses, a.ingresses),
+			cmp.Compare(a.key, b.key),
+		)
+	})
+	return report, nil
+}
+
+func printCoverage(w io.Writer, report coverageReport) {
+	_, _ = fmt.Fprintf(w, "Scanned %d Ingresses in %d namespaces, %d can be converted without losing annotations\n",
+		report.ingresses, report.namespaces, report.convertible)
+	if len(report.annotations) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ANNOTATION\tINGRESSES\tNAMESPACES\tSUPPORT")
+	for _, annotation := range report.annotations {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n",
+			annotation.key, annotation.ingresses, len(annotation.namespaces), annotation.support)
+	}
+	_ = tw.Flush()
+}
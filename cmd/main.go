@@ -19,25 +19,42 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"text/template"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	"github.com/lion7/ingress2httproute/internal/audit"
 	"github.com/lion7/ingress2httproute/internal/controller"
+	webhookv1 "github.com/lion7/ingress2httproute/internal/webhook/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+	gatewayxv1alpha1 "sigs.k8s.io/gateway-api/apisx/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -50,16 +67,107 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(networkingv1.AddToScheme(scheme))
 	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha2.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha3.AddToScheme(scheme))
+	utilruntime.Must(gatewayxv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "convert":
+			run = convert
+		case "coverage":
+			run = coverage
+		case "simulate":
+			run = simulate
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var requireHostname bool
+	var hostnameRewrites map[string]string
+	var annotationPrefix string
+	var collapseParentRefs bool
+	var listenerPorts []int32
+	var listenerProtocols []gatewayv1.ProtocolType
+	var routePerParent bool
+	var disableServiceLookups bool
+	var kubeContext string
+	var targetContext string
+	var profileName string
+	var canaryBackends bool
+	var defaultBackendRule bool
+	var ruleNames bool
+	var consolidateRules bool
+	var strictPrefixMatching bool
+	var mergeHosts bool
+	var parentRefStrategy string
+	var gatewayClasses []gatewayv1.ObjectName
+	var defaultGateway string
+	var requireReadyGateways bool
+	var supportedFeatures bool
+	var conversionProfiles bool
+	var profileGatewayClasses map[string]gatewayv1.ObjectName
+	var ingressClasses []string
+	var externalDNSAnnotations []string
+	var appProtocolBackends bool
+	var tlsPassthroughRoutes bool
+	var backendTLSCACertificates string
+	var backendWeight int
+	var omitBackendWeights bool
+	var omitTimeouts bool
+	var sessionPersistence bool
+	var traefikMiddlewareFilters bool
+	var implementationSpecificPathType string
+	var implementationSpecificPathTypeOverrides map[string]controller.PathTypePolicy
+	var tlsListeners bool
+	var tlsRedirect bool
+	var convertAcmeSolvers bool
+	var annotateIngress bool
+	var retireSource string
+	var retireRequiresVerification bool
+	var retireRequiresConvertible bool
+	var enableIngressFreeze bool
+	var maxRoutesPerNamespace int
+	var conversionPolicyFile string
+	var extensionRefMappingsFile string
+	var sourceRangePolicyTemplateFile string
+	var rateLimitPolicyTemplateFile string
+	var backendConfigPolicyTemplateFile string
+	var annotationPoliciesFile string
+	var crossNamespaceBackends bool
+	var autoGrant bool
+	var gatewayNamespaceRoutes bool
+	var auditLog string
+	var auditConfigMap string
+	var tcpServicesConfigMap string
+	var udpServicesConfigMap string
+	var provisionGateway string
+	var provisionGatewayClass string
+	var managedGateway string
+	var managedListenerSet bool
+	var openShiftRoutes bool
+	var traefikIngressRoutes bool
+	var contourHTTPProxies bool
+	var istioVirtualServices bool
+	var ambassadorMappings bool
+	var retryPolicies bool
+	var auditConfigMapSize int
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -73,6 +181,210 @@ func main() {
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	flag.BoolVar(&requireHostname, "require-hostname", false,
 		"If set, HTTPRoutes will be only be created for Ingress rules that have a host defined")
+	flag.Func("hostname-rewrites", "Comma-separated list of old=new pairs rewriting the hostnames of Ingresses in "+
+		"their HTTPRoutes, e.g. app.example.com=app.example.net", func(value string) error {
+		var err error
+		hostnameRewrites, err = controller.ParseHostnameRewrites(value)
+		return err
+	})
+	flag.Func("annotation-prefix", "Prefix of the annotations the controller recognizes on Ingresses and Namespaces, "+
+		"e.g. to pin a Gateway, "+controller.DefaultAnnotationPrefix+" if unset", func(value string) error {
+		var err error
+		annotationPrefix, err = controller.ParseAnnotationPrefix(value)
+		return err
+	})
+	flag.StringVar(&parentRefStrategy, "parent-ref-strategy", string(controller.ParentRefStrategyListener),
+		"How HTTPRoutes reference the Gateways they attach to: listener (every matching listener by sectionName), "+
+			"port (the port of every matching listener) or gateway (every matching Gateway once, leaving the "+
+			"listener selection to the Gateway)")
+	flag.BoolVar(&collapseParentRefs, "collapse-parent-refs", false,
+		"If set, listeners of a Gateway are referenced by a single parentRef when all of them match a hostname")
+	flag.Func("ingress-class", "Only convert the Ingresses of this IngressClass, from spec.ingressClassName or the "+
+		"kubernetes.io/ingress.class annotation. Can be repeated. All Ingresses are converted if unset.", func(value string) error {
+		ingressClasses = append(ingressClasses, value)
+		return nil
+	})
+	flag.BoolVar(&supportedFeatures, "supported-features", false,
+		"If set, the HTTPRoutes are adapted to the status.supportedFeatures of the GatewayClasses of their Gateways, "+
+			"leaving out what the Gateways do not support")
+	flag.BoolVar(&requireReadyGateways, "require-ready-gateways", false,
+		"If set, HTTPRoutes only attach to the Gateways reporting both the Accepted and Programmed conditions")
+	flag.StringVar(&defaultGateway, "default-gateway", "", "Attach the HTTPRoutes of a hostname that matches no listener to this Gateway, as namespace/name or "+
+		"namespace/name/listener, instead of skipping them")
+	flag.Func("gateway-class", "Only attach HTTPRoutes to the Gateways of this GatewayClass. Can be repeated. "+
+		"All Gateways are candidates if unset.", func(value string) error {
+		gatewayClasses = append(gatewayClasses, gatewayv1.ObjectName(value))
+		return nil
+	})
+	flag.Func("listener-ports", "Comma-separated list of listener ports HTTPRoutes may attach to. "+
+		"If not set, listeners on any port are eligible.", func(value string) error {
+		for _, item := range strings.Split(value, ",") {
+			port, err := strconv.ParseInt(strings.TrimSpace(item), 10, 32)
+			if err != nil {
+				return err
+			}
+			listenerPorts = append(listenerPorts, int32(port))
+		}
+		return nil
+	})
+	flag.Func("listener-protocols", "Comma-separated list of listener protocols HTTPRoutes may attach to. "+
+		"If not set, HTTP and HTTPS listeners are eligible.", func(value string) error {
+		for _, item := range strings.Split(value, ",") {
+			listenerProtocols = append(listenerProtocols, gatewayv1.ProtocolType(strings.TrimSpace(item)))
+		}
+		return nil
+	})
+	flag.BoolVar(&routePerParent, "route-per-parent", false,
+		"If set, one HTTPRoute is created per hostname and Gateway instead of one HTTPRoute per hostname")
+	flag.BoolVar(&disableServiceLookups, "disable-service-lookups", false,
+		"If set, Services are never read, so named Service ports are not resolved and the backends "+
+			"referencing them are left out with an UnresolvedNamedPort warning Event.")
+	flag.StringVar(&kubeContext, "context", "",
+		"The kubeconfig context to read Ingresses from. If not set, the current context is used.")
+	flag.StringVar(&targetContext, "target-context", "",
+		"The kubeconfig context to read Gateways from and write HTTPRoutes to. "+
+			"If not set, the context Ingresses are read from is used.")
+	flag.BoolVar(&canaryBackends, "canary-backends", false,
+		"If set, traffic to a Service managed by Argo Rollouts or Flagger is split over its stable and canary Services")
+	flag.BoolVar(&tlsListeners, "tls-listeners", false,
+		"If set, the hostnames listed under spec.tls are only attached to HTTPS listeners, "+
+			"preferring the listeners using the Secret of the Ingress")
+	flag.BoolVar(&tlsRedirect, "tls-redirect", false,
+		"If set, the HTTP listeners of the hostnames listed under spec.tls redirect to HTTPS. Implies --tls-listeners.")
+	flag.BoolVar(&defaultBackendRule, "default-backend-rule", false,
+		"If set, the default backend of an Ingress receives the requests no path matches, through a catch-all rule")
+	flag.BoolVar(&ruleNames, "rule-names", false,
+		"If set, every generated rule is named after the Ingress, hostname and index of its path. "+
+			"Rule names are part of the experimental channel.")
+	flag.BoolVar(&consolidateRules, "consolidate-rules", false,
+		"If set, the rules of paths with the same backends and filters are merged into one rule with multiple matches")
+	flag.StringVar(&implementationSpecificPathType, "implementation-specific-path-type", string(controller.PathTypeRegex),
+		"The path match type of ImplementationSpecific Ingress paths: prefix, exact or regex")
+	flag.Func("implementation-specific-path-type-overrides", "Comma-separated list of class=type pairs overriding "+
+		"--implementation-specific-path-type for the Ingresses of an IngressClass, e.g. gce=prefix", func(value string) error {
+		var err error
+		implementationSpecificPathTypeOverrides, err = controller.ParsePathTypePolicyOverrides(value)
+		return err
+	})
+	flag.BoolVar(&strictPrefixMatching, "strict-prefix-matching", false,
+		"If set, Prefix paths with a trailing slash also match the path without it exactly, like an Ingress does")
+	flag.IntVar(&backendWeight, "backend-weight", 1, "The weight of the backendRefs of Ingress paths")
+	flag.BoolVar(&omitBackendWeights, "omit-backend-weights", false,
+		"If set, the backendRefs of Ingress paths have no weight, so the Gateway API default of 1 applies")
+	flag.BoolVar(&omitTimeouts, "omit-timeouts", false,
+		"If set, the nginx proxy timeout annotations are not converted, for Gateways that do not support HTTPRoute timeouts")
+	flag.BoolVar(&sessionPersistence, "session-persistence", false,
+		"If set, the nginx cookie affinity is converted to the sessionPersistence of the experimental channel")
+	flag.BoolVar(&retryPolicies, "retry-policies", false,
+		"If set, the retry policies of HTTPProxies and Mappings and the retries of VirtualServices are converted to "+
+			"the retry of the experimental channel")
+	flag.BoolVar(&traefikMiddlewareFilters, "traefik-middleware-filters", false,
+		"If set, the Traefik Middlewares in the namespace of an Ingress are referenced by ExtensionRef filters, for the Traefik Gateway provider")
+	flag.BoolVar(&conversionProfiles, "conversion-profiles", false,
+		"If set, the Ingresses of the nginx, Traefik, AWS load balancer, Azure Application Gateway and GKE Ingress "+
+			"controllers are converted with a profile for that controller, selected by their IngressClass")
+	flag.Func("profile-gateway-classes", "Comma-separated list of profile=gatewayclass pairs limiting the Gateways "+
+		"the HTTPRoutes of a conversion profile attach to, e.g. nginx=internal", func(value string) error {
+		var err error
+		profileGatewayClasses, err = controller.ParseProfileGatewayClasses(value)
+		return err
+	})
+	flag.BoolVar(&mergeHosts, "merge-hosts", false,
+		"If set, the rules of all Ingresses in a namespace with the same hostname are merged into one HTTPRoute per hostname")
+	flag.BoolVar(&appProtocolBackends, "app-protocol-backends", false,
+		"If set, HTTPRoutes whose backends all serve gRPC according to the appProtocol of their Service ports are "+
+			"converted to GRPCRoutes, and a BackendTLSPolicy is created for Services serving HTTPS")
+	flag.BoolVar(&tlsPassthroughRoutes, "tls-passthrough-routes", false,
+		"If set, the hosts of Ingresses with the nginx ssl-passthrough annotation are converted to TLSRoutes of the "+
+			"experimental channel, attached to TLS listeners in Passthrough mode, instead of HTTPRoutes")
+	flag.StringVar(&backendTLSCACertificates, "backend-tls-ca-certificates", "",
+		"ConfigMap in the namespace of each Service serving HTTPS with the CA certificates its BackendTLSPolicy "+
+			"validates against, the system CAs if empty")
+	flag.BoolVar(&convertAcmeSolvers, "convert-acme-solvers", false,
+		"If set, the HTTP01 solver Ingresses of cert-manager are converted too, so challenges are answered through the Gateways")
+	flag.BoolVar(&annotateIngress, "annotate-ingress", false,
+		"If set, the generated HTTPRoutes, the controller version and the conversion time are recorded in annotations on the Ingress")
+	flag.StringVar(&retireSource, "retire-source", "",
+		"What to do with an Ingress once all its HTTPRoutes are accepted: delete (the HTTPRoutes are kept) "+
+			"or strip-class (the Ingress is moved to a non-existent IngressClass, so the Ingress controller releases it). "+
+			"If not set, Ingresses are left alone.")
+	flag.BoolVar(&retireRequiresVerification, "retire-requires-verification", false,
+		"If set, Ingresses are only retired once annotated with ingress2httproute.lion7.dev/verified=true")
+	flag.BoolVar(&retireRequiresConvertible, "retire-requires-convertible", false,
+		"If set, Ingresses are only retired once their unconvertible annotations, such as nginx snippets, are removed")
+	flag.BoolVar(&enableIngressFreeze, "enable-ingress-freeze", false,
+		"If set, the admission webhook rejecting new Ingresses in namespaces labeled "+
+			"ingress2httproute.lion7.dev/phase=CutOver is served")
+	flag.IntVar(&maxRoutesPerNamespace, "max-routes-per-namespace", 0,
+		"The maximum number of routes generated in a namespace, 0 means unlimited. "+
+			"Namespaces can override it with the ingress2httproute.lion7.dev/max-routes annotation.")
+	flag.StringVar(&conversionPolicyFile, "conversion-policy", "",
+		"File with the conversion policy, which sets the maximum number of routes generated in every namespace "+
+			"or in single namespaces, taking precedence over --max-routes-per-namespace")
+	flag.StringVar(&extensionRefMappingsFile, "extension-ref-mappings", "",
+		"File mapping Ingress annotations to ExtensionRef filters that are added to the generated rules")
+	flag.StringVar(&sourceRangePolicyTemplateFile, "source-range-policy-template", "",
+		"File with a Go template of the vendor policy restricting the source ranges of an HTTPRoute, "+
+			"rendered for the HTTPRoutes of Ingresses with an nginx IP allow-list")
+	flag.StringVar(&rateLimitPolicyTemplateFile, "rate-limit-policy-template", "",
+		"File with a Go template of the vendor policy limiting the requests to an HTTPRoute, "+
+			"rendered for the HTTPRoutes of Ingresses with nginx rate limits")
+	flag.StringVar(&backendConfigPolicyTemplateFile, "backend-config-policy-template", "",
+		"File with a Go template of the vendor policy for the GKE BackendConfig of a Service port, "+
+			"rendered for each backend of an HTTPRoute whose Service has a BackendConfig")
+	flag.StringVar(&annotationPoliciesFile, "annotation-policies", "",
+		"File with Go templates of vendor policies keyed by Ingress annotation, "+
+			"rendered for the HTTPRoutes of Ingresses with the annotation")
+	flag.Func("external-dns-annotation", "Copy this external-dns annotation, e.g. ttl for external-dns.alpha.kubernetes.io/ttl, "+
+		"from the Ingresses onto their HTTPRoutes. Can be repeated.", func(value string) error {
+		externalDNSAnnotations = append(externalDNSAnnotations, value)
+		return nil
+	})
+	flag.BoolVar(&crossNamespaceBackends, "cross-namespace-backends", false,
+		"If set, an ExternalName Service pointing at a Service in another namespace is replaced by that Service, "+
+			"when a ReferenceGrant allows it")
+	flag.BoolVar(&autoGrant, "auto-grant", false,
+		"If set, the ReferenceGrants needed by --cross-namespace-backends are created")
+	flag.BoolVar(&gatewayNamespaceRoutes, "gateway-namespace-routes", false,
+		"If set, HTTPRoutes are created in the namespaces of their Gateways, with ReferenceGrants for their backends")
+	flag.StringVar(&tcpServicesConfigMap, "tcp-services-configmap", "",
+		"Namespace/name of the tcp-services ConfigMap of ingress-nginx, whose entries are converted to TCPRoutes "+
+			"attached to the TCP listeners on their ports")
+	flag.StringVar(&udpServicesConfigMap, "udp-services-configmap", "",
+		"Namespace/name of the udp-services ConfigMap of ingress-nginx, whose entries are converted to UDPRoutes "+
+			"attached to the UDP listeners on their ports")
+	flag.StringVar(&provisionGateway, "provision-gateway", "",
+		"Namespace/name of a Gateway to create and maintain, with a listener for each TLS host of the Ingresses")
+	flag.StringVar(&provisionGatewayClass, "provision-gateway-class", "",
+		"GatewayClass of the Gateway created by --provision-gateway")
+	flag.StringVar(&managedGateway, "managed-gateway", "",
+		"Namespace/name of an existing Gateway to add listeners to for the Ingress hosts that no listener accepts")
+	flag.BoolVar(&managedListenerSet, "managed-listener-set", false,
+		"If set, the listeners of --managed-gateway are added to an XListenerSet attached to it instead, "+
+			"and HTTPRoutes attach to the listeners of XListenerSets")
+	flag.BoolVar(&openShiftRoutes, "openshift-routes", false,
+		"If set, the Routes of OpenShift are converted like Ingresses, to HTTPRoutes or to TLSRoutes for passthrough "+
+			"Routes")
+	flag.BoolVar(&traefikIngressRoutes, "traefik-ingress-routes", false,
+		"If set, the IngressRoutes of Traefik are converted like Ingresses, to HTTPRoutes matching the requests like "+
+			"their match expressions")
+	flag.BoolVar(&contourHTTPProxies, "contour-http-proxies", false,
+		"If set, the root HTTPProxies of Contour are converted like Ingresses, with the HTTPProxies they include, "+
+			"to HTTPRoutes")
+	flag.BoolVar(&istioVirtualServices, "istio-virtual-services", false,
+		"If set, the VirtualServices of Istio that are bound to gateways are converted like Ingresses to HTTPRoutes")
+	flag.BoolVar(&ambassadorMappings, "ambassador-mappings", false,
+		"If set, the Mappings of Emissary (formerly Ambassador) are converted like Ingresses to HTTPRoutes, "+
+			"the Mappings sharing a host and match by weight")
+	flag.StringVar(&auditLog, "audit-log", "",
+		"File to append a JSON line to for every write of the controller, or - for stdout. If not set, writes are not audited.")
+	flag.StringVar(&auditConfigMap, "audit-configmap", "",
+		"Namespace/name of a ConfigMap that additionally keeps the most recent audit entries")
+	flag.IntVar(&auditConfigMapSize, "audit-configmap-size", 100, "The number of audit entries kept in --audit-configmap")
+	flag.StringVar(&profileName, "profile", "small",
+		"Tuning profile for concurrency, rate limiting, resync and caching: small (the controller-runtime defaults) "+
+			"or large (for clusters with thousands of Ingresses).")
+	impersonate := impersonationFlags(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -124,8 +436,195 @@ func main() {
 		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if impersonate.UserName == "" && len(impersonate.Groups) > 0 {
+		setupLog.Error(nil, "--as-group requires --as to be set")
+		os.Exit(1)
+	}
+
+	tuning, err := lookupProfile(profileName)
+	if err != nil {
+		setupLog.Error(err, "invalid --profile")
+		os.Exit(1)
+	}
+
+	var extensionRefMappings []controller.ExtensionRefMapping
+	if extensionRefMappingsFile != "" {
+		if extensionRefMappings, err = controller.LoadExtensionRefMappings(extensionRefMappingsFile); err != nil {
+			setupLog.Error(err, "invalid --extension-ref-mappings")
+			os.Exit(1)
+		}
+	}
+
+	var sourceRangePolicyTemplate *template.Template
+	if sourceRangePolicyTemplateFile != "" {
+		if sourceRangePolicyTemplate, err = controller.LoadPolicyTemplate(sourceRangePolicyTemplateFile); err != nil {
+			setupLog.Error(err, "invalid --source-range-policy-template")
+			os.Exit(1)
+		}
+	}
+	var rateLimitPolicyTemplate *template.Template
+	if rateLimitPolicyTemplateFile != "" {
+		if rateLimitPolicyTemplate, err = controller.LoadPolicyTemplate(rateLimitPolicyTemplateFile); err != nil {
+			setupLog.Error(err, "invalid --rate-limit-policy-template")
+			os.Exit(1)
+		}
+	}
+	var backendConfigPolicyTemplate *template.Template
+	if backendConfigPolicyTemplateFile != "" {
+		if backendConfigPolicyTemplate, err = controller.LoadPolicyTemplate(backendConfigPolicyTemplateFile); err != nil {
+			setupLog.Error(err, "invalid --backend-config-policy-template")
+			os.Exit(1)
+		}
+	}
+	var annotationPolicies []controller.AnnotationPolicy
+	if annotationPoliciesFile != "" {
+		if annotationPolicies, err = controller.LoadAnnotationPolicies(annotationPoliciesFile); err != nil {
+			setupLog.Error(err, "invalid --annotation-policies")
+			os.Exit(1)
+		}
+	}
+	var conversionPolicy *controller.ConversionPolicy
+	if conversionPolicyFile != "" {
+		if conversionPolicy, err = controller.LoadConversionPolicy(conversionPolicyFile); err != nil {
+			setupLog.Error(err, "invalid --conversion-policy")
+			os.Exit(1)
+		}
+	}
+
+	retireMode, err := controller.ParseRetireMode(retireSource)
+	if err != nil {
+		setupLog.Error(err, "invalid --retire-source")
+		os.Exit(1)
+	}
+
+	if backendWeight < 0 || backendWeight > 1000000 {
+		setupLog.Error(nil, "--backend-weight must be between 0 and 1000000")
+		os.Exit(1)
+	}
+
+	implementationSpecificPolicy, err := controller.ParsePathTypePolicy(implementationSpecificPathType)
+	if err != nil {
+		setupLog.Error(err, "invalid --implementation-specific-path-type")
+		os.Exit(1)
+	}
+	parentRefStrategyValue, err := controller.ParseParentRefStrategy(parentRefStrategy)
+	if err != nil {
+		setupLog.Error(err, "invalid --parent-ref-strategy")
+		os.Exit(1)
+	}
+	if defaultGateway != "" {
+		if _, err := controller.ParseGatewayReference(defaultGateway); err != nil {
+			setupLog.Error(err, "invalid --default-gateway")
+			os.Exit(1)
+		}
+	}
+
+	// Owner references of merged HTTPRoutes cannot point to another cluster, and the rules of a deleted
+	// Ingress would be dropped from them by the next reconcile of another owner
+	if mergeHosts && targetContext != "" && targetContext != kubeContext {
+		setupLog.Error(nil, "--merge-hosts cannot be used with --target-context")
+		os.Exit(1)
+	}
+	// The routes of the stream services are written next to their ConfigMaps
+	if (tcpServicesConfigMap != "" || udpServicesConfigMap != "") && targetContext != "" && targetContext != kubeContext {
+		setupLog.Error(nil, "--tcp-services-configmap and --udp-services-configmap cannot be used with --target-context")
+		os.Exit(1)
+	}
+	tcpServices, err := parseNamespacedName("--tcp-services-configmap", tcpServicesConfigMap)
+	if err != nil {
+		setupLog.Error(err, "invalid --tcp-services-configmap")
+		os.Exit(1)
+	}
+	udpServices, err := parseNamespacedName("--udp-services-configmap", udpServicesConfigMap)
+	if err != nil {
+		setupLog.Error(err, "invalid --udp-services-configmap")
+		os.Exit(1)
+	}
+	// The provisioned Gateway is written next to the Ingresses, whose Secrets its listeners reference
+	if provisionGateway != "" && targetContext != "" && targetContext != kubeContext {
+		setupLog.Error(nil, "--provision-gateway cannot be used with --target-context")
+		os.Exit(1)
+	}
+	if (provisionGateway == "") != (provisionGatewayClass == "") {
+		setupLog.Error(nil, "--provision-gateway and --provision-gateway-class must be set together")
+		os.Exit(1)
+	}
+	provisionedGateway, err := parseNamespacedName("--provision-gateway", provisionGateway)
+	if err != nil {
+		setupLog.Error(err, "invalid --provision-gateway")
+		os.Exit(1)
+	}
+	// The provisioned Gateway has all the listeners it needs, and only those
+	if managedGateway != "" && provisionGateway != "" {
+		setupLog.Error(nil, "--managed-gateway cannot be used with --provision-gateway")
+		os.Exit(1)
+	}
+	if managedGateway != "" && targetContext != "" && targetContext != kubeContext {
+		setupLog.Error(nil, "--managed-gateway cannot be used with --target-context")
+		os.Exit(1)
+	}
+	if managedListenerSet && managedGateway == "" {
+		setupLog.Error(nil, "--managed-listener-set requires --managed-gateway")
+		os.Exit(1)
+	}
+	listenerGateway, err := parseNamespacedName("--managed-gateway", managedGateway)
+	if err != nil {
+		setupLog.Error(err, "invalid --managed-gateway")
+		os.Exit(1)
+	}
+	if mergeHosts && retireMode == controller.RetireDelete {
+		setupLog.Error(nil, "--merge-hosts cannot be used with --retire-source=delete")
+		os.Exit(1)
+	}
+
+	// The appProtocol of a backend is read from its Service
+	if appProtocolBackends && disableServiceLookups {
+		setupLog.Error(nil, "--app-protocol-backends cannot be used with --disable-service-lookups")
+		os.Exit(1)
+	}
+
+	// Only HTTPRoutes in the namespace of a Gateway are granted access to the backends of the Ingress
+	if gatewayNamespaceRoutes && appProtocolBackends {
+		setupLog.Error(nil, "--gateway-namespace-routes cannot be used with --app-protocol-backends")
+		os.Exit(1)
+	}
+	if gatewayNamespaceRoutes && tlsPassthroughRoutes {
+		setupLog.Error(nil, "--gateway-namespace-routes cannot be used with --tls-passthrough-routes")
+		os.Exit(1)
+	}
+
+	restConfig, err := config.GetConfigWithContext(kubeContext)
+	if err != nil {
+		setupLog.Error(err, "unable to load kubeconfig")
+		os.Exit(1)
+	}
+	// Impersonation lets migrations run under a scoped identity, so the API server
+	// audit log attributes all changes to that identity.
+	restConfig.Impersonate = *impersonate
+	tuning.applyToConfig(restConfig)
+
+	var targetCluster cluster.Cluster
+	if targetContext != "" && targetContext != kubeContext {
+		targetConfig, err := config.GetConfigWithContext(targetContext)
+		if err != nil {
+			setupLog.Error(err, "unable to load kubeconfig", "context", targetContext)
+			os.Exit(1)
+		}
+		targetConfig.Impersonate = restConfig.Impersonate
+		tuning.applyToConfig(targetConfig)
+		targetCluster, err = cluster.New(targetConfig, func(o *cluster.Options) {
+			o.Scheme = scheme
+			o.Cache = tuning.cacheOptions()
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to create target cluster", "context", targetContext)
+			os.Exit(1)
+		}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  tuning.cacheOptions(),
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -148,14 +647,174 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.IngressReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		RequireHostname: requireHostname,
-	}).SetupWithManager(mgr); err != nil {
+	if targetCluster != nil {
+		if err := mgr.Add(targetCluster); err != nil {
+			setupLog.Error(err, "unable to add target cluster")
+			os.Exit(1)
+		}
+	}
+
+	auditSink, err := newAuditSink(mgr, restConfig, auditLog, auditConfigMap, auditConfigMapSize)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit log")
+		os.Exit(1)
+	}
+
+	ingressReconciler := &controller.IngressReconciler{
+		Client:                                  mgr.GetClient(),
+		Scheme:                                  mgr.GetScheme(),
+		RequireHostname:                         requireHostname,
+		HostnameRewrites:                        hostnameRewrites,
+		AnnotationPrefix:                        annotationPrefix,
+		CollapseParentRefs:                      collapseParentRefs,
+		ParentRefStrategy:                       parentRefStrategyValue,
+		ListenerPorts:                           listenerPorts,
+		ListenerProtocols:                       listenerProtocols,
+		RoutePerParent:                          routePerParent,
+		DisableServiceLookups:                   disableServiceLookups,
+		TargetCluster:                           targetCluster,
+		MaxConcurrentReconciles:                 tuning.maxConcurrentReconciles,
+		RateLimiter:                             tuning.rateLimiter(),
+		CanaryBackends:                          canaryBackends,
+		TLSListeners:                            tlsListeners,
+		TLSRedirect:                             tlsRedirect,
+		DefaultBackendRule:                      defaultBackendRule,
+		RuleNames:                               ruleNames,
+		ConsolidateRules:                        consolidateRules,
+		StrictPrefixMatching:                    strictPrefixMatching,
+		MergeHosts:                              mergeHosts,
+		GatewayClasses:                          gatewayClasses,
+		DefaultGateway:                          defaultGateway,
+		RequireReadyGateways:                    requireReadyGateways,
+		ListenerSets:                            managedListenerSet,
+		SupportedFeatures:                       supportedFeatures,
+		ConversionProfiles:                      conversionProfiles,
+		ProfileGatewayClasses:                   profileGatewayClasses,
+		IngressClasses:                          ingressClasses,
+		AppProtocolBackends:                     appProtocolBackends,
+		TLSPassthroughRoutes:                    tlsPassthroughRoutes,
+		BackendTLSCACertificates:                backendTLSCACertificates,
+		BackendWeight:                           ptr.To(int32(backendWeight)),
+		OmitBackendWeights:                      omitBackendWeights,
+		OmitTimeouts:                            omitTimeouts,
+		SessionPersistence:                      sessionPersistence,
+		RetryPolicies:                           retryPolicies,
+		TraefikMiddlewareFilters:                traefikMiddlewareFilters,
+		ImplementationSpecificPathType:          implementationSpecificPolicy,
+		ImplementationSpecificPathTypeOverrides: implementationSpecificPathTypeOverrides,
+		ConvertAcmeSolvers:                      convertAcmeSolvers,
+		AnnotateIngress:                         annotateIngress,
+		Version:                                 version(),
+		RetireSource:                            retireMode,
+		RetireRequiresVerification:              retireRequiresVerification,
+		RetireRequiresConvertible:               retireRequiresConvertible,
+		MaxRoutesPerNamespace:                   maxRoutesPerNamespace,
+		ConversionPolicy:                        conversionPolicy,
+		ExtensionRefMappings:                    extensionRefMappings,
+		SourceRangePolicyTemplate:               sourceRangePolicyTemplate,
+		RateLimitPolicyTemplate:                 rateLimitPolicyTemplate,
+		BackendConfigPolicyTemplate:             backendConfigPolicyTemplate,
+		AnnotationPolicies:                      annotationPolicies,
+		ExternalDNSAnnotations:                  externalDNSAnnotations,
+		CrossNamespaceBackends:                  crossNamespaceBackends,
+		AutoGrant:                               autoGrant,
+		GatewayNamespaceRoutes:                  gatewayNamespaceRoutes,
+		Auditor:                                 audit.Auditor{Sink: auditSink},
+		Recorder:                                mgr.GetEventRecorderFor("ingress2httproute"),
+	}
+	if err = ingressReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
 		os.Exit(1)
 	}
+	if openShiftRoutes {
+		if err = (&controller.OpenShiftRouteReconciler{
+			IngressReconciler: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "OpenShiftRoute")
+			os.Exit(1)
+		}
+	}
+	if traefikIngressRoutes {
+		if err = (&controller.TraefikIngressRouteReconciler{
+			IngressReconciler: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "TraefikIngressRoute")
+			os.Exit(1)
+		}
+	}
+	if contourHTTPProxies {
+		if err = (&controller.ContourHTTPProxyReconciler{
+			IngressReconciler: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ContourHTTPProxy")
+			os.Exit(1)
+		}
+	}
+	if istioVirtualServices {
+		if err = (&controller.IstioVirtualServiceReconciler{
+			IngressReconciler: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "IstioVirtualService")
+			os.Exit(1)
+		}
+	}
+	if ambassadorMappings {
+		if err = (&controller.AmbassadorMappingReconciler{
+			IngressReconciler: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "AmbassadorMapping")
+			os.Exit(1)
+		}
+	}
+	if tcpServices.Name != "" || udpServices.Name != "" {
+		if err = (&controller.StreamServicesReconciler{
+			Client:         mgr.GetClient(),
+			Scheme:         mgr.GetScheme(),
+			TCPServices:    tcpServices,
+			UDPServices:    udpServices,
+			GatewayClasses: gatewayClasses,
+			Auditor:        audit.Auditor{Sink: auditSink},
+			Recorder:       mgr.GetEventRecorderFor("ingress2httproute"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "StreamServices")
+			os.Exit(1)
+		}
+	}
+	if provisionedGateway.Name != "" {
+		if err = (&controller.GatewayProvisionReconciler{
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			Gateway:          provisionedGateway,
+			GatewayClassName: gatewayv1.ObjectName(provisionGatewayClass),
+			IngressClasses:   ingressClasses,
+			Auditor:          audit.Auditor{Sink: auditSink},
+			Recorder:         mgr.GetEventRecorderFor("ingress2httproute"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "GatewayProvision")
+			os.Exit(1)
+		}
+	}
+	if listenerGateway.Name != "" {
+		if err = (&controller.ListenerReconciler{
+			Client:         mgr.GetClient(),
+			Scheme:         mgr.GetScheme(),
+			Gateway:        listenerGateway,
+			ListenerSet:    managedListenerSet,
+			GatewayClasses: gatewayClasses,
+			IngressClasses: ingressClasses,
+			Auditor:        audit.Auditor{Sink: auditSink},
+			Recorder:       mgr.GetEventRecorderFor("ingress2httproute"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Listener")
+			os.Exit(1)
+		}
+	}
+	if enableIngressFreeze {
+		if err = webhookv1.SetupIngressWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Ingress")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -173,3 +832,63 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseNamespacedName returns the namespace and name of an object given as namespace/name, or an empty name if unset
+func parseNamespacedName(flagName, value string) (types.NamespacedName, error) {
+	if value == "" {
+		return types.NamespacedName{}, nil
+	}
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid %s %q, expected namespace/name", flagName, value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// newAuditSink returns the sink for the audit entries of the configured destinations, or nil if none is configured.
+// The ConfigMap is written in the background by the manager.
+func newAuditSink(mgr ctrl.Manager, restConfig *rest.Config, path, configMap string, size int) (audit.Sink, error) {
+	var sinks audit.MultiSink
+	switch path {
+	case "":
+	case "-":
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	default:
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, audit.NewWriterSink(f))
+	}
+	if configMap != "" {
+		namespace, name, ok := strings.Cut(configMap, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("invalid --audit-configmap %q, expected namespace/name", configMap)
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid --audit-configmap-size %d, must be positive", size)
+		}
+		// An uncached client, so no cluster-wide informer on ConfigMaps is started for a single object
+		c, err := client.New(restConfig, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		sink := audit.NewConfigMapSink(c, types.NamespacedName{Namespace: namespace, Name: name}, size)
+		if err := mgr.Add(sink); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return sinks, nil
+}
+
+// version returns the module version the binary was built from
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
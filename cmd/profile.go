@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// profile is a bundle of tuning options for a cluster size
+type profile struct {
+	// maxConcurrentReconciles is the number of Ingresses reconciled in parallel
+	maxConcurrentReconciles int
+	// qps and burst limit the requests to the API server
+	qps   float32
+	burst int
+	// baseDelay and maxDelay bound the per-Ingress exponential backoff after failures,
+	// bucketQPS and bucketBurst limit the overall rate of requeues
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	bucketQPS   float64
+	bucketBurst int
+	// syncPeriod is the interval after which all Ingresses are reconciled again
+	syncPeriod time.Duration
+	// stripManagedFields drops managed fields from cached objects to save memory
+	stripManagedFields bool
+}
+
+// profiles contains the presets selectable with --profile
+var profiles = map[string]profile{
+	// small matches the controller-runtime defaults, suited for clusters up to a few hundred Ingresses
+	"small": {
+		maxConcurrentReconciles: 1,
+		qps:                     20,
+		burst:                   30,
+		baseDelay:               5 * time.Millisecond,
+		maxDelay:                1000 * time.Second,
+		bucketQPS:               10,
+		bucketBurst:             100,
+		syncPeriod:              10 * time.Hour,
+	},
+	// large suits clusters with thousands of Ingresses: it reconciles in parallel, allows more
+	// API requests and requeues, resyncs less often and keeps the informer caches small
+	"large": {
+		maxConcurrentReconciles: 8,
+		qps:                     100,
+		burst:                   200,
+		baseDelay:               5 * time.Millisecond,
+		maxDelay:                300 * time.Second,
+		bucketQPS:               50,
+		bucketBurst:             500,
+		syncPeriod:              24 * time.Hour,
+		stripManagedFields:      true,
+	},
+}
+
+// lookupProfile returns the profile with the given name
+func lookupProfile(name string) (profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q, must be one of small or large", name)
+	}
+	return p, nil
+}
+
+// applyToConfig sets the client rate limits of the profile
+func (p profile) applyToConfig(config *rest.Config) {
+	config.QPS = p.qps
+	config.Burst = p.burst
+}
+
+// cacheOptions returns the informer cache options of the profile
+func (p profile) cacheOptions() cache.Options {
+	options := cache.Options{SyncPeriod: &p.syncPeriod}
+	if p.stripManagedFields {
+		options.DefaultTransform = cache.TransformStripManagedFields()
+	}
+	return options
+}
+
+// rateLimiter returns the workqueue rate limiter of the profile
+func (p profile) rateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](p.baseDelay, p.maxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(p.bucketQPS), p.bucketBurst)},
+	)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/controller"
+)
+
+// simulate converts synthetic Ingresses against synthetic Gateways in memory and reports
+// the conversion throughput, memory usage and output sizes, to capacity-plan the controller.
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	ingresses := flags.Int("ingresses", 1000, "Number of Ingresses to generate")
+	gateways := flags.Int("gateways", 10, "Number of Gateways to generate")
+	hosts := flags.Int("hosts", 2, "Number of hosts per Ingress")
+	paths := flags.Int("paths", 4, "Number of paths per host")
+	listeners := flags.Int("listeners", 2, "Number of listeners per Gateway, alternating between port 80 and 443")
+	collapseParentRefs := flags.Bool("collapse-parent-refs", false, "Simulate with --collapse-parent-refs")
+	routePerParent := flags.Bool("route-per-parent", false, "Simulate with --route-per-parent")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *ingresses < 1 || *gateways < 1 || *hosts < 1 || *paths < 1 || *listeners < 1 {
+		return fmt.Errorf("all counts must be at least 1")
+	}
+
+	// Conversion logs are not relevant for the simulation
+	ctrl.SetLogger(logr.Discard())
+
+	reconciler := &controller.IngressReconciler{
+		Scheme:             scheme,
+		CollapseParentRefs: *collapseParentRefs,
+		RoutePerParent:     *routePerParent,
+	}
+	gatewayList := generateGateways(*gateways, *listeners)
+	ingressList := make([]networkingv1.Ingress, *ingresses)
+	for i := range ingressList {
+		ingressList[i] = generateIngress(i, *gateways, *hosts, *paths)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	ctx := context.Background()
+	start := time.Now()
+	results := make([][]gatewayv1.HTTPRoute, len(ingressList))
+	for i, ingress := range ingressList {
+		routes, err := reconciler.Convert(ctx, ingress, gatewayList)
+		if err != nil {
+			return fmt.Errorf("cannot convert Ingress %s: %w", ingress.Name, err)
+		}
+		results[i] = routes
+	}
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	var routes, rules, totalSize, maxSize int
+	for _, result := range results {
+		for _, route := range result {
+			data, err := json.Marshal(route)
+			if err != nil {
+				return err
+			}
+			routes++
+			rules += len(route.Spec.Rules)
+			totalSize += len(data)
+			maxSize = max(maxSize, len(data))
+		}
+	}
+
+	printSimulation(os.Stdout, simulation{
+		ingresses: len(ingressList),
+		gateways:  len(gatewayList.Items),
+		elapsed:   elapsed,
+		allocated: after.TotalAlloc - before.TotalAlloc,
+		heap:      after.HeapAlloc,
+		routes:    routes,
+		rules:     rules,
+		totalSize: totalSize,
+		maxSize:   maxSize,
+	})
+	return nil
+}
+
+type simulation struct {
+	ingresses int
+	gateways  int
+	elapsed   time.Duration
+	allocated uint64
+	heap      uint64
+	routes    int
+	rules     int
+	totalSize int
+	maxSize   int
+}
+
+func printSimulation(w io.Writer, s simulation) {
+	_, _ = fmt.Fprintf(w, "Converted %d Ingresses against %d Gateways in %s\n", s.ingresses, s.gateways, s.elapsed)
+	_, _ = fmt.Fprintf(w, "  throughput:       %.0f Ingresses/s\n", float64(s.ingresses)/s.elapsed.Seconds())
+	_, _ = fmt.Fprintf(w, "  per Ingress:      %s\n", s.elapsed/time.Duration(s.ingresses))
+	_, _ = fmt.Fprintf(w, "  allocated:        %s (%s per Ingress)\n",
+		formatBytes(s.allocated), formatBytes(s.allocated/uint64(s.ingresses)))
+	_, _ = fmt.Fprintf(w, "  heap in use:      %s\n", formatBytes(s.heap))
+	_, _ = fmt.Fprintf(w, "  HTTPRoutes:       %d (%d rules)\n", s.routes, s.rules)
+	if s.routes > 0 {
+		_, _ = fmt.Fprintf(w, "  HTTPRoute size:   %s total, %s average, %s largest\n",
+			formatBytes(uint64(s.totalSize)), formatBytes(uint64(s.totalSize/s.routes)), formatBytes(uint64(s.maxSize)))
+	}
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// generateGateways creates Gateways that each accept a wildcard domain of their own
+func generateGateways(count, listeners int) gatewayv1.GatewayList {
+	var gateways gatewayv1.GatewayList
+	for i := range count {
+		gateway := gatewayv1.Gateway{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: gatewayv1.GroupVersion.String(),
+				Kind:       "Gateway",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("gateway-%d", i),
+				Namespace: "gateway-system",
+			},
+			Spec: gatewayv1.GatewaySpec{GatewayClassName: "simulation"},
+		}
+
+		hostname := gatewayv1.Hostname(fmt.Sprintf("*.gateway-%d.example.com", i))
+		from := gatewayv1.NamespacesFromAll
+		for j := range listeners {
+			listener := gatewayv1.Listener{
+				Name:          gatewayv1.SectionName(fmt.Sprintf("http-%d", j)),
+				Hostname:      &hostname,
+				Port:          80,
+				Protocol:      gatewayv1.HTTPProtocolType,
+				AllowedRoutes: &gatewayv1.AllowedRoutes{Namespaces: &gatewayv1.RouteNamespaces{From: &from}},
+			}
+			if j%2 == 1 {
+				listener.Name = gatewayv1.SectionName(fmt.Sprintf("https-%d", j))
+				listener.Port = 443
+				listener.Protocol = gatewayv1.HTTPSProtocolType
+			}
+			gateway.Spec.Listeners = append(gateway.Spec.Listeners, listener)
+		}
+
+		gateways.Items = append(gateways.Items, gateway)
+	}
+	return gateways
+}
+
+// generateIngress creates an Ingress whose hosts are spread over the Gateways
+func generateIngress(index, gateways, hosts, paths int) networkingv1.Ingress {
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("ingress-%d", index),
+			Namespace: fmt.Sprintf("namespace-%d", index%100),
+			UID:       types.UID(fmt.Sprintf("00000000-0000-0000-0000-%012d", index)),
+		},
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	for h := range hosts {
+		rule := networkingv1.IngressRule{
+			Host:             fmt.Sprintf("app-%d-%d.gateway-%d.example.com", index, h, (index+h)%gateways),
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}},
+		}
+		for p := range paths {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+				Path:     fmt.Sprintf("/path-%d", p),
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: fmt.Sprintf("service-%d", p),
+						Port: networkingv1.ServiceBackendPort{Number: 8080},
+					},
+				},
+			})
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, rule)
+	}
+	return ingress
+}
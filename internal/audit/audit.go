@@ -0,0 +1,288 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records every write the controller performs, with a field-level diff,
+// the Ingress that triggered it and the reason, so it can be proven what the migration changed.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Entry is a single write operation
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Verb is create, update, patch or delete
+	Verb   string    `json:"verb"`
+	Object ObjectRef `json:"object"`
+	// Ingress is the namespace/name of the Ingress that triggered the write
+	Ingress string `json:"ingress,omitempty"`
+	// Reason is a code for why the write was performed, e.g. IngressConverted
+	Reason string `json:"reason,omitempty"`
+	// Diff is the JSON patch from the previous to the new object, without server-populated fields
+	Diff []jsonpatch.Operation `json:"diff,omitempty"`
+}
+
+// ObjectRef identifies the written object
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Sink stores audit entries
+type Sink interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+// Reasons for the writes of the controller
+const (
+	ReasonIngressConverted       = "IngressConverted"
+	ReasonIngressAnnotated       = "IngressAnnotated"
+	ReasonIngressRetired         = "IngressRetired"
+	ReasonReferenceGrantRequired = "ReferenceGrantRequired"
+	ReasonSolverDeleted          = "SolverDeleted"
+	ReasonRouteStale             = "RouteStale"
+	ReasonBackendTLSRequired     = "BackendTLSRequired"
+	ReasonIngressFinalized       = "IngressFinalized"
+	ReasonSourceRangeRestricted  = "SourceRangeRestricted"
+	ReasonRateLimited            = "RateLimited"
+	ReasonBackendConfigured      = "BackendConfigured"
+	ReasonStreamServicesExposed  = "StreamServicesExposed"
+	ReasonAnnotationPolicy       = "AnnotationPolicy"
+	ReasonGatewayProvisioned     = "GatewayProvisioned"
+	ReasonListenersManaged       = "ListenersManaged"
+)
+
+type causeKey struct{}
+
+type cause struct {
+	ingress types.NamespacedName
+	reason  string
+}
+
+// WithIngress records the Ingress that triggers the writes performed with the context
+func WithIngress(ctx context.Context, ingress types.NamespacedName) context.Context {
+	c, _ := ctx.Value(causeKey{}).(cause)
+	c.ingress = ingress
+	return context.WithValue(ctx, causeKey{}, c)
+}
+
+// WithReason records the reason for the writes performed with the context
+func WithReason(ctx context.Context, reason string) context.Context {
+	c, _ := ctx.Value(causeKey{}).(cause)
+	c.reason = reason
+	return context.WithValue(ctx, causeKey{}, c)
+}
+
+// NewClient returns a client that records the writes performed through it in the sink.
+// Updated and patched objects are read first to compute the diff.
+func NewClient(c client.Client, sink Sink) client.Client {
+	return &auditClient{Client: c, sink: sink}
+}
+
+// Auditor is embedded by the reconcilers to record their writes
+type Auditor struct {
+	// Sink records every write of the controller, nothing is recorded if unset
+	Sink Sink
+}
+
+// Audited returns a client recording the writes performed through c in the sink, or c itself if auditing is disabled
+func (a Auditor) Audited(c client.Client) client.Client {
+	if a.Sink == nil {
+		return c
+	}
+	return NewClient(c, a.Sink)
+}
+
+type auditClient struct {
+	client.Client
+	sink Sink
+}
+
+func (c *auditClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.record(ctx, "create", nil, obj)
+	return nil
+}
+
+func (c *auditClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	previous := c.previous(ctx, obj)
+	if err := c.Client.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.record(ctx, "update", previous, obj)
+	return nil
+}
+
+func (c *auditClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	previous := c.previous(ctx, obj)
+	if err := c.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	c.record(ctx, "patch", previous, obj)
+	return nil
+}
+
+func (c *auditClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.Client.Delete(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.record(ctx, "delete", nil, obj)
+	return nil
+}
+
+// previous reads the object as it is before the write, or returns nil if it cannot be read
+func (c *auditClient) previous(ctx context.Context, obj client.Object) client.Object {
+	previous, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return nil
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), previous); err != nil {
+		return nil
+	}
+	return previous
+}
+
+// record records the write in the sink. The write succeeded, so failing it would only cause it to be retried:
+// errors are logged instead.
+func (c *auditClient) record(ctx context.Context, verb string, previous, obj client.Object) {
+	logger := log.FromContext(ctx)
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		logger.Error(err, "cannot record audit entry", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return
+	}
+	entry := Entry{
+		Time: time.Now().UTC(),
+		Verb: verb,
+		Object: ObjectRef{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		},
+	}
+	if cause, ok := ctx.Value(causeKey{}).(cause); ok {
+		if cause.ingress.Name != "" {
+			entry.Ingress = cause.ingress.String()
+		}
+		entry.Reason = cause.reason
+	}
+	if verb != "delete" {
+		if entry.Diff, err = diff(previous, obj); err != nil {
+			logger.Error(err, "cannot compute the diff of audit entry", "object", entry.Object)
+		}
+	}
+
+	if err := c.sink.Record(ctx, entry); err != nil {
+		logger.Error(err, "cannot record audit entry", "object", entry.Object)
+	}
+}
+
+// ignoredPaths are populated by the API server and not part of the change
+var ignoredPaths = []string{
+	"/metadata/resourceVersion",
+	"/metadata/generation",
+	"/metadata/managedFields",
+	"/metadata/creationTimestamp",
+	"/metadata/uid",
+	"/status",
+}
+
+// diff returns the JSON patch from the previous to the current object, from an empty object if there is none
+func diff(previous, current runtime.Object) ([]jsonpatch.Operation, error) {
+	from := []byte("{}")
+	if previous != nil {
+		var err error
+		if from, err = json.Marshal(previous); err != nil {
+			return nil, err
+		}
+	}
+	to, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := jsonpatch.CreatePatch(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []jsonpatch.Operation
+	for _, operation := range operations {
+		ignored := false
+		for _, path := range ignoredPaths {
+			if operation.Path == path || strings.HasPrefix(operation.Path, path+"/") {
+				ignored = true
+			}
+		}
+		if !ignored {
+			result = append(result, operation)
+		}
+	}
+	return result, nil
+}
+
+// WriterSink writes the entries as JSON lines
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink that writes to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Record writes the entry as a single line of JSON
+func (s *WriterSink) Record(_ context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// MultiSink records the entries in all sinks
+type MultiSink []Sink
+
+// Record records the entry in all sinks, and returns the errors of all sinks that failed
+func (s MultiSink) Record(ctx context.Context, entry Entry) error {
+	var errs []error
+	for _, sink := range s {
+		errs = append(errs, sink.Record(ctx, entry))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestClient(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewClient(fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), NewWriterSink(&buf))
+
+	ctx := WithIngress(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"})
+	ctx = WithReason(ctx, ReasonIngressAnnotated)
+
+	service := corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	if err := c.Create(ctx, &service); err != nil {
+		t.Fatal(err)
+	}
+	patch := client.MergeFrom(service.DeepCopy())
+	service.Annotations = map[string]string{"example.com/owner": "team-a"}
+	if err := c.Patch(ctx, &service, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %d:\n%s", len(lines), buf.String())
+	}
+	var entries []Entry
+	for _, line := range lines {
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	for i, verb := range []string{"create", "patch"} {
+		entry := entries[i]
+		if entry.Verb != verb || entry.Ingress != "default/app" || entry.Reason != ReasonIngressAnnotated {
+			t.Errorf("unexpected entry %d: %+v", i, entry)
+		}
+		if entry.Object != (ObjectRef{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "app"}) {
+			t.Errorf("unexpected object of entry %d: %+v", i, entry.Object)
+		}
+	}
+
+	// The patch only changed the annotations, server-populated fields such as the resourceVersion are left out
+	diff := entries[1].Diff
+	if len(diff) != 1 || diff[0].Operation != "add" || diff[0].Path != "/metadata/annotations" {
+		t.Errorf("unexpected diff of the patch: %+v", diff)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	if audited := (Auditor{}).Audited(c); audited != c {
+		t.Errorf("expected the client itself without a sink, got %T", audited)
+	}
+	if audited := (Auditor{Sink: NewWriterSink(&bytes.Buffer{})}).Audited(c); audited == c {
+		t.Error("expected an auditing client with a sink")
+	}
+}
+
+func TestConfigMapSink(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "migration", Name: "audit"}
+	failing := true
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if failing {
+				return errors.New("unavailable")
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+	sink := NewConfigMapSink(c, key, 3)
+	entries := func() []string {
+		configMap := corev1.ConfigMap{}
+		if err := c.Get(ctx, key, &configMap); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(configMap.Data[configMapKey], "\n"), "\n")
+	}
+
+	// Recording only buffers the entries, the oldest beyond the size are dropped
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := sink.Record(ctx, Entry{Verb: "create", Object: ObjectRef{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The entries stay buffered while the ConfigMap cannot be written
+	if err := sink.Flush(ctx); err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	failing = false
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lines := entries(); len(lines) != 3 || !strings.Contains(lines[0], `"name":"b"`) {
+		t.Errorf("unexpected entries: %v", lines)
+	}
+
+	if err := sink.Record(ctx, Entry{Verb: "delete", Object: ObjectRef{Name: "e"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lines := entries(); len(lines) != 3 || !strings.Contains(lines[0], `"name":"c"`) || !strings.Contains(lines[2], `"name":"e"`) {
+		t.Errorf("unexpected entries: %v", lines)
+	}
+}
+
+func TestTrimEntries(t *testing.T) {
+	large := strings.Repeat("x", maxEntriesSize/2)
+	lines := trimEntries([]string{"old", large, large, "new"}, 10)
+	if len(lines) != 2 || lines[0] != large || lines[1] != "new" {
+		t.Errorf("expected the entries to be trimmed to %d bytes, got %d entries", maxEntriesSize, len(lines))
+	}
+	if lines := trimEntries([]string{strings.Repeat("x", maxEntriesSize)}, 10); len(lines) != 0 {
+		t.Errorf("expected an entry larger than the ConfigMap to be dropped, got %d entries", len(lines))
+	}
+}
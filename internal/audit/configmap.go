@@ -0,0 +1,158 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// configMapKey is the key of the ConfigMap holding the entries as JSON lines
+	configMapKey = "entries"
+	// maxEntriesSize is the size in bytes the entries are trimmed to, leaving room for the metadata of the
+	// ConfigMap below the 1 MiB the API server accepts
+	maxEntriesSize = 1<<20 - 64<<10
+	// flushInterval is how often the buffered entries are written to the ConfigMap
+	flushInterval = 5 * time.Second
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
+
+// ConfigMapSink keeps the most recent entries in a ConfigMap, so they can be inspected in the cluster. The entries
+// are buffered and written in batches by Start, so recording an entry never waits for the API server.
+type ConfigMapSink struct {
+	mu       sync.Mutex
+	pending  []string
+	client   client.Client
+	key      types.NamespacedName
+	size     int
+	interval time.Duration
+}
+
+// NewConfigMapSink returns a sink that keeps the last size entries in the ConfigMap, which is created if needed.
+// The client must not record its own writes, and the sink must be started to write the entries.
+func NewConfigMapSink(c client.Client, key types.NamespacedName, size int) *ConfigMapSink {
+	return &ConfigMapSink{client: c, key: key, size: size, interval: flushInterval}
+}
+
+// Record buffers the entry until the next flush, dropping the oldest buffered entries beyond the size
+func (s *ConfigMapSink) Record(_ context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = trimEntries(append(s.pending, string(data)), s.size)
+	return nil
+}
+
+// Start flushes the buffered entries every interval until the context is done, and once more before returning
+func (s *ConfigMapSink) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("configMap", s.key)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				logger.Error(err, "cannot write audit entries")
+			}
+		case <-ctx.Done():
+			// The context of the manager is done, the last entries get a little time of their own
+			flushCtx, cancel := context.WithTimeout(context.Background(), s.interval)
+			defer cancel()
+			return s.Flush(flushCtx)
+		}
+	}
+}
+
+// Flush appends the buffered entries to the ConfigMap, dropping the oldest entries beyond its size. If the
+// ConfigMap cannot be written, the entries stay buffered for the next flush.
+func (s *ConfigMapSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := corev1.ConfigMap{}
+		if err := s.client.Get(ctx, s.key, &configMap); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			configMap.Namespace = s.key.Namespace
+			configMap.Name = s.key.Name
+			configMap.Data = map[string]string{configMapKey: joinEntries(trimEntries(pending, s.size))}
+			return s.client.Create(ctx, &configMap)
+		}
+
+		var lines []string
+		if existing := strings.TrimSuffix(configMap.Data[configMapKey], "\n"); existing != "" {
+			lines = strings.Split(existing, "\n")
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[configMapKey] = joinEntries(trimEntries(append(lines, pending...), s.size))
+		return s.client.Update(ctx, &configMap)
+	})
+	if err != nil {
+		s.mu.Lock()
+		s.pending = trimEntries(append(pending, s.pending...), s.size)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// trimEntries returns the last entries, at most size of them and at most maxEntriesSize bytes when joined
+func trimEntries(lines []string, size int) []string {
+	if len(lines) > size {
+		lines = lines[len(lines)-size:]
+	}
+	total := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		total += len(lines[i]) + 1
+		if total > maxEntriesSize {
+			return lines[i+1:]
+		}
+	}
+	return lines
+}
+
+// joinEntries returns the entries as JSON lines
+func joinEntries(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// acmeSolverLabel is set by cert-manager on the temporary Ingresses that solve HTTP01 challenges
+	acmeSolverLabel = "acme.cert-manager.io/http01-solver"
+	// acmeChallengePathPrefix is the path prefix of HTTP01 challenges
+	acmeChallengePathPrefix = "/.well-known/acme-challenge/"
+
+	// acmeSolverRouteLabel marks HTTPRoutes converted from a solver Ingress
+	acmeSolverRouteLabel = "ingress2httproute.lion7.dev/acme-solver"
+)
+
+// isAcmeSolver returns true if the Ingress was created by cert-manager to solve an HTTP01 challenge
+func isAcmeSolver(ingress networkingv1.Ingress) bool {
+	return ingress.Labels[acmeSolverLabel] == "true"
+}
+
+// prepareAcmeSolver returns a copy of the solver Ingress whose challenge paths match exactly. cert-manager uses
+// the ImplementationSpecific path type, which would become a regular expression match with the lowest
+// precedence; an exact match takes precedence over the matches of all other HTTPRoutes for the hostname.
+func prepareAcmeSolver(ingress networkingv1.Ingress) networkingv1.Ingress {
+	solver := *ingress.DeepCopy()
+	exact := networkingv1.PathTypeExact
+	for _, rule := range solver.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			if strings.HasPrefix(rule.HTTP.Paths[i].Path, acmeChallengePathPrefix) {
+				rule.HTTP.Paths[i].PathType = &exact
+			}
+		}
+	}
+	return solver
+}
+
+// deleteAcmeSolverRoutes deletes the HTTPRoutes of a deleted solver Ingress from the target cluster, where
+// they are not garbage collected. Solver Ingresses come and go with every challenge, so they would pile up.
+func (r *IngressReconciler) deleteAcmeSolverRoutes(ctx context.Context, ingress types.NamespacedName) error {
+	var routes gatewayv1.HTTPRouteList
+	if err := r.routeClient().List(ctx, &routes,
+		client.InNamespace(ingress.Namespace), client.MatchingLabels{acmeSolverRouteLabel: "true"}); err != nil {
+		return err
+	}
+
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if !isAnnotatedOwner(route.Annotations, ingressGroupKind, ingress.Namespace, ingress.Name) {
+			continue
+		}
+		if err := r.routeClient().Delete(ctx, route); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted HTTPRoute of ACME solver", "name", client.ObjectKeyFromObject(route))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// agicAnnotationPrefix is the prefix of the annotations of the Azure Application Gateway Ingress Controller
+	agicAnnotationPrefix = "appgw.ingress.kubernetes.io/"
+	// agicBackendPathPrefixAnnotation replaces the prefix of the paths of the Ingress before the requests are
+	// forwarded to the backends
+	agicBackendPathPrefixAnnotation = agicAnnotationPrefix + "backend-path-prefix"
+	// agicSSLRedirectAnnotation makes the Application Gateway redirect HTTP requests for the hosts listed under
+	// spec.tls to HTTPS
+	agicSSLRedirectAnnotation = agicAnnotationPrefix + "ssl-redirect"
+	// agicRequestTimeoutAnnotation is the number of seconds the Application Gateway waits for a backend to respond
+	agicRequestTimeoutAnnotation = agicAnnotationPrefix + "request-timeout"
+	// agicRewriteRuleSetAnnotation references a rewrite rule set of the Application Gateway
+	agicRewriteRuleSetAnnotation = agicAnnotationPrefix + "rewrite-rule-set"
+	// agicRewriteRuleSetCustomResourceAnnotation references an AzureApplicationGatewayRewrite resource
+	agicRewriteRuleSetCustomResourceAnnotation = agicAnnotationPrefix + "rewrite-rule-set-custom-resource"
+	// agicWAFPolicyAnnotation references the web application firewall policy of the paths of the Ingress
+	agicWAFPolicyAnnotation = agicAnnotationPrefix + "waf-policy-for-path"
+)
+
+// agicSSLRedirect returns true if the Application Gateway redirects the HTTP requests for a hostname of the Ingress
+// to HTTPS, given whether the hostname is listed under spec.tls
+func agicSSLRedirect(ingress networkingv1.Ingress, tls bool) bool {
+	return tls && ingress.Annotations[agicSSLRedirectAnnotation] == "true"
+}
+
+// agicBackendPathPrefixFilter returns the URLRewrite filter replacing the path of the match by the backend path
+// prefix of the Ingress, or nil if it has none. The prefix of PathPrefix matches is replaced, other matches have their
+// full path replaced.
+func agicBackendPathPrefixFilter(ingress networkingv1.Ingress, pathMatch gatewayv1.HTTPPathMatch) *gatewayv1.HTTPRouteFilter {
+	prefix := ingress.Annotations[agicBackendPathPrefixAnnotation]
+	if prefix == "" {
+		return nil
+	}
+	rewrite := &gatewayv1.HTTPURLRewriteFilter{
+		Path: &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(prefix)},
+	}
+	if pathMatch.Type != nil && *pathMatch.Type == gatewayv1.PathMatchPathPrefix {
+		rewrite.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To(prefix)}
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: rewrite}
+}
+
+// agicRequestTimeout returns the timeouts of the request-timeout annotation of the Ingress, the time the backend
+// gets to respond, or nil if it has none. An invalid timeout is ignored with an Event.
+func (r *IngressReconciler) agicRequestTimeout(ingress *networkingv1.Ingress) *gatewayv1.HTTPRouteTimeouts {
+	value, ok := ingress.Annotations[agicRequestTimeoutAnnotation]
+	if !ok {
+		return nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedTimeout",
+			fmt.Sprintf("Timeout %q of %s is not a positive number of seconds, it is not converted", value, agicRequestTimeoutAnnotation))
+		return nil
+	}
+	return &gatewayv1.HTTPRouteTimeouts{BackendRequest: ptr.To(formatDuration(seconds))}
+}
+
+// applyAGICAnnotations applies the backend path prefix and the request timeout of the Ingress to a rule, unless the
+// nginx annotations of the Ingress already rewrite its path or set its timeouts
+func applyAGICAnnotations(ingress networkingv1.Ingress, routeRule *gatewayv1.HTTPRouteRule, pathMatch gatewayv1.HTTPPathMatch, timeouts *gatewayv1.HTTPRouteTimeouts) {
+	if routeRule.Timeouts == nil {
+		routeRule.Timeouts = timeouts.DeepCopy()
+	}
+	rewrites := slices.ContainsFunc(routeRule.Filters, func(filter gatewayv1.HTTPRouteFilter) bool {
+		return filter.Type == gatewayv1.HTTPRouteFilterURLRewrite
+	})
+	if filter := agicBackendPathPrefixFilter(ingress, pathMatch); filter != nil && !rewrites {
+		routeRule.Filters = append(routeRule.Filters, *filter)
+	}
+}
+
+// warnUnsupportedAGIC emits an Event for the rewrite rule sets and WAF policies of the Ingress, which are resources of
+// the Application Gateway without a Gateway API equivalent
+func (r *IngressReconciler) warnUnsupportedAGIC(ingress *networkingv1.Ingress) {
+	if name, ok := ingress.Annotations[agicRewriteRuleSetAnnotation]; ok {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRewriteRuleSet",
+			fmt.Sprintf("Rewrite rule set %s of the Application Gateway cannot be expressed by HTTPRoute filters, "+
+				"the requests and responses are not rewritten", name))
+	}
+	if policy, ok := ingress.Annotations[agicWAFPolicyAnnotation]; ok {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedWAFPolicy",
+			fmt.Sprintf("WAF policy %s has no Gateway API equivalent, the requests to the HTTPRoutes are not "+
+				"inspected by it", strings.TrimSpace(policy)))
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestAGICRequestTimeout(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		agicRequestTimeoutAnnotation: "120",
+	}}}
+
+	expected := &gatewayv1.HTTPRouteTimeouts{BackendRequest: ptr.To(gatewayv1.Duration("120s"))}
+	if timeouts := r.agicRequestTimeout(ingress); !isEqual(timeouts, expected) {
+		t.Errorf("unexpected timeouts: %v", timeouts)
+	}
+
+	ingress.Annotations[agicRequestTimeoutAnnotation] = "2m"
+	if timeouts := r.agicRequestTimeout(ingress); timeouts != nil {
+		t.Errorf("expected no timeouts, got %v", timeouts)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedTimeout") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestApplyAGICAnnotations(t *testing.T) {
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		agicBackendPathPrefixAnnotation: "/backend",
+	}}}
+	exact := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/health")}
+	timeouts := &gatewayv1.HTTPRouteTimeouts{BackendRequest: ptr.To(gatewayv1.Duration("30s"))}
+
+	var routeRule gatewayv1.HTTPRouteRule
+	applyAGICAnnotations(ingress, &routeRule, exact, timeouts)
+	expected := gatewayv1.HTTPRouteRule{
+		Filters: []gatewayv1.HTTPRouteFilter{{
+			Type: gatewayv1.HTTPRouteFilterURLRewrite,
+			URLRewrite: &gatewayv1.HTTPURLRewriteFilter{Path: &gatewayv1.HTTPPathModifier{
+				Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/backend"),
+			}},
+		}},
+		Timeouts: timeouts,
+	}
+	if !isEqual(routeRule, expected) {
+		t.Errorf("unexpected rule: %+v", routeRule)
+	}
+
+	// The rewrite and timeouts of the nginx annotations win
+	nginx := gatewayv1.HTTPRouteRule{
+		Filters: []gatewayv1.HTTPRouteFilter{{
+			Type:       gatewayv1.HTTPRouteFilterURLRewrite,
+			URLRewrite: &gatewayv1.HTTPURLRewriteFilter{Hostname: ptr.To(gatewayv1.PreciseHostname("app.internal"))},
+		}},
+		Timeouts: &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("120s"))},
+	}
+	routeRule = *nginx.DeepCopy()
+	applyAGICAnnotations(ingress, &routeRule, exact, timeouts)
+	if !isEqual(routeRule, nginx) {
+		t.Errorf("unexpected rule: %+v", routeRule)
+	}
+}
+
+func TestWarnUnsupportedAGIC(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		agicRewriteRuleSetAnnotation: "add-headers",
+		agicWAFPolicyAnnotation:      "/subscriptions/abc/policies/api",
+	}}}
+
+	r.warnUnsupportedAGIC(ingress)
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRewriteRuleSet") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedWAFPolicy") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if !agicSSLRedirect(networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		agicSSLRedirectAnnotation: "true",
+	}}}, true) {
+		t.Error("expected the TLS hosts to be redirected")
+	}
+}
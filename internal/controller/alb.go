@@ -0,0 +1,353 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// albAnnotationPrefix is the prefix of the annotations of the AWS Load Balancer Controller
+	albAnnotationPrefix = "alb.ingress.kubernetes.io/"
+	// albActionsAnnotationPrefix prefixes the name of an action, a JSON object forwarding, redirecting or responding
+	// to the requests of the paths whose backend is the action
+	albActionsAnnotationPrefix = albAnnotationPrefix + "actions."
+	// albConditionsAnnotationPrefix prefixes the name of a Service or action, a JSON list of conditions the requests
+	// of its paths must match as well
+	albConditionsAnnotationPrefix = albAnnotationPrefix + "conditions."
+	// albUseAnnotationPort is the port name of a backend that is the action of the same name
+	albUseAnnotationPort = "use-annotation"
+
+	// maxRouteRuleMatches is the maximum number of matches of an HTTPRoute rule
+	maxRouteRuleMatches = 64
+)
+
+// albMethods are the methods of the requests an HTTPRoute matches
+var albMethods = []gatewayv1.HTTPMethod{
+	gatewayv1.HTTPMethodGet, gatewayv1.HTTPMethodHead, gatewayv1.HTTPMethodPost, gatewayv1.HTTPMethodPut,
+	gatewayv1.HTTPMethodDelete, gatewayv1.HTTPMethodConnect, gatewayv1.HTTPMethodOptions, gatewayv1.HTTPMethodTrace,
+	gatewayv1.HTTPMethodPatch,
+}
+
+// albAction is the value of an actions annotation
+type albAction struct {
+	Type                string                  `json:"type"`
+	TargetGroupARN      string                  `json:"targetGroupARN,omitempty"`
+	ForwardConfig       *albForwardConfig       `json:"forwardConfig,omitempty"`
+	RedirectConfig      *albRedirectConfig      `json:"redirectConfig,omitempty"`
+	FixedResponseConfig *albFixedResponseConfig `json:"fixedResponseConfig,omitempty"`
+}
+
+type albForwardConfig struct {
+	TargetGroups []albTargetGroup `json:"targetGroups"`
+}
+
+type albTargetGroup struct {
+	TargetGroupARN string              `json:"targetGroupARN,omitempty"`
+	ServiceName    string              `json:"serviceName,omitempty"`
+	ServicePort    *intstr.IntOrString `json:"servicePort,omitempty"`
+	Weight         *int32              `json:"weight,omitempty"`
+}
+
+type albRedirectConfig struct {
+	Protocol   string `json:"protocol,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Port       string `json:"port,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Query      string `json:"query,omitempty"`
+	StatusCode string `json:"statusCode"`
+}
+
+type albFixedResponseConfig struct {
+	ContentType string `json:"contentType,omitempty"`
+	MessageBody string `json:"messageBody,omitempty"`
+	StatusCode  string `json:"statusCode"`
+}
+
+// albCondition is an entry of a conditions annotation
+type albCondition struct {
+	Field                   string                `json:"field"`
+	HTTPHeaderConfig        *albHTTPHeaderConfig  `json:"httpHeaderConfig,omitempty"`
+	QueryStringConfig       *albQueryStringConfig `json:"queryStringConfig,omitempty"`
+	HTTPRequestMethodConfig *albValuesConfig      `json:"httpRequestMethodConfig,omitempty"`
+	HostHeaderConfig        *albValuesConfig      `json:"hostHeaderConfig,omitempty"`
+	PathPatternConfig       *albValuesConfig      `json:"pathPatternConfig,omitempty"`
+	SourceIPConfig          *albValuesConfig      `json:"sourceIpConfig,omitempty"`
+}
+
+type albHTTPHeaderConfig struct {
+	HTTPHeaderName string   `json:"httpHeaderName"`
+	Values         []string `json:"values"`
+}
+
+type albQueryStringConfig struct {
+	Values []albKeyValue `json:"values"`
+}
+
+type albKeyValue struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value"`
+}
+
+type albValuesConfig struct {
+	Values []string `json:"values"`
+}
+
+// albAnnotations returns the actions and conditions of the Ingress by name. Annotations that are not valid JSON are
+// ignored with an Event.
+func (r *IngressReconciler) albAnnotations(ingress *networkingv1.Ingress) (map[string]albAction, map[string][]albCondition) {
+	actions := map[string]albAction{}
+	conditions := map[string][]albCondition{}
+	for key, value := range ingress.Annotations {
+		var err error
+		if name, ok := strings.CutPrefix(key, albActionsAnnotationPrefix); ok {
+			var action albAction
+			if err = json.Unmarshal([]byte(value), &action); err == nil {
+				actions[name] = action
+			}
+		} else if name, ok := strings.CutPrefix(key, albConditionsAnnotationPrefix); ok {
+			var condition []albCondition
+			if err = json.Unmarshal([]byte(value), &condition); err == nil {
+				conditions[name] = condition
+			}
+		}
+		if err != nil {
+			r.event(ingress, corev1.EventTypeWarning, "InvalidAction",
+				fmt.Sprintf("Annotation %s is not valid JSON and is ignored: %v", key, err))
+		}
+	}
+	return actions, conditions
+}
+
+// albConditionsName returns the name of the conditions of the backend, which is the name of its Service or action
+func albConditionsName(backend networkingv1.IngressBackend) string {
+	if backend.Service == nil {
+		return ""
+	}
+	return backend.Service.Name
+}
+
+// isALBActionBackend returns true if the backend is the action of the same name
+func isALBActionBackend(backend networkingv1.IngressBackend) bool {
+	return backend.Service != nil && backend.Service.Port.Name == albUseAnnotationPort
+}
+
+// applyALBAction applies the action the backend of a path names to its rule: a forward action becomes the weighted
+// backendRefs of its target groups and a redirect action a RequestRedirect filter. Fixed responses, target groups
+// referenced by ARN and missing actions cannot be expressed: the rule is left without backends, so the Gateway
+// answers with a 500, and an Event is emitted.
+func (r *IngressReconciler) applyALBAction(ctx context.Context, ingress *networkingv1.Ingress, routeRule *gatewayv1.HTTPRouteRule, actions map[string]albAction, name string) error {
+	action, ok := actions[name]
+	if !ok {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAction",
+			fmt.Sprintf("Action %s has no %s%s annotation, its paths have no backends", name, albActionsAnnotationPrefix, name))
+		return nil
+	}
+
+	switch action.Type {
+	case "forward":
+		targetGroups := []albTargetGroup{{TargetGroupARN: action.TargetGroupARN}}
+		if action.ForwardConfig != nil {
+			targetGroups = action.ForwardConfig.TargetGroups
+		}
+		for _, targetGroup := range targetGroups {
+			if targetGroup.ServiceName == "" || targetGroup.ServicePort == nil {
+				r.event(ingress, corev1.EventTypeWarning, "UnsupportedAction",
+					fmt.Sprintf("Target group %q of action %s is not a Service and is left out", targetGroup.TargetGroupARN, name))
+				continue
+			}
+			backend := networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: targetGroup.ServiceName}}
+			if targetGroup.ServicePort.Type == intstr.Int {
+				backend.Service.Port.Number = targetGroup.ServicePort.IntVal
+			} else if number, err := strconv.Atoi(targetGroup.ServicePort.StrVal); err == nil {
+				backend.Service.Port.Number = int32(number)
+			} else if r.DisableServiceLookups {
+				log.FromContext(ctx).Info("cannot resolve named port without Service lookups",
+					"action", name, "service", targetGroup.ServiceName, "port", targetGroup.ServicePort.StrVal)
+				continue
+			} else {
+				backend.Service.Port.Name = targetGroup.ServicePort.StrVal
+			}
+			weight := r.backendWeight()
+			if targetGroup.Weight != nil {
+				weight = targetGroup.Weight
+			}
+			backendRef, err := r.mapBackendRef(ctx, ingress.Namespace, backend, weight)
+			if err != nil {
+				return err
+			}
+			routeRule.BackendRefs = append(routeRule.BackendRefs, *backendRef)
+		}
+	case "redirect":
+		if filter := r.albRedirectFilter(ingress, name, action.RedirectConfig); filter != nil {
+			routeRule.Filters = []gatewayv1.HTTPRouteFilter{*filter}
+		}
+	default:
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAction",
+			fmt.Sprintf("Action %s of type %q cannot be expressed by an HTTPRoute, its paths have no backends", name, action.Type))
+	}
+	return nil
+}
+
+// albRedirectFilter returns the RequestRedirect filter of a redirect action, or nil if it has no config. Parts of
+// the URL built from the request, e.g. www.#{host}, cannot be expressed and are left unchanged with an Event, as is
+// a query that is not #{query}.
+func (r *IngressReconciler) albRedirectFilter(ingress *networkingv1.Ingress, name string, config *albRedirectConfig) *gatewayv1.HTTPRouteFilter {
+	if config == nil {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAction",
+			fmt.Sprintf("Redirect action %s has no redirectConfig, its paths have no backends", name))
+		return nil
+	}
+
+	var unsupported []string
+	redirect := &gatewayv1.HTTPRequestRedirectFilter{StatusCode: ptr.To(http.StatusMovedPermanently)}
+	if config.StatusCode == "HTTP_302" {
+		redirect.StatusCode = ptr.To(http.StatusFound)
+	}
+	if protocol := config.Protocol; protocol != "" && protocol != "#{protocol}" {
+		redirect.Scheme = ptr.To(strings.ToLower(protocol))
+	}
+	if host := config.Host; host != "" && host != "#{host}" {
+		if strings.Contains(host, "#{") {
+			unsupported = append(unsupported, "host "+host)
+		} else {
+			redirect.Hostname = ptr.To(gatewayv1.PreciseHostname(host))
+		}
+	}
+	if port := config.Port; port != "" && port != "#{port}" {
+		if number, err := strconv.Atoi(port); err == nil {
+			redirect.Port = ptr.To(gatewayv1.PortNumber(number))
+		} else {
+			unsupported = append(unsupported, "port "+port)
+		}
+	}
+	if path := config.Path; path != "" && path != "/#{path}" {
+		if strings.Contains(path, "#{") {
+			unsupported = append(unsupported, "path "+path)
+		} else {
+			redirect.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(path)}
+		}
+	}
+	if query := config.Query; query != "" && query != "#{query}" {
+		unsupported = append(unsupported, "query "+query)
+	}
+	if len(unsupported) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAction",
+			fmt.Sprintf("The %s of redirect action %s cannot be expressed by a RequestRedirect filter and are left unchanged",
+				strings.Join(unsupported, ", "), name))
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: redirect}
+}
+
+// albConditionMatches returns the matches of a rule extended with the conditions of its backend. The values of a
+// condition are alternatives, so each of them gets a copy of the matches. Host, path and source IP conditions cannot
+// be expressed by a match and are left out with an Event, as are conditions needing more matches than a rule holds.
+func (r *IngressReconciler) albConditionMatches(ingress *networkingv1.Ingress, name string, matches []gatewayv1.HTTPRouteMatch, conditions []albCondition) []gatewayv1.HTTPRouteMatch {
+	result := matches
+	var unsupported []string
+	for _, condition := range conditions {
+		var alternatives []func(*gatewayv1.HTTPRouteMatch)
+		switch {
+		case condition.Field == "http-header" && condition.HTTPHeaderConfig != nil:
+			headerName := gatewayv1.HTTPHeaderName(condition.HTTPHeaderConfig.HTTPHeaderName)
+			for _, value := range condition.HTTPHeaderConfig.Values {
+				matchType, matchValue := albValueMatch(value)
+				alternatives = append(alternatives, func(match *gatewayv1.HTTPRouteMatch) {
+					match.Headers = append(match.Headers, gatewayv1.HTTPHeaderMatch{
+						Type: ptr.To(gatewayv1.HeaderMatchType(matchType)), Name: headerName, Value: matchValue,
+					})
+				})
+			}
+		case condition.Field == "query-string" && condition.QueryStringConfig != nil:
+			for _, value := range condition.QueryStringConfig.Values {
+				if value.Key == "" {
+					unsupported = append(unsupported, "query-string without key")
+					continue
+				}
+				matchType, matchValue := albValueMatch(value.Value)
+				alternatives = append(alternatives, func(match *gatewayv1.HTTPRouteMatch) {
+					match.QueryParams = append(match.QueryParams, gatewayv1.HTTPQueryParamMatch{
+						Type: ptr.To(gatewayv1.QueryParamMatchType(matchType)), Name: gatewayv1.HTTPHeaderName(value.Key), Value: matchValue,
+					})
+				})
+			}
+		case condition.Field == "http-request-method" && condition.HTTPRequestMethodConfig != nil:
+			for _, value := range condition.HTTPRequestMethodConfig.Values {
+				method := gatewayv1.HTTPMethod(strings.ToUpper(value))
+				if !slices.Contains(albMethods, method) {
+					unsupported = append(unsupported, "http-request-method "+value)
+					continue
+				}
+				alternatives = append(alternatives, func(match *gatewayv1.HTTPRouteMatch) {
+					match.Method = ptr.To(method)
+				})
+			}
+		default:
+			unsupported = append(unsupported, condition.Field)
+			continue
+		}
+
+		if len(alternatives) == 0 {
+			continue
+		}
+		if len(result)*len(alternatives) > maxRouteRuleMatches {
+			unsupported = append(unsupported, condition.Field)
+			continue
+		}
+		var extended []gatewayv1.HTTPRouteMatch
+		for _, match := range result {
+			for _, alternative := range alternatives {
+				copied := *match.DeepCopy()
+				alternative(&copied)
+				extended = append(extended, copied)
+			}
+		}
+		result = extended
+	}
+	if len(unsupported) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedCondition",
+			fmt.Sprintf("Conditions %s of %s cannot be expressed by HTTPRoute matches, its paths match without them",
+				strings.Join(unsupported, ", "), name))
+	}
+	return result
+}
+
+// albValueMatch returns the match type and value of a condition value, where * and ? are wildcards for any and a
+// single character
+func albValueMatch(value string) (string, string) {
+	if !strings.ContainsAny(value, "*?") {
+		return string(gatewayv1.HeaderMatchExact), value
+	}
+	pattern := regexp.QuoteMeta(value)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return string(gatewayv1.HeaderMatchRegularExpression), "^" + pattern + "$"
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestALBActions(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Annotations: map[string]string{
+		albActionsAnnotationPrefix + "https": `{"type":"redirect","redirectConfig":{"protocol":"HTTPS","port":"443",` +
+			`"host":"www.#{host}","query":"a=b","statusCode":"HTTP_301"}}`,
+		albActionsAnnotationPrefix + "arn":     `{"type":"forward","targetGroupARN":"arn:aws:elasticloadbalancing:tg"}`,
+		albActionsAnnotationPrefix + "fixed":   `{"type":"fixed-response","fixedResponseConfig":{"statusCode":"503"}}`,
+		albActionsAnnotationPrefix + "invalid": `{"type":`,
+	}}}
+
+	actions, _ := r.albAnnotations(ingress)
+	if len(actions) != 3 {
+		t.Errorf("expected 3 actions, got %d", len(actions))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidAction") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	var routeRule gatewayv1.HTTPRouteRule
+	if err := r.applyALBAction(context.Background(), ingress, &routeRule, actions, "https"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+		RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+			Scheme:     ptr.To("https"),
+			Port:       ptr.To(gatewayv1.PortNumber(443)),
+			StatusCode: ptr.To(301),
+		},
+	}}
+	if !isEqual(routeRule.Filters, expected) {
+		t.Errorf("unexpected filters: %v", routeRule.Filters)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "host www.#{host}, query a=b") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// Actions that cannot be expressed leave the rule without backends
+	for _, name := range []string{"arn", "fixed", "missing"} {
+		routeRule = gatewayv1.HTTPRouteRule{}
+		if err := r.applyALBAction(context.Background(), ingress, &routeRule, actions, name); err != nil {
+			t.Fatal(err)
+		}
+		if len(routeRule.BackendRefs) != 0 || len(routeRule.Filters) != 0 {
+			t.Errorf("expected action %s to have no backends, got %v", name, routeRule)
+		}
+		if event := <-recorder.Events; !strings.Contains(event, "UnsupportedAction") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+}
+
+func TestALBConditionMatches(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		albConditionsAnnotationPrefix + "app": `[` +
+			`{"field":"query-string","queryStringConfig":{"values":[{"key":"version","value":"v?"},{"value":"beta"}]}},` +
+			`{"field":"source-ip","sourceIpConfig":{"values":["10.0.0.0/8"]}},` +
+			`{"field":"http-request-method","httpRequestMethodConfig":{"values":["get","post"]}}]`,
+	}}}
+	_, conditions := r.albAnnotations(ingress)
+	path := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")}
+
+	matches := r.albConditionMatches(ingress, "app", []gatewayv1.HTTPRouteMatch{{Path: &path}}, conditions["app"])
+	version := []gatewayv1.HTTPQueryParamMatch{{
+		Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "version", Value: "^v.$",
+	}}
+	expected := []gatewayv1.HTTPRouteMatch{
+		{Path: &path, QueryParams: version, Method: ptr.To(gatewayv1.HTTPMethodGet)},
+		{Path: &path, QueryParams: version, Method: ptr.To(gatewayv1.HTTPMethodPost)},
+	}
+	if !isEqual(matches, expected) {
+		t.Errorf("unexpected matches: %v", matches)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "query-string without key, source-ip") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	for _, key := range []string{albActionsAnnotationPrefix + "app", albConditionsAnnotationPrefix + "app"} {
+		if support := r.AnnotationSupport(key); support != AnnotationConverted {
+			t.Errorf("expected %s to be converted, got %s", key, support)
+		}
+	}
+}
@@ -0,0 +1,710 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// AmbassadorMappingGVK is the kind of the Mappings of Emissary, formerly Ambassador, which are converted by the
+// AmbassadorMappingReconciler
+var AmbassadorMappingGVK = schema.GroupVersionKind{Group: "getambassador.io", Version: "v3alpha1", Kind: "Mapping"}
+
+const (
+	// ambassadorMappingKind is the kind of the backend of the Ingress path a group of Mappings is mapped to, named
+	// after the Mapping the group is converted with
+	ambassadorMappingKind = "AmbassadorMapping"
+	// ambassadorDefaultRewrite is the prefix the prefix of a Mapping without a rewrite is rewritten to
+	ambassadorDefaultRewrite = "/"
+	// ambassadorDefaultRedirectCode is the status code of a redirect without a redirect response code
+	ambassadorDefaultRedirectCode = 301
+	// ambassadorDefaultRetries is the number of retries of a retry policy without a number of retries
+	ambassadorDefaultRetries = 1
+)
+
+// ambassadorMappingSpec is the part of the spec of a Mapping of Emissary that is converted
+type ambassadorMappingSpec struct {
+	Hostname              string                 `json:"hostname,omitempty"`
+	Host                  string                 `json:"host,omitempty"`
+	HostRegex             bool                   `json:"host_regex,omitempty"`
+	Prefix                string                 `json:"prefix,omitempty"`
+	PrefixRegex           bool                   `json:"prefix_regex,omitempty"`
+	PrefixExact           bool                   `json:"prefix_exact,omitempty"`
+	Method                string                 `json:"method,omitempty"`
+	MethodRegex           bool                   `json:"method_regex,omitempty"`
+	Headers               map[string]any         `json:"headers,omitempty"`
+	RegexHeaders          map[string]string      `json:"regex_headers,omitempty"`
+	QueryParameters       map[string]any         `json:"query_parameters,omitempty"`
+	RegexQueryParameters  map[string]string      `json:"regex_query_parameters,omitempty"`
+	Rewrite               *string                `json:"rewrite,omitempty"`
+	HostRewrite           string                 `json:"host_rewrite,omitempty"`
+	Service               string                 `json:"service,omitempty"`
+	Weight                int32                  `json:"weight,omitempty"`
+	Shadow                bool                   `json:"shadow,omitempty"`
+	AddRequestHeaders     map[string]any         `json:"add_request_headers,omitempty"`
+	AddResponseHeaders    map[string]any         `json:"add_response_headers,omitempty"`
+	RemoveRequestHeaders  []string               `json:"remove_request_headers,omitempty"`
+	RemoveResponseHeaders []string               `json:"remove_response_headers,omitempty"`
+	TimeoutMS             *int                   `json:"timeout_ms,omitempty"`
+	RetryPolicy           *ambassadorRetryPolicy `json:"retry_policy,omitempty"`
+	HostRedirect          bool                   `json:"host_redirect,omitempty"`
+	PathRedirect          string                 `json:"path_redirect,omitempty"`
+	PrefixRedirect        string                 `json:"prefix_redirect,omitempty"`
+	RedirectResponseCode  int                    `json:"redirect_response_code,omitempty"`
+}
+
+type ambassadorRetryPolicy struct {
+	RetryOn       string `json:"retry_on,omitempty"`
+	NumRetries    int    `json:"num_retries,omitempty"`
+	PerTryTimeout string `json:"per_try_timeout,omitempty"`
+}
+
+// ambassadorMapping is a Mapping with its decoded spec and the match of its prefix, method, headers and query
+// parameters
+type ambassadorMapping struct {
+	object *unstructured.Unstructured
+	spec   ambassadorMappingSpec
+	host   string
+	match  gatewayv1.HTTPRouteMatch
+}
+
+// AmbassadorMappingReconciler converts the Mappings of Emissary to HTTPRoutes. Emissary forwards the requests of the
+// Mappings with the same host and match, a group, to their Services by weight. Each group of Mappings in a namespace
+// is mapped to an Ingress with a path for its host, which is converted like any other Ingress, so the Mappings attach
+// to the Gateways of their hosts. The rule converted from the path then matches, forwards and modifies the requests as
+// the Mappings of the group do. The generated HTTPRoutes are owned by the first Mapping of the group.
+type AmbassadorMappingReconciler struct {
+	// IngressReconciler converts the Ingresses the Mappings are mapped to, with its settings. The features that write
+	// to an Ingress, such as annotating or retiring it, do not apply to Mappings.
+	*IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=getambassador.io,resources=mappings,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=getambassador.io,resources=mappings/finalizers,verbs=update
+
+// Reconcile converts a Mapping to the HTTPRoutes that should exist for it, and deletes the stale ones. The HTTPRoutes
+// of a deleted Mapping are garbage collected, those in the namespaces of their Gateways are deleted by its finalizer.
+func (r *AmbassadorMappingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	mapping := &unstructured.Unstructured{}
+	mapping.SetGroupVersionKind(AmbassadorMappingGVK)
+	if err := r.Get(ctx, req.NamespacedName, mapping); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !mapping.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalizeSource(audit.WithReason(ctx, audit.ReasonIngressFinalized), mapping)
+	}
+
+	converter := r.sourceConverter(mapping)
+	ingress, err := r.AmbassadorMappingIngress(ctx, mapping)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if converter.isPaused(ingress) {
+		logger.V(1).Info("skipping paused Mapping")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := converter.listGateways(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gateways = converter.candidateGateways(gateways)
+
+	// Only the first Mapping of a group has HTTPRoutes
+	if converter.placesRoutes() && len(ingress.Spec.Rules) > 0 {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), mapping); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	httpRoutes, convertErr := r.ConvertAmbassadorMapping(ctx, mapping, ingress, gateways)
+	return converter.applyRoutes(ctx, ingress, gateways, httpRoutes, nil, convertErr)
+}
+
+// ConvertAmbassadorMapping maps the Mapping, with the Ingress returned by AmbassadorMappingIngress, to the HTTPRoutes
+// that should exist for it, given the available Gateways. The rule converted from the path of the Ingress matches the
+// requests as the Mapping does, forwards them to the Services of its group by weight, mirrors them to those of its
+// shadows, or redirects them, and modifies them with the rewrites, headers and timeouts of the Mapping, and with
+// RetryPolicies its retries.
+func (r *AmbassadorMappingReconciler) ConvertAmbassadorMapping(ctx context.Context, mapping *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	converter := r.sourceConverter(mapping)
+	converter.completeSourceRules = func(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) error {
+		group, err := r.ambassadorGroup(ctx, mapping)
+		if err != nil {
+			return err
+		}
+		for i := range httpRoutes {
+			rules := httpRoutes[i].Spec.Rules
+			for j := range rules {
+				if name, ok := sourceRuleName(rules[j], ambassadorMappingKind); !ok || name != mapping.GetName() || len(group) == 0 {
+					continue
+				}
+				if err := r.completeAmbassadorRule(ctx, mapping, group, &rules[j]); err != nil {
+					return err
+				}
+			}
+			slices.SortStableFunc(rules, compareHTTPRouteRule)
+		}
+		return nil
+	}
+	return converter.Convert(ctx, ingress, gateways)
+}
+
+// AmbassadorMappingIngress returns the Ingress the Mapping is mapped to. It carries the kind, name and UID of the
+// Mapping, so the Mapping owns the generated HTTPRoutes, and its annotations, so the annotations of the controller
+// apply. The first Mapping of a group has a path for its hostname, where * matches any host; the other Mappings of the
+// group have none, as they are converted with it. The fields that are not converted, and Mappings that cannot be, are
+// reported with an Event.
+func (r *AmbassadorMappingReconciler) AmbassadorMappingIngress(ctx context.Context, mapping *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	converter := r.sourceConverter(mapping)
+
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: AmbassadorMappingGVK.GroupVersion().String(),
+			Kind:       AmbassadorMappingGVK.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        mapping.GetName(),
+			Namespace:   mapping.GetNamespace(),
+			UID:         mapping.GetUID(),
+			Annotations: make(map[string]string),
+		},
+	}
+	for key, value := range mapping.GetAnnotations() {
+		ingress.Annotations[key] = value
+	}
+
+	if unconverted := unconvertedFields(mapping.Object["spec"], r.ambassadorConvertedFields(), "spec"); len(unconverted) > 0 {
+		converter.event(mapping, corev1.EventTypeWarning, "UnconvertedFields",
+			fmt.Sprintf("Fields %s have no HTTPRoute equivalent and are not converted", strings.Join(unconverted, ", ")))
+	}
+	if _, err := decodeAmbassadorMapping(mapping); err != nil {
+		converter.event(mapping, corev1.EventTypeWarning, "UnsupportedRoute",
+			fmt.Sprintf("The Mapping is not converted: %v", err))
+		return ingress, nil
+	}
+
+	group, err := r.ambassadorGroup(ctx, mapping)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	if len(group) == 0 || group[0].object.GetName() != mapping.GetName() {
+		return ingress, nil
+	}
+	ingress.Spec.Rules = []networkingv1.IngressRule{{
+		Host: group[0].host,
+		IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{
+			Path:     "/",
+			PathType: ptr.To(networkingv1.PathTypePrefix),
+			Backend:  sourceRuleBackend(ambassadorMappingKind, mapping.GetName()),
+		}}}},
+	}}
+	return ingress, nil
+}
+
+// decodeAmbassadorMapping returns the Mapping with its spec, host and match, or an error if the Mapping has no
+// HTTPRoute equivalent
+func decodeAmbassadorMapping(mapping *unstructured.Unstructured) (ambassadorMapping, error) {
+	result := ambassadorMapping{object: mapping}
+	content, _, err := unstructured.NestedMap(mapping.UnstructuredContent(), "spec")
+	if err != nil {
+		return result, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &result.spec); err != nil {
+		return result, err
+	}
+	spec := result.spec
+	switch {
+	case spec.Prefix == "":
+		return result, fmt.Errorf("it has no prefix")
+	case spec.Service == "":
+		return result, fmt.Errorf("it has no service")
+	case spec.HostRegex:
+		return result, fmt.Errorf("host regular expressions have no HTTPRoute equivalent")
+	case spec.MethodRegex:
+		return result, fmt.Errorf("methods can only be matched exactly")
+	}
+
+	result.host = strings.ToLower(cmp.Or(spec.Hostname, spec.Host))
+	if result.host == "*" {
+		result.host = ""
+	}
+	result.match, err = ambassadorMatch(spec)
+	return result, err
+}
+
+// ambassadorMatch returns the HTTPRoute match of the prefix, method, headers and query parameters of a Mapping. A
+// header or query parameter of true only has to be present.
+func ambassadorMatch(spec ambassadorMappingSpec) (gatewayv1.HTTPRouteMatch, error) {
+	match := gatewayv1.HTTPRouteMatch{
+		Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To(spec.Prefix)},
+	}
+	switch {
+	case spec.PrefixRegex:
+		match.Path.Type = ptr.To(gatewayv1.PathMatchRegularExpression)
+	case spec.PrefixExact:
+		match.Path.Type = ptr.To(gatewayv1.PathMatchExact)
+	}
+	if spec.Method != "" {
+		match.Method = ptr.To(gatewayv1.HTTPMethod(strings.ToUpper(spec.Method)))
+	}
+
+	headers := map[string]gatewayv1.HTTPHeaderMatch{}
+	for name, value := range spec.Headers {
+		matchType, matchValue, err := ambassadorMatchValue(value)
+		if err != nil {
+			return match, fmt.Errorf("header %s: %w", name, err)
+		}
+		headers[name] = gatewayv1.HTTPHeaderMatch{Type: ptr.To(gatewayv1.HeaderMatchType(matchType)), Name: gatewayv1.HTTPHeaderName(name), Value: matchValue}
+	}
+	for name, value := range spec.RegexHeaders {
+		headers[name] = gatewayv1.HTTPHeaderMatch{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: gatewayv1.HTTPHeaderName(name), Value: value}
+	}
+	for _, name := range sortedKeys(headers) {
+		match.Headers = append(match.Headers, headers[name])
+	}
+
+	queryParams := map[string]gatewayv1.HTTPQueryParamMatch{}
+	for name, value := range spec.QueryParameters {
+		matchType, matchValue, err := ambassadorMatchValue(value)
+		if err != nil {
+			return match, fmt.Errorf("query parameter %s: %w", name, err)
+		}
+		queryParams[name] = gatewayv1.HTTPQueryParamMatch{Type: ptr.To(gatewayv1.QueryParamMatchType(matchType)), Name: gatewayv1.HTTPHeaderName(name), Value: matchValue}
+	}
+	for name, value := range spec.RegexQueryParameters {
+		queryParams[name] = gatewayv1.HTTPQueryParamMatch{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: gatewayv1.HTTPHeaderName(name), Value: value}
+	}
+	for _, name := range sortedKeys(queryParams) {
+		match.QueryParams = append(match.QueryParams, queryParams[name])
+	}
+	return match, nil
+}
+
+// ambassadorMatchValue returns the match type and value of the value of a header or query parameter, which matches
+// exactly, or any value if it is true
+func ambassadorMatchValue(value any) (string, string, error) {
+	switch v := value.(type) {
+	case string:
+		return string(gatewayv1.HeaderMatchExact), v, nil
+	case bool:
+		if !v {
+			return "", "", fmt.Errorf("absence has no HTTPRoute equivalent")
+		}
+		return string(gatewayv1.HeaderMatchRegularExpression), ".*", nil
+	default:
+		return "", "", fmt.Errorf("%v is not a string", value)
+	}
+}
+
+// ambassadorConvertedFields returns the fields of the spec of a Mapping that are converted with the settings of the
+// reconciler
+func (r *AmbassadorMappingReconciler) ambassadorConvertedFields() fieldSet {
+	fields := fieldSet{
+		"hostname": nil, "host": nil, "host_regex": nil,
+		"prefix": nil, "prefix_regex": nil, "prefix_exact": nil,
+		"method": nil, "method_regex": nil,
+		"headers": nil, "regex_headers": nil, "query_parameters": nil, "regex_query_parameters": nil,
+		"rewrite": nil, "host_rewrite": nil,
+		"service": nil, "weight": nil, "shadow": nil,
+		"add_request_headers": nil, "add_response_headers": nil,
+		"remove_request_headers": nil, "remove_response_headers": nil,
+		"host_redirect": nil, "path_redirect": nil, "prefix_redirect": nil, "redirect_response_code": nil,
+	}
+	retry := fieldSet{}
+	if !r.OmitTimeouts {
+		fields["timeout_ms"] = nil
+		retry["per_try_timeout"] = nil
+	}
+	if r.RetryPolicies {
+		retry["retry_on"] = nil
+		retry["num_retries"] = nil
+	}
+	fields["retry_policy"] = retry
+	return fields
+}
+
+// ambassadorGroup returns the Mappings in the namespace of the Mapping with the same host, match and kind, forwarding
+// or redirecting, as the Mapping: the Mappings Emissary balances the requests over. The Mappings forwarding rather
+// than mirroring come first, ordered by name, the first of which converts the group. It returns no Mappings if the
+// Mapping cannot be converted.
+func (r *AmbassadorMappingReconciler) ambassadorGroup(ctx context.Context, mapping *unstructured.Unstructured) ([]ambassadorMapping, error) {
+	self, err := decodeAmbassadorMapping(mapping)
+	if err != nil {
+		return nil, nil
+	}
+	key, err := ambassadorGroupKey(self)
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := &unstructured.UnstructuredList{}
+	mappings.SetGroupVersionKind(AmbassadorMappingGVK.GroupVersion().WithKind(AmbassadorMappingGVK.Kind + "List"))
+	if err := r.List(ctx, mappings, client.InNamespace(mapping.GetNamespace())); err != nil {
+		return nil, err
+	}
+	var group []ambassadorMapping
+	for i := range mappings.Items {
+		item := &mappings.Items[i]
+		if item.GetName() == mapping.GetName() {
+			group = append(group, self)
+			continue
+		}
+		if !item.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		other, err := decodeAmbassadorMapping(item)
+		if err != nil {
+			continue
+		}
+		if otherKey, err := ambassadorGroupKey(other); err != nil || otherKey != key {
+			continue
+		}
+		group = append(group, other)
+	}
+	if !slices.ContainsFunc(group, func(m ambassadorMapping) bool { return m.object.GetName() == mapping.GetName() }) {
+		group = append(group, self)
+	}
+	slices.SortFunc(group, func(a, b ambassadorMapping) int {
+		if a.spec.Shadow != b.spec.Shadow {
+			if a.spec.Shadow {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.object.GetName(), b.object.GetName())
+	})
+	return group, nil
+}
+
+// ambassadorGroupKey returns the key of the group of the Mapping
+func ambassadorGroupKey(mapping ambassadorMapping) (string, error) {
+	key, err := json.Marshal(struct {
+		Host     string                   `json:"host"`
+		Match    gatewayv1.HTTPRouteMatch `json:"match"`
+		Redirect bool                     `json:"redirect"`
+	}{mapping.host, mapping.match, mapping.spec.HostRedirect})
+	return string(key), err
+}
+
+// completeAmbassadorRule makes the rule converted from the path of the first Mapping of the group match the requests
+// as the Mappings do, and forward them to their Services by weight, mirror them to the Services of the shadows, or
+// redirect them
+func (r *AmbassadorMappingReconciler) completeAmbassadorRule(ctx context.Context, mapping *unstructured.Unstructured, group []ambassadorMapping, rule *gatewayv1.HTTPRouteRule) error {
+	first := group[0]
+	rule.Matches = []gatewayv1.HTTPRouteMatch{*first.match.DeepCopy()}
+	rule.BackendRefs = nil
+
+	if first.spec.HostRedirect {
+		rule.Filters = mergeHeaderFilters(append(rule.Filters, ambassadorRedirectFilter(first.spec)))
+		return nil
+	}
+
+	var backends []ambassadorMapping
+	for _, member := range group {
+		if !member.spec.Shadow {
+			backends = append(backends, member)
+		}
+	}
+	weights := ambassadorWeights(backends)
+
+	filters := rule.Filters
+	if len(backends) <= 1 {
+		filters = append(filters, ambassadorHeaderFilters(first.spec)...)
+	}
+	if rewrite := r.ambassadorRewriteFilter(mapping, first); rewrite != nil {
+		filters = append(filters, *rewrite)
+	}
+	for _, member := range group {
+		weight := r.backendWeight()
+		if len(backends) > 1 {
+			weight = ptr.To(weights[member.object.GetName()])
+		}
+		backendRef, err := r.ambassadorBackendRef(ctx, mapping, member.spec.Service, weight)
+		if err != nil {
+			return err
+		}
+		if backendRef == nil {
+			continue
+		}
+		if member.spec.Shadow {
+			filters = append(filters, gatewayv1.HTTPRouteFilter{
+				Type:          gatewayv1.HTTPRouteFilterRequestMirror,
+				RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{BackendRef: backendRef.BackendObjectReference},
+			})
+			continue
+		}
+		if len(backends) > 1 {
+			backendRef.Filters = ambassadorHeaderFilters(member.spec)
+		}
+		rule.BackendRefs = append(rule.BackendRefs, *backendRef)
+	}
+	rule.Filters = mergeHeaderFilters(filters)
+
+	if !r.OmitTimeouts {
+		rule.Timeouts = r.ambassadorTimeouts(mapping, first.spec)
+	}
+	if retry := first.spec.RetryPolicy; retry != nil && r.RetryPolicies {
+		attempts := retry.NumRetries
+		if attempts == 0 {
+			attempts = ambassadorDefaultRetries
+		}
+		rule.Retry = r.envoyRetry(mapping, attempts, []string{retry.RetryOn})
+	}
+	return nil
+}
+
+// ambassadorWeights returns the weights of the Mappings of a group by name. The Mappings with a weight receive that
+// percentage of the requests, the Mappings without one share the rest equally.
+func ambassadorWeights(mappings []ambassadorMapping) map[string]int32 {
+	weights := map[string]int32{}
+	var rest int32 = 100
+	var unweighted []string
+	for _, mapping := range mappings {
+		if mapping.spec.Weight > 0 {
+			weights[mapping.object.GetName()] = mapping.spec.Weight
+			rest -= mapping.spec.Weight
+		} else {
+			unweighted = append(unweighted, mapping.object.GetName())
+		}
+	}
+	rest = max(rest, 0)
+	for i, name := range unweighted {
+		weights[name] = rest / int32(len(unweighted))
+		if i < int(rest)%len(unweighted) {
+			weights[name]++
+		}
+	}
+	return weights
+}
+
+// ambassadorBackendRef returns the backend ref of the service of a Mapping, [scheme://]name[.namespace][:port] with
+// port 80, or 443 for https, by default. Services that are no Kubernetes Service are reported with an Event, and nil
+// is returned.
+func (r *AmbassadorMappingReconciler) ambassadorBackendRef(ctx context.Context, mapping *unstructured.Unstructured, service string, weight *int32) (*gatewayv1.HTTPBackendRef, error) {
+	host, port := service, int32(80)
+	if rest, ok := strings.CutPrefix(host, "https://"); ok {
+		host, port = rest, 443
+	} else {
+		host = strings.TrimPrefix(host, "http://")
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if hostname, portValue, err := net.SplitHostPort(host); err == nil {
+		host = ""
+		if parsed, err := strconv.ParseInt(portValue, 10, 32); err == nil {
+			host, port = hostname, int32(parsed)
+		}
+	}
+	name, namespace, ok := sourceServiceName(host, mapping.GetNamespace())
+	if !ok {
+		r.sourceConverter(mapping).event(mapping, corev1.EventTypeWarning, "UnsupportedService",
+			fmt.Sprintf("Service %s is not the name of a Kubernetes Service, it is not converted", service))
+		return nil, nil
+	}
+
+	backendRef, err := r.mapBackendRef(ctx, namespace, networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: name, Port: networkingv1.ServiceBackendPort{Number: port}},
+	}, weight)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != mapping.GetNamespace() {
+		if err := r.sourceReferenceGranted(ctx, mapping, backendRef.BackendObjectReference); err != nil {
+			return nil, err
+		}
+	}
+	return backendRef, nil
+}
+
+// ambassadorHeaderFilters returns the header modifier filters of the headers a Mapping adds to and removes from the
+// requests and responses. A header added with append set to false replaces the header instead.
+func ambassadorHeaderFilters(spec ambassadorMappingSpec) []gatewayv1.HTTPRouteFilter {
+	var filters []gatewayv1.HTTPRouteFilter
+	if modifier := ambassadorHeaderModifier(spec.AddRequestHeaders, spec.RemoveRequestHeaders); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                  gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: modifier,
+		})
+	}
+	if modifier := ambassadorHeaderModifier(spec.AddResponseHeaders, spec.RemoveResponseHeaders); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: modifier,
+		})
+	}
+	return filters
+}
+
+// ambassadorHeaderModifier returns the header filter adding and removing the headers, or nil if there are none. The
+// added headers are either a value or an object with a value and whether to append it.
+func ambassadorHeaderModifier(add map[string]any, remove []string) *gatewayv1.HTTPHeaderFilter {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	modifier := &gatewayv1.HTTPHeaderFilter{Remove: remove}
+	for _, name := range sortedKeys(add) {
+		value, appendValue := fmt.Sprint(add[name]), true
+		if object, ok := add[name].(map[string]any); ok {
+			value = fmt.Sprint(object["value"])
+			if appendField, ok := object["append"].(bool); ok {
+				appendValue = appendField
+			}
+		}
+		header := gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(name), Value: value}
+		if appendValue {
+			modifier.Add = append(modifier.Add, header)
+		} else {
+			modifier.Set = append(modifier.Set, header)
+		}
+	}
+	return modifier
+}
+
+// ambassadorRedirectFilter returns the redirect filter of a Mapping redirecting to the host of its service, which
+// replaces the whole path or its prefix, and redirects with a 301 by default
+func ambassadorRedirectFilter(spec ambassadorMappingSpec) gatewayv1.HTTPRouteFilter {
+	redirect := &gatewayv1.HTTPRequestRedirectFilter{StatusCode: ptr.To(ambassadorDefaultRedirectCode)}
+	if spec.RedirectResponseCode != 0 {
+		redirect.StatusCode = ptr.To(spec.RedirectResponseCode)
+	}
+	host := spec.Service
+	if rest, ok := strings.CutPrefix(host, "https://"); ok {
+		host = rest
+		redirect.Scheme = ptr.To("https")
+	} else {
+		host = strings.TrimPrefix(host, "http://")
+	}
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		if parsed, err := strconv.ParseInt(port, 10, 32); err == nil {
+			redirect.Port = ptr.To(gatewayv1.PortNumber(parsed))
+		}
+		host = hostname
+	}
+	redirect.Hostname = ptr.To(gatewayv1.PreciseHostname(host))
+	switch {
+	case spec.PathRedirect != "":
+		redirect.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(spec.PathRedirect)}
+	case spec.PrefixRedirect != "":
+		redirect.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To(spec.PrefixRedirect)}
+	}
+	return gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: redirect}
+}
+
+// ambassadorRewriteFilter returns the URL rewrite filter of a Mapping, or nil if it rewrites neither its prefix nor
+// the host. Emissary rewrites the prefix to / unless the rewrite is empty, and the whole path of an exact prefix. The
+// prefix of a regular expression is only rewritten by an explicit rewrite, which cannot be expressed and is reported
+// with an Event.
+func (r *AmbassadorMappingReconciler) ambassadorRewriteFilter(mapping *unstructured.Unstructured, first ambassadorMapping) *gatewayv1.HTTPRouteFilter {
+	filter := &gatewayv1.HTTPURLRewriteFilter{}
+	if first.spec.HostRewrite != "" {
+		filter.Hostname = ptr.To(gatewayv1.PreciseHostname(first.spec.HostRewrite))
+	}
+	rewrite := ptr.Deref(first.spec.Rewrite, ambassadorDefaultRewrite)
+	if path := first.match.Path; rewrite != "" && rewrite != *path.Value {
+		switch *path.Type {
+		case gatewayv1.PathMatchPathPrefix:
+			filter.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To(rewrite)}
+		case gatewayv1.PathMatchExact:
+			filter.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(rewrite)}
+		case gatewayv1.PathMatchRegularExpression:
+			if first.spec.Rewrite == nil {
+				break
+			}
+			r.sourceConverter(mapping).event(mapping, corev1.EventTypeWarning, "UnsupportedRewrite",
+				fmt.Sprintf("The prefix regular expression %s cannot be rewritten to %s", *path.Value, rewrite))
+		}
+	}
+	if filter.Hostname == nil && filter.Path == nil {
+		return nil
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: filter}
+}
+
+// ambassadorTimeouts returns the timeouts of the Mapping and of the tries of its retry policy, or nil if it has
+// neither. An unparsable timeout is ignored with an Event.
+func (r *AmbassadorMappingReconciler) ambassadorTimeouts(mapping *unstructured.Unstructured, spec ambassadorMappingSpec) *gatewayv1.HTTPRouteTimeouts {
+	timeouts := &gatewayv1.HTTPRouteTimeouts{}
+	if spec.TimeoutMS != nil {
+		timeouts.Request = ptr.To(formatPreciseDuration(time.Duration(*spec.TimeoutMS) * time.Millisecond))
+	}
+	if spec.RetryPolicy != nil && spec.RetryPolicy.PerTryTimeout != "" {
+		duration, err := time.ParseDuration(spec.RetryPolicy.PerTryTimeout)
+		if err != nil || duration < 0 {
+			r.sourceConverter(mapping).event(mapping, corev1.EventTypeWarning, "UnsupportedTimeout",
+				fmt.Sprintf("Timeout %q is not a duration, it is not converted", spec.RetryPolicy.PerTryTimeout))
+		} else {
+			timeouts.BackendRequest = ptr.To(formatPreciseDuration(duration))
+		}
+	}
+	if timeouts.Request == nil && timeouts.BackendRequest == nil {
+		return nil
+	}
+	return timeouts
+}
+
+// ambassadorMappingHosts returns the host of the Mapping to index it by, none if it matches any host or cannot be
+// converted
+func ambassadorMappingHosts(mapping *unstructured.Unstructured) []string {
+	decoded, err := decodeAmbassadorMapping(mapping)
+	if err != nil || decoded.host == "" {
+		return nil
+	}
+	return []string{decoded.host}
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *AmbassadorMappingReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	mapping := &unstructured.Unstructured{}
+	mapping.SetGroupVersionKind(AmbassadorMappingGVK)
+
+	// Every change of a Mapping may change the group of the Mappings in its namespace
+	enqueueMappings := handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		return r.sourceRequests(AmbassadorMappingGVK)(ctx, client.InNamespace(obj.GetNamespace()))
+	})
+
+	b, err := r.sourceControllerBuilder(mgr, "ambassadormapping", AmbassadorMappingGVK, ambassadorMappingHosts)
+	if err != nil {
+		return err
+	}
+	return b.Watches(mapping, enqueueMappings).Complete(r)
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func testAmbassadorMappingReconciler(recorder record.EventRecorder, objects ...client.Object) *AmbassadorMappingReconciler {
+	return &AmbassadorMappingReconciler{IngressReconciler: &IngressReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(objects...).Build(),
+		Recorder:      recorder,
+		RetryPolicies: true,
+	}}
+}
+
+func TestAmbassadorMatch(t *testing.T) {
+	match, err := ambassadorMatch(ambassadorMappingSpec{
+		Prefix:               "/health",
+		PrefixExact:          true,
+		Method:               "get",
+		Headers:              map[string]any{"x-tenant": "acme", "x-debug": true},
+		RegexHeaders:         map[string]string{"user-agent": ".*Mobile.*"},
+		QueryParameters:      map[string]any{"verbose": true},
+		RegexQueryParameters: map[string]string{"version": "v[12]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := gatewayv1.HTTPRouteMatch{
+		Path:   &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/health")},
+		Method: ptr.To(gatewayv1.HTTPMethodGet),
+		Headers: []gatewayv1.HTTPHeaderMatch{
+			{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "user-agent", Value: ".*Mobile.*"},
+			{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "x-debug", Value: ".*"},
+			{Type: ptr.To(gatewayv1.HeaderMatchExact), Name: "x-tenant", Value: "acme"},
+		},
+		QueryParams: []gatewayv1.HTTPQueryParamMatch{
+			{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "verbose", Value: ".*"},
+			{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "version", Value: "v[12]"},
+		},
+	}
+	if !isEqual(match, expected) {
+		t.Errorf("unexpected match: %+v", match)
+	}
+
+	if _, err := ambassadorMatch(ambassadorMappingSpec{Prefix: "/", Headers: map[string]any{"x-debug": false}}); err == nil {
+		t.Error("expected an error for the absence of a header")
+	}
+}
+
+func TestAmbassadorWeights(t *testing.T) {
+	for _, tc := range []struct {
+		weights  []int32
+		expected map[string]int32
+	}{
+		{[]int32{0, 10}, map[string]int32{"m0": 90, "m1": 10}},
+		{[]int32{0, 0, 0}, map[string]int32{"m0": 34, "m1": 33, "m2": 33}},
+		{[]int32{0, 60, 50}, map[string]int32{"m0": 0, "m1": 60, "m2": 50}},
+	} {
+		var mappings []ambassadorMapping
+		for i, weight := range tc.weights {
+			mappings = append(mappings, ambassadorMapping{
+				object: sourceObject(AmbassadorMappingGVK, "default", fmt.Sprintf("m%d", i), nil),
+				spec:   ambassadorMappingSpec{Weight: weight},
+			})
+		}
+		if weights := ambassadorWeights(mappings); !isEqual(weights, tc.expected) {
+			t.Errorf("%v: expected %v, got %v", tc.weights, tc.expected, weights)
+		}
+	}
+}
+
+func TestConvertAmbassadorMapping(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(20)
+	app := sourceObject(AmbassadorMappingGVK, "default", "app", map[string]any{
+		"hostname":            "app.example.com",
+		"prefix":              "/app/",
+		"service":             "app:8080",
+		"add_request_headers": map[string]any{"x-env": map[string]any{"value": "prod", "append": false}},
+		"timeout_ms":          int64(1500),
+		"retry_policy":        map[string]any{"retry_on": "gateway-error", "num_retries": int64(3)},
+		"cors":                map[string]any{"origins": []any{"*"}},
+	})
+	canary := sourceObject(AmbassadorMappingGVK, "default", "app-canary", map[string]any{
+		"hostname": "app.example.com",
+		"prefix":   "/app/",
+		"service":  "app-canary.canary:8080",
+		"weight":   int64(10),
+	})
+	shadow := sourceObject(AmbassadorMappingGVK, "default", "a-shadow", map[string]any{
+		"hostname": "app.example.com",
+		"prefix":   "/app/",
+		"service":  "app-shadow",
+		"shadow":   true,
+	})
+	other := sourceObject(AmbassadorMappingGVK, "default", "admin", map[string]any{
+		"hostname": "app.example.com",
+		"prefix":   "/admin/",
+		"service":  "admin",
+	})
+	r := testAmbassadorMappingReconciler(recorder, app, canary, shadow, other)
+
+	// The other Mappings of a group are converted with its first one
+	for _, mapping := range []*unstructured.Unstructured{canary, shadow} {
+		ingress, err := r.AmbassadorMappingIngress(ctx, mapping)
+		if err != nil || len(ingress.Spec.Rules) != 0 {
+			t.Errorf("%s: expected no rules, got %+v, %v", mapping.GetName(), ingress.Spec.Rules, err)
+		}
+	}
+
+	ingress, err := r.AmbassadorMappingIngress(ctx, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := createOwnerReference(ingress); owner.Kind != "Mapping" || owner.APIVersion != "getambassador.io/v3alpha1" {
+		t.Errorf("expected the Mapping to own the routes, got %+v", owner)
+	}
+	if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != "app.example.com" {
+		t.Errorf("unexpected spec: %+v", ingress.Spec)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnconvertedFields") || !strings.Contains(event, "spec.cors") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	httpRoutes, err := r.ConvertAmbassadorMapping(ctx, app, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 || len(httpRoutes[0].Spec.Rules) != 1 {
+		t.Fatalf("expected 1 HTTPRoute with 1 rule, got %+v", httpRoutes)
+	}
+	rule := httpRoutes[0].Spec.Rules[0]
+	if *rule.Matches[0].Path.Value != "/app/" {
+		t.Errorf("unexpected matches: %+v", rule.Matches)
+	}
+
+	var backends []string
+	for _, backendRef := range rule.BackendRefs {
+		backends = append(backends, fmt.Sprintf("%s/%s:%d:%d", *backendRef.Namespace, backendRef.Name, *backendRef.Port, *backendRef.Weight))
+	}
+	if !isEqual(backends, []string{"default/app:8080:90", "canary/app-canary:8080:10"}) {
+		t.Errorf("unexpected backends: %v", backends)
+	}
+	expectedBackendFilters := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set: []gatewayv1.HTTPHeader{{Name: "x-env", Value: "prod"}},
+		},
+	}}
+	if !isEqual(rule.BackendRefs[0].Filters, expectedBackendFilters) || len(rule.BackendRefs[1].Filters) != 0 {
+		t.Errorf("unexpected backend filters: %+v", rule.BackendRefs)
+	}
+	if len(rule.Filters) != 2 || rule.Filters[0].URLRewrite == nil ||
+		*rule.Filters[0].URLRewrite.Path.ReplacePrefixMatch != "/" ||
+		rule.Filters[1].RequestMirror == nil || rule.Filters[1].RequestMirror.BackendRef.Name != "app-shadow" {
+		t.Errorf("unexpected filters: %+v", rule.Filters)
+	}
+	expectedTimeouts := &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("1500ms"))}
+	if !isEqual(rule.Timeouts, expectedTimeouts) {
+		t.Errorf("unexpected timeouts: %+v", rule.Timeouts)
+	}
+	expectedRetry := &gatewayv1.HTTPRouteRetry{Attempts: ptr.To(3), Codes: []gatewayv1.HTTPRouteRetryStatusCode{502, 503, 504}}
+	if !isEqual(rule.Retry, expectedRetry) {
+		t.Errorf("unexpected retry: %+v", rule.Retry)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, string(gatewayv1.RouteReasonRefNotPermitted)) {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestConvertAmbassadorMappingRedirect(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	mapping := sourceObject(AmbassadorMappingGVK, "default", "moved", map[string]any{
+		"hostname":               "*",
+		"prefix":                 "/old/",
+		"service":                "https://www.example.org",
+		"host_redirect":          true,
+		"path_redirect":          "/new",
+		"redirect_response_code": int64(308),
+	})
+	r := testAmbassadorMappingReconciler(recorder, mapping)
+
+	ingress, err := r.AmbassadorMappingIngress(ctx, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != "" {
+		t.Fatalf("unexpected spec: %+v", ingress.Spec)
+	}
+	httpRoutes, err := r.ConvertAmbassadorMapping(ctx, mapping, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+		RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+			Scheme:     ptr.To("https"),
+			Hostname:   ptr.To(gatewayv1.PreciseHostname("www.example.org")),
+			Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/new")},
+			StatusCode: ptr.To(308),
+		},
+	}}
+	rule := httpRoutes[0].Spec.Rules[0]
+	if len(rule.BackendRefs) != 0 || !isEqual(rule.Filters, expected) {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %s", <-recorder.Events)
+	}
+}
+
+func TestAmbassadorMappingIngressUnsupported(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	mapping := sourceObject(AmbassadorMappingGVK, "default", "regex", map[string]any{
+		"host":       "^app[0-9]+\\.example\\.com$",
+		"host_regex": true,
+		"prefix":     "/",
+		"service":    "app",
+	})
+	r := testAmbassadorMappingReconciler(recorder, mapping)
+
+	ingress, err := r.AmbassadorMappingIngress(ctx, mapping)
+	if err != nil || len(ingress.Spec.Rules) != 0 {
+		t.Errorf("expected no rules, got %+v, %v", ingress.Spec.Rules, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRoute") || !strings.Contains(event, "host regular expressions") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestAmbassadorMappingHostIndex(t *testing.T) {
+	r := &IngressReconciler{}
+	mapping := sourceObject(AmbassadorMappingGVK, "default", "app", map[string]any{"hostname": "App.example.com", "prefix": "/", "service": "app"})
+	if keys := r.indexSourceHosts(ambassadorMappingHosts)(mapping); !slices.Contains(keys, "app.example.com") {
+		t.Errorf("expected the Mapping to be indexed by its hostname, got %v", keys)
+	}
+	anyHost := sourceObject(AmbassadorMappingGVK, "default", "any", map[string]any{"hostname": "*", "prefix": "/", "service": "app"})
+	if keys := r.indexSourceHosts(ambassadorMappingHosts)(anyHost); len(keys) != 0 {
+		t.Errorf("expected a Mapping of any host not to be indexed, got %v", keys)
+	}
+}
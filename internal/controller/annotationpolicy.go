@@ -0,0 +1,130 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// AnnotationPolicy renders a vendor policy for each HTTPRoute of an Ingress with an annotation, so annotations
+// without a Gateway API equivalent can be implemented by the policy CRDs of the Gateway implementation
+type AnnotationPolicy struct {
+	// Annotation is the annotation key that triggers the policy
+	Annotation string `json:"annotation"`
+	// Template is a Go template of the policy. It can refer to the .Route and .Namespace of the HTTPRoute, the name
+	// of the .Ingress, the .Value of the annotation and the values of related .Annotations.
+	Template string `json:"template"`
+}
+
+// AnnotationPolicies is the file format of the annotation policies
+type AnnotationPolicies struct {
+	Policies []AnnotationPolicy `json:"policies"`
+}
+
+// annotationPolicyData is passed to the policy templates
+type annotationPolicyData struct {
+	Route       string
+	Namespace   string
+	Ingress     string
+	Value       string
+	Annotations map[string]string
+}
+
+// LoadAnnotationPolicies reads the annotation policies from a YAML or JSON file
+func LoadAnnotationPolicies(path string) ([]AnnotationPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies AnnotationPolicies
+	if err := yaml.UnmarshalStrict(data, &policies); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	for _, policy := range policies.Policies {
+		if policy.Annotation == "" || policy.Template == "" {
+			return nil, fmt.Errorf("invalid policy in %s: annotation and template are required", path)
+		}
+		if _, err := policy.template(); err != nil {
+			return nil, err
+		}
+	}
+	return policies.Policies, nil
+}
+
+// template parses the template of the policy
+func (p AnnotationPolicy) template() (*template.Template, error) {
+	tmpl, err := template.New(p.Annotation).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy template for %s: %w", p.Annotation, err)
+	}
+	return tmpl, nil
+}
+
+// rendersPolicy returns true if the annotation key triggers an annotation policy
+func (r *IngressReconciler) rendersPolicy(key string) bool {
+	return slices.ContainsFunc(r.AnnotationPolicies, func(policy AnnotationPolicy) bool {
+		return policy.Annotation == key
+	})
+}
+
+// RenderAnnotationPolicies renders the annotation policies triggered by the annotations of the Ingress for each of
+// its HTTPRoutes. The policies are owned like the HTTPRoutes they target.
+func (r *IngressReconciler) RenderAnnotationPolicies(ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) ([]*unstructured.Unstructured, error) {
+	var policies []*unstructured.Unstructured
+	for _, policy := range r.AnnotationPolicies {
+		value, ok := ingress.Annotations[policy.Annotation]
+		if !ok || len(httpRoutes) == 0 {
+			continue
+		}
+		tmpl, err := policy.template()
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := renderPolicies(tmpl, httpRoutes, func(httpRoute gatewayv1.HTTPRoute) any {
+			return annotationPolicyData{
+				Route:       httpRoute.Name,
+				Namespace:   httpRoute.Namespace,
+				Ingress:     ingress.Name,
+				Value:       value,
+				Annotations: ingress.Annotations,
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, rendered...)
+	}
+	return policies, nil
+}
+
+// ensureAnnotationPolicies creates or updates the annotation policies of the HTTPRoutes of the Ingress
+func (r *IngressReconciler) ensureAnnotationPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	policies, err := r.RenderAnnotationPolicies(ingress, httpRoutes)
+	if err != nil {
+		return err
+	}
+	return r.ensurePolicies(ctx, ingress, policies)
+}
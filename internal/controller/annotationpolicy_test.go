@@ -0,0 +1,145 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+const testAnnotationPolicies = `policies:
+- annotation: nginx.ingress.kubernetes.io/proxy-body-size
+  template: |
+    apiVersion: gateway.envoyproxy.io/v1alpha1
+    kind: BackendTrafficPolicy
+    metadata:
+      name: "{{ .Route }}-body-size"
+    spec:
+      targetRefs:
+      - group: gateway.networking.k8s.io
+        kind: HTTPRoute
+        name: "{{ .Route }}"
+      requestBuffer:
+        limit: "{{ .Value }}"
+      ingress: "{{ .Ingress }}"
+`
+
+func TestLoadAnnotationPolicies(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policies.yaml")
+	if err := os.WriteFile(path, []byte(testAnnotationPolicies), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := LoadAnnotationPolicies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Annotation != "nginx.ingress.kubernetes.io/proxy-body-size" {
+		t.Errorf("unexpected policies: %v", policies)
+	}
+
+	for _, invalid := range []string{
+		"policies:\n- annotation: example.com/a\n",
+		"policies:\n- annotation: example.com/a\n  template: '{{ .Route'\n",
+		"policies:\n- annotation: example.com/a\n  kind: Policy\n",
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadAnnotationPolicies(path); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestAnnotationPolicies(t *testing.T) {
+	ctx := context.Background()
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "default",
+		UID:         "1234",
+		Annotations: map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "8m"},
+	}}
+	httpRoutes := []gatewayv1.HTTPRoute{{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-example-com",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{createOwnerReference(ingress)},
+	}}}
+
+	stored := httpRoutes[0].DeepCopy()
+	stored.UID = "5678"
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(stored).Build()}
+	if r.AnnotationSupport("nginx.ingress.kubernetes.io/proxy-body-size") != AnnotationUnsupported {
+		t.Errorf("expected the annotation to be unsupported without a policy")
+	}
+	r.AnnotationPolicies = []AnnotationPolicy{{
+		Annotation: "example.com/unused",
+		Template:   "kind: Unused",
+	}}
+	if policies, err := r.RenderAnnotationPolicies(ingress, httpRoutes); err != nil || policies != nil {
+		t.Errorf("expected no policies without the annotation, got %v, %v", policies, err)
+	}
+
+	var file AnnotationPolicies
+	if err := yaml.UnmarshalStrict([]byte(testAnnotationPolicies), &file); err != nil {
+		t.Fatal(err)
+	}
+	r.AnnotationPolicies = file.Policies
+	if r.AnnotationSupport("nginx.ingress.kubernetes.io/proxy-body-size") != AnnotationConverted {
+		t.Errorf("expected the annotation to be converted with a policy")
+	}
+	if err := r.ensureAnnotationPolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	policy := &unstructured.Unstructured{}
+	policy.SetAPIVersion("gateway.envoyproxy.io/v1alpha1")
+	policy.SetKind("BackendTrafficPolicy")
+	key := client.ObjectKey{Namespace: "default", Name: "app-example-com-body-size"}
+	if err := r.Get(ctx, key, policy); err != nil {
+		t.Fatal(err)
+	}
+	if limit, _, _ := unstructured.NestedString(policy.Object, "spec", "requestBuffer", "limit"); limit != "8m" {
+		t.Errorf("expected the value of the annotation, got %q", limit)
+	}
+	if !isEqual(policy.GetOwnerReferences(), []metav1.OwnerReference{createRouteOwnerReference(*stored)}) {
+		t.Errorf("expected the policy to be owned by the HTTPRoute, got %v", policy.GetOwnerReferences())
+	}
+
+	// A changed annotation updates the policy
+	ingress.Annotations["nginx.ingress.kubernetes.io/proxy-body-size"] = "16m"
+	if err := r.ensureAnnotationPolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, policy); err != nil {
+		t.Fatal(err)
+	}
+	if limit, _, _ := unstructured.NestedString(policy.Object, "spec", "requestBuffer", "limit"); limit != "16m" {
+		t.Errorf("expected the policy to be updated, got %q", limit)
+	}
+}
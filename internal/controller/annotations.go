@@ -0,0 +1,234 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultAnnotationPrefix is the prefix of the annotations the controller recognizes, unless another is configured
+const DefaultAnnotationPrefix = "ingress2httproute.lion7.dev/"
+
+// AnnotationSupport describes how the conversion treats an Ingress annotation
+type AnnotationSupport string
+
+const (
+	// AnnotationConverted annotations are translated into the HTTPRoutes
+	AnnotationConverted AnnotationSupport = "converted"
+	// AnnotationIgnored annotations do not affect routing, so nothing is lost by not converting them
+	AnnotationIgnored AnnotationSupport = "ignored"
+	// AnnotationUnsupported annotations affect routing but are not translated, their behavior is lost
+	AnnotationUnsupported AnnotationSupport = "unsupported"
+	// AnnotationUnconvertible annotations hold raw configuration of the Ingress controller, which no translator can
+	// convert, e.g. nginx snippets
+	AnnotationUnconvertible AnnotationSupport = "unconvertible"
+)
+
+// ParseAnnotationPrefix returns the annotation prefix given as a DNS subdomain, with or without the trailing slash
+func ParseAnnotationPrefix(value string) (string, error) {
+	domain := strings.TrimSuffix(value, "/")
+	if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return "", fmt.Errorf("invalid annotation prefix %q: %s", value, strings.Join(errs, ", "))
+	}
+	return domain + "/", nil
+}
+
+// annotation returns the key of an annotation of the controller, declared with the DefaultAnnotationPrefix, under
+// the configured AnnotationPrefix
+func (r *IngressReconciler) annotation(key string) string {
+	if r.AnnotationPrefix == "" {
+		return key
+	}
+	return r.AnnotationPrefix + strings.TrimPrefix(key, DefaultAnnotationPrefix)
+}
+
+// annotationRule declares the support for an annotation key, or for all keys with a prefix if it ends with a slash
+type annotationRule struct {
+	key     string
+	support AnnotationSupport
+}
+
+// writtenAnnotations are the annotations the controller writes on Ingresses itself, they keep the default prefix
+var writtenAnnotations = []string{routesAnnotation, versionAnnotation, convertedAtAnnotation, retiredClassAnnotation}
+
+// annotationRules lists the annotations with known support, all other annotations are unsupported.
+// Translators add the annotations they convert here.
+var annotationRules = []annotationRule{
+	{key: "kubectl.kubernetes.io/", support: AnnotationIgnored},
+	{key: "meta.helm.sh/", support: AnnotationIgnored},
+	{key: "argocd.argoproj.io/", support: AnnotationIgnored},
+	{key: "field.cattle.io/", support: AnnotationIgnored},
+	{key: ingressClassAnnotation, support: AnnotationConverted},
+	{key: nginxUseRegexAnnotation, support: AnnotationConverted},
+	{key: nginxRewriteTargetAnnotation, support: AnnotationConverted},
+	{key: nginxSSLRedirectAnnotation, support: AnnotationConverted},
+	{key: nginxForceSSLRedirectAnnotation, support: AnnotationConverted},
+	{key: nginxPermanentRedirectAnnotation, support: AnnotationConverted},
+	{key: nginxPermanentRedirectCodeAnnotation, support: AnnotationConverted},
+	{key: nginxTemporalRedirectAnnotation, support: AnnotationConverted},
+	{key: nginxAppRootAnnotation, support: AnnotationConverted},
+	{key: nginxFromToWWWRedirectAnnotation, support: AnnotationConverted},
+	{key: nginxCanaryAnnotation, support: AnnotationConverted},
+	{key: nginxCanaryWeightAnnotation, support: AnnotationConverted},
+	{key: nginxCanaryWeightTotalAnnotation, support: AnnotationConverted},
+	{key: nginxCanaryByHeaderAnnotation, support: AnnotationConverted},
+	{key: nginxCanaryByHeaderValueAnnotation, support: AnnotationConverted},
+	{key: nginxProxyReadTimeoutAnnotation, support: AnnotationConverted},
+	{key: nginxProxySendTimeoutAnnotation, support: AnnotationConverted},
+	{key: nginxUpstreamVhostAnnotation, support: AnnotationConverted},
+	{key: nginxXForwardedPrefixAnnotation, support: AnnotationConverted},
+	{key: nginxEnableCORSAnnotation, support: AnnotationConverted},
+	{key: nginxCORSAllowOriginAnnotation, support: AnnotationConverted},
+	{key: nginxCORSAllowMethodsAnnotation, support: AnnotationConverted},
+	{key: nginxCORSAllowHeadersAnnotation, support: AnnotationConverted},
+	{key: nginxCORSExposeHeadersAnnotation, support: AnnotationConverted},
+	{key: nginxCORSAllowCredentialsAnnotation, support: AnnotationConverted},
+	{key: nginxCORSMaxAgeAnnotation, support: AnnotationConverted},
+	{key: nginxMirrorTargetAnnotation, support: AnnotationConverted},
+	{key: nginxMirrorURIAnnotation, support: AnnotationConverted},
+	{key: nginxMirrorPercentageAnnotation, support: AnnotationConverted},
+	{key: nginxBackendProtocolAnnotation, support: AnnotationConverted},
+	{key: nginxProxySSLNameAnnotation, support: AnnotationConverted},
+	{key: traefikEntryPointsAnnotation, support: AnnotationConverted},
+	{key: agicBackendPathPrefixAnnotation, support: AnnotationConverted},
+	{key: agicSSLRedirectAnnotation, support: AnnotationConverted},
+	{key: agicRequestTimeoutAnnotation, support: AnnotationConverted},
+	{key: traefikPathMatcherAnnotation, support: AnnotationConverted},
+	{key: gatewayAnnotation, support: AnnotationConverted},
+	{key: requestHeadersAddAnnotation, support: AnnotationConverted},
+	{key: requestHeadersSetAnnotation, support: AnnotationConverted},
+	{key: requestHeadersRemoveAnnotation, support: AnnotationConverted},
+	{key: responseHeadersAddAnnotation, support: AnnotationConverted},
+	{key: responseHeadersSetAnnotation, support: AnnotationConverted},
+	{key: responseHeadersRemoveAnnotation, support: AnnotationConverted},
+	{key: queryParamsAnnotation, support: AnnotationConverted},
+	{key: filtersAnnotation, support: AnnotationConverted},
+	{key: routeNameAnnotation, support: AnnotationConverted},
+	{key: routeNameSuffixAnnotation, support: AnnotationConverted},
+	{key: skipAnnotation, support: AnnotationConverted},
+	{key: pauseAnnotation, support: AnnotationConverted},
+	{key: defaultBackendRuleAnnotation, support: AnnotationConverted},
+	{key: nginxConfigurationSnippetAnnotation, support: AnnotationUnconvertible},
+	{key: nginxServerSnippetAnnotation, support: AnnotationUnconvertible},
+	{key: nginxStreamSnippetAnnotation, support: AnnotationUnconvertible},
+	{key: nginxModSecuritySnippetAnnotation, support: AnnotationUnconvertible},
+}
+
+// AnnotationSupport returns how the conversion treats the annotation key, regardless of the IngressClass
+func (r *IngressReconciler) AnnotationSupport(key string) AnnotationSupport {
+	return r.annotationSupport(nil, key)
+}
+
+// IngressAnnotationSupport returns how the conversion treats each annotation of the Ingress, with the conversion
+// profile of its IngressClass
+func (r *IngressReconciler) IngressAnnotationSupport(ctx context.Context, ingress networkingv1.Ingress) (map[string]AnnotationSupport, error) {
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil {
+		return nil, err
+	}
+	support := make(map[string]AnnotationSupport, len(ingress.Annotations))
+	for key := range ingress.Annotations {
+		support[key] = r.annotationSupport(profile, key)
+	}
+	return support, nil
+}
+
+// annotationSupport returns how the conversion treats the annotation key with the profile. The annotations of the
+// other Ingress controllers are not translated with a profile, and ignored like those controllers ignore them.
+func (r *IngressReconciler) annotationSupport(profile *ConversionProfile, key string) AnnotationSupport {
+	if slices.Contains(writtenAnnotations, key) {
+		return AnnotationIgnored
+	}
+	for _, p := range conversionProfiles {
+		for _, prefix := range p.profile.AnnotationPrefixes {
+			if strings.HasPrefix(key, prefix) && !profile.translates(prefix) {
+				return AnnotationIgnored
+			}
+		}
+	}
+	if r.OmitTimeouts && (key == nginxProxyReadTimeoutAnnotation || key == nginxProxySendTimeoutAnnotation ||
+		key == agicRequestTimeoutAnnotation) {
+		return AnnotationUnsupported
+	}
+	// The annotations of the controller are only recognized under the configured prefix
+	if r.AnnotationPrefix != "" && r.AnnotationPrefix != DefaultAnnotationPrefix {
+		if name, ok := strings.CutPrefix(key, r.AnnotationPrefix); ok {
+			key = DefaultAnnotationPrefix + name
+		} else if strings.HasPrefix(key, DefaultAnnotationPrefix) {
+			return AnnotationUnsupported
+		}
+	}
+	if r.mapsAnnotation(key) || r.mapsAuthAnnotation(key) || r.rendersPolicy(key) || r.propagatesExternalDNS(key) {
+		return AnnotationConverted
+	}
+	if r.SourceRangePolicyTemplate != nil &&
+		(key == nginxWhitelistSourceRangeAnnotation || key == nginxAllowlistSourceRangeAnnotation) {
+		return AnnotationConverted
+	}
+	if r.RateLimitPolicyTemplate != nil &&
+		(key == nginxLimitRPSAnnotation || key == nginxLimitRPMAnnotation || key == nginxLimitConnectionsAnnotation) {
+		return AnnotationConverted
+	}
+	if strings.HasPrefix(key, albActionsAnnotationPrefix) || strings.HasPrefix(key, albConditionsAnnotationPrefix) {
+		return AnnotationConverted
+	}
+	if r.TraefikMiddlewareFilters && key == traefikMiddlewaresAnnotation {
+		return AnnotationConverted
+	}
+	if r.TLSPassthroughRoutes && key == nginxSSLPassthroughAnnotation {
+		return AnnotationConverted
+	}
+	if r.SessionPersistence && (key == nginxAffinityAnnotation || key == nginxSessionCookieNameAnnotation ||
+		key == nginxSessionCookieMaxAgeAnnotation) {
+		return AnnotationConverted
+	}
+	for _, rule := range annotationRules {
+		if key == rule.key || strings.HasSuffix(rule.key, "/") && strings.HasPrefix(key, rule.key) {
+			return rule.support
+		}
+	}
+	return AnnotationUnsupported
+}
+
+// unconvertibleAnnotations returns the keys of the unconvertible annotations of the Ingress, sorted
+func (r *IngressReconciler) unconvertibleAnnotations(profile *ConversionProfile, ingress networkingv1.Ingress) []string {
+	var keys []string
+	for key := range ingress.Annotations {
+		if r.annotationSupport(profile, key) == AnnotationUnconvertible {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// warnUnconvertibleAnnotations emits an Event listing the unconvertible annotations of the Ingress, as the behavior
+// they configure is silently lost in the HTTPRoutes otherwise
+func (r *IngressReconciler) warnUnconvertibleAnnotations(profile *ConversionProfile, ingress *networkingv1.Ingress) {
+	if keys := r.unconvertibleAnnotations(profile, *ingress); len(keys) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnconvertibleAnnotations",
+			fmt.Sprintf("Annotations %s hold raw configuration of the Ingress controller, which cannot be converted; "+
+				"its behavior is lost in the HTTPRoutes", strings.Join(keys, ", ")))
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestParseAnnotationPrefix(t *testing.T) {
+	tests := map[string]string{
+		"routing.example.com/": "routing.example.com/",
+		"routing.example.com":  "routing.example.com/",
+		"":                     "",
+		"Routing.example.com/": "",
+		"routing/example.com/": "",
+	}
+	for value, expected := range tests {
+		prefix, err := ParseAnnotationPrefix(value)
+		if expected == "" && err == nil {
+			t.Errorf("expected an error for %q, got %q", value, prefix)
+		} else if expected != "" && (err != nil || prefix != expected) {
+			t.Errorf("expected %q for %q, got %q (%v)", expected, value, prefix, err)
+		}
+	}
+}
+
+func TestAnnotationPrefix(t *testing.T) {
+	r := &IngressReconciler{}
+	if key := r.annotation(gatewayAnnotation); key != gatewayAnnotation {
+		t.Errorf("expected the default key without a prefix, got %q", key)
+	}
+	if support := r.AnnotationSupport(gatewayAnnotation); support != AnnotationConverted {
+		t.Errorf("expected the default key to be converted, got %s", support)
+	}
+
+	r.AnnotationPrefix = "routing.example.com/"
+	if key := r.annotation(gatewayAnnotation); key != "routing.example.com/gateway" {
+		t.Errorf("expected the key under the prefix, got %q", key)
+	}
+	tests := map[string]AnnotationSupport{
+		"routing.example.com/gateway":       AnnotationConverted,
+		"routing.example.com/query-params":  AnnotationConverted,
+		"routing.example.com/unknown":       AnnotationUnsupported,
+		gatewayAnnotation:                   AnnotationUnsupported,
+		nginxConfigurationSnippetAnnotation: AnnotationUnconvertible,
+	}
+	for key, expected := range tests {
+		if support := r.AnnotationSupport(key); support != expected {
+			t.Errorf("expected %s to be %s, got %s", key, expected, support)
+		}
+	}
+}
+
+func TestIngressAnnotationSupport(t *testing.T) {
+	class := &networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "traefik"},
+		Spec:       networkingv1.IngressClassSpec{Controller: "traefik.io/ingress-controller"},
+	}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: map[string]string{
+			nginxRewriteTargetAnnotation:    "/",
+			nginxServerSnippetAnnotation:    "return 403;",
+			traefikEntryPointsAnnotation:    "websecure",
+			nginxProxyReadTimeoutAnnotation: "30",
+		}},
+		Spec: networkingv1.IngressSpec{IngressClassName: ptr.To("traefik")},
+	}
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(class).Build()}
+
+	for _, tc := range []struct {
+		name     string
+		profiles bool
+		expected map[string]AnnotationSupport
+	}{
+		{name: "without profiles", expected: map[string]AnnotationSupport{
+			nginxRewriteTargetAnnotation:    AnnotationConverted,
+			nginxServerSnippetAnnotation:    AnnotationUnconvertible,
+			traefikEntryPointsAnnotation:    AnnotationConverted,
+			nginxProxyReadTimeoutAnnotation: AnnotationConverted,
+		}},
+		// Traefik ignores the annotations of nginx, and so does its profile
+		{name: "with profiles", profiles: true, expected: map[string]AnnotationSupport{
+			nginxRewriteTargetAnnotation:    AnnotationIgnored,
+			nginxServerSnippetAnnotation:    AnnotationIgnored,
+			traefikEntryPointsAnnotation:    AnnotationConverted,
+			nginxProxyReadTimeoutAnnotation: AnnotationIgnored,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r.ConversionProfiles = tc.profiles
+			support, err := r.IngressAnnotationSupport(context.Background(), ingress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isEqual(support, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, support)
+			}
+		})
+	}
+
+	r.ConversionProfiles = false
+	r.OmitTimeouts = true
+	if support := r.AnnotationSupport(nginxProxyReadTimeoutAnnotation); support != AnnotationUnsupported {
+		t.Errorf("expected the omitted timeouts to be unsupported, got %s", support)
+	}
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+)
+
+const (
+	// appProtocolGRPC is the appProtocol of Service ports serving gRPC
+	appProtocolGRPC = "grpc"
+	// appProtocolHTTPS is the appProtocol of Service ports serving HTTPS
+	appProtocolHTTPS = "https"
+)
+
+var (
+	// grpcServicePattern and grpcMethodPattern are the names the GRPCRoute CRD accepts in a method match
+	grpcServicePattern = regexp.MustCompile(`^(?i)\.?[a-z_][a-z_0-9]*(\.[a-z_][a-z_0-9]*)*$`)
+	grpcMethodPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z_0-9]*$`)
+)
+
+// findBackendServicePort returns the Service and port a backend ref points at. Backends other than Services,
+// and Services or ports that cannot be found, are not found either.
+func (r *IngressReconciler) findBackendServicePort(ctx context.Context, namespace string, backend gatewayv1.BackendObjectReference) (corev1.Service, corev1.ServicePort, bool, error) {
+	if ptr.Deref(backend.Group, "") != "" || ptr.Deref(backend.Kind, "Service") != "Service" || backend.Port == nil {
+		return corev1.Service{}, corev1.ServicePort{}, false, nil
+	}
+
+	service := corev1.Service{}
+	name := types.NamespacedName{Namespace: string(ptr.Deref(backend.Namespace, gatewayv1.Namespace(namespace))), Name: string(backend.Name)}
+	if err := r.Get(ctx, name, &service); err != nil {
+		if errors.IsNotFound(err) {
+			return service, corev1.ServicePort{}, false, nil
+		}
+		return service, corev1.ServicePort{}, false, err
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Port == int32(*backend.Port) {
+			return service, port, true, nil
+		}
+	}
+	return service, corev1.ServicePort{}, false, nil
+}
+
+// backendAppProtocol returns the lower-cased appProtocol of the Service port a backend ref points at, if any
+func (r *IngressReconciler) backendAppProtocol(ctx context.Context, namespace string, backend gatewayv1.BackendObjectReference) (string, error) {
+	_, port, found, err := r.findBackendServicePort(ctx, namespace, backend)
+	if err != nil || !found {
+		return "", err
+	}
+	return strings.ToLower(ptr.Deref(port.AppProtocol, "")), nil
+}
+
+// SplitGRPCRoutes replaces the HTTPRoutes whose backends all serve gRPC, according to the appProtocol of their
+// Service ports, by GRPCRoutes. HTTPRoutes with matches or filters a GRPCRoute cannot express are kept.
+// Without AppProtocolBackends, or without Service lookups, the HTTPRoutes are returned as they are.
+func (r *IngressReconciler) SplitGRPCRoutes(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) ([]gatewayv1.HTTPRoute, []gatewayv1.GRPCRoute, error) {
+	if !r.AppProtocolBackends || r.DisableServiceLookups {
+		return httpRoutes, nil, nil
+	}
+
+	var remaining []gatewayv1.HTTPRoute
+	var grpcRoutes []gatewayv1.GRPCRoute
+	for _, httpRoute := range httpRoutes {
+		grpcRoute, ok, err := r.createGRPCRoute(ctx, httpRoute)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			grpcRoutes = append(grpcRoutes, grpcRoute)
+		} else {
+			remaining = append(remaining, httpRoute)
+		}
+	}
+	return remaining, grpcRoutes, nil
+}
+
+// createGRPCRoute converts the HTTPRoute to a GRPCRoute with the same name, if all of its backends serve gRPC
+func (r *IngressReconciler) createGRPCRoute(ctx context.Context, httpRoute gatewayv1.HTTPRoute) (gatewayv1.GRPCRoute, bool, error) {
+	var rules []gatewayv1.GRPCRouteRule
+	for _, rule := range httpRoute.Spec.Rules {
+		if len(rule.BackendRefs) == 0 {
+			return gatewayv1.GRPCRoute{}, false, nil
+		}
+		matches, ok := createGRPCRouteMatches(rule.Matches)
+		if !ok {
+			log.FromContext(ctx).Info("cannot convert paths to gRPC method matches", "name", httpRoute.Name)
+			return gatewayv1.GRPCRoute{}, false, nil
+		}
+
+		var filters []gatewayv1.GRPCRouteFilter
+		for _, filter := range rule.Filters {
+			if filter.Type != gatewayv1.HTTPRouteFilterExtensionRef {
+				return gatewayv1.GRPCRoute{}, false, nil
+			}
+			filters = append(filters, gatewayv1.GRPCRouteFilter{
+				Type:         gatewayv1.GRPCRouteFilterExtensionRef,
+				ExtensionRef: filter.ExtensionRef,
+			})
+		}
+
+		var backendRefs []gatewayv1.GRPCBackendRef
+		for _, backendRef := range rule.BackendRefs {
+			appProtocol, err := r.backendAppProtocol(ctx, httpRoute.Namespace, backendRef.BackendObjectReference)
+			if err != nil {
+				return gatewayv1.GRPCRoute{}, false, err
+			}
+			if appProtocol != appProtocolGRPC {
+				return gatewayv1.GRPCRoute{}, false, nil
+			}
+			backendRefs = append(backendRefs, gatewayv1.GRPCBackendRef{BackendRef: backendRef.BackendRef})
+		}
+
+		rules = append(rules, gatewayv1.GRPCRouteRule{Name: rule.Name, Matches: matches, Filters: filters, BackendRefs: backendRefs})
+	}
+
+	return gatewayv1.GRPCRoute{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gatewayv1.GroupVersion.String(),
+			Kind:       "GRPCRoute",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            httpRoute.Name,
+			Namespace:       httpRoute.Namespace,
+			Labels:          httpRoute.Labels,
+			Annotations:     httpRoute.Annotations,
+			OwnerReferences: httpRoute.OwnerReferences,
+		},
+		Spec: gatewayv1.GRPCRouteSpec{
+			CommonRouteSpec: httpRoute.Spec.CommonRouteSpec,
+			Hostnames:       httpRoute.Spec.Hostnames,
+			Rules:           rules,
+		},
+	}, true, nil
+}
+
+// createGRPCRouteMatches converts path matches to gRPC method matches: a / prefix matches all methods,
+// a /service prefix all methods of the service and an exact /service/method path a single method.
+// Matches on anything but the path cannot be converted.
+func createGRPCRouteMatches(matches []gatewayv1.HTTPRouteMatch) ([]gatewayv1.GRPCRouteMatch, bool) {
+	var result []gatewayv1.GRPCRouteMatch
+	for _, match := range matches {
+		if len(match.Headers) > 0 || len(match.QueryParams) > 0 || match.Method != nil || match.Path == nil {
+			return nil, false
+		}
+		pathType := ptr.Deref(match.Path.Type, gatewayv1.PathMatchPathPrefix)
+		service, method, _ := strings.Cut(strings.Trim(ptr.Deref(match.Path.Value, "/"), "/"), "/")
+
+		switch {
+		case pathType == gatewayv1.PathMatchPathPrefix && service == "":
+			// Matches all methods, like a rule without matches
+			return nil, true
+		case pathType == gatewayv1.PathMatchPathPrefix && method == "" && grpcServicePattern.MatchString(service):
+			result = append(result, gatewayv1.GRPCRouteMatch{Method: &gatewayv1.GRPCMethodMatch{
+				Type:    ptr.To(gatewayv1.GRPCMethodMatchExact),
+				Service: ptr.To(service),
+			}})
+		case pathType == gatewayv1.PathMatchExact && grpcServicePattern.MatchString(service) && grpcMethodPattern.MatchString(method):
+			result = append(result, gatewayv1.GRPCRouteMatch{Method: &gatewayv1.GRPCMethodMatch{
+				Type:    ptr.To(gatewayv1.GRPCMethodMatchExact),
+				Service: ptr.To(service),
+				Method:  ptr.To(method),
+			}})
+		default:
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+// BackendTLSPolicies returns a BackendTLSPolicy for each Service serving HTTPS that is referenced by the HTTPRoutes
+// of the Ingress, so the Gateways connect to it with TLS. A Service port serves HTTPS if its appProtocol says so with
+// AppProtocolBackends, or if the Ingress sets the nginx backend-protocol annotation to HTTPS. The certificate of the
+// Service is validated against BackendTLSCACertificates, or else the system CAs, for its cluster-local hostname or
+// the proxy-ssl-name of the Ingress; as the validation depends on how the certificate was issued, the policies are
+// only created and never updated, so they can be adjusted.
+// Without Service lookups, the policies of the annotation target all ports of the Service.
+func (r *IngressReconciler) BackendTLSPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) ([]gatewayv1alpha3.BackendTLSPolicy, error) {
+	httpsServices, hostname, err := r.nginxHTTPSServices(ctx, &ingress)
+	if err != nil {
+		return nil, err
+	}
+	appProtocol := r.AppProtocolBackends && !r.DisableServiceLookups
+	if !appProtocol && len(httpsServices) == 0 {
+		return nil, nil
+	}
+
+	var result []gatewayv1alpha3.BackendTLSPolicy
+	for _, httpRoute := range httpRoutes {
+		for _, rule := range httpRoute.Spec.Rules {
+			for _, backendRef := range rule.BackendRefs {
+				ref := backendRef.BackendObjectReference
+				if ptr.Deref(ref.Group, "") != "" || ptr.Deref(ref.Kind, "Service") != "Service" {
+					continue
+				}
+				namespace := string(ptr.Deref(ref.Namespace, gatewayv1.Namespace(httpRoute.Namespace)))
+				// Merged HTTPRoutes also reference the Services of other Ingresses
+				annotated := namespace == ingress.Namespace && httpsServices[string(ref.Name)]
+				if r.DisableServiceLookups {
+					if annotated {
+						result = r.addBackendTLSPolicyTarget(result, namespace, string(ref.Name), "", hostname)
+					}
+					continue
+				}
+
+				service, port, found, err := r.findBackendServicePort(ctx, httpRoute.Namespace, ref)
+				if err != nil {
+					return nil, err
+				}
+				if !found || !annotated && (!appProtocol || strings.ToLower(ptr.Deref(port.AppProtocol, "")) != appProtocolHTTPS) {
+					continue
+				}
+				result = r.addBackendTLSPolicyTarget(result, service.Namespace, service.Name, port.Name, hostname)
+			}
+		}
+	}
+	return result, nil
+}
+
+// addBackendTLSPolicyTarget adds the Service port to the policy of the Service, creating it if needed. Without a
+// port name, the policy targets all ports of the Service. Without a hostname, the certificate is validated for the
+// cluster-local hostname of the Service.
+func (r *IngressReconciler) addBackendTLSPolicyTarget(policies []gatewayv1alpha3.BackendTLSPolicy, namespace, name, portName, hostname string) []gatewayv1alpha3.BackendTLSPolicy {
+	target := gatewayv1alpha2.LocalPolicyTargetReferenceWithSectionName{
+		LocalPolicyTargetReference: gatewayv1alpha2.LocalPolicyTargetReference{
+			Group: "",
+			Kind:  "Service",
+			Name:  gatewayv1.ObjectName(name),
+		},
+	}
+	if portName != "" {
+		target.SectionName = ptr.To(gatewayv1.SectionName(portName))
+	}
+
+	index := slices.IndexFunc(policies, func(policy gatewayv1alpha3.BackendTLSPolicy) bool {
+		return policy.Namespace == namespace && policy.Name == name
+	})
+	if index < 0 {
+		validation := gatewayv1alpha3.BackendTLSPolicyValidation{
+			Hostname: gatewayv1.PreciseHostname(cmp.Or(hostname, name+"."+namespace+".svc")),
+		}
+		if r.BackendTLSCACertificates != "" {
+			validation.CACertificateRefs = []gatewayv1.LocalObjectReference{{
+				Group: "",
+				Kind:  "ConfigMap",
+				Name:  gatewayv1.ObjectName(r.BackendTLSCACertificates),
+			}}
+		} else {
+			validation.WellKnownCACertificates = ptr.To(gatewayv1alpha3.WellKnownCACertificatesSystem)
+		}
+		policies = append(policies, gatewayv1alpha3.BackendTLSPolicy{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: gatewayv1alpha3.GroupVersion.String(),
+				Kind:       "BackendTLSPolicy",
+			},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       gatewayv1alpha3.BackendTLSPolicySpec{Validation: validation},
+		})
+		index = len(policies) - 1
+	}
+	if !slices.ContainsFunc(policies[index].Spec.TargetRefs, func(existing gatewayv1alpha2.LocalPolicyTargetReferenceWithSectionName) bool {
+		return isEqual(existing, target)
+	}) {
+		policies[index].Spec.TargetRefs = append(policies[index].Spec.TargetRefs, target)
+	}
+	return policies
+}
+
+// ensureBackendTLSPolicies creates the BackendTLSPolicies the HTTPS backends of the HTTPRoutes of the Ingress need,
+// existing policies are left as they are
+func (r *IngressReconciler) ensureBackendTLSPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	policies, err := r.BackendTLSPolicies(ctx, ingress, httpRoutes)
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		policy := &policies[i]
+		existing := gatewayv1alpha3.BackendTLSPolicy{}
+		err := r.routeClient().Get(ctx, client.ObjectKeyFromObject(policy), &existing)
+		if err == nil {
+			continue
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := r.routeClient().Create(ctx, policy); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("created BackendTLSPolicy", "name", client.ObjectKeyFromObject(policy))
+	}
+	return nil
+}
+
+// reconcileGRPCRoute creates or updates a single GRPCRoute for the ingress, like reconcileHTTPRoute.
+// A GRPCRoute with the name that is not owned by the Ingress is left alone.
+func (r *IngressReconciler) reconcileGRPCRoute(ctx context.Context, desired gatewayv1.GRPCRoute, owner metav1.OwnerReference) error {
+	logger := log.FromContext(ctx)
+	routeClient := r.routeClient()
+	name := client.ObjectKeyFromObject(&desired)
+	grpcRoute := gatewayv1.GRPCRoute{}
+	if err := routeClient.Get(ctx, name, &grpcRoute); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := r.checkRouteQuota(ctx, name.Namespace); err != nil {
+			return err
+		}
+
+		grpcRoute.SetNamespace(name.Namespace)
+		grpcRoute.SetName(name.Name)
+		grpcRoute.SetLabels(desired.Labels)
+		if annotation, ok := desired.Annotations[ownerAnnotation]; ok {
+			grpcRoute.SetAnnotations(map[string]string{ownerAnnotation: annotation})
+		} else if r.TargetCluster == nil {
+			grpcRoute.SetOwnerReferences(desired.OwnerReferences)
+		} else {
+			grpcRoute.SetAnnotations(map[string]string{
+				ownerAnnotation: ownerAnnotationValue(ownerGroupKind(owner), name.Namespace, owner.Name),
+			})
+		}
+		syncUnconvertedAnnotation(&grpcRoute.ObjectMeta, desired.ObjectMeta)
+		r.syncExternalDNSAnnotations(&grpcRoute.ObjectMeta, desired.ObjectMeta)
+		grpcRoute.Spec = desired.Spec
+
+		if err := routeClient.Create(ctx, &grpcRoute); err != nil {
+			return err
+		}
+		logger.Info("created GRPCRoute", "name", name)
+		return nil
+	}
+
+	if !r.ownsRoute(grpcRoute.ObjectMeta, desired.ObjectMeta) {
+		logger.Info("GRPCRoute belongs to another owner", "name", name)
+		return nil
+	}
+
+	spec := *desired.Spec.DeepCopy()
+	applyGRPCRouteDefaults(&spec)
+	ownersChanged := r.syncMergedOwners(&grpcRoute.ObjectMeta, desired.ObjectMeta)
+	unconvertedChanged := syncUnconvertedAnnotation(&grpcRoute.ObjectMeta, desired.ObjectMeta)
+	externalDNSChanged := r.syncExternalDNSAnnotations(&grpcRoute.ObjectMeta, desired.ObjectMeta)
+	if isEqual(grpcRoute.Spec, spec) && hasLabels(grpcRoute.ObjectMeta, desired.Labels) && !ownersChanged && !unconvertedChanged &&
+		!externalDNSChanged {
+		return nil
+	}
+
+	grpcRoute.Spec = spec
+	for key, value := range desired.Labels {
+		metav1.SetMetaDataLabel(&grpcRoute.ObjectMeta, key, value)
+	}
+	if err := routeClient.Update(ctx, &grpcRoute); err != nil {
+		return err
+	}
+	logger.Info("updated GRPCRoute", "name", name)
+	return nil
+}
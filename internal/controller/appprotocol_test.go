@@ -0,0 +1,238 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func appProtocolService(name, appProtocol string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "http", Port: 80},
+			{Name: appProtocol, Port: 8443, AppProtocol: ptr.To(appProtocol)},
+		}},
+	}
+}
+
+func appProtocolHTTPRoute(name string, path gatewayv1.HTTPPathMatch, services ...string) gatewayv1.HTTPRoute {
+	var backendRefs []gatewayv1.HTTPBackendRef
+	for _, service := range services {
+		backendRefs = append(backendRefs, gatewayv1.HTTPBackendRef{BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Name: gatewayv1.ObjectName(service), Port: ptr.To(gatewayv1.PortNumber(8443)),
+			},
+		}})
+	}
+	return gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			Hostnames: []gatewayv1.Hostname{"app.example.com"},
+			Rules: []gatewayv1.HTTPRouteRule{{
+				Matches:     []gatewayv1.HTTPRouteMatch{{Path: &path}},
+				BackendRefs: backendRefs,
+			}},
+		},
+	}
+}
+
+func TestSplitGRPCRoutes(t *testing.T) {
+	ctx := context.Background()
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+			appProtocolService("greeter", appProtocolGRPC), appProtocolService("web", appProtocolHTTPS),
+		).Build(),
+		AppProtocolBackends: true,
+	}
+
+	prefix := func(value string) gatewayv1.HTTPPathMatch {
+		return gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To(value)}
+	}
+	exact := func(value string) gatewayv1.HTTPPathMatch {
+		return gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To(value)}
+	}
+
+	tests := []struct {
+		name    string
+		route   gatewayv1.HTTPRoute
+		matches []gatewayv1.GRPCRouteMatch
+		grpc    bool
+	}{
+		{name: "all methods", route: appProtocolHTTPRoute("all", prefix("/"), "greeter"), grpc: true},
+		{name: "service", route: appProtocolHTTPRoute("service", prefix("/helloworld.Greeter"), "greeter"), grpc: true,
+			matches: []gatewayv1.GRPCRouteMatch{{Method: &gatewayv1.GRPCMethodMatch{
+				Type: ptr.To(gatewayv1.GRPCMethodMatchExact), Service: ptr.To("helloworld.Greeter"),
+			}}}},
+		{name: "method", route: appProtocolHTTPRoute("method", exact("/helloworld.Greeter/SayHello"), "greeter"), grpc: true,
+			matches: []gatewayv1.GRPCRouteMatch{{Method: &gatewayv1.GRPCMethodMatch{
+				Type: ptr.To(gatewayv1.GRPCMethodMatchExact), Service: ptr.To("helloworld.Greeter"), Method: ptr.To("SayHello"),
+			}}}},
+		{name: "not a service", route: appProtocolHTTPRoute("path", prefix("/api/v1"), "greeter")},
+		{name: "mixed backends", route: appProtocolHTTPRoute("mixed", prefix("/"), "greeter", "web")},
+		{name: "https backend", route: appProtocolHTTPRoute("https", prefix("/"), "web")},
+		{name: "missing Service", route: appProtocolHTTPRoute("missing", prefix("/"), "missing")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpRoutes, grpcRoutes, err := r.SplitGRPCRoutes(ctx, []gatewayv1.HTTPRoute{tt.route})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.grpc {
+				if len(httpRoutes) != 1 || len(grpcRoutes) != 0 {
+					t.Fatalf("expected the HTTPRoute to be kept, got %d HTTPRoutes and %d GRPCRoutes", len(httpRoutes), len(grpcRoutes))
+				}
+				return
+			}
+			if len(httpRoutes) != 0 || len(grpcRoutes) != 1 {
+				t.Fatalf("expected a GRPCRoute, got %d HTTPRoutes and %d GRPCRoutes", len(httpRoutes), len(grpcRoutes))
+			}
+			grpcRoute := grpcRoutes[0]
+			if grpcRoute.Name != tt.route.Name || !isEqual(grpcRoute.Spec.Hostnames, tt.route.Spec.Hostnames) {
+				t.Errorf("GRPCRoute %s does not keep the name and hostnames of the HTTPRoute", grpcRoute.Name)
+			}
+			if !isEqual(grpcRoute.Spec.Rules[0].Matches, tt.matches) {
+				t.Errorf("expected matches %+v, got %+v", tt.matches, grpcRoute.Spec.Rules[0].Matches)
+			}
+			if grpcRoute.Spec.Rules[0].BackendRefs[0].Name != "greeter" {
+				t.Errorf("expected the greeter backend, got %+v", grpcRoute.Spec.Rules[0].BackendRefs)
+			}
+		})
+	}
+
+	// Without the option every HTTPRoute is kept
+	r.AppProtocolBackends = false
+	httpRoutes, grpcRoutes, err := r.SplitGRPCRoutes(ctx, []gatewayv1.HTTPRoute{tests[0].route})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 || len(grpcRoutes) != 0 {
+		t.Errorf("expected the HTTPRoute to be kept without AppProtocolBackends")
+	}
+}
+
+func TestEnsureBackendTLSPolicies(t *testing.T) {
+	ctx := context.Background()
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+			appProtocolService("greeter", appProtocolGRPC), appProtocolService("web", appProtocolHTTPS),
+		).Build(),
+		AppProtocolBackends: true,
+	}
+
+	root := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")}
+	httpRoutes := []gatewayv1.HTTPRoute{
+		appProtocolHTTPRoute("first", root, "web", "greeter"),
+		appProtocolHTTPRoute("second", root, "web"),
+	}
+
+	// Reconciling twice must create a single BackendTLSPolicy for the HTTPS Service only
+	for range 2 {
+		if err := r.ensureBackendTLSPolicies(ctx, networkingv1.Ingress{}, httpRoutes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var policies gatewayv1alpha3.BackendTLSPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		t.Fatal(err)
+	}
+	if len(policies.Items) != 1 {
+		t.Fatalf("expected 1 BackendTLSPolicy, got %d", len(policies.Items))
+	}
+	policy := policies.Items[0]
+	if policy.Name != "web" || len(policy.Spec.TargetRefs) != 1 || policy.Spec.TargetRefs[0].Name != "web" ||
+		ptr.Deref(policy.Spec.TargetRefs[0].SectionName, "") != "https" {
+		t.Errorf("BackendTLSPolicy does not target the https port of the web Service: %+v", policy.Spec.TargetRefs)
+	}
+	if policy.Spec.Validation.Hostname != "web.default.svc" {
+		t.Errorf("expected the cluster-local hostname of the Service, got %s", policy.Spec.Validation.Hostname)
+	}
+}
+
+func TestNginxBackendTLSPolicies(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+			appProtocolService("web", "tls"), appProtocolService("other", "tls"),
+		).Build(),
+		BackendTLSCACertificates: "internal-ca",
+		Recorder:                 recorder,
+	}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{
+			nginxBackendProtocolAnnotation: "HTTPS",
+			nginxProxySSLNameAnnotation:    "web.internal",
+		}},
+		Spec: networkingv1.IngressSpec{DefaultBackend: &networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{Name: "web", Port: networkingv1.ServiceBackendPort{Number: 8443}},
+		}},
+	}
+	root := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")}
+	// The Service of another Ingress merged into the HTTPRoute is not annotated
+	httpRoutes := []gatewayv1.HTTPRoute{appProtocolHTTPRoute("web", root, "web", "other")}
+
+	policies, err := r.BackendTLSPolicies(ctx, ingress, httpRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("expected 1 BackendTLSPolicy, got %d", len(policies))
+	}
+	policy := policies[0]
+	if policy.Name != "web" || ptr.Deref(policy.Spec.TargetRefs[0].SectionName, "") != "tls" {
+		t.Errorf("BackendTLSPolicy does not target the tls port of the web Service: %+v", policy.Spec.TargetRefs)
+	}
+	validation := policy.Spec.Validation
+	if validation.Hostname != "web.internal" || validation.WellKnownCACertificates != nil ||
+		len(validation.CACertificateRefs) != 1 || validation.CACertificateRefs[0].Name != "internal-ca" {
+		t.Errorf("expected validation for the proxy SSL name against the internal CA, got %+v", validation)
+	}
+
+	// Without Service lookups the policy targets all ports of the Service
+	r.DisableServiceLookups = true
+	if policies, err = r.BackendTLSPolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Spec.TargetRefs[0].SectionName != nil {
+		t.Errorf("expected a BackendTLSPolicy for the whole web Service, got %+v", policies)
+	}
+
+	// Other protocols are reported instead
+	ingress.Annotations[nginxBackendProtocolAnnotation] = "GRPCS"
+	if policies, err = r.BackendTLSPolicies(ctx, ingress, httpRoutes); err != nil || len(policies) != 0 {
+		t.Errorf("expected no BackendTLSPolicy for GRPCS, got %+v, %v", policies, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedBackendProtocol") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
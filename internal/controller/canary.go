@@ -0,0 +1,181 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// argoRolloutsAnnotation is set by Argo Rollouts on the stable and canary Services of a Rollout
+	argoRolloutsAnnotation = "argo-rollouts.argoproj.io/managed-by-rollouts"
+	// flaggerGroup is the API group of the Flagger Canary that owns the primary and canary Services
+	flaggerGroup = "flagger.app"
+
+	// canaryProviderLabel marks HTTPRoutes whose traffic split is managed by a progressive delivery tool
+	canaryProviderLabel = "ingress2httproute.lion7.dev/canary-provider"
+	// canaryLabel is the name of the Rollout or Canary managing the traffic split
+	canaryLabel = "ingress2httproute.lion7.dev/canary"
+
+	// argoCDInstanceLabel tracks the resources of an Argo CD application. It is not copied from the Ingress, as Argo CD
+	// would prune the HTTPRoute missing from the application.
+	argoCDInstanceLabel = "app.kubernetes.io/instance"
+
+	argoRolloutsProvider = "argo-rollouts"
+	flaggerProvider      = "flagger"
+)
+
+// canaryBackends is a pair of Services a progressive delivery tool shifts traffic between
+type canaryBackends struct {
+	provider string
+	name     string
+	stable   string
+	canary   string
+}
+
+// findCanaryBackends detects whether the Service is managed by Argo Rollouts or Flagger, and returns its stable
+// and canary Services if so. The Service referenced by the Ingress is the stable Service for Argo Rollouts,
+// and the apex Service in front of the <service>-primary and <service>-canary Services for Flagger.
+func (r *IngressReconciler) findCanaryBackends(ctx context.Context, namespace, serviceName string) (*canaryBackends, error) {
+	service := corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: serviceName}, &service); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if rollout := service.Annotations[argoRolloutsAnnotation]; rollout != "" {
+		return r.findArgoRolloutsBackends(ctx, service, rollout)
+	}
+	return r.findFlaggerBackends(ctx, service)
+}
+
+// findArgoRolloutsBackends finds the canary Service managed by the same Rollout as the stable Service
+func (r *IngressReconciler) findArgoRolloutsBackends(ctx context.Context, stable corev1.Service, rollout string) (*canaryBackends, error) {
+	services := corev1.ServiceList{}
+	if err := r.List(ctx, &services, client.InNamespace(stable.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var canary string
+	for _, service := range services.Items {
+		if service.Name == stable.Name || service.Annotations[argoRolloutsAnnotation] != rollout {
+			continue
+		}
+		if canary != "" {
+			// Ambiguous, the Rollout manages more than a stable and a canary Service
+			return nil, nil
+		}
+		canary = service.Name
+	}
+	if canary == "" {
+		return nil, nil
+	}
+
+	return &canaryBackends{provider: argoRolloutsProvider, name: rollout, stable: stable.Name, canary: canary}, nil
+}
+
+// findFlaggerBackends finds the primary and canary Services Flagger creates next to the apex Service
+func (r *IngressReconciler) findFlaggerBackends(ctx context.Context, apex corev1.Service) (*canaryBackends, error) {
+	primary := corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: apex.Namespace, Name: apex.Name + "-primary"}, &primary); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var name string
+	for _, owner := range primary.OwnerReferences {
+		if owner.Kind == "Canary" && strings.HasPrefix(owner.APIVersion, flaggerGroup+"/") {
+			name = owner.Name
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	canary := corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: apex.Namespace, Name: apex.Name + "-canary"}, &canary); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &canaryBackends{provider: flaggerProvider, name: name, stable: primary.Name, canary: canary.Name}, nil
+}
+
+// backendRefs returns the backendRefs to the stable and canary Services, based on the backendRef to the
+// Service referenced by the Ingress. All traffic goes to the stable Service until the tool shifts it.
+func (c *canaryBackends) backendRefs(backendRef gatewayv1.HTTPBackendRef) []gatewayv1.HTTPBackendRef {
+	stable := *backendRef.DeepCopy()
+	stable.Name = gatewayv1.ObjectName(c.stable)
+	stableWeight := int32(100)
+	stable.Weight = &stableWeight
+
+	canary := *backendRef.DeepCopy()
+	canary.Name = gatewayv1.ObjectName(c.canary)
+	canaryWeight := int32(0)
+	canary.Weight = &canaryWeight
+
+	return []gatewayv1.HTTPBackendRef{stable, canary}
+}
+
+// labels returns the provenance labels of the HTTPRoute splitting the traffic of the Ingress: the labels of the
+// Ingress, and those identifying the tool and object managing the traffic split
+func (c *canaryBackends) labels(ingress networkingv1.Ingress) map[string]string {
+	result := make(map[string]string, len(ingress.Labels)+2)
+	for key, value := range ingress.Labels {
+		if key != argoCDInstanceLabel {
+			result[key] = value
+		}
+	}
+	result[canaryProviderLabel] = c.provider
+	result[canaryLabel] = c.name
+	return result
+}
+
+// preserveCanaryWeights copies the weights of the current HTTPRoute to rules with the same matches and backends,
+// so reconciling does not undo the traffic shifted by the progressive delivery tool
+func preserveCanaryWeights(spec *gatewayv1.HTTPRouteSpec, current gatewayv1.HTTPRouteSpec) {
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		if len(rule.BackendRefs) < 2 {
+			continue
+		}
+		for _, currentRule := range current.Rules {
+			if !isEqual(rule.Matches, currentRule.Matches) || len(rule.BackendRefs) != len(currentRule.BackendRefs) {
+				continue
+			}
+			for j := range rule.BackendRefs {
+				if isEqual(rule.BackendRefs[j].BackendObjectReference, currentRule.BackendRefs[j].BackendObjectReference) {
+					rule.BackendRefs[j].Weight = currentRule.BackendRefs[j].Weight
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestCanaryProvenanceLabels(t *testing.T) {
+	newService := func(name string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{argoRolloutsAnnotation: "demo-rollout"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		}
+	}
+	r := &IngressReconciler{
+		Client:         fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(newService("stable"), newService("canary")).Build(),
+		Recorder:       record.NewFakeRecorder(10),
+		CanaryBackends: true,
+	}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "app",
+				argoCDInstanceLabel:      "app",
+			},
+		},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "app.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: ptr.To(networkingv1.PathTypePrefix),
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: "stable", Port: networkingv1.ServiceBackendPort{Number: 80},
+					}},
+				}},
+			}},
+		}}},
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		}},
+	}}}
+
+	httpRoutes, err := r.Convert(context.Background(), ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 {
+		t.Fatalf("expected a single HTTPRoute, got %d", len(httpRoutes))
+	}
+	expected := map[string]string{
+		"app.kubernetes.io/name": "app",
+		canaryProviderLabel:      argoRolloutsProvider,
+		canaryLabel:              "demo-rollout",
+	}
+	if labels := httpRoutes[0].Labels; !isEqual(labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+}
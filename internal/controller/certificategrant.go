@@ -0,0 +1,127 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// certificateGrantLabel marks the ReferenceGrants created for the certificateRefs of the listeners of a provisioned
+// or managed Gateway, with their Gateway or XListenerSet in the owner annotation
+const certificateGrantLabel = "ingress2httproute.lion7.dev/certificate-grant"
+
+// ensureCertificateGrants creates the ReferenceGrants that allow the listeners of the parent, a Gateway or
+// XListenerSet, to reference the Secrets of their certificateRefs in other namespaces, unless a ReferenceGrant
+// allows it already. The ReferenceGrants created before that are no longer needed are deleted.
+func ensureCertificateGrants(ctx context.Context, c client.Client, parent gatewayv1.ParentReference, listeners []gatewayv1.Listener) error {
+	logger := log.FromContext(ctx)
+	namespace := string(*parent.Namespace)
+	kind := schema.GroupKind{Group: string(*parent.Group), Kind: string(*parent.Kind)}
+	owner := ownerAnnotationValue(kind, namespace, string(parent.Name))
+	from := gatewayv1beta1.ReferenceGrantFrom{Group: *parent.Group, Kind: *parent.Kind, Namespace: *parent.Namespace}
+
+	var desired []gatewayv1beta1.ReferenceGrant
+	for _, listener := range listeners {
+		if listener.TLS == nil {
+			continue
+		}
+		for _, certificate := range listener.TLS.CertificateRefs {
+			if certificate.Namespace == nil || string(*certificate.Namespace) == namespace {
+				continue
+			}
+			grant := gatewayv1beta1.ReferenceGrant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        truncateName(namespace + "-" + string(parent.Name) + "-" + string(certificate.Name)),
+					Namespace:   string(*certificate.Namespace),
+					Labels:      map[string]string{certificateGrantLabel: "true"},
+					Annotations: map[string]string{ownerAnnotation: owner},
+				},
+				Spec: gatewayv1beta1.ReferenceGrantSpec{
+					From: []gatewayv1beta1.ReferenceGrantFrom{from},
+					To:   []gatewayv1beta1.ReferenceGrantTo{{Group: "", Kind: "Secret", Name: ptr.To(certificate.Name)}},
+				},
+			}
+			if !slices.ContainsFunc(desired, func(existing gatewayv1beta1.ReferenceGrant) bool {
+				return existing.Namespace == grant.Namespace && existing.Name == grant.Name
+			}) {
+				desired = append(desired, grant)
+			}
+		}
+	}
+
+	var existing gatewayv1beta1.ReferenceGrantList
+	if err := c.List(ctx, &existing, client.MatchingLabels{certificateGrantLabel: "true"}); err != nil {
+		return err
+	}
+	for _, grant := range existing.Items {
+		if !isAnnotatedOwner(grant.Annotations, kind, namespace, string(parent.Name)) || slices.ContainsFunc(desired, func(desired gatewayv1beta1.ReferenceGrant) bool {
+			return desired.Namespace == grant.Namespace && desired.Name == grant.Name
+		}) {
+			continue
+		}
+		if err := c.Delete(ctx, &grant); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		logger.Info("deleted ReferenceGrant", "name", client.ObjectKeyFromObject(&grant))
+	}
+
+	for _, grant := range desired {
+		granted, err := isCertificateGranted(ctx, c, from, grant)
+		if err != nil {
+			return err
+		}
+		if granted {
+			continue
+		}
+		if err := c.Create(ctx, &grant); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+		logger.Info("created ReferenceGrant", "name", client.ObjectKeyFromObject(&grant))
+	}
+	return nil
+}
+
+// isCertificateGranted returns true if a ReferenceGrant in the namespace of the desired ReferenceGrant already
+// allows its reference, including the desired ReferenceGrant itself
+func isCertificateGranted(ctx context.Context, c client.Client, from gatewayv1beta1.ReferenceGrantFrom, desired gatewayv1beta1.ReferenceGrant) (bool, error) {
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := c.List(ctx, &grants, client.InNamespace(desired.Namespace)); err != nil {
+		return false, err
+	}
+	secret := *desired.Spec.To[0].Name
+	for _, grant := range grants.Items {
+		if !slices.Contains(grant.Spec.From, from) {
+			continue
+		}
+		for _, to := range grant.Spec.To {
+			if to.Group == "" && to.Kind == "Secret" && (to.Name == nil || *to.Name == secret) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestEnsureCertificateGrants(t *testing.T) {
+	ctx := context.Background()
+	parent := gatewayv1.ParentReference{
+		Group:     ptr.To(gatewayv1.Group(gatewayv1.GroupName)),
+		Kind:      ptr.To(gatewayv1.Kind("Gateway")),
+		Namespace: ptr.To(gatewayv1.Namespace("gateway")),
+		Name:      "ingress",
+	}
+	certificate := func(namespace, name string) gatewayv1.SecretObjectReference {
+		ref := gatewayv1.SecretObjectReference{Name: gatewayv1.ObjectName(name)}
+		if namespace != "" {
+			ref.Namespace = ptr.To(gatewayv1.Namespace(namespace))
+		}
+		return ref
+	}
+	listeners := []gatewayv1.Listener{
+		httpsListener("app.example.com", certificate("app", "app-tls")),
+		httpsListener("api.example.com", certificate("api", "api-tls")),
+		httpsListener("local.example.com", certificate("", "local-tls")),
+	}
+	// A ReferenceGrant of the user allows all Secrets in namespace api
+	existing := &gatewayv1beta1.ReferenceGrant{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "api", Name: "gateway-secrets"},
+		Spec: gatewayv1beta1.ReferenceGrantSpec{
+			From: []gatewayv1beta1.ReferenceGrantFrom{{Group: gatewayv1.GroupName, Kind: "Gateway", Namespace: "gateway"}},
+			To:   []gatewayv1beta1.ReferenceGrantTo{{Group: "", Kind: "Secret"}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(existing).Build()
+
+	if err := ensureCertificateGrants(ctx, c, parent, listeners); err != nil {
+		t.Fatal(err)
+	}
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := c.List(ctx, &grants, client.MatchingLabels{certificateGrantLabel: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(grants.Items) != 1 {
+		t.Fatalf("expected a ReferenceGrant for Secret app/app-tls only, got %+v", grants.Items)
+	}
+	grant := grants.Items[0]
+	expected := gatewayv1beta1.ReferenceGrantSpec{
+		From: []gatewayv1beta1.ReferenceGrantFrom{{Group: gatewayv1.GroupName, Kind: "Gateway", Namespace: "gateway"}},
+		To:   []gatewayv1beta1.ReferenceGrantTo{{Group: "", Kind: "Secret", Name: ptr.To(gatewayv1.ObjectName("app-tls"))}},
+	}
+	if grant.Namespace != "app" || grant.Name != "gateway-ingress-app-tls" || !isEqual(grant.Spec, expected) ||
+		grant.Annotations[ownerAnnotation] != "Gateway.gateway.networking.k8s.io/gateway/ingress" {
+		t.Errorf("unexpected ReferenceGrant: %+v", grant)
+	}
+
+	// The ReferenceGrants of another parent are left alone, the own ones are deleted once no longer needed
+	other := parent
+	other.Name = "other"
+	if err := ensureCertificateGrants(ctx, c, other, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(&grant), &gatewayv1beta1.ReferenceGrant{}); err != nil {
+		t.Errorf("expected the ReferenceGrant of another parent to be kept, got %v", err)
+	}
+	if err := ensureCertificateGrants(ctx, c, parent, listeners[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.List(ctx, &grants, client.MatchingLabels{certificateGrantLabel: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(grants.Items) != 0 {
+		t.Errorf("expected the ReferenceGrant to be deleted, got %+v", grants.Items)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(existing), &gatewayv1beta1.ReferenceGrant{}); err != nil {
+		t.Errorf("expected the ReferenceGrant of the user to be kept, got %v", err)
+	}
+}
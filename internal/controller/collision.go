@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// resolveHTTPRouteName returns the name to create or update the desired HTTPRoute with, and whether it collided.
+// Generated names can collide, e.g. Ingress app with host a-b.example.com and Ingress app-a with host
+// b.example.com. If the HTTPRoute with the generated name belongs to another owner, a name ending in a hash of
+// the owning Ingress is used instead. Once created, that name is kept even if the other HTTPRoute is deleted,
+// so the HTTPRoute does not move between names.
+func (r *IngressReconciler) resolveHTTPRouteName(ctx context.Context, desired gatewayv1.HTTPRoute, owner metav1.OwnerReference) (string, bool, error) {
+	alternate := alternateHTTPRouteName(desired.Name, owner)
+
+	existing := gatewayv1.HTTPRoute{}
+	err := r.routeClient().Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, &existing)
+	if err == nil {
+		if r.ownsRoute(existing.ObjectMeta, desired.ObjectMeta) {
+			return desired.Name, false, nil
+		}
+		return alternate, true, nil
+	}
+	if !errors.IsNotFound(err) {
+		return "", false, err
+	}
+
+	err = r.routeClient().Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: alternate}, &existing)
+	if err == nil && r.ownsRoute(existing.ObjectMeta, desired.ObjectMeta) {
+		return alternate, false, nil
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return "", false, err
+	}
+	return desired.Name, false, nil
+}
+
+// alternateHTTPRouteName returns the name used when the generated name belongs to another owner
+func alternateHTTPRouteName(name string, owner metav1.OwnerReference) string {
+	return truncateName(name + "-" + shortHash(owner.Name))
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+var _ = Describe("HTTPRoute name collisions", func() {
+	const namespace = "collision-namespace"
+
+	var (
+		gateway   *gatewayv1.Gateway
+		ingresses []*networkingv1.Ingress
+	)
+
+	newIngress := func(name, host string) *networkingv1.Ingress {
+		pathType := networkingv1.PathTypePrefix
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: name + "-service",
+							Port: networkingv1.ServiceBackendPort{Number: 80},
+						}},
+					}},
+				}},
+			}}},
+		}
+	}
+
+	BeforeEach(func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		Expect(ctrlclient.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).To(Succeed())
+
+		hostname := gatewayv1.Hostname("*.collision.example.com")
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "collision-gw", Namespace: namespace},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "test-class",
+				Listeners: []gatewayv1.Listener{{
+					Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80, Hostname: &hostname,
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, gateway)).To(Succeed())
+
+		// Both generate the HTTPRoute name app-a-b-collision-example-com
+		ingresses = []*networkingv1.Ingress{
+			newIngress("app", "a-b.collision.example.com"),
+			newIngress("app-a", "b.collision.example.com"),
+		}
+		for _, ingress := range ingresses {
+			Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		for _, ingress := range ingresses {
+			Expect(k8sClient.Delete(ctx, ingress)).To(Succeed())
+		}
+		Expect(k8sClient.Delete(ctx, gateway)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &gatewayv1.HTTPRoute{}, ctrlclient.InNamespace(namespace))).To(Succeed())
+	})
+
+	It("creates the HTTPRoute of the second Ingress under an alternate name", func() {
+		recorder := record.NewFakeRecorder(10)
+		reconciler := &IngressReconciler{
+			Client:   k8sClient,
+			Scheme:   k8sClient.Scheme(),
+			Recorder: recorder,
+		}
+
+		for _, ingress := range ingresses {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(recorder.Events).To(Receive(ContainSubstring("NameCollision")))
+
+		alternate := alternateHTTPRouteName("app-a-b-collision-example-com", createOwnerReference(*ingresses[1]))
+		for name, service := range map[string]string{
+			"app-a-b-collision-example-com": "app-service",
+			alternate:                       "app-a-service",
+		} {
+			httpRoute := gatewayv1.HTTPRoute{}
+			Expect(k8sClient.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, &httpRoute)).To(Succeed())
+			Expect(httpRoute.Spec.Rules[0].BackendRefs[0].Name).To(BeEquivalentTo(service))
+		}
+
+		By("keeping the alternate name once the other HTTPRoute is gone")
+		Expect(k8sClient.Delete(ctx, &gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app-a-b-collision-example-com"},
+		})).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingresses[1])})
+		Expect(err).NotTo(HaveOccurred())
+
+		var httpRoutes gatewayv1.HTTPRouteList
+		Expect(k8sClient.List(ctx, &httpRoutes, ctrlclient.InNamespace(namespace))).To(Succeed())
+		Expect(httpRoutes.Items).To(HaveLen(1))
+		Expect(httpRoutes.Items[0].Name).To(Equal(alternate))
+	})
+})
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// consolidateHTTPRouteRules merges the sorted rules that only differ in their matches, e.g. paths sharing a backend,
+// into the first of them, up to the number of matches a rule can hold. Gateways order matches by precedence
+// whatever rule they are in, only identical matches are resolved by rule order: a match is not moved ahead of a
+// rule with an identical match, so the same rule keeps winning.
+func consolidateHTTPRouteRules(rules []gatewayv1.HTTPRouteRule) []gatewayv1.HTTPRouteRule {
+	var result []gatewayv1.HTTPRouteRule
+	for _, rule := range rules {
+		index := slices.IndexFunc(result, func(candidate gatewayv1.HTTPRouteRule) bool {
+			return len(candidate.Matches)+len(rule.Matches) <= maxMatchesPerRule && isSameRuleAction(candidate, rule)
+		})
+		if index < 0 || isMatchShadowed(result[index+1:], rule.Matches) {
+			result = append(result, *rule.DeepCopy())
+			continue
+		}
+		result[index].Matches = append(result[index].Matches, rule.Matches...)
+	}
+	return result
+}
+
+// isSameRuleAction returns true if the rules do the same with the requests they match. Rules rewriting the prefix
+// of their match never are, as they can only have a single match.
+func isSameRuleAction(a, b gatewayv1.HTTPRouteRule) bool {
+	if hasReplacePrefixMatch(a) || hasReplacePrefixMatch(b) {
+		return false
+	}
+	a.Name, b.Name = nil, nil
+	a.Matches, b.Matches = nil, nil
+	return isEqual(a, b)
+}
+
+// isMatchShadowed returns true if any of the rules has one of the matches
+func isMatchShadowed(rules []gatewayv1.HTTPRouteRule, matches []gatewayv1.HTTPRouteMatch) bool {
+	return slices.ContainsFunc(rules, func(rule gatewayv1.HTTPRouteRule) bool {
+		return slices.ContainsFunc(rule.Matches, func(match gatewayv1.HTTPRouteMatch) bool {
+			return slices.ContainsFunc(matches, func(other gatewayv1.HTTPRouteMatch) bool {
+				return isEqual(match, other)
+			})
+		})
+	})
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestConsolidateHTTPRouteRules(t *testing.T) {
+	newRule := func(path, backend string) gatewayv1.HTTPRouteRule {
+		return gatewayv1.HTTPRouteRule{
+			Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{Value: ptr.To(path)}}},
+			BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(backend)},
+			}}},
+		}
+	}
+	paths := func(rules []gatewayv1.HTTPRouteRule) []string {
+		var result []string
+		for _, rule := range rules {
+			var values []string
+			for _, match := range rule.Matches {
+				values = append(values, *match.Path.Value)
+			}
+			result = append(result, fmt.Sprintf("%v->%s", values, rule.BackendRefs[0].Name))
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		rules    []gatewayv1.HTTPRouteRule
+		expected []string
+	}{
+		{
+			name:     "shared backend",
+			rules:    []gatewayv1.HTTPRouteRule{newRule("/static", "app"), newRule("/api", "api"), newRule("/", "app")},
+			expected: []string{"[/static /]->app", "[/api]->api"},
+		},
+		{
+			// The second /x must keep losing to the api rule
+			name:     "identical match in between",
+			rules:    []gatewayv1.HTTPRouteRule{newRule("/y", "app"), newRule("/x", "api"), newRule("/x", "app")},
+			expected: []string{"[/y]->app", "[/x]->api", "[/x]->app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := paths(consolidateHTTPRouteRules(tt.rules)); !isEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// A rule holds at most 64 matches
+	var rules []gatewayv1.HTTPRouteRule
+	for i := range 70 {
+		rules = append(rules, newRule(fmt.Sprintf("/%d", i), "app"))
+	}
+	if result := consolidateHTTPRouteRules(rules); len(result) != 2 || len(result[0].Matches) != maxMatchesPerRule {
+		t.Errorf("expected 2 rules of which the first has %d matches, got %d rules", maxMatchesPerRule, len(result))
+	}
+}
@@ -0,0 +1,813 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// ContourHTTPProxyGVK is the kind of the HTTPProxies of Contour, which are converted by the ContourHTTPProxyReconciler
+var ContourHTTPProxyGVK = schema.GroupVersionKind{Group: "projectcontour.io", Version: "v1", Kind: "HTTPProxy"}
+
+const (
+	// contourRouteKind is the kind of the backends of the Ingress paths the routes of an HTTPProxy are mapped to,
+	// named after the index of the route among the routes of the HTTPProxy and the HTTPProxies it includes
+	contourRouteKind = "ContourRoute"
+	// contourInfinity disables a timeout of a route
+	contourInfinity = "infinity"
+	// contourDefaultRetries is the number of retries of a retry policy without a count
+	contourDefaultRetries = 1
+	// contourRetriableStatusCodes is the retry condition retrying on the retriable status codes of the retry policy
+	contourRetriableStatusCodes = "retriable-status-codes"
+)
+
+// contourHTTPProxySpec is the part of the spec of an HTTPProxy of Contour that is converted
+type contourHTTPProxySpec struct {
+	VirtualHost *contourVirtualHost `json:"virtualhost,omitempty"`
+	Routes      []contourRoute      `json:"routes,omitempty"`
+	Includes    []contourInclude    `json:"includes,omitempty"`
+}
+
+type contourVirtualHost struct {
+	FQDN string `json:"fqdn"`
+	TLS  *struct {
+		SecretName  string `json:"secretName,omitempty"`
+		Passthrough bool   `json:"passthrough,omitempty"`
+	} `json:"tls,omitempty"`
+}
+
+type contourInclude struct {
+	Name       string             `json:"name"`
+	Namespace  string             `json:"namespace,omitempty"`
+	Conditions []contourCondition `json:"conditions,omitempty"`
+}
+
+type contourRoute struct {
+	Conditions            []contourCondition     `json:"conditions,omitempty"`
+	Services              []contourService       `json:"services,omitempty"`
+	TimeoutPolicy         *contourTimeoutPolicy  `json:"timeoutPolicy,omitempty"`
+	RetryPolicy           *contourRetryPolicy    `json:"retryPolicy,omitempty"`
+	PathRewritePolicy     *contourPathRewrite    `json:"pathRewritePolicy,omitempty"`
+	RequestHeadersPolicy  *contourHeadersPolicy  `json:"requestHeadersPolicy,omitempty"`
+	ResponseHeadersPolicy *contourHeadersPolicy  `json:"responseHeadersPolicy,omitempty"`
+	RequestRedirectPolicy *contourRedirectPolicy `json:"requestRedirectPolicy,omitempty"`
+}
+
+type contourCondition struct {
+	Prefix         string                      `json:"prefix,omitempty"`
+	Exact          string                      `json:"exact,omitempty"`
+	Regex          string                      `json:"regex,omitempty"`
+	Header         *contourHeaderCondition     `json:"header,omitempty"`
+	QueryParameter *contourQueryParamCondition `json:"queryParameter,omitempty"`
+}
+
+type contourHeaderCondition struct {
+	Name        string `json:"name"`
+	Present     bool   `json:"present,omitempty"`
+	NotPresent  bool   `json:"notpresent,omitempty"`
+	Contains    string `json:"contains,omitempty"`
+	NotContains string `json:"notcontains,omitempty"`
+	Exact       string `json:"exact,omitempty"`
+	NotExact    string `json:"notexact,omitempty"`
+	IgnoreCase  bool   `json:"ignoreCase,omitempty"`
+}
+
+type contourQueryParamCondition struct {
+	Name       string `json:"name"`
+	Exact      string `json:"exact,omitempty"`
+	Prefix     string `json:"prefix,omitempty"`
+	Suffix     string `json:"suffix,omitempty"`
+	Regex      string `json:"regex,omitempty"`
+	Contains   string `json:"contains,omitempty"`
+	IgnoreCase bool   `json:"ignoreCase,omitempty"`
+	Present    bool   `json:"present,omitempty"`
+}
+
+type contourService struct {
+	Name                  string                `json:"name"`
+	Port                  int32                 `json:"port"`
+	Weight                int32                 `json:"weight,omitempty"`
+	Mirror                bool                  `json:"mirror,omitempty"`
+	RequestHeadersPolicy  *contourHeadersPolicy `json:"requestHeadersPolicy,omitempty"`
+	ResponseHeadersPolicy *contourHeadersPolicy `json:"responseHeadersPolicy,omitempty"`
+}
+
+type contourHeadersPolicy struct {
+	Set []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"set,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+type contourTimeoutPolicy struct {
+	Response string `json:"response,omitempty"`
+}
+
+type contourRetryPolicy struct {
+	Count                int                                  `json:"count,omitempty"`
+	PerTryTimeout        string                               `json:"perTryTimeout,omitempty"`
+	RetryOn              []string                             `json:"retryOn,omitempty"`
+	RetriableStatusCodes []gatewayv1.HTTPRouteRetryStatusCode `json:"retriableStatusCodes,omitempty"`
+}
+
+type contourPathRewrite struct {
+	ReplacePrefix []struct {
+		Prefix      string `json:"prefix,omitempty"`
+		Replacement string `json:"replacement"`
+	} `json:"replacePrefix,omitempty"`
+}
+
+type contourRedirectPolicy struct {
+	Scheme     *string `json:"scheme,omitempty"`
+	Hostname   *string `json:"hostname,omitempty"`
+	Port       *int32  `json:"port,omitempty"`
+	StatusCode *int    `json:"statusCode,omitempty"`
+	Path       *string `json:"path,omitempty"`
+	Prefix     *string `json:"prefix,omitempty"`
+}
+
+// contourProxyRoute is a route of an HTTPProxy or of an HTTPProxy it includes, with the match of its conditions and
+// of those of the includes leading to it
+type contourProxyRoute struct {
+	namespace string
+	route     contourRoute
+	match     gatewayv1.HTTPRouteMatch
+}
+
+// ContourHTTPProxyReconciler converts the root HTTPProxies of Contour, and the HTTPProxies they include, to
+// HTTPRoutes. Each root HTTPProxy is mapped to an Ingress with a path for each of its routes and the routes of the
+// HTTPProxies it includes, which is converted like any other Ingress, so the HTTPProxies attach to the same Gateways.
+// The rules converted from the paths then match, forward and modify the requests as the routes do. The generated
+// HTTPRoutes are owned by the root HTTPProxy.
+type ContourHTTPProxyReconciler struct {
+	// IngressReconciler converts the Ingresses the HTTPProxies are mapped to, with its settings. The features that
+	// write to an Ingress, such as annotating or retiring it, do not apply to HTTPProxies.
+	*IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=projectcontour.io,resources=httpproxies,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=projectcontour.io,resources=httpproxies/finalizers,verbs=update
+
+// Reconcile converts a root HTTPProxy to the HTTPRoutes that should exist for it, and deletes the stale ones. The
+// HTTPRoutes of a deleted HTTPProxy are garbage collected, those in the namespaces of their Gateways are deleted by
+// its finalizer.
+func (r *ContourHTTPProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	proxy := &unstructured.Unstructured{}
+	proxy.SetGroupVersionKind(ContourHTTPProxyGVK)
+	if err := r.Get(ctx, req.NamespacedName, proxy); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !proxy.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalizeSource(audit.WithReason(ctx, audit.ReasonIngressFinalized), proxy)
+	}
+
+	converter := r.converter(proxy)
+	ingress, err := r.ContourHTTPProxyIngress(ctx, proxy)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if converter.isPaused(ingress) {
+		logger.V(1).Info("skipping paused HTTPProxy")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := converter.listGateways(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gateways = converter.candidateGateways(gateways)
+
+	// The HTTPProxies without routes of their own, such as those only included by others, have no HTTPRoutes
+	if converter.placesRoutes() && len(ingress.Spec.Rules) > 0 {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), proxy); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	httpRoutes, convertErr := r.ConvertContourHTTPProxy(ctx, proxy, ingress, gateways)
+	return converter.applyRoutes(ctx, ingress, gateways, httpRoutes, nil, convertErr)
+}
+
+// ConvertContourHTTPProxy maps the HTTPProxy, with the Ingress returned by ContourHTTPProxyIngress, to the HTTPRoutes
+// that should exist for it, given the available Gateways. The rules converted from the paths of the Ingress match the
+// requests by the conditions of their route, forward them to its Services by weight, or redirect them, and modify
+// them with its header and path rewrite policies and timeouts, and with RetryPolicies its retries.
+func (r *ContourHTTPProxyReconciler) ConvertContourHTTPProxy(ctx context.Context, proxy *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	converter := r.converter(proxy)
+	converter.completeSourceRules = func(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) error {
+		routes, _, _, err := r.contourProxyRoutes(ctx, proxy)
+		if err != nil {
+			return err
+		}
+		for i := range httpRoutes {
+			rules := httpRoutes[i].Spec.Rules
+			for j := range rules {
+				name, ok := sourceRuleName(rules[j], contourRouteKind)
+				if !ok {
+					continue
+				}
+				index, err := strconv.Atoi(name)
+				if err != nil || index >= len(routes) {
+					continue
+				}
+				if err := r.completeContourRule(ctx, proxy, routes[index], &rules[j]); err != nil {
+					return err
+				}
+			}
+			slices.SortStableFunc(rules, compareHTTPRouteRule)
+		}
+		return nil
+	}
+	return converter.Convert(ctx, ingress, gateways)
+}
+
+// ContourHTTPProxyIngress returns the Ingress the HTTPProxy is mapped to. It carries the kind, name and UID of the
+// HTTPProxy, so the HTTPProxy owns the generated HTTPRoutes, and its annotations, so the annotations of the controller
+// apply. Each route of the HTTPProxy and of the HTTPProxies it includes is a path for its fqdn, which is listed under
+// spec.tls if the HTTPProxy has TLS. HTTPProxies without a virtual host are only converted as part of the root
+// HTTPProxies including them, and TLS passthrough is not converted. The fields that are not converted, and routes
+// whose conditions cannot be, are reported with an Event.
+func (r *ContourHTTPProxyReconciler) ContourHTTPProxyIngress(ctx context.Context, proxy *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	spec, err := decodeContourHTTPProxy(proxy)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	converter := r.converter(proxy)
+
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ContourHTTPProxyGVK.GroupVersion().String(),
+			Kind:       ContourHTTPProxyGVK.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        proxy.GetName(),
+			Namespace:   proxy.GetNamespace(),
+			UID:         proxy.GetUID(),
+			Annotations: make(map[string]string),
+		},
+	}
+	for key, value := range proxy.GetAnnotations() {
+		ingress.Annotations[key] = value
+	}
+	if spec.VirtualHost == nil || spec.VirtualHost.FQDN == "" {
+		return ingress, nil
+	}
+	host := strings.ToLower(spec.VirtualHost.FQDN)
+	if tls := spec.VirtualHost.TLS; tls != nil && tls.Passthrough {
+		converter.event(proxy, corev1.EventTypeWarning, "UnsupportedPassthrough",
+			"HTTPProxies passing TLS through are not converted, their TCP proxies have no HTTPRoute equivalent")
+		return ingress, nil
+	}
+
+	routes, unconverted, invalid, err := r.contourProxyRoutes(ctx, proxy)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	for _, message := range invalid {
+		converter.event(proxy, corev1.EventTypeWarning, "UnsupportedRoute", message)
+	}
+	if len(unconverted) > 0 {
+		converter.event(proxy, corev1.EventTypeWarning, "UnconvertedFields",
+			fmt.Sprintf("Fields %s have no HTTPRoute equivalent and are not converted", strings.Join(unconverted, ", ")))
+	}
+
+	var paths []networkingv1.HTTPIngressPath
+	for i := range routes {
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     "/",
+			PathType: ptr.To(networkingv1.PathTypePrefix),
+			Backend:  sourceRuleBackend(contourRouteKind, strconv.Itoa(i)),
+		})
+	}
+	if len(paths) > 0 {
+		ingress.Spec.Rules = []networkingv1.IngressRule{{
+			Host:             host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}},
+		}}
+	}
+	if tls := spec.VirtualHost.TLS; tls != nil {
+		// A Secret delegated from another namespace is served by the listeners of any Secret
+		ingressTLS := networkingv1.IngressTLS{Hosts: []string{host}}
+		if !strings.Contains(tls.SecretName, "/") {
+			ingressTLS.SecretName = tls.SecretName
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{ingressTLS}
+	}
+	return ingress, nil
+}
+
+// converter returns the reconciler converting the Ingress of the HTTPProxy. The fqdn of an HTTPProxy with TLS only
+// attaches to HTTPS listeners, and its HTTP listeners redirect to HTTPS, as Contour does.
+func (r *ContourHTTPProxyReconciler) converter(proxy *unstructured.Unstructured) *IngressReconciler {
+	converter := r.sourceConverter(proxy)
+	converter.TLSListeners = true
+	converter.TLSRedirect = true
+	return converter
+}
+
+// decodeContourHTTPProxy returns the spec of the HTTPProxy
+func decodeContourHTTPProxy(proxy *unstructured.Unstructured) (contourHTTPProxySpec, error) {
+	var spec contourHTTPProxySpec
+	content, _, err := unstructured.NestedMap(proxy.UnstructuredContent(), "spec")
+	if err != nil {
+		return spec, err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec)
+	return spec, err
+}
+
+// contourProxyRoutes returns the routes of the HTTPProxy and of the HTTPProxies it includes, in order, with the
+// fields of those HTTPProxies that are not converted and a message for each route or include that is left out
+func (r *ContourHTTPProxyReconciler) contourProxyRoutes(ctx context.Context, proxy *unstructured.Unstructured) ([]contourProxyRoute, []string, []string, error) {
+	var routes []contourProxyRoute
+	var unconverted, invalid []string
+	visited := map[types.NamespacedName]bool{}
+
+	var walk func(proxy *unstructured.Unstructured, conditions []contourCondition) error
+	walk = func(proxy *unstructured.Unstructured, conditions []contourCondition) error {
+		key := client.ObjectKeyFromObject(proxy)
+		visited[key] = true
+		defer delete(visited, key)
+		spec, err := decodeContourHTTPProxy(proxy)
+		if err != nil {
+			return err
+		}
+		for _, field := range unconvertedFields(proxy.Object["spec"], r.contourConvertedFields(), "spec") {
+			unconverted = append(unconverted, key.String()+" "+field)
+		}
+
+		for i, route := range spec.Routes {
+			match, err := contourMatch(append(slices.Clone(conditions), route.Conditions...))
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("Route %d of %s is not converted: %v", i, key, err))
+				continue
+			}
+			routes = append(routes, contourProxyRoute{namespace: proxy.GetNamespace(), route: route, match: match})
+		}
+
+		for _, include := range spec.Includes {
+			childKey := types.NamespacedName{Namespace: include.Namespace, Name: include.Name}
+			if childKey.Namespace == "" {
+				childKey.Namespace = proxy.GetNamespace()
+			}
+			if visited[childKey] {
+				invalid = append(invalid, fmt.Sprintf("Include %s of %s is not converted, it forms a cycle", childKey, key))
+				continue
+			}
+			child := &unstructured.Unstructured{}
+			child.SetGroupVersionKind(ContourHTTPProxyGVK)
+			if err := r.Get(ctx, childKey, child); errors.IsNotFound(err) {
+				invalid = append(invalid, fmt.Sprintf("Include %s of %s is not converted, it does not exist", childKey, key))
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := walk(child, append(slices.Clone(conditions), include.Conditions...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(proxy, nil); err != nil {
+		return nil, nil, nil, err
+	}
+	return routes, unconverted, invalid, nil
+}
+
+// contourConvertedFields returns the fields of the spec of an HTTPProxy that are converted with the settings of the
+// reconciler
+func (r *ContourHTTPProxyReconciler) contourConvertedFields() fieldSet {
+	route := fieldSet{
+		"conditions": nil,
+		"services": fieldSet{
+			"name": nil, "port": nil, "weight": nil, "mirror": nil,
+			"requestHeadersPolicy": nil, "responseHeadersPolicy": nil,
+		},
+		"pathRewritePolicy":     nil,
+		"requestHeadersPolicy":  nil,
+		"responseHeadersPolicy": nil,
+		"requestRedirectPolicy": nil,
+		"enableWebsockets":      nil,
+	}
+	retry := fieldSet{}
+	if !r.OmitTimeouts {
+		route["timeoutPolicy"] = fieldSet{"response": nil}
+		retry["perTryTimeout"] = nil
+	}
+	if r.RetryPolicies {
+		retry["count"] = nil
+		retry["retryOn"] = nil
+		retry["retriableStatusCodes"] = nil
+	}
+	route["retryPolicy"] = retry
+	return fieldSet{
+		"ingressClassName": nil,
+		"virtualhost":      fieldSet{"fqdn": nil, "tls": fieldSet{"secretName": nil, "passthrough": nil}},
+		"routes":           route,
+		"includes":         nil,
+	}
+}
+
+// contourMatch returns the HTTPRoute match of the conditions of a route, preceded by those of the includes leading to
+// it. The prefixes of the conditions are joined, an exact path is appended to them. Negated header conditions have no
+// HTTPRoute equivalent.
+func contourMatch(conditions []contourCondition) (gatewayv1.HTTPRouteMatch, error) {
+	var match gatewayv1.HTTPRouteMatch
+	prefix := ""
+	for _, condition := range conditions {
+		if match.Path != nil && (condition.Prefix != "" || condition.Exact != "" || condition.Regex != "") {
+			return match, fmt.Errorf("a path condition follows an exact or regex condition")
+		}
+		switch {
+		case condition.Prefix != "":
+			prefix = joinContourPath(prefix, condition.Prefix)
+		case condition.Exact != "":
+			match.Path = &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchExact),
+				Value: ptr.To(joinContourPath(prefix, condition.Exact)),
+			}
+		case condition.Regex != "":
+			if prefix != "" {
+				return match, fmt.Errorf("a regex condition cannot be combined with the prefix %s", prefix)
+			}
+			match.Path = &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchRegularExpression),
+				Value: ptr.To(condition.Regex),
+			}
+		case condition.Header != nil:
+			header, err := contourHeaderMatch(*condition.Header)
+			if err != nil {
+				return match, err
+			}
+			match.Headers = append(match.Headers, header)
+		case condition.QueryParameter != nil:
+			match.QueryParams = append(match.QueryParams, contourQueryParamMatch(*condition.QueryParameter))
+		}
+	}
+	if match.Path == nil {
+		match.Path = &gatewayv1.HTTPPathMatch{
+			Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+			Value: ptr.To(joinContourPath(prefix, "/")),
+		}
+	}
+	return match, nil
+}
+
+// joinContourPath appends the path of a condition to the prefix of the conditions before it
+func joinContourPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	if path == "/" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// contourHeaderMatch returns the header match of a header condition, with a regular expression for the conditions
+// that do not match the whole value exactly
+func contourHeaderMatch(condition contourHeaderCondition) (gatewayv1.HTTPHeaderMatch, error) {
+	match := gatewayv1.HTTPHeaderMatch{
+		Type: ptr.To(gatewayv1.HeaderMatchRegularExpression),
+		Name: gatewayv1.HTTPHeaderName(condition.Name),
+	}
+	switch {
+	case condition.NotPresent || condition.NotContains != "" || condition.NotExact != "":
+		return match, fmt.Errorf("the negated condition of header %s has no HTTPRoute equivalent", condition.Name)
+	case condition.Exact != "" && !condition.IgnoreCase:
+		match.Type = ptr.To(gatewayv1.HeaderMatchExact)
+		match.Value = condition.Exact
+	case condition.Exact != "":
+		match.Value = "^" + regexp.QuoteMeta(condition.Exact) + "$"
+	case condition.Contains != "":
+		match.Value = ".*" + regexp.QuoteMeta(condition.Contains) + ".*"
+	default:
+		match.Value = ".*"
+	}
+	if condition.IgnoreCase && match.Value != ".*" {
+		match.Value = "(?i)" + match.Value
+	}
+	return match, nil
+}
+
+// contourQueryParamMatch returns the query parameter match of a query parameter condition, with a regular expression
+// for the conditions that do not match the whole value exactly
+func contourQueryParamMatch(condition contourQueryParamCondition) gatewayv1.HTTPQueryParamMatch {
+	match := gatewayv1.HTTPQueryParamMatch{
+		Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression),
+		Name: gatewayv1.HTTPHeaderName(condition.Name),
+	}
+	switch {
+	case condition.Exact != "" && !condition.IgnoreCase:
+		match.Type = ptr.To(gatewayv1.QueryParamMatchExact)
+		match.Value = condition.Exact
+	case condition.Exact != "":
+		match.Value = "^" + regexp.QuoteMeta(condition.Exact) + "$"
+	case condition.Prefix != "":
+		match.Value = "^" + regexp.QuoteMeta(condition.Prefix) + ".*"
+	case condition.Suffix != "":
+		match.Value = ".*" + regexp.QuoteMeta(condition.Suffix) + "$"
+	case condition.Contains != "":
+		match.Value = ".*" + regexp.QuoteMeta(condition.Contains) + ".*"
+	case condition.Regex != "":
+		match.Value = condition.Regex
+	default:
+		match.Value = ".*"
+	}
+	if condition.IgnoreCase && match.Value != ".*" {
+		match.Value = "(?i)" + match.Value
+	}
+	return match
+}
+
+// completeContourRule makes the rule converted from the path of the route match, forward and modify the requests as
+// the route does
+func (r *ContourHTTPProxyReconciler) completeContourRule(ctx context.Context, proxy *unstructured.Unstructured, route contourProxyRoute, rule *gatewayv1.HTTPRouteRule) error {
+	rule.Matches = []gatewayv1.HTTPRouteMatch{*route.match.DeepCopy()}
+	rule.BackendRefs = nil
+
+	filters := rule.Filters
+	filters = append(filters, contourHeaderFilters(route.route.RequestHeadersPolicy, route.route.ResponseHeadersPolicy)...)
+	if redirect := route.route.RequestRedirectPolicy; redirect != nil {
+		rule.Filters = mergeHeaderFilters(append(filters, contourRedirectFilter(*redirect)))
+		return nil
+	}
+	if rewrite := r.contourPathRewriteFilter(proxy, route); rewrite != nil {
+		filters = append(filters, *rewrite)
+	}
+
+	weighted := slices.ContainsFunc(route.route.Services, func(service contourService) bool {
+		return !service.Mirror && service.Weight > 0
+	})
+	backends := 0
+	for _, service := range route.route.Services {
+		if !service.Mirror {
+			backends++
+		}
+	}
+	for _, service := range route.route.Services {
+		weight := r.backendWeight()
+		if weighted {
+			weight = ptr.To(service.Weight)
+		} else if backends > 1 {
+			weight = ptr.To[int32](1)
+		}
+		backendRef, err := r.mapBackendRef(ctx, route.namespace, networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: service.Name,
+				Port: networkingv1.ServiceBackendPort{Number: service.Port},
+			},
+		}, weight)
+		if err != nil {
+			return err
+		}
+		if route.namespace != proxy.GetNamespace() {
+			if err := r.sourceReferenceGranted(ctx, proxy, backendRef.BackendObjectReference); err != nil {
+				return err
+			}
+		}
+		if service.Mirror {
+			filters = append(filters, gatewayv1.HTTPRouteFilter{
+				Type:          gatewayv1.HTTPRouteFilterRequestMirror,
+				RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{BackendRef: backendRef.BackendObjectReference},
+			})
+			continue
+		}
+		backendRef.Filters = contourHeaderFilters(service.RequestHeadersPolicy, service.ResponseHeadersPolicy)
+		rule.BackendRefs = append(rule.BackendRefs, *backendRef)
+	}
+	rule.Filters = mergeHeaderFilters(filters)
+
+	if !r.OmitTimeouts {
+		rule.Timeouts = r.contourTimeouts(proxy, route.route)
+	}
+	if retry := route.route.RetryPolicy; retry != nil && r.RetryPolicies {
+		rule.Retry = r.contourRetry(proxy, *retry)
+	}
+	return nil
+}
+
+// contourHeaderFilters returns the header modifier filters of the request and response headers policies. Setting the
+// Host header of the requests rewrites their hostname instead.
+func contourHeaderFilters(request, response *contourHeadersPolicy) []gatewayv1.HTTPRouteFilter {
+	var filters []gatewayv1.HTTPRouteFilter
+	if request != nil {
+		modifier := &gatewayv1.HTTPHeaderFilter{Remove: request.Remove}
+		for _, header := range request.Set {
+			if strings.EqualFold(header.Name, "Host") {
+				filters = append(filters, gatewayv1.HTTPRouteFilter{
+					Type:       gatewayv1.HTTPRouteFilterURLRewrite,
+					URLRewrite: &gatewayv1.HTTPURLRewriteFilter{Hostname: ptr.To(gatewayv1.PreciseHostname(header.Value))},
+				})
+				continue
+			}
+			modifier.Set = append(modifier.Set, gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(header.Name), Value: header.Value})
+		}
+		if len(modifier.Set) > 0 || len(modifier.Remove) > 0 {
+			filters = append(filters, gatewayv1.HTTPRouteFilter{
+				Type:                  gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+				RequestHeaderModifier: modifier,
+			})
+		}
+	}
+	if response != nil {
+		modifier := &gatewayv1.HTTPHeaderFilter{Remove: response.Remove}
+		for _, header := range response.Set {
+			modifier.Set = append(modifier.Set, gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(header.Name), Value: header.Value})
+		}
+		if len(modifier.Set) > 0 || len(modifier.Remove) > 0 {
+			filters = append(filters, gatewayv1.HTTPRouteFilter{
+				Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+				ResponseHeaderModifier: modifier,
+			})
+		}
+	}
+	return filters
+}
+
+// contourRedirectFilter returns the redirect filter of the redirect policy, which redirects with a 302 by default
+func contourRedirectFilter(policy contourRedirectPolicy) gatewayv1.HTTPRouteFilter {
+	redirect := &gatewayv1.HTTPRequestRedirectFilter{
+		Scheme:     policy.Scheme,
+		Hostname:   (*gatewayv1.PreciseHostname)(policy.Hostname),
+		Port:       (*gatewayv1.PortNumber)(policy.Port),
+		StatusCode: ptr.To(ptr.Deref(policy.StatusCode, 302)),
+	}
+	switch {
+	case policy.Path != nil:
+		redirect.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: policy.Path}
+	case policy.Prefix != nil:
+		redirect.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: policy.Prefix}
+	}
+	return gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: redirect}
+}
+
+// contourPathRewriteFilter returns the URL rewrite filter replacing the prefix of the route, with the replacement of
+// the prefix matching it or the replacement without a prefix. The prefix of other paths cannot be replaced, which is
+// reported with an Event.
+func (r *ContourHTTPProxyReconciler) contourPathRewriteFilter(proxy *unstructured.Unstructured, route contourProxyRoute) *gatewayv1.HTTPRouteFilter {
+	rewrite := route.route.PathRewritePolicy
+	if rewrite == nil || len(rewrite.ReplacePrefix) == 0 {
+		return nil
+	}
+	path := route.match.Path
+	if *path.Type != gatewayv1.PathMatchPathPrefix {
+		r.converter(proxy).event(proxy, corev1.EventTypeWarning, "UnsupportedPathRewrite",
+			fmt.Sprintf("The prefix of path %s cannot be replaced, it is not a prefix condition", *path.Value))
+		return nil
+	}
+	for _, replace := range rewrite.ReplacePrefix {
+		if replace.Prefix == "" || replace.Prefix == *path.Value {
+			return &gatewayv1.HTTPRouteFilter{
+				Type: gatewayv1.HTTPRouteFilterURLRewrite,
+				URLRewrite: &gatewayv1.HTTPURLRewriteFilter{Path: &gatewayv1.HTTPPathModifier{
+					Type:               gatewayv1.PrefixMatchHTTPPathModifier,
+					ReplacePrefixMatch: ptr.To(replace.Replacement),
+				}},
+			}
+		}
+	}
+	return nil
+}
+
+// contourTimeouts returns the timeouts of the timeout policy of the route and of the tries of its retry policy, or nil
+// if it has neither. An unparsable timeout is ignored with an Event.
+func (r *ContourHTTPProxyReconciler) contourTimeouts(proxy *unstructured.Unstructured, route contourRoute) *gatewayv1.HTTPRouteTimeouts {
+	timeouts := &gatewayv1.HTTPRouteTimeouts{}
+	if route.TimeoutPolicy != nil && route.TimeoutPolicy.Response != "" {
+		timeouts.Request = r.contourDuration(proxy, route.TimeoutPolicy.Response)
+	}
+	if route.RetryPolicy != nil && route.RetryPolicy.PerTryTimeout != "" {
+		timeouts.BackendRequest = r.contourDuration(proxy, route.RetryPolicy.PerTryTimeout)
+	}
+	if timeouts.Request == nil && timeouts.BackendRequest == nil {
+		return nil
+	}
+	return timeouts
+}
+
+// contourDuration returns the Gateway API duration of a timeout of Contour, 0s to disable it for infinity
+func (r *ContourHTTPProxyReconciler) contourDuration(proxy *unstructured.Unstructured, value string) *gatewayv1.Duration {
+	if value == contourInfinity {
+		return ptr.To(gatewayv1.Duration("0s"))
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		r.converter(proxy).event(proxy, corev1.EventTypeWarning, "UnsupportedTimeout",
+			fmt.Sprintf("Timeout %q is not a duration, it is not converted", value))
+		return nil
+	}
+	return ptr.To(formatPreciseDuration(duration))
+}
+
+// contourRetry returns the retry of the retry policy, retrying on the status codes of its conditions. The conditions
+// that do not retry on status codes, such as reset, are reported with an Event.
+func (r *ContourHTTPProxyReconciler) contourRetry(proxy *unstructured.Unstructured, policy contourRetryPolicy) *gatewayv1.HTTPRouteRetry {
+	attempts := policy.Count
+	if attempts == 0 {
+		attempts = contourDefaultRetries
+	}
+	retryOn := policy.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{"5xx"}
+	}
+	var codes []gatewayv1.HTTPRouteRetryStatusCode
+	var unsupported []string
+	for _, condition := range retryOn {
+		switch {
+		case condition == contourRetriableStatusCodes:
+			codes = append(codes, policy.RetriableStatusCodes...)
+		case envoyRetryCodes[condition] != nil:
+			codes = append(codes, envoyRetryCodes[condition]...)
+		default:
+			unsupported = append(unsupported, condition)
+		}
+	}
+	if len(unsupported) > 0 {
+		r.converter(proxy).event(proxy, corev1.EventTypeWarning, "UnsupportedRetryOn",
+			fmt.Sprintf("Retry conditions %s are not status codes, the requests are not retried for them",
+				strings.Join(unsupported, ", ")))
+	}
+	slices.Sort(codes)
+	return &gatewayv1.HTTPRouteRetry{Attempts: ptr.To(attempts), Codes: slices.Compact(codes)}
+}
+
+// contourHTTPProxyHosts returns the fqdn of a root HTTPProxy to index it by, none for the HTTPProxies it includes
+func contourHTTPProxyHosts(proxy *unstructured.Unstructured) []string {
+	fqdn, _, _ := unstructured.NestedString(proxy.Object, "spec", "virtualhost", "fqdn")
+	if fqdn == "" {
+		return nil
+	}
+	return []string{strings.ToLower(fqdn)}
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *ContourHTTPProxyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	proxy := &unstructured.Unstructured{}
+	proxy.SetGroupVersionKind(ContourHTTPProxyGVK)
+
+	// Every change of an included HTTPProxy may change the HTTPRoutes of the root HTTPProxies
+	enqueueRoots := handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, _ client.Object) []reconcile.Request {
+		proxies := &unstructured.UnstructuredList{}
+		proxies.SetGroupVersionKind(ContourHTTPProxyGVK.GroupVersion().WithKind(ContourHTTPProxyGVK.Kind + "List"))
+		if err := r.List(ctx, proxies); err != nil {
+			log.FromContext(ctx).Error(err, "cannot list httpproxies")
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, item := range proxies.Items {
+			if _, root, _ := unstructured.NestedMap(item.Object, "spec", "virtualhost"); root {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+			}
+		}
+		return requests
+	})
+
+	b, err := r.sourceControllerBuilder(mgr, "contourhttpproxy", ContourHTTPProxyGVK, contourHTTPProxyHosts)
+	if err != nil {
+		return err
+	}
+	return b.Watches(proxy, enqueueRoots).Complete(r)
+}
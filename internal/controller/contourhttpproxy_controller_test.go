@@ -0,0 +1,243 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func testContourHTTPProxyReconciler(recorder record.EventRecorder, objects ...client.Object) *ContourHTTPProxyReconciler {
+	return &ContourHTTPProxyReconciler{IngressReconciler: &IngressReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(objects...).Build(),
+		Recorder:      recorder,
+		RetryPolicies: true,
+	}}
+}
+
+func TestContourMatch(t *testing.T) {
+	match, err := contourMatch([]contourCondition{
+		{Prefix: "/api"},
+		{Header: &contourHeaderCondition{Name: "X-Tenant", Contains: "acme", IgnoreCase: true}},
+		{Exact: "/v1"},
+		{QueryParameter: &contourQueryParamCondition{Name: "debug", Present: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := gatewayv1.HTTPRouteMatch{
+		Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/api/v1")},
+		Headers: []gatewayv1.HTTPHeaderMatch{
+			{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "X-Tenant", Value: "(?i).*acme.*"},
+		},
+		QueryParams: []gatewayv1.HTTPQueryParamMatch{
+			{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "debug", Value: ".*"},
+		},
+	}
+	if !isEqual(match, expected) {
+		t.Errorf("unexpected match: %+v", match)
+	}
+
+	for _, conditions := range [][]contourCondition{
+		{{Header: &contourHeaderCondition{Name: "X-Debug", NotPresent: true}}},
+		{{Prefix: "/api"}, {Regex: "/v[0-9]+"}},
+	} {
+		if _, err := contourMatch(conditions); err == nil {
+			t.Errorf("expected an error for %+v", conditions)
+		}
+	}
+}
+
+func TestUnconvertedFields(t *testing.T) {
+	content := map[string]any{
+		"virtualhost": map[string]any{"fqdn": "app.example.com", "corsPolicy": map[string]any{}},
+		"routes": []any{
+			map[string]any{"conditions": []any{}, "loadBalancerPolicy": map[string]any{}},
+		},
+	}
+	fields := fieldSet{"virtualhost": fieldSet{"fqdn": nil}, "routes": fieldSet{"conditions": nil}}
+	unconverted := unconvertedFields(content, fields, "spec")
+	if !isEqual(unconverted, []string{"spec.routes[0].loadBalancerPolicy", "spec.virtualhost.corsPolicy"}) {
+		t.Errorf("unexpected fields: %v", unconverted)
+	}
+}
+
+func TestConvertContourHTTPProxy(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	root := sourceObject(ContourHTTPProxyGVK, "default", "app", map[string]any{
+		"virtualhost": map[string]any{
+			"fqdn": "app.example.com",
+			"tls":  map[string]any{"secretName": "app-tls"},
+		},
+		"routes": []any{
+			map[string]any{
+				"conditions": []any{map[string]any{"prefix": "/"}},
+				"services": []any{
+					map[string]any{"name": "app", "port": int64(80), "weight": int64(90)},
+					map[string]any{"name": "app-canary", "port": int64(80), "weight": int64(10)},
+					map[string]any{"name": "app-shadow", "port": int64(80), "mirror": true},
+				},
+				"timeoutPolicy":      map[string]any{"response": "1m30s", "idle": "5m"},
+				"retryPolicy":        map[string]any{"count": int64(3), "perTryTimeout": "500ms", "retryOn": []any{"gateway-error"}},
+				"loadBalancerPolicy": map[string]any{"strategy": "Cookie"},
+			},
+		},
+		"includes": []any{
+			map[string]any{"name": "api", "namespace": "api", "conditions": []any{map[string]any{"prefix": "/api"}}},
+		},
+	})
+	child := sourceObject(ContourHTTPProxyGVK, "api", "api", map[string]any{
+		"routes": []any{
+			map[string]any{
+				"conditions":        []any{map[string]any{"prefix": "/v1"}},
+				"services":          []any{map[string]any{"name": "api", "port": int64(8080)}},
+				"pathRewritePolicy": map[string]any{"replacePrefix": []any{map[string]any{"replacement": "/"}}},
+				"requestHeadersPolicy": map[string]any{
+					"set": []any{map[string]any{"name": "Host", "value": "api.internal"}},
+				},
+			},
+		},
+	})
+	r := testContourHTTPProxyReconciler(recorder, child)
+
+	ingress, err := r.ContourHTTPProxyIngress(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := createOwnerReference(ingress); owner.Kind != "HTTPProxy" || owner.APIVersion != "projectcontour.io/v1" {
+		t.Errorf("expected the HTTPProxy to own the routes, got %+v", owner)
+	}
+	if len(ingress.Spec.Rules) != 1 || len(ingress.Spec.Rules[0].HTTP.Paths) != 2 ||
+		len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != "app-tls" {
+		t.Errorf("unexpected spec: %+v", ingress.Spec)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnconvertedFields") ||
+		!strings.Contains(event, "default/app spec.routes[0].loadBalancerPolicy") ||
+		!strings.Contains(event, "default/app spec.routes[0].timeoutPolicy.idle") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	httpRoutes, err := r.ConvertContourHTTPProxy(ctx, root, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, httpRoute := range httpRoutes {
+		names = append(names, httpRoute.Name)
+	}
+	if !isEqual(names, []string{"app-app-example-com", "app-app-example-com-redirect"}) {
+		t.Fatalf("unexpected HTTPRoutes: %v", names)
+	}
+
+	rules := httpRoutes[0].Spec.Rules
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %+v", rules)
+	}
+	api, root0 := rules[0], rules[1]
+	if *api.Matches[0].Path.Value != "/api/v1" || api.BackendRefs[0].Name != "api" ||
+		*api.BackendRefs[0].Namespace != "api" {
+		t.Errorf("unexpected rule of the included HTTPProxy: %+v", api)
+	}
+	expectedFilters := []gatewayv1.HTTPRouteFilter{
+		{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+			Hostname: ptr.To(gatewayv1.PreciseHostname("api.internal")),
+		}},
+		{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+			Path: &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To("/")},
+		}},
+	}
+	if !isEqual(api.Filters, expectedFilters) {
+		t.Errorf("unexpected filters: %+v", api.Filters)
+	}
+
+	var backends []string
+	for _, backendRef := range root0.BackendRefs {
+		backends = append(backends, fmt.Sprintf("%s:%d", backendRef.Name, *backendRef.Weight))
+	}
+	if !isEqual(backends, []string{"app:90", "app-canary:10"}) {
+		t.Errorf("unexpected backends: %v", backends)
+	}
+	if len(root0.Filters) != 1 || root0.Filters[0].RequestMirror.BackendRef.Name != "app-shadow" {
+		t.Errorf("unexpected filters: %+v", root0.Filters)
+	}
+	expectedTimeouts := &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("90s")), BackendRequest: ptr.To(gatewayv1.Duration("500ms"))}
+	if !isEqual(root0.Timeouts, expectedTimeouts) {
+		t.Errorf("unexpected timeouts: %+v", root0.Timeouts)
+	}
+	expectedRetry := &gatewayv1.HTTPRouteRetry{Attempts: ptr.To(3), Codes: []gatewayv1.HTTPRouteRetryStatusCode{502, 503, 504}}
+	if !isEqual(root0.Retry, expectedRetry) {
+		t.Errorf("unexpected retry: %+v", root0.Retry)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, string(gatewayv1.RouteReasonRefNotPermitted)) {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestContourHTTPProxyIngressInclude(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	root := sourceObject(ContourHTTPProxyGVK, "default", "app", map[string]any{
+		"virtualhost": map[string]any{"fqdn": "app.example.com"},
+		"includes":    []any{map[string]any{"name": "missing"}},
+	})
+	r := testContourHTTPProxyReconciler(recorder, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}})
+
+	ingress, err := r.ContourHTTPProxyIngress(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ingress.Spec.Rules) != 0 {
+		t.Errorf("expected no rules, got %+v", ingress.Spec.Rules)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRoute") || !strings.Contains(event, "default/missing") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// HTTPProxies without a virtual host are converted as part of the HTTPProxies including them
+	ingress, err = r.ContourHTTPProxyIngress(ctx, sourceObject(ContourHTTPProxyGVK, "default", "child", map[string]any{
+		"routes": []any{map[string]any{"services": []any{map[string]any{"name": "app", "port": int64(80)}}}},
+	}))
+	if err != nil || len(ingress.Spec.Rules) != 0 {
+		t.Errorf("expected no rules, got %+v, %v", ingress.Spec.Rules, err)
+	}
+}
+
+func TestContourHTTPProxyHostIndex(t *testing.T) {
+	r := &IngressReconciler{}
+	root := sourceObject(ContourHTTPProxyGVK, "default", "root", map[string]any{"virtualhost": map[string]any{"fqdn": "App.example.com"}})
+	if keys := r.indexSourceHosts(contourHTTPProxyHosts)(root); !slices.Contains(keys, "app.example.com") {
+		t.Errorf("expected the root HTTPProxy to be indexed by its fqdn, got %v", keys)
+	}
+	included := sourceObject(ContourHTTPProxyGVK, "default", "included", map[string]any{"routes": []any{}})
+	if keys := r.indexSourceHosts(contourHTTPProxyHosts)(included); len(keys) != 0 {
+		t.Errorf("expected an included HTTPProxy not to be indexed, got %v", keys)
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// clusterServiceName matches the cluster DNS name of a Service, <name>.<namespace>.svc[.cluster.local]
+var clusterServiceName = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.svc(\.cluster\.local)?\.?$`)
+
+// mapCrossNamespaceBackendRef follows an ExternalName Service that points at a Service in another namespace,
+// the usual way for an Ingress to reach another namespace, and references that Service directly. The backendRef
+// is only changed if a ReferenceGrant permits it, or if one will be created by AutoGrant or GatewayNamespaceRoutes;
+// otherwise a RefNotPermitted Event is emitted and the ExternalName Service is kept, as the Gateway would reject
+// the reference.
+func (r *IngressReconciler) mapCrossNamespaceBackendRef(ctx context.Context, ingress networkingv1.Ingress, backendRef gatewayv1.HTTPBackendRef) (gatewayv1.HTTPBackendRef, error) {
+	if backendRef.Kind == nil || *backendRef.Kind != "Service" || backendRef.Group == nil || *backendRef.Group != "" {
+		return backendRef, nil
+	}
+
+	service := corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ingress.Namespace, Name: string(backendRef.Name)}, &service); err != nil {
+		return backendRef, client.IgnoreNotFound(err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeExternalName {
+		return backendRef, nil
+	}
+	match := clusterServiceName.FindStringSubmatch(service.Spec.ExternalName)
+	if match == nil || match[3] == ingress.Namespace {
+		return backendRef, nil
+	}
+
+	target := *backendRef.DeepCopy()
+	namespace := gatewayv1.Namespace(match[3])
+	target.Namespace = &namespace
+	target.Name = gatewayv1.ObjectName(match[1])
+
+	if !r.AutoGrant && !r.GatewayNamespaceRoutes {
+		granted, err := r.isReferenceGranted(ctx, "HTTPRoute", ingress.Namespace, target.BackendObjectReference)
+		if err != nil {
+			return backendRef, err
+		}
+		if !granted {
+			r.event(&ingress, corev1.EventTypeWarning, string(gatewayv1.RouteReasonRefNotPermitted),
+				fmt.Sprintf("No ReferenceGrant in namespace %s allows HTTPRoutes in namespace %s to reference Service %s",
+					match[3], ingress.Namespace, match[1]))
+			return backendRef, nil
+		}
+	}
+	return target, nil
+}
+
+// backendGrantLabel marks the ReferenceGrants created for the backendRefs of generated routes in other namespaces
+const backendGrantLabel = "ingress2httproute.lion7.dev/backend-grant"
+
+// grantsBackends returns true if the ReferenceGrants the backendRefs of the generated routes need are created
+func (r *IngressReconciler) grantsBackends() bool {
+	return r.CrossNamespaceBackends && r.AutoGrant || r.GatewayNamespaceRoutes
+}
+
+// isReferenceGranted returns true if a ReferenceGrant allows routes of the kind in the namespace to reference the
+// backend
+func (r *IngressReconciler) isReferenceGranted(ctx context.Context, kind gatewayv1.Kind, namespace string, backend gatewayv1.BackendObjectReference) (bool, error) {
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := r.routeClient().List(ctx, &grants, client.InNamespace(string(*backend.Namespace))); err != nil {
+		return false, err
+	}
+	for _, grant := range grants.Items {
+		if grantsReference(grant, kind, namespace, backend) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// grantsReference returns true if the ReferenceGrant allows routes of the kind in the namespace to reference the
+// backend. A backend without group or kind is a Service.
+func grantsReference(grant gatewayv1beta1.ReferenceGrant, kind gatewayv1.Kind, namespace string, backend gatewayv1.BackendObjectReference) bool {
+	if !slices.ContainsFunc(grant.Spec.From, func(from gatewayv1beta1.ReferenceGrantFrom) bool {
+		return from.Group == gatewayv1.GroupName && from.Kind == kind && string(from.Namespace) == namespace
+	}) {
+		return false
+	}
+	return slices.ContainsFunc(grant.Spec.To, func(to gatewayv1beta1.ReferenceGrantTo) bool {
+		return to.Group == ptr.Deref(backend.Group, "") && to.Kind == ptr.Deref(backend.Kind, "Service") &&
+			(to.Name == nil || *to.Name == backend.Name)
+	})
+}
+
+// httpRouteBackends returns the backends the rules of the HTTPRoute reference, including those they mirror to
+func httpRouteBackends(httpRoute gatewayv1.HTTPRoute) []gatewayv1.BackendObjectReference {
+	var result []gatewayv1.BackendObjectReference
+	for _, rule := range httpRoute.Spec.Rules {
+		for _, backendRef := range rule.BackendRefs {
+			result = append(result, backendRef.BackendObjectReference)
+		}
+		for _, filter := range rule.Filters {
+			if filter.RequestMirror != nil {
+				result = append(result, filter.RequestMirror.BackendRef)
+			}
+		}
+	}
+	return result
+}
+
+// grpcRouteBackends returns the backends the rules of the GRPCRoute reference, including those they mirror to
+func grpcRouteBackends(grpcRoute gatewayv1.GRPCRoute) []gatewayv1.BackendObjectReference {
+	var result []gatewayv1.BackendObjectReference
+	for _, rule := range grpcRoute.Spec.Rules {
+		for _, backendRef := range rule.BackendRefs {
+			result = append(result, backendRef.BackendObjectReference)
+		}
+		for _, filter := range rule.Filters {
+			if filter.RequestMirror != nil {
+				result = append(result, filter.RequestMirror.BackendRef)
+			}
+		}
+	}
+	return result
+}
+
+// ensureReferenceGrants creates the ReferenceGrants that allow the routes of the kind in the namespace to reference
+// the backends in other namespaces, unless a ReferenceGrant allows it already. A ReferenceGrant created for other
+// backends with the same name is extended instead.
+func (r *IngressReconciler) ensureReferenceGrants(ctx context.Context, kind gatewayv1.Kind, namespace string, backends []gatewayv1.BackendObjectReference) error {
+	for _, backend := range backends {
+		if backend.Namespace == nil || string(*backend.Namespace) == namespace {
+			continue
+		}
+		granted, err := r.isReferenceGranted(ctx, kind, namespace, backend)
+		if err != nil {
+			return err
+		}
+		if granted {
+			continue
+		}
+
+		grant := gatewayv1beta1.ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      truncateName(fmt.Sprintf("%s-%s", namespace, backend.Name)),
+				Namespace: string(*backend.Namespace),
+				Labels:    map[string]string{backendGrantLabel: "true"},
+			},
+			Spec: gatewayv1beta1.ReferenceGrantSpec{
+				From: []gatewayv1beta1.ReferenceGrantFrom{{
+					Group:     gatewayv1.GroupName,
+					Kind:      kind,
+					Namespace: gatewayv1.Namespace(namespace),
+				}},
+				To: []gatewayv1beta1.ReferenceGrantTo{{
+					Group: ptr.Deref(backend.Group, ""),
+					Kind:  ptr.Deref(backend.Kind, "Service"),
+					Name:  ptr.To(backend.Name),
+				}},
+			},
+		}
+		if err := r.routeClient().Create(ctx, &grant); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+			if err := r.extendReferenceGrant(ctx, grant); err != nil {
+				return err
+			}
+			continue
+		}
+		log.FromContext(ctx).Info("created ReferenceGrant", "name", client.ObjectKeyFromObject(&grant))
+	}
+	return nil
+}
+
+// extendReferenceGrant adds the from and to of the desired ReferenceGrant to the existing one with its name, which
+// allows another reference, e.g. from another kind of route or to another kind of backend. A ReferenceGrant that
+// was not created for the backends of routes is not changed, the reference is reported as not permitted instead.
+func (r *IngressReconciler) extendReferenceGrant(ctx context.Context, desired gatewayv1beta1.ReferenceGrant) error {
+	existing := gatewayv1beta1.ReferenceGrant{}
+	if err := r.routeClient().Get(ctx, client.ObjectKeyFromObject(&desired), &existing); err != nil {
+		return err
+	}
+	if existing.Labels[backendGrantLabel] != "true" {
+		return fmt.Errorf("ReferenceGrant %s exists and does not allow %s from namespace %s to reference %s %s",
+			client.ObjectKeyFromObject(&existing), desired.Spec.From[0].Kind, desired.Spec.From[0].Namespace,
+			desired.Spec.To[0].Kind, *desired.Spec.To[0].Name)
+	}
+
+	for _, from := range desired.Spec.From {
+		if !slices.Contains(existing.Spec.From, from) {
+			existing.Spec.From = append(existing.Spec.From, from)
+		}
+	}
+	for _, to := range desired.Spec.To {
+		if !slices.ContainsFunc(existing.Spec.To, func(existing gatewayv1beta1.ReferenceGrantTo) bool {
+			return existing.Group == to.Group && existing.Kind == to.Kind && ptr.Equal(existing.Name, to.Name)
+		}) {
+			existing.Spec.To = append(existing.Spec.To, to)
+		}
+	}
+	if err := r.routeClient().Update(ctx, &existing); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("extended ReferenceGrant", "name", client.ObjectKeyFromObject(&existing))
+	return nil
+}
+
+// deleteStaleReferenceGrants deletes the ReferenceGrants created for the backends of routes that no route in their
+// from namespaces references anymore, including the routes created by others
+func (r *IngressReconciler) deleteStaleReferenceGrants(ctx context.Context) error {
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := r.routeClient().List(ctx, &grants, client.MatchingLabels{backendGrantLabel: "true"}); err != nil {
+		return err
+	}
+
+	// The backends referenced by the routes of each from namespace, read once
+	referenced := make(map[string][]gatewayv1.BackendObjectReference)
+	backends := func(namespace string) ([]gatewayv1.BackendObjectReference, error) {
+		if result, ok := referenced[namespace]; ok {
+			return result, nil
+		}
+		var result []gatewayv1.BackendObjectReference
+		var httpRoutes gatewayv1.HTTPRouteList
+		if err := r.routeClient().List(ctx, &httpRoutes, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		for _, httpRoute := range httpRoutes.Items {
+			result = append(result, httpRouteBackends(httpRoute)...)
+		}
+		if r.AppProtocolBackends {
+			var grpcRoutes gatewayv1.GRPCRouteList
+			if err := r.routeClient().List(ctx, &grpcRoutes, client.InNamespace(namespace)); err != nil {
+				return nil, err
+			}
+			for _, grpcRoute := range grpcRoutes.Items {
+				result = append(result, grpcRouteBackends(grpcRoute)...)
+			}
+		}
+		referenced[namespace] = result
+		return result, nil
+	}
+
+	for i := range grants.Items {
+		grant := &grants.Items[i]
+		used := false
+		for _, from := range grant.Spec.From {
+			namespaceBackends, err := backends(string(from.Namespace))
+			if err != nil {
+				return err
+			}
+			if slices.ContainsFunc(namespaceBackends, func(backend gatewayv1.BackendObjectReference) bool {
+				return backend.Namespace != nil && string(*backend.Namespace) == grant.Namespace &&
+					grantsReference(*grant, from.Kind, string(from.Namespace), backend)
+			}) {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+		if err := r.routeClient().Delete(ctx, grant); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted ReferenceGrant", "name", client.ObjectKeyFromObject(grant))
+	}
+	return nil
+}
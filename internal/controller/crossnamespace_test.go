@@ -0,0 +1,161 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestEnsureReferenceGrants(t *testing.T) {
+	ctx := context.Background()
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).Build(), AutoGrant: true}
+
+	httpRoute := gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "default"},
+		Spec: gatewayv1.HTTPRouteSpec{Rules: []gatewayv1.HTTPRouteRule{{
+			BackendRefs: []gatewayv1.HTTPBackendRef{
+				{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{
+					Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+					Namespace: ptr.To(gatewayv1.Namespace("default")), Name: "local",
+				}}},
+				{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{
+					Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+					Namespace: ptr.To(gatewayv1.Namespace("shared")), Name: "remote",
+				}}},
+			},
+		}}},
+	}
+
+	// Reconciling twice must create a single ReferenceGrant for the remote Service only
+	for range 2 {
+		if err := r.ensureReferenceGrants(ctx, "HTTPRoute", httpRoute.Namespace, httpRouteBackends(httpRoute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := r.List(ctx, &grants); err != nil {
+		t.Fatal(err)
+	}
+	if len(grants.Items) != 1 {
+		t.Fatalf("expected 1 ReferenceGrant, got %d", len(grants.Items))
+	}
+	grant := grants.Items[0]
+	if grant.Namespace != "shared" || !grantsReference(grant, "HTTPRoute", "default", httpRoute.Spec.Rules[0].BackendRefs[1].BackendObjectReference) {
+		t.Errorf("ReferenceGrant %s does not grant the remote Service: %+v", client.ObjectKeyFromObject(&grant), grant.Spec)
+	}
+}
+
+func TestEnsureReferenceGrantsKinds(t *testing.T) {
+	ctx := context.Background()
+	foreign := &gatewayv1beta1.ReferenceGrant{ObjectMeta: metav1.ObjectMeta{Name: "default-foreign", Namespace: "shared"}}
+	r := &IngressReconciler{
+		Client:    fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(foreign).Build(),
+		AutoGrant: true,
+	}
+	service := gatewayv1.BackendObjectReference{
+		Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+		Namespace: ptr.To(gatewayv1.Namespace("shared")), Name: "remote",
+	}
+	// A resource backend of the core group has no group
+	resource := gatewayv1.BackendObjectReference{
+		Kind: ptr.To(gatewayv1.Kind("ConfigMap")), Namespace: ptr.To(gatewayv1.Namespace("shared")), Name: "remote",
+	}
+
+	if err := r.ensureReferenceGrants(ctx, "HTTPRoute", "default", []gatewayv1.BackendObjectReference{service, resource}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureReferenceGrants(ctx, "GRPCRoute", "default", []gatewayv1.BackendObjectReference{service}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ReferenceGrant of the Service is extended with the resource and the GRPCRoutes
+	grant := gatewayv1beta1.ReferenceGrant{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: "shared", Name: "default-remote"}, &grant); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []gatewayv1.Kind{"HTTPRoute", "GRPCRoute"} {
+		if !grantsReference(grant, kind, "default", service) {
+			t.Errorf("ReferenceGrant does not allow %s to reference the Service: %+v", kind, grant.Spec)
+		}
+	}
+	if !grantsReference(grant, "HTTPRoute", "default", resource) {
+		t.Errorf("ReferenceGrant does not allow the resource backend: %+v", grant.Spec)
+	}
+
+	// A ReferenceGrant with the name created by others is not changed
+	foreignBackend := service
+	foreignBackend.Name = "foreign"
+	if err := r.ensureReferenceGrants(ctx, "HTTPRoute", "default", []gatewayv1.BackendObjectReference{foreignBackend}); err == nil {
+		t.Error("expected an error for the existing ReferenceGrant")
+	}
+}
+
+func TestDeleteStaleReferenceGrants(t *testing.T) {
+	ctx := context.Background()
+	grant := func(name, backend string) *gatewayv1beta1.ReferenceGrant {
+		return &gatewayv1beta1.ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shared", Labels: map[string]string{backendGrantLabel: "true"}},
+			Spec: gatewayv1beta1.ReferenceGrantSpec{
+				From: []gatewayv1beta1.ReferenceGrantFrom{{Group: gatewayv1.GroupName, Kind: "HTTPRoute", Namespace: "default"}},
+				To:   []gatewayv1beta1.ReferenceGrantTo{{Kind: "Service", Name: ptr.To(gatewayv1.ObjectName(backend))}},
+			},
+		}
+	}
+	unlabeled := grant("unlabeled", "gone")
+	unlabeled.Labels = nil
+	httpRoute := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "default"},
+		Spec: gatewayv1.HTTPRouteSpec{Rules: []gatewayv1.HTTPRouteRule{{
+			BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{
+				Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+				Namespace: ptr.To(gatewayv1.Namespace("shared")), Name: "used",
+			}}}},
+		}}},
+	}
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).
+			WithObjects(grant("default-used", "used"), grant("default-gone", "gone"), unlabeled, httpRoute).Build(),
+		CrossNamespaceBackends: true,
+		AutoGrant:              true,
+	}
+
+	if err := r.deleteStaleReferenceGrants(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := r.List(ctx, &grants); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, grant := range grants.Items {
+		names = append(names, grant.Name)
+	}
+	if !isEqual(names, []string{"default-used", "unlabeled"}) {
+		t.Errorf("expected the ReferenceGrant of the unreferenced backend to be deleted, got %v", names)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// defaultBackendRuleAnnotation overrides DefaultBackendRule for an Ingress, with "true" or "false"
+const defaultBackendRuleAnnotation = DefaultAnnotationPrefix + "default-backend-rule"
+
+// defaultBackendRule returns true if the default backend of the Ingress gets a catch-all rule, as set by its
+// annotation or else by DefaultBackendRule. Other values of the annotation are ignored, like those of skip and pause.
+func (r *IngressReconciler) defaultBackendRule(ingress networkingv1.Ingress) bool {
+	switch ingress.Annotations[r.annotation(defaultBackendRuleAnnotation)] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return r.DefaultBackendRule
+}
+
+// withDefaultBackendRule adds a catch-all path for the default backend to the rules of a hostname, unless one
+// of its paths already matches everything. As the shortest prefix, it is ordered after all other rules, so it
+// only receives the requests no other path matches, like the default backend of the Ingress.
+func withDefaultBackendRule(rules []networkingv1.IngressRule, hostname string, backend networkingv1.IngressBackend) []networkingv1.IngressRule {
+	for _, rule := range rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Path == "/" && path.PathType != nil && *path.PathType == networkingv1.PathTypePrefix {
+				return rules
+			}
+		}
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	return append(rules, networkingv1.IngressRule{
+		Host: hostname,
+		IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+			Paths: []networkingv1.HTTPIngressPath{{Path: "/", PathType: &pathType, Backend: backend}},
+		}},
+	})
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDefaultBackendRule(t *testing.T) {
+	tests := []struct {
+		flag       bool
+		annotation string
+		expected   bool
+	}{
+		{flag: false, expected: false},
+		{flag: true, expected: true},
+		{flag: true, annotation: "false", expected: false},
+		{flag: false, annotation: "true", expected: true},
+		{flag: true, annotation: "no", expected: true},
+	}
+	for _, tt := range tests {
+		r := &IngressReconciler{DefaultBackendRule: tt.flag}
+		ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+		if tt.annotation != "" {
+			ingress.Annotations = map[string]string{defaultBackendRuleAnnotation: tt.annotation}
+		}
+		if result := r.defaultBackendRule(ingress); result != tt.expected {
+			t.Errorf("expected %t with flag %t and annotation %q, got %t", tt.expected, tt.flag, tt.annotation, result)
+		}
+	}
+}
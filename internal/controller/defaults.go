@@ -0,0 +1,173 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// applyHTTPRouteDefaults sets the fields the API server defaults according to the HTTPRoute CRD, so a desired
+// spec can be compared with a stored one. Without them, e.g. a backendRef without group would differ from the
+// stored backendRef with an empty group on every reconcile.
+func applyHTTPRouteDefaults(spec *gatewayv1.HTTPRouteSpec) {
+	for i := range spec.ParentRefs {
+		parentRef := &spec.ParentRefs[i]
+		if parentRef.Group == nil {
+			parentRef.Group = ptr.To(gatewayv1.Group(gatewayv1.GroupName))
+		}
+		if parentRef.Kind == nil {
+			parentRef.Kind = ptr.To(gatewayv1.Kind("Gateway"))
+		}
+	}
+
+	if spec.Rules == nil {
+		spec.Rules = []gatewayv1.HTTPRouteRule{{}}
+	}
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		if rule.Matches == nil {
+			rule.Matches = []gatewayv1.HTTPRouteMatch{{}}
+		}
+		for j := range rule.Matches {
+			applyHTTPRouteMatchDefaults(&rule.Matches[j])
+		}
+		for j := range rule.Filters {
+			applyHTTPRouteFilterDefaults(&rule.Filters[j])
+		}
+		if persistence := rule.SessionPersistence; persistence != nil {
+			if persistence.Type == nil {
+				persistence.Type = ptr.To(gatewayv1.CookieBasedSessionPersistence)
+			}
+			if persistence.CookieConfig != nil && persistence.CookieConfig.LifetimeType == nil {
+				persistence.CookieConfig.LifetimeType = ptr.To(gatewayv1.SessionCookieLifetimeType)
+			}
+		}
+		for j := range rule.BackendRefs {
+			backendRef := &rule.BackendRefs[j]
+			applyBackendObjectReferenceDefaults(&backendRef.BackendObjectReference)
+			if backendRef.Weight == nil {
+				backendRef.Weight = ptr.To(int32(1))
+			}
+			for k := range backendRef.Filters {
+				applyHTTPRouteFilterDefaults(&backendRef.Filters[k])
+			}
+		}
+	}
+}
+
+func applyHTTPRouteMatchDefaults(match *gatewayv1.HTTPRouteMatch) {
+	if match.Path == nil {
+		match.Path = &gatewayv1.HTTPPathMatch{}
+	}
+	if match.Path.Type == nil {
+		match.Path.Type = ptr.To(gatewayv1.PathMatchPathPrefix)
+	}
+	if match.Path.Value == nil {
+		match.Path.Value = ptr.To("/")
+	}
+	for i := range match.Headers {
+		if match.Headers[i].Type == nil {
+			match.Headers[i].Type = ptr.To(gatewayv1.HeaderMatchExact)
+		}
+	}
+	for i := range match.QueryParams {
+		if match.QueryParams[i].Type == nil {
+			match.QueryParams[i].Type = ptr.To(gatewayv1.QueryParamMatchExact)
+		}
+	}
+}
+
+func applyHTTPRouteFilterDefaults(filter *gatewayv1.HTTPRouteFilter) {
+	if filter.RequestRedirect != nil && filter.RequestRedirect.StatusCode == nil {
+		filter.RequestRedirect.StatusCode = ptr.To(302)
+	}
+	if filter.RequestMirror != nil {
+		applyBackendObjectReferenceDefaults(&filter.RequestMirror.BackendRef)
+	}
+}
+
+func applyBackendObjectReferenceDefaults(ref *gatewayv1.BackendObjectReference) {
+	if ref.Group == nil {
+		ref.Group = ptr.To(gatewayv1.Group(""))
+	}
+	if ref.Kind == nil {
+		ref.Kind = ptr.To(gatewayv1.Kind("Service"))
+	}
+}
+
+// applyGRPCRouteDefaults sets the fields the API server defaults according to the GRPCRoute CRD,
+// like applyHTTPRouteDefaults does for HTTPRoutes
+func applyGRPCRouteDefaults(spec *gatewayv1.GRPCRouteSpec) {
+	for i := range spec.ParentRefs {
+		parentRef := &spec.ParentRefs[i]
+		if parentRef.Group == nil {
+			parentRef.Group = ptr.To(gatewayv1.Group(gatewayv1.GroupName))
+		}
+		if parentRef.Kind == nil {
+			parentRef.Kind = ptr.To(gatewayv1.Kind("Gateway"))
+		}
+	}
+
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		for j := range rule.Matches {
+			match := &rule.Matches[j]
+			if match.Method != nil && match.Method.Type == nil {
+				match.Method.Type = ptr.To(gatewayv1.GRPCMethodMatchExact)
+			}
+			for k := range match.Headers {
+				if match.Headers[k].Type == nil {
+					match.Headers[k].Type = ptr.To(gatewayv1.GRPCHeaderMatchExact)
+				}
+			}
+		}
+		for j := range rule.BackendRefs {
+			backendRef := &rule.BackendRefs[j]
+			applyBackendObjectReferenceDefaults(&backendRef.BackendObjectReference)
+			if backendRef.Weight == nil {
+				backendRef.Weight = ptr.To(int32(1))
+			}
+		}
+	}
+}
+
+// applyTLSRouteDefaults sets the fields the API server defaults according to the TLSRoute CRD,
+// like applyHTTPRouteDefaults does for HTTPRoutes
+func applyTLSRouteDefaults(spec *gatewayv1alpha2.TLSRouteSpec) {
+	for i := range spec.ParentRefs {
+		parentRef := &spec.ParentRefs[i]
+		if parentRef.Group == nil {
+			parentRef.Group = ptr.To(gatewayv1.Group(gatewayv1.GroupName))
+		}
+		if parentRef.Kind == nil {
+			parentRef.Kind = ptr.To(gatewayv1.Kind("Gateway"))
+		}
+	}
+
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		for j := range rule.BackendRefs {
+			backendRef := &rule.BackendRefs[j]
+			applyBackendObjectReferenceDefaults(&backendRef.BackendObjectReference)
+			if backendRef.Weight == nil {
+				backendRef.Weight = ptr.To(int32(1))
+			}
+		}
+	}
+}
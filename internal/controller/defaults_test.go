@@ -0,0 +1,118 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestApplyHTTPRouteDefaults(t *testing.T) {
+	desired := gatewayv1.HTTPRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{Name: "gw"}}},
+		Rules: []gatewayv1.HTTPRouteRule{{
+			Filters: []gatewayv1.HTTPRouteFilter{{
+				Type:            gatewayv1.HTTPRouteFilterRequestRedirect,
+				RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{Scheme: ptr.To("https")},
+			}},
+			BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{Name: "app"},
+			}}},
+		}},
+	}
+
+	// The spec as stored by the API server
+	stored := gatewayv1.HTTPRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+			Group: ptr.To(gatewayv1.Group(gatewayv1.GroupName)),
+			Kind:  ptr.To(gatewayv1.Kind("Gateway")),
+			Name:  "gw",
+		}}},
+		Rules: []gatewayv1.HTTPRouteRule{{
+			Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+				Value: ptr.To("/"),
+			}}},
+			Filters: []gatewayv1.HTTPRouteFilter{{
+				Type:            gatewayv1.HTTPRouteFilterRequestRedirect,
+				RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{Scheme: ptr.To("https"), StatusCode: ptr.To(302)},
+			}},
+			BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{
+					Group: ptr.To(gatewayv1.Group("")),
+					Kind:  ptr.To(gatewayv1.Kind("Service")),
+					Name:  "app",
+				},
+				Weight: ptr.To(int32(1)),
+			}}},
+		}},
+	}
+
+	if isEqual(desired, stored) {
+		t.Fatal("expected the specs to differ before defaulting")
+	}
+	applyHTTPRouteDefaults(&desired)
+	if !isEqual(desired, stored) {
+		t.Errorf("expected the defaulted spec to equal the stored spec, got %+v", desired)
+	}
+
+	// Empty slices are as good as nil ones
+	if !isEqual(gatewayv1.HTTPRouteSpec{Hostnames: []gatewayv1.Hostname{}}, gatewayv1.HTTPRouteSpec{}) {
+		t.Error("expected empty and nil hostnames to be equal")
+	}
+}
+
+func TestBackendWeight(t *testing.T) {
+	pathType := networkingv1.PathTypePrefix
+	rules := []networkingv1.IngressRule{{IngressRuleValue: networkingv1.IngressRuleValue{
+		HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{
+			Path:     "/",
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: "app", Port: networkingv1.ServiceBackendPort{Number: 80},
+			}},
+		}}},
+	}}}
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+
+	for _, tc := range []struct {
+		reconciler IngressReconciler
+		expected   *int32
+	}{
+		{reconciler: IngressReconciler{}, expected: ptr.To(int32(1))},
+		{reconciler: IngressReconciler{BackendWeight: ptr.To(int32(10))}, expected: ptr.To(int32(10))},
+		{reconciler: IngressReconciler{BackendWeight: ptr.To(int32(10)), OmitBackendWeights: true}, expected: nil},
+	} {
+		// Ingresses are listed for their nginx canaries
+		tc.reconciler.Client = fake.NewClientBuilder().WithScheme(golden.Scheme).Build()
+		routeRules, _, err := tc.reconciler.mapToHTTPRouteRules(context.Background(), ingress, rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weight := routeRules[0].BackendRefs[0].Weight; !isEqual(weight, tc.expected) {
+			t.Errorf("expected weight %v, got %v", ptr.Deref(tc.expected, -1), ptr.Deref(weight, -1))
+		}
+	}
+}
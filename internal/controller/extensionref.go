@@ -0,0 +1,115 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ExtensionRefMapping routes an Ingress annotation to an ExtensionRef filter, so custom Gateway filters
+// can implement annotations that have no Gateway API equivalent
+type ExtensionRefMapping struct {
+	// Annotation is the annotation key that triggers the filter
+	Annotation string `json:"annotation"`
+	// Group and Kind of the filter resource
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	// Name is a template for the name of the filter resource. It can refer to .Name and .Namespace of the
+	// Ingress, to the .Value of the annotation and to the values of related .Annotations, e.g. "{{ .Name }}-auth"
+	// or `{{ index .Annotations "nginx.ingress.kubernetes.io/auth-secret" }}`.
+	Name string `json:"name"`
+}
+
+// ExtensionRefMappings is the file format of the mapping table
+type ExtensionRefMappings struct {
+	Mappings []ExtensionRefMapping `json:"mappings"`
+}
+
+// extensionRefData is passed to the name templates
+type extensionRefData struct {
+	Name        string
+	Namespace   string
+	Value       string
+	Annotations map[string]string
+}
+
+// LoadExtensionRefMappings reads the mapping table from a YAML or JSON file
+func LoadExtensionRefMappings(path string) ([]ExtensionRefMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings ExtensionRefMappings
+	if err := yaml.UnmarshalStrict(data, &mappings); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	for _, mapping := range mappings.Mappings {
+		if mapping.Annotation == "" || mapping.Kind == "" || mapping.Name == "" {
+			return nil, fmt.Errorf("invalid mapping in %s: annotation, kind and name are required", path)
+		}
+		if _, err := template.New(mapping.Annotation).Parse(mapping.Name); err != nil {
+			return nil, fmt.Errorf("invalid name template for %s: %w", mapping.Annotation, err)
+		}
+	}
+	return mappings.Mappings, nil
+}
+
+// extensionRefFilters returns the ExtensionRef filters for the mapped annotations of the Ingress
+func (r *IngressReconciler) extensionRefFilters(ingress networkingv1.Ingress) ([]gatewayv1.HTTPRouteFilter, error) {
+	var filters []gatewayv1.HTTPRouteFilter
+	for _, mapping := range r.ExtensionRefMappings {
+		value, ok := ingress.Annotations[mapping.Annotation]
+		if !ok {
+			continue
+		}
+
+		tmpl, err := template.New(mapping.Annotation).Option("missingkey=error").Parse(mapping.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name template for %s: %w", mapping.Annotation, err)
+		}
+		var name strings.Builder
+		if err := tmpl.Execute(&name, extensionRefData{
+			Name:        ingress.Name,
+			Namespace:   ingress.Namespace,
+			Value:       value,
+			Annotations: ingress.Annotations,
+		}); err != nil {
+			return nil, fmt.Errorf("cannot render name template for %s: %w", mapping.Annotation, err)
+		}
+		if name.Len() == 0 {
+			// index yields an empty value for a missing annotation instead of an error
+			return nil, fmt.Errorf("name template for %s renders an empty name for Ingress %s", mapping.Annotation, ingress.Name)
+		}
+
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type: gatewayv1.HTTPRouteFilterExtensionRef,
+			ExtensionRef: &gatewayv1.LocalObjectReference{
+				Group: gatewayv1.Group(mapping.Group),
+				Kind:  gatewayv1.Kind(mapping.Kind),
+				Name:  gatewayv1.ObjectName(name.String()),
+			},
+		})
+	}
+	return filters, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// externalDNSAnnotationPrefix is the prefix of the annotations external-dns reads from its sources
+const externalDNSAnnotationPrefix = "external-dns.alpha.kubernetes.io/"
+
+// propagatesExternalDNS returns true if the annotation is an external-dns annotation on the allowlist
+func (r *IngressReconciler) propagatesExternalDNS(key string) bool {
+	name, ok := strings.CutPrefix(key, externalDNSAnnotationPrefix)
+	return ok && slices.Contains(r.ExternalDNSAnnotations, name)
+}
+
+// annotateExternalDNS copies the allowlisted external-dns annotations of the Ingresses onto the HTTPRoutes generated
+// from them, so DNS records keep being managed once external-dns reads the routes. When the Ingresses of a merged
+// hostname disagree, the value of the first Ingress wins.
+func (r *IngressReconciler) annotateExternalDNS(httpRoutes []gatewayv1.HTTPRoute, ingresses ...networkingv1.Ingress) {
+	for _, ingress := range ingresses {
+		for key, value := range ingress.Annotations {
+			if !r.propagatesExternalDNS(key) {
+				continue
+			}
+			for i := range httpRoutes {
+				if _, ok := httpRoutes[i].Annotations[key]; !ok {
+					metav1.SetMetaDataAnnotation(&httpRoutes[i].ObjectMeta, key, value)
+				}
+			}
+		}
+	}
+}
+
+// syncExternalDNSAnnotations sets the allowlisted external-dns annotations of the current route to those of the
+// desired route, removing the ones the desired route lacks, and returns true if any changed. Other external-dns
+// annotations on the route are left alone.
+func (r *IngressReconciler) syncExternalDNSAnnotations(current *metav1.ObjectMeta, desired metav1.ObjectMeta) bool {
+	changed := false
+	for _, name := range r.ExternalDNSAnnotations {
+		key := externalDNSAnnotationPrefix + name
+		value, ok := desired.Annotations[key]
+		if currentValue, currentOk := current.Annotations[key]; currentOk == ok && currentValue == value {
+			continue
+		}
+		if ok {
+			metav1.SetMetaDataAnnotation(current, key, value)
+		} else {
+			delete(current.Annotations, key)
+		}
+		changed = true
+	}
+	return changed
+}
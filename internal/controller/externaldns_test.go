@@ -0,0 +1,82 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestAnnotateExternalDNS(t *testing.T) {
+	r := &IngressReconciler{ExternalDNSAnnotations: []string{"ttl", "target"}}
+	first := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl": "60",
+	}}}
+	second := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl":      "300",
+		"external-dns.alpha.kubernetes.io/target":   "lb.example.com",
+		"external-dns.alpha.kubernetes.io/hostname": "www.example.com",
+	}}}
+
+	httpRoutes := make([]gatewayv1.HTTPRoute, 2)
+	r.annotateExternalDNS(httpRoutes, first, second)
+	expected := map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl":    "60",
+		"external-dns.alpha.kubernetes.io/target": "lb.example.com",
+	}
+	for _, httpRoute := range httpRoutes {
+		if !isEqual(httpRoute.Annotations, expected) {
+			t.Errorf("unexpected annotations: %v", httpRoute.Annotations)
+		}
+	}
+
+	if support := r.AnnotationSupport("external-dns.alpha.kubernetes.io/ttl"); support != AnnotationConverted {
+		t.Errorf("expected an allowlisted annotation to be converted, got %v", support)
+	}
+	if support := r.AnnotationSupport("external-dns.alpha.kubernetes.io/hostname"); support == AnnotationConverted {
+		t.Errorf("expected an annotation missing from the allowlist not to be converted")
+	}
+}
+
+func TestSyncExternalDNSAnnotations(t *testing.T) {
+	r := &IngressReconciler{ExternalDNSAnnotations: []string{"ttl", "target"}}
+	current := metav1.ObjectMeta{Annotations: map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl":      "60",
+		"external-dns.alpha.kubernetes.io/target":   "lb.example.com",
+		"external-dns.alpha.kubernetes.io/hostname": "www.example.com",
+	}}
+	desired := metav1.ObjectMeta{Annotations: map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl": "300",
+	}}
+
+	if !r.syncExternalDNSAnnotations(&current, desired) {
+		t.Errorf("expected the annotations to change")
+	}
+	expected := map[string]string{
+		"external-dns.alpha.kubernetes.io/ttl":      "300",
+		"external-dns.alpha.kubernetes.io/hostname": "www.example.com",
+	}
+	if !isEqual(current.Annotations, expected) {
+		t.Errorf("unexpected annotations: %v", current.Annotations)
+	}
+	if r.syncExternalDNSAnnotations(&current, desired) {
+		t.Errorf("expected no change")
+	}
+}
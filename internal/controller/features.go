@@ -0,0 +1,291 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/gateway-api/pkg/features"
+)
+
+const (
+	// supportHTTPRouteCORS is the feature of the CORS filter, which is part of the experimental channel and not yet
+	// defined by the features package of the Gateway API version in use
+	supportHTTPRouteCORS features.FeatureName = "HTTPRouteCORS"
+	// supportHTTPRouteSessionPersistence is the feature of the sessionPersistence of rules, which is part of the
+	// experimental channel and not yet defined by the features package either
+	supportHTTPRouteSessionPersistence features.FeatureName = "HTTPRouteSessionPersistence"
+	// supportHTTPRouteRetry is the feature of the retry of rules, which is part of the experimental channel and not
+	// yet defined by the features package either
+	supportHTTPRouteRetry features.FeatureName = "HTTPRouteRetry"
+)
+
+// featureSet is the set of features a HTTPRoute may use, nil if they are unknown and any feature may be used
+type featureSet map[gatewayv1.FeatureName]bool
+
+// supports returns true if the feature may be used
+func (s featureSet) supports(feature features.FeatureName) bool {
+	return s == nil || s[gatewayv1.FeatureName(feature)]
+}
+
+// advertises returns true if the feature is reported, which is required for features of the experimental channel,
+// as the HTTPRoute CRD of the standard channel rejects them
+func (s featureSet) advertises(feature features.FeatureName) bool {
+	return s[gatewayv1.FeatureName(feature)]
+}
+
+// gatewayClassFeatures returns the features reported by each GatewayClass in its status.supportedFeatures.
+// GatewayClasses that report no features are left out, as their implementation predates the field.
+func (r *IngressReconciler) gatewayClassFeatures(ctx context.Context) (map[gatewayv1.ObjectName]featureSet, error) {
+	var gatewayClasses gatewayv1.GatewayClassList
+	if err := r.routeClient().List(ctx, &gatewayClasses); err != nil {
+		return nil, err
+	}
+
+	result := make(map[gatewayv1.ObjectName]featureSet)
+	for _, gatewayClass := range gatewayClasses.Items {
+		if len(gatewayClass.Status.SupportedFeatures) == 0 {
+			continue
+		}
+		set := make(featureSet)
+		for _, feature := range gatewayClass.Status.SupportedFeatures {
+			set[feature.Name] = true
+		}
+		result[gatewayv1.ObjectName(gatewayClass.Name)] = set
+	}
+	return result, nil
+}
+
+// routeFeatures returns the features supported by the GatewayClasses of all Gateways the HTTPRoute attaches to
+func routeFeatures(httpRoute gatewayv1.HTTPRoute, gateways gatewayv1.GatewayList, classFeatures map[gatewayv1.ObjectName]featureSet) featureSet {
+	var result featureSet
+	for _, gateway := range gateways.Items {
+		if !slices.ContainsFunc(httpRoute.Spec.ParentRefs, func(parentRef gatewayv1.ParentReference) bool {
+			return isParentRefForGateway(parentRef, gateway)
+		}) {
+			continue
+		}
+		set, ok := classFeatures[gateway.Spec.GatewayClassName]
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = make(featureSet)
+			for feature := range set {
+				result[feature] = true
+			}
+			continue
+		}
+		for feature := range result {
+			if !set[feature] {
+				delete(result, feature)
+			}
+		}
+	}
+	return result
+}
+
+// adaptToSupportedFeatures removes what the GatewayClasses of the Gateways of the HTTPRoutes do not support,
+// and reports the features that could not be expressed with an Event. Timeouts, header modifications and rewrites
+// are dropped, while rules depending on an unsupported match or redirect are dropped as a whole, as they would
+// otherwise match or redirect other requests. HTTPRoutes without any rules left are dropped.
+func (r *IngressReconciler) adaptToSupportedFeatures(ctx context.Context, ingress *networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	var classFeatures map[gatewayv1.ObjectName]featureSet
+	if r.SupportedFeatures {
+		var err error
+		if classFeatures, err = r.gatewayClassFeatures(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []gatewayv1.HTTPRoute
+	for _, httpRoute := range httpRoutes {
+		supported := routeFeatures(httpRoute, gateways, classFeatures)
+		if !supported.advertises(supportHTTPRouteCORS) {
+			httpRoute = r.fallbackCORSFilters(ingress, httpRoute)
+		}
+		if supported == nil {
+			result = append(result, httpRoute)
+			continue
+		}
+
+		httpRoute = *httpRoute.DeepCopy()
+		unsupported := adaptHTTPRoute(&httpRoute, supported)
+		if len(unsupported) > 0 {
+			names := make([]string, 0, len(unsupported))
+			for _, feature := range unsupported {
+				names = append(names, string(feature))
+			}
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedFeatures",
+				fmt.Sprintf("HTTPRoute %s uses features its Gateways do not support, they are left out: %s",
+					httpRoute.Name, strings.Join(names, ", ")))
+		}
+		if len(httpRoute.Spec.Rules) > 0 {
+			result = append(result, httpRoute)
+		}
+	}
+	return result, nil
+}
+
+// adaptHTTPRoute removes the unsupported features from the HTTPRoute and returns them, sorted
+func adaptHTTPRoute(httpRoute *gatewayv1.HTTPRoute, supported featureSet) []features.FeatureName {
+	var unsupported []features.FeatureName
+	uses := func(feature features.FeatureName) bool {
+		if supported.supports(feature) {
+			return false
+		}
+		if !slices.Contains(unsupported, feature) {
+			unsupported = append(unsupported, feature)
+		}
+		return true
+	}
+
+	for i := range httpRoute.Spec.ParentRefs {
+		if httpRoute.Spec.ParentRefs[i].Port != nil && uses(features.SupportHTTPRouteParentRefPort) {
+			// Without the port the parentRef attaches to the listener by name, or else to the whole Gateway
+			httpRoute.Spec.ParentRefs[i].Port = nil
+		}
+	}
+
+	var rules []gatewayv1.HTTPRouteRule
+	for _, rule := range httpRoute.Spec.Rules {
+		if rule.Timeouts != nil {
+			if rule.Timeouts.Request != nil && uses(features.SupportHTTPRouteRequestTimeout) {
+				rule.Timeouts.Request = nil
+			}
+			if rule.Timeouts.BackendRequest != nil && uses(features.SupportHTTPRouteBackendTimeout) {
+				rule.Timeouts.BackendRequest = nil
+			}
+			if rule.Timeouts.Request == nil && rule.Timeouts.BackendRequest == nil {
+				rule.Timeouts = nil
+			}
+		}
+
+		if rule.SessionPersistence != nil && uses(supportHTTPRouteSessionPersistence) {
+			// The requests are balanced over the backends instead
+			rule.SessionPersistence = nil
+		}
+
+		if rule.Retry != nil && uses(supportHTTPRouteRetry) {
+			// The requests are not retried by the Gateway instead
+			rule.Retry = nil
+		}
+
+		if slices.ContainsFunc(rule.Matches, func(match gatewayv1.HTTPRouteMatch) bool {
+			return (len(match.QueryParams) > 0 && uses(features.SupportHTTPRouteQueryParamMatching)) ||
+				(match.Method != nil && uses(features.SupportHTTPRouteMethodMatching))
+		}) {
+			continue
+		}
+
+		var keep bool
+		if rule.Filters, keep = adaptHTTPRouteFilters(rule.Filters, uses); !keep {
+			continue
+		}
+		for j := range rule.BackendRefs {
+			if rule.BackendRefs[j].Filters, keep = adaptHTTPRouteFilters(rule.BackendRefs[j].Filters, uses); !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	httpRoute.Spec.Rules = rules
+
+	slices.Sort(unsupported)
+	return unsupported
+}
+
+// adaptHTTPRouteFilters removes the unsupported filters, or the unsupported fields of a filter, and returns false
+// if the rule cannot be kept because it redirects with an unsupported field
+func adaptHTTPRouteFilters(filters []gatewayv1.HTTPRouteFilter, uses func(features.FeatureName) bool) ([]gatewayv1.HTTPRouteFilter, bool) {
+	var result []gatewayv1.HTTPRouteFilter
+	mirrors := 0
+	for _, filter := range filters {
+		switch filter.Type {
+		case gatewayv1.HTTPRouteFilterRequestRedirect:
+			redirect := filter.RequestRedirect
+			if (redirect.Scheme != nil && uses(features.SupportHTTPRouteSchemeRedirect)) ||
+				(redirect.Port != nil && uses(features.SupportHTTPRoutePortRedirect)) ||
+				(redirect.Path != nil && uses(features.SupportHTTPRoutePathRedirect)) {
+				return nil, false
+			}
+		case gatewayv1.HTTPRouteFilterResponseHeaderModifier:
+			if uses(features.SupportHTTPRouteResponseHeaderModification) {
+				continue
+			}
+		case gatewayv1.HTTPRouteFilterURLRewrite:
+			rewrite := *filter.URLRewrite
+			if rewrite.Hostname != nil && uses(features.SupportHTTPRouteHostRewrite) {
+				rewrite.Hostname = nil
+			}
+			if rewrite.Path != nil && uses(features.SupportHTTPRoutePathRewrite) {
+				rewrite.Path = nil
+			}
+			if rewrite.Hostname == nil && rewrite.Path == nil {
+				continue
+			}
+			filter.URLRewrite = &rewrite
+		case gatewayv1.HTTPRouteFilterRequestMirror:
+			mirror := filter.RequestMirror
+			if uses(features.SupportHTTPRouteRequestMirror) ||
+				((mirror.Percent != nil || mirror.Fraction != nil) && uses(features.SupportHTTPRouteRequestPercentageMirror)) {
+				continue
+			}
+			if mirrors++; mirrors > 1 && uses(features.SupportHTTPRouteRequestMultipleMirrors) {
+				continue
+			}
+		}
+		result = append(result, filter)
+	}
+	return result, true
+}
+
+// findIngressesForGatewayClass enqueues all Ingresses when the supported features of a GatewayClass change,
+// as any of them may attach to its Gateways
+func (r *IngressReconciler) findIngressesForGatewayClass(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.listIngressRequests(ctx)
+}
+
+// supportedFeaturesChangedPredicate only passes updates of GatewayClasses that changed their supported features
+func supportedFeaturesChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldClass, ok := e.ObjectOld.(*gatewayv1.GatewayClass)
+			if !ok {
+				return true
+			}
+			newClass, ok := e.ObjectNew.(*gatewayv1.GatewayClass)
+			if !ok {
+				return true
+			}
+			return !isEqual(oldClass.Status.SupportedFeatures, newClass.Status.SupportedFeatures)
+		},
+	}
+}
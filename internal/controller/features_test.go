@@ -0,0 +1,172 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/gateway-api/pkg/features"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestAdaptToSupportedFeatures(t *testing.T) {
+	ctx := context.Background()
+
+	newGatewayClass := func(name string, supported ...features.FeatureName) *gatewayv1.GatewayClass {
+		gatewayClass := &gatewayv1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, feature := range supported {
+			gatewayClass.Status.SupportedFeatures = append(gatewayClass.Status.SupportedFeatures,
+				gatewayv1.SupportedFeature{Name: gatewayv1.FeatureName(feature)})
+		}
+		return gatewayClass
+	}
+	newGateway := func(name string, class gatewayv1.ObjectName) gatewayv1.Gateway {
+		return gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       gatewayv1.GatewaySpec{GatewayClassName: class},
+		}
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{
+		newGateway("basic", "basic"),
+		newGateway("timeouts", "timeouts"),
+		newGateway("unreported", "unreported"),
+	}}
+
+	mirror := gatewayv1.HTTPRouteFilter{
+		Type:          gatewayv1.HTTPRouteFilterRequestMirror,
+		RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{BackendRef: gatewayv1.BackendObjectReference{Name: "mirror"}},
+	}
+	newHTTPRoute := func(gateway string) gatewayv1.HTTPRoute {
+		return gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-" + gateway, Namespace: "default"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+					Namespace: ptr.To(gatewayv1.Namespace("default")),
+					Name:      gatewayv1.ObjectName(gateway),
+					Port:      ptr.To(gatewayv1.PortNumber(80)),
+				}}},
+				Rules: []gatewayv1.HTTPRouteRule{
+					{
+						Timeouts: &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("10s"))},
+						Filters:  []gatewayv1.HTTPRouteFilter{mirror},
+					},
+					{
+						Matches: []gatewayv1.HTTPRouteMatch{{Method: ptr.To(gatewayv1.HTTPMethodGet)}},
+					},
+					{
+						Filters: []gatewayv1.HTTPRouteFilter{{
+							Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+							RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+								Scheme: ptr.To("https"),
+							},
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+			newGatewayClass("basic", features.SupportHTTPRoute),
+			newGatewayClass("timeouts", features.SupportHTTPRouteRequestTimeout, features.SupportHTTPRouteParentRefPort,
+				features.SupportHTTPRouteSchemeRedirect),
+			newGatewayClass("unreported"),
+		).Build(),
+		Recorder:          recorder,
+		SupportedFeatures: true,
+	}
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	httpRoutes, err := r.adaptToSupportedFeatures(ctx, ingress, []gatewayv1.HTTPRoute{
+		newHTTPRoute("basic"), newHTTPRoute("timeouts"), newHTTPRoute("unreported"),
+	}, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 3 {
+		t.Fatalf("expected 3 HTTPRoutes, got %d", len(httpRoutes))
+	}
+
+	basic := httpRoutes[0]
+	if basic.Spec.ParentRefs[0].Port != nil {
+		t.Errorf("expected the port of the parentRef to be dropped")
+	}
+	if len(basic.Spec.Rules) != 1 || basic.Spec.Rules[0].Timeouts != nil || len(basic.Spec.Rules[0].Filters) != 0 {
+		t.Errorf("expected a single rule without timeouts and filters, got %+v", basic.Spec.Rules)
+	}
+
+	timeouts := httpRoutes[1]
+	if timeouts.Spec.ParentRefs[0].Port == nil {
+		t.Errorf("expected the port of the parentRef to be kept")
+	}
+	if len(timeouts.Spec.Rules) != 2 || timeouts.Spec.Rules[0].Timeouts == nil || len(timeouts.Spec.Rules[0].Filters) != 0 {
+		t.Errorf("expected the timeout and the redirect rule to be kept, got %+v", timeouts.Spec.Rules)
+	}
+
+	if unreported := httpRoutes[2]; !isEqual(unreported, newHTTPRoute("unreported")) {
+		t.Errorf("expected the HTTPRoute of a GatewayClass without reported features to be unchanged")
+	}
+
+	expected := []string{
+		"HTTPRoute app-basic uses features its Gateways do not support, they are left out: " +
+			"HTTPRouteMethodMatching, HTTPRouteParentRefPort, HTTPRouteRequestMirror, HTTPRouteRequestTimeout, " +
+			"HTTPRouteSchemeRedirect",
+		"HTTPRoute app-timeouts uses features its Gateways do not support, they are left out: " +
+			"HTTPRouteMethodMatching, HTTPRouteRequestMirror",
+	}
+	for _, message := range expected {
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasSuffix(event, message) {
+				t.Errorf("expected event %q, got %q", message, event)
+			}
+		default:
+			t.Errorf("expected event %q", message)
+		}
+	}
+}
+
+func TestAdaptSessionPersistence(t *testing.T) {
+	newHTTPRoute := func() gatewayv1.HTTPRoute {
+		return gatewayv1.HTTPRoute{Spec: gatewayv1.HTTPRouteSpec{Rules: []gatewayv1.HTTPRouteRule{{
+			SessionPersistence: &gatewayv1.SessionPersistence{SessionName: ptr.To("INGRESSCOOKIE")},
+		}}}}
+	}
+
+	httpRoute := newHTTPRoute()
+	unsupported := adaptHTTPRoute(&httpRoute, featureSet{gatewayv1.FeatureName(features.SupportHTTPRoute): true})
+	if httpRoute.Spec.Rules[0].SessionPersistence != nil || !isEqual(unsupported, []features.FeatureName{supportHTTPRouteSessionPersistence}) {
+		t.Errorf("expected the session persistence to be dropped, got %+v, %v", httpRoute.Spec.Rules[0], unsupported)
+	}
+
+	httpRoute = newHTTPRoute()
+	unsupported = adaptHTTPRoute(&httpRoute, featureSet{gatewayv1.FeatureName(supportHTTPRouteSessionPersistence): true})
+	if httpRoute.Spec.Rules[0].SessionPersistence == nil || len(unsupported) != 0 {
+		t.Errorf("expected the session persistence to be kept, got %v", unsupported)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+const (
+	// routesFinalizer keeps an Ingress until the routes created for it outside its namespace or in the target
+	// cluster are deleted, as owner references cannot point to another namespace or cluster
+	routesFinalizer = "ingress2httproute.lion7.dev/routes"
+	// sourceKindLabel, sourceNamespaceLabel and sourceNameLabel select the HTTPRoutes created for an Ingress, or
+	// other converted source, outside its namespace
+	sourceKindLabel      = "ingress2httproute.lion7.dev/source-kind"
+	sourceNamespaceLabel = "ingress2httproute.lion7.dev/source-namespace"
+	sourceNameLabel      = "ingress2httproute.lion7.dev/source-name"
+)
+
+// sourceLabels returns the labels of the HTTPRoutes created for the owner in the namespace outside that namespace.
+// Names longer than a label value are shortened like truncateName, the owner annotation tells the owners apart.
+func sourceLabels(namespace string, owner metav1.OwnerReference) map[string]string {
+	name := owner.Name
+	if len(name) > validation.LabelValueMaxLength {
+		name = strings.TrimRight(name[:validation.LabelValueMaxLength-nameHashLength-1], "-.") + "-" + shortHash(name)
+	}
+	return map[string]string{
+		sourceKindLabel:      ownerGroupKind(owner).String(),
+		sourceNamespaceLabel: namespace,
+		sourceNameLabel:      name,
+	}
+}
+
+// placesRoutes returns true if the routes cannot be garbage collected with their Ingress, or other converted source,
+// as they are created outside its namespace or in the target cluster
+func (r *IngressReconciler) placesRoutes() bool {
+	return r.GatewayNamespaceRoutes || r.TargetCluster != nil
+}
+
+// ensureRoutesFinalizer adds the routes finalizer to the Ingress, or other converted source, before HTTPRoutes are
+// created for it outside its namespace
+func (r *IngressReconciler) ensureRoutesFinalizer(ctx context.Context, obj client.Object) error {
+	if controllerutil.ContainsFinalizer(obj, routesFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	controllerutil.AddFinalizer(obj, routesFinalizer)
+	return r.ingressClient().Patch(ctx, obj, patch)
+}
+
+// finalizeIngress deletes the routes created for the deleted Ingress outside its namespace and then removes
+// the routes finalizer. HTTPRoutes that were orphaned by the retirement of the Ingress no longer carry its owner
+// annotation and are kept.
+func (r *IngressReconciler) finalizeIngress(ctx context.Context, ingress networkingv1.Ingress) error {
+	if err := r.deletePlacedRoutes(ctx, ingress); err != nil {
+		return err
+	}
+	if r.grantsBackends() {
+		if err := r.deleteStaleReferenceGrants(ctx); err != nil {
+			return err
+		}
+	}
+	return r.removeRoutesFinalizer(ctx, &ingress)
+}
+
+// deletePlacedRoutes deletes the routes created outside its namespace or in the target cluster for the Ingress, or for
+// the source it is mapped from. Merged routes that are still owned by other Ingresses are only released, those
+// Ingresses then merge them again. The policies rendered for the HTTPRoutes are owned by them and deleted with them.
+func (r *IngressReconciler) deletePlacedRoutes(ctx context.Context, ingress networkingv1.Ingress) error {
+	// The labels of a merged route only name one of its Ingresses, and the routes placed before the kind was
+	// recorded have no kind label, so the routes are selected by namespace and told apart by the owner annotation
+	selector := client.MatchingLabels{sourceNamespaceLabel: ingress.Namespace}
+
+	lists := map[string]client.ObjectList{"HTTPRoute": &gatewayv1.HTTPRouteList{}}
+	if r.AppProtocolBackends {
+		lists["GRPCRoute"] = &gatewayv1.GRPCRouteList{}
+	}
+	if r.TLSPassthroughRoutes {
+		lists["TLSRoute"] = &gatewayv1alpha2.TLSRouteList{}
+	}
+	for kind, list := range lists {
+		if err := r.routeClient().List(ctx, list, selector); err != nil {
+			return err
+		}
+		routes, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		if r.TargetCluster != nil {
+			// The routes in the namespace of the Ingress only carry the owner annotation
+			namespacedList := list.DeepCopyObject().(client.ObjectList)
+			if err := r.routeClient().List(ctx, namespacedList, client.InNamespace(ingress.Namespace)); err != nil {
+				return err
+			}
+			namespaced, err := meta.ExtractList(namespacedList)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, namespaced...)
+		}
+		for _, obj := range routes {
+			if err := r.deletePlacedRoute(ctx, ingress, kind, obj.(client.Object)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deletePlacedRoute deletes the route of the kind if it is owned by the Ingress, or releases it if other Ingresses
+// own it too
+func (r *IngressReconciler) deletePlacedRoute(ctx context.Context, ingress networkingv1.Ingress, kind string, route client.Object) error {
+	owner := createOwnerReference(ingress)
+	if !isAnnotatedOwner(route.GetAnnotations(), ownerGroupKind(owner), ingress.Namespace, ingress.Name) {
+		return nil
+	}
+	patch := client.MergeFrom(route.DeepCopyObject().(client.Object))
+	if releaseAnnotatedOwner(route, ownerGroupKind(owner), ingress.Namespace, ingress.Name) {
+		if err := r.routeClient().Patch(ctx, route, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("released "+kind+" of deleted "+owner.Kind, "name", client.ObjectKeyFromObject(route))
+		return nil
+	}
+	if err := r.routeClient().Delete(ctx, route); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("deleted "+kind+" of deleted "+owner.Kind, "name", client.ObjectKeyFromObject(route))
+	return nil
+}
+
+// removeRoutesFinalizer removes the routes finalizer once the HTTPRoutes of the object are deleted
+func (r *IngressReconciler) removeRoutesFinalizer(ctx context.Context, obj client.Object) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	controllerutil.RemoveFinalizer(obj, routesFinalizer)
+	return client.IgnoreNotFound(r.ingressClient().Patch(ctx, obj, patch))
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestFinalizeIngress(t *testing.T) {
+	ctx := context.Background()
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name: "app", Namespace: "default", Finalizers: []string{routesFinalizer},
+	}}
+	newHTTPRoute := func(name, owner string) *gatewayv1.HTTPRoute {
+		httpRoute := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "infra", Labels: sourceLabels("default", createOwnerReference(*ingress)),
+		}}
+		if owner != "" {
+			httpRoute.Annotations = map[string]string{ownerAnnotation: owner}
+		}
+		return httpRoute
+	}
+
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+		ingress,
+		newHTTPRoute("default-app-app-example-com", "Ingress.networking.k8s.io/default/app"),
+		// Placed before the kind was recorded
+		newHTTPRoute("default-app-legacy-example-com", "default/app"),
+		// A Route of OpenShift with the same name
+		newHTTPRoute("default-app-route-example-com", "Route.route.openshift.io/default/app"),
+		// Orphaned by the retirement of the Ingress
+		newHTTPRoute("default-app-retired-example-com", ""),
+		// Another Ingress whose long name was shortened to the same label value
+		newHTTPRoute("default-other-example-com", "default/app-other"),
+		// Merged with the rules of another Ingress
+		newHTTPRoute("default-shared-example-com", "Ingress.networking.k8s.io/default/app,Ingress.networking.k8s.io/default/other"),
+	).Build()
+	r := &IngressReconciler{Client: c, Scheme: golden.Scheme, GatewayNamespaceRoutes: true, MergeHosts: true}
+
+	if err := c.Delete(ctx, ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var httpRoutes gatewayv1.HTTPRouteList
+	if err := c.List(ctx, &httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, httpRoute := range httpRoutes.Items {
+		names = append(names, httpRoute.Name)
+	}
+	expected := []string{"default-app-retired-example-com", "default-app-route-example-com", "default-other-example-com", "default-shared-example-com"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected HTTPRoutes %v, got %v", expected, names)
+	}
+	if owner := httpRoutes.Items[3].Annotations[ownerAnnotation]; owner != "Ingress.networking.k8s.io/default/other" {
+		t.Errorf("expected the merged HTTPRoute to be released to the other Ingress, got %q", owner)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ingress), &networkingv1.Ingress{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the Ingress to be deleted once finalized, got %v", err)
+	}
+}
+
+// targetCluster is the cluster of the target client, of which the tests only use the client
+type targetCluster struct {
+	cluster.Cluster
+	client client.Client
+}
+
+func (c targetCluster) GetClient() client.Client {
+	return c.client
+}
+
+func TestFinalizeIngressInTargetCluster(t *testing.T) {
+	ctx := context.Background()
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name: "app", Namespace: "default", Finalizers: []string{routesFinalizer},
+	}}
+	newHTTPRoute := func(name, owner string) *gatewayv1.HTTPRoute {
+		return &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "default", Annotations: map[string]string{ownerAnnotation: owner},
+		}}
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(ingress).Build()
+	owner := map[string]string{ownerAnnotation: "Ingress.networking.k8s.io/default/app"}
+	target := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+		newHTTPRoute("app-app-example-com", "Ingress.networking.k8s.io/default/app"),
+		newHTTPRoute("other-other-example-com", "Ingress.networking.k8s.io/default/other"),
+		&gatewayv1.GRPCRoute{ObjectMeta: metav1.ObjectMeta{Name: "app-grpc-example-com", Namespace: "default", Annotations: owner}},
+		&gatewayv1alpha2.TLSRoute{ObjectMeta: metav1.ObjectMeta{Name: "app-tls-example-com", Namespace: "default", Annotations: owner}},
+	).Build()
+	r := &IngressReconciler{
+		Client:               c,
+		Scheme:               golden.Scheme,
+		TargetCluster:        targetCluster{client: target},
+		AppProtocolBackends:  true,
+		TLSPassthroughRoutes: true,
+	}
+
+	if err := c.Delete(ctx, ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var httpRoutes gatewayv1.HTTPRouteList
+	if err := target.List(ctx, &httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes.Items) != 1 || httpRoutes.Items[0].Name != "other-other-example-com" {
+		t.Errorf("expected only the HTTPRoute of the other Ingress to be kept, got %v", httpRoutes.Items)
+	}
+	var grpcRoutes gatewayv1.GRPCRouteList
+	if err := target.List(ctx, &grpcRoutes); err != nil {
+		t.Fatal(err)
+	}
+	var tlsRoutes gatewayv1alpha2.TLSRouteList
+	if err := target.List(ctx, &tlsRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if len(grpcRoutes.Items) != 0 || len(tlsRoutes.Items) != 0 {
+		t.Errorf("expected the GRPCRoute and TLSRoute to be deleted, got %v and %v", grpcRoutes.Items, tlsRoutes.Items)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ingress), &networkingv1.Ingress{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the Ingress to be deleted once finalized, got %v", err)
+	}
+}
+
+func TestSourceLabels(t *testing.T) {
+	name := strings.Repeat("a", 100)
+	labels := sourceLabels("default", metav1.OwnerReference{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: name})
+	if value := labels[sourceNameLabel]; len(value) > validation.LabelValueMaxLength || !strings.HasPrefix(value, "aaa") {
+		t.Errorf("expected a shortened label value, got %q", value)
+	}
+	if labels[sourceNameLabel] == sourceLabels("default", metav1.OwnerReference{Name: name + "b"})[sourceNameLabel] {
+		t.Errorf("expected long names with the same beginning to get different label values")
+	}
+	if value := labels[sourceKindLabel]; value != "Ingress.networking.k8s.io" {
+		t.Errorf("expected the kind label Ingress.networking.k8s.io, got %q", value)
+	}
+}
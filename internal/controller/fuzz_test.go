@@ -0,0 +1,305 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// Gateway API limits on HTTPRoutes, as enforced by the CRD schema
+	maxParentRefs   = 32
+	maxHostnames    = 16
+	maxRules        = 16
+	maxMatches      = 64
+	maxRouteMatches = 128
+
+	// The generator exceeds the number of rules a single HTTPRoute can hold,
+	// so the limits also cover the shards of large Ingresses.
+	maxGeneratedPaths = 3 * maxRules
+)
+
+var (
+	fuzzNamespaces        = []string{"default", "apps", "infra"}
+	fuzzIngressHosts      = []string{"", "app.example.com", "api.example.com", "*.example.com", "example.org", "deep.api.example.com"}
+	fuzzListenerHostnames = []string{"", "*.example.com", "app.example.com", "*.api.example.com", "example.org", "*.org"}
+	fuzzPaths             = []string{"/", "/api", "/api/v1", "/static", "/app/assets", "/healthz"}
+	fuzzPathTypes         = []networkingv1.PathType{networkingv1.PathTypeExact, networkingv1.PathTypePrefix, networkingv1.PathTypeImplementationSpecific}
+	fuzzServices          = []string{"app-service", "api-service", "static-service"}
+	fuzzPorts             = []gatewayv1.PortNumber{80, 443, 8080}
+)
+
+// FuzzConvert generates random Ingress and Gateway combinations from a seed and checks
+// the invariants every conversion must satisfy, whatever the reconciler options are.
+func FuzzConvert(f *testing.F) {
+	for seed := int64(0); seed < 32; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		rnd := rand.New(rand.NewSource(seed))
+		ingress := generateIngress(rnd)
+		gateways := generateGateways(rnd)
+		reconciler := &IngressReconciler{
+			Client:             fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(generateServices(ingress.Namespace)...).Build(),
+			Scheme:             scheme.Scheme,
+			CollapseParentRefs: rnd.Intn(2) == 0,
+			RoutePerParent:     rnd.Intn(2) == 0,
+			ConsolidateRules:   rnd.Intn(2) == 0,
+		}
+		if rnd.Intn(2) == 0 {
+			reconciler.ListenerPorts = []int32{int32(fuzzPorts[rnd.Intn(len(fuzzPorts))])}
+		}
+
+		ctx := context.Background()
+		routes, err := reconciler.Convert(ctx, ingress, gateways)
+		if err != nil {
+			t.Fatalf("conversion failed: %v", err)
+		}
+
+		// The output must not depend on map iteration order
+		again, err := reconciler.Convert(ctx, ingress, gateways)
+		if err != nil {
+			t.Fatalf("second conversion failed: %v", err)
+		}
+		if !isEqual(routes, again) {
+			t.Fatalf("conversion is not deterministic")
+		}
+
+		names := make(map[string]bool)
+		for _, route := range routes {
+			if errs := validation.IsDNS1123Subdomain(route.Name); len(errs) > 0 {
+				t.Errorf("HTTPRoute name %q is invalid: %v", route.Name, errs)
+			}
+			if names[route.Name] {
+				t.Errorf("HTTPRoute name %q is generated more than once", route.Name)
+			}
+			names[route.Name] = true
+
+			checkLimits(t, route)
+			checkParentRefsUnique(t, route)
+			checkRulesTraceable(t, route, ingress)
+		}
+
+		checkHostIndexConsistent(t, ingress, gateways)
+	})
+}
+
+// checkHostIndexConsistent verifies a Gateway change enqueues exactly the Ingresses with a matching host
+func checkHostIndexConsistent(t *testing.T, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) {
+	keys := indexIngressHosts(&ingress)
+	for _, gateway := range gateways.Items {
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Hostname == nil {
+				continue
+			}
+			hostname := string(*listener.Hostname)
+			matches := slices.ContainsFunc(ingress.Spec.Rules, func(rule networkingv1.IngressRule) bool {
+				return hostnamesIntersect(rule.Host, hostname)
+			})
+			indexed := slices.ContainsFunc(listenerIndexKeys(hostname), func(key string) bool {
+				return slices.Contains(keys, key)
+			})
+			if indexed != matches {
+				t.Errorf("listener hostname %s is indexed: %v, but matches: %v", hostname, indexed, matches)
+			}
+		}
+	}
+}
+
+func checkLimits(t *testing.T, route gatewayv1.HTTPRoute) {
+	if n := len(route.Spec.ParentRefs); n == 0 || n > maxParentRefs {
+		t.Errorf("HTTPRoute %s has %d parentRefs", route.Name, n)
+	}
+	if n := len(route.Spec.Hostnames); n > maxHostnames {
+		t.Errorf("HTTPRoute %s has %d hostnames", route.Name, n)
+	}
+	if n := len(route.Spec.Rules); n == 0 || n > maxRules {
+		t.Errorf("HTTPRoute %s has %d rules", route.Name, n)
+	}
+	var matches int
+	for _, rule := range route.Spec.Rules {
+		if n := len(rule.Matches); n > maxMatches {
+			t.Errorf("HTTPRoute %s has a rule with %d matches", route.Name, n)
+		}
+		matches += len(rule.Matches)
+	}
+	if matches >= maxRouteMatches {
+		t.Errorf("HTTPRoute %s has %d matches", route.Name, matches)
+	}
+}
+
+func checkParentRefsUnique(t *testing.T, route gatewayv1.HTTPRoute) {
+	for i, a := range route.Spec.ParentRefs {
+		for _, b := range route.Spec.ParentRefs[i+1:] {
+			if compareParentRef(a, b) == 0 {
+				t.Errorf("HTTPRoute %s references parent %s more than once", route.Name, a.Name)
+			}
+			// Only a single parentRef to the same parent may omit the sectionName
+			if isSameParent(a, b) && a.SectionName == nil && b.SectionName == nil {
+				t.Errorf("HTTPRoute %s references parent %s more than once without sectionName", route.Name, a.Name)
+			}
+		}
+	}
+}
+
+// checkRulesTraceable verifies every match of the HTTPRoute originates from a path of the Ingress
+func checkRulesTraceable(t *testing.T, route gatewayv1.HTTPRoute, ingress networkingv1.Ingress) {
+	host := ""
+	if len(route.Spec.Hostnames) > 0 {
+		host = string(route.Spec.Hostnames[0])
+	}
+
+	for _, rule := range route.Spec.Rules {
+		for _, match := range rule.Matches {
+			if !isMatchTraceable(match, rule.BackendRefs, host, ingress) {
+				t.Errorf("HTTPRoute %s has a match for %s that is not in the Ingress", route.Name, *match.Path.Value)
+			}
+		}
+	}
+}
+
+func isMatchTraceable(match gatewayv1.HTTPRouteMatch, backendRefs []gatewayv1.HTTPBackendRef, host string, ingress networkingv1.Ingress) bool {
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != host || rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if !isEqual(createPathMatch(path, PathTypeRegex), *match.Path) {
+				continue
+			}
+			if len(backendRefs) == 1 && string(backendRefs[0].Name) == path.Backend.Service.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generateIngress(rnd *rand.Rand) networkingv1.Ingress {
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("ingress-%d", rnd.Intn(100)),
+			Namespace: fuzzNamespaces[rnd.Intn(len(fuzzNamespaces))],
+			UID:       "12345678-1234-1234-1234-123456789012",
+		},
+	}
+
+	paths := make(map[string]int)
+	for range 1 + rnd.Intn(5) {
+		host := fuzzIngressHosts[rnd.Intn(len(fuzzIngressHosts))]
+		rule := networkingv1.IngressRule{
+			Host:             host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}},
+		}
+		for range 1 + rnd.Intn(12) {
+			if paths[host] == maxGeneratedPaths {
+				break
+			}
+			paths[host]++
+
+			port := networkingv1.ServiceBackendPort{Number: int32(fuzzPorts[rnd.Intn(len(fuzzPorts))])}
+			if rnd.Intn(4) == 0 {
+				port = networkingv1.ServiceBackendPort{Name: "http"}
+			}
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+				Path:     fuzzPaths[rnd.Intn(len(fuzzPaths))],
+				PathType: ptr.To(fuzzPathTypes[rnd.Intn(len(fuzzPathTypes))]),
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: fuzzServices[rnd.Intn(len(fuzzServices))],
+						Port: port,
+					},
+				},
+			})
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, rule)
+	}
+
+	return ingress
+}
+
+func generateGateways(rnd *rand.Rand) gatewayv1.GatewayList {
+	var gateways gatewayv1.GatewayList
+	for i := range rnd.Intn(5) {
+		gateway := gatewayv1.Gateway{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: gatewayv1.GroupVersion.String(),
+				Kind:       "Gateway",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("gateway-%d", i),
+				Namespace: fuzzNamespaces[rnd.Intn(len(fuzzNamespaces))],
+			},
+			Spec: gatewayv1.GatewaySpec{GatewayClassName: "fuzz"},
+		}
+
+		for j := range 1 + rnd.Intn(4) {
+			port := fuzzPorts[rnd.Intn(len(fuzzPorts))]
+			listener := gatewayv1.Listener{
+				Name:     gatewayv1.SectionName(fmt.Sprintf("listener-%d", j)),
+				Protocol: gatewayv1.HTTPProtocolType,
+				Port:     port,
+			}
+			if hostname := fuzzListenerHostnames[rnd.Intn(len(fuzzListenerHostnames))]; hostname != "" {
+				listener.Hostname = ptr.To(gatewayv1.Hostname(hostname))
+			}
+			if port == 443 {
+				listener.Protocol = gatewayv1.HTTPSProtocolType
+				mode := []gatewayv1.TLSModeType{gatewayv1.TLSModeTerminate, gatewayv1.TLSModePassthrough}[rnd.Intn(2)]
+				listener.TLS = &gatewayv1.GatewayTLSConfig{Mode: &mode}
+			}
+			if rnd.Intn(2) == 0 {
+				from := []gatewayv1.FromNamespaces{gatewayv1.NamespacesFromAll, gatewayv1.NamespacesFromSame}[rnd.Intn(2)]
+				listener.AllowedRoutes = &gatewayv1.AllowedRoutes{
+					Namespaces: &gatewayv1.RouteNamespaces{From: &from},
+				}
+			}
+			gateway.Spec.Listeners = append(gateway.Spec.Listeners, listener)
+		}
+
+		gateways.Items = append(gateways.Items, gateway)
+	}
+	return gateways
+}
+
+func generateServices(namespace string) []client.Object {
+	var services []client.Object
+	for _, name := range fuzzServices {
+		services = append(services, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{Name: "http", Port: 8080}},
+			},
+		})
+	}
+	return services
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// gatewayAnnotation pins the HTTPRoutes of an Ingress to a Gateway as namespace/name,
+	// or to one of its listeners as namespace/name/listener
+	gatewayAnnotation = DefaultAnnotationPrefix + "gateway"
+	// ingressGatewayIndex is the field index of Ingresses by the namespace/name of the Gateway they are pinned to
+	ingressGatewayIndex = "metadata.annotations.gateway"
+)
+
+// ParseGatewayReference returns the parentRef of a Gateway given as namespace/name, or of one of its listeners
+// given as namespace/name/listener
+func ParseGatewayReference(value string) (gatewayv1.ParentReference, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return gatewayv1.ParentReference{}, fmt.Errorf("must be namespace/name or namespace/name/listener")
+	}
+	for _, part := range parts {
+		if errs := validation.IsDNS1123Subdomain(part); len(errs) > 0 {
+			return gatewayv1.ParentReference{}, fmt.Errorf("invalid name %q: %s", part, strings.Join(errs, ", "))
+		}
+	}
+
+	parentRef := gatewayv1.ParentReference{
+		Group:     ptr.To(gatewayv1.Group(gatewayv1.GroupName)),
+		Kind:      ptr.To(gatewayv1.Kind("Gateway")),
+		Namespace: ptr.To(gatewayv1.Namespace(parts[0])),
+		Name:      gatewayv1.ObjectName(parts[1]),
+	}
+	if len(parts) == 3 {
+		parentRef.SectionName = ptr.To(gatewayv1.SectionName(parts[2]))
+	}
+	return parentRef, nil
+}
+
+// pinnedParentRef returns the parentRef the Ingress pins its HTTPRoutes to, bypassing the hostname-based discovery
+// of Gateways, and true if it is pinned. An invalid annotation, or a Gateway that does not exist or is not a
+// candidate, e.g. as it is not programmed yet, is reported with an Event and returns no parentRef: the Ingress stays
+// pinned, so its HTTPRoutes attach to nothing rather than to the Gateways discovered by hostname.
+func (r *IngressReconciler) pinnedParentRef(ingress *networkingv1.Ingress, gateways gatewayv1.GatewayList) (*gatewayv1.ParentReference, bool) {
+	annotation := r.annotation(gatewayAnnotation)
+	value, ok := ingress.Annotations[annotation]
+	if !ok {
+		return nil, false
+	}
+
+	parentRef, err := ParseGatewayReference(value)
+	if err != nil {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidGatewayAnnotation",
+			fmt.Sprintf("Not attaching HTTPRoutes, %s annotation %q is invalid: %v", annotation, value, err))
+		return nil, true
+	}
+
+	index := slices.IndexFunc(gateways.Items, func(gateway gatewayv1.Gateway) bool {
+		return gateway.Namespace == string(*parentRef.Namespace) && gateway.Name == string(parentRef.Name)
+	})
+	if index < 0 {
+		r.event(ingress, corev1.EventTypeWarning, "GatewayNotFound",
+			fmt.Sprintf("Not attaching HTTPRoutes, Gateway %s/%s of %s annotation is not found or not a candidate",
+				*parentRef.Namespace, parentRef.Name, annotation))
+		return nil, true
+	}
+	if parentRef.SectionName != nil && !slices.ContainsFunc(gateways.Items[index].Spec.Listeners, func(listener gatewayv1.Listener) bool {
+		return listener.Name == *parentRef.SectionName
+	}) {
+		r.event(ingress, corev1.EventTypeWarning, "GatewayNotFound",
+			fmt.Sprintf("Not attaching HTTPRoutes, Gateway %s/%s of %s annotation has no listener %s",
+				*parentRef.Namespace, parentRef.Name, annotation, *parentRef.SectionName))
+		return nil, true
+	}
+	return &parentRef, true
+}
+
+// indexPinnedGateway returns the namespace/name of the Gateway an Ingress, or a source mapped to one, is pinned to
+func (r *IngressReconciler) indexPinnedGateway(obj client.Object) []string {
+	parentRef, err := ParseGatewayReference(obj.GetAnnotations()[r.annotation(gatewayAnnotation)])
+	if err != nil {
+		return nil
+	}
+	return []string{string(*parentRef.Namespace) + "/" + string(parentRef.Name)}
+}
+
+// defaultParentRef returns the parentRef of the default Gateway for a hostname that matches no listener,
+// or nil if there is no default Gateway or it is not a candidate. The fallback is reported with an Event,
+// as the HTTPRoute is only accepted by a listener without hostname or with a wildcard hostname.
+func (r *IngressReconciler) defaultParentRef(ingress *networkingv1.Ingress, hostname string, gateways gatewayv1.GatewayList) *gatewayv1.ParentReference {
+	if r.DefaultGateway == "" {
+		return nil
+	}
+
+	parentRef, err := ParseGatewayReference(r.DefaultGateway)
+	if err != nil {
+		return nil
+	}
+	if !slices.ContainsFunc(gateways.Items, func(gateway gatewayv1.Gateway) bool {
+		return isParentRefForGateway(parentRef, gateway) && (parentRef.SectionName == nil ||
+			slices.ContainsFunc(gateway.Spec.Listeners, func(listener gatewayv1.Listener) bool {
+				return listener.Name == *parentRef.SectionName
+			}))
+	}) {
+		return nil
+	}
+
+	r.event(ingress, corev1.EventTypeNormal, "DefaultGateway",
+		fmt.Sprintf("No Gateway listener with a hostname intersecting %q, attaching to default Gateway %s", hostname, r.DefaultGateway))
+	return &parentRef
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestConvertPinnedToMissingGateway(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).Build(), Recorder: recorder}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: map[string]string{gatewayAnnotation: "infra/pinned"},
+		},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "app.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: ptr.To(networkingv1.PathTypePrefix),
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: "app", Port: networkingv1.ServiceBackendPort{Number: 80},
+					}},
+				}},
+			}},
+		}}},
+	}
+	// The discovered Gateway matches the host, but the Ingress is pinned to another one
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		}},
+	}}}
+
+	httpRoutes, err := r.Convert(context.Background(), ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 0 {
+		t.Errorf("expected no HTTPRoutes, got %+v", httpRoutes)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "GatewayNotFound") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestEnqueueForPinnedGateways(t *testing.T) {
+	ingress := func(name string, annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations}}
+	}
+	r := &IngressReconciler{DefaultGateway: "infra/default"}
+	r.Client = fake.NewClientBuilder().WithScheme(golden.Scheme).
+		WithObjects(ingress("pinned", map[string]string{gatewayAnnotation: "infra/pinned/https"}), ingress("other", nil)).
+		WithIndex(&networkingv1.Ingress{}, ingressHostIndex, indexIngressHosts).
+		WithIndex(&networkingv1.Ingress{}, ingressGatewayIndex, r.indexPinnedGateway).
+		Build()
+	enqueued := func(gateway string) []string {
+		q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+		defer q.ShutDown()
+		r.enqueueForGateways(context.Background(), q, r.listIngressRequests, &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: gateway, Namespace: "infra"},
+			Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+				{Name: "https", Hostname: ptr.To(gatewayv1.Hostname("*.unrelated.example.com"))},
+			}},
+		})
+		var names []string
+		for q.Len() > 0 {
+			request, _ := q.Get()
+			names = append(names, request.Name)
+			q.Done(request)
+		}
+		return names
+	}
+
+	// The listener hostnames match neither Ingress
+	if names := enqueued("pinned"); !isEqual(names, []string{"pinned"}) {
+		t.Errorf("expected the pinned Ingress to be enqueued, got %v", names)
+	}
+	if names := enqueued("unrelated"); len(names) != 0 {
+		t.Errorf("expected no Ingress to be enqueued, got %v", names)
+	}
+	if names := enqueued("default"); len(names) != 2 {
+		t.Errorf("expected every Ingress to be enqueued for the default Gateway, got %v", names)
+	}
+}
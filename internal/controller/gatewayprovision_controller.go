@@ -0,0 +1,267 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// provisionedLabel marks the Gateway created by the controller, an existing Gateway without it is left alone
+const provisionedLabel = "ingress2httproute.lion7.dev/provisioned"
+
+// maxListeners is the maximum number of listeners of a Gateway
+const maxListeners = 64
+
+// GatewayProvisionReconciler creates and maintains a Gateway for the Ingresses, for clusters without Gateways yet.
+// The Gateway has an HTTP listener on port 80 for all hostnames, and an HTTPS listener on port 443 for each TLS host
+// of the Ingresses, terminating TLS with the Secret of the host. All listeners accept routes from all namespaces.
+type GatewayProvisionReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Gateway is the Gateway to create and maintain
+	Gateway types.NamespacedName
+	// GatewayClassName is the GatewayClass of the Gateway when it is created
+	GatewayClassName gatewayv1.ObjectName
+	// IngressClasses limits the Ingresses whose TLS hosts get a listener, like the Ingresses that are converted
+	IngressClasses []string
+	audit.Auditor
+	// Recorder emits Events on the Gateway and the Ingresses, no Events are emitted if unset
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;delete
+
+// Reconcile creates the Gateway, or updates its listeners to those of the current Ingresses
+func (r *GatewayProvisionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.NamespacedName != r.Gateway {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx)
+	ctx = audit.WithReason(ctx, audit.ReasonGatewayProvisioned)
+
+	var ingressList networkingv1.IngressList
+	if err := r.List(ctx, &ingressList); err != nil {
+		return ctrl.Result{}, err
+	}
+	var ingresses []networkingv1.Ingress
+	for _, ingress := range ingressList.Items {
+		if !ingress.DeletionTimestamp.IsZero() {
+			continue
+		}
+		matches, err := matchesIngressClass(ctx, r.Client, r.IngressClasses, ingress)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if matches {
+			ingresses = append(ingresses, ingress)
+		}
+	}
+	listeners, dropped := r.listeners(ingresses)
+
+	gateway := &gatewayv1.Gateway{}
+	if err := r.Get(ctx, r.Gateway, gateway); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      r.Gateway.Name,
+				Namespace: r.Gateway.Namespace,
+				Labels:    map[string]string{provisionedLabel: "true"},
+			},
+			Spec: gatewayv1.GatewaySpec{GatewayClassName: r.GatewayClassName, Listeners: listeners},
+		}
+		if err := r.Audited(r.Client).Create(ctx, gateway); err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("created Gateway", "name", r.Gateway)
+		r.warnDroppedListeners(gateway, dropped)
+		return ctrl.Result{}, r.ensureCertificateGrants(ctx, listeners)
+	}
+
+	if gateway.Labels[provisionedLabel] != "true" {
+		logger.Info("Gateway was not provisioned by the controller", "name", r.Gateway)
+		return ctrl.Result{}, nil
+	}
+	r.warnDroppedListeners(gateway, dropped)
+	if !isEqual(gateway.Spec.Listeners, listeners) {
+		gateway.Spec.Listeners = listeners
+		if err := r.Audited(r.Client).Update(ctx, gateway); err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("updated Gateway", "name", r.Gateway)
+	}
+	return ctrl.Result{}, r.ensureCertificateGrants(ctx, listeners)
+}
+
+// ensureCertificateGrants creates the ReferenceGrants the listeners need for the Secrets in other namespaces
+func (r *GatewayProvisionReconciler) ensureCertificateGrants(ctx context.Context, listeners []gatewayv1.Listener) error {
+	parent := gatewayv1.ParentReference{
+		Group:     ptr.To(gatewayv1.Group(gatewayv1.GroupName)),
+		Kind:      ptr.To(gatewayv1.Kind("Gateway")),
+		Namespace: ptr.To(gatewayv1.Namespace(r.Gateway.Namespace)),
+		Name:      gatewayv1.ObjectName(r.Gateway.Name),
+	}
+	return ensureCertificateGrants(audit.WithReason(ctx, audit.ReasonReferenceGrantRequired), r.Audited(r.Client), parent, listeners)
+}
+
+// listeners returns the listeners of the Gateway for the Ingresses, and the TLS hosts left out as a Gateway has at
+// most 64 listeners
+func (r *GatewayProvisionReconciler) listeners(ingresses []networkingv1.Ingress) ([]gatewayv1.Listener, []string) {
+	hosts, certificates := tlsCertificates(ingresses, r.Gateway.Namespace, func(ingress *networkingv1.Ingress, host, secretName string) {
+		r.event(ingress, corev1.EventTypeWarning, "ConflictingCertificate",
+			fmt.Sprintf("Host %s has the Secret of another Ingress on Gateway %s, Secret %s is not used",
+				host, r.Gateway, secretName))
+	})
+
+	listeners := []gatewayv1.Listener{{
+		Name:          "http",
+		Port:          80,
+		Protocol:      gatewayv1.HTTPProtocolType,
+		AllowedRoutes: allNamespacesRoutes(),
+	}}
+	var dropped []string
+	if len(hosts) > maxListeners-1 {
+		hosts, dropped = hosts[:maxListeners-1], hosts[maxListeners-1:]
+	}
+	for _, host := range hosts {
+		listeners = append(listeners, httpsListener(host, certificates[host]))
+	}
+	return listeners, dropped
+}
+
+// tlsCertificates returns the TLS hosts of the Ingresses with a Secret sorted, and the references to their Secrets
+// from a Gateway in the namespace. A host with different Secrets in several Ingresses uses the Secret of the first
+// Ingress by namespace and name, the others are passed to conflict.
+func tlsCertificates(ingresses []networkingv1.Ingress, gatewayNamespace string, conflict func(ingress *networkingv1.Ingress, host, secretName string)) ([]string, map[string]gatewayv1.SecretObjectReference) {
+	slices.SortFunc(ingresses, func(a, b networkingv1.Ingress) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+
+	certificates := map[string]gatewayv1.SecretObjectReference{}
+	var hosts []string
+	for i := range ingresses {
+		ingress := &ingresses[i]
+		for _, tls := range ingress.Spec.TLS {
+			// Without a Secret the Ingress controller serves its default certificate, which the Gateway lacks
+			if tls.SecretName == "" {
+				continue
+			}
+			certificate := gatewayv1.SecretObjectReference{
+				Group: ptr.To(gatewayv1.Group("")),
+				Kind:  ptr.To(gatewayv1.Kind("Secret")),
+				Name:  gatewayv1.ObjectName(tls.SecretName),
+			}
+			if ingress.Namespace != gatewayNamespace {
+				certificate.Namespace = ptr.To(gatewayv1.Namespace(ingress.Namespace))
+			}
+			for _, host := range tls.Hosts {
+				existing, ok := certificates[host]
+				if !ok {
+					certificates[host] = certificate
+					hosts = append(hosts, host)
+				} else if !isEqual(existing, certificate) {
+					conflict(ingress, host, tls.SecretName)
+				}
+			}
+		}
+	}
+	slices.Sort(hosts)
+	return hosts, certificates
+}
+
+// listenerName returns the name of the listener of the protocol for the host, with wildcard for *
+func listenerName(protocol gatewayv1.ProtocolType, host string) gatewayv1.SectionName {
+	return gatewayv1.SectionName(strings.ToLower(string(protocol)) + "-" + strings.ReplaceAll(host, "*", "wildcard"))
+}
+
+// httpsListener returns the HTTPS listener of the host on port 443, terminating TLS with the Secret
+func httpsListener(host string, certificate gatewayv1.SecretObjectReference) gatewayv1.Listener {
+	return gatewayv1.Listener{
+		Name:     listenerName(gatewayv1.HTTPSProtocolType, host),
+		Hostname: ptr.To(gatewayv1.Hostname(host)),
+		Port:     443,
+		Protocol: gatewayv1.HTTPSProtocolType,
+		TLS: &gatewayv1.GatewayTLSConfig{
+			Mode:            ptr.To(gatewayv1.TLSModeTerminate),
+			CertificateRefs: []gatewayv1.SecretObjectReference{certificate},
+		},
+		AllowedRoutes: allNamespacesRoutes(),
+	}
+}
+
+// allNamespacesRoutes allows the routes of all namespaces to attach to a listener
+func allNamespacesRoutes() *gatewayv1.AllowedRoutes {
+	return &gatewayv1.AllowedRoutes{Namespaces: &gatewayv1.RouteNamespaces{From: ptr.To(gatewayv1.NamespacesFromAll)}}
+}
+
+// warnDroppedListeners emits an Event on the Gateway listing the TLS hosts without a listener
+func (r *GatewayProvisionReconciler) warnDroppedListeners(gateway *gatewayv1.Gateway, dropped []string) {
+	if len(dropped) > 0 {
+		r.event(gateway, corev1.EventTypeWarning, "TooManyListeners",
+			fmt.Sprintf("A Gateway has at most %d listeners, TLS hosts %s have none", maxListeners,
+				strings.Join(dropped, ", ")))
+	}
+}
+
+// event emits an Event on the object, if a recorder is set
+func (r *GatewayProvisionReconciler) event(object runtime.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GatewayProvisionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every Ingress change may add or remove a TLS host
+	enqueueGateway := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: r.Gateway}}
+	})
+	isGateway := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return client.ObjectKeyFromObject(obj) == r.Gateway
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("gatewayprovision").
+		For(&gatewayv1.Gateway{}, builder.WithPredicates(isGateway)).
+		Watches(&networkingv1.Ingress{}, enqueueGateway).
+		Watches(&networkingv1.IngressClass{}, enqueueGateway).
+		Complete(r)
+}
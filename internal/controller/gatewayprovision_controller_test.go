@@ -0,0 +1,145 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestGatewayProvisionReconcile(t *testing.T) {
+	ctx := context.Background()
+	name := types.NamespacedName{Namespace: "gateway", Name: "ingress"}
+	app := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{
+			{Hosts: []string{"app.example.com", "*.example.com"}, SecretName: "app-tls"},
+			{Hosts: []string{"default.example.com"}},
+		}},
+	}
+	other := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "app"},
+		Spec: networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{
+			{Hosts: []string{"app.example.com"}, SecretName: "other-tls"},
+		}},
+	}
+	nginx := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: ptr.To("nginx"),
+			TLS:              []networkingv1.IngressTLS{{Hosts: []string{"nginx.example.com"}, SecretName: "nginx-tls"}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(app, other, nginx).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &GatewayProvisionReconciler{
+		Client:           c,
+		Gateway:          name,
+		GatewayClassName: "envoy",
+		Recorder:         recorder,
+	}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	gateway := &gatewayv1.Gateway{}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	if gateway.Spec.GatewayClassName != "envoy" || gateway.Labels[provisionedLabel] != "true" {
+		t.Errorf("unexpected Gateway: %+v", gateway)
+	}
+	var names []string
+	for _, listener := range gateway.Spec.Listeners {
+		names = append(names, string(listener.Name))
+	}
+	expected := []string{"http", "https-wildcard.example.com", "https-app.example.com", "https-nginx.example.com"}
+	if !isEqual(names, expected) {
+		t.Errorf("unexpected listeners: %v", names)
+	}
+	certificate := gatewayv1.SecretObjectReference{
+		Group:     ptr.To(gatewayv1.Group("")),
+		Kind:      ptr.To(gatewayv1.Kind("Secret")),
+		Name:      "app-tls",
+		Namespace: ptr.To(gatewayv1.Namespace("default")),
+	}
+	if refs := gateway.Spec.Listeners[2].TLS.CertificateRefs; !isEqual(refs, []gatewayv1.SecretObjectReference{certificate}) {
+		t.Errorf("expected the Secret of the first Ingress, got %v", refs)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ConflictingCertificate") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// Only the Ingresses of the IngressClasses get listeners
+	r.IngressClasses = []string{"nginx"}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	if len(gateway.Spec.Listeners) != 2 || gateway.Spec.Listeners[1].Name != "https-nginx.example.com" {
+		t.Errorf("unexpected listeners: %+v", gateway.Spec.Listeners)
+	}
+
+	// A Gateway that was not provisioned is left alone
+	delete(gateway.Labels, provisionedLabel)
+	if err := c.Update(ctx, gateway); err != nil {
+		t.Fatal(err)
+	}
+	r.IngressClasses = nil
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	if len(gateway.Spec.Listeners) != 2 {
+		t.Errorf("expected the Gateway to be left alone, got %+v", gateway.Spec.Listeners)
+	}
+}
+
+func TestGatewayProvisionListenerLimit(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GatewayProvisionReconciler{Gateway: types.NamespacedName{Namespace: "default", Name: "ingress"}, Recorder: recorder}
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	tls := networkingv1.IngressTLS{SecretName: "app-tls"}
+	for i := range maxListeners + 1 {
+		tls.Hosts = append(tls.Hosts, strings.Repeat("a", i+1)+".example.com")
+	}
+	ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+
+	listeners, dropped := r.listeners([]networkingv1.Ingress{ingress})
+	if len(listeners) != maxListeners || len(dropped) != 2 {
+		t.Errorf("expected %d listeners and 2 dropped hosts, got %d and %v", maxListeners, len(listeners), dropped)
+	}
+	if listeners[1].TLS.CertificateRefs[0].Namespace != nil {
+		t.Errorf("expected no namespace for a Secret in the namespace of the Gateway")
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestCandidateGateways(t *testing.T) {
+	newGateway := func(name string, class gatewayv1.ObjectName, accepted, programmed metav1.ConditionStatus) gatewayv1.Gateway {
+		return gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       gatewayv1.GatewaySpec{GatewayClassName: class},
+			Status: gatewayv1.GatewayStatus{Conditions: []metav1.Condition{
+				{Type: string(gatewayv1.GatewayConditionAccepted), Status: accepted},
+				{Type: string(gatewayv1.GatewayConditionProgrammed), Status: programmed},
+			}},
+		}
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{
+		newGateway("ready", "internal", metav1.ConditionTrue, metav1.ConditionTrue),
+		newGateway("not-programmed", "internal", metav1.ConditionTrue, metav1.ConditionFalse),
+		newGateway("not-accepted", "internal", metav1.ConditionFalse, metav1.ConditionUnknown),
+		newGateway("external", "external", metav1.ConditionTrue, metav1.ConditionTrue),
+		{ObjectMeta: metav1.ObjectMeta{Name: "no-status", Namespace: "default"}},
+	}}
+
+	tests := []struct {
+		name       string
+		reconciler IngressReconciler
+		expected   []string
+	}{
+		{name: "all", expected: []string{"ready", "not-programmed", "not-accepted", "external", "no-status"}},
+		{name: "gateway class", reconciler: IngressReconciler{GatewayClasses: []gatewayv1.ObjectName{"internal"}},
+			expected: []string{"ready", "not-programmed", "not-accepted"}},
+		{name: "ready", reconciler: IngressReconciler{RequireReadyGateways: true},
+			expected: []string{"ready", "external"}},
+		{name: "ready gateway class", reconciler: IngressReconciler{
+			GatewayClasses: []gatewayv1.ObjectName{"internal"}, RequireReadyGateways: true,
+		}, expected: []string{"ready"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, gateway := range tt.reconciler.candidateGateways(gateways).Items {
+				names = append(names, gateway.Name)
+			}
+			if !slices.Equal(names, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestLookupGateways(t *testing.T) {
+	newGateway := func(name string, hostnames ...string) *gatewayv1.Gateway {
+		gateway := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "infra"}}
+		for _, hostname := range hostnames {
+			listener := gatewayv1.Listener{Name: gatewayv1.SectionName(name), Protocol: gatewayv1.HTTPProtocolType, Port: 80}
+			if hostname != "" {
+				listener.Hostname = ptr.To(gatewayv1.Hostname(hostname))
+			}
+			gateway.Spec.Listeners = append(gateway.Spec.Listeners, listener)
+		}
+		return gateway
+	}
+	newIngress := func(annotations map[string]string, hosts ...string) networkingv1.Ingress {
+		ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: annotations}}
+		for _, host := range hosts {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{Host: host})
+		}
+		return ingress
+	}
+	gateways := []*gatewayv1.Gateway{
+		newGateway("exact", "app.example.com"),
+		newGateway("wildcard", "*.example.com"),
+		newGateway("below-wildcard", "api.wild.example.com"),
+		newGateway("other", "other.test"),
+		newGateway("pinned", "pinned.test"),
+		newGateway("default", "default.test"),
+	}
+	builder := fake.NewClientBuilder().WithScheme(golden.Scheme).
+		WithIndex(&gatewayv1.Gateway{}, gatewayHostIndex, indexGatewayHosts)
+	for _, gateway := range gateways {
+		builder = builder.WithObjects(gateway)
+	}
+	indexed := builder.Build()
+	withCatchAll := builder.WithObjects(newGateway("catch-all", "")).Build()
+
+	tests := []struct {
+		name       string
+		reconciler IngressReconciler
+		ingress    networkingv1.Ingress
+		expected   []string
+	}{
+		{name: "exact and wildcard", reconciler: IngressReconciler{Client: indexed, gatewayHostIndexed: true},
+			ingress: newIngress(nil, "app.example.com"), expected: []string{"exact", "wildcard"}},
+		{name: "wildcard host", reconciler: IngressReconciler{Client: indexed, gatewayHostIndexed: true},
+			ingress: newIngress(nil, "*.wild.example.com"), expected: []string{"below-wildcard", "wildcard"}},
+		{name: "catch-all", reconciler: IngressReconciler{Client: withCatchAll, gatewayHostIndexed: true},
+			ingress: newIngress(nil, "other.test"), expected: []string{"catch-all", "other"}},
+		{name: "default and pinned", reconciler: IngressReconciler{
+			Client: indexed, gatewayHostIndexed: true, DefaultGateway: "infra/default",
+		},
+			ingress:  newIngress(map[string]string{gatewayAnnotation: "infra/pinned/pinned"}, "other.test"),
+			expected: []string{"default", "other", "pinned"}},
+		{name: "no match", reconciler: IngressReconciler{Client: indexed, gatewayHostIndexed: true},
+			ingress:  newIngress(nil, "unknown.test"),
+			expected: []string{"below-wildcard", "default", "exact", "other", "pinned", "wildcard"}},
+		{name: "not indexed", reconciler: IngressReconciler{Client: indexed},
+			ingress:  newIngress(nil, "app.example.com"),
+			expected: []string{"below-wildcard", "default", "exact", "other", "pinned", "wildcard"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.reconciler.lookupGateways(context.Background(), tt.ingress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, gateway := range result.Items {
+				names = append(names, gateway.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
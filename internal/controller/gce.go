@@ -0,0 +1,210 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// gceAnnotationPrefix is the prefix of the Service annotations of the GKE Ingress controller
+	gceAnnotationPrefix = "cloud.google.com/"
+	// gceBackendConfigAnnotation references the BackendConfigs of the ports of a Service, as JSON with a default
+	// BackendConfig and one per port number or name
+	gceBackendConfigAnnotation = gceAnnotationPrefix + "backend-config"
+	// gceBetaBackendConfigAnnotation is the older name of the backend-config annotation
+	gceBetaBackendConfigAnnotation = "beta." + gceBackendConfigAnnotation
+)
+
+// backendConfigGVK is the kind of the BackendConfigs of the GKE Ingress controller
+var backendConfigGVK = schema.GroupVersionKind{Group: "cloud.google.com", Version: "v1", Kind: "BackendConfig"}
+
+// gceBackendConfigs is the value of the backend-config annotation of a Service
+type gceBackendConfigs struct {
+	Default string            `json:"default,omitempty"`
+	Ports   map[string]string `json:"ports,omitempty"`
+}
+
+// backendConfigData is passed to the BackendConfig policy template
+type backendConfigData struct {
+	// Route and Namespace are the name and namespace of the HTTPRoute with the Service as backend
+	Route     string
+	Namespace string
+	// Ingress is the name of the Ingress the HTTPRoute was converted from
+	Ingress string
+	// Service and Port are the backend the BackendConfig applies to
+	Service string
+	Port    int32
+	// BackendConfig is the name of the BackendConfig, Spec its spec, e.g. .Spec.timeoutSec or .Spec.iap.enabled
+	BackendConfig string
+	Spec          map[string]any
+}
+
+// gceWildcardPath returns the PathPrefix match of an ImplementationSpecific path ending in the /* wildcard of the GKE
+// Ingress controller, e.g. /static/ for /static/*, and false for other paths. A PathPrefix match would compare the
+// wildcard literally.
+func gceWildcardPath(path networkingv1.HTTPIngressPath) (gatewayv1.HTTPPathMatch, bool) {
+	if path.PathType == nil || *path.PathType != networkingv1.PathTypeImplementationSpecific {
+		return gatewayv1.HTTPPathMatch{}, false
+	}
+	prefix, ok := strings.CutSuffix(path.Path, "/*")
+	if !ok {
+		return gatewayv1.HTTPPathMatch{}, false
+	}
+	pathPrefix := gatewayv1.PathMatchPathPrefix
+	value := prefix + "/"
+	return gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &value}, true
+}
+
+// BackendConfigPolicies renders the BackendConfigPolicyTemplate for each Service port of the HTTPRoutes of an
+// Ingress with a BackendConfig, as the features it configures, e.g. Cloud CDN, IAP or the backend timeout, have no
+// Gateway API equivalent. The policies are owned like the HTTPRoutes. Without a template, an Event lists the
+// features that are lost instead.
+func (r *IngressReconciler) BackendConfigPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) ([]*unstructured.Unstructured, error) {
+	if r.DisableServiceLookups || len(httpRoutes) == 0 {
+		return nil, nil
+	}
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil || !profile.translates(gceAnnotationPrefix) {
+		return nil, err
+	}
+
+	var policies []*unstructured.Unstructured
+	seen, reported := map[string]bool{}, map[string]bool{}
+	for _, httpRoute := range httpRoutes {
+		for _, rule := range httpRoute.Spec.Rules {
+			for _, backendRef := range rule.BackendRefs {
+				service, port, found, err := r.findBackendServicePort(ctx, httpRoute.Namespace, backendRef.BackendObjectReference)
+				if err != nil {
+					return nil, err
+				}
+				key := fmt.Sprintf("%s/%s/%s/%d", httpRoute.Name, service.Namespace, service.Name, port.Port)
+				if !found || seen[key] {
+					continue
+				}
+				seen[key] = true
+				name, spec, err := r.backendConfig(ctx, &ingress, service, port)
+				if err != nil {
+					return nil, err
+				}
+				if spec == nil {
+					continue
+				}
+				if r.BackendConfigPolicyTemplate == nil {
+					if !reported[name] {
+						reported[name] = true
+						r.warnBackendConfig(&ingress, service, name, spec)
+					}
+					continue
+				}
+
+				data := backendConfigData{
+					Namespace: httpRoute.Namespace, Ingress: ingress.Name,
+					Service: service.Name, Port: port.Port, BackendConfig: name, Spec: spec,
+				}
+				rendered, err := renderPolicies(r.BackendConfigPolicyTemplate, []gatewayv1.HTTPRoute{httpRoute}, func(httpRoute gatewayv1.HTTPRoute) any {
+					data.Route = httpRoute.Name
+					return data
+				})
+				if err != nil {
+					return nil, err
+				}
+				policies = append(policies, rendered...)
+			}
+		}
+	}
+	return policies, nil
+}
+
+// ensureBackendConfigPolicies creates or updates the BackendConfig policies of the HTTPRoutes of the Ingress
+func (r *IngressReconciler) ensureBackendConfigPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	policies, err := r.BackendConfigPolicies(ctx, ingress, httpRoutes)
+	if err != nil {
+		return err
+	}
+	return r.ensurePolicies(ctx, ingress, policies)
+}
+
+// warnBackendConfig emits an Event listing the features of the BackendConfig of a Service, which are lost
+func (r *IngressReconciler) warnBackendConfig(ingress *networkingv1.Ingress, service corev1.Service, name string, spec map[string]any) {
+	features := make([]string, 0, len(spec))
+	for feature := range spec {
+		features = append(features, feature)
+	}
+	slices.Sort(features)
+	r.event(ingress, corev1.EventTypeWarning, "UnsupportedBackendConfig",
+		fmt.Sprintf("BackendConfig %s of Service %s configures %s, which have no Gateway API equivalent",
+			name, service.Name, strings.Join(features, ", ")))
+}
+
+// backendConfig returns the name and spec of the BackendConfig of a Service port, or a nil spec if it has none. An
+// invalid annotation or a BackendConfig that does not exist is reported with an Event.
+func (r *IngressReconciler) backendConfig(ctx context.Context, ingress *networkingv1.Ingress, service corev1.Service, port corev1.ServicePort) (string, map[string]any, error) {
+	value, ok := service.Annotations[gceBackendConfigAnnotation]
+	if !ok {
+		if value, ok = service.Annotations[gceBetaBackendConfigAnnotation]; !ok {
+			return "", nil, nil
+		}
+	}
+	var configs gceBackendConfigs
+	if err := json.Unmarshal([]byte(value), &configs); err != nil {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidBackendConfig",
+			fmt.Sprintf("BackendConfig annotation of Service %s is not valid JSON and is ignored: %v", service.Name, err))
+		return "", nil, nil
+	}
+
+	// A BackendConfig of the port, by number or name, wins over the default one
+	name := configs.Default
+	if config, ok := configs.Ports[strconv.Itoa(int(port.Port))]; ok {
+		name = config
+	} else if config, ok := configs.Ports[port.Name]; ok && port.Name != "" {
+		name = config
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+
+	config := &unstructured.Unstructured{}
+	config.SetGroupVersionKind(backendConfigGVK)
+	if err := r.Get(ctx, types.NamespacedName{Namespace: service.Namespace, Name: name}, config); err != nil {
+		if !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return "", nil, err
+		}
+		r.event(ingress, corev1.EventTypeWarning, "InvalidBackendConfig",
+			fmt.Sprintf("BackendConfig %s of Service %s does not exist", name, service.Name))
+		return "", nil, nil
+	}
+	spec, _, _ := unstructured.NestedMap(config.Object, "spec")
+	if len(spec) == 0 {
+		return "", nil, nil
+	}
+	return name, spec, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+const testBackendConfigPolicyTemplate = `apiVersion: networking.gke.io/v1
+kind: GCPBackendPolicy
+metadata:
+  name: "{{ .Service }}-{{ .Port }}"
+spec:
+  targetRef:
+    group: ""
+    kind: Service
+    name: "{{ .Service }}"
+  default:
+    timeoutSec: {{ .Spec.timeoutSec }}
+`
+
+func TestGCEWildcardPath(t *testing.T) {
+	for path, expected := range map[string]string{"/*": "/", "/static/*": "/static/"} {
+		match, ok := gceWildcardPath(networkingv1.HTTPIngressPath{
+			Path: path, PathType: ptr.To(networkingv1.PathTypeImplementationSpecific),
+		})
+		if !ok || *match.Type != gatewayv1.PathMatchPathPrefix || *match.Value != expected {
+			t.Errorf("expected %s to become a prefix of %s, got %v", path, expected, match)
+		}
+	}
+	for _, path := range []networkingv1.HTTPIngressPath{
+		{Path: "/static", PathType: ptr.To(networkingv1.PathTypeImplementationSpecific)},
+		{Path: "/static/*", PathType: ptr.To(networkingv1.PathTypePrefix)},
+	} {
+		if _, ok := gceWildcardPath(path); ok {
+			t.Errorf("expected %s of type %s to be no wildcard path", path.Path, *path.PathType)
+		}
+	}
+}
+
+func TestBackendConfigPolicies(t *testing.T) {
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1234"}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{
+			gceBackendConfigAnnotation: `{"default":"missing","ports":{"http":"web-config"}}`,
+		}},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "admin", Port: 9090}}},
+	}
+	config := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": "web-config", "namespace": "default"},
+		"spec":     map[string]any{"timeoutSec": int64(40), "cdn": map[string]any{"enabled": true}},
+	}}
+	config.SetGroupVersionKind(backendConfigGVK)
+	backendRef := func(port gatewayv1.PortNumber) gatewayv1.HTTPBackendRef {
+		return gatewayv1.HTTPBackendRef{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{
+			Name: "web", Port: ptr.To(port),
+		}}}
+	}
+	httpRoutes := []gatewayv1.HTTPRoute{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-example-com",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{createOwnerReference(ingress)},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{Rules: []gatewayv1.HTTPRouteRule{
+			{BackendRefs: []gatewayv1.HTTPBackendRef{backendRef(80)}},
+			{BackendRefs: []gatewayv1.HTTPBackendRef{backendRef(80), backendRef(9090)}},
+		}},
+	}}
+
+	// Without a template the features are only reported, the default BackendConfig of the other port does not exist
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(service, config).Build(),
+		Recorder: recorder,
+	}
+	if policies, err := r.BackendConfigPolicies(context.Background(), ingress, httpRoutes); err != nil || policies != nil {
+		t.Errorf("expected no policies without a template, got %v, %v", policies, err)
+	}
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedBackendConfig") || !strings.Contains(event, "cdn, timeoutSec") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidBackendConfig") || !strings.Contains(event, "missing") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	r.BackendConfigPolicyTemplate = template.Must(template.New("policy").Option("missingkey=error").Parse(testBackendConfigPolicyTemplate))
+	policies, err := r.BackendConfigPolicies(context.Background(), ingress, httpRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("expected 1 policy, got %d", len(policies))
+	}
+	policy := policies[0]
+	if policy.GetName() != "web-80" || !isEqual(policy.GetOwnerReferences(), []metav1.OwnerReference{createRouteOwnerReference(httpRoutes[0])}) {
+		t.Errorf("expected the policy to be named after the Service port and owned by the HTTPRoute, got %+v", policy.Object["metadata"])
+	}
+	if timeout, _, _ := unstructured.NestedInt64(policy.Object, "spec", "default", "timeoutSec"); timeout != 40 {
+		t.Errorf("expected a timeout of 40 seconds, got %d", timeout)
+	}
+}
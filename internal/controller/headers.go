@@ -0,0 +1,188 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// requestHeadersAddAnnotation adds headers to the requests, one `Name: value` per line
+	requestHeadersAddAnnotation = DefaultAnnotationPrefix + "request-headers-add"
+	// requestHeadersSetAnnotation overwrites headers of the requests, one `Name: value` per line
+	requestHeadersSetAnnotation = DefaultAnnotationPrefix + "request-headers-set"
+	// requestHeadersRemoveAnnotation removes the comma-separated headers from the requests
+	requestHeadersRemoveAnnotation = DefaultAnnotationPrefix + "request-headers-remove"
+	// responseHeadersAddAnnotation adds headers to the responses, one `Name: value` per line
+	responseHeadersAddAnnotation = DefaultAnnotationPrefix + "response-headers-add"
+	// responseHeadersSetAnnotation overwrites headers of the responses, one `Name: value` per line
+	responseHeadersSetAnnotation = DefaultAnnotationPrefix + "response-headers-set"
+	// responseHeadersRemoveAnnotation removes the comma-separated headers from the responses
+	responseHeadersRemoveAnnotation = DefaultAnnotationPrefix + "response-headers-remove"
+
+	// maxHeaderModifications is the maximum number of headers a header filter adds, sets or removes each
+	maxHeaderModifications = 16
+)
+
+// headerNamePattern matches the header names the Gateway API accepts
+var headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+\\-.^_`|~]+$")
+
+// headerFilters returns the RequestHeaderModifier and ResponseHeaderModifier filters of the header annotations of
+// the Ingress, giving users a way to modify headers without the snippets of an Ingress controller. Invalid entries
+// are left out with an Event.
+func (r *IngressReconciler) headerFilters(ingress *networkingv1.Ingress) []gatewayv1.HTTPRouteFilter {
+	var filters []gatewayv1.HTTPRouteFilter
+	if modifier := r.headerModifier(ingress, requestHeadersAddAnnotation, requestHeadersSetAnnotation, requestHeadersRemoveAnnotation); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                  gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: modifier,
+		})
+	}
+	if modifier := r.headerModifier(ingress, responseHeadersAddAnnotation, responseHeadersSetAnnotation, responseHeadersRemoveAnnotation); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: modifier,
+		})
+	}
+	return filters
+}
+
+// headerModifier returns the header modifications of the add, set and remove annotations, or nil if there are none
+func (r *IngressReconciler) headerModifier(ingress *networkingv1.Ingress, add, set, remove string) *gatewayv1.HTTPHeaderFilter {
+	modifier := &gatewayv1.HTTPHeaderFilter{
+		Add:    r.parseHeaders(ingress, r.annotation(add)),
+		Set:    r.parseHeaders(ingress, r.annotation(set)),
+		Remove: r.parseHeaderNames(ingress, r.annotation(remove)),
+	}
+	if len(modifier.Add) == 0 && len(modifier.Set) == 0 && len(modifier.Remove) == 0 {
+		return nil
+	}
+	return modifier
+}
+
+// parseHeaders returns the headers of the annotation, one `Name: value` per line. Lines without a valid name, repeated
+// names and lines beyond the maximum are left out with an Event.
+func (r *IngressReconciler) parseHeaders(ingress *networkingv1.Ingress, annotation string) []gatewayv1.HTTPHeader {
+	var headers []gatewayv1.HTTPHeader
+	var invalid []string
+	for _, line := range strings.Split(ingress.Annotations[annotation], "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		repeated := slices.ContainsFunc(headers, func(header gatewayv1.HTTPHeader) bool {
+			return strings.EqualFold(string(header.Name), name)
+		})
+		if !found || !headerNamePattern.MatchString(name) || repeated || len(headers) == maxHeaderModifications {
+			invalid = append(invalid, fmt.Sprintf("%q", line))
+			continue
+		}
+		headers = append(headers, gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(name), Value: strings.TrimSpace(value)})
+	}
+	r.warnInvalidHeaders(ingress, annotation, invalid)
+	return headers
+}
+
+// parseHeaderNames returns the comma-separated header names of the annotation. Invalid and repeated names and names
+// beyond the maximum are left out with an Event.
+func (r *IngressReconciler) parseHeaderNames(ingress *networkingv1.Ingress, annotation string) []string {
+	var names []string
+	var invalid []string
+	for _, name := range splitList(ingress.Annotations[annotation]) {
+		repeated := slices.ContainsFunc(names, func(other string) bool { return strings.EqualFold(other, name) })
+		if !headerNamePattern.MatchString(name) || repeated || len(names) == maxHeaderModifications {
+			invalid = append(invalid, fmt.Sprintf("%q", name))
+			continue
+		}
+		names = append(names, name)
+	}
+	r.warnInvalidHeaders(ingress, annotation, invalid)
+	return names
+}
+
+// warnInvalidHeaders emits an Event for the entries of the header annotation that are left out
+func (r *IngressReconciler) warnInvalidHeaders(ingress *networkingv1.Ingress, annotation string, invalid []string) {
+	if len(invalid) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidHeaderAnnotation",
+			fmt.Sprintf("Entries %s of %s are not valid or repeated headers, or exceed the maximum of %d, and are "+
+				"left out", strings.Join(invalid, ", "), annotation, maxHeaderModifications))
+	}
+}
+
+// mergeHeaderFilters merges the RequestHeaderModifier filters of a rule into the first one, as are its
+// ResponseHeaderModifier filters, as a rule may have only one of each. A header of a later filter replaces that of
+// an earlier one.
+func mergeHeaderFilters(filters []gatewayv1.HTTPRouteFilter) []gatewayv1.HTTPRouteFilter {
+	var result []gatewayv1.HTTPRouteFilter
+	merged := map[gatewayv1.HTTPRouteFilterType]*gatewayv1.HTTPHeaderFilter{}
+	for _, filter := range filters {
+		var modifier *gatewayv1.HTTPHeaderFilter
+		switch filter.Type {
+		case gatewayv1.HTTPRouteFilterRequestHeaderModifier:
+			modifier = filter.RequestHeaderModifier
+		case gatewayv1.HTTPRouteFilterResponseHeaderModifier:
+			modifier = filter.ResponseHeaderModifier
+		}
+		if modifier == nil {
+			result = append(result, filter)
+			continue
+		}
+		into, ok := merged[filter.Type]
+		if !ok {
+			// Copied, as the filter may be shared by other rules
+			filter = *filter.DeepCopy()
+			if filter.RequestHeaderModifier != nil {
+				merged[filter.Type] = filter.RequestHeaderModifier
+			} else {
+				merged[filter.Type] = filter.ResponseHeaderModifier
+			}
+			result = append(result, filter)
+			continue
+		}
+		into.Add = mergeHeaders(into.Add, modifier.Add)
+		into.Set = mergeHeaders(into.Set, modifier.Set)
+		for _, name := range modifier.Remove {
+			if !slices.ContainsFunc(into.Remove, func(other string) bool { return strings.EqualFold(other, name) }) {
+				into.Remove = append(into.Remove, name)
+			}
+		}
+	}
+	return result
+}
+
+// mergeHeaders returns the headers with the other headers added, replacing the headers of the same name
+func mergeHeaders(headers, others []gatewayv1.HTTPHeader) []gatewayv1.HTTPHeader {
+	for _, other := range others {
+		index := slices.IndexFunc(headers, func(header gatewayv1.HTTPHeader) bool {
+			return strings.EqualFold(string(header.Name), string(other.Name))
+		})
+		if index >= 0 {
+			headers[index] = other
+		} else {
+			headers = append(headers, other)
+		}
+	}
+	return headers
+}
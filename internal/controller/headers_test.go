@@ -0,0 +1,101 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestHeaderFilters(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		requestHeadersAddAnnotation:     "X-Source: edge\n\nX-Via: a:b",
+		requestHeadersRemoveAnnotation:  "X-Debug, x-debug, bad header",
+		responseHeadersSetAnnotation:    "Cache-Control: no-store\nmissing-colon",
+		responseHeadersRemoveAnnotation: "",
+	}}}
+
+	expected := []gatewayv1.HTTPRouteFilter{
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Add:    []gatewayv1.HTTPHeader{{Name: "X-Source", Value: "edge"}, {Name: "X-Via", Value: "a:b"}},
+				Remove: []string{"X-Debug"},
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set: []gatewayv1.HTTPHeader{{Name: "Cache-Control", Value: "no-store"}},
+			},
+		},
+	}
+	if filters := r.headerFilters(ingress); !isEqual(filters, expected) {
+		t.Errorf("unexpected filters: %+v", filters)
+	}
+	for range 2 {
+		if event := <-recorder.Events; !strings.Contains(event, "InvalidHeaderAnnotation") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+
+	if filters := r.headerFilters(&networkingv1.Ingress{}); filters != nil {
+		t.Errorf("expected no filters, got %+v", filters)
+	}
+}
+
+func TestMergeHeaderFilters(t *testing.T) {
+	prefix := gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set: []gatewayv1.HTTPHeader{{Name: "X-Forwarded-Prefix", Value: "/app"}},
+		},
+	}
+	redirect := gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect}
+	headers := gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set:    []gatewayv1.HTTPHeader{{Name: "x-forwarded-prefix", Value: "/web"}, {Name: "X-Env", Value: "prod"}},
+			Remove: []string{"X-Debug"},
+		},
+	}
+
+	expected := []gatewayv1.HTTPRouteFilter{
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set:    []gatewayv1.HTTPHeader{{Name: "x-forwarded-prefix", Value: "/web"}, {Name: "X-Env", Value: "prod"}},
+				Remove: []string{"X-Debug"},
+			},
+		},
+		redirect,
+	}
+	if filters := mergeHeaderFilters([]gatewayv1.HTTPRouteFilter{prefix, redirect, headers}); !isEqual(filters, expected) {
+		t.Errorf("unexpected filters: %+v", filters)
+	}
+	// The filters may be shared by other rules, so they are left as they are
+	if value := prefix.RequestHeaderModifier.Set[0].Value; value != "/app" {
+		t.Errorf("expected the merged filter to be copied, got %s", value)
+	}
+}
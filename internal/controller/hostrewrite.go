@@ -0,0 +1,84 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ParseHostnameRewrites parses a comma-separated list of old=new hostname pairs, e.g.
+// app.example.com=app.example.net. A wildcard hostname can only be rewritten to another wildcard hostname.
+func ParseHostnameRewrites(value string) (map[string]string, error) {
+	rewrites := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		from, to, found := strings.Cut(strings.TrimSpace(item), "=")
+		from, to = canonicalHostname(strings.TrimSpace(from)), canonicalHostname(strings.TrimSpace(to))
+		if !found || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid hostname rewrite %q, must be old=new", item)
+		}
+		for _, hostname := range []string{from, to} {
+			if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(hostname, "*.")); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid hostname %q in rewrite %q: %s", hostname, item, strings.Join(errs, ", "))
+			}
+		}
+		if strings.HasPrefix(from, "*.") != strings.HasPrefix(to, "*.") {
+			return nil, fmt.Errorf("invalid hostname rewrite %q, a wildcard hostname must be rewritten to a wildcard hostname", item)
+		}
+		rewrites[from] = to
+	}
+	return rewrites, nil
+}
+
+// rewriteHostnames returns a copy of the Ingress whose hosts in spec.rules and spec.tls are rewritten according to
+// HostnameRewrites, so the HTTPRoutes and the listeners they attach to use the new hostnames. Hosts are only
+// rewritten on an exact match of their canonical form, the Ingress in the cluster is left untouched.
+func (r *IngressReconciler) rewriteHostnames(ingress networkingv1.Ingress) networkingv1.Ingress {
+	if len(r.HostnameRewrites) == 0 {
+		return ingress
+	}
+
+	rewritten := ingress.DeepCopy()
+	for i, rule := range rewritten.Spec.Rules {
+		if hostname, ok := r.HostnameRewrites[canonicalHostname(rule.Host)]; ok {
+			rewritten.Spec.Rules[i].Host = hostname
+		}
+	}
+	for i, tls := range rewritten.Spec.TLS {
+		for j, host := range tls.Hosts {
+			if hostname, ok := r.HostnameRewrites[canonicalHostname(host)]; ok {
+				rewritten.Spec.TLS[i].Hosts[j] = hostname
+			}
+		}
+	}
+	return *rewritten
+}
+
+// indexRewrittenIngressHosts returns the host index keys of an Ingress after rewriting its hosts, so Gateway changes
+// enqueue the Ingresses whose HTTPRoutes are attached to the new hostnames
+func (r *IngressReconciler) indexRewrittenIngressHosts(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	rewritten := r.rewriteHostnames(*ingress)
+	return indexIngressHosts(&rewritten)
+}
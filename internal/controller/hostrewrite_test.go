@@ -0,0 +1,65 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestParseHostnameRewrites(t *testing.T) {
+	rewrites, err := ParseHostnameRewrites("App.Example.com=app.example.net, *.example.com=*.example.net")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"app.example.com": "app.example.net", "*.example.com": "*.example.net"}
+	if !isEqual(rewrites, expected) {
+		t.Errorf("expected %v, got %v", expected, rewrites)
+	}
+
+	for _, value := range []string{"app.example.com", "app.example.com=", "app_example.com=app.example.net", "*.example.com=app.example.net"} {
+		if _, err := ParseHostnameRewrites(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestRewriteHostnames(t *testing.T) {
+	r := &IngressReconciler{HostnameRewrites: map[string]string{"app.example.com": "app.example.net"}}
+	ingress := networkingv1.Ingress{Spec: networkingv1.IngressSpec{
+		Rules: []networkingv1.IngressRule{{Host: "app.example.com"}, {Host: "api.example.com"}},
+		TLS:   []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}}},
+	}}
+
+	rewritten := r.rewriteHostnames(ingress)
+	if rewritten.Spec.Rules[0].Host != "app.example.net" || rewritten.Spec.Rules[1].Host != "api.example.com" {
+		t.Errorf("expected only app.example.com to be rewritten, got %+v", rewritten.Spec.Rules)
+	}
+	if rewritten.Spec.TLS[0].Hosts[0] != "app.example.net" {
+		t.Errorf("expected the TLS host to be rewritten, got %v", rewritten.Spec.TLS[0].Hosts)
+	}
+	if ingress.Spec.Rules[0].Host != "app.example.com" || ingress.Spec.TLS[0].Hosts[0] != "app.example.com" {
+		t.Errorf("expected the source Ingress to be left untouched")
+	}
+
+	keys := r.indexRewrittenIngressHosts(&ingress)
+	if !slices.Contains(keys, "app.example.net") || slices.Contains(keys, "app.example.com") {
+		t.Errorf("expected the index keys of the new hostname, got %v", keys)
+	}
+}
@@ -20,36 +20,239 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/ptr"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayxv1alpha1 "sigs.k8s.io/gateway-api/apisx/v1alpha1"
 
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// ownerAnnotation records the owning Ingress, or other converted source, on HTTPRoutes created in a target
+// cluster or another namespace, see ownerAnnotationValue
+const ownerAnnotation = "ingress2httproute.lion7.dev/owner"
+
+// ingressHostIndex is the field index of Ingresses by the keys of their hosts, see hostnameIndexKeys
+const ingressHostIndex = "spec.rules.host"
+
+const (
+	// gatewayHostIndex is the field index of Gateways by the keys of their listener hostnames, see listenerIndexKeys
+	gatewayHostIndex = "spec.listeners.hostname"
+	// catchAllListenerKey is the key of the listeners without hostname in the Gateway host index
+	catchAllListenerKey = "*"
+)
+
+const (
+	// routesAnnotation lists the names of the routes generated for an Ingress
+	routesAnnotation = "ingress2httproute.lion7.dev/routes"
+	// versionAnnotation is the version of the controller that generated the HTTPRoutes
+	versionAnnotation = "ingress2httproute.lion7.dev/version"
+	// convertedAtAnnotation is the time the generated HTTPRoutes last changed
+	convertedAtAnnotation = "ingress2httproute.lion7.dev/converted-at"
 )
 
 // IngressReconciler reconciles an Ingress object
 type IngressReconciler struct {
 	client.Client
-	Scheme          *runtime.Scheme
-	RequireHostname bool
+	Scheme             *runtime.Scheme
+	RequireHostname    bool
+	CollapseParentRefs bool
+	ListenerPorts      []int32
+	// ParentRefStrategy selects whether HTTPRoutes reference matching listeners, their ports or whole Gateways,
+	// listeners if unset
+	ParentRefStrategy ParentRefStrategy
+	// GatewayClasses, if set, only lets HTTPRoutes attach to the Gateways of these GatewayClasses,
+	// so the Gateways of other implementations in the cluster are ignored.
+	GatewayClasses []gatewayv1.ObjectName
+	// ListenerSets lets HTTPRoutes attach to the listeners of XListenerSets like to those of their parent Gateways
+	ListenerSets bool
+	// RequireReadyGateways only lets HTTPRoutes attach to the Gateways reporting both Accepted and Programmed,
+	// so Gateways that are misconfigured or cannot be scheduled are skipped until they are.
+	RequireReadyGateways bool
+	// SupportedFeatures adapts the HTTPRoutes to the status.supportedFeatures of the GatewayClasses of their
+	// Gateways, leaving out what the Gateways do not support.
+	SupportedFeatures bool
+	// DefaultGateway is the Gateway, as namespace/name or namespace/name/listener, the HTTPRoutes of a hostname
+	// that matches no listener attach to instead of being skipped.
+	DefaultGateway string
+	// ListenerProtocols are the protocols of the listeners HTTPRoutes attach to, HTTP and HTTPS if unset.
+	// Implementations with their own HTTP-based protocols can add them.
+	ListenerProtocols []gatewayv1.ProtocolType
+	RoutePerParent    bool
+	// DisableServiceLookups prevents named Service ports from being resolved,
+	// so the controller never reads Services and needs no RBAC for them.
+	DisableServiceLookups bool
+	// IngressClasses limits the conversion to the Ingresses of these IngressClasses, all Ingresses are converted
+	// if unset. Ingresses of other classes are left alone, together with the HTTPRoutes generated for them before.
+	IngressClasses []string
+	// TargetCluster, if set, is the cluster Gateways are read from and HTTPRoutes are
+	// written to, while Ingresses and Services are still read through Client.
+	TargetCluster cluster.Cluster
+	// MaxConcurrentReconciles and RateLimiter tune the controller, the controller-runtime defaults are used if unset
+	MaxConcurrentReconciles int
+	RateLimiter             workqueue.TypedRateLimiter[reconcile.Request]
+	// CanaryBackends splits the traffic of a Service over its stable and canary Services
+	// when they are managed by Argo Rollouts or Flagger.
+	CanaryBackends bool
+	// ConvertAcmeSolvers converts the Ingresses cert-manager creates to solve HTTP01 challenges,
+	// instead of leaving them to the Ingress controller.
+	ConvertAcmeSolvers bool
+	// AnnotateIngress records the generated HTTPRoutes, the Version and the time of the conversion
+	// in annotations on the Ingress.
+	AnnotateIngress bool
+	// Version is the version of the controller recorded on the Ingress with AnnotateIngress, so the conversion time is
+	// updated after an upgrade too.
+	Version string
+	// RetireSource deletes the Ingress or strips its class once all its HTTPRoutes are accepted.
+	// With RetireRequiresVerification, the Ingress must also be annotated as verified, and with
+	// RetireRequiresConvertible it must not have unconvertible annotations, such as nginx snippets.
+	RetireSource               RetireMode
+	RetireRequiresVerification bool
+	RetireRequiresConvertible  bool
+	// MaxRoutesPerNamespace limits the number of routes generated in a namespace, 0 means unlimited.
+	// The ConversionPolicy overrides it, and Namespaces can override both with an annotation.
+	MaxRoutesPerNamespace int
+	ConversionPolicy      *ConversionPolicy
+	// CrossNamespaceBackends references the Service an ExternalName Service points to in another namespace,
+	// if a ReferenceGrant allows it. With AutoGrant, the ReferenceGrants are created instead.
+	CrossNamespaceBackends bool
+	AutoGrant              bool
+	// GatewayNamespaceRoutes creates the HTTPRoutes in the namespaces of their Gateways instead of the namespace of
+	// the Ingress, together with the ReferenceGrants that allow them to reference the backends of the Ingress.
+	GatewayNamespaceRoutes bool
+	// TLSListeners attaches the hostnames listed under spec.tls only to HTTPS listeners, preferring those that
+	// terminate TLS with the Secret of the Ingress. TLSRedirect implies it, and also redirects their HTTP listeners.
+	TLSListeners bool
+	TLSRedirect  bool
+	// DefaultBackendRule routes the requests no path matches to the default backend of the Ingress,
+	// with a catch-all rule in every generated HTTPRoute. Ingresses can override it with an annotation.
+	DefaultBackendRule bool
+	// RuleNames names every generated rule after the Ingress, hostname and index of the path it was converted from,
+	// so operators and policies can refer to it. Rule names are part of the experimental channel.
+	RuleNames bool
+	// ConsolidateRules merges the rules that only differ in their path, e.g. paths sharing a backend, into one rule
+	// with multiple matches, so large Ingresses need fewer and smaller HTTPRoutes.
+	ConsolidateRules bool
+	// StrictPrefixMatching adds an Exact match without the trailing slash to the PathPrefix matches of paths with
+	// one, as an Ingress Prefix path ignores the trailing slash and Gateways do not always.
+	StrictPrefixMatching bool
+	// HostnameRewrites maps Ingress hosts to the hostnames of their HTTPRoutes, e.g. to migrate to a new domain.
+	// The listeners are matched against the new hostnames, the Ingresses themselves are not changed.
+	HostnameRewrites map[string]string
+	// ImplementationSpecificPathType is the path match type of ImplementationSpecific paths, RegularExpression if
+	// unset. Ingress controllers interpret them differently, so it can be overridden per IngressClass.
+	ImplementationSpecificPathType          PathTypePolicy
+	ImplementationSpecificPathTypeOverrides map[string]PathTypePolicy
+	// BackendWeight is the weight of the backend refs of Ingress paths, 1 if unset. With OmitBackendWeights,
+	// the weight is left out instead, so the HTTPRoutes resemble hand-written ones.
+	BackendWeight      *int32
+	OmitBackendWeights bool
+	// OmitTimeouts leaves out the timeouts converted from the proxy timeout annotations of nginx, for Gateways that
+	// do not support HTTPRoute timeouts.
+	OmitTimeouts bool
+	// SessionPersistence converts the cookie affinity of nginx to the sessionPersistence of the rules, which is part
+	// of the experimental channel. It is left out for GatewayClasses not advertising it with SupportedFeatures.
+	SessionPersistence bool
+	// RetryPolicies converts the retry policies of the sources other than Ingresses to the retry of their rules,
+	// which is part of the experimental channel. It is left out for GatewayClasses not advertising it with
+	// SupportedFeatures.
+	RetryPolicies bool
+	// AppProtocolBackends converts HTTPRoutes whose backends all serve gRPC, according to the appProtocol of their
+	// Service ports, to GRPCRoutes, and creates a BackendTLSPolicy for Services serving HTTPS.
+	AppProtocolBackends bool
+	// TLSPassthroughRoutes converts the hosts of Ingresses with nginx's ssl-passthrough to TLSRoutes attached to TLS
+	// listeners in Passthrough mode, which are part of the experimental channel, instead of HTTPRoutes
+	TLSPassthroughRoutes bool
+	// BackendTLSCACertificates is the ConfigMap in the namespace of each Service serving HTTPS with the CA
+	// certificates its BackendTLSPolicy validates the certificate of the Service against, the system CAs if unset
+	BackendTLSCACertificates string
+	// ConversionProfiles converts the Ingresses of known Ingress controllers with their profile, selected by the
+	// IngressClass of the Ingress. ProfileGatewayClasses limits the Gateways of a profile to a GatewayClass.
+	ConversionProfiles    bool
+	ProfileGatewayClasses map[string]gatewayv1.ObjectName
+	// MergeHosts merges the rules of all Ingresses in a namespace declaring the same hostname into one
+	// HTTPRoute per hostname, owned by all of them. It cannot be used with a TargetCluster.
+	MergeHosts bool
+	// TraefikMiddlewareFilters adds an ExtensionRef filter to the rules of an Ingress for each Traefik Middleware in
+	// its namespace it references, which only the Gateway provider of Traefik accepts
+	TraefikMiddlewareFilters bool
+	// ExtensionRefMappings add ExtensionRef filters to the rules of Ingresses with the mapped annotations
+	ExtensionRefMappings []ExtensionRefMapping
+	// SourceRangePolicyTemplate renders a vendor policy restricting the source ranges of each HTTPRoute of an
+	// Ingress with an IP allow-list, which is only reported in an Event if unset
+	SourceRangePolicyTemplate *template.Template
+	// RateLimitPolicyTemplate renders a vendor policy limiting the requests to each HTTPRoute of an Ingress with
+	// rate limits, which are only reported in an Event if unset
+	RateLimitPolicyTemplate *template.Template
+	// BackendConfigPolicyTemplate renders a vendor policy for each Service port of the HTTPRoutes of an Ingress with
+	// a GKE BackendConfig, whose features are only reported in an Event if unset
+	BackendConfigPolicyTemplate *template.Template
+	// AnnotationPolicies render vendor policies for the HTTPRoutes of Ingresses with the annotations they are keyed by
+	AnnotationPolicies []AnnotationPolicy
+	// ExternalDNSAnnotations are the names of the external-dns annotations, without the external-dns.alpha.kubernetes.io/
+	// prefix, copied from the Ingresses onto their HTTPRoutes
+	ExternalDNSAnnotations []string
+	// AnnotationPrefix is the prefix of the annotations the controller recognizes on Ingresses and Namespaces, e.g.
+	// to pin a Gateway or modify headers, DefaultAnnotationPrefix if unset. The annotations and labels the controller
+	// writes itself keep the default prefix, so existing HTTPRoutes stay owned.
+	AnnotationPrefix string
+	audit.Auditor
+	// Recorder emits Events on Ingresses, no Events are emitted if unset
+	Recorder record.EventRecorder
+
+	// completeSourceRules completes the rules converted from the Ingress a source is mapped to with what the Ingress
+	// cannot express, before they are adapted to the supported features. It is set by the converters of sources.
+	completeSourceRules func(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) error
+	// hostIndexed is set once the host index is registered, so Ingresses sharing a host are looked up in it
+	hostIndexed bool
+	// gatewayHostIndexed is set once the Gateway host index is registered, so the Gateways of an Ingress are
+	// looked up in it instead of listing all of them
+	gatewayHostIndexed bool
 }
 
-// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingressclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=grpcroutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=tlsroutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=backendtlspolicies,verbs=get;list;watch;create
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cloud.google.com,resources=backendconfigs,verbs=get
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -58,54 +261,387 @@ type IngressReconciler struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.0/pkg/reconcile
 func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+	ctx = audit.WithIngress(ctx, req.NamespacedName)
 
 	ingress := networkingv1.Ingress{}
 	if err := r.Get(ctx, req.NamespacedName, &ingress); err != nil {
 		if errors.IsNotFound(err) {
+			if r.ConvertAcmeSolvers && r.TargetCluster != nil {
+				return ctrl.Result{}, r.deleteAcmeSolverRoutes(audit.WithReason(ctx, audit.ReasonSolverDeleted), req.NamespacedName)
+			}
+			// The deletion of the routes of a deleted Ingress enqueues it, their ReferenceGrants may be stale now
+			if r.grantsBackends() {
+				return ctrl.Result{}, r.deleteStaleReferenceGrants(audit.WithReason(ctx, audit.ReasonRouteStale))
+			}
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, fmt.Sprintf("cannot reconcile Ingress %s", req.NamespacedName))
 		return ctrl.Result{}, err
 	}
 
-	var gateways gatewayv1.GatewayList
-	if err := r.List(ctx, &gateways); err != nil {
+	// The HTTPRoutes outside the namespace of the Ingress or in the target cluster are not garbage collected, even of
+	// another IngressClass
+	if !ingress.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&ingress, routesFinalizer) {
+			return ctrl.Result{}, r.finalizeIngress(audit.WithReason(ctx, audit.ReasonIngressFinalized), ingress)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// The Ingresses of other IngressClasses are migrated separately, if at all
+	matches, err := r.MatchesIngressClass(ctx, ingress)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !matches {
+		logger.V(1).Info("skipping Ingress of another IngressClass", "class", ingressClass(ingress))
+		return ctrl.Result{}, nil
+	}
+
+	// A paused Ingress keeps its routes as they are, including changes made to them by hand
+	if r.isPaused(ingress) {
+		logger.V(1).Info("skipping paused Ingress")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := r.lookupGateways(ctx, ingress)
+	if err != nil {
 		logger.Error(err, "cannot list gateways")
 		return ctrl.Result{}, err
 	}
+	gateways = r.candidateGateways(gateways)
+
+	if r.placesRoutes() {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), &ingress); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The HTTPRoutes of the hostnames that can be converted are reconciled even if others fail
+	httpRoutes, convertErr := r.Convert(ctx, ingress, gateways)
+	tlsRoutes, err := r.TLSRoutes(ctx, ingress, gateways)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.applyRoutes(ctx, ingress, gateways, httpRoutes, tlsRoutes, convertErr)
+}
+
+// applyRoutes creates or updates the routes converted from the Ingress together with their policies, and unless
+// the conversion failed, deletes the stale routes and annotates or retires the Ingress
+func (r *IngressReconciler) applyRoutes(ctx context.Context, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList, httpRoutes []gatewayv1.HTTPRoute, tlsRoutes []gatewayv1alpha2.TLSRoute, convertErr error) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	httpRoutes, grpcRoutes, err := r.SplitGRPCRoutes(ctx, httpRoutes)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureBackendTLSPolicies(audit.WithReason(ctx, audit.ReasonBackendTLSRequired), ingress, httpRoutes); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Create or update the HTTPRoutes for this Ingress
+	owner := createOwnerReference(ingress)
+	for i, httpRoute := range httpRoutes {
+		name, collided, err := r.resolveHTTPRouteName(ctx, httpRoute, owner)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if collided {
+			logger.Info("HTTPRoute name belongs to another owner", "name", httpRoute.Name, "alternate", name)
+			r.event(&ingress, corev1.EventTypeWarning, "NameCollision",
+				fmt.Sprintf("HTTPRoute %s belongs to another owner, using %s instead", httpRoute.Name, name))
+		}
+		httpRoute.Name = name
+		httpRoutes[i].Name = name
+
+		if r.grantsBackends() {
+			if err := r.ensureReferenceGrants(audit.WithReason(ctx, audit.ReasonReferenceGrantRequired), "HTTPRoute", httpRoute.Namespace, httpRouteBackends(httpRoute)); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if err := r.reconcileHTTPRoute(audit.WithReason(ctx, audit.ReasonIngressConverted), httpRoute, owner); err != nil {
+			if isRouteQuotaExceeded(err) {
+				return r.routeQuotaExceeded(ctx, &ingress, "HTTPRoute", httpRoute.Name, err), nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.ensureSourceRangePolicies(audit.WithReason(ctx, audit.ReasonSourceRangeRestricted), ingress, httpRoutes); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureRateLimitPolicies(audit.WithReason(ctx, audit.ReasonRateLimited), ingress, httpRoutes); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureBackendConfigPolicies(audit.WithReason(ctx, audit.ReasonBackendConfigured), ingress, httpRoutes); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureAnnotationPolicies(audit.WithReason(ctx, audit.ReasonAnnotationPolicy), ingress, httpRoutes); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, grpcRoute := range grpcRoutes {
+		if r.CrossNamespaceBackends && r.AutoGrant {
+			if err := r.ensureReferenceGrants(audit.WithReason(ctx, audit.ReasonReferenceGrantRequired), "GRPCRoute", grpcRoute.Namespace, grpcRouteBackends(grpcRoute)); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if err := r.reconcileGRPCRoute(audit.WithReason(ctx, audit.ReasonIngressConverted), grpcRoute, owner); err != nil {
+			if isRouteQuotaExceeded(err) {
+				return r.routeQuotaExceeded(ctx, &ingress, "GRPCRoute", grpcRoute.Name, err), nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
+	for _, tlsRoute := range tlsRoutes {
+		if err := r.reconcileTLSRoute(audit.WithReason(ctx, audit.ReasonIngressConverted), tlsRoute, owner); err != nil {
+			if isRouteQuotaExceeded(err) {
+				return r.routeQuotaExceeded(ctx, &ingress, "TLSRoute", tlsRoute.Name, err), nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The HTTPRoutes of the hostnames that failed are not stale, retry before anything is deleted or retired
+	if convertErr != nil {
+		return ctrl.Result{}, convertErr
+	}
+
+	// Without Gateways nothing is generated, keep the HTTPRoutes until they are back
+	if len(gateways.Items) > 0 {
+		if err := r.deleteStaleHTTPRoutes(audit.WithReason(ctx, audit.ReasonRouteStale), ingress, httpRoutes); err != nil {
+			return ctrl.Result{}, err
+		}
+		if r.AppProtocolBackends {
+			if err := r.deleteStaleGRPCRoutes(audit.WithReason(ctx, audit.ReasonRouteStale), ingress, grpcRoutes); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if r.TLSPassthroughRoutes {
+			if err := r.deleteStaleTLSRoutes(audit.WithReason(ctx, audit.ReasonRouteStale), ingress, tlsRoutes); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	if r.grantsBackends() {
+		if err := r.deleteStaleReferenceGrants(audit.WithReason(ctx, audit.ReasonRouteStale)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
+	if r.AnnotateIngress {
+		// Routes in the namespaces of their Gateways are recorded as namespace/name
+		names := make([]string, 0, len(httpRoutes)+len(grpcRoutes)+len(tlsRoutes))
+		for _, httpRoute := range httpRoutes {
+			names = append(names, routeName(ingress, &httpRoute))
+		}
+		for _, grpcRoute := range grpcRoutes {
+			names = append(names, routeName(ingress, &grpcRoute))
+		}
+		for _, tlsRoute := range tlsRoutes {
+			names = append(names, routeName(ingress, &tlsRoute))
+		}
+		if err := r.annotateIngress(audit.WithReason(ctx, audit.ReasonIngressAnnotated), ingress, names); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The acceptance of GRPCRoutes and TLSRoutes is not checked, Ingresses converted to them are never retired
+	if r.RetireSource != RetireNone && len(grpcRoutes) == 0 && len(tlsRoutes) == 0 {
+		if err := r.retireSource(audit.WithReason(ctx, audit.ReasonIngressRetired), ingress, httpRoutes); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// Convert maps an Ingress to the HTTPRoutes that should exist for it, given the available Gateways.
+// The HTTPRoutes are sorted by name and are owned by the Ingress; they are not created in the cluster.
+// Hostnames whose rules cannot be converted are skipped, their errors are aggregated into the returned error.
+func (r *IngressReconciler) Convert(ctx context.Context, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	logger := log.FromContext(ctx)
+
+	gateways = r.candidateGateways(gateways)
 	if len(gateways.Items) == 0 {
 		logger.Info("no gateways found")
-		return ctrl.Result{}, nil
+		return nil, nil
 	}
 
 	if len(ingress.Spec.Rules) == 0 {
 		logger.Info("no rules found")
-		return ctrl.Result{}, nil
+		return nil, nil
+	}
+
+	// The routes generated for a skipped Ingress before are stale
+	if r.isSkipped(ingress) {
+		logger.Info("skipping Ingress opted out of the conversion")
+		return nil, nil
+	}
+
+	// Solver Ingresses of cert-manager are left to the Ingress controller, unless they are converted as well
+	solver := isAcmeSolver(ingress)
+	if solver && !r.ConvertAcmeSolvers {
+		logger.Info("skipping ACME HTTP01 solver")
+		return nil, nil
+	}
+	if solver {
+		ingress = prepareAcmeSolver(ingress)
+	}
+
+	// Convert the Ingress as if it declared the new hostnames
+	ingress = r.rewriteHostnames(ingress)
+
+	// The profile of the Ingress controller may limit the Gateways to a GatewayClass
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil {
+		return nil, err
+	}
+	if profile.translates(nginxAnnotationPrefix) && isNginxCanary(ingress) {
+		logger.Info("skipping nginx canary, its backends are merged into the HTTPRoutes of its primary Ingress")
+		return nil, nil
+	}
+	if r.TLSPassthroughRoutes && profile.translates(nginxAnnotationPrefix) && sslPassthrough(ingress) {
+		logger.Info("skipping nginx ssl-passthrough, its hosts are converted to TLSRoutes")
+		return nil, nil
+	}
+	r.warnUnconvertibleAnnotations(profile, &ingress)
+	r.warnUnsupportedAnnotations(profile, &ingress)
+	if profile.translates(nginxAnnotationPrefix) {
+		r.warnUnmappedAuth(&ingress)
+	}
+	if profile.translates(agicAnnotationPrefix) {
+		r.warnUnsupportedAGIC(&ingress)
+	}
+	if gateways = profile.gateways(gateways); len(gateways.Items) == 0 {
+		logger.Info("no gateways found for conversion profile", "profile", profile.Name, "gatewayClass", profile.GatewayClassName)
+		return nil, nil
 	}
 
 	// Create owner reference early for reuse
 	owner := createOwnerReference(ingress)
 
+	// Filters added to every rule for the annotations of the Ingress
+	filters, err := r.ingressFilters(profile, ingress)
+	if err != nil {
+		return nil, err
+	}
+	if profile.translates(traefikAnnotationPrefix) {
+		r.warnTraefikPriority(&ingress)
+	}
+
 	// Group rules by hostname
 	ingressRules := groupRulesByHostname(ingress.Spec.Rules)
+	if ingress.Spec.DefaultBackend != nil && r.defaultBackendRule(ingress) {
+		for hostname, matchingRules := range ingressRules {
+			ingressRules[hostname] = withDefaultBackendRule(matchingRules, hostname, *ingress.Spec.DefaultBackend)
+		}
+	}
+
+	// Ingresses sharing a hostname with this one, whose rules are merged into the same HTTPRoute
+	var siblings []networkingv1.Ingress
+	if r.MergeHosts && !solver {
+		if siblings, err = r.listMergeSiblings(ctx, ingress); err != nil {
+			return nil, err
+		}
+	}
 
 	// Map gateways to parent refs, grouped by hostname
-	parentRefs := groupGatewaysByHostNameAndMapToParentRefs(ingress.Namespace, gateways)
+	namespace := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ingress.Namespace}}
+	if usesNamespaceSelector(gateways) {
+		if namespace, err = r.routeNamespace(ctx, ingress.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	parentRefs := groupGatewaysByHostNameAndMapToParentRefs(namespace, gateways, r.ListenerPorts, r.ListenerProtocols)
+	if r.GatewayNamespaceRoutes {
+		if parentRefs, err = r.gatewayNamespaceParentRefs(ctx, gateways); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unless the Ingress pins its HTTPRoutes to a Gateway, which may not be available
+	pinned, isPinned := r.pinnedParentRef(&ingress, gateways)
+	if isPinned && pinned == nil {
+		return nil, nil
+	}
 
 	// Create one HTTPRoute per hostname as per mapping specification
+	nameRoute := r.routeNamer(&ingress)
+	var result []gatewayv1.HTTPRoute
+	var hostnameErrs []error
 	for hostname, matchingRules := range ingressRules {
 		// Generate HTTPRoute name based on ingress name and hostname
-		routeName := types.NamespacedName{
-			Name:      generateHTTPRouteName(req.Name, hostname),
-			Namespace: req.Namespace,
+		routeName := nameRoute(hostname)
+
+		// Or share the HTTPRoute of the hostname with the other Ingresses declaring it
+		var merged []hostRules
+		tlsIngress := ingress
+		if siblings != nil && hostname != "" {
+			routeName = mergedHTTPRouteName(hostname)
+			merged = mergeRulesByHostname(siblings, hostname, r.defaultBackendRule)
+			for _, m := range merged {
+				if _, tls := findTLSSecret(m.ingress, hostname); tls {
+					tlsIngress = m.ingress
+					break
+				}
+			}
 		}
 
 		// Find parent refs matching this hostname
-		routeParentRefs := findMatchingGateways(hostname, parentRefs)
+		// Except the listeners a listener in the other TLS mode takes the connections of the hostname from
+		routeParentRefs := withoutShadowedListeners(findMatchingGateways(hostname, parentRefs), gateways, hostname)
+		if profile.translates(traefikAnnotationPrefix) {
+			routeParentRefs = r.traefikEntryPointParentRefs(&ingress, routeParentRefs)
+		}
+		fixed := pinned
+		if fixed == nil && len(routeParentRefs) == 0 {
+			// Or fall back to the default Gateway
+			fixed = r.defaultParentRef(&ingress, hostname, gateways)
+		}
+		if fixed != nil {
+			routeParentRefs = []gatewayv1.ParentReference{*fixed}
+		}
+
+		// Hosts listed under spec.tls are only attached to HTTPS listeners, their HTTP listeners may redirect,
+		// as may those of the hosts nginx or the Application Gateway is told to redirect to HTTPS
+		var redirectParentRefs []gatewayv1.ParentReference
+		tlsSelected := false
+		secretName, tls := findTLSSecret(tlsIngress, hostname)
+		redirect := tls && r.TLSRedirect || hostname != "" && !solver &&
+			(profile.translates(nginxAnnotationPrefix) && sslRedirect(tlsIngress, tls) ||
+				profile.translates(agicAnnotationPrefix) && agicSSLRedirect(tlsIngress, tls))
+		if (tls && r.TLSListeners || redirect) && fixed == nil {
+			https, http := selectTLSListeners(routeParentRefs, gateways, ingress.Namespace, secretName)
+			if len(https) > 0 {
+				routeParentRefs = https
+				tlsSelected = true
+				if redirect {
+					redirectParentRefs = http
+				}
+			} else {
+				logger.Info("no HTTPS listener found for TLS host", "hostname", hostname)
+			}
+		}
+
 		if len(routeParentRefs) == 0 {
+			// The Gateways would reject a HTTPRoute whose hostname does not intersect a listener hostname
+			logger.Info("no listener found for hostname", "hostname", hostname)
+			r.event(&ingress, corev1.EventTypeWarning, "NoMatchingListener",
+				fmt.Sprintf("No Gateway listener with a hostname intersecting %q accepts HTTPRoutes from namespace %s",
+					hostname, ingress.Namespace))
 			continue
 		}
+		// The listeners selected for TLS must stay referenced by name, the Gateway would also attach others
+		if r.ParentRefStrategy == ParentRefStrategyGateway && fixed == nil && !tlsSelected {
+			routeParentRefs = gatewayParentRefs(routeParentRefs, gateways)
+		} else if r.ParentRefStrategy == ParentRefStrategyPort && fixed == nil && !tlsSelected {
+			routeParentRefs = portParentRefs(routeParentRefs, gateways)
+		} else if r.CollapseParentRefs {
+			routeParentRefs = collapseParentRefs(routeParentRefs, gateways)
+			if len(redirectParentRefs) > 0 {
+				redirectParentRefs = collapseParentRefs(redirectParentRefs, gateways)
+			}
+		}
 
 		// Create HTTPRoute hostnames slice
 		var routeHostnames []gatewayv1.Hostname
@@ -114,13 +650,31 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		}
 
 		// Map the Ingress rules for this specific hostname to HTTPRoute rules
-		routeRules, err := r.mapToHTTPRouteRules(ctx, req.Namespace, matchingRules)
+		var routeRules []gatewayv1.HTTPRouteRule
+		var routeLabels map[string]string
+		routeOwners := []metav1.OwnerReference{owner}
+		if merged != nil {
+			routeRules, routeLabels, routeOwners, err = r.mapMergedHTTPRouteRules(ctx, merged)
+		} else {
+			routeRules, routeLabels, err = r.mapToHTTPRouteRules(ctx, ingress, matchingRules)
+			for i := range routeRules {
+				routeRules[i].Filters = mergeHeaderFilters(append(routeRules[i].Filters, filters...))
+			}
+		}
 		if err != nil {
-			return ctrl.Result{}, err
+			// The other hostnames are still converted, the HTTPRoute of this one is left as it is
+			logger.Error(err, "cannot convert hostname", "hostname", hostname)
+			r.event(&ingress, corev1.EventTypeWarning, "HostnameConversionFailed",
+				fmt.Sprintf("Cannot convert the rules of hostname %q: %v", hostname, err))
+			hostnameErrs = append(hostnameErrs, fmt.Errorf("hostname %q: %w", hostname, err))
+			continue
 		}
 		if len(routeRules) == 0 {
 			continue
 		}
+		if solver {
+			routeLabels = map[string]string{acmeSolverRouteLabel: "true"}
+		}
 
 		// Create the HTTPRoute spec
 		spec := gatewayv1.HTTPRouteSpec{
@@ -129,52 +683,288 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			Rules:           routeRules,
 		}
 
-		// Create or update HTTPRoute for this hostname
-		if err := r.reconcileHTTPRoute(ctx, routeName, owner, spec); err != nil {
-			return ctrl.Result{}, err
+		first := len(result)
+		result = append(result, r.createHTTPRoutes(routeName, ingress.Namespace, routeOwners, routeLabels, spec)...)
+		if len(redirectParentRefs) > 0 {
+			redirectSpec := createRedirectSpec(redirectParentRefs, routeHostnames)
+			result = append(result, r.createHTTPRoutes(routeName+redirectRouteSuffix, ingress.Namespace, routeOwners, nil, redirectSpec)...)
 		}
+
+		// nginx redirects the www or non-www variant of the hostname to it, unless the Ingress declares the variant too
+		if variant := wwwVariant(hostname); variant != "" && !solver && profile.translates(nginxAnnotationPrefix) && fromToWWWRedirect(ingress) {
+			if _, declared := ingressRules[variant]; !declared {
+				if wwwParentRefs := r.wwwRedirectParentRefs(&ingress, variant, parentRefs, fixed, gateways); len(wwwParentRefs) > 0 {
+					wwwSpec := createWWWRedirectSpec(wwwParentRefs, variant, hostname, redirect && tlsSelected)
+					result = append(result, r.createHTTPRoutes(routeName+wwwRedirectRouteSuffix, ingress.Namespace, routeOwners, nil, wwwSpec)...)
+				}
+			}
+		}
+
+		// The HTTPRoutes of a merged hostname report the unconverted annotations of all Ingresses sharing it
+		sources := []networkingv1.Ingress{ingress}
+		if merged != nil {
+			sources = nil
+			for _, m := range merged {
+				sources = append(sources, m.ingress)
+			}
+		}
+		if err := r.annotateUnconverted(ctx, result[first:], sources...); err != nil {
+			return nil, err
+		}
+		r.annotateExternalDNS(result[first:], sources...)
 	}
 
-	return ctrl.Result{}, nil
+	if r.completeSourceRules != nil {
+		if err := r.completeSourceRules(ctx, result); err != nil {
+			return nil, err
+		}
+	}
+	if result, err = r.adaptToSupportedFeatures(ctx, &ingress, result, gateways); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(result, func(a, b gatewayv1.HTTPRoute) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result, utilerrors.NewAggregate(hostnameErrs)
+}
+
+// createHTTPRoutes creates the HTTPRoutes for the spec in the namespace of the Ingress, or in the namespaces of
+// its Gateways with GatewayNamespaceRoutes
+func (r *IngressReconciler) createHTTPRoutes(name, namespace string, owners []metav1.OwnerReference, labels map[string]string, spec gatewayv1.HTTPRouteSpec) []gatewayv1.HTTPRoute {
+	if r.GatewayNamespaceRoutes {
+		return r.createGatewayNamespaceHTTPRoutes(name, namespace, owners, labels, spec)
+	}
+	return r.createNamespaceHTTPRoutes(name, namespace, owners, labels, spec)
+}
+
+// createNamespaceHTTPRoutes creates a HTTPRoute for the spec, or one HTTPRoute per Gateway of its parent refs,
+// sharded when the rules exceed the limits of a single HTTPRoute
+func (r *IngressReconciler) createNamespaceHTTPRoutes(name, namespace string, owners []metav1.OwnerReference, labels map[string]string, spec gatewayv1.HTTPRouteSpec) []gatewayv1.HTTPRoute {
+	if r.ConsolidateRules {
+		sortHTTPRouteSpec(&spec)
+		spec.Rules = consolidateHTTPRouteRules(spec.Rules)
+	}
+	if !r.RoutePerParent {
+		return shardHTTPRoute(createHTTPRoute(name, namespace, owners, labels, spec))
+	}
+
+	var result []gatewayv1.HTTPRoute
+	for _, gatewayParentRefs := range groupParentRefsByGateway(spec.ParentRefs) {
+		gatewaySpec := *spec.DeepCopy()
+		gatewaySpec.ParentRefs = gatewayParentRefs
+		gatewayRouteName := generatePerParentHTTPRouteName(name, namespace, gatewayParentRefs[0])
+		result = append(result, shardHTTPRoute(createHTTPRoute(gatewayRouteName, namespace, owners, labels, gatewaySpec))...)
+	}
+	return result
+}
+
+// ingressFilters returns the filters added to every rule of the Ingress for its annotations, whether its rules get an
+// HTTPRoute of their own or are merged with those of other Ingresses
+func (r *IngressReconciler) ingressFilters(profile *ConversionProfile, ingress networkingv1.Ingress) ([]gatewayv1.HTTPRouteFilter, error) {
+	filters, err := r.extensionRefFilters(ingress)
+	if err != nil {
+		return nil, err
+	}
+	if profile.translates(traefikAnnotationPrefix) {
+		filters = append(filters, r.traefikMiddlewareFilters(&ingress)...)
+	}
+	filters = append(filters, r.headerFilters(&ingress)...)
+	filters = append(filters, r.inlineFilters(&ingress)...)
+	return filters, nil
 }
 
-// mapToHTTPRouteRules converts ingress HTTP rules to HTTPRoute rules
-func (r *IngressReconciler) mapToHTTPRouteRules(ctx context.Context, namespace string, rules []networkingv1.IngressRule) ([]gatewayv1.HTTPRouteRule, error) {
+// mapToHTTPRouteRules converts ingress HTTP rules to HTTPRoute rules, and returns the labels the HTTPRoute needs for them
+func (r *IngressReconciler) mapToHTTPRouteRules(ctx context.Context, ingress networkingv1.Ingress, rules []networkingv1.IngressRule) ([]gatewayv1.HTTPRouteRule, map[string]string, error) {
+	namespace := ingress.Namespace
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil {
+		return nil, nil, err
+	}
+	implementationSpecific := r.implementationSpecificPathType(ingress, profile)
 	var result []gatewayv1.HTTPRouteRule
+	var labels map[string]string
 
+	// A redirect replaces the backends of all paths of the Ingress, nginx canaries share the traffic of their paths
+	var redirect *gatewayv1.HTTPRouteFilter
+	var timeouts *gatewayv1.HTTPRouteTimeouts
+	var vhost *gatewayv1.PreciseHostname
+	var forwardedPrefix, cors, mirror *gatewayv1.HTTPRouteFilter
+	var persistence *gatewayv1.SessionPersistence
+	var canaries []networkingv1.Ingress
+	var agicTimeouts *gatewayv1.HTTPRouteTimeouts
+	if profile.translates(agicAnnotationPrefix) && !r.OmitTimeouts {
+		agicTimeouts = r.agicRequestTimeout(&ingress)
+	}
+	queryParams := r.queryParamMatches(&ingress)
+	var albActions map[string]albAction
+	var albConditions map[string][]albCondition
+	if profile.translates(albAnnotationPrefix) {
+		albActions, albConditions = r.albAnnotations(&ingress)
+	}
+	if profile.translates(nginxAnnotationPrefix) {
+		redirect = r.redirectFilter(&ingress)
+		if !r.OmitTimeouts {
+			timeouts = r.proxyTimeouts(&ingress)
+		}
+		vhost = r.upstreamVhost(&ingress)
+		forwardedPrefix = forwardedPrefixFilter(ingress)
+		cors = r.corsFilter(&ingress)
+		persistence = r.sessionPersistence(&ingress)
+		if mirror, err = r.mirrorFilter(ctx, &ingress); err != nil {
+			return nil, nil, err
+		}
+		if canaries, err = r.listNginxCanaries(ctx, ingress, rules); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	index := 0
 	for _, rule := range rules {
 		if rule.HTTP != nil {
 			for _, path := range rule.HTTP.Paths {
 				// Create a path match
-				pathMatch := createPathMatch(path)
+				pathMatch := createPathMatch(path, implementationSpecific)
+				if implementationSpecific == PathTypePrefix {
+					if wildcardMatch, ok := gceWildcardPath(path); ok {
+						pathMatch = wildcardMatch
+					}
+				}
+				if profile.translates(nginxAnnotationPrefix) && usesRegex(ingress) {
+					applyUseRegex(&pathMatch)
+				}
+				r.validateRegexPath(&ingress, pathMatch)
 
-				// Create a backend reference
-				backendRef, err := r.mapBackendRef(ctx, namespace, path.Backend)
-				if err != nil {
-					return nil, err
+				routeRule := gatewayv1.HTTPRouteRule{
+					Matches: []gatewayv1.HTTPRouteMatch{{Path: &pathMatch}},
+				}
+				if redirect != nil {
+					routeRule.Filters = []gatewayv1.HTTPRouteFilter{*redirect}
+				} else if profile.translates(nginxAnnotationPrefix) {
+					routeRule.Timeouts = timeouts.DeepCopy()
+					routeRule.SessionPersistence = persistence.DeepCopy()
+					if filter := r.urlRewriteFilter(&ingress, pathMatch, vhost); filter != nil {
+						routeRule.Filters = append(routeRule.Filters, *filter)
+					}
+					if forwardedPrefix != nil {
+						routeRule.Filters = append(routeRule.Filters, *forwardedPrefix.DeepCopy())
+					}
+					if cors != nil {
+						routeRule.Filters = append(routeRule.Filters, *cors.DeepCopy())
+					}
+					if mirror != nil {
+						routeRule.Filters = append(routeRule.Filters, *mirror.DeepCopy())
+					}
 				}
-				if backendRef == nil {
-					return nil, fmt.Errorf("no backend found for path '%s'", path.Path)
+				if redirect == nil && profile.translates(agicAnnotationPrefix) {
+					applyAGICAnnotations(ingress, &routeRule, pathMatch, agicTimeouts)
 				}
+				if r.StrictPrefixMatching {
+					if exactMatch, ok := trailingSlashMatch(pathMatch); ok {
+						routeRule.Matches = append(routeRule.Matches, gatewayv1.HTTPRouteMatch{Path: &exactMatch})
+					}
+				}
+				if name := albConditionsName(path.Backend); len(albConditions[name]) > 0 {
+					routeRule.Matches = r.albConditionMatches(&ingress, name, routeRule.Matches, albConditions[name])
+				}
+				applyQueryParamMatches(&routeRule, queryParams)
+				if r.RuleNames {
+					routeRule.Name = ptr.To(generateRuleName(ingress.Name, rule.Host, index))
+				}
+				index++
 
-				result = append(result, gatewayv1.HTTPRouteRule{
-					Matches:     []gatewayv1.HTTPRouteMatch{{Path: &pathMatch}},
-					BackendRefs: []gatewayv1.HTTPBackendRef{*backendRef},
-				})
+				var canaryRule *gatewayv1.HTTPRouteRule
+				if redirect != nil {
+					// The requests are redirected and never reach the backend of the path
+				} else if isALBActionBackend(path.Backend) && profile.translates(albAnnotationPrefix) {
+					// The AWS load balancer action named by the backend forwards or redirects the requests
+					if err := r.applyALBAction(ctx, &ingress, &routeRule, albActions, path.Backend.Service.Name); err != nil {
+						return nil, nil, err
+					}
+				} else if r.DisableServiceLookups && isNamedServicePort(path.Backend) {
+					// A Service backendRef without a port is rejected by the API server, so leave
+					// the rule without backends: the Gateway answers with a 404 instead of
+					// routing the request elsewhere.
+					log.FromContext(ctx).Info("cannot resolve named port without Service lookups",
+						"path", path.Path, "service", path.Backend.Service.Name, "port", path.Backend.Service.Port.Name)
+					r.event(&ingress, corev1.EventTypeWarning, "UnresolvedNamedPort",
+						fmt.Sprintf("Backend %s:%s of path %s is left out, named ports are not resolved without Service lookups",
+							path.Backend.Service.Name, path.Backend.Service.Port.Name, path.Path))
+				} else {
+					// Create a backend reference
+					backendRef, err := r.mapBackendRef(ctx, namespace, path.Backend, r.backendWeight())
+					if err != nil {
+						return nil, nil, err
+					}
+					if backendRef == nil {
+						return nil, nil, fmt.Errorf("no backend found for path '%s'", path.Path)
+					}
+					if r.CrossNamespaceBackends && !r.DisableServiceLookups {
+						if *backendRef, err = r.mapCrossNamespaceBackendRef(ctx, ingress, *backendRef); err != nil {
+							return nil, nil, err
+						}
+					}
+					routeRule.BackendRefs = []gatewayv1.HTTPBackendRef{*backendRef}
+
+					// Or split the traffic of the path with the same path of an nginx canary, by weight or by header
+					if canary, canaryPath := findNginxCanaryPath(canaries, rule.Host, path); canary != nil {
+						backendRefs, err := r.nginxCanaryBackendRefs(ctx, *backendRef, *canary, *canaryPath)
+						if err != nil {
+							return nil, nil, err
+						}
+						if backendRefs != nil {
+							routeRule.BackendRefs = backendRefs
+						}
+						if canaryRule, err = r.nginxCanaryHeaderRule(ctx, routeRule, *canary, *canaryPath); err != nil {
+							return nil, nil, err
+						}
+					}
+
+					// Or split the traffic over the stable and canary Services of a progressive delivery tool
+					if r.CanaryBackends && !r.DisableServiceLookups && path.Backend.Service != nil && len(routeRule.BackendRefs) == 1 {
+						canary, err := r.findCanaryBackends(ctx, namespace, path.Backend.Service.Name)
+						if err != nil {
+							return nil, nil, err
+						}
+						if canary != nil {
+							routeRule.BackendRefs = canary.backendRefs(*backendRef)
+							if labels == nil {
+								labels = canary.labels(ingress)
+							}
+						}
+					}
+				}
+
+				// A prefix rewrite only applies to a single PathPrefix match
+				result = append(result, splitReplacePrefixMatch(routeRule)...)
+				if canaryRule != nil {
+					result = append(result, splitReplacePrefixMatch(*canaryRule)...)
+				}
 			}
 		}
 	}
 
-	slices.SortStableFunc(result, compareHTTPRouteRule)
-	return result, nil
+	// Requests for / are redirected to the root of the application, unless all requests are redirected
+	if redirect == nil && len(result) > 0 && profile.translates(nginxAnnotationPrefix) {
+		if appRootRule := r.appRootRule(&ingress); appRootRule != nil {
+			if r.RuleNames {
+				appRootRule.Name = ptr.To(generateRuleName(ingress.Name, rules[0].Host, index))
+			}
+			result = append(result, *appRootRule)
+		}
+	}
+
+	return result, labels, nil
 }
 
 // reconcileHTTPRoute creates or updates a single HTTPRoute for the ingress
-func (r *IngressReconciler) reconcileHTTPRoute(ctx context.Context, name types.NamespacedName, owner metav1.OwnerReference, spec gatewayv1.HTTPRouteSpec) error {
+func (r *IngressReconciler) reconcileHTTPRoute(ctx context.Context, desired gatewayv1.HTTPRoute, owner metav1.OwnerReference) error {
 	logger := log.FromContext(ctx)
+	routeClient := r.routeClient()
+	name := types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}
 	httpRoute := gatewayv1.HTTPRoute{}
 	httpRouteExists := true
-	if err := r.Get(ctx, name, &httpRoute); err != nil {
+	if err := routeClient.Get(ctx, name, &httpRoute); err != nil {
 		if errors.IsNotFound(err) {
 			httpRouteExists = false
 		} else {
@@ -183,21 +973,57 @@ func (r *IngressReconciler) reconcileHTTPRoute(ctx context.Context, name types.N
 	}
 
 	if !httpRouteExists {
+		if err := r.checkRouteQuota(ctx, name.Namespace); err != nil {
+			return err
+		}
+
 		// Create a new HTTPRoute
 		httpRoute.SetNamespace(name.Namespace)
 		httpRoute.SetName(name.Name)
-		httpRoute.SetOwnerReferences([]metav1.OwnerReference{owner})
-		httpRoute.Spec = spec
+		httpRoute.SetLabels(desired.Labels)
+		if annotation, ok := desired.Annotations[ownerAnnotation]; ok {
+			// Owner references cannot point to another namespace either
+			httpRoute.SetAnnotations(map[string]string{ownerAnnotation: annotation})
+		} else if r.TargetCluster == nil {
+			httpRoute.SetOwnerReferences(desired.OwnerReferences)
+		} else {
+			// Owner references cannot point to another cluster, the garbage collector
+			// would delete the HTTPRoute right away. Record the owner in an annotation instead.
+			httpRoute.SetAnnotations(map[string]string{
+				ownerAnnotation: ownerAnnotationValue(ownerGroupKind(owner), name.Namespace, owner.Name),
+			})
+		}
+		syncUnconvertedAnnotation(&httpRoute.ObjectMeta, desired.ObjectMeta)
+		r.syncExternalDNSAnnotations(&httpRoute.ObjectMeta, desired.ObjectMeta)
+		httpRoute.Spec = desired.Spec
 
-		if err := r.Create(ctx, &httpRoute); err != nil {
+		if err := routeClient.Create(ctx, &httpRoute); err != nil {
 			return err
 		}
 
 		logger.Info("created HTTPRoute", "name", name)
-	} else if isOwnedBy(httpRoute.ObjectMeta, owner) && !isEqual(httpRoute.Spec, spec) {
+	} else if r.ownsRoute(httpRoute.ObjectMeta, desired.ObjectMeta) {
+		spec := *desired.Spec.DeepCopy()
+		applyHTTPRouteDefaults(&spec)
+		if httpRoute.Labels[canaryProviderLabel] != "" {
+			// The traffic split is managed by the progressive delivery tool
+			preserveCanaryWeights(&spec, httpRoute.Spec)
+		}
+		// Merged HTTPRoutes are owned by all Ingresses currently sharing the hostname
+		ownersChanged := r.syncMergedOwners(&httpRoute.ObjectMeta, desired.ObjectMeta)
+		unconvertedChanged := syncUnconvertedAnnotation(&httpRoute.ObjectMeta, desired.ObjectMeta)
+		externalDNSChanged := r.syncExternalDNSAnnotations(&httpRoute.ObjectMeta, desired.ObjectMeta)
+		if isEqual(httpRoute.Spec, spec) && hasLabels(httpRoute.ObjectMeta, desired.Labels) && !ownersChanged && !unconvertedChanged &&
+			!externalDNSChanged {
+			return nil
+		}
+
 		// Update existing HTTPRoute
 		httpRoute.Spec = spec
-		if err := r.Update(ctx, &httpRoute); err != nil {
+		for key, value := range desired.Labels {
+			metav1.SetMetaDataLabel(&httpRoute.ObjectMeta, key, value)
+		}
+		if err := routeClient.Update(ctx, &httpRoute); err != nil {
 			return err
 		}
 		logger.Info("updated HTTPRoute", "name", name)
@@ -206,38 +1032,328 @@ func (r *IngressReconciler) reconcileHTTPRoute(ctx context.Context, name types.N
 	return nil
 }
 
+// annotateIngress records the names of the generated routes on the Ingress. The timestamp only changes together
+// with the routes or the version, otherwise every patch would trigger another reconcile.
+func (r *IngressReconciler) annotateIngress(ctx context.Context, ingress networkingv1.Ingress, names []string) error {
+	routes := strings.Join(names, ",")
+
+	current, ok := ingress.Annotations[routesAnnotation]
+	if ok && current == routes && ingress.Annotations[versionAnnotation] == r.Version {
+		return nil
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	metav1.SetMetaDataAnnotation(&ingress.ObjectMeta, routesAnnotation, routes)
+	metav1.SetMetaDataAnnotation(&ingress.ObjectMeta, versionAnnotation, r.Version)
+	metav1.SetMetaDataAnnotation(&ingress.ObjectMeta, convertedAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+	return r.ingressClient().Patch(ctx, &ingress, patch)
+}
+
+// event emits an Event on the object if a Recorder is set
+func (r *IngressReconciler) event(object runtime.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// routeClient returns the client used to read Gateways and to write HTTPRoutes
+func (r *IngressReconciler) routeClient() client.Client {
+	if r.TargetCluster != nil {
+		return r.Audited(r.TargetCluster.GetClient())
+	}
+	return r.Audited(r.Client)
+}
+
+// ingressClient returns the client used to write Ingresses
+func (r *IngressReconciler) ingressClient() client.Client {
+	return r.Audited(r.Client)
+}
+
+// isOwnedBy returns true if the HTTPRoute was created for the owning Ingress
+func (r *IngressReconciler) isOwnedBy(metadata metav1.ObjectMeta, owner metav1.OwnerReference) bool {
+	if r.TargetCluster != nil {
+		return isAnnotatedOwner(metadata.Annotations, ownerGroupKind(owner), metadata.Namespace, owner.Name)
+	}
+	return isOwnedBy(metadata, owner)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	// Index the hosts of Ingresses, so a Gateway change only enqueues the Ingresses it can affect
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, ingressHostIndex, r.indexRewrittenIngressHosts); err != nil {
+		return err
+	}
+	r.hostIndexed = true
+
+	// Index the Gateways Ingresses are pinned to, so a change of such a Gateway enqueues them whatever their hosts
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, ingressGatewayIndex, r.indexPinnedGateway); err != nil {
+		return err
+	}
+
+	// Index the backend Services of Ingresses, so a Service change only enqueues the Ingresses referencing it
+	if !r.DisableServiceLookups {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, ingressServiceIndex, indexIngressServices); err != nil {
+			return err
+		}
+	}
+
+	// Listeners may select the namespaces of their routes by label, which are evaluated against the
+	// namespaces the HTTPRoutes are written to, as are the GatewayClasses of their Gateways
+	routeCache := mgr.GetCache()
+	if r.TargetCluster != nil {
+		routeCache = r.TargetCluster.GetCache()
+	}
+
+	// Index the listener hostnames of Gateways, so only the Gateways matching the hosts of an Ingress are read
+	if err := routeCache.IndexField(context.Background(), &gatewayv1.Gateway{}, gatewayHostIndex, indexGatewayHosts); err != nil {
+		return err
+	}
+	r.gatewayHostIndexed = true
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&networkingv1.Ingress{}).
-		Owns(&gatewayv1.HTTPRoute{}).
-		Watches(
-			&gatewayv1.Gateway{},
-			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
-				// This will trigger reconciliation for all Ingresses when any Gateway changes
-				var requests []reconcile.Request
-
-				ingressList := &networkingv1.IngressList{}
-				if err := r.List(ctx, ingressList); err != nil {
-					return requests
-				}
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
+		}).
+		WatchesRawSource(source.Kind[client.Object](routeCache, &corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.findIngressesForNamespace), predicate.LabelChangedPredicate{}))
+
+	if r.TargetCluster == nil && r.MergeHosts {
+		// Merged HTTPRoutes have no controller, every owning Ingress is reconciled when they change,
+		// and a change of an Ingress may change the HTTPRoutes of the Ingresses sharing its hosts
+		builder = builder.
+			Watches(&gatewayv1.HTTPRoute{}, handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &networkingv1.Ingress{})).
+			Watches(&networkingv1.Ingress{}, r.siblingEventHandler()).
+			Watches(&gatewayv1.Gateway{}, r.gatewayEventHandler())
+	} else if r.TargetCluster == nil {
+		builder = builder.
+			Owns(&gatewayv1.HTTPRoute{}).
+			Watches(&gatewayv1.Gateway{}, r.gatewayEventHandler())
+	} else {
+		builder = builder.
+			WatchesRawSource(source.Kind[client.Object](r.TargetCluster.GetCache(), &gatewayv1.HTTPRoute{},
+				handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(ingressGroupKind)))).
+			WatchesRawSource(source.Kind[client.Object](r.TargetCluster.GetCache(), &gatewayv1.Gateway{},
+				r.gatewayEventHandler()))
+	}
+
+	// Ingresses split their traffic with the nginx canaries sharing their hosts, merged hosts enqueue them already
+	if !r.MergeHosts {
+		builder = builder.Watches(&networkingv1.Ingress{}, r.canaryEventHandler())
+	}
+
+	// HTTPRoutes in the namespaces of their Gateways record their owner in an annotation
+	if r.GatewayNamespaceRoutes && r.TargetCluster == nil {
+		builder = builder.Watches(&gatewayv1.HTTPRoute{}, handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(ingressGroupKind)))
+	}
+
+	// Without Service lookups nothing of a Service is converted
+	if !r.DisableServiceLookups {
+		builder = builder.WatchesRawSource(source.Kind[client.Object](mgr.GetCache(), &corev1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.findIngressesForService), serviceChangedPredicate()))
+	}
+
+	builder = watchListenerSets(builder, r.ListenerSets, routeCache, r.listenerSetEventHandler(r.listIngressRequests))
+
+	// The supported features of GatewayClasses are only read when the HTTPRoutes are adapted to them
+	if r.SupportedFeatures {
+		builder = builder.WatchesRawSource(source.Kind[client.Object](routeCache, &gatewayv1.GatewayClass{},
+			handler.EnqueueRequestsFromMapFunc(r.findIngressesForGatewayClass), supportedFeaturesChangedPredicate()))
+	}
+
+	// GRPCRoutes are only watched when generated, so their CRD is not required otherwise
+	if r.AppProtocolBackends && r.TargetCluster == nil {
+		builder = builder.Watches(&gatewayv1.GRPCRoute{},
+			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &networkingv1.Ingress{}))
+	} else if r.AppProtocolBackends {
+		builder = builder.WatchesRawSource(source.Kind[client.Object](r.TargetCluster.GetCache(), &gatewayv1.GRPCRoute{},
+			handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(ingressGroupKind))))
+	}
+
+	// TLSRoutes are only watched when generated, so their CRD is not required otherwise
+	if r.TLSPassthroughRoutes && r.TargetCluster == nil {
+		builder = builder.Watches(&gatewayv1alpha2.TLSRoute{},
+			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &networkingv1.Ingress{}))
+	} else if r.TLSPassthroughRoutes {
+		builder = builder.WatchesRawSource(source.Kind[client.Object](r.TargetCluster.GetCache(), &gatewayv1alpha2.TLSRoute{},
+			handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(ingressGroupKind))))
+	}
+
+	return builder.Complete(r)
+}
+
+// gatewayEventHandler enqueues the Ingresses with a host matching a listener of the changed Gateway.
+// For updates the listeners before and after the change are considered, so Ingresses that no longer
+// match are reconciled as well.
+func (r *IngressReconciler) gatewayEventHandler() handler.EventHandler {
+	return r.gatewayHostEventHandler(r.listIngressRequests)
+}
+
+// gatewayHostEventHandler enqueues the objects listed by list with a host matching a listener of the changed Gateway
+func (r *IngressReconciler) gatewayHostEventHandler(list requestLister) handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, e.Object)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, e.Object)
+		},
+	}
+}
+
+// watchListenerSets watches the XListenerSets of the cache with the handler if they are used, so their CRD is not
+// required otherwise
+func watchListenerSets(b *ctrl.Builder, used bool, c cache.Cache, h handler.EventHandler) *ctrl.Builder {
+	if !used {
+		return b
+	}
+	return b.WatchesRawSource(source.Kind[client.Object](c, &gatewayxv1alpha1.XListenerSet{}, h))
+}
 
-				for _, ingress := range ingressList.Items {
-					requests = append(requests, reconcile.Request{
-						NamespacedName: types.NamespacedName{
-							Name:      ingress.Name,
-							Namespace: ingress.Namespace,
-						},
-					})
+// listenerSetEventHandler enqueues the objects listed by list matching the listener hostnames of changed
+// XListenerSets
+func (r *IngressReconciler) listenerSetEventHandler(list requestLister) handler.EventHandler {
+	gateways := func(ctx context.Context, objects ...client.Object) []client.Object {
+		var listenerSets []gatewayxv1alpha1.XListenerSet
+		for _, obj := range objects {
+			if listenerSet, ok := obj.(*gatewayxv1alpha1.XListenerSet); ok {
+				listenerSets = append(listenerSets, *listenerSet)
+			}
+		}
+		var parents gatewayv1.GatewayList
+		if err := r.routeClient().List(ctx, &parents); err != nil {
+			log.FromContext(ctx).Error(err, "cannot list gateways")
+			return nil
+		}
+		var result []client.Object
+		for _, gateway := range listenerSetGateways(listenerSets, parents.Items) {
+			result = append(result, &gateway)
+		}
+		return result
+	}
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, gateways(ctx, e.Object)...)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, gateways(ctx, e.ObjectOld, e.ObjectNew)...)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, gateways(ctx, e.Object)...)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForGateways(ctx, q, list, gateways(ctx, e.Object)...)
+		},
+	}
+}
+
+// requestLister returns a reconcile request for each object matching the list options, such as the Ingresses with
+// a key in the host index
+type requestLister func(ctx context.Context, opts ...client.ListOption) []reconcile.Request
+
+// enqueueForGateways looks up the objects listed by list matching the listener hostnames of the Gateways in the
+// host index, and those pinned to the Gateways in the Gateway index. Any object may fall back to the default Gateway.
+func (r *IngressReconciler) enqueueForGateways(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], list requestLister, objects ...client.Object) {
+	logger := log.FromContext(ctx)
+
+	hostnames := make(map[string]bool)
+	pinned := make(map[string]bool)
+	for _, obj := range objects {
+		gateway, ok := obj.(*gatewayv1.Gateway)
+		if !ok {
+			continue
+		}
+		// A pinned Gateway that is no longer a candidate leaves the HTTPRoutes pinned to it without parents
+		key := gateway.Namespace + "/" + gateway.Name
+		if parentRef, err := ParseGatewayReference(r.DefaultGateway); err == nil &&
+			key == string(*parentRef.Namespace)+"/"+string(parentRef.Name) {
+			for _, request := range list(ctx) {
+				q.Add(request)
+			}
+			return
+		}
+		pinned[key] = true
+		if !r.isCandidateGateway(*gateway) {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Hostname == nil {
+				// A catch-all listener matches any Ingress
+				for _, request := range list(ctx) {
+					q.Add(request)
 				}
+				return
+			}
+			for _, key := range listenerIndexKeys(string(*listener.Hostname)) {
+				hostnames[key] = true
+			}
+		}
+	}
+
+	for hostname := range hostnames {
+		for _, request := range list(ctx, client.MatchingFields{ingressHostIndex: hostname}) {
+			q.Add(request)
+		}
+	}
+	for gateway := range pinned {
+		for _, request := range list(ctx, client.MatchingFields{ingressGatewayIndex: gateway}) {
+			q.Add(request)
+		}
+	}
+	logger.V(1).Info("enqueued objects for Gateway change", "hostnames", len(hostnames), "gateways", len(pinned))
+}
+
+// findIngressesForNamespace enqueues the Ingresses in a namespace whose labels changed,
+// as listeners selecting namespaces by label may now allow or reject their HTTPRoutes
+func (r *IngressReconciler) findIngressesForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listIngressRequests(ctx, client.InNamespace(obj.GetName()))
+}
+
+// routeNamespace returns the namespace the HTTPRoutes of an Ingress are written to. If it cannot be found,
+// e.g. when converting files, only the label the API server sets on every namespace is assumed.
+func (r *IngressReconciler) routeNamespace(ctx context.Context, name string) (corev1.Namespace, error) {
+	namespace := corev1.Namespace{}
+	if err := r.routeClient().Get(ctx, types.NamespacedName{Name: name}, &namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			return namespace, err
+		}
+		namespace.Name = name
+		namespace.Labels = map[string]string{corev1.LabelMetadataName: name}
+	}
+	return namespace, nil
+}
 
-				return requests
-			}),
-		).
-		Complete(r)
+// listIngressRequests returns a reconcile request for each Ingress matching the list options
+func (r *IngressReconciler) listIngressRequests(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	var requests []reconcile.Request
+
+	ingressList := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingressList, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "cannot list ingresses")
+		return requests
+	}
+
+	for _, ingress := range ingressList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      ingress.Name,
+				Namespace: ingress.Namespace,
+			},
+		})
+	}
+
+	return requests
 }
 
-func (r *IngressReconciler) mapBackendRef(ctx context.Context, namespace string, ref networkingv1.IngressBackend) (*gatewayv1.HTTPBackendRef, error) {
+// mapBackendRef converts an Ingress backend to a backend ref with the weight, which is left out if nil
+func (r *IngressReconciler) mapBackendRef(ctx context.Context, namespace string, ref networkingv1.IngressBackend, weight *int32) (*gatewayv1.HTTPBackendRef, error) {
 	var objectRef gatewayv1.BackendObjectReference
 	if ref.Resource != nil {
 		if ref.Resource.APIGroup != nil {
@@ -278,6 +1394,147 @@ func (r *IngressReconciler) mapBackendRef(ctx context.Context, namespace string,
 	}
 	backendRef := gatewayv1.HTTPBackendRef{BackendRef: gatewayv1.BackendRef{
 		BackendObjectReference: objectRef,
+		Weight:                 weight,
 	}}
 	return &backendRef, nil
 }
+
+// defaultBackendWeight is the weight the API server defaults a backendRef to
+const defaultBackendWeight int32 = 1
+
+// backendWeight returns the weight of the backend refs of Ingress paths. By default it is set explicitly to the
+// Gateway API default, so the output of the convert command and the golden files show the HTTPRoutes as the API
+// server stores them. Reconciling does not depend on it, the defaults are applied before comparing.
+func (r *IngressReconciler) backendWeight() *int32 {
+	if r.OmitBackendWeights {
+		return nil
+	}
+	return ptr.To(ptr.Deref(r.BackendWeight, defaultBackendWeight))
+}
+
+// listGateways returns the Gateways, and with ListenerSets the XListenerSets attached to them as Gateways
+func (r *IngressReconciler) listGateways(ctx context.Context) (gatewayv1.GatewayList, error) {
+	var gateways gatewayv1.GatewayList
+	if err := r.routeClient().List(ctx, &gateways); err != nil {
+		return gateways, err
+	}
+	if r.ListenerSets {
+		var listenerSets gatewayxv1alpha1.XListenerSetList
+		if err := r.routeClient().List(ctx, &listenerSets); err != nil {
+			return gateways, err
+		}
+		gateways.Items = append(gateways.Items, listenerSetGateways(listenerSets.Items, gateways.Items)...)
+	}
+	return gateways, nil
+}
+
+// lookupGateways returns the Gateways the routes of the Ingress can attach to: those with a listener hostname
+// intersecting one of its hosts or without hostname, and the default Gateway and the one it is pinned to.
+// Without the Gateway host index, with ListenerSets, or if no Gateway matches, so the stale routes of the Ingress
+// are deleted as usual, all Gateways are listed.
+func (r *IngressReconciler) lookupGateways(ctx context.Context, ingress networkingv1.Ingress) (gatewayv1.GatewayList, error) {
+	if !r.gatewayHostIndexed || r.ListenerSets {
+		return r.listGateways(ctx)
+	}
+
+	var result gatewayv1.GatewayList
+	found := make(map[types.NamespacedName]bool)
+	add := func(gateway gatewayv1.Gateway) {
+		key := client.ObjectKeyFromObject(&gateway)
+		if !found[key] {
+			found[key] = true
+			result.Items = append(result.Items, gateway)
+		}
+	}
+	for _, key := range append(r.indexRewrittenIngressHosts(&ingress), catchAllListenerKey) {
+		var gateways gatewayv1.GatewayList
+		if err := r.routeClient().List(ctx, &gateways, client.MatchingFields{gatewayHostIndex: key}); err != nil {
+			return result, err
+		}
+		for _, gateway := range gateways.Items {
+			add(gateway)
+		}
+	}
+	if len(result.Items) == 0 {
+		return r.listGateways(ctx)
+	}
+
+	var references []string
+	if r.DefaultGateway != "" {
+		references = append(references, r.DefaultGateway)
+	}
+	if pinned, ok := ingress.Annotations[r.annotation(gatewayAnnotation)]; ok {
+		references = append(references, pinned)
+	}
+	for _, reference := range references {
+		parentRef, err := ParseGatewayReference(reference)
+		if err != nil {
+			continue
+		}
+		var gateway gatewayv1.Gateway
+		key := types.NamespacedName{Namespace: string(*parentRef.Namespace), Name: string(parentRef.Name)}
+		if err := r.routeClient().Get(ctx, key, &gateway); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return result, err
+		}
+		add(gateway)
+	}
+
+	slices.SortFunc(result.Items, func(a, b gatewayv1.Gateway) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return result, nil
+}
+
+// indexGatewayHosts returns the host index keys of all listeners of a Gateway. Looking up the host index keys of an
+// Ingress then yields exactly the Gateways with a listener hostname intersecting one of its hosts.
+func indexGatewayHosts(obj client.Object) []string {
+	gateway, ok := obj.(*gatewayv1.Gateway)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, listener := range gateway.Spec.Listeners {
+		listenerKeys := []string{catchAllListenerKey}
+		if listener.Hostname != nil {
+			listenerKeys = listenerIndexKeys(string(*listener.Hostname))
+		}
+		for _, key := range listenerKeys {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// candidateGateways returns the Gateways HTTPRoutes may attach to, given their GatewayClass and status
+func (r *IngressReconciler) candidateGateways(gateways gatewayv1.GatewayList) gatewayv1.GatewayList {
+	if len(r.GatewayClasses) == 0 && !r.RequireReadyGateways {
+		return gateways
+	}
+	var result gatewayv1.GatewayList
+	for _, gateway := range gateways.Items {
+		if r.isCandidateGateway(gateway) {
+			result.Items = append(result.Items, gateway)
+		}
+	}
+	return result
+}
+
+// isCandidateGateway returns true if HTTPRoutes may attach to the Gateway, given its GatewayClass and status
+func (r *IngressReconciler) isCandidateGateway(gateway gatewayv1.Gateway) bool {
+	if r.RequireReadyGateways && !isReadyGateway(gateway) {
+		return false
+	}
+	return len(r.GatewayClasses) == 0 || slices.Contains(r.GatewayClasses, gateway.Spec.GatewayClassName)
+}
+
+// isReadyGateway returns true if the Gateway is both accepted by its GatewayClass and programmed in the data plane
+func isReadyGateway(gateway gatewayv1.Gateway) bool {
+	return meta.IsStatusConditionTrue(gateway.Status.Conditions, string(gatewayv1.GatewayConditionAccepted)) &&
+		meta.IsStatusConditionTrue(gateway.Status.Conditions, string(gatewayv1.GatewayConditionProgrammed))
+}
@@ -19,22 +19,20 @@ package controller
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes/scheme"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/yaml"
 
-	networkingv1 "k8s.io/api/networking/v1"
+	"github.com/lion7/ingress2httproute/pkg/golden"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
@@ -46,40 +44,6 @@ const (
 
 var _ = Describe("Ingress Controller", func() {
 	ctx := context.Background()
-	deserializer := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
-	yamlCommentRegexp := regexp.MustCompile("#.*")
-
-	// Helper function to load multiple objects from a multi-doc YAML file
-	loadFromYAML := func(filePath string) ([]ctrlclient.Object, error) {
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			return nil, err
-		}
-
-		var objects []ctrlclient.Object
-
-		// Remove any YAML comments
-		yaml := yamlCommentRegexp.ReplaceAllString(string(data), "")
-
-		// Split by YAML document separator
-		docs := strings.Split(yaml, "---")
-		for _, doc := range docs {
-			doc = strings.TrimSpace(doc)
-			if doc == "" {
-				continue
-			}
-
-			obj, _, err := deserializer.Decode([]byte(doc), nil, nil)
-			if err != nil {
-				return nil, err
-			}
-			if clientObj, ok := obj.(ctrlclient.Object); ok {
-				objects = append(objects, clientObj)
-			}
-		}
-
-		return objects, nil
-	}
 
 	// Helper function to apply objects to the cluster
 	applyObjects := func(objects []ctrlclient.Object) []ctrlclient.Object {
@@ -95,35 +59,21 @@ var _ = Describe("Ingress Controller", func() {
 		return appliedObjects
 	}
 
-	// Helper function to find Ingress from loaded objects
-	findIngress := func(objects []ctrlclient.Object) *networkingv1.Ingress {
-		for _, obj := range objects {
-			if ingress, ok := obj.(*networkingv1.Ingress); ok {
-				return ingress
-			}
-		}
-		return nil
-	}
-
-	// Helper function to find HTTPRoutes from loaded objects
-	findHTTPRoutes := func(objects []ctrlclient.Object) []*gatewayv1.HTTPRoute {
-		var routes []*gatewayv1.HTTPRoute
-		for _, obj := range objects {
-			if route, ok := obj.(*gatewayv1.HTTPRoute); ok {
-				routes = append(routes, route)
-			}
-		}
-		return routes
-	}
-
 	// Helper function to validate HTTPRoute against expected
 	validateHTTPRouteAgainstExpected := func(actual *gatewayv1.HTTPRoute, expected *gatewayv1.HTTPRoute) {
 		By(fmt.Sprintf("validating HTTPRoute %s matches expected", actual.Name))
+		Expect(expected).NotTo(BeNil(),
+			fmt.Sprintf("HTTPRoute %s should have a matching expected route", actual.Name))
 		actualSpec, err := yaml.Marshal(actual.Spec)
 		Expect(err).NotTo(HaveOccurred())
 		expectedSpec, err := yaml.Marshal(expected.Spec)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(actualSpec).To(MatchYAML(expectedSpec))
+		actualLabels, err := yaml.Marshal(actual.Labels)
+		Expect(err).NotTo(HaveOccurred())
+		expectedLabels, err := yaml.Marshal(expected.Labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actualLabels).To(MatchYAML(expectedLabels))
 	}
 
 	// Helper function to cleanup resources
@@ -131,6 +81,12 @@ var _ = Describe("Ingress Controller", func() {
 		// Clean up all applied resources
 		for _, obj := range appliedResources {
 			_ = k8sClient.Delete(ctx, obj)
+
+			// The finalizer of the Ingress is not run without the controller
+			if ingress, ok := obj.(*networkingv1.Ingress); ok && k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), ingress) == nil {
+				ingress.Finalizers = nil
+				_ = k8sClient.Update(ctx, ingress)
+			}
 		}
 
 		// Clean up any HTTPRoutes that were created
@@ -143,67 +99,41 @@ var _ = Describe("Ingress Controller", func() {
 		}
 	}
 
-	// Get test directories dynamically from testdata directory
-	getTestDirectories := func() []string {
-		entries, err := os.ReadDir(testdataDir)
-		if err != nil {
-			Fail(fmt.Sprintf("Failed to read testdata directory %s: %v", testdataDir, err))
-			return nil
-		}
-
-		var testDirs []string
-		for _, entry := range entries {
-			if entry.IsDir() && (strings.HasPrefix(entry.Name(), "0") || strings.HasPrefix(entry.Name(), "1")) { // Test directories starting with 0 or 1
-				testDirs = append(testDirs, entry.Name())
-			}
-		}
-		return testDirs
+	// Get test cases dynamically from testdata directory
+	testCases, err := golden.List(testdataDir)
+	if err != nil {
+		Fail(fmt.Sprintf("Failed to read testdata directory %s: %v", testdataDir, err))
 	}
 
-	testDirectories := getTestDirectories()
-	for _, testDir := range testDirectories {
-		tc := testDir // capture loop variable
+	for _, name := range testCases {
+		tc := name // capture loop variable
 
 		Context(tc, func() {
 			var (
-				ingress            *networkingv1.Ingress
-				appliedResources   []ctrlclient.Object
-				expectedHTTPRoutes []*gatewayv1.HTTPRoute
-				defaultResources   []ctrlclient.Object
+				testCase         *golden.Case
+				appliedResources []ctrlclient.Object
+				defaultResources []ctrlclient.Object
 			)
 
 			BeforeEach(func() {
 				By(fmt.Sprintf("Setting up test case: %s", tc))
 
 				// Load and apply default resources
-				defaultPath := filepath.Join(testdataDir, "default.yaml")
-				defaultObjs, err := loadFromYAML(defaultPath)
+				defaultObjs, err := golden.LoadObjects(filepath.Join(testdataDir, "default.yaml"))
 				if err != nil {
 					Fail(fmt.Sprintf("Failed to load default.yaml: %v", err))
 				}
 				defaultResources = applyObjects(defaultObjs)
 
-				// Load input objects from input.yaml
-				inputPath := filepath.Join(testdataDir, tc, "input.yaml")
-				inputObjs, err := loadFromYAML(inputPath)
+				// Load the input objects and expected HTTPRoutes
+				testCase, err = golden.Load(testdataDir, tc)
 				if err != nil {
-					Fail(fmt.Sprintf("Failed to load input.yaml: %v", err))
+					Fail(fmt.Sprintf("Failed to load test case: %v", err))
 				}
-
-				// Find the Ingress from input objects
-				ingress = findIngress(inputObjs)
-				Expect(ingress).NotTo(BeNil(), "Ingress should exist in input.yaml")
+				Expect(testCase.Ingresses()).NotTo(BeEmpty(), "Ingress should exist in input.yaml")
 
 				// Apply all input objects
-				appliedResources = applyObjects(inputObjs)
-
-				// Load expected HTTPRoutes from output.yaml
-				outputPath := filepath.Join(testdataDir, tc, "output.yaml")
-				outputObjs, err := loadFromYAML(outputPath)
-				if err != nil {
-					Fail(fmt.Sprintf("Failed to load output.yaml: %v", err))
-				}
-				expectedHTTPRoutes = findHTTPRoutes(outputObjs)
+				appliedResources = applyObjects(testCase.Input)
 			})
 
 			AfterEach(func() {
@@ -214,74 +144,104 @@ var _ = Describe("Ingress Controller", func() {
 				// Reset for next test
 				appliedResources = nil
 				defaultResources = nil
-				expectedHTTPRoutes = nil
-				ingress = nil
+				testCase = nil
 			})
 
 			It("should handle ingress to httproute mapping correctly", func() {
-				By("Reconciling the Ingress")
 				reconciler := &IngressReconciler{
 					Client: k8sClient,
 					Scheme: k8sClient.Scheme(),
 				}
 
-				_, err := reconciler.Reconcile(ctx, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      ingress.Name,
-						Namespace: ingress.Namespace,
-					},
-				})
-				Expect(err).NotTo(HaveOccurred())
+				// Apply reconciler options from options.yaml, if present
+				if testCase.Options != nil {
+					Expect(yaml.Unmarshal(testCase.Options, reconciler)).To(Succeed())
+				}
 
-				// Wait for controller to process
-				time.Sleep(2 * time.Second)
+				By("Converting the Ingresses")
+				var gateways gatewayv1.GatewayList
+				Expect(k8sClient.List(ctx, &gateways)).To(Succeed())
+
+				var converted []gatewayv1.HTTPRoute
+				for _, ingress := range testCase.Ingresses() {
+					routes, err := reconciler.Convert(ctx, *ingress, gateways)
+					Expect(err).NotTo(HaveOccurred())
+					for _, route := range routes {
+						// Merged HTTPRoutes are generated for each Ingress sharing the hostname
+						if !slices.ContainsFunc(converted, func(c gatewayv1.HTTPRoute) bool { return c.Name == route.Name }) {
+							converted = append(converted, route)
+						}
+					}
+				}
 
-				// List all HTTPRoutes in the ingress namespace
-				By("Listing all HTTPRoutes in the ingress namespace")
-				routeList := &gatewayv1.HTTPRouteList{}
+				if golden.Update() {
+					By("Updating the expected HTTPRoutes")
+					Expect(testCase.WriteOutput(converted)).To(Succeed())
+					testCase, err = golden.Load(testdataDir, tc)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				Expect(converted).To(HaveLen(len(testCase.Output)),
+					fmt.Sprintf("Should convert to exactly %d HTTPRoutes", len(testCase.Output)))
+				for i := range converted {
+					validateHTTPRouteAgainstExpected(&converted[i], testCase.Expected(converted[i].Name))
+				}
+
+				By("Reconciling the Ingresses")
+				for _, ingress := range testCase.Ingresses() {
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{
+						NamespacedName: types.NamespacedName{
+							Name:      ingress.Name,
+							Namespace: ingress.Namespace,
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+				}
 
 				// Wait for the expected number of HTTPRoutes to be created
+				routeList := &gatewayv1.HTTPRouteList{}
 				Eventually(func() int {
-					err := k8sClient.List(ctx, routeList, ctrlclient.InNamespace(ingress.Namespace))
+					err := k8sClient.List(ctx, routeList)
 					if err != nil {
 						return -1
 					}
 					return len(routeList.Items)
-				}, timeout, interval).Should(Equal(len(expectedHTTPRoutes)),
-					fmt.Sprintf("Should have exactly %d HTTPRoutes in namespace %s", len(expectedHTTPRoutes), ingress.Namespace))
-
-				// Get the final list of routes
-				err = k8sClient.List(ctx, routeList, ctrlclient.InNamespace(ingress.Namespace))
-				Expect(err).NotTo(HaveOccurred())
+				}, timeout, interval).Should(Equal(len(testCase.Output)),
+					fmt.Sprintf("Should have exactly %d HTTPRoutes", len(testCase.Output)))
 
-				// Validate each created HTTPRoute matches one of the expected ones
+				// Validate each created HTTPRoute, as stored by the API server, matches the expected one
 				By(fmt.Sprintf("Validating %d created HTTPRoutes match expected", len(routeList.Items)))
 				for i := range routeList.Items {
-					actualRoute := &routeList.Items[i]
-
-					// Find the matching expected route (by hostname or other characteristics)
-					var matchedExpected *gatewayv1.HTTPRoute
-					for _, expected := range expectedHTTPRoutes {
-						// Try to match by hostnames (or lack thereof for catch-all routes)
-						if len(actualRoute.Spec.Hostnames) == len(expected.Spec.Hostnames) {
-							if len(actualRoute.Spec.Hostnames) == 0 {
-								// Both are catch-all routes
-								matchedExpected = expected
-								break
-							} else if len(actualRoute.Spec.Hostnames) > 0 &&
-								actualRoute.Spec.Hostnames[0] == expected.Spec.Hostnames[0] {
-								// Hostnames match
-								matchedExpected = expected
-								break
+					validateHTTPRouteAgainstExpected(&routeList.Items[i], testCase.Expected(routeList.Items[i].Name))
+				}
+
+				By("Reconciling the Ingresses again without updating the HTTPRoutes")
+				for _, ingress := range testCase.Ingresses() {
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+					Expect(err).NotTo(HaveOccurred())
+				}
+				for _, route := range routeList.Items {
+					current := gatewayv1.HTTPRoute{}
+					Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(&route), &current)).To(Succeed())
+					Expect(current.ResourceVersion).To(Equal(route.ResourceVersion),
+						fmt.Sprintf("HTTPRoute %s should not be updated", route.Name))
+				}
+
+				if reconciler.AnnotateIngress {
+					By("Validating the Ingresses are annotated with their HTTPRoutes")
+					for _, ingress := range testCase.Ingresses() {
+						var names []string
+						for _, route := range converted {
+							if isOwnedBy(route.ObjectMeta, createOwnerReference(*ingress)) {
+								names = append(names, route.Name)
 							}
 						}
+						annotated := networkingv1.Ingress{}
+						Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), &annotated)).To(Succeed())
+						Expect(annotated.Annotations).To(HaveKeyWithValue(routesAnnotation, strings.Join(names, ",")))
+						Expect(annotated.Annotations).To(HaveKeyWithValue(versionAnnotation, reconciler.Version))
+						Expect(annotated.Annotations).To(HaveKey(convertedAtAnnotation))
 					}
-
-					Expect(matchedExpected).NotTo(BeNil(),
-						fmt.Sprintf("HTTPRoute with hostnames %v should have a matching expected route", actualRoute.Spec.Hostnames))
-
-					// Validate against the matched expected route
-					validateHTTPRouteAgainstExpected(actualRoute, matchedExpected)
 				}
 			})
 		})
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultIngressClassAnnotation marks the IngressClass of the Ingresses without a class
+const defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+
+// ingressClass returns the IngressClass of the Ingress, from spec.ingressClassName or the legacy annotation. A retired
+// Ingress whose class was stripped keeps the class it had before.
+func ingressClass(ingress networkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		if *ingress.Spec.IngressClassName == retiredIngressClass {
+			return ingress.Annotations[retiredClassAnnotation]
+		}
+		return *ingress.Spec.IngressClassName
+	}
+	return ingress.Annotations[ingressClassAnnotation]
+}
+
+// MatchesIngressClass returns true if the Ingress belongs to one of the IngressClasses, or if none are given.
+// An Ingress without a class belongs to the default IngressClass, if there is one.
+func (r *IngressReconciler) MatchesIngressClass(ctx context.Context, ingress networkingv1.Ingress) (bool, error) {
+	return matchesIngressClass(ctx, r.Client, r.IngressClasses, ingress)
+}
+
+// matchesIngressClass returns true if the Ingress belongs to one of the IngressClasses, or if none are given
+func matchesIngressClass(ctx context.Context, c client.Reader, ingressClasses []string, ingress networkingv1.Ingress) (bool, error) {
+	if len(ingressClasses) == 0 {
+		return true, nil
+	}
+
+	class := ingressClass(ingress)
+	if class == "" {
+		var err error
+		if class, err = defaultIngressClass(ctx, c); err != nil {
+			return false, err
+		}
+	}
+	return class != "" && slices.Contains(ingressClasses, class), nil
+}
+
+// defaultIngressClass returns the name of the IngressClass marked as default, or an empty string if there is none
+func defaultIngressClass(ctx context.Context, c client.Reader) (string, error) {
+	var ingressClasses networkingv1.IngressClassList
+	if err := c.List(ctx, &ingressClasses); err != nil {
+		return "", err
+	}
+	for _, ingressClass := range ingressClasses.Items {
+		if ingressClass.Annotations[defaultIngressClassAnnotation] == "true" {
+			return ingressClass.Name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestMatchesIngressClass(t *testing.T) {
+	ctx := context.Background()
+	defaultClass := &networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{
+		Name:        "nginx",
+		Annotations: map[string]string{defaultIngressClassAnnotation: "true"},
+	}}
+
+	withClassName := func(class string) networkingv1.Ingress {
+		return networkingv1.Ingress{Spec: networkingv1.IngressSpec{IngressClassName: ptr.To(class)}}
+	}
+	withAnnotation := func(class string) networkingv1.Ingress {
+		return networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ingressClassAnnotation: class}}}
+	}
+
+	tests := []struct {
+		name           string
+		ingressClasses []string
+		objects        []client.Object
+		ingress        networkingv1.Ingress
+		expected       bool
+	}{
+		{name: "no filter", ingress: withClassName("traefik"), expected: true},
+		{name: "class name", ingressClasses: []string{"nginx"}, ingress: withClassName("nginx"), expected: true},
+		{name: "other class name", ingressClasses: []string{"nginx"}, ingress: withClassName("traefik")},
+		{name: "repeated", ingressClasses: []string{"nginx", "traefik"}, ingress: withClassName("traefik"), expected: true},
+		{name: "annotation", ingressClasses: []string{"nginx"}, ingress: withAnnotation("nginx"), expected: true},
+		{name: "class name over annotation", ingressClasses: []string{"nginx"},
+			ingress: networkingv1.Ingress{
+				ObjectMeta: withAnnotation("nginx").ObjectMeta,
+				Spec:       withClassName("traefik").Spec,
+			}},
+		{name: "default class", ingressClasses: []string{"nginx"}, objects: []client.Object{defaultClass}, expected: true},
+		{name: "no default class", ingressClasses: []string{"nginx"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &IngressReconciler{
+				Client:         fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(tt.objects...).Build(),
+				IngressClasses: tt.ingressClasses,
+			}
+			matches, err := r.MatchesIngressClass(ctx, tt.ingress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matches != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, matches)
+			}
+		})
+	}
+}
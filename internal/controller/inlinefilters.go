@@ -0,0 +1,98 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// filtersAnnotation adds a YAML or JSON list of HTTPRoute filters to every rule of the HTTPRoutes of an Ingress
+	filtersAnnotation = DefaultAnnotationPrefix + "filters"
+
+	// maxInlineFilters is the maximum number of filters of the filters annotation, the maximum of a rule
+	maxInlineFilters = 16
+)
+
+// inlineFilters returns the filters of the filters annotation of the Ingress, giving users a way to add the behavior
+// of the Gateway that has no Ingress equivalent without losing it to the next conversion. An annotation that cannot
+// be parsed or holds an invalid filter is ignored entirely with an Event.
+func (r *IngressReconciler) inlineFilters(ingress *networkingv1.Ingress) []gatewayv1.HTTPRouteFilter {
+	annotation := r.annotation(filtersAnnotation)
+	value := strings.TrimSpace(ingress.Annotations[annotation])
+	if value == "" {
+		return nil
+	}
+
+	var filters []gatewayv1.HTTPRouteFilter
+	err := yaml.UnmarshalStrict([]byte(value), &filters)
+	if err == nil {
+		err = validateFilters(filters)
+	}
+	if err != nil {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidFiltersAnnotation",
+			fmt.Sprintf("Ignoring %s annotation: %v", annotation, err))
+		return nil
+	}
+	// With the defaults of the API server, so the HTTPRoutes do not change when they are created
+	for i := range filters {
+		applyHTTPRouteFilterDefaults(&filters[i])
+	}
+	return filters
+}
+
+// validateFilters returns an error if there are more filters than a rule may have, or if a filter lacks the
+// configuration of its type or has that of another type
+func validateFilters(filters []gatewayv1.HTTPRouteFilter) error {
+	if len(filters) > maxInlineFilters {
+		return fmt.Errorf("%d filters exceed the maximum of %d", len(filters), maxInlineFilters)
+	}
+	for i, filter := range filters {
+		configured := []struct {
+			filterType gatewayv1.HTTPRouteFilterType
+			set        bool
+		}{
+			{gatewayv1.HTTPRouteFilterRequestHeaderModifier, filter.RequestHeaderModifier != nil},
+			{gatewayv1.HTTPRouteFilterResponseHeaderModifier, filter.ResponseHeaderModifier != nil},
+			{gatewayv1.HTTPRouteFilterRequestMirror, filter.RequestMirror != nil},
+			{gatewayv1.HTTPRouteFilterRequestRedirect, filter.RequestRedirect != nil},
+			{gatewayv1.HTTPRouteFilterURLRewrite, filter.URLRewrite != nil},
+			{gatewayv1.HTTPRouteFilterCORS, filter.CORS != nil},
+			{gatewayv1.HTTPRouteFilterExtensionRef, filter.ExtensionRef != nil},
+		}
+		known := false
+		for _, config := range configured {
+			switch {
+			case config.filterType == filter.Type && !config.set:
+				return fmt.Errorf("filter %d of type %s lacks its configuration", i, filter.Type)
+			case config.filterType != filter.Type && config.set:
+				return fmt.Errorf("filter %d of type %s has the configuration of %s", i, filter.Type, config.filterType)
+			}
+			known = known || config.filterType == filter.Type
+		}
+		if !known {
+			return fmt.Errorf("filter %d has unknown type %q", i, filter.Type)
+		}
+	}
+	return nil
+}
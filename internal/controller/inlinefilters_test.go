@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestInlineFilters(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app",
+		Namespace: "default",
+		Annotations: map[string]string{filtersAnnotation: `
+- type: RequestMirror
+  requestMirror:
+    backendRef:
+      name: shadow-service
+      port: 80
+- type: ExtensionRef
+  extensionRef:
+    group: filters.example.com
+    kind: RateLimit
+    name: app-limit
+`},
+	}}
+
+	filters := r.inlineFilters(ingress)
+	if len(filters) != 2 || filters[0].RequestMirror == nil || filters[1].ExtensionRef == nil {
+		t.Fatalf("expected a RequestMirror and an ExtensionRef filter, got %+v", filters)
+	}
+	if filters[0].RequestMirror.BackendRef.Name != "shadow-service" {
+		t.Errorf("unexpected mirror backend %+v", filters[0].RequestMirror.BackendRef)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(recorder.Events))
+	}
+
+	ingress.Annotations[filtersAnnotation] = `[{"type": "RequestHeaderModifier", "requestHeaderModifier": {"remove": ["X-Debug"]}}]`
+	if filters := r.inlineFilters(ingress); len(filters) != 1 || filters[0].Type != gatewayv1.HTTPRouteFilterRequestHeaderModifier {
+		t.Errorf("expected a RequestHeaderModifier filter from JSON, got %+v", filters)
+	}
+
+	for _, value := range []string{
+		"not: a list",
+		"- type: RequestRedirect",
+		"- type: URLRewrite\n  requestRedirect:\n    statusCode: 301\n  urlRewrite:\n    hostname: example.com",
+		"- type: Unknown",
+		"- type: RequestMirror\n  requestMirror:\n    backendRef:\n      name: shadow-service\n    unknownField: true",
+	} {
+		ingress.Annotations[filtersAnnotation] = value
+		if filters := r.inlineFilters(ingress); filters != nil {
+			t.Errorf("expected no filters for %q, got %+v", value, filters)
+		}
+		if event := <-recorder.Events; !strings.Contains(event, "InvalidFiltersAnnotation") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	filters := make([]gatewayv1.HTTPRouteFilter, maxInlineFilters+1)
+	for i := range filters {
+		filters[i] = gatewayv1.HTTPRouteFilter{
+			Type:         gatewayv1.HTTPRouteFilterExtensionRef,
+			ExtensionRef: &gatewayv1.LocalObjectReference{Kind: "Filter", Name: "filter"},
+		}
+	}
+	if err := validateFilters(filters[:maxInlineFilters]); err != nil {
+		t.Errorf("expected the maximum number of filters to be valid, got %v", err)
+	}
+	if err := validateFilters(filters); err == nil {
+		t.Errorf("expected an error for more than %d filters", maxInlineFilters)
+	}
+}
@@ -0,0 +1,706 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// IstioVirtualServiceGVK is the kind of the VirtualServices of Istio, which are converted by the
+// IstioVirtualServiceReconciler
+var IstioVirtualServiceGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "VirtualService"}
+
+const (
+	// istioRouteKind is the kind of the backends of the Ingress paths the HTTP routes of a VirtualService are mapped
+	// to, named after the index of the route among the HTTP routes of the VirtualService
+	istioRouteKind = "IstioRoute"
+	// istioMeshGateway is the reserved gateway name of the sidecars of the mesh, which VirtualServices bind to without
+	// gateways
+	istioMeshGateway = "mesh"
+	// istioDefaultRedirectCode is the status code of a redirect without a redirect code
+	istioDefaultRedirectCode = 301
+)
+
+// istioVirtualServiceSpec is the part of the spec of a VirtualService of Istio that is converted
+type istioVirtualServiceSpec struct {
+	Hosts    []string         `json:"hosts,omitempty"`
+	Gateways []string         `json:"gateways,omitempty"`
+	HTTP     []istioHTTPRoute `json:"http,omitempty"`
+}
+
+type istioHTTPRoute struct {
+	Name             string                  `json:"name,omitempty"`
+	Match            []istioHTTPMatch        `json:"match,omitempty"`
+	Route            []istioRouteDestination `json:"route,omitempty"`
+	Redirect         *istioRedirect          `json:"redirect,omitempty"`
+	DirectResponse   map[string]any          `json:"directResponse,omitempty"`
+	Delegate         map[string]any          `json:"delegate,omitempty"`
+	Rewrite          *istioRewrite           `json:"rewrite,omitempty"`
+	Timeout          string                  `json:"timeout,omitempty"`
+	Retries          *istioRetries           `json:"retries,omitempty"`
+	Mirror           *istioDestination       `json:"mirror,omitempty"`
+	MirrorPercentage *istioPercent           `json:"mirrorPercentage,omitempty"`
+	Mirrors          []istioMirror           `json:"mirrors,omitempty"`
+	Headers          *istioHeaders           `json:"headers,omitempty"`
+}
+
+type istioHTTPMatch struct {
+	URI         *istioStringMatch           `json:"uri,omitempty"`
+	Method      *istioStringMatch           `json:"method,omitempty"`
+	Headers     map[string]istioStringMatch `json:"headers,omitempty"`
+	QueryParams map[string]istioStringMatch `json:"queryParams,omitempty"`
+}
+
+type istioStringMatch struct {
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+}
+
+type istioDestination struct {
+	Host   string `json:"host"`
+	Subset string `json:"subset,omitempty"`
+	Port   *struct {
+		Number int32 `json:"number,omitempty"`
+	} `json:"port,omitempty"`
+}
+
+type istioRouteDestination struct {
+	Destination istioDestination `json:"destination"`
+	Weight      int32            `json:"weight,omitempty"`
+	Headers     *istioHeaders    `json:"headers,omitempty"`
+}
+
+type istioHeaders struct {
+	Request  *istioHeaderOperations `json:"request,omitempty"`
+	Response *istioHeaderOperations `json:"response,omitempty"`
+}
+
+type istioHeaderOperations struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+type istioRedirect struct {
+	URI          string  `json:"uri,omitempty"`
+	Authority    string  `json:"authority,omitempty"`
+	Port         int32   `json:"port,omitempty"`
+	Scheme       *string `json:"scheme,omitempty"`
+	RedirectCode int     `json:"redirectCode,omitempty"`
+}
+
+type istioRewrite struct {
+	URI       string `json:"uri,omitempty"`
+	Authority string `json:"authority,omitempty"`
+}
+
+type istioRetries struct {
+	Attempts      int    `json:"attempts,omitempty"`
+	PerTryTimeout string `json:"perTryTimeout,omitempty"`
+	RetryOn       string `json:"retryOn,omitempty"`
+}
+
+type istioPercent struct {
+	Value float64 `json:"value,omitempty"`
+}
+
+type istioMirror struct {
+	Destination istioDestination `json:"destination"`
+	Percentage  *istioPercent    `json:"percentage,omitempty"`
+}
+
+// IstioVirtualServiceReconciler converts the VirtualServices of Istio that are bound to gateways to HTTPRoutes. Each
+// VirtualService is mapped to an Ingress with a path for each of its HTTP routes, which is converted like any other
+// Ingress, so the VirtualServices attach to the Gateways of their hosts. The rules converted from the paths then
+// match, forward and modify the requests as the HTTP routes do. The generated HTTPRoutes are owned by the
+// VirtualService.
+type IstioVirtualServiceReconciler struct {
+	// IngressReconciler converts the Ingresses the VirtualServices are mapped to, with its settings. The features that
+	// write to an Ingress, such as annotating or retiring it, do not apply to VirtualServices.
+	*IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices/finalizers,verbs=update
+
+// Reconcile converts a VirtualService to the HTTPRoutes that should exist for it, and deletes the stale ones. The
+// HTTPRoutes of a deleted VirtualService are garbage collected, those in the namespaces of their Gateways are
+// deleted by its finalizer.
+func (r *IstioVirtualServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	virtualService := &unstructured.Unstructured{}
+	virtualService.SetGroupVersionKind(IstioVirtualServiceGVK)
+	if err := r.Get(ctx, req.NamespacedName, virtualService); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !virtualService.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalizeSource(audit.WithReason(ctx, audit.ReasonIngressFinalized), virtualService)
+	}
+
+	converter := r.sourceConverter(virtualService)
+	ingress, err := r.IstioVirtualServiceIngress(virtualService)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if converter.isPaused(ingress) {
+		logger.V(1).Info("skipping paused VirtualService")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := converter.listGateways(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gateways = converter.candidateGateways(gateways)
+
+	// The VirtualServices only bound to the sidecars of the mesh have no HTTPRoutes
+	if converter.placesRoutes() && len(ingress.Spec.Rules) > 0 {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), virtualService); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	httpRoutes, convertErr := r.ConvertIstioVirtualService(ctx, virtualService, ingress, gateways)
+	return converter.applyRoutes(ctx, ingress, gateways, httpRoutes, nil, convertErr)
+}
+
+// ConvertIstioVirtualService maps the VirtualService, with the Ingress returned by IstioVirtualServiceIngress, to the
+// HTTPRoutes that should exist for it, given the available Gateways. The rules converted from the paths of the
+// Ingress match the requests by the matches of their HTTP route, forward them to its destinations by weight, or
+// redirect them, and modify them with its rewrite, headers, mirrors and timeouts, and with RetryPolicies its retries.
+func (r *IstioVirtualServiceReconciler) ConvertIstioVirtualService(ctx context.Context, virtualService *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	spec, err := decodeIstioVirtualService(virtualService)
+	if err != nil {
+		return nil, err
+	}
+	converter := r.sourceConverter(virtualService)
+	converter.completeSourceRules = func(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) error {
+		for i := range httpRoutes {
+			rules := httpRoutes[i].Spec.Rules
+			for j := range rules {
+				name, ok := sourceRuleName(rules[j], istioRouteKind)
+				if !ok {
+					continue
+				}
+				index, err := strconv.Atoi(name)
+				if err != nil || index >= len(spec.HTTP) {
+					continue
+				}
+				if err := r.completeIstioRule(ctx, virtualService, spec.HTTP[index], &rules[j]); err != nil {
+					return err
+				}
+			}
+			slices.SortStableFunc(rules, compareHTTPRouteRule)
+		}
+		return nil
+	}
+	return converter.Convert(ctx, ingress, gateways)
+}
+
+// IstioVirtualServiceIngress returns the Ingress the VirtualService is mapped to. It carries the kind, name and UID of
+// the VirtualService, so the VirtualService owns the generated HTTPRoutes, and its annotations, so the annotations of
+// the controller apply. Each HTTP route of the VirtualService is a path for each of its hosts, where * matches any
+// host. VirtualServices that only bind to the sidecars of the mesh have no paths. The fields that are not converted,
+// and HTTP routes that cannot be, are reported with an Event.
+func (r *IstioVirtualServiceReconciler) IstioVirtualServiceIngress(virtualService *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	spec, err := decodeIstioVirtualService(virtualService)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	converter := r.sourceConverter(virtualService)
+
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: IstioVirtualServiceGVK.GroupVersion().String(),
+			Kind:       IstioVirtualServiceGVK.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        virtualService.GetName(),
+			Namespace:   virtualService.GetNamespace(),
+			UID:         virtualService.GetUID(),
+			Annotations: make(map[string]string),
+		},
+	}
+	for key, value := range virtualService.GetAnnotations() {
+		ingress.Annotations[key] = value
+	}
+	if !slices.ContainsFunc(spec.Gateways, func(gateway string) bool { return gateway != istioMeshGateway }) {
+		return ingress, nil
+	}
+
+	if unconverted := unconvertedFields(virtualService.Object["spec"], r.istioConvertedFields(), "spec"); len(unconverted) > 0 {
+		converter.event(virtualService, corev1.EventTypeWarning, "UnconvertedFields",
+			fmt.Sprintf("Fields %s have no HTTPRoute equivalent and are not converted", strings.Join(unconverted, ", ")))
+	}
+
+	var paths []networkingv1.HTTPIngressPath
+	for i, route := range spec.HTTP {
+		var reason string
+		switch {
+		case route.Delegate != nil:
+			reason = "it delegates to another VirtualService"
+		case route.DirectResponse != nil:
+			reason = "direct responses have no HTTPRoute equivalent"
+		case len(route.Route) == 0 && route.Redirect == nil:
+			reason = "it has no destinations"
+		default:
+			if _, err := istioMatches(route.Match); err != nil {
+				reason = err.Error()
+			}
+		}
+		if reason != "" {
+			converter.event(virtualService, corev1.EventTypeWarning, "UnsupportedRoute",
+				fmt.Sprintf("HTTP route %d is not converted: %s", i, reason))
+			continue
+		}
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     "/",
+			PathType: ptr.To(networkingv1.PathTypePrefix),
+			Backend:  sourceRuleBackend(istioRouteKind, strconv.Itoa(i)),
+		})
+	}
+	if len(paths) == 0 {
+		return ingress, nil
+	}
+	for _, host := range spec.Hosts {
+		if host == "*" {
+			host = ""
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host:             strings.ToLower(host),
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: slices.Clone(paths)}},
+		})
+	}
+	return ingress, nil
+}
+
+// decodeIstioVirtualService returns the spec of the VirtualService
+func decodeIstioVirtualService(virtualService *unstructured.Unstructured) (istioVirtualServiceSpec, error) {
+	var spec istioVirtualServiceSpec
+	content, _, err := unstructured.NestedMap(virtualService.UnstructuredContent(), "spec")
+	if err != nil {
+		return spec, err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec)
+	return spec, err
+}
+
+// istioConvertedFields returns the fields of the spec of a VirtualService that are converted with the settings of the
+// reconciler. Delegates and direct responses are reported as unsupported routes instead.
+func (r *IstioVirtualServiceReconciler) istioConvertedFields() fieldSet {
+	destination := fieldSet{"host": nil, "port": nil}
+	route := fieldSet{
+		"name":             nil,
+		"match":            fieldSet{"name": nil, "uri": nil, "method": nil, "headers": nil, "queryParams": nil},
+		"route":            fieldSet{"destination": destination, "weight": nil, "headers": nil},
+		"redirect":         fieldSet{"uri": nil, "authority": nil, "port": nil, "scheme": nil, "redirectCode": nil},
+		"rewrite":          fieldSet{"uri": nil, "authority": nil},
+		"mirror":           destination,
+		"mirrorPercentage": nil,
+		"mirrors":          fieldSet{"destination": destination, "percentage": nil},
+		"headers":          nil,
+		"delegate":         nil,
+		"directResponse":   nil,
+	}
+	retries := fieldSet{}
+	if !r.OmitTimeouts {
+		route["timeout"] = nil
+		retries["perTryTimeout"] = nil
+	}
+	if r.RetryPolicies {
+		retries["attempts"] = nil
+		retries["retryOn"] = nil
+	}
+	route["retries"] = retries
+	return fieldSet{
+		"hosts":    nil,
+		"gateways": nil,
+		"exportTo": nil,
+		"http":     route,
+	}
+}
+
+// istioMatches returns the HTTPRoute matches of the matches of an HTTP route, any of which a request must satisfy.
+// Prefixes of headers and query parameters are matched with a regular expression, methods can only be matched
+// exactly.
+func istioMatches(matches []istioHTTPMatch) ([]gatewayv1.HTTPRouteMatch, error) {
+	if len(matches) == 0 {
+		matches = []istioHTTPMatch{{}}
+	}
+	var result []gatewayv1.HTTPRouteMatch
+	for _, m := range matches {
+		match := gatewayv1.HTTPRouteMatch{
+			Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")},
+		}
+		if uri := m.URI; uri != nil {
+			switch {
+			case uri.Exact != "":
+				match.Path = &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To(uri.Exact)}
+			case uri.Prefix != "":
+				match.Path = &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To(uri.Prefix)}
+			case uri.Regex != "":
+				match.Path = &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchRegularExpression), Value: ptr.To(uri.Regex)}
+			}
+		}
+		if method := m.Method; method != nil {
+			if method.Exact == "" {
+				return nil, fmt.Errorf("methods can only be matched exactly")
+			}
+			match.Method = ptr.To(gatewayv1.HTTPMethod(strings.ToUpper(method.Exact)))
+		}
+		for _, name := range sortedKeys(m.Headers) {
+			matchType, value := istioStringMatchValue(m.Headers[name])
+			match.Headers = append(match.Headers, gatewayv1.HTTPHeaderMatch{
+				Type:  ptr.To(gatewayv1.HeaderMatchType(matchType)),
+				Name:  gatewayv1.HTTPHeaderName(name),
+				Value: value,
+			})
+		}
+		for _, name := range sortedKeys(m.QueryParams) {
+			matchType, value := istioStringMatchValue(m.QueryParams[name])
+			match.QueryParams = append(match.QueryParams, gatewayv1.HTTPQueryParamMatch{
+				Type:  ptr.To(gatewayv1.QueryParamMatchType(matchType)),
+				Name:  gatewayv1.HTTPHeaderName(name),
+				Value: value,
+			})
+		}
+		result = append(result, match)
+	}
+	return result, nil
+}
+
+// istioStringMatchValue returns the match type and value of a string match of a header or query parameter, with a
+// regular expression for a prefix and for a match without a value, which matches any value
+func istioStringMatchValue(match istioStringMatch) (string, string) {
+	switch {
+	case match.Exact != "":
+		return string(gatewayv1.HeaderMatchExact), match.Exact
+	case match.Prefix != "":
+		return string(gatewayv1.HeaderMatchRegularExpression), "^" + regexp.QuoteMeta(match.Prefix) + ".*"
+	case match.Regex != "":
+		return string(gatewayv1.HeaderMatchRegularExpression), match.Regex
+	default:
+		return string(gatewayv1.HeaderMatchRegularExpression), ".*"
+	}
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// completeIstioRule makes the rule converted from the path of the HTTP route match, forward and modify the requests
+// as the HTTP route does
+func (r *IstioVirtualServiceReconciler) completeIstioRule(ctx context.Context, virtualService *unstructured.Unstructured, route istioHTTPRoute, rule *gatewayv1.HTTPRouteRule) error {
+	matches, err := istioMatches(route.Match)
+	if err != nil {
+		return err
+	}
+	rule.Matches = matches
+	rule.BackendRefs = nil
+
+	filters := rule.Filters
+	filters = append(filters, istioHeaderFilters(route.Headers)...)
+	if redirect := route.Redirect; redirect != nil {
+		rule.Filters = mergeHeaderFilters(append(filters, istioRedirectFilter(*redirect)))
+		return nil
+	}
+	if rewrite := r.istioRewriteFilter(virtualService, route.Rewrite, matches); rewrite != nil {
+		filters = append(filters, *rewrite)
+	}
+
+	for _, destination := range route.Route {
+		weight := r.backendWeight()
+		if len(route.Route) > 1 {
+			weight = ptr.To(destination.Weight)
+		}
+		backendRef, err := r.istioBackendRef(ctx, virtualService, destination.Destination, weight)
+		if err != nil {
+			return err
+		}
+		if backendRef == nil {
+			continue
+		}
+		backendRef.Filters = istioHeaderFilters(destination.Headers)
+		rule.BackendRefs = append(rule.BackendRefs, *backendRef)
+	}
+
+	mirrors := route.Mirrors
+	if route.Mirror != nil {
+		mirrors = append([]istioMirror{{Destination: *route.Mirror, Percentage: route.MirrorPercentage}}, mirrors...)
+	}
+	for _, mirror := range mirrors {
+		backendRef, err := r.istioBackendRef(ctx, virtualService, mirror.Destination, nil)
+		if err != nil {
+			return err
+		}
+		if backendRef == nil {
+			continue
+		}
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:          gatewayv1.HTTPRouteFilterRequestMirror,
+			RequestMirror: istioMirrorFilter(backendRef.BackendObjectReference, mirror.Percentage),
+		})
+	}
+	rule.Filters = mergeHeaderFilters(filters)
+
+	if !r.OmitTimeouts {
+		rule.Timeouts = r.istioTimeouts(virtualService, route)
+	}
+	if retries := route.Retries; retries != nil && r.RetryPolicies {
+		rule.Retry = r.envoyRetry(virtualService, retries.Attempts, strings.Split(retries.RetryOn, ","))
+	}
+	return nil
+}
+
+// istioBackendRef returns the backend ref of the Service of a destination, or nil if the host of the destination is no
+// Service or its port cannot be determined, which is reported with an Event. The host is the name of a Service in the
+// namespace of the VirtualService, or its cluster DNS name. A destination without a port forwards to the only port of
+// the Service.
+func (r *IstioVirtualServiceReconciler) istioBackendRef(ctx context.Context, virtualService *unstructured.Unstructured, destination istioDestination, weight *int32) (*gatewayv1.HTTPBackendRef, error) {
+	unsupported := func(reason string) (*gatewayv1.HTTPBackendRef, error) {
+		r.sourceConverter(virtualService).event(virtualService, corev1.EventTypeWarning, "UnsupportedDestination",
+			fmt.Sprintf("Destination %s %s, it is not converted", destination.Host, reason))
+		return nil, nil
+	}
+
+	name, namespace, ok := sourceServiceName(destination.Host, virtualService.GetNamespace())
+	if !ok {
+		return unsupported("is not the name of a Service")
+	}
+	var port int32
+	if destination.Port != nil {
+		port = destination.Port.Number
+	}
+	if port == 0 {
+		if r.DisableServiceLookups {
+			return unsupported("has no port and Service lookups are disabled")
+		}
+		service := &corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, service); errors.IsNotFound(err) {
+			return unsupported("has no port and its Service does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+		if len(service.Spec.Ports) != 1 {
+			return unsupported("has no port and its Service does not have exactly one port")
+		}
+		port = service.Spec.Ports[0].Port
+	}
+
+	backendRef, err := r.mapBackendRef(ctx, namespace, networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: name, Port: networkingv1.ServiceBackendPort{Number: port}},
+	}, weight)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != virtualService.GetNamespace() {
+		if err := r.sourceReferenceGranted(ctx, virtualService, backendRef.BackendObjectReference); err != nil {
+			return nil, err
+		}
+	}
+	return backendRef, nil
+}
+
+// istioHeaderFilters returns the header modifier filters of the header operations of the requests and responses
+func istioHeaderFilters(headers *istioHeaders) []gatewayv1.HTTPRouteFilter {
+	if headers == nil {
+		return nil
+	}
+	var filters []gatewayv1.HTTPRouteFilter
+	if modifier := istioHeaderModifier(headers.Request); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                  gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: modifier,
+		})
+	}
+	if modifier := istioHeaderModifier(headers.Response); modifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: modifier,
+		})
+	}
+	return filters
+}
+
+// istioHeaderModifier returns the header filter of the header operations, or nil if there are none
+func istioHeaderModifier(operations *istioHeaderOperations) *gatewayv1.HTTPHeaderFilter {
+	if operations == nil || len(operations.Set)+len(operations.Add)+len(operations.Remove) == 0 {
+		return nil
+	}
+	modifier := &gatewayv1.HTTPHeaderFilter{Remove: operations.Remove}
+	for _, name := range sortedKeys(operations.Set) {
+		modifier.Set = append(modifier.Set, gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(name), Value: operations.Set[name]})
+	}
+	for _, name := range sortedKeys(operations.Add) {
+		modifier.Add = append(modifier.Add, gatewayv1.HTTPHeader{Name: gatewayv1.HTTPHeaderName(name), Value: operations.Add[name]})
+	}
+	return modifier
+}
+
+// istioRedirectFilter returns the redirect filter of the redirect, which replaces the whole path and redirects with a
+// 301 by default
+func istioRedirectFilter(redirect istioRedirect) gatewayv1.HTTPRouteFilter {
+	filter := &gatewayv1.HTTPRequestRedirectFilter{
+		Scheme:     redirect.Scheme,
+		StatusCode: ptr.To(redirect.RedirectCode),
+	}
+	if redirect.RedirectCode == 0 {
+		filter.StatusCode = ptr.To(istioDefaultRedirectCode)
+	}
+	if redirect.Authority != "" {
+		filter.Hostname = ptr.To(gatewayv1.PreciseHostname(redirect.Authority))
+	}
+	if redirect.Port != 0 {
+		filter.Port = ptr.To(gatewayv1.PortNumber(redirect.Port))
+	}
+	if redirect.URI != "" {
+		filter.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(redirect.URI)}
+	}
+	return gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: filter}
+}
+
+// istioRewriteFilter returns the URL rewrite filter of the rewrite, or nil if there is none. Istio replaces the
+// matched prefix of prefix matches and the whole path of exact matches; the path of HTTP routes that mix them or
+// match by regular expression cannot be rewritten, which is reported with an Event.
+func (r *IstioVirtualServiceReconciler) istioRewriteFilter(virtualService *unstructured.Unstructured, rewrite *istioRewrite, matches []gatewayv1.HTTPRouteMatch) *gatewayv1.HTTPRouteFilter {
+	if rewrite == nil || rewrite.URI == "" && rewrite.Authority == "" {
+		return nil
+	}
+	filter := &gatewayv1.HTTPURLRewriteFilter{}
+	if rewrite.Authority != "" {
+		filter.Hostname = ptr.To(gatewayv1.PreciseHostname(rewrite.Authority))
+	}
+	if rewrite.URI != "" {
+		pathTypes := map[gatewayv1.PathMatchType]bool{}
+		for _, match := range matches {
+			pathTypes[*match.Path.Type] = true
+		}
+		switch {
+		case len(pathTypes) == 1 && pathTypes[gatewayv1.PathMatchPathPrefix]:
+			filter.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To(rewrite.URI)}
+		case len(pathTypes) == 1 && pathTypes[gatewayv1.PathMatchExact]:
+			filter.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(rewrite.URI)}
+		default:
+			r.sourceConverter(virtualService).event(virtualService, corev1.EventTypeWarning, "UnsupportedRewrite",
+				fmt.Sprintf("The path cannot be rewritten to %s, the HTTP route does not only match prefixes or only exact paths", rewrite.URI))
+		}
+	}
+	if filter.Hostname == nil && filter.Path == nil {
+		return nil
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: filter}
+}
+
+// istioMirrorFilter returns the mirror filter of the backend, mirroring the percentage of the requests, or all of them
+// without a percentage
+func istioMirrorFilter(backend gatewayv1.BackendObjectReference, percentage *istioPercent) *gatewayv1.HTTPRequestMirrorFilter {
+	mirror := &gatewayv1.HTTPRequestMirrorFilter{BackendRef: backend}
+	switch {
+	case percentage == nil || percentage.Value >= 100:
+	case percentage.Value == math.Trunc(percentage.Value):
+		mirror.Percent = ptr.To(int32(percentage.Value))
+	default:
+		mirror.Fraction = &gatewayv1.Fraction{
+			Numerator:   int32(math.Round(percentage.Value * 1000)),
+			Denominator: ptr.To[int32](100000),
+		}
+	}
+	return mirror
+}
+
+// istioTimeouts returns the timeouts of the HTTP route and of the tries of its retries, or nil if it has neither. An
+// unparsable timeout is ignored with an Event.
+func (r *IstioVirtualServiceReconciler) istioTimeouts(virtualService *unstructured.Unstructured, route istioHTTPRoute) *gatewayv1.HTTPRouteTimeouts {
+	timeouts := &gatewayv1.HTTPRouteTimeouts{}
+	if route.Timeout != "" {
+		timeouts.Request = r.istioDuration(virtualService, route.Timeout)
+	}
+	if route.Retries != nil && route.Retries.PerTryTimeout != "" {
+		timeouts.BackendRequest = r.istioDuration(virtualService, route.Retries.PerTryTimeout)
+	}
+	if timeouts.Request == nil && timeouts.BackendRequest == nil {
+		return nil
+	}
+	return timeouts
+}
+
+// istioDuration returns the Gateway API duration of a duration of Istio, where 0s disables a timeout in both
+func (r *IstioVirtualServiceReconciler) istioDuration(virtualService *unstructured.Unstructured, value string) *gatewayv1.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		r.sourceConverter(virtualService).event(virtualService, corev1.EventTypeWarning, "UnsupportedTimeout",
+			fmt.Sprintf("Timeout %q is not a duration, it is not converted", value))
+		return nil
+	}
+	return ptr.To(formatPreciseDuration(duration))
+}
+
+// istioVirtualServiceHosts returns the hosts of a VirtualService bound to gateways to index it by, where * matches
+// any host, and none for a VirtualService only bound to the mesh or that cannot be decoded
+func istioVirtualServiceHosts(virtualService *unstructured.Unstructured) []string {
+	spec, err := decodeIstioVirtualService(virtualService)
+	if err != nil || !slices.ContainsFunc(spec.Gateways, func(gateway string) bool { return gateway != istioMeshGateway }) {
+		return nil
+	}
+	var hosts []string
+	for _, host := range spec.Hosts {
+		if host != "*" {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	return hosts
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *IstioVirtualServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b, err := r.sourceControllerBuilder(mgr, "istiovirtualservice", IstioVirtualServiceGVK, istioVirtualServiceHosts)
+	if err != nil {
+		return err
+	}
+	return b.Complete(r)
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func testIstioVirtualServiceReconciler(recorder record.EventRecorder, objects ...client.Object) *IstioVirtualServiceReconciler {
+	return &IstioVirtualServiceReconciler{IngressReconciler: &IngressReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(objects...).Build(),
+		Recorder:      recorder,
+		RetryPolicies: true,
+	}}
+}
+
+func TestIstioMatches(t *testing.T) {
+	matches, err := istioMatches([]istioHTTPMatch{
+		{
+			URI:         &istioStringMatch{Prefix: "/api"},
+			Method:      &istioStringMatch{Exact: "get"},
+			Headers:     map[string]istioStringMatch{"x-tenant": {Prefix: "acme."}, "x-debug": {}},
+			QueryParams: map[string]istioStringMatch{"version": {Regex: "v[12]"}},
+		},
+		{URI: &istioStringMatch{Exact: "/health"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []gatewayv1.HTTPRouteMatch{
+		{
+			Path:   &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/api")},
+			Method: ptr.To(gatewayv1.HTTPMethodGet),
+			Headers: []gatewayv1.HTTPHeaderMatch{
+				{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "x-debug", Value: ".*"},
+				{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "x-tenant", Value: `^acme\..*`},
+			},
+			QueryParams: []gatewayv1.HTTPQueryParamMatch{
+				{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "version", Value: "v[12]"},
+			},
+		},
+		{Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/health")}},
+	}
+	if !isEqual(matches, expected) {
+		t.Errorf("unexpected matches: %+v", matches)
+	}
+
+	if _, err := istioMatches([]istioHTTPMatch{{Method: &istioStringMatch{Prefix: "P"}}}); err == nil {
+		t.Error("expected an error for a method prefix")
+	}
+}
+
+func TestSourceServiceName(t *testing.T) {
+	for host, expected := range map[string][3]string{
+		"app":                          {"app", "default", "true"},
+		"app.api":                      {"app", "api", "true"},
+		"app.api.svc.cluster.local":    {"app", "api", "true"},
+		"www.example.com":              {"", "", "false"},
+		"payments.external.example.io": {"", "", "false"},
+	} {
+		name, namespace, ok := sourceServiceName(host, "default")
+		if actual := [3]string{name, namespace, fmt.Sprint(ok)}; actual != expected {
+			t.Errorf("%s: expected %v, got %v", host, expected, actual)
+		}
+	}
+}
+
+func TestConvertIstioVirtualService(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(20)
+	virtualService := sourceObject(IstioVirtualServiceGVK, "default", "app", map[string]any{
+		"hosts":    []any{"app.example.com"},
+		"gateways": []any{"istio-system/ingressgateway", "mesh"},
+		"http": []any{
+			map[string]any{
+				"match":   []any{map[string]any{"uri": map[string]any{"prefix": "/api"}}},
+				"rewrite": map[string]any{"uri": "/", "authority": "api.internal"},
+				"route": []any{map[string]any{
+					"destination": map[string]any{"host": "api.api.svc.cluster.local", "port": map[string]any{"number": int64(8080)}},
+				}},
+				"timeout": "10s",
+				"retries": map[string]any{"attempts": int64(3), "perTryTimeout": "500ms", "retryOn": "gateway-error,connect-failure,429"},
+			},
+			map[string]any{
+				"match":    []any{map[string]any{"uri": map[string]any{"exact": "/old"}}},
+				"redirect": map[string]any{"uri": "/new"},
+			},
+			map[string]any{
+				"route": []any{
+					map[string]any{"destination": map[string]any{"host": "app", "port": map[string]any{"number": int64(80)}}, "weight": int64(90)},
+					map[string]any{"destination": map[string]any{"host": "app-canary", "subset": "v2"}, "weight": int64(10)},
+				},
+				"mirror":           map[string]any{"host": "app-shadow", "port": map[string]any{"number": int64(80)}},
+				"mirrorPercentage": map[string]any{"value": 12.5},
+				"headers":          map[string]any{"request": map[string]any{"set": map[string]any{"x-env": "prod"}}},
+				"fault":            map[string]any{"abort": map[string]any{"httpStatus": int64(503)}},
+			},
+			map[string]any{"directResponse": map[string]any{"status": int64(503)}},
+		},
+		"tcp": []any{map[string]any{"route": []any{}}},
+	})
+	r := testIstioVirtualServiceReconciler(recorder, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app-canary"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8080}}},
+	})
+
+	ingress, err := r.IstioVirtualServiceIngress(virtualService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := createOwnerReference(ingress); owner.Kind != "VirtualService" || owner.APIVersion != "networking.istio.io/v1beta1" {
+		t.Errorf("expected the VirtualService to own the routes, got %+v", owner)
+	}
+	if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != "app.example.com" || len(ingress.Spec.Rules[0].HTTP.Paths) != 3 {
+		t.Errorf("unexpected spec: %+v", ingress.Spec)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnconvertedFields") ||
+		!strings.Contains(event, "spec.http[2].fault") ||
+		!strings.Contains(event, "spec.http[2].route[1].destination.subset") ||
+		!strings.Contains(event, "spec.tcp") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRoute") || !strings.Contains(event, "HTTP route 3") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	httpRoutes, err := r.ConvertIstioVirtualService(ctx, virtualService, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 {
+		t.Fatalf("expected 1 HTTPRoute, got %d", len(httpRoutes))
+	}
+	rules := httpRoutes[0].Spec.Rules
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %+v", rules)
+	}
+	redirect, api, app := rules[0], rules[1], rules[2]
+
+	expectedRedirect := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+		RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+			Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/new")},
+			StatusCode: ptr.To(301),
+		},
+	}}
+	if *redirect.Matches[0].Path.Value != "/old" || len(redirect.BackendRefs) != 0 || !isEqual(redirect.Filters, expectedRedirect) {
+		t.Errorf("unexpected redirect rule: %+v", redirect)
+	}
+
+	if api.BackendRefs[0].Name != "api" || *api.BackendRefs[0].Namespace != "api" || *api.BackendRefs[0].Port != 8080 {
+		t.Errorf("unexpected backends: %+v", api.BackendRefs)
+	}
+	expectedRewrite := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterURLRewrite,
+		URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+			Hostname: ptr.To(gatewayv1.PreciseHostname("api.internal")),
+			Path:     &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To("/")},
+		},
+	}}
+	if !isEqual(api.Filters, expectedRewrite) {
+		t.Errorf("unexpected filters: %+v", api.Filters)
+	}
+	expectedTimeouts := &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("10s")), BackendRequest: ptr.To(gatewayv1.Duration("500ms"))}
+	if !isEqual(api.Timeouts, expectedTimeouts) {
+		t.Errorf("unexpected timeouts: %+v", api.Timeouts)
+	}
+	expectedRetry := &gatewayv1.HTTPRouteRetry{Attempts: ptr.To(3), Codes: []gatewayv1.HTTPRouteRetryStatusCode{429, 502, 503, 504}}
+	if !isEqual(api.Retry, expectedRetry) {
+		t.Errorf("unexpected retry: %+v", api.Retry)
+	}
+
+	var backends []string
+	for _, backendRef := range app.BackendRefs {
+		backends = append(backends, fmt.Sprintf("%s:%d:%d", backendRef.Name, *backendRef.Port, *backendRef.Weight))
+	}
+	if !isEqual(backends, []string{"app:80:90", "app-canary:8080:10"}) {
+		t.Errorf("unexpected backends: %v", backends)
+	}
+	expectedFilters := []gatewayv1.HTTPRouteFilter{
+		{Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier, RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set: []gatewayv1.HTTPHeader{{Name: "x-env", Value: "prod"}},
+		}},
+		{Type: gatewayv1.HTTPRouteFilterRequestMirror, RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{
+			BackendRef: gatewayv1.BackendObjectReference{
+				Group:     ptr.To(gatewayv1.Group("")),
+				Kind:      ptr.To(gatewayv1.Kind("Service")),
+				Namespace: ptr.To(gatewayv1.Namespace("default")),
+				Name:      "app-shadow",
+				Port:      ptr.To(gatewayv1.PortNumber(80)),
+			},
+			Fraction: &gatewayv1.Fraction{Numerator: 12500, Denominator: ptr.To[int32](100000)},
+		}},
+	}
+	if !isEqual(app.Filters, expectedFilters) {
+		t.Errorf("unexpected filters: %+v", app.Filters)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	if joined := strings.Join(events, "\n"); !strings.Contains(joined, string(gatewayv1.RouteReasonRefNotPermitted)) ||
+		!strings.Contains(joined, "UnsupportedRetryOn") || !strings.Contains(joined, "connect-failure") {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestIstioVirtualServiceIngressMesh(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := testIstioVirtualServiceReconciler(recorder)
+
+	// VirtualServices only bound to the sidecars of the mesh are not converted
+	for _, gateways := range [][]any{nil, {"mesh"}} {
+		spec := map[string]any{
+			"hosts": []any{"app"},
+			"http":  []any{map[string]any{"route": []any{map[string]any{"destination": map[string]any{"host": "app"}}}}},
+		}
+		if gateways != nil {
+			spec["gateways"] = gateways
+		}
+		ingress, err := r.IstioVirtualServiceIngress(sourceObject(IstioVirtualServiceGVK, "default", "app", spec))
+		if err != nil || len(ingress.Spec.Rules) != 0 {
+			t.Errorf("expected no rules for gateways %v, got %+v, %v", gateways, ingress.Spec.Rules, err)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(recorder.Events))
+	}
+}
+
+func TestIstioVirtualServiceHostIndex(t *testing.T) {
+	r := &IngressReconciler{}
+	virtualService := sourceObject(IstioVirtualServiceGVK, "default", "app", map[string]any{
+		"hosts":    []any{"App.example.com", "*"},
+		"gateways": []any{"istio-system/ingress"},
+	})
+	if keys := r.indexSourceHosts(istioVirtualServiceHosts)(virtualService); !slices.Equal(keys, []string{"app.example.com", "*.example.com", "*.com"}) {
+		t.Errorf("expected the VirtualService to be indexed by its host, got %v", keys)
+	}
+	mesh := sourceObject(IstioVirtualServiceGVK, "default", "app", map[string]any{"hosts": []any{"app.example.com"}})
+	if keys := r.indexSourceHosts(istioVirtualServiceHosts)(mesh); len(keys) != 0 {
+		t.Errorf("expected a VirtualService of the mesh not to be indexed, got %v", keys)
+	}
+}
@@ -0,0 +1,434 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayxv1alpha1 "sigs.k8s.io/gateway-api/apisx/v1alpha1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// managedListenersAnnotation lists the listeners of the managed Gateway that were added by the controller, the other
+// listeners are left alone
+const managedListenersAnnotation = "ingress2httproute.lion7.dev/listeners"
+
+// listenerSetSuffix is appended to the name of the managed Gateway for the name of its XListenerSet
+const listenerSetSuffix = "-ingresses"
+
+// ListenerReconciler adds listeners to a managed Gateway for the hosts of the Ingresses that no listener accepts, and
+// removes them again once no Ingress needs them. A host gets an HTTP listener on port 80, and an HTTPS listener on
+// port 443 if an Ingress has a TLS Secret for it. The listeners accept routes from all namespaces.
+type ListenerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Gateway is the Gateway the listeners are added to
+	Gateway types.NamespacedName
+	// ListenerSet adds the listeners to an XListenerSet attached to the Gateway instead of the Gateway itself
+	ListenerSet bool
+	// GatewayClasses limits the listeners that accept the hosts, to those of Gateways of these GatewayClasses if set
+	GatewayClasses []gatewayv1.ObjectName
+	// IngressClasses limits the Ingresses whose hosts get a listener, like the Ingresses that are converted
+	IngressClasses []string
+	audit.Auditor
+	// Recorder emits Events on the Gateway and the Ingresses, no Events are emitted if unset
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=gateway.networking.x-k8s.io,resources=xlistenersets,verbs=get;list;watch;create;update;delete
+
+// Reconcile updates the managed listeners to the hosts of the current Ingresses without a listener
+func (r *ListenerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.NamespacedName != r.Gateway {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx)
+	ctx = audit.WithReason(ctx, audit.ReasonListenersManaged)
+
+	gateway := &gatewayv1.Gateway{}
+	if err := r.Get(ctx, r.Gateway, gateway); err != nil {
+		if errors.IsNotFound(err) {
+			// The XListenerSet is garbage collected with the Gateway
+			logger.Info("managed Gateway not found", "name", r.Gateway)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	var gateways gatewayv1.GatewayList
+	if err := r.List(ctx, &gateways); err != nil {
+		return ctrl.Result{}, err
+	}
+	candidates := slices.DeleteFunc(gateways.Items, func(gateway gatewayv1.Gateway) bool {
+		return len(r.GatewayClasses) > 0 && !slices.Contains(r.GatewayClasses, gateway.Spec.GatewayClassName)
+	})
+	var managed []string
+	if r.ListenerSet {
+		var listenerSets gatewayxv1alpha1.XListenerSetList
+		if err := r.List(ctx, &listenerSets); err != nil {
+			return ctrl.Result{}, err
+		}
+		own := r.listenerSetName()
+		others := slices.DeleteFunc(listenerSets.Items, func(listenerSet gatewayxv1alpha1.XListenerSet) bool {
+			return listenerSet.Namespace == own.Namespace && listenerSet.Name == own.Name
+		})
+		candidates = append(candidates, listenerSetGateways(others, candidates)...)
+	} else if value := gateway.Annotations[managedListenersAnnotation]; value != "" {
+		managed = strings.Split(value, ",")
+	}
+	// The managed listeners themselves do not accept the hosts, or they would never be removed
+	for i := range candidates {
+		if candidates[i].Namespace == r.Gateway.Namespace && candidates[i].Name == r.Gateway.Name {
+			candidates[i].Spec.Listeners = slices.DeleteFunc(slices.Clone(candidates[i].Spec.Listeners), func(listener gatewayv1.Listener) bool {
+				return slices.Contains(managed, string(listener.Name))
+			})
+		}
+	}
+
+	ingresses, err := r.ingresses(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	listeners, err := r.listeners(ctx, ingresses, candidates)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if r.ListenerSet {
+		return ctrl.Result{}, r.reconcileListenerSet(ctx, gateway, listeners)
+	}
+	return ctrl.Result{}, r.reconcileGatewayListeners(ctx, gateway, managed, listeners)
+}
+
+// ingresses returns the Ingresses of the IngressClasses that are not being deleted
+func (r *ListenerReconciler) ingresses(ctx context.Context) ([]networkingv1.Ingress, error) {
+	var ingressList networkingv1.IngressList
+	if err := r.List(ctx, &ingressList); err != nil {
+		return nil, err
+	}
+	var result []networkingv1.Ingress
+	for _, ingress := range ingressList.Items {
+		if !ingress.DeletionTimestamp.IsZero() {
+			continue
+		}
+		matches, err := matchesIngressClass(ctx, r.Client, r.IngressClasses, ingress)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			result = append(result, ingress)
+		}
+	}
+	return result, nil
+}
+
+// listeners returns the listeners for the hosts of the Ingresses that no listener of the Gateways accepts from
+// the namespace of the Ingress, sorted by host
+func (r *ListenerReconciler) listeners(ctx context.Context, ingresses []networkingv1.Ingress, gateways []gatewayv1.Gateway) ([]gatewayv1.Listener, error) {
+	_, certificates := tlsCertificates(ingresses, r.Gateway.Namespace, func(ingress *networkingv1.Ingress, host, secretName string) {
+		r.event(ingress, corev1.EventTypeWarning, "ConflictingCertificate",
+			fmt.Sprintf("Host %s has the Secret of another Ingress on Gateway %s, Secret %s is not used",
+				host, r.Gateway, secretName))
+	})
+
+	http := map[string]bool{}
+	https := map[string]bool{}
+	namespaces := map[string]corev1.Namespace{}
+	for _, ingress := range ingresses {
+		namespace, ok := namespaces[ingress.Namespace]
+		if !ok {
+			if err := r.Get(ctx, types.NamespacedName{Name: ingress.Namespace}, &namespace); err != nil {
+				if !errors.IsNotFound(err) {
+					return nil, err
+				}
+				namespace.Name = ingress.Namespace
+				namespace.Labels = map[string]string{corev1.LabelMetadataName: ingress.Namespace}
+			}
+			namespaces[ingress.Namespace] = namespace
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" && !acceptsHost(gateways, namespace, gatewayv1.HTTPProtocolType, rule.Host) {
+				http[rule.Host] = true
+			}
+		}
+		for _, tls := range ingress.Spec.TLS {
+			for _, host := range tls.Hosts {
+				if _, ok := certificates[host]; ok && !acceptsHost(gateways, namespace, gatewayv1.HTTPSProtocolType, host) {
+					https[host] = true
+				}
+			}
+		}
+	}
+
+	var listeners []gatewayv1.Listener
+	for host := range http {
+		listeners = append(listeners, gatewayv1.Listener{
+			Name:          listenerName(gatewayv1.HTTPProtocolType, host),
+			Hostname:      ptr.To(gatewayv1.Hostname(host)),
+			Port:          80,
+			Protocol:      gatewayv1.HTTPProtocolType,
+			AllowedRoutes: allNamespacesRoutes(),
+		})
+	}
+	for host := range https {
+		listeners = append(listeners, httpsListener(host, certificates[host]))
+	}
+	slices.SortFunc(listeners, func(a, b gatewayv1.Listener) int {
+		if c := strings.Compare(string(*a.Hostname), string(*b.Hostname)); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.Protocol), string(b.Protocol))
+	})
+	return listeners, nil
+}
+
+// acceptsHost returns true if a listener of the protocol of the Gateways accepts the host from the namespace
+func acceptsHost(gateways []gatewayv1.Gateway, namespace corev1.Namespace, protocol gatewayv1.ProtocolType, host string) bool {
+	for _, gateway := range gateways {
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Protocol != protocol || !isListenerAccessibleFromNamespace(listener, gateway.Namespace, namespace) {
+				continue
+			}
+			if listener.Hostname == nil || hostnamesIntersect(host, string(*listener.Hostname)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reconcileGatewayListeners replaces the managed listeners of the Gateway. A listener whose name is taken by a
+// listener of the Gateway is left out, as are the listeners beyond the maximum of 64.
+func (r *ListenerReconciler) reconcileGatewayListeners(ctx context.Context, gateway *gatewayv1.Gateway, managed []string, desired []gatewayv1.Listener) error {
+	listeners := slices.DeleteFunc(slices.Clone(gateway.Spec.Listeners), func(listener gatewayv1.Listener) bool {
+		return slices.Contains(managed, string(listener.Name))
+	})
+	var names, dropped []string
+	for _, listener := range desired {
+		if slices.ContainsFunc(listeners, func(existing gatewayv1.Listener) bool { return existing.Name == listener.Name }) {
+			continue
+		}
+		if len(listeners) >= maxListeners {
+			dropped = append(dropped, string(listener.Name))
+			continue
+		}
+		listeners = append(listeners, listener)
+		names = append(names, string(listener.Name))
+	}
+	r.warnDroppedListeners(gateway, dropped)
+
+	value := strings.Join(names, ",")
+	if !isEqual(gateway.Spec.Listeners, listeners) || gateway.Annotations[managedListenersAnnotation] != value {
+		gateway.Spec.Listeners = listeners
+		if value == "" {
+			delete(gateway.Annotations, managedListenersAnnotation)
+		} else {
+			metav1.SetMetaDataAnnotation(&gateway.ObjectMeta, managedListenersAnnotation, value)
+		}
+		if err := r.Audited(r.Client).Update(ctx, gateway); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("updated listeners of Gateway", "name", r.Gateway, "listeners", len(names))
+	}
+
+	added := slices.DeleteFunc(slices.Clone(listeners), func(listener gatewayv1.Listener) bool {
+		return !slices.Contains(names, string(listener.Name))
+	})
+	return r.ensureCertificateGrants(ctx, gatewayv1.GroupName, "Gateway", r.Gateway.Name, added)
+}
+
+// reconcileListenerSet creates, updates or deletes the XListenerSet of the managed listeners. It is owned by the
+// Gateway, and an XListenerSet of the name that is not is left alone.
+func (r *ListenerReconciler) reconcileListenerSet(ctx context.Context, gateway *gatewayv1.Gateway, desired []gatewayv1.Listener) error {
+	logger := log.FromContext(ctx)
+	name := r.listenerSetName()
+
+	var entries []gatewayxv1alpha1.ListenerEntry
+	var dropped []string
+	for _, listener := range desired {
+		if len(entries) >= maxListeners {
+			dropped = append(dropped, string(listener.Name))
+			continue
+		}
+		entries = append(entries, gatewayxv1alpha1.ListenerEntry{
+			Name:          listener.Name,
+			Hostname:      listener.Hostname,
+			Port:          listener.Port,
+			Protocol:      listener.Protocol,
+			TLS:           listener.TLS,
+			AllowedRoutes: listener.AllowedRoutes,
+		})
+	}
+	r.warnDroppedListeners(gateway, dropped)
+
+	existing := &gatewayxv1alpha1.XListenerSet{}
+	if err := r.Get(ctx, name, existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if len(entries) == 0 {
+			return r.ensureCertificateGrants(ctx, gatewayxv1alpha1.GroupName, "XListenerSet", name.Name, nil)
+		}
+		listenerSet := &gatewayxv1alpha1.XListenerSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+			Spec: gatewayxv1alpha1.ListenerSetSpec{
+				ParentRef: gatewayxv1alpha1.ParentGatewayReference{
+					Group: ptr.To(gatewayv1.Group(gatewayv1.GroupName)),
+					Kind:  ptr.To(gatewayv1.Kind("Gateway")),
+					Name:  gatewayv1.ObjectName(gateway.Name),
+				},
+				Listeners: entries,
+			},
+		}
+		if err := controllerutil.SetControllerReference(gateway, listenerSet, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Audited(r.Client).Create(ctx, listenerSet); err != nil {
+			return err
+		}
+		logger.Info("created XListenerSet", "name", name)
+		return r.ensureCertificateGrants(ctx, gatewayxv1alpha1.GroupName, "XListenerSet", name.Name, desired[:len(entries)])
+	}
+
+	if !metav1.IsControlledBy(existing, gateway) {
+		logger.Info("XListenerSet is not owned by the managed Gateway", "name", name)
+		return nil
+	}
+	if len(entries) == 0 {
+		if err := r.Audited(r.Client).Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		logger.Info("deleted XListenerSet", "name", name)
+		return r.ensureCertificateGrants(ctx, gatewayxv1alpha1.GroupName, "XListenerSet", name.Name, nil)
+	}
+	if !isEqual(existing.Spec.Listeners, entries) {
+		existing.Spec.Listeners = entries
+		if err := r.Audited(r.Client).Update(ctx, existing); err != nil {
+			return err
+		}
+		logger.Info("updated XListenerSet", "name", name)
+	}
+	return r.ensureCertificateGrants(ctx, gatewayxv1alpha1.GroupName, "XListenerSet", name.Name, desired[:len(entries)])
+}
+
+// ensureCertificateGrants creates the ReferenceGrants the managed listeners of the Gateway or XListenerSet need for
+// the Secrets in other namespaces
+func (r *ListenerReconciler) ensureCertificateGrants(ctx context.Context, group gatewayv1.Group, kind gatewayv1.Kind, name string, listeners []gatewayv1.Listener) error {
+	parent := gatewayv1.ParentReference{
+		Group:     ptr.To(group),
+		Kind:      ptr.To(kind),
+		Namespace: ptr.To(gatewayv1.Namespace(r.Gateway.Namespace)),
+		Name:      gatewayv1.ObjectName(name),
+	}
+	return ensureCertificateGrants(audit.WithReason(ctx, audit.ReasonReferenceGrantRequired), r.Audited(r.Client), parent, listeners)
+}
+
+// listenerSetName returns the name of the XListenerSet of the managed listeners
+func (r *ListenerReconciler) listenerSetName() types.NamespacedName {
+	return types.NamespacedName{Namespace: r.Gateway.Namespace, Name: truncateName(r.Gateway.Name + listenerSetSuffix)}
+}
+
+// warnDroppedListeners emits an Event on the Gateway listing the listeners beyond the maximum
+func (r *ListenerReconciler) warnDroppedListeners(gateway *gatewayv1.Gateway, dropped []string) {
+	if len(dropped) > 0 {
+		r.event(gateway, corev1.EventTypeWarning, "TooManyListeners",
+			fmt.Sprintf("At most %d listeners can be attached, listeners %s are not added", maxListeners,
+				strings.Join(dropped, ", ")))
+	}
+}
+
+// event emits an Event on the object, if a recorder is set
+func (r *ListenerReconciler) event(object runtime.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// listenerSetGateways returns the XListenerSets as Gateways, so their listeners are matched like those of Gateways
+// and routes attach to them with a parentRef of kind XListenerSet. They get the GatewayClass and conditions of their
+// parent Gateway, an XListenerSet whose parent is not one of the Gateways is left out.
+func listenerSetGateways(listenerSets []gatewayxv1alpha1.XListenerSet, gateways []gatewayv1.Gateway) []gatewayv1.Gateway {
+	var result []gatewayv1.Gateway
+	for _, listenerSet := range listenerSets {
+		parentRef := listenerSet.Spec.ParentRef
+		namespace := listenerSet.Namespace
+		if parentRef.Namespace != nil {
+			namespace = string(*parentRef.Namespace)
+		}
+		i := slices.IndexFunc(gateways, func(gateway gatewayv1.Gateway) bool {
+			return gateway.Namespace == namespace && gateway.Name == string(parentRef.Name)
+		})
+		if i < 0 {
+			continue
+		}
+
+		gateway := gatewayv1.Gateway{
+			TypeMeta:   metav1.TypeMeta{APIVersion: gatewayxv1alpha1.GroupVersion.String(), Kind: "XListenerSet"},
+			ObjectMeta: metav1.ObjectMeta{Name: listenerSet.Name, Namespace: listenerSet.Namespace},
+			Spec:       gatewayv1.GatewaySpec{GatewayClassName: gateways[i].Spec.GatewayClassName},
+			Status:     gatewayv1.GatewayStatus{Conditions: gateways[i].Status.Conditions},
+		}
+		for _, entry := range listenerSet.Spec.Listeners {
+			gateway.Spec.Listeners = append(gateway.Spec.Listeners, gatewayv1.Listener{
+				Name:          entry.Name,
+				Hostname:      entry.Hostname,
+				Port:          entry.Port,
+				Protocol:      entry.Protocol,
+				TLS:           entry.TLS,
+				AllowedRoutes: entry.AllowedRoutes,
+			})
+		}
+		result = append(result, gateway)
+	}
+	return result
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ListenerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every Ingress or Gateway change may add or remove a host without a listener
+	enqueueGateway := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: r.Gateway}}
+	})
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("listeners").
+		Watches(&gatewayv1.Gateway{}, enqueueGateway).
+		Watches(&networkingv1.Ingress{}, enqueueGateway).
+		Watches(&networkingv1.IngressClass{}, enqueueGateway)
+	return watchListenerSets(b, r.ListenerSet, mgr.GetCache(), enqueueGateway).Complete(r)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayxv1alpha1 "sigs.k8s.io/gateway-api/apisx/v1alpha1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+// testListenerObjects returns a Gateway accepting *.example.com over HTTP, and an Ingress with a host it accepts and
+// one it does not, with a TLS Secret for both
+func testListenerObjects() (*gatewayv1.Gateway, *networkingv1.Ingress) {
+	gateway := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw", UID: "5678"},
+		Spec: gatewayv1.GatewaySpec{GatewayClassName: "envoy", Listeners: []gatewayv1.Listener{{
+			Name:          "http",
+			Hostname:      ptr.To(gatewayv1.Hostname("*.example.com")),
+			Port:          80,
+			Protocol:      gatewayv1.HTTPProtocolType,
+			AllowedRoutes: allNamespacesRoutes(),
+		}}},
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "app.example.com"}, {Host: "app.example.org"}},
+			TLS: []networkingv1.IngressTLS{
+				{Hosts: []string{"app.example.com", "app.example.org"}, SecretName: "app-tls"},
+			},
+		},
+	}
+	return gateway, ingress
+}
+
+func TestListenerReconcileGateway(t *testing.T) {
+	ctx := context.Background()
+	gateway, ingress := testListenerObjects()
+	name := types.NamespacedName{Namespace: "default", Name: "gw"}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(gateway, ingress).Build()
+	r := &ListenerReconciler{Client: c, Scheme: golden.Scheme, Gateway: name}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	var names []gatewayv1.SectionName
+	for _, listener := range gateway.Spec.Listeners {
+		names = append(names, listener.Name)
+	}
+	expected := []gatewayv1.SectionName{"http", "https-app.example.com", "http-app.example.org", "https-app.example.org"}
+	if !isEqual(names, expected) {
+		t.Errorf("unexpected listeners: %v", names)
+	}
+	if value := gateway.Annotations[managedListenersAnnotation]; value != "https-app.example.com,http-app.example.org,https-app.example.org" {
+		t.Errorf("unexpected managed listeners: %q", value)
+	}
+
+	// The listeners are removed once no Ingress needs them, and the listeners of the Gateway are kept
+	if err := c.Delete(ctx, ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	if len(gateway.Spec.Listeners) != 1 || gateway.Spec.Listeners[0].Name != "http" {
+		t.Errorf("expected only the listener of the Gateway, got %+v", gateway.Spec.Listeners)
+	}
+	if _, ok := gateway.Annotations[managedListenersAnnotation]; ok {
+		t.Errorf("expected no managed listeners annotation, got %v", gateway.Annotations)
+	}
+}
+
+func TestListenerReconcileListenerSet(t *testing.T) {
+	ctx := context.Background()
+	gateway, ingress := testListenerObjects()
+	name := types.NamespacedName{Namespace: "default", Name: "gw"}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(gateway, ingress).Build()
+	r := &ListenerReconciler{Client: c, Scheme: golden.Scheme, Gateway: name, ListenerSet: true}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	listenerSet := &gatewayxv1alpha1.XListenerSet{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "gw-ingresses"}, listenerSet); err != nil {
+		t.Fatal(err)
+	}
+	if len(listenerSet.Spec.Listeners) != 3 || listenerSet.Spec.ParentRef.Name != "gw" || !metav1.IsControlledBy(listenerSet, gateway) {
+		t.Errorf("unexpected XListenerSet: %+v", listenerSet)
+	}
+	if err := c.Get(ctx, name, gateway); err != nil {
+		t.Fatal(err)
+	}
+	if len(gateway.Spec.Listeners) != 1 {
+		t.Errorf("expected the Gateway to be left alone, got %+v", gateway.Spec.Listeners)
+	}
+
+	// The listeners of the XListenerSet attach HTTPRoutes as if they were of a Gateway
+	gateways := listenerSetGateways([]gatewayxv1alpha1.XListenerSet{*listenerSet}, []gatewayv1.Gateway{*gateway})
+	if len(gateways) != 1 || gateways[0].Spec.GatewayClassName != "envoy" || len(gateways[0].Spec.Listeners) != 3 {
+		t.Fatalf("unexpected Gateways: %+v", gateways)
+	}
+	parentRef := createParentRef(gateways[0], gateways[0].Spec.Listeners[0])
+	if *parentRef.Group != gatewayxv1alpha1.GroupName || *parentRef.Kind != "XListenerSet" || parentRef.Name != "gw-ingresses" {
+		t.Errorf("unexpected parentRef: %+v", parentRef)
+	}
+
+	// The XListenerSet is deleted once no Ingress needs it
+	if err := c.Delete(ctx, ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "gw-ingresses"}, listenerSet)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the XListenerSet to be deleted, got %v", err)
+	}
+}
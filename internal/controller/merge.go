@@ -0,0 +1,210 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// listMergeSiblings returns the Ingresses in the namespace of the Ingress whose rules are merged with its rules,
+// oldest first, like the precedence of routes with conflicting matches, and by name for the same creation time.
+// Paused and deleted Ingresses no longer contribute their rules. The Ingress itself is included as given, as it may
+// differ from the stored one.
+func (r *IngressReconciler) listMergeSiblings(ctx context.Context, ingress networkingv1.Ingress) ([]networkingv1.Ingress, error) {
+	var ingressList networkingv1.IngressList
+	if err := r.List(ctx, &ingressList, client.InNamespace(ingress.Namespace)); err != nil {
+		return nil, err
+	}
+
+	siblings := []networkingv1.Ingress{ingress}
+	for _, sibling := range ingressList.Items {
+		if sibling.Name == ingress.Name || isAcmeSolver(sibling) || len(sibling.Spec.Rules) == 0 || r.isSkipped(sibling) ||
+			r.isPaused(sibling) || !sibling.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// nginx canaries only share the traffic of the paths of the Ingresses
+		canary, err := r.isTranslatedNginxCanary(ctx, sibling)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := r.MatchesIngressClass(ctx, sibling)
+		if err != nil {
+			return nil, err
+		}
+		if canary || !matches {
+			continue
+		}
+		siblings = append(siblings, r.rewriteHostnames(sibling))
+	}
+	slices.SortFunc(siblings, func(a, b networkingv1.Ingress) int {
+		return cmp.Or(a.CreationTimestamp.Compare(b.CreationTimestamp.Time), strings.Compare(a.Name, b.Name))
+	})
+	return siblings, nil
+}
+
+// hostRules are the rules of one of the Ingresses sharing a hostname
+type hostRules struct {
+	ingress networkingv1.Ingress
+	rules   []networkingv1.IngressRule
+}
+
+// mergeRulesByHostname returns the rules of the siblings with the hostname, in the order of the siblings, with the
+// rule of the default backend of the siblings for which defaultBackendRule returns true
+func mergeRulesByHostname(siblings []networkingv1.Ingress, hostname string, defaultBackendRule func(networkingv1.Ingress) bool) []hostRules {
+	var result []hostRules
+	for _, sibling := range siblings {
+		rules := groupRulesByHostname(sibling.Spec.Rules)[hostname]
+		if len(rules) == 0 {
+			continue
+		}
+		if sibling.Spec.DefaultBackend != nil && defaultBackendRule(sibling) {
+			rules = withDefaultBackendRule(rules, hostname, *sibling.Spec.DefaultBackend)
+		}
+		result = append(result, hostRules{ingress: sibling, rules: rules})
+	}
+	return result
+}
+
+// mapMergedHTTPRouteRules converts the rules of all Ingresses sharing a hostname to the rules of a single HTTPRoute.
+// Every Ingress keeps the filters of its own annotations. The Ingresses become the owners of the HTTPRoute, none of
+// them as controller, so the HTTPRoute is only deleted with the last of them.
+func (r *IngressReconciler) mapMergedHTTPRouteRules(ctx context.Context, merged []hostRules) ([]gatewayv1.HTTPRouteRule, map[string]string, []metav1.OwnerReference, error) {
+	var result []gatewayv1.HTTPRouteRule
+	var labels map[string]string
+	var owners []metav1.OwnerReference
+
+	for _, m := range merged {
+		profile, err := r.conversionProfile(ctx, m.ingress)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		filters, err := r.ingressFilters(profile, m.ingress)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		routeRules, routeLabels, err := r.mapToHTTPRouteRules(ctx, m.ingress, m.rules)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for i := range routeRules {
+			routeRules[i].Filters = mergeHeaderFilters(append(routeRules[i].Filters, filters...))
+		}
+		result = append(result, routeRules...)
+		// The labels of the first Ingress win
+		for key, value := range routeLabels {
+			if _, ok := labels[key]; !ok {
+				if labels == nil {
+					labels = make(map[string]string)
+				}
+				labels[key] = value
+			}
+		}
+
+		owner := createOwnerReference(m.ingress)
+		owner.Controller = nil
+		owners = append(owners, owner)
+	}
+
+	return result, labels, owners, nil
+}
+
+// mergedHTTPRouteName creates the name of the HTTPRoute shared by all Ingresses with the hostname
+func mergedHTTPRouteName(hostname string) string {
+	return normalizeHostname(hostname)
+}
+
+// isOwnedByAny returns true if the HTTPRoute was created for one of the owning Ingresses
+func (r *IngressReconciler) isOwnedByAny(metadata metav1.ObjectMeta, owners []metav1.OwnerReference) bool {
+	for _, owner := range owners {
+		if r.isOwnedBy(metadata, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncMergedOwners updates the owners of the existing merged route to the Ingresses currently sharing the hostname,
+// recorded in the owner annotation for routes outside their namespace, and returns true if they changed
+func (r *IngressReconciler) syncMergedOwners(existing *metav1.ObjectMeta, desired metav1.ObjectMeta) bool {
+	if !r.MergeHosts {
+		return false
+	}
+	if annotation, ok := desired.Annotations[ownerAnnotation]; ok {
+		if existing.Annotations[ownerAnnotation] == annotation {
+			return false
+		}
+		metav1.SetMetaDataAnnotation(existing, ownerAnnotation, annotation)
+		return true
+	}
+	if isEqual(existing.OwnerReferences, desired.OwnerReferences) {
+		return false
+	}
+	existing.OwnerReferences = desired.OwnerReferences
+	return true
+}
+
+// siblingEventHandler enqueues the Ingresses sharing a host with the changed Ingress, so they merge its new rules.
+// For updates the hosts before and after the change are considered, so a host the Ingress no longer declares is
+// merged again without its rules.
+func (r *IngressReconciler) siblingEventHandler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueSiblings(ctx, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueSiblings(ctx, q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueSiblings(ctx, q, e.Object)
+		},
+	}
+}
+
+// enqueueSiblings looks up the Ingresses with the hosts of the changed Ingresses in the host index
+func (r *IngressReconciler) enqueueSiblings(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], objects ...client.Object) {
+	hostnames := make(map[string]bool)
+	for _, obj := range objects {
+		ingress, ok := obj.(*networkingv1.Ingress)
+		if !ok {
+			continue
+		}
+		for _, rule := range r.rewriteHostnames(*ingress).Spec.Rules {
+			if rule.Host != "" {
+				hostnames[canonicalHostname(rule.Host)] = true
+			}
+		}
+	}
+
+	for hostname := range hostnames {
+		for _, request := range r.listIngressRequests(ctx, client.InNamespace(objects[0].GetNamespace()),
+			client.MatchingFields{ingressHostIndex: hostname}) {
+			q.Add(request)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestListMergeSiblings(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newIngress := func(name string, age time.Duration, annotations map[string]string, finalizers ...string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+				Annotations:       annotations,
+				Finalizers:        finalizers,
+			},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "app.example.com"}}},
+		}
+	}
+	deleted := newIngress("deleted", 0, nil, routesFinalizer)
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+		newIngress("web", 0, nil),
+		newIngress("old", time.Hour, nil),
+		newIngress("api", 0, nil),
+		newIngress("paused", 0, map[string]string{pauseAnnotation: "true"}),
+		deleted,
+	).Build()
+	if err := c.Delete(context.Background(), deleted); err != nil {
+		t.Fatal(err)
+	}
+	r := &IngressReconciler{Client: c, MergeHosts: true}
+
+	siblings, err := r.listMergeSiblings(context.Background(), *newIngress("new", -time.Hour, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sibling := range siblings {
+		names = append(names, sibling.Name)
+	}
+	// Oldest first, by name for the same creation time
+	expected := []string{"old", "api", "web", "new"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected siblings %v, got %v", expected, names)
+	}
+}
+
+func TestMergedHostFilters(t *testing.T) {
+	newIngress := func(name, path string, annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+				Host: "app.example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: ptr.To(networkingv1.PathTypePrefix),
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: name, Port: networkingv1.ServiceBackendPort{Number: 80},
+						}},
+					}},
+				}},
+			}}},
+		}
+	}
+	api := newIngress("api", "/api", map[string]string{
+		requestHeadersSetAnnotation:  "X-Team: api",
+		traefikMiddlewaresAnnotation: "default-auth@kubernetescrd",
+	})
+	web := newIngress("web", "/", map[string]string{filtersAnnotation: `
+- type: ExtensionRef
+  extensionRef:
+    group: filters.example.com
+    kind: RateLimit
+    name: web-limit
+`})
+	r := &IngressReconciler{
+		Client:                   fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(api, web).Build(),
+		Recorder:                 record.NewFakeRecorder(10),
+		MergeHosts:               true,
+		TraefikMiddlewareFilters: true,
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		}},
+	}}}
+
+	httpRoutes, err := r.Convert(context.Background(), *api, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 || len(httpRoutes[0].Spec.Rules) != 2 {
+		t.Fatalf("expected a single merged HTTPRoute with two rules, got %+v", httpRoutes)
+	}
+	filterTypes := make(map[string][]gatewayv1.HTTPRouteFilterType)
+	for _, rule := range httpRoutes[0].Spec.Rules {
+		for _, filter := range rule.Filters {
+			filterTypes[*rule.Matches[0].Path.Value] = append(filterTypes[*rule.Matches[0].Path.Value], filter.Type)
+		}
+	}
+	expected := map[string][]gatewayv1.HTTPRouteFilterType{
+		"/api": {gatewayv1.HTTPRouteFilterExtensionRef, gatewayv1.HTTPRouteFilterRequestHeaderModifier},
+		"/":    {gatewayv1.HTTPRouteFilterExtensionRef},
+	}
+	if !isEqual(filterTypes, expected) {
+		t.Errorf("expected every Ingress to keep the filters of its annotations, got %v", filterTypes)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxAnnotationPrefix is the prefix of the annotations of the nginx Ingress controller
+	nginxAnnotationPrefix = "nginx.ingress.kubernetes.io/"
+	// nginxUseRegexAnnotation makes nginx treat all paths of the Ingress as regular expressions
+	nginxUseRegexAnnotation = nginxAnnotationPrefix + "use-regex"
+	// nginxRewriteTargetAnnotation makes nginx rewrite the path of the requests before proxying them
+	nginxRewriteTargetAnnotation = nginxAnnotationPrefix + "rewrite-target"
+	// nginxSSLRedirectAnnotation makes nginx redirect HTTP requests for the hosts listed under spec.tls to HTTPS
+	nginxSSLRedirectAnnotation = nginxAnnotationPrefix + "ssl-redirect"
+	// nginxForceSSLRedirectAnnotation makes nginx redirect HTTP requests to HTTPS, also without spec.tls
+	nginxForceSSLRedirectAnnotation = nginxAnnotationPrefix + "force-ssl-redirect"
+	// nginxPermanentRedirectAnnotation makes nginx redirect all requests to a URL, with a 301 by default
+	nginxPermanentRedirectAnnotation = nginxAnnotationPrefix + "permanent-redirect"
+	// nginxPermanentRedirectCodeAnnotation overrides the status code of the permanent redirect
+	nginxPermanentRedirectCodeAnnotation = nginxAnnotationPrefix + "permanent-redirect-code"
+	// nginxTemporalRedirectAnnotation makes nginx redirect all requests to a URL with a 302
+	nginxTemporalRedirectAnnotation = nginxAnnotationPrefix + "temporal-redirect"
+	// nginxAppRootAnnotation makes nginx redirect the requests for / to the root of the application
+	nginxAppRootAnnotation = nginxAnnotationPrefix + "app-root"
+	// nginxProxyReadTimeoutAnnotation is the number of seconds nginx waits between two reads of the response
+	nginxProxyReadTimeoutAnnotation = nginxAnnotationPrefix + "proxy-read-timeout"
+	// nginxProxySendTimeoutAnnotation is the number of seconds nginx waits between two writes of the request
+	nginxProxySendTimeoutAnnotation = nginxAnnotationPrefix + "proxy-send-timeout"
+	// nginxUpstreamVhostAnnotation overrides the Host header nginx sends to the backends
+	nginxUpstreamVhostAnnotation = nginxAnnotationPrefix + "upstream-vhost"
+	// nginxXForwardedPrefixAnnotation makes nginx send the X-Forwarded-Prefix header with the value to the backends
+	nginxXForwardedPrefixAnnotation = nginxAnnotationPrefix + "x-forwarded-prefix"
+	// nginxConfigurationSnippetAnnotation adds raw nginx configuration to the locations of the Ingress
+	nginxConfigurationSnippetAnnotation = nginxAnnotationPrefix + "configuration-snippet"
+	// nginxServerSnippetAnnotation adds raw nginx configuration to the servers of the hosts of the Ingress
+	nginxServerSnippetAnnotation = nginxAnnotationPrefix + "server-snippet"
+	// nginxStreamSnippetAnnotation adds raw nginx configuration to the stream block
+	nginxStreamSnippetAnnotation = nginxAnnotationPrefix + "stream-snippet"
+	// nginxModSecuritySnippetAnnotation adds raw ModSecurity rules to the locations of the Ingress
+	nginxModSecuritySnippetAnnotation = nginxAnnotationPrefix + "modsecurity-snippet"
+	// nginxDefaultProxyTimeout is the number of seconds of the proxy timeouts nginx uses by default
+	nginxDefaultProxyTimeout = 60
+)
+
+// nginxCaptureGroupPattern matches the references to capture groups of the path in a rewrite target, e.g. $1
+var nginxCaptureGroupPattern = regexp.MustCompile(`\$[0-9]`)
+
+// usesRegex returns true if nginx treats the paths of the Ingress as regular expressions
+func usesRegex(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[nginxUseRegexAnnotation] == "true"
+}
+
+// sslRedirect returns true if nginx redirects the HTTP requests for a hostname of the Ingress to HTTPS, given whether
+// the hostname is listed under spec.tls
+func sslRedirect(ingress networkingv1.Ingress, tls bool) bool {
+	return tls && ingress.Annotations[nginxSSLRedirectAnnotation] == "true" ||
+		ingress.Annotations[nginxForceSSLRedirectAnnotation] == "true"
+}
+
+// applyUseRegex turns the path match into a RegularExpression match, like nginx does for all but Exact paths
+func applyUseRegex(pathMatch *gatewayv1.HTTPPathMatch) {
+	if pathMatch.Type == nil || *pathMatch.Type != gatewayv1.PathMatchExact {
+		pathMatch.Type = ptr.To(gatewayv1.PathMatchRegularExpression)
+	}
+}
+
+// validateRegexPath emits an Event if a RegularExpression match is not valid RE2 syntax. Most Gateway
+// implementations evaluate RE2, so PCRE-only syntax such as lookarounds or backreferences, which nginx
+// accepts, would be rejected or never match. The match is kept, as some implementations do evaluate PCRE.
+func (r *IngressReconciler) validateRegexPath(ingress *networkingv1.Ingress, pathMatch gatewayv1.HTTPPathMatch) {
+	if pathMatch.Type == nil || *pathMatch.Type != gatewayv1.PathMatchRegularExpression || pathMatch.Value == nil {
+		return
+	}
+	if _, err := regexp.Compile(*pathMatch.Value); err != nil {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRegex",
+			fmt.Sprintf("Path %q is not a valid RE2 regular expression and may not be supported by the Gateway: %v",
+				*pathMatch.Value, err))
+	}
+}
+
+// upstreamVhost returns the hostname of the upstream-vhost annotation of the Ingress, or nil if it has none. Values
+// that are not a plain hostname, such as those with a port or nginx variables, cannot be expressed by a URLRewrite
+// filter: an Event is emitted and nil returned.
+func (r *IngressReconciler) upstreamVhost(ingress *networkingv1.Ingress) *gatewayv1.PreciseHostname {
+	vhost := ingress.Annotations[nginxUpstreamVhostAnnotation]
+	if vhost == "" {
+		return nil
+	}
+	hostname := canonicalHostname(vhost)
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedUpstreamVhost",
+			fmt.Sprintf("Upstream vhost %q is not a hostname, the Host header is not rewritten: %s",
+				vhost, strings.Join(errs, ", ")))
+		return nil
+	}
+	return ptr.To(gatewayv1.PreciseHostname(hostname))
+}
+
+// urlRewriteFilter returns the URLRewrite filter rewriting the Host header to the hostname of the upstream-vhost
+// annotation and the path for the rewrite-target annotation of the Ingress, or nil if it rewrites neither. The prefix
+// of PathPrefix matches is replaced by the target, other matches have their full path replaced. Targets referring to
+// capture groups of the path cannot be expressed, an Event is emitted and the path not rewritten.
+func (r *IngressReconciler) urlRewriteFilter(ingress *networkingv1.Ingress, pathMatch gatewayv1.HTTPPathMatch, hostname *gatewayv1.PreciseHostname) *gatewayv1.HTTPRouteFilter {
+	rewrite := &gatewayv1.HTTPURLRewriteFilter{Hostname: hostname}
+	target := ingress.Annotations[nginxRewriteTargetAnnotation]
+	switch {
+	case target == "":
+	case nginxCaptureGroupPattern.MatchString(target):
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRewriteTarget",
+			fmt.Sprintf("Rewrite target %q of path %q refers to capture groups, which cannot be expressed by a "+
+				"URLRewrite filter; the path is not rewritten", target, ptr.Deref(pathMatch.Value, "")))
+	case pathMatch.Type != nil && *pathMatch.Type == gatewayv1.PathMatchPathPrefix:
+		rewrite.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To(target)}
+	default:
+		rewrite.Path = &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(target)}
+	}
+	if rewrite.Hostname == nil && rewrite.Path == nil {
+		return nil
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterURLRewrite, URLRewrite: rewrite}
+}
+
+// forwardedPrefixFilter returns the RequestHeaderModifier filter setting the X-Forwarded-Prefix header to the value
+// of the x-forwarded-prefix annotation of the Ingress, or nil if it has none. Backends behind a rewrite-target use it
+// to build their links with the prefix the client requested.
+func forwardedPrefixFilter(ingress networkingv1.Ingress) *gatewayv1.HTTPRouteFilter {
+	prefix := ingress.Annotations[nginxXForwardedPrefixAnnotation]
+	if prefix == "" {
+		return nil
+	}
+	return &gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set: []gatewayv1.HTTPHeader{{Name: "X-Forwarded-Prefix", Value: prefix}},
+		},
+	}
+}
+
+// hasReplacePrefixMatch returns true if the rule rewrites the prefix of its match, which requires it to have
+// exactly one PathPrefix match
+func hasReplacePrefixMatch(rule gatewayv1.HTTPRouteRule) bool {
+	return slices.ContainsFunc(rule.Filters, func(filter gatewayv1.HTTPRouteFilter) bool {
+		return filter.URLRewrite != nil && filter.URLRewrite.Path != nil &&
+			filter.URLRewrite.Path.Type == gatewayv1.PrefixMatchHTTPPathModifier
+	})
+}
+
+// splitReplacePrefixMatch keeps the first match of a rule rewriting the prefix of its match, and moves the other
+// matches to rules of their own that replace the full path with the same value instead. The additional rules are
+// named after the rule, suffixed with their index.
+func splitReplacePrefixMatch(rule gatewayv1.HTTPRouteRule) []gatewayv1.HTTPRouteRule {
+	if len(rule.Matches) <= 1 || !hasReplacePrefixMatch(rule) {
+		return []gatewayv1.HTTPRouteRule{rule}
+	}
+
+	result := []gatewayv1.HTTPRouteRule{*rule.DeepCopy()}
+	result[0].Matches = result[0].Matches[:1]
+	for i, match := range rule.Matches[1:] {
+		part := *rule.DeepCopy()
+		part.Matches = []gatewayv1.HTTPRouteMatch{match}
+		for _, filter := range part.Filters {
+			if filter.URLRewrite != nil && filter.URLRewrite.Path != nil &&
+				filter.URLRewrite.Path.Type == gatewayv1.PrefixMatchHTTPPathModifier {
+				filter.URLRewrite.Path.Type = gatewayv1.FullPathHTTPPathModifier
+				filter.URLRewrite.Path.ReplaceFullPath = filter.URLRewrite.Path.ReplacePrefixMatch
+				filter.URLRewrite.Path.ReplacePrefixMatch = nil
+			}
+		}
+		if part.Name != nil {
+			part.Name = ptr.To(gatewayv1.SectionName(truncateName(fmt.Sprintf("%s-%d", *rule.Name, i+1))))
+		}
+		result = append(result, part)
+	}
+	return result
+}
+
+// redirectFilter returns the RequestRedirect filter for the permanent-redirect or temporal-redirect annotation of the
+// Ingress, or nil if it has neither. nginx redirects to the URL as is, so the full path is replaced by the path of
+// the URL. HTTPRoutes only redirect with a 301 or 302, other codes are replaced by the one that is permanent or not
+// likewise, and the query of the URL cannot be expressed: an Event is emitted for both.
+func (r *IngressReconciler) redirectFilter(ingress *networkingv1.Ingress) *gatewayv1.HTTPRouteFilter {
+	target, statusCode := ingress.Annotations[nginxPermanentRedirectAnnotation], http.StatusMovedPermanently
+	if target == "" {
+		target, statusCode = ingress.Annotations[nginxTemporalRedirectAnnotation], http.StatusFound
+	}
+	if target == "" {
+		return nil
+	}
+	redirectURL, err := url.Parse(target)
+	if err != nil {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRedirect",
+			fmt.Sprintf("Redirect URL %q cannot be parsed, the requests are routed to the backends: %v", target, err))
+		return nil
+	}
+
+	if statusCode == http.StatusMovedPermanently {
+		if code, ok := ingress.Annotations[nginxPermanentRedirectCodeAnnotation]; ok {
+			if statusCode, err = strconv.Atoi(code); err != nil || statusCode < 300 || statusCode > 308 {
+				statusCode = http.StatusMovedPermanently
+			}
+		}
+	}
+	if statusCode != http.StatusMovedPermanently && statusCode != http.StatusFound {
+		replacement := http.StatusFound
+		if statusCode == http.StatusPermanentRedirect {
+			replacement = http.StatusMovedPermanently
+		}
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRedirect",
+			fmt.Sprintf("Redirect status code %d is not supported by HTTPRoutes, redirecting with %d instead",
+				statusCode, replacement))
+		statusCode = replacement
+	}
+	if redirectURL.RawQuery != "" || redirectURL.Fragment != "" {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedRedirect",
+			fmt.Sprintf("The query and fragment of redirect URL %q cannot be expressed by a RequestRedirect filter", target))
+	}
+
+	redirect := &gatewayv1.HTTPRequestRedirectFilter{StatusCode: ptr.To(statusCode)}
+	if redirectURL.Scheme != "" {
+		redirect.Scheme = ptr.To(redirectURL.Scheme)
+	}
+	if hostname := redirectURL.Hostname(); hostname != "" {
+		redirect.Hostname = ptr.To(gatewayv1.PreciseHostname(hostname))
+	}
+	if port, err := strconv.Atoi(redirectURL.Port()); err == nil {
+		redirect.Port = ptr.To(gatewayv1.PortNumber(port))
+	}
+	redirect.Path = &gatewayv1.HTTPPathModifier{
+		Type:            gatewayv1.FullPathHTTPPathModifier,
+		ReplaceFullPath: ptr.To(cmp.Or(redirectURL.Path, "/")),
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestRedirect, RequestRedirect: redirect}
+}
+
+// appRootRule returns the rule redirecting the requests for / to the app-root annotation of the Ingress with a 302,
+// like nginx, or nil if it has none. An app-root that is not an absolute path is rejected by nginx, an Event is
+// emitted and no rule returned.
+func (r *IngressReconciler) appRootRule(ingress *networkingv1.Ingress) *gatewayv1.HTTPRouteRule {
+	appRoot, ok := ingress.Annotations[nginxAppRootAnnotation]
+	if !ok || appRoot == "" {
+		return nil
+	}
+	if !strings.HasPrefix(appRoot, "/") {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAppRoot",
+			fmt.Sprintf("App root %q is not an absolute path, the requests for / are not redirected", appRoot))
+		return nil
+	}
+
+	return &gatewayv1.HTTPRouteRule{
+		Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{
+			Type:  ptr.To(gatewayv1.PathMatchExact),
+			Value: ptr.To("/"),
+		}}},
+		Filters: []gatewayv1.HTTPRouteFilter{{
+			Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+			RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+				Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To(appRoot)},
+				StatusCode: ptr.To(http.StatusFound),
+			},
+		}},
+	}
+}
+
+// proxyTimeouts returns the timeouts of the rules for the proxy timeout annotations of the Ingress, or nil if it has
+// neither. The backend has the read timeout to respond, the whole request the send and read timeouts together;
+// the timeout that is not set is the nginx default of 60 seconds. An invalid timeout is ignored, like nginx does,
+// and an Event is emitted.
+func (r *IngressReconciler) proxyTimeouts(ingress *networkingv1.Ingress) *gatewayv1.HTTPRouteTimeouts {
+	timeout := func(annotation string) (int, bool) {
+		value, ok := ingress.Annotations[annotation]
+		if !ok {
+			return nginxDefaultProxyTimeout, false
+		}
+		seconds, err := strconv.Atoi(strings.TrimSuffix(value, "s"))
+		if err != nil || seconds <= 0 {
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedTimeout",
+				fmt.Sprintf("Timeout %q of %s is not a positive number of seconds, it is not converted", value, annotation))
+			return nginxDefaultProxyTimeout, false
+		}
+		return seconds, true
+	}
+
+	read, readSet := timeout(nginxProxyReadTimeoutAnnotation)
+	send, sendSet := timeout(nginxProxySendTimeoutAnnotation)
+	if !readSet && !sendSet {
+		return nil
+	}
+	return &gatewayv1.HTTPRouteTimeouts{
+		Request:        ptr.To(formatDuration(send + read)),
+		BackendRequest: ptr.To(formatDuration(read)),
+	}
+}
+
+// formatDuration formats the seconds as a Gateway API duration, which allows at most 5 digits per unit
+func formatDuration(seconds int) gatewayv1.Duration {
+	if seconds <= 99999 {
+		return gatewayv1.Duration(fmt.Sprintf("%ds", seconds))
+	}
+	duration := fmt.Sprintf("%dh", seconds/3600)
+	if minutes := seconds % 3600 / 60; minutes > 0 {
+		duration += fmt.Sprintf("%dm", minutes)
+	}
+	if seconds%60 > 0 {
+		duration += fmt.Sprintf("%ds", seconds%60)
+	}
+	return gatewayv1.Duration(duration)
+}
+
+// formatPreciseDuration returns the duration as a Gateway API duration, in milliseconds if it is no whole number of
+// seconds
+func formatPreciseDuration(duration time.Duration) gatewayv1.Duration {
+	if duration%time.Second != 0 && duration.Milliseconds() <= 99999 {
+		return gatewayv1.Duration(fmt.Sprintf("%dms", duration.Milliseconds()))
+	}
+	return formatDuration(int(duration.Seconds()))
+}
@@ -0,0 +1,515 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestUseRegexValidation(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).Build(), Recorder: recorder}
+
+	pathType := networkingv1.PathTypePrefix
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: map[string]string{nginxUseRegexAnnotation: "true"},
+		},
+	}
+	var paths []networkingv1.HTTPIngressPath
+	for _, path := range []string{"/api/v[0-9]+", "/(?!internal).*"} {
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: "app", Port: networkingv1.ServiceBackendPort{Number: 80},
+			}},
+		})
+	}
+	rules := []networkingv1.IngressRule{{IngressRuleValue: networkingv1.IngressRuleValue{
+		HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+	}}}
+
+	routeRules, _, err := r.mapToHTTPRouteRules(context.Background(), ingress, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range routeRules {
+		if *rule.Matches[0].Path.Type != gatewayv1.PathMatchRegularExpression {
+			t.Errorf("expected a RegularExpression match for %s", *rule.Matches[0].Path.Value)
+		}
+	}
+
+	// Only the lookahead is PCRE-only syntax
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRegex") || !strings.Contains(event, "(?!internal)") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestURLRewriteFilter(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	prefix := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/api")}
+	exact := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/healthz")}
+	newIngress := func(target string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: map[string]string{nginxRewriteTargetAnnotation: target},
+		}}
+	}
+
+	filter := r.urlRewriteFilter(newIngress("/v1"), prefix, nil)
+	if filter == nil || *filter.URLRewrite.Path.ReplacePrefixMatch != "/v1" {
+		t.Errorf("expected the prefix to be replaced by /v1, got %+v", filter)
+	}
+	filter = r.urlRewriteFilter(newIngress("/v1"), exact, nil)
+	if filter == nil || *filter.URLRewrite.Path.ReplaceFullPath != "/v1" {
+		t.Errorf("expected the full path to be replaced by /v1, got %+v", filter)
+	}
+	if filter := r.urlRewriteFilter(&networkingv1.Ingress{}, prefix, nil); filter != nil {
+		t.Errorf("expected no filter without the annotation, got %+v", filter)
+	}
+
+	// Capture groups cannot be expressed
+	if filter := r.urlRewriteFilter(newIngress("/$2"), prefix, nil); filter != nil {
+		t.Errorf("expected no filter for a target with capture groups, got %+v", filter)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRewriteTarget") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestUpstreamVhost(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	newIngress := func(vhost string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: map[string]string{nginxUpstreamVhostAnnotation: vhost},
+		}}
+	}
+
+	hostname := r.upstreamVhost(newIngress("Internal.svc"))
+	if hostname == nil || *hostname != "internal.svc" {
+		t.Errorf("expected internal.svc, got %v", hostname)
+	}
+	exact := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/healthz")}
+	filter := r.urlRewriteFilter(&networkingv1.Ingress{}, exact, hostname)
+	if filter == nil || *filter.URLRewrite.Hostname != "internal.svc" || filter.URLRewrite.Path != nil {
+		t.Errorf("expected only the hostname to be rewritten, got %+v", filter)
+	}
+
+	// Ports and nginx variables cannot be expressed
+	for _, vhost := range []string{"internal.svc:8080", "$host"} {
+		if hostname := r.upstreamVhost(newIngress(vhost)); hostname != nil {
+			t.Errorf("expected no hostname for %q, got %s", vhost, *hostname)
+		}
+	}
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedUpstreamVhost") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestForwardedPrefixFilter(t *testing.T) {
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{nginxXForwardedPrefixAnnotation: "/dashboard"},
+	}}
+	expected := &gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+			Set: []gatewayv1.HTTPHeader{{Name: "X-Forwarded-Prefix", Value: "/dashboard"}},
+		},
+	}
+	if filter := forwardedPrefixFilter(ingress); !isEqual(filter, expected) {
+		t.Errorf("expected %+v, got %+v", expected, filter)
+	}
+	if filter := forwardedPrefixFilter(networkingv1.Ingress{}); filter != nil {
+		t.Errorf("expected no filter without the annotation, got %+v", filter)
+	}
+}
+
+func TestSplitReplacePrefixMatch(t *testing.T) {
+	rule := gatewayv1.HTTPRouteRule{
+		Name: ptr.To(gatewayv1.SectionName("static")),
+		Matches: []gatewayv1.HTTPRouteMatch{
+			{Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/static/")}},
+			{Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/static")}},
+		},
+		Filters: []gatewayv1.HTTPRouteFilter{{
+			Type: gatewayv1.HTTPRouteFilterURLRewrite,
+			URLRewrite: &gatewayv1.HTTPURLRewriteFilter{Path: &gatewayv1.HTTPPathModifier{
+				Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr.To("/"),
+			}},
+		}},
+	}
+
+	rules := splitReplacePrefixMatch(rule)
+	if len(rules) != 2 || len(rules[0].Matches) != 1 || len(rules[1].Matches) != 1 {
+		t.Fatalf("expected 2 rules of a single match, got %+v", rules)
+	}
+	if !hasReplacePrefixMatch(rules[0]) || *rules[1].Filters[0].URLRewrite.Path.ReplaceFullPath != "/" {
+		t.Errorf("expected the second rule to replace the full path, got %+v", rules[1].Filters[0].URLRewrite.Path)
+	}
+	if *rules[1].Name != "static-1" || !hasReplacePrefixMatch(rule) {
+		t.Errorf("expected the second rule to be named static-1 and the rule to be unchanged, got %s", *rules[1].Name)
+	}
+
+	// Rules rewriting their prefix are never consolidated
+	if consolidated := consolidateHTTPRouteRules([]gatewayv1.HTTPRouteRule{rules[0], rules[0]}); len(consolidated) != 2 {
+		t.Errorf("expected rules rewriting their prefix to be kept apart, got %d rules", len(consolidated))
+	}
+}
+
+func TestSSLRedirect(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		tls         bool
+		expected    bool
+	}{
+		{name: "ssl-redirect with tls", annotations: map[string]string{nginxSSLRedirectAnnotation: "true"}, tls: true, expected: true},
+		{name: "ssl-redirect without tls", annotations: map[string]string{nginxSSLRedirectAnnotation: "true"}},
+		{name: "ssl-redirect disabled", annotations: map[string]string{nginxSSLRedirectAnnotation: "false"}, tls: true},
+		{name: "force-ssl-redirect without tls", annotations: map[string]string{nginxForceSSLRedirectAnnotation: "true"}, expected: true},
+		{name: "no annotations", tls: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if redirect := sslRedirect(ingress, tt.tls); redirect != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, redirect)
+			}
+		})
+	}
+}
+
+func TestRedirectFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *gatewayv1.HTTPRequestRedirectFilter
+		events      int
+	}{
+		{
+			name:        "permanent redirect",
+			annotations: map[string]string{nginxPermanentRedirectAnnotation: "https://www.example.net/new"},
+			expected: &gatewayv1.HTTPRequestRedirectFilter{
+				Scheme:     ptr.To("https"),
+				Hostname:   ptr.To(gatewayv1.PreciseHostname("www.example.net")),
+				Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/new")},
+				StatusCode: ptr.To(301),
+			},
+		},
+		{
+			name: "permanent redirect code",
+			annotations: map[string]string{
+				nginxPermanentRedirectAnnotation:     "https://www.example.net",
+				nginxPermanentRedirectCodeAnnotation: "302",
+			},
+			expected: &gatewayv1.HTTPRequestRedirectFilter{
+				Scheme:     ptr.To("https"),
+				Hostname:   ptr.To(gatewayv1.PreciseHostname("www.example.net")),
+				Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/")},
+				StatusCode: ptr.To(302),
+			},
+		},
+		{
+			name: "unsupported code and query",
+			annotations: map[string]string{
+				nginxPermanentRedirectAnnotation:     "http://www.example.net:8080/new?from=old",
+				nginxPermanentRedirectCodeAnnotation: "308",
+			},
+			expected: &gatewayv1.HTTPRequestRedirectFilter{
+				Scheme:     ptr.To("http"),
+				Hostname:   ptr.To(gatewayv1.PreciseHostname("www.example.net")),
+				Port:       ptr.To(gatewayv1.PortNumber(8080)),
+				Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/new")},
+				StatusCode: ptr.To(301),
+			},
+			events: 2,
+		},
+		{
+			name:        "temporal redirect",
+			annotations: map[string]string{nginxTemporalRedirectAnnotation: "/maintenance"},
+			expected: &gatewayv1.HTTPRequestRedirectFilter{
+				Path:       &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr.To("/maintenance")},
+				StatusCode: ptr.To(302),
+			},
+		},
+		{
+			name: "no redirect",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &IngressReconciler{Recorder: recorder}
+			ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			filter := r.redirectFilter(ingress)
+			if tt.expected == nil {
+				if filter != nil {
+					t.Errorf("expected no filter, got %+v", filter)
+				}
+				return
+			}
+			if filter == nil || !isEqual(filter.RequestRedirect, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, filter)
+			}
+			if len(recorder.Events) != tt.events {
+				t.Errorf("expected %d events, got %d", tt.events, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestAppRootRule(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	newIngress := func(appRoot string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{nginxAppRootAnnotation: appRoot},
+		}}
+	}
+
+	rule := r.appRootRule(newIngress("/console"))
+	if rule == nil || *rule.Matches[0].Path.Type != gatewayv1.PathMatchExact || *rule.Matches[0].Path.Value != "/" {
+		t.Fatalf("expected a rule matching / exactly, got %+v", rule)
+	}
+	if redirect := rule.Filters[0].RequestRedirect; *redirect.Path.ReplaceFullPath != "/console" || *redirect.StatusCode != 302 {
+		t.Errorf("expected a 302 redirect to /console, got %+v", redirect)
+	}
+	if rule := r.appRootRule(&networkingv1.Ingress{}); rule != nil {
+		t.Errorf("expected no rule without the annotation, got %+v", rule)
+	}
+
+	// nginx rejects an app root that is not an absolute path
+	if rule := r.appRootRule(newIngress("console")); rule != nil {
+		t.Errorf("expected no rule for a relative app root, got %+v", rule)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedAppRoot") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *gatewayv1.HTTPRouteTimeouts
+		events      int
+	}{
+		{
+			name:        "read timeout",
+			annotations: map[string]string{nginxProxyReadTimeoutAnnotation: "120"},
+			expected:    &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("180s")), BackendRequest: ptr.To(gatewayv1.Duration("120s"))},
+		},
+		{
+			name:        "send and read timeouts",
+			annotations: map[string]string{nginxProxyReadTimeoutAnnotation: "30", nginxProxySendTimeoutAnnotation: "10s"},
+			expected:    &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(gatewayv1.Duration("40s")), BackendRequest: ptr.To(gatewayv1.Duration("30s"))},
+		},
+		{
+			name:        "invalid timeout",
+			annotations: map[string]string{nginxProxyReadTimeoutAnnotation: "1m"},
+			events:      1,
+		},
+		{
+			name: "no timeouts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &IngressReconciler{Recorder: recorder}
+			ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if timeouts := r.proxyTimeouts(ingress); !isEqual(timeouts, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, timeouts)
+			}
+			if len(recorder.Events) != tt.events {
+				t.Errorf("expected %d events, got %d", tt.events, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for seconds, expected := range map[int]gatewayv1.Duration{
+		60:     "60s",
+		99999:  "99999s",
+		100000: "27h46m40s",
+		108000: "30h",
+	} {
+		if duration := formatDuration(seconds); duration != expected {
+			t.Errorf("expected %s for %d seconds, got %s", expected, seconds, duration)
+		}
+	}
+}
+
+func TestWarnUnconvertibleAnnotations(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		nginxServerSnippetAnnotation:        "listen 8443;",
+		nginxConfigurationSnippetAnnotation: "return 418;",
+		nginxUseRegexAnnotation:             "true",
+	}}}
+
+	r.warnUnconvertibleAnnotations(nil, ingress)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	expected := nginxConfigurationSnippetAnnotation + ", " + nginxServerSnippetAnnotation
+	if event := <-recorder.Events; !strings.Contains(event, "UnconvertibleAnnotations") || !strings.Contains(event, expected) {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	r.warnUnconvertibleAnnotations(nil, &networkingv1.Ingress{})
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event without unconvertible annotations")
+	}
+}
+
+func TestWarnUnmappedAuth(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder, ExtensionRefMappings: []ExtensionRefMapping{
+		{Annotation: nginxAuthTypeAnnotation, Kind: "BasicAuth", Name: "{{ .Name }}"},
+	}}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		nginxAuthURLAnnotation:    "https://auth.example.com/verify",
+		nginxAuthTypeAnnotation:   "basic",
+		nginxAuthSecretAnnotation: "users",
+	}}}
+
+	r.warnUnmappedAuth(ingress)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedAuth") || !strings.Contains(event, nginxAuthURLAnnotation) {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// The annotations configuring a mapped annotation are converted by its filter
+	for key, expected := range map[string]AnnotationSupport{
+		nginxAuthSecretAnnotation: AnnotationConverted,
+		nginxAuthRealmAnnotation:  AnnotationConverted,
+		nginxAuthSigninAnnotation: AnnotationUnsupported,
+		nginxAuthMethodAnnotation: AnnotationUnsupported,
+		nginxAuthTypeAnnotation:   AnnotationConverted,
+		nginxAuthURLAnnotation:    AnnotationUnsupported,
+	} {
+		if support := r.AnnotationSupport(key); support != expected {
+			t.Errorf("expected %s to be %s, got %s", key, expected, support)
+		}
+	}
+}
+
+func TestExtensionRefFilterAnnotations(t *testing.T) {
+	r := &IngressReconciler{ExtensionRefMappings: []ExtensionRefMapping{{
+		Annotation: nginxAuthTypeAnnotation,
+		Group:      "filters.example.com",
+		Kind:       "BasicAuth",
+		Name:       `{{ index .Annotations "` + nginxAuthSecretAnnotation + `" }}`,
+	}}}
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: map[string]string{
+		nginxAuthTypeAnnotation:   "basic",
+		nginxAuthSecretAnnotation: "users",
+	}}}
+
+	filters, err := r.extensionRefFilters(ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 || filters[0].ExtensionRef.Name != "users" {
+		t.Errorf("expected a filter named after the auth secret, got %+v", filters)
+	}
+
+	// A missing annotation renders an empty name, which is no valid reference
+	delete(ingress.Annotations, nginxAuthSecretAnnotation)
+	if _, err := r.extensionRefFilters(ingress); err == nil {
+		t.Errorf("expected an error for an empty name")
+	}
+}
+
+func TestSessionPersistence(t *testing.T) {
+	newIngress := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder, SessionPersistence: true}
+
+	persistence := r.sessionPersistence(newIngress(map[string]string{nginxAffinityAnnotation: "cookie"}))
+	expected := &gatewayv1.SessionPersistence{
+		SessionName:  ptr.To(nginxDefaultSessionCookieName),
+		Type:         ptr.To(gatewayv1.CookieBasedSessionPersistence),
+		CookieConfig: &gatewayv1.CookieConfig{LifetimeType: ptr.To(gatewayv1.SessionCookieLifetimeType)},
+	}
+	if !isEqual(persistence, expected) {
+		t.Errorf("expected a session cookie named %s, got %+v", nginxDefaultSessionCookieName, persistence)
+	}
+
+	persistence = r.sessionPersistence(newIngress(map[string]string{
+		nginxAffinityAnnotation:            "cookie",
+		nginxSessionCookieNameAnnotation:   "route",
+		nginxSessionCookieMaxAgeAnnotation: "172800",
+	}))
+	if ptr.Deref(persistence.SessionName, "") != "route" || ptr.Deref(persistence.AbsoluteTimeout, "") != "48h" ||
+		ptr.Deref(persistence.CookieConfig.LifetimeType, "") != gatewayv1.PermanentCookieLifetimeType {
+		t.Errorf("expected a permanent cookie named route lasting 48h, got %+v", persistence)
+	}
+
+	// Other types of affinity, or cookie affinity without SessionPersistence, are reported
+	if persistence := r.sessionPersistence(newIngress(map[string]string{nginxAffinityAnnotation: "ip"})); persistence != nil {
+		t.Errorf("expected no session persistence for ip affinity, got %+v", persistence)
+	}
+	r.SessionPersistence = false
+	if persistence := r.sessionPersistence(newIngress(map[string]string{nginxAffinityAnnotation: "cookie"})); persistence != nil {
+		t.Errorf("expected no session persistence without SessionPersistence, got %+v", persistence)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(recorder.Events))
+	}
+	for range len(recorder.Events) {
+		if event := <-recorder.Events; !strings.Contains(event, "UnsupportedAffinity") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxAffinityAnnotation makes nginx send the requests of a client to the same backend, only cookie is supported
+	nginxAffinityAnnotation = nginxAnnotationPrefix + "affinity"
+	// nginxSessionCookieNameAnnotation is the name of the affinity cookie, INGRESSCOOKIE by default
+	nginxSessionCookieNameAnnotation = nginxAnnotationPrefix + "session-cookie-name"
+	// nginxSessionCookieMaxAgeAnnotation is the number of seconds the affinity cookie lasts, a session cookie by default
+	nginxSessionCookieMaxAgeAnnotation = nginxAnnotationPrefix + "session-cookie-max-age"
+
+	// nginxDefaultSessionCookieName is the name nginx uses when session-cookie-name is not set
+	nginxDefaultSessionCookieName = "INGRESSCOOKIE"
+	// maxSessionNameLength is the longest session name the HTTPRoute CRD accepts
+	maxSessionNameLength = 128
+)
+
+// sessionPersistence returns the cookie based session persistence for the affinity annotations of the Ingress, or nil
+// if it has none. As sessionPersistence is part of the experimental channel, cookie affinity is only converted with
+// SessionPersistence; otherwise, or for other types of affinity, an Event is emitted instead.
+func (r *IngressReconciler) sessionPersistence(ingress *networkingv1.Ingress) *gatewayv1.SessionPersistence {
+	affinity, ok := ingress.Annotations[nginxAffinityAnnotation]
+	if !ok {
+		return nil
+	}
+	if affinity != "cookie" {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAffinity",
+			fmt.Sprintf("Affinity %q is not supported, the requests are balanced over the backends", affinity))
+		return nil
+	}
+	if !r.SessionPersistence {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAffinity",
+			"Cookie affinity is only converted to the sessionPersistence of the experimental channel with "+
+				"--session-persistence, the requests are balanced over the backends")
+		return nil
+	}
+
+	name := cmp.Or(ingress.Annotations[nginxSessionCookieNameAnnotation], nginxDefaultSessionCookieName)
+	if len(name) > maxSessionNameLength {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedAffinity",
+			fmt.Sprintf("Session cookie name %q is longer than %d characters, the default name %s is used",
+				name, maxSessionNameLength, nginxDefaultSessionCookieName))
+		name = nginxDefaultSessionCookieName
+	}
+	persistence := &gatewayv1.SessionPersistence{
+		SessionName:  ptr.To(name),
+		Type:         ptr.To(gatewayv1.CookieBasedSessionPersistence),
+		CookieConfig: &gatewayv1.CookieConfig{LifetimeType: ptr.To(gatewayv1.SessionCookieLifetimeType)},
+	}
+	if value, ok := ingress.Annotations[nginxSessionCookieMaxAgeAnnotation]; ok {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || maxAge <= 0 {
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedAffinity",
+				fmt.Sprintf("Session cookie max age %q is not a positive number of seconds, a session cookie is used", value))
+		} else {
+			persistence.AbsoluteTimeout = ptr.To(formatDuration(maxAge))
+			persistence.CookieConfig.LifetimeType = ptr.To(gatewayv1.PermanentCookieLifetimeType)
+		}
+	}
+	return persistence
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+const (
+	// nginxAuthURLAnnotation is the URL of the external service nginx asks to authenticate each request
+	nginxAuthURLAnnotation = nginxAnnotationPrefix + "auth-url"
+	// nginxAuthMethodAnnotation is the HTTP method of the requests to the external authentication service
+	nginxAuthMethodAnnotation = nginxAnnotationPrefix + "auth-method"
+	// nginxAuthSigninAnnotation is the URL unauthenticated clients are redirected to
+	nginxAuthSigninAnnotation = nginxAnnotationPrefix + "auth-signin"
+	// nginxAuthResponseHeadersAnnotation are the headers of the authentication response passed to the backend
+	nginxAuthResponseHeadersAnnotation = nginxAnnotationPrefix + "auth-response-headers"
+	// nginxAuthTypeAnnotation enables basic or digest authentication against the users of auth-secret
+	nginxAuthTypeAnnotation = nginxAnnotationPrefix + "auth-type"
+	// nginxAuthSecretAnnotation is the Secret with the users of basic or digest authentication
+	nginxAuthSecretAnnotation = nginxAnnotationPrefix + "auth-secret"
+	// nginxAuthSecretTypeAnnotation is the format of auth-secret, an htpasswd file or a map of users
+	nginxAuthSecretTypeAnnotation = nginxAnnotationPrefix + "auth-secret-type"
+	// nginxAuthRealmAnnotation is the realm of basic or digest authentication
+	nginxAuthRealmAnnotation = nginxAnnotationPrefix + "auth-realm"
+)
+
+// nginxAuthAnnotations maps the annotations that enable authentication to the annotations configuring it. Mapping
+// the former to an ExtensionRef filter converts the latter too, as the filter resource implements them.
+var nginxAuthAnnotations = map[string][]string{
+	nginxAuthURLAnnotation:  {nginxAuthMethodAnnotation, nginxAuthSigninAnnotation, nginxAuthResponseHeadersAnnotation},
+	nginxAuthTypeAnnotation: {nginxAuthSecretAnnotation, nginxAuthSecretTypeAnnotation, nginxAuthRealmAnnotation},
+}
+
+// mapsAnnotation returns true if an ExtensionRef mapping exists for the annotation key
+func (r *IngressReconciler) mapsAnnotation(key string) bool {
+	return slices.ContainsFunc(r.ExtensionRefMappings, func(mapping ExtensionRefMapping) bool {
+		return mapping.Annotation == key
+	})
+}
+
+// mapsAuthAnnotation returns true if the annotation key configures an authentication annotation with an ExtensionRef
+// mapping
+func (r *IngressReconciler) mapsAuthAnnotation(key string) bool {
+	for annotation, related := range nginxAuthAnnotations {
+		if slices.Contains(related, key) && r.mapsAnnotation(annotation) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnmappedAuth emits an Event for the authentication annotations of the Ingress without an ExtensionRef mapping,
+// as the HTTPRoutes would otherwise silently accept unauthenticated requests
+func (r *IngressReconciler) warnUnmappedAuth(ingress *networkingv1.Ingress) {
+	for _, annotation := range []string{nginxAuthURLAnnotation, nginxAuthTypeAnnotation} {
+		if _, ok := ingress.Annotations[annotation]; ok && !r.mapsAnnotation(annotation) {
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedAuth",
+				fmt.Sprintf("Annotation %s has no ExtensionRef mapping, the HTTPRoutes accept unauthenticated "+
+					"requests", annotation))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// nginxBackendProtocolAnnotation is the protocol nginx uses to connect to the backends, HTTP by default
+	nginxBackendProtocolAnnotation = nginxAnnotationPrefix + "backend-protocol"
+	// nginxProxySSLNameAnnotation is the hostname nginx validates the certificates of HTTPS backends for
+	nginxProxySSLNameAnnotation = nginxAnnotationPrefix + "proxy-ssl-name"
+)
+
+// nginxHTTPSServices returns the names of the Services of the Ingress nginx connects to with HTTPS, as the
+// backend-protocol annotation is set to HTTPS, with the hostname of the proxy-ssl-name annotation their certificates
+// are validated for, if any. Other protocols than HTTP are reported with an Event, as they are not converted.
+func (r *IngressReconciler) nginxHTTPSServices(ctx context.Context, ingress *networkingv1.Ingress) (map[string]bool, string, error) {
+	value, ok := ingress.Annotations[nginxBackendProtocolAnnotation]
+	if !ok {
+		return nil, "", nil
+	}
+	profile, err := r.conversionProfile(ctx, *ingress)
+	if err != nil || !profile.translates(nginxAnnotationPrefix) {
+		return nil, "", err
+	}
+	switch strings.ToUpper(value) {
+	case "HTTP", "AUTO_HTTP":
+		return nil, "", nil
+	case "HTTPS":
+	default:
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedBackendProtocol",
+			fmt.Sprintf("Backend protocol %s is not converted, the Gateways connect to the backends with the "+
+				"appProtocol of their Service ports", value))
+		return nil, "", nil
+	}
+
+	services := make(map[string]bool)
+	if backend := ingress.Spec.DefaultBackend; backend != nil && backend.Service != nil {
+		services[backend.Service.Name] = true
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service != nil {
+				services[path.Backend.Service.Name] = true
+			}
+		}
+	}
+
+	hostname := ingress.Annotations[nginxProxySSLNameAnnotation]
+	if hostname != "" && len(validation.IsDNS1123Subdomain(hostname)) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedBackendProtocol",
+			fmt.Sprintf("Proxy SSL name %q is not a hostname, the certificates of the backends are validated for "+
+				"their cluster-local hostnames", hostname))
+		hostname = ""
+	}
+	return services, hostname, nil
+}
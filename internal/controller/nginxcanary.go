@@ -0,0 +1,267 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxCanaryAnnotation marks an Ingress whose backends receive part of the traffic of the Ingress with the
+	// same hosts and paths
+	nginxCanaryAnnotation = nginxAnnotationPrefix + "canary"
+	// nginxCanaryWeightAnnotation is the share of the traffic the canary receives, out of the weight total
+	nginxCanaryWeightAnnotation = nginxAnnotationPrefix + "canary-weight"
+	// nginxCanaryWeightTotalAnnotation is the total the canary weight is relative to, 100 by default
+	nginxCanaryWeightTotalAnnotation = nginxAnnotationPrefix + "canary-weight-total"
+	// nginxCanaryByHeaderAnnotation is the request header routing to the canary, when set to always
+	nginxCanaryByHeaderAnnotation = nginxAnnotationPrefix + "canary-by-header"
+	// nginxCanaryByHeaderValueAnnotation is the value of the request header routing to the canary instead of always
+	nginxCanaryByHeaderValueAnnotation = nginxAnnotationPrefix + "canary-by-header-value"
+	// nginxCanaryHeaderAlways is the value of the canary header routing to the canary without a header value
+	nginxCanaryHeaderAlways = "always"
+)
+
+// isNginxCanary returns true if the Ingress is an nginx canary of another Ingress
+func isNginxCanary(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[nginxCanaryAnnotation] == "true"
+}
+
+// isTranslatedNginxCanary returns true if the Ingress is an nginx canary whose annotations are translated, which is
+// merged into the HTTPRoutes of the Ingress it is a canary of instead of being converted itself
+func (r *IngressReconciler) isTranslatedNginxCanary(ctx context.Context, ingress networkingv1.Ingress) (bool, error) {
+	if !isNginxCanary(ingress) {
+		return false, nil
+	}
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil {
+		return false, err
+	}
+	return profile.translates(nginxAnnotationPrefix), nil
+}
+
+// nginxCanaryWeights returns the weight of the canary and the total it is relative to. Like nginx, an invalid
+// total is replaced by 100, and the weight is limited to the total.
+func nginxCanaryWeights(canary networkingv1.Ingress) (int32, int32) {
+	total, err := strconv.ParseInt(canary.Annotations[nginxCanaryWeightTotalAnnotation], 10, 32)
+	if err != nil || total <= 0 {
+		total = 100
+	}
+	weight, err := strconv.ParseInt(canary.Annotations[nginxCanaryWeightAnnotation], 10, 32)
+	if err != nil || weight < 0 {
+		weight = 0
+	}
+	return int32(min(weight, total)), int32(total)
+}
+
+// listNginxCanaries returns the translated nginx canaries in the namespace of the Ingress routing by weight or by
+// header and sharing a host with the rules, sorted by name. Their hosts are rewritten like the hosts of the Ingress.
+// Without a client, e.g. when simulating, there are none.
+func (r *IngressReconciler) listNginxCanaries(ctx context.Context, ingress networkingv1.Ingress, rules []networkingv1.IngressRule) ([]networkingv1.Ingress, error) {
+	if r.Client == nil {
+		return nil, nil
+	}
+	candidates, err := r.listIngressesWithHosts(ctx, ingress.Namespace, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var canaries []networkingv1.Ingress
+	for _, candidate := range candidates {
+		if candidate.Name == ingress.Name ||
+			candidate.Annotations[nginxCanaryWeightAnnotation] == "" && candidate.Annotations[nginxCanaryByHeaderAnnotation] == "" {
+			continue
+		}
+		canary, err := r.isTranslatedNginxCanary(ctx, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !canary {
+			continue
+		}
+		matches, err := r.MatchesIngressClass(ctx, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			canaries = append(canaries, r.rewriteHostnames(candidate))
+		}
+	}
+	slices.SortFunc(canaries, func(a, b networkingv1.Ingress) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return canaries, nil
+}
+
+// listIngressesWithHosts returns the Ingresses in the namespace, looked up in the host index by the hosts of the
+// rules if the controller registered it. Otherwise all Ingresses in the namespace are listed, the caller matches
+// their hosts.
+func (r *IngressReconciler) listIngressesWithHosts(ctx context.Context, namespace string, rules []networkingv1.IngressRule) ([]networkingv1.Ingress, error) {
+	if !r.hostIndexed {
+		var ingressList networkingv1.IngressList
+		if err := r.List(ctx, &ingressList, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		return ingressList.Items, nil
+	}
+
+	var result []networkingv1.Ingress
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Host == "" || seen[canonicalHostname(rule.Host)] {
+			continue
+		}
+		seen[canonicalHostname(rule.Host)] = true
+		var ingressList networkingv1.IngressList
+		if err := r.List(ctx, &ingressList, client.InNamespace(namespace),
+			client.MatchingFields{ingressHostIndex: canonicalHostname(rule.Host)}); err != nil {
+			return nil, err
+		}
+		for _, ingress := range ingressList.Items {
+			if !slices.ContainsFunc(result, func(i networkingv1.Ingress) bool { return i.Name == ingress.Name }) {
+				result = append(result, ingress)
+			}
+		}
+	}
+	return result, nil
+}
+
+// findNginxCanaryPath returns the first canary with the same path for the hostname, and that path
+func findNginxCanaryPath(canaries []networkingv1.Ingress, hostname string, path networkingv1.HTTPIngressPath) (*networkingv1.Ingress, *networkingv1.HTTPIngressPath) {
+	for i, canary := range canaries {
+		for _, rule := range groupRulesByHostname(canary.Spec.Rules)[hostname] {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, canaryPath := range rule.HTTP.Paths {
+				if canaryPath.Path == path.Path && ptr.Equal(canaryPath.PathType, path.PathType) {
+					return &canaries[i], &canaryPath
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// nginxCanaryBackendRefs splits the traffic of a path between the backend of the Ingress and the backend of its
+// canary by their weights, instead of converting the canary to a HTTPRoute conflicting with the one of the Ingress.
+// Nil is returned for a canary routing by header only.
+func (r *IngressReconciler) nginxCanaryBackendRefs(ctx context.Context, backendRef gatewayv1.HTTPBackendRef, canary networkingv1.Ingress, canaryPath networkingv1.HTTPIngressPath) ([]gatewayv1.HTTPBackendRef, error) {
+	if canary.Annotations[nginxCanaryWeightAnnotation] == "" {
+		return nil, nil
+	}
+	weight, total := nginxCanaryWeights(canary)
+	canaryBackendRef, err := r.mapNginxCanaryBackendRef(ctx, canary, canaryPath, ptr.To(weight))
+	if err != nil || canaryBackendRef == nil {
+		return nil, err
+	}
+
+	backendRef.Weight = ptr.To(total - weight)
+	return []gatewayv1.HTTPBackendRef{backendRef, *canaryBackendRef}, nil
+}
+
+// nginxCanaryHeaderRule returns a copy of the rule of a path that routes the requests with the canary header to the
+// backend of the canary, or nil if the canary does not route by header. Its matches have a header match more than
+// the rule, so it takes precedence over the rule and its weights, like the header does over the weight in nginx.
+func (r *IngressReconciler) nginxCanaryHeaderRule(ctx context.Context, rule gatewayv1.HTTPRouteRule, canary networkingv1.Ingress, canaryPath networkingv1.HTTPIngressPath) (*gatewayv1.HTTPRouteRule, error) {
+	header := canary.Annotations[nginxCanaryByHeaderAnnotation]
+	if header == "" {
+		return nil, nil
+	}
+	canaryBackendRef, err := r.mapNginxCanaryBackendRef(ctx, canary, canaryPath, r.backendWeight())
+	if err != nil || canaryBackendRef == nil {
+		return nil, err
+	}
+
+	headerRule := rule.DeepCopy()
+	headerMatch := gatewayv1.HTTPHeaderMatch{
+		Type:  ptr.To(gatewayv1.HeaderMatchExact),
+		Name:  gatewayv1.HTTPHeaderName(header),
+		Value: cmp.Or(canary.Annotations[nginxCanaryByHeaderValueAnnotation], nginxCanaryHeaderAlways),
+	}
+	for i := range headerRule.Matches {
+		headerRule.Matches[i].Headers = append(headerRule.Matches[i].Headers, headerMatch)
+	}
+	headerRule.BackendRefs = []gatewayv1.HTTPBackendRef{*canaryBackendRef}
+	if headerRule.Name != nil {
+		headerRule.Name = ptr.To(gatewayv1.SectionName(truncateName(string(*headerRule.Name) + "-canary")))
+	}
+	return headerRule, nil
+}
+
+// mapNginxCanaryBackendRef returns the backendRef of the path of the canary with the weight, or nil if its named port
+// cannot be resolved without Service lookups
+func (r *IngressReconciler) mapNginxCanaryBackendRef(ctx context.Context, canary networkingv1.Ingress, canaryPath networkingv1.HTTPIngressPath, weight *int32) (*gatewayv1.HTTPBackendRef, error) {
+	if r.DisableServiceLookups && isNamedServicePort(canaryPath.Backend) {
+		r.event(&canary, corev1.EventTypeWarning, "UnresolvedNamedPort",
+			fmt.Sprintf("Backend %s:%s of canary path %s is left out, named ports are not resolved without Service lookups",
+				canaryPath.Backend.Service.Name, canaryPath.Backend.Service.Port.Name, canaryPath.Path))
+		return nil, nil
+	}
+	canaryBackendRef, err := r.mapBackendRef(ctx, canary.Namespace, canaryPath.Backend, weight)
+	if err != nil || canaryBackendRef == nil {
+		return nil, err
+	}
+	if r.CrossNamespaceBackends && !r.DisableServiceLookups {
+		if *canaryBackendRef, err = r.mapCrossNamespaceBackendRef(ctx, canary, *canaryBackendRef); err != nil {
+			return nil, err
+		}
+	}
+	return canaryBackendRef, nil
+}
+
+// canaryEventHandler enqueues the Ingresses sharing a host with a changed nginx canary, so they split their traffic
+// with its new backends and weight. For updates the canary before and after the change is considered.
+func (r *IngressReconciler) canaryEventHandler() handler.EventHandler {
+	enqueueCanaries := func(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], objects ...client.Object) {
+		var canaries []client.Object
+		for _, obj := range objects {
+			if ingress, ok := obj.(*networkingv1.Ingress); ok && isNginxCanary(*ingress) {
+				canaries = append(canaries, obj)
+			}
+		}
+		if len(canaries) > 0 {
+			r.enqueueSiblings(ctx, q, canaries...)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueCanaries(ctx, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueCanaries(ctx, q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueueCanaries(ctx, q, e.Object)
+		},
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestNginxCanaryWeights(t *testing.T) {
+	tests := []struct {
+		name           string
+		weight         string
+		total          string
+		expectedWeight int32
+		expectedTotal  int32
+	}{
+		{name: "default total", weight: "20", expectedWeight: 20, expectedTotal: 100},
+		{name: "custom total", weight: "20", total: "1000", expectedWeight: 20, expectedTotal: 1000},
+		{name: "weight above total", weight: "150", expectedWeight: 100, expectedTotal: 100},
+		{name: "invalid total", weight: "20", total: "zero", expectedWeight: 20, expectedTotal: 100},
+		{name: "invalid weight", weight: "-5", expectedWeight: 0, expectedTotal: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				nginxCanaryWeightAnnotation:      tt.weight,
+				nginxCanaryWeightTotalAnnotation: tt.total,
+			}}}
+			if weight, total := nginxCanaryWeights(canary); weight != tt.expectedWeight || total != tt.expectedTotal {
+				t.Errorf("expected %d/%d, got %d/%d", tt.expectedWeight, tt.expectedTotal, weight, total)
+			}
+		})
+	}
+}
+
+func TestListNginxCanaries(t *testing.T) {
+	newIngress := func(name, host string, annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: host}}},
+		}
+	}
+	primary := newIngress("app", "app.example.com", nil)
+	objects := []client.Object{
+		primary,
+		newIngress("weighted", "app.example.com", map[string]string{nginxCanaryAnnotation: "true", nginxCanaryWeightAnnotation: "10"}),
+		newIngress("by-header", "app.example.com", map[string]string{nginxCanaryAnnotation: "true", nginxCanaryByHeaderAnnotation: "X-Canary"}),
+		// Canaries routing by cookie are not merged
+		newIngress("by-cookie", "app.example.com", map[string]string{nginxCanaryAnnotation: "true", nginxAnnotationPrefix + "canary-by-cookie": "canary"}),
+		newIngress("not-a-canary", "app.example.com", map[string]string{nginxCanaryWeightAnnotation: "10"}),
+		newIngress("other-host", "other.example.com", map[string]string{nginxCanaryAnnotation: "true", nginxCanaryWeightAnnotation: "10"}),
+	}
+
+	for _, indexed := range []bool{false, true} {
+		builder := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(objects...)
+		if indexed {
+			builder = builder.WithIndex(&networkingv1.Ingress{}, ingressHostIndex, indexIngressHosts)
+		}
+		r := &IngressReconciler{Client: builder.Build(), hostIndexed: indexed}
+
+		canaries, err := r.listNginxCanaries(context.Background(), *primary, primary.Spec.Rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, canary := range canaries {
+			names = append(names, canary.Name)
+		}
+		// The canary of another host is only left out by the index, its paths never match
+		expected := []string{"by-header", "weighted"}
+		if !indexed {
+			expected = []string{"by-header", "other-host", "weighted"}
+		}
+		if !slices.Equal(names, expected) {
+			t.Errorf("expected canaries %v with index %t, got %v", expected, indexed, names)
+		}
+	}
+
+	// Without a client, e.g. when simulating, nothing is looked up
+	r := &IngressReconciler{}
+	if canaries, err := r.listNginxCanaries(context.Background(), *primary, primary.Spec.Rules); err != nil || canaries != nil {
+		t.Errorf("expected no canaries without a client, got %v: %v", canaries, err)
+	}
+}
+
+func TestNginxCanaryHeaderRule(t *testing.T) {
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).Build()}
+	rule := gatewayv1.HTTPRouteRule{
+		Name:    ptr.To(gatewayv1.SectionName("api")),
+		Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{Value: ptr.To("/api")}}},
+	}
+	canaryPath := networkingv1.HTTPIngressPath{Path: "/api", Backend: networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: "api-v2", Port: networkingv1.ServiceBackendPort{Number: 80}},
+	}}
+	newCanary := func(annotations map[string]string) networkingv1.Ingress {
+		return networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Annotations: annotations}}
+	}
+
+	headerRule, err := r.nginxCanaryHeaderRule(context.Background(), rule,
+		newCanary(map[string]string{nginxCanaryByHeaderAnnotation: "X-Canary"}), canaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []gatewayv1.HTTPHeaderMatch{{Type: ptr.To(gatewayv1.HeaderMatchExact), Name: "X-Canary", Value: "always"}}
+	if headerRule == nil || !isEqual(headerRule.Matches[0].Headers, expected) || headerRule.BackendRefs[0].Name != "api-v2" {
+		t.Fatalf("expected a rule matching X-Canary: always to the canary, got %+v", headerRule)
+	}
+	if *headerRule.Name != "api-canary" || len(rule.Matches[0].Headers) != 0 {
+		t.Errorf("expected the rule to be named api-canary and the original rule to be unchanged, got %s", *headerRule.Name)
+	}
+
+	headerRule, err = r.nginxCanaryHeaderRule(context.Background(), rule, newCanary(map[string]string{
+		nginxCanaryByHeaderAnnotation:      "X-Canary",
+		nginxCanaryByHeaderValueAnnotation: "beta",
+	}), canaryPath)
+	if err != nil || headerRule.Matches[0].Headers[0].Value != "beta" {
+		t.Errorf("expected a match of the header value beta, got %+v: %v", headerRule, err)
+	}
+
+	// Canaries routing by weight only
+	if headerRule, err := r.nginxCanaryHeaderRule(context.Background(), rule,
+		newCanary(map[string]string{nginxCanaryWeightAnnotation: "10"}), canaryPath); err != nil || headerRule != nil {
+		t.Errorf("expected no rule without a canary header, got %+v: %v", headerRule, err)
+	}
+}
+
+func TestNginxCanaryNamedPortWithoutServiceLookups(t *testing.T) {
+	var gets int
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				gets++
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build(),
+		Recorder:              recorder,
+		DisableServiceLookups: true,
+	}
+	backendRef := gatewayv1.HTTPBackendRef{BackendRef: gatewayv1.BackendRef{BackendObjectReference: gatewayv1.BackendObjectReference{
+		Name: "app", Port: ptr.To(gatewayv1.PortNumber(80)),
+	}}}
+	canary := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name: "app-canary", Namespace: "default", Annotations: map[string]string{nginxCanaryWeightAnnotation: "10"},
+	}}
+	canaryPath := networkingv1.HTTPIngressPath{Path: "/", Backend: networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: "app-canary", Port: networkingv1.ServiceBackendPort{Name: "http"}},
+	}}
+
+	backendRefs, err := r.nginxCanaryBackendRefs(context.Background(), backendRef, canary, canaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backendRefs != nil || gets != 0 {
+		t.Errorf("expected the canary to be left out without a Service lookup, got %+v after %d lookups", backendRefs, gets)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnresolvedNamedPort") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
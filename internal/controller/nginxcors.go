@@ -0,0 +1,179 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxEnableCORSAnnotation makes nginx answer preflight requests and add the CORS headers to the responses
+	nginxEnableCORSAnnotation = nginxAnnotationPrefix + "enable-cors"
+	// nginxCORSAllowOriginAnnotation is the comma-separated list of origins allowed to share the responses
+	nginxCORSAllowOriginAnnotation = nginxAnnotationPrefix + "cors-allow-origin"
+	// nginxCORSAllowMethodsAnnotation is the comma-separated list of methods allowed for cross-origin requests
+	nginxCORSAllowMethodsAnnotation = nginxAnnotationPrefix + "cors-allow-methods"
+	// nginxCORSAllowHeadersAnnotation is the comma-separated list of headers allowed in cross-origin requests
+	nginxCORSAllowHeadersAnnotation = nginxAnnotationPrefix + "cors-allow-headers"
+	// nginxCORSExposeHeadersAnnotation is the comma-separated list of response headers exposed to scripts
+	nginxCORSExposeHeadersAnnotation = nginxAnnotationPrefix + "cors-expose-headers"
+	// nginxCORSAllowCredentialsAnnotation allows cross-origin requests to include credentials, true by default
+	nginxCORSAllowCredentialsAnnotation = nginxAnnotationPrefix + "cors-allow-credentials"
+	// nginxCORSMaxAgeAnnotation is the number of seconds clients may cache the result of a preflight request
+	nginxCORSMaxAgeAnnotation = nginxAnnotationPrefix + "cors-max-age"
+
+	// nginxDefaultCORSAllowMethods are the methods nginx allows when cors-allow-methods is not set
+	nginxDefaultCORSAllowMethods = "GET, PUT, POST, DELETE, PATCH, OPTIONS"
+	// nginxDefaultCORSAllowHeaders are the headers nginx allows when cors-allow-headers is not set
+	nginxDefaultCORSAllowHeaders = "DNT,Keep-Alive,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control," +
+		"Content-Type,Range,Authorization"
+	// nginxDefaultCORSMaxAge is the number of seconds nginx uses when cors-max-age is not set
+	nginxDefaultCORSMaxAge = 1728000
+)
+
+// splitList splits a comma-separated annotation value, leaving out empty items
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// joinList joins the values into a comma-separated header value
+func joinList[T ~string](values []T) string {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		items = append(items, string(value))
+	}
+	return strings.Join(items, ", ")
+}
+
+// corsFilter returns the CORS filter for the CORS annotations of the Ingress, with the defaults of nginx for the
+// ones that are not set, or nil if CORS is not enabled. An invalid max age is replaced by the default with an Event.
+func (r *IngressReconciler) corsFilter(ingress *networkingv1.Ingress) *gatewayv1.HTTPRouteFilter {
+	if ingress.Annotations[nginxEnableCORSAnnotation] != "true" {
+		return nil
+	}
+
+	cors := &gatewayv1.HTTPCORSFilter{
+		AllowCredentials: ingress.Annotations[nginxCORSAllowCredentialsAnnotation] != "false",
+		MaxAge:           nginxDefaultCORSMaxAge,
+	}
+	for _, origin := range splitList(cmp.Or(ingress.Annotations[nginxCORSAllowOriginAnnotation], "*")) {
+		cors.AllowOrigins = append(cors.AllowOrigins, gatewayv1.AbsoluteURI(origin))
+	}
+	for _, method := range splitList(cmp.Or(ingress.Annotations[nginxCORSAllowMethodsAnnotation], nginxDefaultCORSAllowMethods)) {
+		cors.AllowMethods = append(cors.AllowMethods, gatewayv1.HTTPMethodWithWildcard(strings.ToUpper(method)))
+	}
+	for _, header := range splitList(cmp.Or(ingress.Annotations[nginxCORSAllowHeadersAnnotation], nginxDefaultCORSAllowHeaders)) {
+		cors.AllowHeaders = append(cors.AllowHeaders, gatewayv1.HTTPHeaderName(header))
+	}
+	for _, header := range splitList(ingress.Annotations[nginxCORSExposeHeadersAnnotation]) {
+		cors.ExposeHeaders = append(cors.ExposeHeaders, gatewayv1.HTTPHeaderName(header))
+	}
+	if value, ok := ingress.Annotations[nginxCORSMaxAgeAnnotation]; ok {
+		maxAge, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || maxAge <= 0 {
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedCORS",
+				fmt.Sprintf("CORS max age %q is not a positive number of seconds, the default of %d is used",
+					value, nginxDefaultCORSMaxAge))
+		} else {
+			cors.MaxAge = int32(maxAge)
+		}
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterCORS, CORS: cors}
+}
+
+// corsHeaderFilter returns the ResponseHeaderModifier filter that sets the CORS headers nginx adds to the responses,
+// for Gateways without the CORS filter. Unlike the CORS filter, it cannot echo one of several origins or answer
+// preflight requests, so false is returned for several origins.
+func corsHeaderFilter(cors gatewayv1.HTTPCORSFilter) (gatewayv1.HTTPRouteFilter, bool) {
+	if len(cors.AllowOrigins) != 1 {
+		return gatewayv1.HTTPRouteFilter{}, false
+	}
+
+	headers := []gatewayv1.HTTPHeader{{Name: "Access-Control-Allow-Origin", Value: string(cors.AllowOrigins[0])}}
+	if cors.AllowCredentials {
+		headers = append(headers, gatewayv1.HTTPHeader{Name: "Access-Control-Allow-Credentials", Value: "true"})
+	}
+	if len(cors.AllowMethods) > 0 {
+		headers = append(headers, gatewayv1.HTTPHeader{Name: "Access-Control-Allow-Methods", Value: joinList(cors.AllowMethods)})
+	}
+	if len(cors.AllowHeaders) > 0 {
+		headers = append(headers, gatewayv1.HTTPHeader{Name: "Access-Control-Allow-Headers", Value: joinList(cors.AllowHeaders)})
+	}
+	if len(cors.ExposeHeaders) > 0 {
+		headers = append(headers, gatewayv1.HTTPHeader{Name: "Access-Control-Expose-Headers", Value: joinList(cors.ExposeHeaders)})
+	}
+	if cors.MaxAge > 0 {
+		headers = append(headers, gatewayv1.HTTPHeader{Name: "Access-Control-Max-Age", Value: strconv.Itoa(int(cors.MaxAge))})
+	}
+	return gatewayv1.HTTPRouteFilter{
+		Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+		ResponseHeaderModifier: &gatewayv1.HTTPHeaderFilter{Set: headers},
+	}, true
+}
+
+// hasCORSFilter returns true if the rule has a CORS filter
+func hasCORSFilter(rule gatewayv1.HTTPRouteRule) bool {
+	return slices.ContainsFunc(rule.Filters, func(filter gatewayv1.HTTPRouteFilter) bool {
+		return filter.Type == gatewayv1.HTTPRouteFilterCORS
+	})
+}
+
+// fallbackCORSFilters returns a copy of the HTTPRoute whose CORS filters are replaced by ResponseHeaderModifier
+// filters, for Gateways not advertising the CORS filter of the experimental channel. CORS filters that cannot be
+// expressed by headers are dropped with an Event.
+func (r *IngressReconciler) fallbackCORSFilters(ingress *networkingv1.Ingress, httpRoute gatewayv1.HTTPRoute) gatewayv1.HTTPRoute {
+	if !slices.ContainsFunc(httpRoute.Spec.Rules, hasCORSFilter) {
+		return httpRoute
+	}
+
+	httpRoute = *httpRoute.DeepCopy()
+	var dropped bool
+	for i, rule := range httpRoute.Spec.Rules {
+		var filters []gatewayv1.HTTPRouteFilter
+		for _, filter := range rule.Filters {
+			if filter.Type == gatewayv1.HTTPRouteFilterCORS {
+				var ok bool
+				if filter, ok = corsHeaderFilter(*filter.CORS); !ok {
+					dropped = true
+					continue
+				}
+			}
+			filters = append(filters, filter)
+		}
+		httpRoute.Spec.Rules[i].Filters = mergeHeaderFilters(filters)
+	}
+	if dropped {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedCORS",
+			fmt.Sprintf("HTTPRoute %s allows several CORS origins, which Gateways without the CORS filter cannot "+
+				"express; the CORS headers are left out", httpRoute.Name))
+	}
+	return httpRoute
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestCORSFilter(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app",
+		Namespace: "default",
+		Annotations: map[string]string{
+			nginxEnableCORSAnnotation:           "true",
+			nginxCORSAllowOriginAnnotation:      "https://a.example.com, https://b.example.com",
+			nginxCORSAllowMethodsAnnotation:     "get,post",
+			nginxCORSAllowCredentialsAnnotation: "false",
+			nginxCORSMaxAgeAnnotation:           "forever",
+		},
+	}}
+
+	filter := r.corsFilter(ingress)
+	if filter == nil || filter.Type != gatewayv1.HTTPRouteFilterCORS {
+		t.Fatalf("expected a CORS filter, got %+v", filter)
+	}
+	expected := &gatewayv1.HTTPCORSFilter{
+		AllowOrigins: []gatewayv1.AbsoluteURI{"https://a.example.com", "https://b.example.com"},
+		AllowMethods: []gatewayv1.HTTPMethodWithWildcard{"GET", "POST"},
+		AllowHeaders: []gatewayv1.HTTPHeaderName{"DNT", "Keep-Alive", "User-Agent", "X-Requested-With",
+			"If-Modified-Since", "Cache-Control", "Content-Type", "Range", "Authorization"},
+		MaxAge: nginxDefaultCORSMaxAge,
+	}
+	if !isEqual(filter.CORS, expected) {
+		t.Errorf("expected %+v, got %+v", expected, filter.CORS)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedCORS") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	if filter := r.corsFilter(&networkingv1.Ingress{}); filter != nil {
+		t.Errorf("expected no filter without enable-cors, got %+v", filter)
+	}
+}
+
+func TestCORSHeaderFilter(t *testing.T) {
+	filter, ok := corsHeaderFilter(gatewayv1.HTTPCORSFilter{
+		AllowOrigins:     []gatewayv1.AbsoluteURI{"*"},
+		AllowCredentials: true,
+		AllowMethods:     []gatewayv1.HTTPMethodWithWildcard{"GET", "POST"},
+		ExposeHeaders:    []gatewayv1.HTTPHeaderName{"X-Total-Count"},
+		MaxAge:           600,
+	})
+	if !ok {
+		t.Fatal("expected the CORS filter to be expressed by headers")
+	}
+	expected := []gatewayv1.HTTPHeader{
+		{Name: "Access-Control-Allow-Origin", Value: "*"},
+		{Name: "Access-Control-Allow-Credentials", Value: "true"},
+		{Name: "Access-Control-Allow-Methods", Value: "GET, POST"},
+		{Name: "Access-Control-Expose-Headers", Value: "X-Total-Count"},
+		{Name: "Access-Control-Max-Age", Value: "600"},
+	}
+	if filter.Type != gatewayv1.HTTPRouteFilterResponseHeaderModifier || !isEqual(filter.ResponseHeaderModifier.Set, expected) {
+		t.Errorf("expected the headers %+v, got %+v", expected, filter)
+	}
+
+	// Only the CORS filter can echo one of several origins
+	if _, ok := corsHeaderFilter(gatewayv1.HTTPCORSFilter{
+		AllowOrigins: []gatewayv1.AbsoluteURI{"https://a.example.com", "https://b.example.com"},
+	}); ok {
+		t.Error("expected several origins not to be expressed by headers")
+	}
+}
+
+func TestAdaptCORSFilters(t *testing.T) {
+	newRoute := func(gateway string, origins ...gatewayv1.AbsoluteURI) gatewayv1.HTTPRoute {
+		return gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-" + gateway, Namespace: "default"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+					Namespace: ptr.To(gatewayv1.Namespace("default")),
+					Name:      gatewayv1.ObjectName(gateway),
+				}}},
+				Rules: []gatewayv1.HTTPRouteRule{{Filters: []gatewayv1.HTTPRouteFilter{{
+					Type: gatewayv1.HTTPRouteFilterCORS,
+					CORS: &gatewayv1.HTTPCORSFilter{AllowOrigins: origins},
+				}}}},
+			},
+		}
+	}
+	newGateway := func(name string) gatewayv1.Gateway {
+		return gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       gatewayv1.GatewaySpec{GatewayClassName: gatewayv1.ObjectName(name)},
+		}
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{newGateway("cors"), newGateway("standard")}}
+	cors := &gatewayv1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "cors"}}
+	cors.Status.SupportedFeatures = []gatewayv1.SupportedFeature{{Name: gatewayv1.FeatureName(supportHTTPRouteCORS)}}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client:            fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(cors).Build(),
+		Recorder:          recorder,
+		SupportedFeatures: true,
+	}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	httpRoutes, err := r.adaptToSupportedFeatures(context.Background(), ingress, []gatewayv1.HTTPRoute{
+		newRoute("cors", "https://a.example.com", "https://b.example.com"),
+		newRoute("standard", "https://a.example.com"),
+		newRoute("standard", "https://a.example.com", "https://b.example.com"),
+	}, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filters := httpRoutes[0].Spec.Rules[0].Filters; len(filters) != 1 || filters[0].Type != gatewayv1.HTTPRouteFilterCORS {
+		t.Errorf("expected the CORS filter to be kept for an advertising GatewayClass, got %+v", filters)
+	}
+	if filters := httpRoutes[1].Spec.Rules[0].Filters; len(filters) != 1 || filters[0].Type != gatewayv1.HTTPRouteFilterResponseHeaderModifier {
+		t.Errorf("expected the CORS headers for a GatewayClass without CORS, got %+v", filters)
+	}
+	if filters := httpRoutes[2].Spec.Rules[0].Filters; len(filters) != 0 {
+		t.Errorf("expected several origins to be left out, got %+v", filters)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedCORS") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
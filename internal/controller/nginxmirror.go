@@ -0,0 +1,119 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxMirrorTargetAnnotation is the URL nginx mirrors the requests to, usually ending with $request_uri
+	nginxMirrorTargetAnnotation = nginxAnnotationPrefix + "mirror-target"
+	// nginxMirrorURIAnnotation is the older form of mirror-target
+	nginxMirrorURIAnnotation = nginxAnnotationPrefix + "mirror-uri"
+	// nginxMirrorPercentageAnnotation is the percentage of the requests that is mirrored, all of them by default
+	nginxMirrorPercentageAnnotation = nginxAnnotationPrefix + "mirror-percentage"
+	// nginxRequestURIVariable is the nginx variable of the path and query of the request
+	nginxRequestURIVariable = "$request_uri"
+)
+
+// mirrorFilter returns the RequestMirror filter for the mirror-target or mirror-uri annotation of the Ingress, or nil
+// if it has neither. The host of the URL must be the name of a Service, e.g. mirror.default.svc.cluster.local, with
+// the port of the URL or else of its scheme as port. Targets that are no Service, or that replace the request URI,
+// cannot be expressed: an Event is emitted and no filter returned. A Service in another namespace is only mirrored
+// to if a ReferenceGrant permits it, or if one will be created by AutoGrant with CrossNamespaceBackends.
+func (r *IngressReconciler) mirrorFilter(ctx context.Context, ingress *networkingv1.Ingress) (*gatewayv1.HTTPRouteFilter, error) {
+	target := cmp.Or(ingress.Annotations[nginxMirrorTargetAnnotation], ingress.Annotations[nginxMirrorURIAnnotation])
+	if target == "" {
+		return nil, nil
+	}
+	unsupported := func(reason string) (*gatewayv1.HTTPRouteFilter, error) {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedMirror",
+			fmt.Sprintf("Mirror target %q %s, the requests are not mirrored", target, reason))
+		return nil, nil
+	}
+
+	mirrorURL, err := url.Parse(strings.TrimSuffix(target, nginxRequestURIVariable))
+	if err != nil || mirrorURL.Hostname() == "" {
+		return unsupported("is not an absolute URL")
+	}
+	if mirrorURL.Path != "" || mirrorURL.RawQuery != "" {
+		return unsupported("replaces the request URI, which a RequestMirror filter cannot express")
+	}
+
+	name, namespace := mirrorURL.Hostname(), ingress.Namespace
+	if match := clusterServiceName.FindStringSubmatch(name); match != nil {
+		name, namespace = match[1], match[3]
+	} else if len(validation.IsDNS1035Label(name)) > 0 {
+		return unsupported("is not the name of a Service")
+	}
+	port := 80
+	if mirrorURL.Scheme == "https" {
+		port = 443
+	}
+	if mirrorURL.Port() != "" {
+		if port, err = strconv.Atoi(mirrorURL.Port()); err != nil {
+			return unsupported("has an invalid port")
+		}
+	}
+
+	backendRef := gatewayv1.BackendObjectReference{
+		Group: ptr.To(gatewayv1.Group("")),
+		Kind:  ptr.To(gatewayv1.Kind("Service")),
+		Name:  gatewayv1.ObjectName(name),
+		// Like the backendRefs, so the Service is still found once the HTTPRoute is placed in another namespace
+		Namespace: ptr.To(gatewayv1.Namespace(namespace)),
+		Port:      ptr.To(gatewayv1.PortNumber(port)),
+	}
+	if namespace != ingress.Namespace {
+		if !r.CrossNamespaceBackends || !r.AutoGrant {
+			granted, err := r.isReferenceGranted(ctx, "HTTPRoute", ingress.Namespace, backendRef)
+			if err != nil {
+				return nil, err
+			}
+			if !granted {
+				r.event(ingress, corev1.EventTypeWarning, string(gatewayv1.RouteReasonRefNotPermitted),
+					fmt.Sprintf("No ReferenceGrant in namespace %s allows HTTPRoutes in namespace %s to reference Service %s",
+						namespace, ingress.Namespace, name))
+				return nil, nil
+			}
+		}
+	}
+
+	mirror := &gatewayv1.HTTPRequestMirrorFilter{BackendRef: backendRef}
+	if value, ok := ingress.Annotations[nginxMirrorPercentageAnnotation]; ok {
+		percent, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || percent < 0 || percent > 100 {
+			r.event(ingress, corev1.EventTypeWarning, "UnsupportedMirror",
+				fmt.Sprintf("Mirror percentage %q is not a number from 0 to 100, all requests are mirrored", value))
+		} else if percent < 100 {
+			mirror.Percent = ptr.To(int32(percent))
+		}
+	}
+	return &gatewayv1.HTTPRouteFilter{Type: gatewayv1.HTTPRouteFilterRequestMirror, RequestMirror: mirror}, nil
+}
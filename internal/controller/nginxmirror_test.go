@@ -0,0 +1,148 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestMirrorFilter(t *testing.T) {
+	ctx := context.Background()
+	newIngress := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: annotations,
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *gatewayv1.BackendObjectReference
+		percent     *int32
+		event       string
+	}{
+		{
+			name:        "service in the namespace",
+			annotations: map[string]string{nginxMirrorTargetAnnotation: "https://mirror$request_uri"},
+			expected: &gatewayv1.BackendObjectReference{
+				Name: "mirror", Namespace: ptr.To(gatewayv1.Namespace("default")), Port: ptr.To(gatewayv1.PortNumber(443)),
+			},
+		},
+		{
+			name: "cluster service name with a percentage",
+			annotations: map[string]string{
+				nginxMirrorURIAnnotation:        "http://mirror.default.svc.cluster.local:8080$request_uri",
+				nginxMirrorPercentageAnnotation: "25",
+			},
+			expected: &gatewayv1.BackendObjectReference{
+				Name: "mirror", Namespace: ptr.To(gatewayv1.Namespace("default")), Port: ptr.To(gatewayv1.PortNumber(8080)),
+			},
+			percent: ptr.To(int32(25)),
+		},
+		{
+			name:        "service in another namespace without a ReferenceGrant",
+			annotations: map[string]string{nginxMirrorTargetAnnotation: "http://mirror.shadow.svc$request_uri"},
+			event:       "RefNotPermitted",
+		},
+		{
+			name:        "external host",
+			annotations: map[string]string{nginxMirrorTargetAnnotation: "https://mirror.example.com$request_uri"},
+			event:       "UnsupportedMirror",
+		},
+		{
+			name:        "path of its own",
+			annotations: map[string]string{nginxMirrorTargetAnnotation: "http://mirror/shadow"},
+			event:       "UnsupportedMirror",
+		},
+		{
+			name:        "location of the nginx configuration",
+			annotations: map[string]string{nginxMirrorURIAnnotation: "/_mirror"},
+			event:       "UnsupportedMirror",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).Build(), Recorder: recorder}
+			filter, err := r.mirrorFilter(ctx, newIngress(tt.annotations))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.expected == nil {
+				if filter != nil {
+					t.Errorf("expected no filter, got %+v", filter)
+				}
+				if event := <-recorder.Events; !strings.Contains(event, tt.event) {
+					t.Errorf("expected a %s event, got %s", tt.event, event)
+				}
+				return
+			}
+			if filter == nil {
+				t.Fatal("expected a RequestMirror filter")
+			}
+			applyBackendObjectReferenceDefaults(tt.expected)
+			if !isEqual(filter.RequestMirror.BackendRef, *tt.expected) {
+				t.Errorf("expected %+v, got %+v", *tt.expected, filter.RequestMirror.BackendRef)
+			}
+			if !ptr.Equal(filter.RequestMirror.Percent, tt.percent) {
+				t.Errorf("expected percent %v, got %v", tt.percent, filter.RequestMirror.Percent)
+			}
+		})
+	}
+}
+
+func TestMirrorFilterGrants(t *testing.T) {
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "default",
+		Annotations: map[string]string{nginxMirrorTargetAnnotation: "http://mirror.shadow.svc$request_uri"},
+	}}
+	for _, tc := range []struct {
+		name     string
+		r        *IngressReconciler
+		expected bool
+	}{
+		{name: "auto grant", r: &IngressReconciler{CrossNamespaceBackends: true, AutoGrant: true}, expected: true},
+		{name: "gateway namespace routes", r: &IngressReconciler{GatewayNamespaceRoutes: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.r.Client = fake.NewClientBuilder().WithScheme(golden.Scheme).Build()
+			tc.r.Recorder = record.NewFakeRecorder(10)
+			filter, err := tc.r.mirrorFilter(context.Background(), ingress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (filter != nil) != tc.expected {
+				t.Errorf("expected a filter: %t, got %+v", tc.expected, filter)
+			}
+		})
+	}
+}
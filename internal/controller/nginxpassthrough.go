@@ -0,0 +1,239 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// nginxSSLPassthroughAnnotation makes nginx forward the TLS connections for the hosts of the Ingress to the backend
+// of their / path without terminating them
+const nginxSSLPassthroughAnnotation = nginxAnnotationPrefix + "ssl-passthrough"
+
+// sslPassthrough returns true if nginx passes the TLS connections for the hosts of the Ingress through
+func sslPassthrough(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[nginxSSLPassthroughAnnotation] == "true"
+}
+
+// TLSRoutes maps an Ingress with nginx's ssl-passthrough to the TLSRoutes that should exist for it, one per host,
+// attached to the TLS listeners in Passthrough mode of the Gateways. The TLS connections are routed by SNI alone,
+// so only the backend of the / path of a host is kept, as nginx does. Without TLSPassthroughRoutes, or for other
+// Ingresses, no TLSRoutes are returned.
+func (r *IngressReconciler) TLSRoutes(ctx context.Context, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1alpha2.TLSRoute, error) {
+	if !r.TLSPassthroughRoutes || !sslPassthrough(ingress) || r.isSkipped(ingress) {
+		return nil, nil
+	}
+	profile, err := r.conversionProfile(ctx, ingress)
+	if err != nil || !profile.translates(nginxAnnotationPrefix) {
+		return nil, err
+	}
+	if gateways = profile.gateways(r.candidateGateways(gateways)); len(gateways.Items) == 0 {
+		return nil, nil
+	}
+	ingress = r.rewriteHostnames(ingress)
+
+	namespace := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ingress.Namespace}}
+	if usesNamespaceSelector(gateways) {
+		if namespace, err = r.routeNamespace(ctx, ingress.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	owner := createOwnerReference(ingress)
+	nameRoute := r.routeNamer(&ingress)
+	var result []gatewayv1alpha2.TLSRoute
+	for hostname, rules := range groupRulesByHostname(ingress.Spec.Rules) {
+		if hostname == "" {
+			r.event(&ingress, corev1.EventTypeWarning, "UnsupportedPassthrough",
+				"Rules without a host cannot be matched by SNI, they are not converted to a TLSRoute")
+			continue
+		}
+		backendRefs, err := r.passthroughBackendRefs(ctx, &ingress, hostname, rules)
+		if err != nil {
+			return nil, err
+		}
+		if len(backendRefs) == 0 {
+			continue
+		}
+		parentRefs := passthroughParentRefs(namespace, gateways, hostname)
+		if len(parentRefs) == 0 {
+			r.event(&ingress, corev1.EventTypeWarning, "NoMatchingListener",
+				fmt.Sprintf("No Gateway TLS listener in Passthrough mode with a hostname intersecting %q accepts "+
+					"TLSRoutes from namespace %s", hostname, ingress.Namespace))
+			continue
+		}
+
+		result = append(result, gatewayv1alpha2.TLSRoute{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: gatewayv1alpha2.GroupVersion.String(),
+				Kind:       "TLSRoute",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            truncateName(nameRoute(hostname)),
+				Namespace:       ingress.Namespace,
+				OwnerReferences: []metav1.OwnerReference{owner},
+			},
+			Spec: gatewayv1alpha2.TLSRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: parentRefs},
+				Hostnames:       []gatewayv1alpha2.Hostname{gatewayv1alpha2.Hostname(hostname)},
+				Rules:           []gatewayv1alpha2.TLSRouteRule{{BackendRefs: backendRefs}},
+			},
+		})
+	}
+
+	slices.SortFunc(result, func(a, b gatewayv1alpha2.TLSRoute) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result, nil
+}
+
+// passthroughBackendRefs returns the backend of the / path of the rules of a host. The other paths cannot be told
+// apart without terminating TLS and are left out with an Event, as is a host without a / path.
+func (r *IngressReconciler) passthroughBackendRefs(ctx context.Context, ingress *networkingv1.Ingress, hostname string, rules []networkingv1.IngressRule) ([]gatewayv1.BackendRef, error) {
+	var root *networkingv1.HTTPIngressPath
+	var ignored []string
+	for _, rule := range rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i, path := range rule.HTTP.Paths {
+			if root == nil && path.Path == "/" && ptr.Deref(path.PathType, networkingv1.PathTypePrefix) != networkingv1.PathTypeExact {
+				root = &rule.HTTP.Paths[i]
+			} else {
+				ignored = append(ignored, path.Path)
+			}
+		}
+	}
+	if root == nil {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedPassthrough",
+			fmt.Sprintf("Host %q has no / path whose backend the TLS connections are passed through to, it is not "+
+				"converted to a TLSRoute", hostname))
+		return nil, nil
+	}
+	if len(ignored) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedPassthrough",
+			fmt.Sprintf("Paths %s of host %q cannot be routed without terminating TLS, the TLSRoute passes all "+
+				"connections through to the backend of /", strings.Join(ignored, ", "), hostname))
+	}
+
+	backendRef, err := r.mapBackendRef(ctx, ingress.Namespace, root.Backend, r.backendWeight())
+	if err != nil {
+		return nil, err
+	}
+	if backendRef.Port == nil && backendRef.Kind != nil && *backendRef.Kind == "Service" {
+		// A Service backendRef without a port is rejected by the API server
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedPassthrough",
+			fmt.Sprintf("The port of the backend of host %q cannot be resolved, it is not converted to a TLSRoute", hostname))
+		return nil, nil
+	}
+	return []gatewayv1.BackendRef{backendRef.BackendRef}, nil
+}
+
+// passthroughParentRefs returns the parent refs of the TLS listeners in Passthrough mode accepting TLSRoutes for the
+// hostname from the namespace, unless a listener terminating TLS on the same port is preferred for the hostname
+func passthroughParentRefs(namespace corev1.Namespace, gateways gatewayv1.GatewayList, hostname string) []gatewayv1.ParentReference {
+	var result []gatewayv1.ParentReference
+	for _, gateway := range gateways.Items {
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Protocol != gatewayv1.TLSProtocolType || !isPassthroughListener(listener) {
+				continue
+			}
+			if !isListenerAccessibleFromNamespace(listener, gateway.Namespace, namespace) {
+				continue
+			}
+			if listener.Hostname != nil && !hostnamesIntersect(hostname, string(*listener.Hostname)) {
+				continue
+			}
+			// A listener terminating TLS on the same port may take the connections of the hostname
+			if isShadowedListener(gateway, listener, hostname) {
+				continue
+			}
+			result = append(result, createParentRef(gateway, listener))
+		}
+	}
+	slices.SortStableFunc(result, compareParentRef)
+	return result
+}
+
+// reconcileTLSRoute creates or updates a single TLSRoute for the ingress, like reconcileHTTPRoute.
+// A TLSRoute with the name that is not owned by the Ingress is left alone.
+func (r *IngressReconciler) reconcileTLSRoute(ctx context.Context, desired gatewayv1alpha2.TLSRoute, owner metav1.OwnerReference) error {
+	logger := log.FromContext(ctx)
+	routeClient := r.routeClient()
+	name := client.ObjectKeyFromObject(&desired)
+	tlsRoute := gatewayv1alpha2.TLSRoute{}
+	if err := routeClient.Get(ctx, name, &tlsRoute); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := r.checkRouteQuota(ctx, name.Namespace); err != nil {
+			return err
+		}
+
+		tlsRoute.SetNamespace(name.Namespace)
+		tlsRoute.SetName(name.Name)
+		tlsRoute.SetLabels(desired.Labels)
+		if r.TargetCluster == nil {
+			tlsRoute.SetOwnerReferences(desired.OwnerReferences)
+		} else {
+			tlsRoute.SetAnnotations(map[string]string{
+				ownerAnnotation: ownerAnnotationValue(ownerGroupKind(owner), name.Namespace, owner.Name),
+			})
+		}
+		tlsRoute.Spec = desired.Spec
+
+		if err := routeClient.Create(ctx, &tlsRoute); err != nil {
+			return err
+		}
+		logger.Info("created TLSRoute", "name", name)
+		return nil
+	}
+
+	if !r.ownsRoute(tlsRoute.ObjectMeta, desired.ObjectMeta) {
+		logger.Info("TLSRoute belongs to another owner", "name", name)
+		return nil
+	}
+
+	spec := *desired.Spec.DeepCopy()
+	applyTLSRouteDefaults(&spec)
+	if isEqual(tlsRoute.Spec, spec) && hasLabels(tlsRoute.ObjectMeta, desired.Labels) {
+		return nil
+	}
+
+	tlsRoute.Spec = spec
+	for key, value := range desired.Labels {
+		metav1.SetMetaDataLabel(&tlsRoute.ObjectMeta, key, value)
+	}
+	if err := routeClient.Update(ctx, &tlsRoute); err != nil {
+		return err
+	}
+	logger.Info("updated TLSRoute", "name", name)
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func passthroughIngress(paths ...string) networkingv1.Ingress {
+	var ingressPaths []networkingv1.HTTPIngressPath
+	for _, path := range paths {
+		ingressPaths = append(ingressPaths, networkingv1.HTTPIngressPath{
+			Path: path, PathType: ptr.To(networkingv1.PathTypePrefix),
+			Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: "app", Port: networkingv1.ServiceBackendPort{Number: 8443},
+			}},
+		})
+	}
+	return networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "secure", Namespace: "default", Annotations: map[string]string{
+			nginxSSLPassthroughAnnotation: "true",
+		}},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host:             "secure.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: ingressPaths}},
+		}}},
+	}
+}
+
+func TestTLSRoutes(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client:               fake.NewClientBuilder().WithScheme(golden.Scheme).Build(),
+		TLSPassthroughRoutes: true,
+		Recorder:             recorder,
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1.GroupVersion.String(), Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443},
+			{Name: "passthrough", Protocol: gatewayv1.TLSProtocolType, Port: 8443, Hostname: ptr.To(gatewayv1.Hostname("*.example.com")),
+				TLS: &gatewayv1.GatewayTLSConfig{Mode: ptr.To(gatewayv1.TLSModePassthrough)}},
+			{Name: "other", Protocol: gatewayv1.TLSProtocolType, Port: 9443, Hostname: ptr.To(gatewayv1.Hostname("*.example.org")),
+				TLS: &gatewayv1.GatewayTLSConfig{Mode: ptr.To(gatewayv1.TLSModePassthrough)}},
+		}},
+	}}}
+	ingress := passthroughIngress("/", "/admin")
+
+	tlsRoutes, err := r.TLSRoutes(ctx, ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := gatewayv1alpha2.TLSRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+			Group: ptr.To(gatewayv1.Group(gatewayv1.GroupName)), Kind: ptr.To(gatewayv1.Kind("Gateway")),
+			Namespace: ptr.To(gatewayv1.Namespace("default")), Name: "gw", SectionName: ptr.To(gatewayv1.SectionName("passthrough")),
+		}}},
+		Hostnames: []gatewayv1alpha2.Hostname{"secure.example.com"},
+		Rules: []gatewayv1alpha2.TLSRouteRule{{BackendRefs: []gatewayv1.BackendRef{{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+				Namespace: ptr.To(gatewayv1.Namespace("default")), Name: "app", Port: ptr.To(gatewayv1.PortNumber(8443)),
+			},
+			Weight: ptr.To(int32(1)),
+		}}}},
+	}
+	if len(tlsRoutes) != 1 || tlsRoutes[0].Name != "secure-secure-example-com" || !isEqual(tlsRoutes[0].Spec, expected) {
+		t.Fatalf("unexpected TLSRoutes: %+v", tlsRoutes)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedPassthrough") || !strings.Contains(event, "/admin") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// The Ingress is not converted to HTTPRoutes as well
+	httpRoutes, err := r.Convert(ctx, ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 0 {
+		t.Errorf("expected no HTTPRoutes, got %+v", httpRoutes)
+	}
+
+	// Without a / path the connections cannot be passed through
+	if tlsRoutes, err = r.TLSRoutes(ctx, passthroughIngress("/admin"), gateways); err != nil || len(tlsRoutes) != 0 {
+		t.Errorf("expected no TLSRoutes, got %+v, %v", tlsRoutes, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedPassthrough") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// Without a Passthrough listener for the host
+	gateways.Items[0].Spec.Listeners = gateways.Items[0].Spec.Listeners[:1]
+	if tlsRoutes, err = r.TLSRoutes(ctx, passthroughIngress("/"), gateways); err != nil || len(tlsRoutes) != 0 {
+		t.Errorf("expected no TLSRoutes, got %+v, %v", tlsRoutes, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NoMatchingListener") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// Without the option the Ingress is converted to HTTPRoutes
+	r.TLSPassthroughRoutes = false
+	if tlsRoutes, err = r.TLSRoutes(ctx, ingress, gateways); err != nil || len(tlsRoutes) != 0 {
+		t.Errorf("expected no TLSRoutes, got %+v, %v", tlsRoutes, err)
+	}
+}
+
+func TestShadowedListeners(t *testing.T) {
+	ctx := context.Background()
+	r := &IngressReconciler{
+		Client:               fake.NewClientBuilder().WithScheme(golden.Scheme).Build(),
+		TLSPassthroughRoutes: true,
+		Recorder:             record.NewFakeRecorder(10),
+	}
+	passthrough := &gatewayv1.GatewayTLSConfig{Mode: ptr.To(gatewayv1.TLSModePassthrough)}
+	// The Terminate and Passthrough listeners share port 443, the more specific hostname takes the connections
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1.GroupVersion.String(), Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443, Hostname: ptr.To(gatewayv1.Hostname("*.example.com"))},
+			{Name: "secure", Protocol: gatewayv1.TLSProtocolType, Port: 443, Hostname: ptr.To(gatewayv1.Hostname("secure.example.com")), TLS: passthrough},
+			{Name: "passthrough", Protocol: gatewayv1.TLSProtocolType, Port: 443, Hostname: ptr.To(gatewayv1.Hostname("*.example.com")), TLS: passthrough},
+			{Name: "https-alt", Protocol: gatewayv1.HTTPSProtocolType, Port: 8443},
+		}},
+	}}}
+	sectionNames := func(parentRefs []gatewayv1.ParentReference) []string {
+		var names []string
+		for _, parentRef := range parentRefs {
+			names = append(names, string(*parentRef.SectionName))
+		}
+		return names
+	}
+
+	// The exact Passthrough listener takes the connections of its host from the wildcard Terminate listener,
+	// which takes those of the other hosts from the equally specific wildcard Passthrough listener
+	tlsRoutes, err := r.TLSRoutes(ctx, passthroughIngress("/"), gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsRoutes) != 1 || !isEqual(sectionNames(tlsRoutes[0].Spec.ParentRefs), []string{"secure"}) {
+		t.Errorf("unexpected TLSRoutes: %+v", tlsRoutes)
+	}
+
+	ingress := passthroughIngress("/")
+	ingress.Annotations = nil
+	ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+		Host: "app.example.com", IngressRuleValue: ingress.Spec.Rules[0].IngressRuleValue,
+	})
+	httpRoutes, err := r.Convert(ctx, ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"secure-app-example-com":    {"https", "https-alt"},
+		"secure-secure-example-com": {"https-alt"},
+	}
+	if len(httpRoutes) != len(expected) {
+		t.Fatalf("unexpected HTTPRoutes: %+v", httpRoutes)
+	}
+	for _, httpRoute := range httpRoutes {
+		if names := sectionNames(httpRoute.Spec.ParentRefs); !isEqual(names, expected[httpRoute.Name]) {
+			t.Errorf("unexpected listeners of HTTPRoute %s: %v", httpRoute.Name, names)
+		}
+	}
+}
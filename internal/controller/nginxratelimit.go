@@ -0,0 +1,110 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxLimitRPSAnnotation is the number of requests per second nginx accepts from a client address
+	nginxLimitRPSAnnotation = nginxAnnotationPrefix + "limit-rps"
+	// nginxLimitRPMAnnotation is the number of requests per minute nginx accepts from a client address
+	nginxLimitRPMAnnotation = nginxAnnotationPrefix + "limit-rpm"
+	// nginxLimitConnectionsAnnotation is the number of concurrent connections nginx accepts from a client address
+	nginxLimitConnectionsAnnotation = nginxAnnotationPrefix + "limit-connections"
+)
+
+// rateLimitData is passed to the rate limit policy template
+type rateLimitData struct {
+	// Route and Namespace are the name and namespace of the HTTPRoute the policy targets
+	Route     string
+	Namespace string
+	// Ingress is the name of the Ingress the HTTPRoute was converted from
+	Ingress string
+	// RequestsPerSecond, RequestsPerMinute and Connections are the limits per client address, 0 if not limited
+	RequestsPerSecond int
+	RequestsPerMinute int
+	Connections       int
+}
+
+// rateLimits returns the limits of the rate limit annotations of the Ingress, and false if it has none. Values that
+// are not a positive number are left out with an Event.
+func (r *IngressReconciler) rateLimits(ingress *networkingv1.Ingress) (rateLimitData, bool) {
+	var limits rateLimitData
+	var invalid []string
+	for annotation, limit := range map[string]*int{
+		nginxLimitRPSAnnotation:         &limits.RequestsPerSecond,
+		nginxLimitRPMAnnotation:         &limits.RequestsPerMinute,
+		nginxLimitConnectionsAnnotation: &limits.Connections,
+	} {
+		value, ok := ingress.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		if number, err := strconv.Atoi(value); err == nil && number > 0 {
+			*limit = number
+		} else {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", annotation, value))
+		}
+	}
+	if len(invalid) > 0 {
+		slices.Sort(invalid)
+		r.event(ingress, corev1.EventTypeWarning, "InvalidRateLimit",
+			fmt.Sprintf("Rate limits %s are not positive numbers and are left out", strings.Join(invalid, ", ")))
+	}
+	return limits, limits.RequestsPerSecond > 0 || limits.RequestsPerMinute > 0 || limits.Connections > 0
+}
+
+// RateLimitPolicies renders the RateLimitPolicyTemplate for each HTTPRoute of an Ingress with rate limits, as the
+// Gateway API has no rate limit filter. The policies are owned like the HTTPRoutes they target. Without a template,
+// an Event is emitted instead, as the rate limits are lost.
+func (r *IngressReconciler) RateLimitPolicies(ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) ([]*unstructured.Unstructured, error) {
+	limits, ok := r.rateLimits(&ingress)
+	if !ok || len(httpRoutes) == 0 {
+		return nil, nil
+	}
+	if r.RateLimitPolicyTemplate == nil {
+		r.event(&ingress, corev1.EventTypeWarning, "UnsupportedRateLimit",
+			"The rate limits have no Gateway API equivalent, the HTTPRoutes accept any number of requests")
+		return nil, nil
+	}
+
+	return renderPolicies(r.RateLimitPolicyTemplate, httpRoutes, func(httpRoute gatewayv1.HTTPRoute) any {
+		data := limits
+		data.Route, data.Namespace, data.Ingress = httpRoute.Name, httpRoute.Namespace, ingress.Name
+		return data
+	})
+}
+
+// ensureRateLimitPolicies creates or updates the rate limit policies of the HTTPRoutes of the Ingress
+func (r *IngressReconciler) ensureRateLimitPolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	policies, err := r.RateLimitPolicies(ingress, httpRoutes)
+	if err != nil {
+		return err
+	}
+	return r.ensurePolicies(ctx, ingress, policies)
+}
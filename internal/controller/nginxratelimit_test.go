@@ -0,0 +1,122 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const testRateLimitPolicyTemplate = `apiVersion: gateway.envoyproxy.io/v1alpha1
+kind: BackendTrafficPolicy
+metadata:
+  name: "{{ .Route }}-ratelimit"
+spec:
+  targetRefs:
+  - group: gateway.networking.k8s.io
+    kind: HTTPRoute
+    name: "{{ .Route }}"
+  rateLimit:
+    type: Local
+    local:
+      rules:
+{{- if .RequestsPerSecond }}
+      - limit:
+          requests: {{ .RequestsPerSecond }}
+          unit: Second
+{{- end }}
+{{- if .RequestsPerMinute }}
+      - limit:
+          requests: {{ .RequestsPerMinute }}
+          unit: Minute
+{{- end }}
+`
+
+func TestRateLimits(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		nginxLimitRPSAnnotation:         "10",
+		nginxLimitRPMAnnotation:         "many",
+		nginxLimitConnectionsAnnotation: "-1",
+	}}}
+
+	limits, ok := r.rateLimits(ingress)
+	if !ok || !isEqual(limits, rateLimitData{RequestsPerSecond: 10}) {
+		t.Errorf("expected 10 requests per second only, got %+v", limits)
+	}
+	expected := nginxLimitConnectionsAnnotation + `="-1", ` + nginxLimitRPMAnnotation + `="many"`
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidRateLimit") || !strings.Contains(event, expected) {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	if _, ok := r.rateLimits(&networkingv1.Ingress{}); ok {
+		t.Errorf("expected no rate limits without annotations")
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "default",
+		UID:         "1234",
+		Annotations: map[string]string{nginxLimitRPSAnnotation: "10", nginxLimitRPMAnnotation: "300"},
+	}}
+	httpRoutes := []gatewayv1.HTTPRoute{{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-example-com",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{createOwnerReference(ingress)},
+	}}}
+
+	// Without a template the rate limits are only reported
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	if policies, err := r.RateLimitPolicies(ingress, httpRoutes); err != nil || policies != nil {
+		t.Errorf("expected no policies without a template, got %v, %v", policies, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedRateLimit") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	r.RateLimitPolicyTemplate = template.Must(template.New("policy").Option("missingkey=error").Parse(testRateLimitPolicyTemplate))
+	policies, err := r.RateLimitPolicies(ingress, httpRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("expected 1 policy, got %d", len(policies))
+	}
+	policy := policies[0]
+	if policy.GetName() != "app-example-com-ratelimit" || policy.GetNamespace() != "default" ||
+		!isEqual(policy.GetOwnerReferences(), []metav1.OwnerReference{createRouteOwnerReference(httpRoutes[0])}) {
+		t.Errorf("expected the policy to be named after and owned by the HTTPRoute, got %+v", policy.Object["metadata"])
+	}
+	rules, _, _ := unstructured.NestedSlice(policy.Object, "spec", "rateLimit", "local", "rules")
+	if len(rules) != 2 {
+		t.Fatalf("expected a rule per limit, got %v", rules)
+	}
+	if requests, _, _ := unstructured.NestedInt64(rules[1].(map[string]any), "limit", "requests"); requests != 300 {
+		t.Errorf("expected 300 requests per minute, got %d", requests)
+	}
+}
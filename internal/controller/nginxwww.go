@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxFromToWWWRedirectAnnotation makes nginx redirect the requests for the www or non-www variant of the hosts
+	// of the Ingress to the hosts themselves
+	nginxFromToWWWRedirectAnnotation = nginxAnnotationPrefix + "from-to-www-redirect"
+
+	// wwwRedirectRouteSuffix is appended to the name of the HTTPRoute redirecting the variant of a hostname
+	wwwRedirectRouteSuffix = "-www-redirect"
+)
+
+// fromToWWWRedirect returns true if nginx redirects the www or non-www variant of the hosts of the Ingress
+func fromToWWWRedirect(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[nginxFromToWWWRedirectAnnotation] == "true"
+}
+
+// wwwVariant returns the hostname without its www. prefix, or with it if it has none. It returns an empty string for
+// the catch-all host, wildcard hosts and variants that are not valid hostnames.
+func wwwVariant(hostname string) string {
+	if hostname == "" || strings.HasPrefix(hostname, "*.") {
+		return ""
+	}
+	variant, found := strings.CutPrefix(hostname, "www.")
+	if !found {
+		variant = "www." + hostname
+	}
+	if errs := validation.IsDNS1123Subdomain(variant); len(errs) > 0 {
+		return ""
+	}
+	return variant
+}
+
+// wwwRedirectParentRefs returns the parent refs of the HTTPRoute redirecting the variant of a hostname, the listeners
+// matching the variant unless the HTTPRoutes of the Ingress are attached to a fixed parent ref. An Event is emitted
+// if there are none.
+func (r *IngressReconciler) wwwRedirectParentRefs(ingress *networkingv1.Ingress, variant string, parentRefs map[string][]gatewayv1.ParentReference, fixed *gatewayv1.ParentReference, gateways gatewayv1.GatewayList) []gatewayv1.ParentReference {
+	if fixed != nil {
+		return []gatewayv1.ParentReference{*fixed}
+	}
+	variantParentRefs := withoutShadowedListeners(findMatchingGateways(variant, parentRefs), gateways, variant)
+	if len(variantParentRefs) == 0 {
+		r.event(ingress, corev1.EventTypeWarning, "NoMatchingListener",
+			fmt.Sprintf("No Gateway listener with a hostname intersecting %q accepts HTTPRoutes from namespace %s, "+
+				"its requests are not redirected", variant, ingress.Namespace))
+		return nil
+	}
+	switch {
+	case r.ParentRefStrategy == ParentRefStrategyGateway:
+		return gatewayParentRefs(variantParentRefs, gateways)
+	case r.ParentRefStrategy == ParentRefStrategyPort:
+		return portParentRefs(variantParentRefs, gateways)
+	case r.CollapseParentRefs:
+		return collapseParentRefs(variantParentRefs, gateways)
+	}
+	return variantParentRefs
+}
+
+// createWWWRedirectSpec returns the spec of a HTTPRoute that redirects all requests for the variant to the hostname,
+// and to HTTPS if the hostname is redirected to HTTPS as well. nginx redirects with a 308 by default, HTTPRoutes
+// only with a 301 or 302.
+func createWWWRedirectSpec(parentRefs []gatewayv1.ParentReference, variant, hostname string, https bool) gatewayv1.HTTPRouteSpec {
+	redirect := &gatewayv1.HTTPRequestRedirectFilter{
+		Hostname:   ptr.To(gatewayv1.PreciseHostname(hostname)),
+		StatusCode: ptr.To(http.StatusMovedPermanently),
+	}
+	if https {
+		redirect.Scheme = ptr.To("https")
+	}
+	return gatewayv1.HTTPRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: parentRefs},
+		Hostnames:       []gatewayv1.Hostname{gatewayv1.Hostname(variant)},
+		Rules: []gatewayv1.HTTPRouteRule{{
+			// The match the API server would default to, so the spec does not change when it is created
+			Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+				Value: ptr.To("/"),
+			}}},
+			Filters: []gatewayv1.HTTPRouteFilter{{
+				Type:            gatewayv1.HTTPRouteFilterRequestRedirect,
+				RequestRedirect: redirect,
+			}},
+		}},
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestWWWVariant(t *testing.T) {
+	tests := map[string]string{
+		"example.com":       "www.example.com",
+		"www.example.com":   "example.com",
+		"www.":              "",
+		"*.example.com":     "",
+		"":                  "",
+		"wwwexample.com":    "www.wwwexample.com",
+		"www.www.example.c": "www.example.c",
+	}
+	for hostname, expected := range tests {
+		if variant := wwwVariant(hostname); variant != expected {
+			t.Errorf("expected variant %q of %q, got %q", expected, hostname, variant)
+		}
+	}
+}
+
+func TestWWWRedirectParentRefs(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"}}
+	http := gatewayv1.ParentReference{Name: "example-gw", SectionName: ptr.To(gatewayv1.SectionName("http"))}
+	other := gatewayv1.ParentReference{Name: "other-gw", SectionName: ptr.To(gatewayv1.SectionName("http"))}
+	parentRefs := map[string][]gatewayv1.ParentReference{
+		"*.example.com": {http},
+		"*.example.org": {other},
+	}
+
+	result := r.wwwRedirectParentRefs(ingress, "www.shop.example.com", parentRefs, nil, gatewayv1.GatewayList{})
+	if !isEqual(result, []gatewayv1.ParentReference{http}) {
+		t.Errorf("expected the listener matching the variant, got %+v", result)
+	}
+
+	fixed := gatewayv1.ParentReference{Name: "pinned-gw"}
+	result = r.wwwRedirectParentRefs(ingress, "www.shop.example.com", parentRefs, &fixed, gatewayv1.GatewayList{})
+	if !isEqual(result, []gatewayv1.ParentReference{fixed}) {
+		t.Errorf("expected the fixed parent ref, got %+v", result)
+	}
+
+	if result = r.wwwRedirectParentRefs(ingress, "www.shop.example.net", parentRefs, nil, gatewayv1.GatewayList{}); result != nil {
+		t.Errorf("expected no parent refs for an unmatched variant, got %+v", result)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NoMatchingListener") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestCreateWWWRedirectSpec(t *testing.T) {
+	spec := createWWWRedirectSpec(nil, "www.shop.example.com", "shop.example.com", true)
+	if !isEqual(spec.Hostnames, []gatewayv1.Hostname{"www.shop.example.com"}) {
+		t.Errorf("expected the variant as hostname, got %v", spec.Hostnames)
+	}
+	expected := &gatewayv1.HTTPRequestRedirectFilter{
+		Scheme:     ptr.To("https"),
+		Hostname:   ptr.To(gatewayv1.PreciseHostname("shop.example.com")),
+		StatusCode: ptr.To(301),
+	}
+	if redirect := spec.Rules[0].Filters[0].RequestRedirect; !isEqual(redirect, expected) {
+		t.Errorf("expected %+v, got %+v", expected, redirect)
+	}
+}
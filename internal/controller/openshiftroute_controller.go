@@ -0,0 +1,386 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// OpenShiftRouteGVK is the kind of the Routes of OpenShift, which are converted by the OpenShiftRouteReconciler
+var OpenShiftRouteGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+const (
+	// openShiftTerminationEdge, openShiftTerminationReencrypt and openShiftTerminationPassthrough are the TLS
+	// terminations of a Route: by the router, by the router and again by the backend, or by the backend alone
+	openShiftTerminationEdge        = "edge"
+	openShiftTerminationReencrypt   = "reencrypt"
+	openShiftTerminationPassthrough = "passthrough"
+	// openShiftInsecureAllow and openShiftInsecureRedirect serve the HTTP requests for a secured Route, or redirect
+	// them to HTTPS, instead of rejecting them
+	openShiftInsecureAllow    = "Allow"
+	openShiftInsecureRedirect = "Redirect"
+	// openShiftWildcardSubdomain lets a Route serve all hosts of the domain of its host
+	openShiftWildcardSubdomain = "Subdomain"
+	// openShiftDefaultWeight is the weight of a backend of a Route without one
+	openShiftDefaultWeight = 100
+)
+
+// openShiftRouteSpec is the part of the spec of a Route of OpenShift that is converted
+type openShiftRouteSpec struct {
+	Host              string                   `json:"host,omitempty"`
+	Path              string                   `json:"path,omitempty"`
+	To                openShiftRouteTarget     `json:"to"`
+	AlternateBackends []openShiftRouteTarget   `json:"alternateBackends,omitempty"`
+	Port              *openShiftRoutePort      `json:"port,omitempty"`
+	TLS               *openShiftRouteTLSConfig `json:"tls,omitempty"`
+	WildcardPolicy    string                   `json:"wildcardPolicy,omitempty"`
+}
+
+type openShiftRouteTarget struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+type openShiftRoutePort struct {
+	TargetPort intstr.IntOrString `json:"targetPort"`
+}
+
+type openShiftRouteTLSConfig struct {
+	Termination                   string `json:"termination"`
+	InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy,omitempty"`
+	Certificate                   string `json:"certificate,omitempty"`
+	DestinationCACertificate      string `json:"destinationCACertificate,omitempty"`
+	ExternalCertificate           *struct {
+		Name string `json:"name"`
+	} `json:"externalCertificate,omitempty"`
+}
+
+// OpenShiftRouteReconciler converts the Routes of OpenShift to HTTPRoutes, or to TLSRoutes for passthrough Routes.
+// Each Route is mapped to the Ingress the OpenShift router would treat alike, which is converted like any other
+// Ingress, so the Routes attach to the same Gateways. The generated routes are owned by the Route.
+type OpenShiftRouteReconciler struct {
+	// IngressReconciler converts the Ingresses the Routes are mapped to, with its settings. The features that write
+	// to an Ingress, such as annotating or retiring it, do not apply to Routes.
+	*IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes/finalizers,verbs=update
+
+// Reconcile converts a Route to the routes that should exist for it, and deletes the stale ones. The routes of a
+// deleted Route are garbage collected, those in the namespaces of their Gateways are deleted by its finalizer.
+func (r *OpenShiftRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(OpenShiftRouteGVK)
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !route.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalizeSource(audit.WithReason(ctx, audit.ReasonIngressFinalized), route)
+	}
+
+	converter := r.converter(route)
+	ingress, err := r.OpenShiftRouteIngress(ctx, route)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if converter.isPaused(ingress) {
+		logger.V(1).Info("skipping paused Route")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := converter.listGateways(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gateways = converter.candidateGateways(gateways)
+
+	if converter.placesRoutes() {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), route); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	httpRoutes, tlsRoutes, convertErr := r.ConvertOpenShiftRoute(ctx, route, ingress, gateways)
+	return converter.applyRoutes(ctx, ingress, gateways, httpRoutes, tlsRoutes, convertErr)
+}
+
+// ConvertOpenShiftRoute maps the Route, with the Ingress returned by OpenShiftRouteIngress, to the HTTPRoutes and
+// TLSRoutes that should exist for it, given the available Gateways. The traffic is split over the alternate backends
+// of the Route by weight. Passthrough Routes are only converted with TLSPassthroughRoutes.
+func (r *OpenShiftRouteReconciler) ConvertOpenShiftRoute(ctx context.Context, route *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, []gatewayv1alpha2.TLSRoute, error) {
+	spec, err := decodeOpenShiftRoute(route)
+	if err != nil {
+		return nil, nil, err
+	}
+	converter := r.converter(route)
+
+	if sslPassthrough(ingress) && !r.TLSPassthroughRoutes {
+		converter.event(route, corev1.EventTypeWarning, "UnsupportedPassthrough",
+			"Passthrough Routes are only converted to TLSRoutes with --tls-passthrough-routes")
+		return nil, nil, nil
+	}
+	httpRoutes, convertErr := converter.Convert(ctx, ingress, gateways)
+	tlsRoutes, err := converter.TLSRoutes(ctx, ingress, gateways)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(spec.AlternateBackends) == 0 {
+		return httpRoutes, tlsRoutes, convertErr
+	}
+
+	backendRefs, err := r.openShiftBackendRefs(ctx, route, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range httpRoutes {
+		for j := range httpRoutes[i].Spec.Rules {
+			// The rules redirecting to HTTPS have no backends
+			rule := &httpRoutes[i].Spec.Rules[j]
+			if len(rule.BackendRefs) == 0 {
+				continue
+			}
+			rule.BackendRefs = nil
+			for _, backendRef := range backendRefs {
+				rule.BackendRefs = append(rule.BackendRefs, gatewayv1.HTTPBackendRef{BackendRef: backendRef})
+			}
+		}
+	}
+	for i := range tlsRoutes {
+		for j := range tlsRoutes[i].Spec.Rules {
+			tlsRoutes[i].Spec.Rules[j].BackendRefs = backendRefs
+		}
+	}
+	return httpRoutes, tlsRoutes, convertErr
+}
+
+// OpenShiftRouteIngress returns the Ingress the Route is mapped to. It carries the kind, name and UID of the Route,
+// so the Route owns the generated routes, and its annotations, so the annotations of the controller apply. Its path
+// is a Prefix path, the TLS termination of the Route is expressed with spec.tls and the annotations of nginx:
+//   - edge and reencrypt Routes list their host under spec.tls, so they attach to HTTPS listeners, unless their
+//     insecureEdgeTerminationPolicy is Allow. With Redirect, their HTTP listeners redirect to HTTPS.
+//   - reencrypt Routes connect to their backends with HTTPS.
+//   - passthrough Routes pass the TLS connections through.
+func (r *OpenShiftRouteReconciler) OpenShiftRouteIngress(ctx context.Context, route *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	spec, err := decodeOpenShiftRoute(route)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	converter := r.converter(route)
+
+	host := openShiftRouteHost(spec)
+	path := spec.Path
+	if path == "" {
+		path = "/"
+	}
+	var targetPort *intstr.IntOrString
+	if spec.Port != nil {
+		targetPort = &spec.Port.TargetPort
+	}
+	port, err := r.openShiftServicePort(ctx, route.GetNamespace(), spec.To.Name, targetPort)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: OpenShiftRouteGVK.GroupVersion().String(),
+			Kind:       OpenShiftRouteGVK.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        route.GetName(),
+			Namespace:   route.GetNamespace(),
+			UID:         route.GetUID(),
+			Annotations: make(map[string]string),
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: ptr.To(networkingv1.PathTypePrefix),
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: spec.To.Name,
+							Port: port,
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+	for key, value := range route.GetAnnotations() {
+		ingress.Annotations[key] = value
+	}
+
+	if tls := spec.TLS; tls != nil {
+		switch tls.Termination {
+		case openShiftTerminationPassthrough:
+			ingress.Annotations[nginxSSLPassthroughAnnotation] = "true"
+		case openShiftTerminationReencrypt:
+			ingress.Annotations[nginxBackendProtocolAnnotation] = "HTTPS"
+			if tls.DestinationCACertificate != "" {
+				converter.event(route, corev1.EventTypeWarning, "UnconvertedDestinationCACertificate",
+					"The destination CA certificate of the Route is not converted, the certificates of the backends "+
+						"are validated against the CA certificates of --backend-tls-ca-certificates or the system CAs")
+			}
+		}
+		if tls.Termination != openShiftTerminationPassthrough && tls.InsecureEdgeTerminationPolicy != openShiftInsecureAllow {
+			ingressTLS := networkingv1.IngressTLS{Hosts: []string{host}}
+			if tls.ExternalCertificate != nil {
+				ingressTLS.SecretName = tls.ExternalCertificate.Name
+			}
+			ingress.Spec.TLS = []networkingv1.IngressTLS{ingressTLS}
+			if tls.InsecureEdgeTerminationPolicy == openShiftInsecureRedirect {
+				ingress.Annotations[nginxSSLRedirectAnnotation] = "true"
+			}
+		}
+		if tls.Certificate != "" {
+			converter.event(route, corev1.EventTypeWarning, "UnconvertedCertificate",
+				fmt.Sprintf("The certificate of the Route is not converted, the HTTPS listeners of the Gateways "+
+					"must serve a certificate for %q", host))
+		}
+	}
+	return ingress, nil
+}
+
+// openShiftRouteHost returns the host of the Route, which is a wildcard for the domain of its host if the Route
+// serves the whole subdomain
+func openShiftRouteHost(spec openShiftRouteSpec) string {
+	if spec.WildcardPolicy == openShiftWildcardSubdomain {
+		if _, domain, ok := strings.Cut(spec.Host, "."); ok {
+			return "*." + domain
+		}
+	}
+	return spec.Host
+}
+
+// openShiftRouteHosts returns the host of the Route to index it by, none if it cannot be decoded
+func openShiftRouteHosts(route *unstructured.Unstructured) []string {
+	spec, err := decodeOpenShiftRoute(route)
+	if err != nil {
+		return nil
+	}
+	return []string{openShiftRouteHost(spec)}
+}
+
+// converter returns the reconciler converting the Ingress of the Route. The hosts of secured Routes only attach to
+// HTTPS listeners, and only redirect to them if the Route says so, as the OpenShift router does.
+func (r *OpenShiftRouteReconciler) converter(route *unstructured.Unstructured) *IngressReconciler {
+	converter := r.sourceConverter(route)
+	converter.TLSListeners = true
+	converter.TLSRedirect = false
+	return converter
+}
+
+// decodeOpenShiftRoute returns the spec of the Route
+func decodeOpenShiftRoute(route *unstructured.Unstructured) (openShiftRouteSpec, error) {
+	var spec openShiftRouteSpec
+	content, _, err := unstructured.NestedMap(route.UnstructuredContent(), "spec")
+	if err != nil {
+		return spec, err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec)
+	return spec, err
+}
+
+// openShiftBackendRefs returns the weighted backend refs of the Service the Route points to and of its alternate
+// backends. Backends of other kinds than Service are left out with an Event.
+func (r *OpenShiftRouteReconciler) openShiftBackendRefs(ctx context.Context, route *unstructured.Unstructured, spec openShiftRouteSpec) ([]gatewayv1.BackendRef, error) {
+	var targetPort *intstr.IntOrString
+	if spec.Port != nil {
+		targetPort = &spec.Port.TargetPort
+	}
+
+	var result []gatewayv1.BackendRef
+	for _, target := range append([]openShiftRouteTarget{spec.To}, spec.AlternateBackends...) {
+		if target.Kind != "" && target.Kind != "Service" {
+			r.converter(route).event(route, corev1.EventTypeWarning, "UnsupportedBackend",
+				fmt.Sprintf("Backend %s %s is not converted, only Services are", target.Kind, target.Name))
+			continue
+		}
+		port, err := r.openShiftServicePort(ctx, route.GetNamespace(), target.Name, targetPort)
+		if err != nil {
+			return nil, err
+		}
+		backendRef, err := r.mapBackendRef(ctx, route.GetNamespace(), networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{Name: target.Name, Port: port},
+		}, ptr.To(ptr.Deref(target.Weight, openShiftDefaultWeight)))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, backendRef.BackendRef)
+	}
+	return result, nil
+}
+
+// openShiftServicePort returns the port of the Service the target port of a Route selects, by name or target port,
+// or the first port of the Service without a target port. Without Service lookups, or if the Service does not exist,
+// the target port is assumed to be the port of the Service.
+func (r *OpenShiftRouteReconciler) openShiftServicePort(ctx context.Context, namespace, name string, targetPort *intstr.IntOrString) (networkingv1.ServiceBackendPort, error) {
+	if !r.DisableServiceLookups {
+		service := corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &service); err != nil && !errors.IsNotFound(err) {
+			return networkingv1.ServiceBackendPort{}, err
+		}
+		for _, port := range service.Spec.Ports {
+			if targetPort == nil || targetPort.Type == intstr.String && port.Name == targetPort.StrVal || port.TargetPort == *targetPort {
+				return networkingv1.ServiceBackendPort{Number: port.Port}, nil
+			}
+		}
+	}
+	switch {
+	case targetPort == nil:
+		return networkingv1.ServiceBackendPort{}, nil
+	case targetPort.Type == intstr.Int:
+		return networkingv1.ServiceBackendPort{Number: targetPort.IntVal}, nil
+	default:
+		return networkingv1.ServiceBackendPort{Name: targetPort.StrVal}, nil
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *OpenShiftRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b, err := r.sourceControllerBuilder(mgr, "openshiftroute", OpenShiftRouteGVK, openShiftRouteHosts)
+	if err != nil {
+		return err
+	}
+	return b.Complete(r)
+}
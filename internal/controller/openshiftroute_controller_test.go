@@ -0,0 +1,253 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func testOpenShiftRouteReconciler(recorder record.EventRecorder) *OpenShiftRouteReconciler {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt32(9090)},
+			{Name: "web", Port: 80, TargetPort: intstr.FromString("http")},
+		}},
+	}
+	return &OpenShiftRouteReconciler{IngressReconciler: &IngressReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(service).Build(),
+		Recorder: recorder,
+	}}
+}
+
+func testOpenShiftGateways() gatewayv1.GatewayList {
+	return gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1.GroupVersion.String(), Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+			{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443},
+		}},
+	}}}
+}
+
+func TestOpenShiftRouteIngress(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := testOpenShiftRouteReconciler(recorder)
+	route := sourceObject(OpenShiftRouteGVK, "default", "app", map[string]any{
+		"host":           "www.apps.example.com",
+		"path":           "/shop",
+		"wildcardPolicy": "Subdomain",
+		"to":             map[string]any{"kind": "Service", "name": "app"},
+		"port":           map[string]any{"targetPort": "http"},
+		"tls": map[string]any{
+			"termination":                   "reencrypt",
+			"insecureEdgeTerminationPolicy": "Redirect",
+			"destinationCACertificate":      "-----BEGIN CERTIFICATE-----",
+		},
+	})
+	route.SetAnnotations(map[string]string{"haproxy.router.openshift.io/timeout": "30s"})
+
+	ingress, err := r.OpenShiftRouteIngress(ctx, route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := createOwnerReference(ingress); owner.Kind != "Route" || owner.APIVersion != "route.openshift.io/v1" ||
+		owner.UID != route.GetUID() {
+		t.Errorf("expected the Route to own the routes, got %+v", owner)
+	}
+	rule := ingress.Spec.Rules[0]
+	path := rule.HTTP.Paths[0]
+	if rule.Host != "*.apps.example.com" || path.Path != "/shop" || path.Backend.Service.Port.Number != 80 {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].Hosts[0] != "*.apps.example.com" {
+		t.Errorf("expected the host under spec.tls, got %+v", ingress.Spec.TLS)
+	}
+	expected := map[string]string{
+		"haproxy.router.openshift.io/timeout": "30s",
+		nginxBackendProtocolAnnotation:        "HTTPS",
+		nginxSSLRedirectAnnotation:            "true",
+	}
+	if !isEqual(ingress.Annotations, expected) {
+		t.Errorf("unexpected annotations: %v", ingress.Annotations)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnconvertedDestinationCACertificate") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestConvertOpenShiftRoute(t *testing.T) {
+	ctx := context.Background()
+	r := testOpenShiftRouteReconciler(nil)
+	route := sourceObject(OpenShiftRouteGVK, "default", "app", map[string]any{
+		"host": "app.example.com",
+		"to":   map[string]any{"kind": "Service", "name": "app", "weight": int64(90)},
+		"alternateBackends": []any{
+			map[string]any{"kind": "Service", "name": "app-canary", "weight": int64(10)},
+		},
+		"port": map[string]any{"targetPort": int64(8080)},
+		"tls":  map[string]any{"termination": "edge"},
+	})
+	ingress, err := r.OpenShiftRouteIngress(ctx, route)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpRoutes, tlsRoutes, err := r.ConvertOpenShiftRoute(ctx, route, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 || len(tlsRoutes) != 0 {
+		t.Fatalf("expected a single HTTPRoute, got %d HTTPRoutes and %d TLSRoutes", len(httpRoutes), len(tlsRoutes))
+	}
+	httpRoute := httpRoutes[0]
+	if len(httpRoute.OwnerReferences) != 1 || httpRoute.OwnerReferences[0].Kind != "Route" {
+		t.Errorf("unexpected owner references: %+v", httpRoute.OwnerReferences)
+	}
+	// The HTTP listener is left out, as the insecure requests of the Route are rejected
+	expectedParentRefs := []gatewayv1.ParentReference{createParentRef(testOpenShiftGateways().Items[0],
+		testOpenShiftGateways().Items[0].Spec.Listeners[1])}
+	if !isEqual(httpRoute.Spec.ParentRefs, expectedParentRefs) {
+		t.Errorf("unexpected parent refs: %+v", httpRoute.Spec.ParentRefs)
+	}
+	var weights []string
+	for _, backendRef := range httpRoute.Spec.Rules[0].BackendRefs {
+		weights = append(weights, fmt.Sprintf("%s:%d:%d", backendRef.Name, ptr.Deref(backendRef.Port, 0),
+			ptr.Deref(backendRef.Weight, -1)))
+	}
+	if expected := []string{"app:8080:90", "app-canary:8080:10"}; !isEqual(weights, expected) {
+		t.Errorf("unexpected backends: %v", weights)
+	}
+}
+
+func TestConvertOpenShiftRoutePassthrough(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := testOpenShiftRouteReconciler(recorder)
+	route := sourceObject(OpenShiftRouteGVK, "default", "app", map[string]any{
+		"host": "secure.example.com",
+		"to":   map[string]any{"kind": "Service", "name": "app"},
+		"tls":  map[string]any{"termination": "passthrough"},
+	})
+	ingress, err := r.OpenShiftRouteIngress(ctx, route)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpRoutes, tlsRoutes, err := r.ConvertOpenShiftRoute(ctx, route, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 0 || len(tlsRoutes) != 0 {
+		t.Errorf("expected no routes without TLSPassthroughRoutes, got %d HTTPRoutes and %d TLSRoutes",
+			len(httpRoutes), len(tlsRoutes))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedPassthrough") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestReconcileOpenShiftRouteGatewayNamespaceRoutes(t *testing.T) {
+	ctx := context.Background()
+	route := sourceObject(OpenShiftRouteGVK, "default", "app", map[string]any{
+		"host": "app.example.com",
+		"to":   map[string]any{"kind": "Service", "name": "app"},
+	})
+	gateway := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "infra"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(route, gateway).Build()
+	r := &OpenShiftRouteReconciler{IngressReconciler: &IngressReconciler{
+		Client: c, Scheme: golden.Scheme, GatewayNamespaceRoutes: true, DisableServiceLookups: true,
+	}}
+	request := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, request.NamespacedName, route); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(route.GetFinalizers(), routesFinalizer) {
+		t.Errorf("expected the routes finalizer on the Route, got %v", route.GetFinalizers())
+	}
+	var httpRoutes gatewayv1.HTTPRouteList
+	if err := c.List(ctx, &httpRoutes, client.InNamespace("infra")); err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes.Items) != 1 {
+		t.Fatalf("expected an HTTPRoute in the Gateway namespace, got %d", len(httpRoutes.Items))
+	}
+	placed := httpRoutes.Items[0]
+	if owner := placed.Annotations[ownerAnnotation]; owner != "Route.route.openshift.io/default/app" {
+		t.Errorf("unexpected owner annotation %q", owner)
+	}
+	if kind := placed.Labels[sourceKindLabel]; kind != "Route.route.openshift.io" {
+		t.Errorf("unexpected kind label %q", kind)
+	}
+
+	if err := c.Delete(ctx, route); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.List(ctx, &httpRoutes, client.InNamespace("infra")); err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes.Items) != 0 {
+		t.Errorf("expected the HTTPRoute of the deleted Route to be deleted, got %d", len(httpRoutes.Items))
+	}
+	if err := c.Get(ctx, request.NamespacedName, route); !errors.IsNotFound(err) {
+		t.Errorf("expected the Route to be deleted once finalized, got %v", err)
+	}
+}
+
+func TestOpenShiftRouteHostIndex(t *testing.T) {
+	r := &IngressReconciler{}
+	route := sourceObject(OpenShiftRouteGVK, "default", "app", map[string]any{
+		"host":           "www.apps.example.com",
+		"wildcardPolicy": "Subdomain",
+		"to":             map[string]any{"kind": "Service", "name": "app"},
+	})
+	keys := r.indexSourceHosts(openShiftRouteHosts)(route)
+	if !slices.Contains(keys, wildcardHostKeyPrefix+"*.apps.example.com") || slices.Contains(keys, "www.apps.example.com") {
+		t.Errorf("expected the Route to be indexed by its wildcard host, got %v", keys)
+	}
+}
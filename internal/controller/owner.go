@@ -0,0 +1,166 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	// ingressGroupKind is the kind of the Ingresses, which own the routes generated for them
+	ingressGroupKind = schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}
+	// configMapGroupKind is the kind of the ConfigMaps of stream services, which own the TCPRoutes and UDPRoutes
+	configMapGroupKind = schema.GroupKind{Kind: "ConfigMap"}
+)
+
+// ownerGroupKind returns the kind of the owner reference
+func ownerGroupKind(owner metav1.OwnerReference) schema.GroupKind {
+	return schema.FromAPIVersionAndKind(owner.APIVersion, owner.Kind).GroupKind()
+}
+
+// ownerAnnotationValue returns the value of the owner annotation recording the owner of the kind as
+// <kind>.<group>/<namespace>/<name>, so an Ingress and a Route of OpenShift with the same name are told apart
+func ownerAnnotationValue(kind schema.GroupKind, namespace, name string) string {
+	return kind.String() + "/" + namespace + "/" + name
+}
+
+// AnnotateOwner replaces the owner references of a generated object by the owner annotation, as they cannot point to
+// another cluster. The convert command does so for the objects it writes to a target cluster, like the controller.
+func AnnotateOwner(obj client.Object) {
+	owners := obj.GetOwnerReferences()
+	if len(owners) == 0 {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[ownerAnnotation]; !ok {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ownerAnnotation] = ownerAnnotationValue(ownerGroupKind(owners[0]), obj.GetNamespace(), owners[0].Name)
+		obj.SetAnnotations(annotations)
+	}
+	obj.SetOwnerReferences(nil)
+}
+
+// ownersAnnotationValue returns the value of the owner annotation recording all owners in the namespace, separated
+// by commas, as the HTTPRoutes merged from several Ingresses are only deleted with the last of them
+func ownersAnnotationValue(namespace string, owners []metav1.OwnerReference) string {
+	values := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		values = append(values, ownerAnnotationValue(ownerGroupKind(owner), namespace, owner.Name))
+	}
+	return strings.Join(values, ",")
+}
+
+// annotatedOwner is an owner recorded in the owner annotation
+type annotatedOwner struct {
+	kind schema.GroupKind
+	key  types.NamespacedName
+}
+
+// parseOwnerAnnotations returns the owners recorded in the owner annotation. The kind is empty for the
+// namespace/name recorded before the kind was.
+func parseOwnerAnnotations(annotations map[string]string) []annotatedOwner {
+	value, ok := annotations[ownerAnnotation]
+	if !ok {
+		return nil
+	}
+	var result []annotatedOwner
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(entry, "/")
+		switch len(parts) {
+		case 2:
+			result = append(result, annotatedOwner{key: types.NamespacedName{Namespace: parts[0], Name: parts[1]}})
+		case 3:
+			result = append(result, annotatedOwner{
+				kind: schema.ParseGroupKind(parts[0]),
+				key:  types.NamespacedName{Namespace: parts[1], Name: parts[2]},
+			})
+		}
+	}
+	return result
+}
+
+// parseOwnerAnnotation returns the kind and the namespace and name of the first owner recorded in the owner
+// annotation, and false if there is none
+func parseOwnerAnnotation(annotations map[string]string) (schema.GroupKind, types.NamespacedName, bool) {
+	owners := parseOwnerAnnotations(annotations)
+	if len(owners) == 0 {
+		return schema.GroupKind{}, types.NamespacedName{}, false
+	}
+	return owners[0].kind, owners[0].key, true
+}
+
+// is returns true if the annotated owner is the owner of the kind. An owner without a kind is an owner of any kind
+// with the namespace and name, as it was recorded before the kind was.
+func (o annotatedOwner) is(kind schema.GroupKind, namespace, name string) bool {
+	return o.key == types.NamespacedName{Namespace: namespace, Name: name} && (o.kind.Empty() || o.kind == kind)
+}
+
+// isAnnotatedOwner returns true if the owner annotation records the owner of the kind
+func isAnnotatedOwner(annotations map[string]string, kind schema.GroupKind, namespace, name string) bool {
+	return slices.ContainsFunc(parseOwnerAnnotations(annotations), func(owner annotatedOwner) bool {
+		return owner.is(kind, namespace, name)
+	})
+}
+
+// releaseAnnotatedOwner removes the owner of the kind from the owner annotation of the object, and returns true if
+// other owners are still recorded, so the object is kept for them
+func releaseAnnotatedOwner(obj client.Object, kind schema.GroupKind, namespace, name string) bool {
+	annotations := obj.GetAnnotations()
+	value, ok := annotations[ownerAnnotation]
+	if !ok {
+		return false
+	}
+	var remaining []string
+	for _, entry := range strings.Split(value, ",") {
+		owners := parseOwnerAnnotations(map[string]string{ownerAnnotation: entry})
+		if len(owners) == 1 && owners[0].is(kind, namespace, name) {
+			continue
+		}
+		remaining = append(remaining, entry)
+	}
+	if len(remaining) == 0 {
+		return false
+	}
+	annotations[ownerAnnotation] = strings.Join(remaining, ",")
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// enqueueAnnotatedOwner returns the map function triggering reconciliation for the owners of the kind recorded in the
+// owner annotation, so a controller only enqueues the owners it reconciles
+func enqueueAnnotatedOwner(kind schema.GroupKind) handler.MapFunc {
+	return func(_ context.Context, obj client.Object) []reconcile.Request {
+		var result []reconcile.Request
+		for _, owner := range parseOwnerAnnotations(obj.GetAnnotations()) {
+			if owner.kind.Empty() || owner.kind == kind {
+				result = append(result, reconcile.Request{NamespacedName: owner.key})
+			}
+		}
+		return result
+	}
+}
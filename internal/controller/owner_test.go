@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestIsAnnotatedOwner(t *testing.T) {
+	routeKind := OpenShiftRouteGVK.GroupKind()
+	for _, tc := range []struct {
+		annotation string
+		ingress    bool
+		route      bool
+	}{
+		{annotation: "Ingress.networking.k8s.io/default/app", ingress: true},
+		{annotation: "Route.route.openshift.io/default/app", route: true},
+		// Recorded before the kind was
+		{annotation: "default/app", ingress: true, route: true},
+		{annotation: "Ingress.networking.k8s.io/default/other"},
+		// Merged from several Ingresses
+		{annotation: "Ingress.networking.k8s.io/default/other,Ingress.networking.k8s.io/default/app", ingress: true},
+		{annotation: "app"},
+		{annotation: ""},
+	} {
+		annotations := map[string]string{ownerAnnotation: tc.annotation}
+		if owned := isAnnotatedOwner(annotations, ingressGroupKind, "default", "app"); owned != tc.ingress {
+			t.Errorf("expected %q to record the Ingress: %t", tc.annotation, tc.ingress)
+		}
+		if owned := isAnnotatedOwner(annotations, routeKind, "default", "app"); owned != tc.route {
+			t.Errorf("expected %q to record the Route: %t", tc.annotation, tc.route)
+		}
+	}
+
+	owner := metav1.OwnerReference{APIVersion: OpenShiftRouteGVK.GroupVersion().String(), Kind: OpenShiftRouteGVK.Kind, Name: "app"}
+	if value := ownerAnnotationValue(ownerGroupKind(owner), "default", "app"); value != "Route.route.openshift.io/default/app" {
+		t.Errorf("unexpected owner annotation %q", value)
+	}
+}
+
+func TestAnnotateOwner(t *testing.T) {
+	httpRoute := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-app-example-com",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{createOwnerReference(networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app"}})},
+	}}
+	AnnotateOwner(httpRoute)
+	if len(httpRoute.OwnerReferences) != 0 {
+		t.Errorf("expected no owner references, got %v", httpRoute.OwnerReferences)
+	}
+	if !isAnnotatedOwner(httpRoute.Annotations, ingressGroupKind, "default", "app") {
+		t.Errorf("expected the owner annotation to record the Ingress, got %v", httpRoute.Annotations)
+	}
+
+	// The owner of a route placed in another namespace is recorded already
+	placed := ownerAnnotationValue(ingressGroupKind, "default", "app")
+	httpRoute = &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "infra",
+		Annotations: map[string]string{ownerAnnotation: placed},
+	}}
+	AnnotateOwner(httpRoute)
+	if httpRoute.Annotations[ownerAnnotation] != placed {
+		t.Errorf("expected the owner annotation to be kept, got %v", httpRoute.Annotations)
+	}
+}
+
+func TestEnqueueAnnotatedOwner(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "app"}
+	for _, tc := range []struct {
+		annotation string
+		expected   bool
+	}{
+		{annotation: "Ingress.networking.k8s.io/default/app", expected: true},
+		{annotation: "default/app", expected: true},
+		{annotation: "Route.route.openshift.io/default/app"},
+		{annotation: ""},
+	} {
+		httpRoute := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{ownerAnnotation: tc.annotation},
+		}}
+		requests := enqueueAnnotatedOwner(ingressGroupKind)(ctx, httpRoute)
+		if enqueued := len(requests) == 1 && requests[0].NamespacedName == key; enqueued != tc.expected {
+			t.Errorf("expected %q to enqueue the Ingress: %t, got %v", tc.annotation, tc.expected, requests)
+		}
+	}
+}
+
+func TestReleaseAnnotatedOwner(t *testing.T) {
+	httpRoute := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "infra",
+		Annotations: map[string]string{
+			ownerAnnotation: ownersAnnotationValue("default", []metav1.OwnerReference{
+				createOwnerReference(networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app"}}),
+				createOwnerReference(networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "other"}}),
+			}),
+		},
+	}}
+	if !releaseAnnotatedOwner(httpRoute, ingressGroupKind, "default", "app") {
+		t.Fatal("expected the other Ingress to keep the HTTPRoute")
+	}
+	if value := httpRoute.Annotations[ownerAnnotation]; value != "Ingress.networking.k8s.io/default/other" {
+		t.Errorf("expected only the other Ingress to be recorded, got %q", value)
+	}
+	if releaseAnnotatedOwner(httpRoute, ingressGroupKind, "default", "other") {
+		t.Error("expected no Ingress to keep the HTTPRoute")
+	}
+
+	requests := enqueueAnnotatedOwner(ingressGroupKind)(context.Background(), &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{ownerAnnotation: "Ingress.networking.k8s.io/default/app,default/other"},
+	}})
+	if len(requests) != 2 || requests[1].Name != "other" {
+		t.Errorf("expected both Ingresses to be enqueued, got %v", requests)
+	}
+}
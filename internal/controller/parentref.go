@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// ParentRefStrategy selects how HTTPRoutes reference the Gateways they attach to
+type ParentRefStrategy string
+
+const (
+	// ParentRefStrategyListener references every matching listener by its sectionName
+	ParentRefStrategyListener ParentRefStrategy = "listener"
+	// ParentRefStrategyGateway references every matching Gateway once, leaving the listener selection to the Gateway
+	ParentRefStrategyGateway ParentRefStrategy = "gateway"
+	// ParentRefStrategyPort references the ports of the matching listeners, which survive listener renames
+	ParentRefStrategyPort ParentRefStrategy = "port"
+)
+
+// ParseParentRefStrategy validates a parentRef strategy given on the command line
+func ParseParentRefStrategy(value string) (ParentRefStrategy, error) {
+	strategy := ParentRefStrategy(value)
+	switch strategy {
+	case ParentRefStrategyListener, ParentRefStrategyGateway, ParentRefStrategyPort:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown parentRef strategy %q, must be one of %s, %s or %s", value,
+		ParentRefStrategyListener, ParentRefStrategyGateway, ParentRefStrategyPort)
+}
+
+// gatewayParentRefs references each Gateway of the parent refs once, without sectionName or port,
+// in the order of the Gateways
+func gatewayParentRefs(parentRefs []gatewayv1.ParentReference, gateways gatewayv1.GatewayList) []gatewayv1.ParentReference {
+	var result []gatewayv1.ParentReference
+	for _, gateway := range gateways.Items {
+		for _, parentRef := range parentRefs {
+			if isParentRefForGateway(parentRef, gateway) {
+				parentRef.SectionName = nil
+				parentRef.Port = nil
+				result = append(result, parentRef)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// portParentRefs references the listeners of the parent refs by port instead of by name, in the order of the
+// Gateways. A Gateway can only be referenced more than once with distinct sectionNames, so the listeners of a
+// Gateway that span several ports stay referenced by name.
+func portParentRefs(parentRefs []gatewayv1.ParentReference, gateways gatewayv1.GatewayList) []gatewayv1.ParentReference {
+	var result []gatewayv1.ParentReference
+	for _, gateway := range gateways.Items {
+		var gatewayParentRefs []gatewayv1.ParentReference
+		var ports []gatewayv1.PortNumber
+		for _, parentRef := range parentRefs {
+			if !isParentRefForGateway(parentRef, gateway) {
+				continue
+			}
+			gatewayParentRefs = append(gatewayParentRefs, parentRef)
+			for _, listener := range gateway.Spec.Listeners {
+				if parentRef.SectionName != nil && *parentRef.SectionName == listener.Name && !slices.Contains(ports, listener.Port) {
+					ports = append(ports, listener.Port)
+				}
+			}
+		}
+		if len(ports) != 1 {
+			result = append(result, gatewayParentRefs...)
+			continue
+		}
+		parentRef := gatewayParentRefs[0]
+		parentRef.SectionName = nil
+		parentRef.Port = ptr.To(ports[0])
+		result = append(result, parentRef)
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// PathTypePolicy selects the HTTPRoute path match type ImplementationSpecific Ingress paths are converted to
+type PathTypePolicy string
+
+const (
+	// PathTypeRegex converts to a RegularExpression match, as the nginx Ingress controller interprets them
+	PathTypeRegex PathTypePolicy = "regex"
+	// PathTypePrefix converts to a PathPrefix match, as e.g. the GKE and AWS load balancer controllers interpret them
+	PathTypePrefix PathTypePolicy = "prefix"
+	// PathTypeExact converts to an Exact match
+	PathTypeExact PathTypePolicy = "exact"
+)
+
+// ParsePathTypePolicy validates a path type policy given on the command line
+func ParsePathTypePolicy(value string) (PathTypePolicy, error) {
+	policy := PathTypePolicy(value)
+	switch policy {
+	case PathTypeRegex, PathTypePrefix, PathTypeExact:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown path type policy %q, must be one of %s, %s or %s", value, PathTypePrefix, PathTypeExact, PathTypeRegex)
+}
+
+// ParsePathTypePolicyOverrides parses a comma-separated list of class=policy pairs, e.g. gce=prefix,alb=prefix
+func ParsePathTypePolicyOverrides(value string) (map[string]PathTypePolicy, error) {
+	overrides := make(map[string]PathTypePolicy)
+	for _, item := range strings.Split(value, ",") {
+		class, policyValue, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || class == "" {
+			return nil, fmt.Errorf("invalid override %q, must be class=policy", item)
+		}
+		policy, err := ParsePathTypePolicy(policyValue)
+		if err != nil {
+			return nil, err
+		}
+		overrides[class] = policy
+	}
+	return overrides, nil
+}
+
+// implementationSpecificPathType returns the policy for the ImplementationSpecific paths of the Ingress: the Traefik
+// path matcher of the Ingress, the override for its IngressClass, the policy of its conversion profile or the
+// default policy
+func (r *IngressReconciler) implementationSpecificPathType(ingress networkingv1.Ingress, profile *ConversionProfile) PathTypePolicy {
+	if profile.translates(traefikAnnotationPrefix) {
+		if policy, ok := r.traefikPathType(&ingress); ok {
+			return policy
+		}
+	}
+	class := ingressClass(ingress)
+	if policy, ok := r.ImplementationSpecificPathTypeOverrides[class]; ok && class != "" {
+		return policy
+	}
+	if profile != nil {
+		return profile.ImplementationSpecificPathType
+	}
+	if r.ImplementationSpecificPathType == "" {
+		return PathTypeRegex
+	}
+	return r.ImplementationSpecificPathType
+}
+
+// pathMatchType returns the HTTPRoute path match type of the policy
+func (p PathTypePolicy) pathMatchType() gatewayv1.PathMatchType {
+	switch p {
+	case PathTypePrefix:
+		return gatewayv1.PathMatchPathPrefix
+	case PathTypeExact:
+		return gatewayv1.PathMatchExact
+	default:
+		return gatewayv1.PathMatchRegularExpression
+	}
+}
+
+// trailingSlashMatch returns the Exact match a PathPrefix match with a trailing slash needs to match like an Ingress
+// Prefix path. The Ingress ignores the trailing slash, so `/foo/` also matches `/foo`, while Gateways that compare
+// path elements including the trailing one only match `/foo/` and below.
+func trailingSlashMatch(pathMatch gatewayv1.HTTPPathMatch) (gatewayv1.HTTPPathMatch, bool) {
+	if pathMatch.Type == nil || *pathMatch.Type != gatewayv1.PathMatchPathPrefix || pathMatch.Value == nil {
+		return gatewayv1.HTTPPathMatch{}, false
+	}
+	value := strings.TrimRight(*pathMatch.Value, "/")
+	if value == "" || value == *pathMatch.Value {
+		return gatewayv1.HTTPPathMatch{}, false
+	}
+	exact := gatewayv1.PathMatchExact
+	return gatewayv1.HTTPPathMatch{Type: &exact, Value: &value}, true
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestTrailingSlashMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchType *gatewayv1.PathMatchType
+		value     string
+		expected  string
+	}{
+		{name: "trailing slash", matchType: ptr.To(gatewayv1.PathMatchPathPrefix), value: "/foo/", expected: "/foo"},
+		{name: "nested trailing slash", matchType: ptr.To(gatewayv1.PathMatchPathPrefix), value: "/foo/bar/", expected: "/foo/bar"},
+		{name: "repeated trailing slashes", matchType: ptr.To(gatewayv1.PathMatchPathPrefix), value: "/foo//", expected: "/foo"},
+		{name: "no trailing slash", matchType: ptr.To(gatewayv1.PathMatchPathPrefix), value: "/foo"},
+		{name: "root", matchType: ptr.To(gatewayv1.PathMatchPathPrefix), value: "/"},
+		{name: "exact", matchType: ptr.To(gatewayv1.PathMatchExact), value: "/foo/"},
+		{name: "regular expression", matchType: ptr.To(gatewayv1.PathMatchRegularExpression), value: "/foo/"},
+		{name: "no type", value: "/foo/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := trailingSlashMatch(gatewayv1.HTTPPathMatch{Type: tt.matchType, Value: ptr.To(tt.value)})
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("expected no Exact match, got %s", *match.Value)
+				}
+				return
+			}
+			if !ok || *match.Type != gatewayv1.PathMatchExact || *match.Value != tt.expected {
+				t.Errorf("expected an Exact match for %s, got %+v", tt.expected, match)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// gatewayNamespaceParentRefs maps the listeners of the Gateways to parent refs grouped by hostname, like
+// groupGatewaysByHostNameAndMapToParentRefs, but for HTTPRoutes in the namespace of each Gateway. The allowed
+// routes of a listener are evaluated against the namespace of its own Gateway, where the HTTPRoutes are placed.
+func (r *IngressReconciler) gatewayNamespaceParentRefs(ctx context.Context, gateways gatewayv1.GatewayList) (map[string][]gatewayv1.ParentReference, error) {
+	result := make(map[string][]gatewayv1.ParentReference)
+	for _, gateway := range gateways.Items {
+		namespace, err := r.routeNamespace(ctx, gateway.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		single := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{gateway}}
+		for hostname, parentRefs := range groupGatewaysByHostNameAndMapToParentRefs(namespace, single, r.ListenerPorts, r.ListenerProtocols) {
+			result[hostname] = append(result[hostname], parentRefs...)
+		}
+	}
+	return result, nil
+}
+
+// createGatewayNamespaceHTTPRoutes creates the HTTPRoutes for the spec in the namespaces of its Gateways. Owner
+// references cannot point to another namespace, so the HTTPRoutes outside the namespace of the Ingress record
+// their owner in the owner annotation and the source labels instead, and their names are prefixed with the
+// namespace of the Ingress.
+func (r *IngressReconciler) createGatewayNamespaceHTTPRoutes(name, namespace string, owners []metav1.OwnerReference, labels map[string]string, spec gatewayv1.HTTPRouteSpec) []gatewayv1.HTTPRoute {
+	var result []gatewayv1.HTTPRoute
+	for _, parentRefs := range groupParentRefsByNamespace(spec.ParentRefs) {
+		namespaceSpec := *spec.DeepCopy()
+		namespaceSpec.ParentRefs = parentRefs
+		routeNamespace := string(*parentRefs[0].Namespace)
+		if routeNamespace == namespace {
+			result = append(result, r.createNamespaceHTTPRoutes(name, namespace, owners, labels, namespaceSpec)...)
+			continue
+		}
+
+		// The labels of merged HTTPRoutes can only name one of the Ingresses, the owner annotation records all of them
+		placedLabels := sourceLabels(namespace, owners[0])
+		for key, value := range labels {
+			placedLabels[key] = value
+		}
+		for _, httpRoute := range r.createNamespaceHTTPRoutes(namespace+"-"+name, routeNamespace, nil, placedLabels, namespaceSpec) {
+			httpRoute.Annotations = map[string]string{ownerAnnotation: ownersAnnotationValue(namespace, owners)}
+			result = append(result, httpRoute)
+		}
+	}
+	return result
+}
+
+// groupParentRefsByNamespace groups the parent refs by the namespace of their parent, in order of appearance
+func groupParentRefsByNamespace(parentRefs []gatewayv1.ParentReference) [][]gatewayv1.ParentReference {
+	var result [][]gatewayv1.ParentReference
+	index := make(map[gatewayv1.Namespace]int)
+	for _, parentRef := range parentRefs {
+		if i, ok := index[*parentRef.Namespace]; ok {
+			result[i] = append(result[i], parentRef)
+			continue
+		}
+		index[*parentRef.Namespace] = len(result)
+		result = append(result, []gatewayv1.ParentReference{parentRef})
+	}
+	return result
+}
+
+// routeName returns the name of the route, prefixed with its namespace if it is not the namespace of the Ingress
+func routeName(ingress networkingv1.Ingress, route client.Object) string {
+	if route.GetNamespace() != ingress.Namespace {
+		return client.ObjectKeyFromObject(route).String()
+	}
+	return route.GetName()
+}
+
+// ownsRoute returns true if the existing route was created for one of the owners of the desired one,
+// recorded in the owner annotation for routes outside the namespace of their Ingress
+func (r *IngressReconciler) ownsRoute(existing, desired metav1.ObjectMeta) bool {
+	if owners := parseOwnerAnnotations(desired.Annotations); len(owners) > 0 {
+		return slices.ContainsFunc(owners, func(owner annotatedOwner) bool {
+			return isAnnotatedOwner(existing.Annotations, owner.kind, owner.key.Namespace, owner.key.Name)
+		})
+	}
+	return r.isOwnedByAny(existing, desired.OwnerReferences)
+}
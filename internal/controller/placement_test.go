@@ -0,0 +1,49 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestGatewayNamespaceHTTPRoutesRecordAllOwners(t *testing.T) {
+	r := &IngressReconciler{GatewayNamespaceRoutes: true, MergeHosts: true}
+	var owners []metav1.OwnerReference
+	for _, name := range []string{"app", "other"} {
+		owner := createOwnerReference(networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+		owner.Controller = nil
+		owners = append(owners, owner)
+	}
+	spec := gatewayv1.HTTPRouteSpec{CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+		Name: "gw", Namespace: ptr.To(gatewayv1.Namespace("infra")),
+	}}}}
+
+	httpRoutes := r.createGatewayNamespaceHTTPRoutes("app-example-com", "default", owners, nil, spec)
+	if len(httpRoutes) != 1 {
+		t.Fatalf("expected a single HTTPRoute, got %d", len(httpRoutes))
+	}
+	for _, name := range []string{"app", "other"} {
+		if !isAnnotatedOwner(httpRoutes[0].Annotations, ingressGroupKind, "default", name) {
+			t.Errorf("expected the owner annotation to record Ingress %s, got %v", name, httpRoutes[0].Annotations)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadPolicyTemplate reads the template of a vendor policy for the HTTPRoutes of an Ingress from a file, for
+// annotations without a Gateway API equivalent, e.g. an Envoy Gateway SecurityPolicy or BackendTrafficPolicy
+func LoadPolicyTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// renderPolicies renders the policy template for each HTTPRoute, with the data returned for it. The policies are
+// created in the namespace of the HTTPRoute they target and owned by it, so they are kept when the HTTPRoute is
+// orphaned by a retired Ingress and deleted together with it when it becomes stale.
+func renderPolicies(tmpl *template.Template, httpRoutes []gatewayv1.HTTPRoute, data func(gatewayv1.HTTPRoute) any) ([]*unstructured.Unstructured, error) {
+	var policies []*unstructured.Unstructured
+	for _, httpRoute := range httpRoutes {
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, data(httpRoute)); err != nil {
+			return nil, fmt.Errorf("cannot render policy %s for HTTPRoute %s: %w", tmpl.Name(), httpRoute.Name, err)
+		}
+		// Decoded from JSON, numbers are integers like in the objects read from the API server
+		policy := &unstructured.Unstructured{}
+		object, err := yaml.YAMLToJSON(rendered.Bytes())
+		if err == nil {
+			err = policy.UnmarshalJSON(object)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse policy %s for HTTPRoute %s: %w", tmpl.Name(), httpRoute.Name, err)
+		}
+		if policy.GetName() == "" {
+			return nil, fmt.Errorf("policy %s for HTTPRoute %s must have a name", tmpl.Name(), httpRoute.Name)
+		}
+		policy.SetNamespace(httpRoute.Namespace)
+		policy.SetLabels(httpRoute.Labels)
+		policy.SetOwnerReferences([]metav1.OwnerReference{createRouteOwnerReference(httpRoute)})
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// createRouteOwnerReference creates the owner reference of a policy to the HTTPRoute it targets. The HTTPRoute is
+// always in the same cluster and namespace as the policy, unlike the Ingress it is converted from.
+func createRouteOwnerReference(httpRoute gatewayv1.HTTPRoute) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         gatewayv1.GroupVersion.String(),
+		Kind:               "HTTPRoute",
+		Name:               httpRoute.Name,
+		UID:                httpRoute.UID,
+		Controller:         ptr.To(true),
+		BlockOwnerDeletion: ptr.To(true),
+	}
+}
+
+// ensurePolicies creates or updates the rendered policies of the HTTPRoutes of the Ingress, owned by the HTTPRoutes
+// as they are stored. Policies with the same name that are owned by neither the HTTPRoute nor the Ingress are left
+// alone, those still owned by the Ingress are handed over to the HTTPRoute.
+func (r *IngressReconciler) ensurePolicies(ctx context.Context, ingress networkingv1.Ingress, policies []*unstructured.Unstructured) error {
+	logger := log.FromContext(ctx)
+	for _, policy := range policies {
+		routeOwner := policy.GetOwnerReferences()[0]
+		httpRoute := gatewayv1.HTTPRoute{}
+		if err := r.routeClient().Get(ctx, types.NamespacedName{Namespace: policy.GetNamespace(), Name: routeOwner.Name}, &httpRoute); err != nil {
+			if errors.IsNotFound(err) {
+				// The HTTPRoute was not created, e.g. as it belongs to another owner
+				continue
+			}
+			return err
+		}
+		if !r.ownsRoute(httpRoute.ObjectMeta, r.routeOwnerMeta(ingress, httpRoute)) {
+			continue
+		}
+		owners := []metav1.OwnerReference{createRouteOwnerReference(httpRoute)}
+		policy.SetOwnerReferences(owners)
+
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(policy.GroupVersionKind())
+		if err := r.routeClient().Get(ctx, client.ObjectKeyFromObject(policy), existing); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			if err := r.routeClient().Create(ctx, policy); err != nil {
+				return err
+			}
+			logger.Info("created policy", "kind", policy.GetKind(), "name", client.ObjectKeyFromObject(policy))
+			continue
+		}
+
+		existingMeta := metav1.ObjectMeta{Annotations: existing.GetAnnotations(), OwnerReferences: existing.GetOwnerReferences()}
+		ownedByRoute := isOwnedBy(existingMeta, owners[0])
+		if !ownedByRoute && !r.ownsRoute(existingMeta, r.routeOwnerMeta(ingress, httpRoute)) {
+			continue
+		}
+		if ownedByRoute && isEqual(existing.Object["spec"], policy.Object["spec"]) {
+			continue
+		}
+		existing.Object["spec"] = policy.Object["spec"]
+		existing.SetOwnerReferences(owners)
+		if annotations := existing.GetAnnotations(); annotations[ownerAnnotation] != "" {
+			delete(annotations, ownerAnnotation)
+			existing.SetAnnotations(annotations)
+		}
+		if err := r.routeClient().Update(ctx, existing); err != nil {
+			return err
+		}
+		logger.Info("updated policy", "kind", policy.GetKind(), "name", client.ObjectKeyFromObject(policy))
+	}
+	return nil
+}
+
+// routeOwnerMeta returns the metadata recording the Ingress as the owner of its HTTPRoute, as an owner reference or,
+// for HTTPRoutes in another namespace or cluster, as the owner annotation
+func (r *IngressReconciler) routeOwnerMeta(ingress networkingv1.Ingress, httpRoute gatewayv1.HTTPRoute) metav1.ObjectMeta {
+	owner := createOwnerReference(ingress)
+	if _, ok := httpRoute.Annotations[ownerAnnotation]; ok || r.TargetCluster != nil {
+		return metav1.ObjectMeta{Annotations: map[string]string{ownerAnnotation: ownerAnnotationValue(ownerGroupKind(owner), ingress.Namespace, ingress.Name)}}
+	}
+	return metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{owner}}
+}
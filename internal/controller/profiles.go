@@ -0,0 +1,139 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// ConversionProfile describes how the Ingresses of an Ingress controller are converted
+type ConversionProfile struct {
+	// Name of the profile, e.g. nginx
+	Name string
+	// ImplementationSpecificPathType is how the Ingress controller interprets ImplementationSpecific paths
+	ImplementationSpecificPathType PathTypePolicy
+	// AnnotationPrefixes are the prefixes of the annotations that are translated, e.g. nginx.ingress.kubernetes.io/
+	AnnotationPrefixes []string
+	// GatewayClassName limits the Gateways the HTTPRoutes attach to, all Gateways if empty
+	GatewayClassName gatewayv1.ObjectName
+}
+
+// conversionProfiles are the built-in profiles, keyed by the controller of their IngressClass.
+// GKE has no IngressClass resource, its Ingresses only use the legacy annotation.
+var conversionProfiles = []struct {
+	controller string
+	profile    ConversionProfile
+}{
+	{controller: "k8s.io/ingress-nginx", profile: ConversionProfile{
+		Name: "nginx", ImplementationSpecificPathType: PathTypeRegex, AnnotationPrefixes: []string{nginxAnnotationPrefix},
+	}},
+	{controller: "traefik.io/ingress-controller", profile: ConversionProfile{
+		Name: "traefik", ImplementationSpecificPathType: PathTypePrefix, AnnotationPrefixes: []string{traefikAnnotationPrefix},
+	}},
+	{controller: "ingress.k8s.aws/alb", profile: ConversionProfile{
+		Name: "alb", ImplementationSpecificPathType: PathTypePrefix, AnnotationPrefixes: []string{albAnnotationPrefix},
+	}},
+	{controller: "azure/application-gateway", profile: ConversionProfile{
+		Name: "agic", ImplementationSpecificPathType: PathTypePrefix, AnnotationPrefixes: []string{agicAnnotationPrefix},
+	}},
+	{controller: "", profile: ConversionProfile{
+		Name: "gce", ImplementationSpecificPathType: PathTypePrefix, AnnotationPrefixes: []string{gceAnnotationPrefix},
+	}},
+}
+
+// ProfileNames returns the names of the built-in conversion profiles
+func ProfileNames() []string {
+	names := make([]string, 0, len(conversionProfiles))
+	for _, p := range conversionProfiles {
+		names = append(names, p.profile.Name)
+	}
+	return names
+}
+
+// ParseProfileGatewayClasses parses a comma-separated list of profile=gatewayclass pairs, e.g. nginx=internal
+func ParseProfileGatewayClasses(value string) (map[string]gatewayv1.ObjectName, error) {
+	gatewayClasses := make(map[string]gatewayv1.ObjectName)
+	for _, item := range strings.Split(value, ",") {
+		profile, gatewayClass, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || gatewayClass == "" {
+			return nil, fmt.Errorf("invalid profile GatewayClass %q, must be profile=gatewayclass", item)
+		}
+		if !slices.Contains(ProfileNames(), profile) {
+			return nil, fmt.Errorf("unknown conversion profile %q, must be one of %s", profile, strings.Join(ProfileNames(), ", "))
+		}
+		gatewayClasses[profile] = gatewayv1.ObjectName(gatewayClass)
+	}
+	return gatewayClasses, nil
+}
+
+// conversionProfile returns the profile for the IngressClass of the Ingress, selected by the controller of the
+// IngressClass or else by the name of the class, e.g. gce. Without ConversionProfiles, or for an Ingress of an
+// unknown controller, nil is returned and the Ingress is converted with the global options.
+func (r *IngressReconciler) conversionProfile(ctx context.Context, ingress networkingv1.Ingress) (*ConversionProfile, error) {
+	if !r.ConversionProfiles {
+		return nil, nil
+	}
+
+	class := ingressClass(ingress)
+	if class == "" {
+		var err error
+		if class, err = defaultIngressClass(ctx, r.Client); err != nil || class == "" {
+			return nil, err
+		}
+	}
+
+	resource := networkingv1.IngressClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: class}, &resource); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	for _, p := range conversionProfiles {
+		if (p.controller != "" && p.controller == resource.Spec.Controller) || p.profile.Name == class {
+			profile := p.profile
+			profile.GatewayClassName = r.ProfileGatewayClasses[profile.Name]
+			return &profile, nil
+		}
+	}
+	return nil, nil
+}
+
+// translates returns true if the annotations with the prefix are translated. Without a profile all are.
+func (p *ConversionProfile) translates(prefix string) bool {
+	return p == nil || slices.Contains(p.AnnotationPrefixes, prefix)
+}
+
+// gateways returns the Gateways the HTTPRoutes of the profile attach to. Without a profile all do.
+func (p *ConversionProfile) gateways(gateways gatewayv1.GatewayList) gatewayv1.GatewayList {
+	if p == nil || p.GatewayClassName == "" {
+		return gateways
+	}
+	var result gatewayv1.GatewayList
+	for _, gateway := range gateways.Items {
+		if gateway.Spec.GatewayClassName == p.GatewayClassName {
+			result.Items = append(result.Items, gateway)
+		}
+	}
+	return result
+}
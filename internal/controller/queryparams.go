@@ -0,0 +1,93 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// queryParamsAnnotation lists the query parameters the requests must have, one per line, as `name=value` for an
+	// exact value or `name~=pattern` for a regular expression
+	queryParamsAnnotation = DefaultAnnotationPrefix + "query-params"
+
+	// maxQueryParamMatches is the maximum number of query parameters of an HTTPRoute match
+	maxQueryParamMatches = 16
+)
+
+// queryParamMatches returns the query parameter matches of the query-params annotation of the Ingress, or nil if it
+// has none. Lines without a valid name or a valid regular expression, repeated names and lines beyond the maximum
+// are left out with an Event.
+func (r *IngressReconciler) queryParamMatches(ingress *networkingv1.Ingress) []gatewayv1.HTTPQueryParamMatch {
+	var matches []gatewayv1.HTTPQueryParamMatch
+	var invalid []string
+	annotation := r.annotation(queryParamsAnnotation)
+	for _, line := range strings.Split(ingress.Annotations[annotation], "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		matchType := gatewayv1.QueryParamMatchExact
+		name, value, found := strings.Cut(line, "=")
+		if regex, ok := strings.CutSuffix(name, "~"); ok && found {
+			matchType, name = gatewayv1.QueryParamMatchRegularExpression, regex
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		repeated := slices.ContainsFunc(matches, func(match gatewayv1.HTTPQueryParamMatch) bool {
+			return string(match.Name) == name
+		})
+		valid := found && headerNamePattern.MatchString(name) && value != "" && !repeated && len(matches) < maxQueryParamMatches
+		if valid && matchType == gatewayv1.QueryParamMatchRegularExpression {
+			_, err := regexp.Compile(value)
+			valid = err == nil
+		}
+		if !valid {
+			invalid = append(invalid, fmt.Sprintf("%q", line))
+			continue
+		}
+		matches = append(matches, gatewayv1.HTTPQueryParamMatch{
+			Type: ptr.To(matchType), Name: gatewayv1.HTTPHeaderName(name), Value: value,
+		})
+	}
+	if len(invalid) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidQueryParamAnnotation",
+			fmt.Sprintf("Entries %s of %s are not valid or repeated query parameters, or exceed the maximum of %d, "+
+				"and are left out", strings.Join(invalid, ", "), annotation, maxQueryParamMatches))
+	}
+	return matches
+}
+
+// applyQueryParamMatches adds the query parameter matches to each match of a rule, replacing the query parameters
+// of the same name, e.g. of an AWS load balancer condition
+func applyQueryParamMatches(routeRule *gatewayv1.HTTPRouteRule, queryParams []gatewayv1.HTTPQueryParamMatch) {
+	for i := range routeRule.Matches {
+		match := &routeRule.Matches[i]
+		for _, queryParam := range queryParams {
+			match.QueryParams = slices.DeleteFunc(match.QueryParams, func(other gatewayv1.HTTPQueryParamMatch) bool {
+				return other.Name == queryParam.Name
+			})
+			match.QueryParams = append(match.QueryParams, *queryParam.DeepCopy())
+		}
+	}
+}
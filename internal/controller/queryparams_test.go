@@ -0,0 +1,72 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestQueryParamMatches(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		queryParamsAnnotation: "version = v2\n\nregion~=^eu-.*$\nversion=v3\nbroken~=(\nmissing",
+	}}}
+
+	expected := []gatewayv1.HTTPQueryParamMatch{
+		{Type: ptr.To(gatewayv1.QueryParamMatchExact), Name: "version", Value: "v2"},
+		{Type: ptr.To(gatewayv1.QueryParamMatchRegularExpression), Name: "region", Value: "^eu-.*$"},
+	}
+	if matches := r.queryParamMatches(ingress); !isEqual(matches, expected) {
+		t.Errorf("unexpected matches: %+v", matches)
+	}
+	event := <-recorder.Events
+	for _, entry := range []string{`"version=v3"`, `"broken~=("`, `"missing"`} {
+		if !strings.Contains(event, "InvalidQueryParamAnnotation") || !strings.Contains(event, entry) {
+			t.Errorf("expected event for %s, got %s", entry, event)
+		}
+	}
+
+	if matches := r.queryParamMatches(&networkingv1.Ingress{}); matches != nil {
+		t.Errorf("expected no matches, got %+v", matches)
+	}
+}
+
+func TestApplyQueryParamMatches(t *testing.T) {
+	pathMatch := gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")}
+	routeRule := gatewayv1.HTTPRouteRule{Matches: []gatewayv1.HTTPRouteMatch{
+		{Path: &pathMatch, QueryParams: []gatewayv1.HTTPQueryParamMatch{{Name: "version", Value: "v1"}, {Name: "debug", Value: "true"}}},
+		{Path: &pathMatch},
+	}}
+	queryParams := []gatewayv1.HTTPQueryParamMatch{{Type: ptr.To(gatewayv1.QueryParamMatchExact), Name: "version", Value: "v2"}}
+
+	applyQueryParamMatches(&routeRule, queryParams)
+	expected := []gatewayv1.HTTPRouteMatch{
+		{Path: &pathMatch, QueryParams: []gatewayv1.HTTPQueryParamMatch{{Name: "debug", Value: "true"}, queryParams[0]}},
+		{Path: &pathMatch, QueryParams: queryParams},
+	}
+	if !isEqual(routeRule.Matches, expected) {
+		t.Errorf("unexpected matches: %+v", routeRule.Matches)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// quotaRequeueDelay is the interval at which an Ingress exceeding its route quota is retried
+const quotaRequeueDelay = time.Minute
+
+// maxRoutesAnnotation on a Namespace overrides the maximum number of routes generated in it, 0 lifts the limit
+const maxRoutesAnnotation = DefaultAnnotationPrefix + "max-routes"
+
+// errRouteQuotaExceeded is returned when creating a route would exceed the quota of its namespace
+var errRouteQuotaExceeded = errors.New("route quota exceeded")
+
+func isRouteQuotaExceeded(err error) bool {
+	return errors.Is(err, errRouteQuotaExceeded)
+}
+
+// routeQuotaExceeded reports the route that cannot be created, generating stops until routes are deleted or the
+// quota is raised
+func (r *IngressReconciler) routeQuotaExceeded(ctx context.Context, ingress *networkingv1.Ingress, kind, name string, err error) ctrl.Result {
+	log.FromContext(ctx).Info("cannot create "+kind, "name", name, "reason", err.Error())
+	r.event(ingress, corev1.EventTypeWarning, "RouteQuotaExceeded", fmt.Sprintf("Cannot create %s %s: %v", kind, name, err))
+	return ctrl.Result{RequeueAfter: quotaRequeueDelay}
+}
+
+// ConversionPolicy limits what is generated for the Ingresses, it is read from a YAML or JSON file
+type ConversionPolicy struct {
+	// MaxRoutesPerNamespace is the maximum number of routes generated in a namespace, 0 means unlimited
+	MaxRoutesPerNamespace int `json:"maxRoutesPerNamespace,omitempty"`
+	// NamespaceMaxRoutes overrides MaxRoutesPerNamespace for single namespaces, 0 lifts the limit
+	NamespaceMaxRoutes map[string]int `json:"namespaceMaxRoutes,omitempty"`
+}
+
+// LoadConversionPolicy reads the conversion policy from a YAML or JSON file
+func LoadConversionPolicy(path string) (*ConversionPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy ConversionPolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	if policy.MaxRoutesPerNamespace < 0 {
+		return nil, fmt.Errorf("invalid maxRoutesPerNamespace in %s: %d", path, policy.MaxRoutesPerNamespace)
+	}
+	for namespace, quota := range policy.NamespaceMaxRoutes {
+		if quota < 0 {
+			return nil, fmt.Errorf("invalid namespaceMaxRoutes of namespace %s in %s: %d", namespace, path, quota)
+		}
+	}
+	return &policy, nil
+}
+
+// routeQuota returns the maximum number of routes generated in the namespace, or 0 if unlimited. The annotation
+// of the Namespace takes precedence over the ConversionPolicy, which takes precedence over MaxRoutesPerNamespace.
+func (r *IngressReconciler) routeQuota(ctx context.Context, namespace string) (int, error) {
+	// The Namespace the routes are written to, which is in the target cluster if any
+	ns := corev1.Namespace{}
+	if err := r.routeClient().Get(ctx, types.NamespacedName{Name: namespace}, &ns); client.IgnoreNotFound(err) != nil {
+		return 0, err
+	}
+	annotation := r.annotation(maxRoutesAnnotation)
+	if value, ok := ns.Annotations[annotation]; ok {
+		quota, err := strconv.Atoi(value)
+		if err != nil || quota < 0 {
+			return 0, fmt.Errorf("invalid %s annotation on namespace %s: %q", annotation, namespace, value)
+		}
+		return quota, nil
+	}
+	if r.ConversionPolicy != nil {
+		if quota, ok := r.ConversionPolicy.NamespaceMaxRoutes[namespace]; ok {
+			return quota, nil
+		}
+		if r.ConversionPolicy.MaxRoutesPerNamespace > 0 {
+			return r.ConversionPolicy.MaxRoutesPerNamespace, nil
+		}
+	}
+	return r.MaxRoutesPerNamespace, nil
+}
+
+// checkRouteQuota returns errRouteQuotaExceeded if the namespace cannot hold another generated route. The
+// generated HTTPRoutes count, and the GRPCRoutes and TLSRoutes if they are generated.
+func (r *IngressReconciler) checkRouteQuota(ctx context.Context, namespace string) error {
+	quota, err := r.routeQuota(ctx, namespace)
+	if err != nil || quota == 0 {
+		return err
+	}
+
+	lists := []client.ObjectList{&gatewayv1.HTTPRouteList{}}
+	if r.AppProtocolBackends {
+		lists = append(lists, &gatewayv1.GRPCRouteList{})
+	}
+	if r.TLSPassthroughRoutes {
+		lists = append(lists, &gatewayv1alpha2.TLSRouteList{})
+	}
+	generated := 0
+	for _, list := range lists {
+		if err := r.routeClient().List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return err
+		}
+		if err := meta.EachListItem(list, func(obj runtime.Object) error {
+			if route, ok := obj.(client.Object); ok && isGenerated(route) {
+				generated++
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if generated >= quota {
+		return fmt.Errorf("%w: namespace %s already has %d generated routes", errRouteQuotaExceeded, namespace, generated)
+	}
+	return nil
+}
+
+// isGenerated returns true if the route was generated for an Ingress or another converted source
+func isGenerated(route client.Object) bool {
+	if _, ok := route.GetAnnotations()[ownerAnnotation]; ok {
+		return true
+	}
+	for _, reference := range route.GetOwnerReferences() {
+		if isSourceOwner(reference.APIVersion, reference.Kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+var _ = Describe("Route quotas", func() {
+	const namespace = "quota-namespace"
+
+	var (
+		gateway *gatewayv1.Gateway
+		ingress *networkingv1.Ingress
+	)
+
+	BeforeEach(func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		Expect(ctrlclient.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).To(Succeed())
+
+		hostname := gatewayv1.Hostname("*.quota.example.com")
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota-gw", Namespace: namespace},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "test-class",
+				Listeners: []gatewayv1.Listener{{
+					Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80, Hostname: &hostname,
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, gateway)).To(Succeed())
+
+		pathType := networkingv1.PathTypePrefix
+		ingress = &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "sprawling-app", Namespace: namespace}}
+		for _, host := range []string{"a.quota.example.com", "b.quota.example.com", "c.quota.example.com"} {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: "app-service",
+							Port: networkingv1.ServiceBackendPort{Number: 80},
+						}},
+					}},
+				}},
+			})
+		}
+		Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, ingress)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, gateway)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &gatewayv1.HTTPRoute{}, ctrlclient.InNamespace(namespace))).To(Succeed())
+	})
+
+	countHTTPRoutes := func() int {
+		var httpRoutes gatewayv1.HTTPRouteList
+		Expect(k8sClient.List(ctx, &httpRoutes, ctrlclient.InNamespace(namespace))).To(Succeed())
+		return len(httpRoutes.Items)
+	}
+
+	It("stops generating HTTPRoutes once the namespace quota is reached", func() {
+		recorder := record.NewFakeRecorder(10)
+		reconciler := &IngressReconciler{
+			Client:                k8sClient,
+			Scheme:                k8sClient.Scheme(),
+			MaxRoutesPerNamespace: 2,
+			Recorder:              recorder,
+		}
+
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(quotaRequeueDelay))
+		Expect(countHTTPRoutes()).To(Equal(2))
+		Expect(recorder.Events).To(Receive(ContainSubstring("RouteQuotaExceeded")))
+
+		By("lifting the quota of the namespace")
+		ns := &corev1.Namespace{}
+		Expect(k8sClient.Get(ctx, ctrlclient.ObjectKey{Name: namespace}, ns)).To(Succeed())
+		metav1.SetMetaDataAnnotation(&ns.ObjectMeta, maxRoutesAnnotation, "0")
+		Expect(k8sClient.Update(ctx, ns)).To(Succeed())
+
+		result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(countHTTPRoutes()).To(Equal(3))
+	})
+})
+
+func TestLoadConversionPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("maxRoutesPerNamespace: 5\nnamespaceMaxRoutes:\n  platform: 0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadConversionPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxRoutesPerNamespace != 5 || policy.NamespaceMaxRoutes["platform"] != 0 {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	for _, invalid := range []string{
+		"maxRoutesPerNamespace: -1\n",
+		"namespaceMaxRoutes:\n  platform: -1\n",
+		"maxRoutes: 5\n",
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConversionPolicy(path); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestRouteQuota(t *testing.T) {
+	namespace := func(name, quota string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if quota != "" {
+			ns.Annotations = map[string]string{maxRoutesAnnotation: quota}
+		}
+		return ns
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).
+		WithObjects(namespace("annotated", "3"), namespace("lifted", "0"), namespace("plain", ""), namespace("listed", "")).
+		Build()
+	policy := &ConversionPolicy{MaxRoutesPerNamespace: 10, NamespaceMaxRoutes: map[string]int{"listed": 20, "lifted": 30}}
+
+	for _, tc := range []struct {
+		name      string
+		flag      int
+		policy    *ConversionPolicy
+		namespace string
+		expected  int
+	}{
+		{name: "annotation without flag", namespace: "annotated", expected: 3},
+		{name: "annotation over policy", policy: policy, namespace: "lifted", expected: 0},
+		{name: "namespace of policy", flag: 1, policy: policy, namespace: "listed", expected: 20},
+		{name: "default of policy", flag: 1, policy: policy, namespace: "plain", expected: 10},
+		{name: "flag", flag: 1, namespace: "plain", expected: 1},
+		{name: "missing namespace", flag: 1, namespace: "missing", expected: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &IngressReconciler{Client: c, MaxRoutesPerNamespace: tc.flag, ConversionPolicy: tc.policy}
+			quota, err := r.routeQuota(context.Background(), tc.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quota != tc.expected {
+				t.Errorf("expected quota %d, got %d", tc.expected, quota)
+			}
+		})
+	}
+}
+
+func TestCheckRouteQuotaCountsAllRoutes(t *testing.T) {
+	generated := metav1.ObjectMeta{
+		Namespace:   "default",
+		Annotations: map[string]string{ownerAnnotation: ownerAnnotationValue(ingressGroupKind, "default", "app")},
+	}
+	httpRoute := &gatewayv1.HTTPRoute{ObjectMeta: *generated.DeepCopy()}
+	httpRoute.Name = "app"
+	grpcRoute := &gatewayv1.GRPCRoute{ObjectMeta: *generated.DeepCopy()}
+	grpcRoute.Name = "app-grpc"
+	tlsRoute := &gatewayv1alpha2.TLSRoute{ObjectMeta: *generated.DeepCopy()}
+	tlsRoute.Name = "app-tls"
+	// Routes created by hand do not count
+	manual := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "default"}}
+
+	r := &IngressReconciler{
+		Client:                fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(httpRoute, grpcRoute, tlsRoute, manual).Build(),
+		MaxRoutesPerNamespace: 3,
+	}
+	if err := r.checkRouteQuota(context.Background(), "default"); err != nil {
+		t.Errorf("expected the HTTPRoute to fit the quota without GRPCRoutes and TLSRoutes, got %v", err)
+	}
+	r.AppProtocolBackends = true
+	r.TLSPassthroughRoutes = true
+	if err := r.checkRouteQuota(context.Background(), "default"); !isRouteQuotaExceeded(err) {
+		t.Errorf("expected the GRPCRoute and TLSRoute to count, got %v", err)
+	}
+}
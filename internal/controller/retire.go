@@ -0,0 +1,221 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// RetireMode selects what happens to an Ingress once its HTTPRoutes are accepted
+type RetireMode string
+
+const (
+	// RetireNone leaves the Ingress alone
+	RetireNone RetireMode = ""
+	// RetireDelete deletes the Ingress, the HTTPRoutes are orphaned first so they are not garbage collected
+	RetireDelete RetireMode = "delete"
+	// RetireStripClass moves the Ingress to an IngressClass that does not exist, so the Ingress controller releases it
+	// without the Ingress being handed to the default IngressClass
+	RetireStripClass RetireMode = "strip-class"
+)
+
+const (
+	// verifiedAnnotation marks an Ingress whose HTTPRoutes have been verified to serve its traffic
+	verifiedAnnotation = DefaultAnnotationPrefix + "verified"
+	// ingressClassAnnotation is the legacy way of selecting the IngressClass
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// retiredClassAnnotation records the IngressClass of an Ingress before its class was stripped, so it keeps being
+	// converted as an Ingress of that class
+	retiredClassAnnotation = DefaultAnnotationPrefix + "retired-class"
+	// retiredIngressClass is the IngressClass of the Ingresses whose class was stripped, which no controller serves
+	retiredIngressClass = "ingress2httproute-retired"
+)
+
+// ParseRetireMode validates a retire mode given on the command line
+func ParseRetireMode(value string) (RetireMode, error) {
+	mode := RetireMode(value)
+	switch mode {
+	case RetireNone, RetireDelete, RetireStripClass:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown retire mode %q, must be one of %s or %s", value, RetireDelete, RetireStripClass)
+}
+
+// retireSource deletes the Ingress or strips its class, once all its HTTPRoutes are accepted by all their parents
+// and, if required, the Ingress is annotated as verified and has no unconvertible annotations left. An Ingress
+// without HTTPRoutes is never retired, neither are ACME solvers, as cert-manager deletes them itself, nor Ingresses
+// with backends left out of their HTTPRoutes as their named ports are not resolved.
+func (r *IngressReconciler) retireSource(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	if len(httpRoutes) == 0 || isAcmeSolver(ingress) {
+		return nil
+	}
+	if r.RetireRequiresVerification && ingress.Annotations[r.annotation(verifiedAnnotation)] != "true" {
+		return nil
+	}
+	if r.RetireRequiresConvertible {
+		profile, err := r.conversionProfile(ctx, ingress)
+		if err != nil {
+			return err
+		}
+		if len(r.unconvertibleAnnotations(profile, ingress)) > 0 {
+			return nil
+		}
+	}
+	if r.DisableServiceLookups && hasNamedServicePort(ingress) {
+		// The backends of named ports are left out of the HTTPRoutes
+		return nil
+	}
+
+	var current []gatewayv1.HTTPRoute
+	for _, desired := range httpRoutes {
+		httpRoute := gatewayv1.HTTPRoute{}
+		if err := r.routeClient().Get(ctx, client.ObjectKeyFromObject(&desired), &httpRoute); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !isAccepted(httpRoute) {
+			return nil
+		}
+		current = append(current, httpRoute)
+	}
+
+	logger := log.FromContext(ctx)
+	mode := r.RetireSource
+	if mode == RetireDelete && slices.ContainsFunc(current, func(httpRoute gatewayv1.HTTPRoute) bool {
+		return hasOtherOwners(httpRoute.ObjectMeta, ingress)
+	}) {
+		// The other Ingresses of a merged hostname would rebuild the HTTPRoute without the rules of this one
+		logger.Info("stripping IngressClass instead of deleting retired Ingress, as its HTTPRoutes are shared")
+		mode = RetireStripClass
+	}
+	switch mode {
+	case RetireDelete:
+		for i := range current {
+			if err := r.orphanHTTPRoute(ctx, &current[i], ingress); err != nil {
+				return err
+			}
+		}
+		if err := r.ingressClient().Delete(ctx, &ingress, client.Preconditions{UID: &ingress.UID}); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		logger.Info("deleted retired Ingress")
+	case RetireStripClass:
+		if ptr.Deref(ingress.Spec.IngressClassName, "") == retiredIngressClass {
+			return nil
+		}
+		// Without a class, the Ingress would be served by the default IngressClass
+		class := ingressClass(ingress)
+		if class == "" {
+			var err error
+			if class, err = defaultIngressClass(ctx, r.Client); err != nil {
+				return err
+			}
+		}
+		patch := client.MergeFrom(ingress.DeepCopy())
+		ingress.Spec.IngressClassName = ptr.To(retiredIngressClass)
+		delete(ingress.Annotations, ingressClassAnnotation)
+		if class != "" {
+			metav1.SetMetaDataAnnotation(&ingress.ObjectMeta, retiredClassAnnotation, class)
+		}
+		if err := r.ingressClient().Patch(ctx, &ingress, patch); err != nil {
+			return err
+		}
+		logger.Info("stripped IngressClass from retired Ingress", "class", class)
+	}
+	return nil
+}
+
+// hasNamedServicePort returns true if a backend of the Ingress references a Service port by name
+func hasNamedServicePort(ingress networkingv1.Ingress) bool {
+	if ingress.Spec.DefaultBackend != nil && isNamedServicePort(*ingress.Spec.DefaultBackend) {
+		return true
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if isNamedServicePort(path.Backend) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasOtherOwners returns true if the route is also owned by others than the Ingress, such as the other Ingresses of a
+// merged hostname
+func hasOtherOwners(metadata metav1.ObjectMeta, ingress networkingv1.Ingress) bool {
+	if slices.ContainsFunc(metadata.OwnerReferences, func(reference metav1.OwnerReference) bool {
+		return reference.UID != ingress.UID
+	}) {
+		return true
+	}
+	return slices.ContainsFunc(parseOwnerAnnotations(metadata.Annotations), func(owner annotatedOwner) bool {
+		return !owner.is(ingressGroupKind, ingress.Namespace, ingress.Name)
+	})
+}
+
+// isAccepted returns true if every parent of the HTTPRoute accepted its current generation
+func isAccepted(httpRoute gatewayv1.HTTPRoute) bool {
+	for _, parentRef := range httpRoute.Spec.ParentRefs {
+		index := slices.IndexFunc(httpRoute.Status.Parents, func(status gatewayv1.RouteParentStatus) bool {
+			return isSameParent(status.ParentRef, parentRef) &&
+				ptr.Equal(status.ParentRef.SectionName, parentRef.SectionName) && ptr.Equal(status.ParentRef.Port, parentRef.Port)
+		})
+		if index < 0 {
+			return false
+		}
+		condition := meta.FindStatusCondition(httpRoute.Status.Parents[index].Conditions, string(gatewayv1.RouteConditionAccepted))
+		if condition == nil || condition.Status != metav1.ConditionTrue || condition.ObservedGeneration < httpRoute.Generation {
+			return false
+		}
+	}
+	return true
+}
+
+// orphanHTTPRoute removes the owner reference and the owner annotation entry of the Ingress from the HTTPRoute, and
+// the source labels once no other owner is left in the annotation
+func (r *IngressReconciler) orphanHTTPRoute(ctx context.Context, httpRoute *gatewayv1.HTTPRoute, ingress networkingv1.Ingress) error {
+	patch := client.MergeFrom(httpRoute.DeepCopy())
+	httpRoute.OwnerReferences = slices.DeleteFunc(httpRoute.OwnerReferences, func(reference metav1.OwnerReference) bool {
+		return reference.UID == ingress.UID
+	})
+	if !releaseAnnotatedOwner(httpRoute, ingressGroupKind, ingress.Namespace, ingress.Name) {
+		delete(httpRoute.Annotations, ownerAnnotation)
+		delete(httpRoute.Labels, sourceKindLabel)
+		delete(httpRoute.Labels, sourceNamespaceLabel)
+		delete(httpRoute.Labels, sourceNameLabel)
+	}
+	if err := r.routeClient().Patch(ctx, httpRoute, patch); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("orphaned HTTPRoute of retired Ingress",
+		"name", types.NamespacedName{Namespace: httpRoute.Namespace, Name: httpRoute.Name})
+	return nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+var _ = Describe("Retiring Ingresses", func() {
+	var (
+		gateway *gatewayv1.Gateway
+		ingress *networkingv1.Ingress
+	)
+
+	BeforeEach(func() {
+		hostname := gatewayv1.Hostname("*.retire.example.com")
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "retire-gw", Namespace: "default"},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "test-class",
+				Listeners: []gatewayv1.Listener{{
+					Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80, Hostname: &hostname,
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, gateway)).To(Succeed())
+
+		pathType := networkingv1.PathTypePrefix
+		ingress = &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "retired-app", Namespace: "default"},
+			Spec: networkingv1.IngressSpec{
+				IngressClassName: ptr.To("legacy-class"),
+				Rules: []networkingv1.IngressRule{{
+					Host: "app.retire.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+								Name: "app-service",
+								Port: networkingv1.ServiceBackendPort{Number: 80},
+							}},
+						}},
+					}},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(ctrlclient.IgnoreNotFound(k8sClient.Delete(ctx, ingress))).To(Succeed())
+		Expect(ctrlclient.IgnoreNotFound(k8sClient.Delete(ctx, gateway))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &gatewayv1.HTTPRoute{}, ctrlclient.InNamespace("default"))).To(Succeed())
+	})
+
+	reconcileIngress := func(reconciler *IngressReconciler) {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// acceptHTTPRoute sets the status a Gateway controller would set on the HTTPRoute
+	acceptHTTPRoute := func() {
+		httpRoute := gatewayv1.HTTPRoute{}
+		key := ctrlclient.ObjectKey{Namespace: "default", Name: "retired-app-app-retire-example-com"}
+		Expect(k8sClient.Get(ctx, key, &httpRoute)).To(Succeed())
+		httpRoute.Status.Parents = []gatewayv1.RouteParentStatus{{
+			ParentRef:      httpRoute.Spec.ParentRefs[0],
+			ControllerName: "example.com/gateway-controller",
+			Conditions: []metav1.Condition{{
+				Type:               string(gatewayv1.RouteConditionAccepted),
+				Status:             metav1.ConditionTrue,
+				Reason:             string(gatewayv1.RouteReasonAccepted),
+				ObservedGeneration: httpRoute.Generation,
+				LastTransitionTime: metav1.Now(),
+			}},
+		}}
+		Expect(k8sClient.Status().Update(ctx, &httpRoute)).To(Succeed())
+	}
+
+	getIngress := func() (*networkingv1.Ingress, error) {
+		current := &networkingv1.Ingress{}
+		return current, k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), current)
+	}
+
+	It("strips the class once the HTTPRoutes are accepted", func() {
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), RetireSource: RetireStripClass}
+
+		reconcileIngress(reconciler)
+		current, err := getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Spec.IngressClassName).To(HaveValue(Equal("legacy-class")))
+
+		acceptHTTPRoute()
+		reconcileIngress(reconciler)
+		current, err = getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Spec.IngressClassName).To(HaveValue(Equal(retiredIngressClass)))
+		Expect(current.Annotations).To(HaveKeyWithValue(retiredClassAnnotation, "legacy-class"))
+		Expect(ingressClass(*current)).To(Equal("legacy-class"))
+	})
+
+	It("keeps an Ingress without a class away from the default IngressClass", func() {
+		defaultClass := &networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{
+			Name:        "default-class",
+			Annotations: map[string]string{defaultIngressClassAnnotation: "true"},
+		}}
+		Expect(k8sClient.Create(ctx, defaultClass)).To(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, defaultClass)).To(Succeed()) }()
+		current, err := getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		current.Spec.IngressClassName = nil
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), RetireSource: RetireStripClass}
+		reconcileIngress(reconciler)
+		acceptHTTPRoute()
+		reconcileIngress(reconciler)
+		current, err = getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Spec.IngressClassName).To(HaveValue(Equal(retiredIngressClass)))
+		Expect(current.Annotations).To(HaveKeyWithValue(retiredClassAnnotation, "default-class"))
+	})
+
+	It("keeps the class until the unconvertible annotations are removed", func() {
+		reconciler := &IngressReconciler{
+			Client:                    k8sClient,
+			Scheme:                    k8sClient.Scheme(),
+			RetireSource:              RetireStripClass,
+			RetireRequiresConvertible: true,
+		}
+
+		current, err := getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		metav1.SetMetaDataAnnotation(&current.ObjectMeta, nginxConfigurationSnippetAnnotation, "more_set_headers \"X-Frame-Options: DENY\";")
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		reconcileIngress(reconciler)
+		acceptHTTPRoute()
+		reconcileIngress(reconciler)
+		current, err = getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Spec.IngressClassName).To(HaveValue(Equal("legacy-class")))
+
+		delete(current.Annotations, nginxConfigurationSnippetAnnotation)
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		reconcileIngress(reconciler)
+		current, err = getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Spec.IngressClassName).To(HaveValue(Equal(retiredIngressClass)))
+		Expect(current.Annotations).To(HaveKeyWithValue(retiredClassAnnotation, "legacy-class"))
+		Expect(ingressClass(*current)).To(Equal("legacy-class"))
+	})
+
+	It("deletes the Ingress but keeps its HTTPRoutes once verified", func() {
+		reconciler := &IngressReconciler{
+			Client:                     k8sClient,
+			Scheme:                     k8sClient.Scheme(),
+			RetireSource:               RetireDelete,
+			RetireRequiresVerification: true,
+		}
+
+		reconcileIngress(reconciler)
+		acceptHTTPRoute()
+		reconcileIngress(reconciler)
+		_, err := getIngress()
+		Expect(err).NotTo(HaveOccurred())
+
+		current, err := getIngress()
+		Expect(err).NotTo(HaveOccurred())
+		metav1.SetMetaDataAnnotation(&current.ObjectMeta, verifiedAnnotation, "true")
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		reconcileIngress(reconciler)
+		_, err = getIngress()
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		httpRoute := gatewayv1.HTTPRoute{}
+		key := ctrlclient.ObjectKey{Namespace: "default", Name: "retired-app-app-retire-example-com"}
+		Expect(k8sClient.Get(ctx, key, &httpRoute)).To(Succeed())
+		Expect(httpRoute.OwnerReferences).To(BeEmpty())
+	})
+})
+
+func TestRetireMergedHost(t *testing.T) {
+	ctx := context.Background()
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "api-uid"},
+		Spec:       networkingv1.IngressSpec{IngressClassName: ptr.To("nginx")},
+	}
+	newHTTPRoute := func(name, owner string) *gatewayv1.HTTPRoute {
+		return &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "infra", Annotations: map[string]string{ownerAnnotation: owner},
+			Labels: sourceLabels("default", createOwnerReference(*ingress)),
+		}}
+	}
+	shared := newHTTPRoute("default-app-example-com", "Ingress.networking.k8s.io/default/api,Ingress.networking.k8s.io/default/web")
+	own := newHTTPRoute("default-api-api-example-com", "Ingress.networking.k8s.io/default/api")
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(ingress, shared, own).Build()
+	r := &IngressReconciler{Client: c, Scheme: golden.Scheme, RetireSource: RetireDelete, GatewayNamespaceRoutes: true}
+
+	// The other Ingress would rebuild the shared HTTPRoute without the rules of this one
+	if err := r.retireSource(ctx, *ingress, []gatewayv1.HTTPRoute{*shared, *own}); err != nil {
+		t.Fatal(err)
+	}
+	var retired networkingv1.Ingress
+	if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), &retired); err != nil {
+		t.Fatalf("expected the Ingress of a merged hostname not to be deleted, got %v", err)
+	}
+	if class := ptr.Deref(retired.Spec.IngressClassName, ""); class != retiredIngressClass {
+		t.Errorf("expected the class of the Ingress to be stripped instead, got %q", class)
+	}
+
+	// Orphaning only releases the entry of the Ingress
+	var httpRoute gatewayv1.HTTPRoute
+	if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(shared), &httpRoute); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.orphanHTTPRoute(ctx, &httpRoute, *ingress); err != nil {
+		t.Fatal(err)
+	}
+	if owner := httpRoute.Annotations[ownerAnnotation]; owner != "Ingress.networking.k8s.io/default/web" {
+		t.Errorf("expected the other owner to be kept, got %q", owner)
+	}
+	if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(own), &httpRoute); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.orphanHTTPRoute(ctx, &httpRoute, *ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := httpRoute.Annotations[ownerAnnotation]; ok || len(httpRoute.Labels) > 0 {
+		t.Errorf("expected the HTTPRoute to be orphaned, got annotations %v and labels %v", httpRoute.Annotations, httpRoute.Labels)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// routeNameAnnotation replaces the name of the Ingress in the names of the routes generated for it
+	routeNameAnnotation = DefaultAnnotationPrefix + "route-name"
+	// routeNameSuffixAnnotation selects whether the hostname is appended to the route name, see routeNameSuffix
+	routeNameSuffixAnnotation = DefaultAnnotationPrefix + "route-name-suffix"
+
+	// routeNameSuffixHostname appends the hostname to the route name, like the generated names
+	routeNameSuffixHostname = "hostname"
+	// routeNameSuffixNone uses the route name as is, for an Ingress with a single hostname
+	routeNameSuffixNone = "none"
+)
+
+// routeNamer returns the function naming the route of a hostname of the Ingress. The name follows
+// generateHTTPRouteName, with the route-name annotation instead of the name of the Ingress if it has one, so GitOps
+// setups can rely on predictable names. With the route-name-suffix annotation set to none, the name is used without
+// the hostname, which only an Ingress with a single hostname can. Invalid annotations are ignored with an Event.
+func (r *IngressReconciler) routeNamer(ingress *networkingv1.Ingress) func(hostname string) string {
+	name := ingress.Name
+	nameAnnotation := r.annotation(routeNameAnnotation)
+	if value, ok := ingress.Annotations[nameAnnotation]; ok {
+		if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			r.event(ingress, corev1.EventTypeWarning, "InvalidRouteNameAnnotation",
+				fmt.Sprintf("Ignoring %s annotation %q: %s", nameAnnotation, value, strings.Join(errs, ", ")))
+		} else {
+			name = value
+		}
+	}
+
+	suffixAnnotation := r.annotation(routeNameSuffixAnnotation)
+	switch suffix, ok := ingress.Annotations[suffixAnnotation]; {
+	case !ok || suffix == routeNameSuffixHostname:
+	case suffix != routeNameSuffixNone:
+		r.event(ingress, corev1.EventTypeWarning, "InvalidRouteNameAnnotation",
+			fmt.Sprintf("Ignoring %s annotation %q, must be %s or %s", suffixAnnotation, suffix,
+				routeNameSuffixHostname, routeNameSuffixNone))
+	case len(groupRulesByHostname(ingress.Spec.Rules)) > 1:
+		r.event(ingress, corev1.EventTypeWarning, "InvalidRouteNameAnnotation",
+			fmt.Sprintf("Ignoring %s annotation, the routes of the hostnames of the Ingress need distinct names",
+				suffixAnnotation))
+	default:
+		return func(string) string { return name }
+	}
+	return func(hostname string) string { return generateHTTPRouteName(name, hostname) }
+}
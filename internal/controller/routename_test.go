@@ -0,0 +1,105 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRouteNamer(t *testing.T) {
+	hosts := func(hostnames ...string) []networkingv1.IngressRule {
+		var rules []networkingv1.IngressRule
+		for _, hostname := range hostnames {
+			rules = append(rules, networkingv1.IngressRule{Host: hostname})
+		}
+		return rules
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		rules       []networkingv1.IngressRule
+		expected    string
+		event       bool
+	}{
+		{
+			name:     "generated",
+			rules:    hosts("app.example.com"),
+			expected: "app-app-example-com",
+		},
+		{
+			name:        "route name",
+			annotations: map[string]string{routeNameAnnotation: "shop"},
+			rules:       hosts("app.example.com", "www.example.com"),
+			expected:    "shop-app-example-com",
+		},
+		{
+			name:        "route name without suffix",
+			annotations: map[string]string{routeNameAnnotation: "shop", routeNameSuffixAnnotation: routeNameSuffixNone},
+			rules:       hosts("app.example.com"),
+			expected:    "shop",
+		},
+		{
+			name:        "no suffix for multiple hostnames",
+			annotations: map[string]string{routeNameSuffixAnnotation: routeNameSuffixNone},
+			rules:       hosts("app.example.com", "www.example.com"),
+			expected:    "app-app-example-com",
+			event:       true,
+		},
+		{
+			name:        "invalid suffix",
+			annotations: map[string]string{routeNameSuffixAnnotation: "index"},
+			rules:       hosts("app.example.com"),
+			expected:    "app-app-example-com",
+			event:       true,
+		},
+		{
+			name:        "invalid route name",
+			annotations: map[string]string{routeNameAnnotation: "Shop_Routes"},
+			rules:       hosts("app.example.com"),
+			expected:    "app-app-example-com",
+			event:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &IngressReconciler{Recorder: recorder}
+			ingress := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: tt.annotations},
+				Spec:       networkingv1.IngressSpec{Rules: tt.rules},
+			}
+			if name := r.routeNamer(ingress)("app.example.com"); name != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, name)
+			}
+			if tt.event {
+				if len(recorder.Events) != 1 {
+					t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+				}
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidRouteNameAnnotation") {
+					t.Errorf("unexpected event: %s", event)
+				}
+			} else if len(recorder.Events) != 0 {
+				t.Errorf("expected no events, got %d", len(recorder.Events))
+			}
+		})
+	}
+}
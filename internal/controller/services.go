@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ingressServiceIndex is the field index of Ingresses by the names of their backend Services
+const ingressServiceIndex = "spec.rules.http.paths.backend.service.name"
+
+// indexIngressServices returns the names of the Services the paths and the default backend of an Ingress reference
+func indexIngressServices(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	add := func(backend *networkingv1.IngressBackend) {
+		if backend != nil && backend.Service != nil && !slices.Contains(names, backend.Service.Name) {
+			names = append(names, backend.Service.Name)
+		}
+	}
+	add(ingress.Spec.DefaultBackend)
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			add(&path.Backend)
+		}
+	}
+	return names
+}
+
+// findIngressesForService enqueues the Ingresses referencing a changed Service, so their named ports are resolved
+// again. Otherwise the HTTPRoutes would keep the old port number until the Ingress itself changes.
+func (r *IngressReconciler) findIngressesForService(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listIngressRequests(ctx, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{ingressServiceIndex: obj.GetName()})
+}
+
+// serviceChangedPredicate only passes updates of Services that changed their ports, the Service an ExternalName
+// points to or their GKE BackendConfigs, as nothing else of a Service ends up in the HTTPRoutes or their policies,
+// while e.g. its load balancer status changes often.
+func serviceChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldService, ok := e.ObjectOld.(*corev1.Service)
+			if !ok {
+				return true
+			}
+			newService, ok := e.ObjectNew.(*corev1.Service)
+			if !ok {
+				return true
+			}
+			return !isEqual(oldService.Spec.Ports, newService.Spec.Ports) ||
+				oldService.Spec.Type != newService.Spec.Type || oldService.Spec.ExternalName != newService.Spec.ExternalName ||
+				oldService.Annotations[gceBackendConfigAnnotation] != newService.Annotations[gceBackendConfigAnnotation] ||
+				oldService.Annotations[gceBetaBackendConfigAnnotation] != newService.Annotations[gceBetaBackendConfigAnnotation]
+		},
+	}
+}
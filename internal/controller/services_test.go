@@ -0,0 +1,142 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestFindIngressesForService(t *testing.T) {
+	ctx := context.Background()
+
+	newIngress := func(namespace, name, service string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+				Host: "app.example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path: "/",
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: service, Port: networkingv1.ServiceBackendPort{Name: "http"},
+						}},
+					}},
+				}},
+			}}},
+		}
+	}
+	withDefaultBackend := newIngress("default", "fallback", "web")
+	withDefaultBackend.Spec.DefaultBackend = &networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+		Name: "api", Port: networkingv1.ServiceBackendPort{Number: 80},
+	}}
+
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).
+		WithIndex(&networkingv1.Ingress{}, ingressServiceIndex, indexIngressServices).
+		WithObjects(
+			newIngress("default", "app", "api"),
+			newIngress("default", "web", "web"),
+			newIngress("other", "app", "api"),
+			withDefaultBackend,
+		).Build()}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}}
+	var names []string
+	for _, request := range r.findIngressesForService(ctx, service) {
+		names = append(names, request.String())
+	}
+	expected := []string{"default/app", "default/fallback"}
+	if !isEqual(names, expected) {
+		t.Errorf("expected %v to be enqueued, got %v", expected, names)
+	}
+}
+
+func TestServiceChangedPredicate(t *testing.T) {
+	newService := func(port int32) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: port}}},
+		}
+	}
+
+	p := serviceChangedPredicate()
+	if !p.Update(event.UpdateEvent{ObjectOld: newService(80), ObjectNew: newService(8080)}) {
+		t.Error("expected a changed port to pass")
+	}
+
+	withStatus := newService(80)
+	withStatus.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "192.0.2.1"}}
+	if p.Update(event.UpdateEvent{ObjectOld: newService(80), ObjectNew: withStatus}) {
+		t.Error("expected a status change to be filtered")
+	}
+}
+
+func TestConvertWithoutServiceLookups(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Client:                fake.NewClientBuilder().WithScheme(golden.Scheme).Build(),
+		Recorder:              recorder,
+		DisableServiceLookups: true,
+	}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "app.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: ptr.To(networkingv1.PathTypePrefix),
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: "app", Port: networkingv1.ServiceBackendPort{Name: "http"},
+					}},
+				}},
+			}},
+		}}},
+	}
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		}},
+	}}}
+
+	httpRoutes, err := r.Convert(context.Background(), ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 || len(httpRoutes[0].Spec.Rules) != 1 || len(httpRoutes[0].Spec.Rules[0].BackendRefs) != 0 {
+		t.Fatalf("expected a rule without backendRefs, got %+v", httpRoutes)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnresolvedNamedPort") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if !hasNamedServicePort(ingress) {
+		t.Errorf("expected the Ingress to keep being converted instead of being retired")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// maxRulesPerRoute is the number of rules the CRD schema allows in a HTTPRoute
+	maxRulesPerRoute = 16
+	// maxMatchesPerRule is the number of matches the CRD schema allows in a rule
+	maxMatchesPerRule = 64
+	// maxMatchesPerRoute is the number of matches the CRD schema allows across all rules of a HTTPRoute, which must
+	// be less than 128
+	maxMatchesPerRoute = 127
+)
+
+// shardHTTPRoute splits a HTTPRoute whose rules exceed the limits of the CRD schema, which would be rejected.
+// Rules with too many matches are split into rules with the same filters and backends first. The sorted rules are
+// then spread in order over HTTPRoutes of at most 16 rules and 127 matches: the first keeps the name, the others are
+// suffixed with their index. Precedence between matches does not depend on the HTTPRoute they are in, so routing is
+// unchanged.
+func shardHTTPRoute(httpRoute gatewayv1.HTTPRoute) []gatewayv1.HTTPRoute {
+	var shards [][]gatewayv1.HTTPRouteRule
+	var matches int
+	for _, rule := range splitHTTPRouteRules(httpRoute.Spec.Rules) {
+		if len(shards) == 0 || len(shards[len(shards)-1]) == maxRulesPerRoute || matches+len(rule.Matches) > maxMatchesPerRoute {
+			shards = append(shards, nil)
+			matches = 0
+		}
+		shards[len(shards)-1] = append(shards[len(shards)-1], rule)
+		matches += len(rule.Matches)
+	}
+	if len(shards) <= 1 {
+		if len(shards) == 1 {
+			httpRoute.Spec.Rules = shards[0]
+		}
+		return []gatewayv1.HTTPRoute{httpRoute}
+	}
+
+	var result []gatewayv1.HTTPRoute
+	for i, rules := range shards {
+		shard := *httpRoute.DeepCopy()
+		shard.Spec.Rules = rules
+		if i > 0 {
+			shard.Name = truncateName(fmt.Sprintf("%s-%d", httpRoute.Name, i))
+		}
+		result = append(result, shard)
+	}
+	return result
+}
+
+// splitHTTPRouteRules splits the rules with more matches than allowed into consecutive rules of at most 64 matches,
+// the names of the additional rules are suffixed with their index so they stay unique
+func splitHTTPRouteRules(rules []gatewayv1.HTTPRouteRule) []gatewayv1.HTTPRouteRule {
+	var result []gatewayv1.HTTPRouteRule
+	for _, rule := range rules {
+		if len(rule.Matches) <= maxMatchesPerRule {
+			result = append(result, rule)
+			continue
+		}
+		for i := 0; i*maxMatchesPerRule < len(rule.Matches); i++ {
+			part := *rule.DeepCopy()
+			part.Matches = part.Matches[i*maxMatchesPerRule : min((i+1)*maxMatchesPerRule, len(rule.Matches))]
+			if i > 0 && part.Name != nil {
+				part.Name = ptr.To(gatewayv1.SectionName(truncateName(fmt.Sprintf("%s-%d", *rule.Name, i))))
+			}
+			result = append(result, part)
+		}
+	}
+	return result
+}
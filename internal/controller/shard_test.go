@@ -0,0 +1,114 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestShardHTTPRoute(t *testing.T) {
+	newMatch := func(i int) gatewayv1.HTTPRouteMatch {
+		return gatewayv1.HTTPRouteMatch{Path: &gatewayv1.HTTPPathMatch{Value: ptr.To(fmt.Sprintf("/%d", i))}}
+	}
+
+	// 33 rules of a single match, and a rule with 70 matches that is split in two
+	var rules []gatewayv1.HTTPRouteRule
+	for i := range 33 {
+		rules = append(rules, gatewayv1.HTTPRouteRule{Matches: []gatewayv1.HTTPRouteMatch{newMatch(i)}})
+	}
+	wide := gatewayv1.HTTPRouteRule{Name: ptr.To(gatewayv1.SectionName("wide"))}
+	for i := range 70 {
+		wide.Matches = append(wide.Matches, newMatch(i))
+	}
+	rules = append(rules, wide)
+
+	httpRoute := gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-example-com", Namespace: "default"},
+		Spec:       gatewayv1.HTTPRouteSpec{Rules: rules},
+	}
+	shards := shardHTTPRoute(httpRoute)
+
+	expected := []struct {
+		name  string
+		rules int
+	}{
+		{name: "app-example-com", rules: 16},
+		{name: "app-example-com-1", rules: 16},
+		{name: "app-example-com-2", rules: 3},
+	}
+	if len(shards) != len(expected) {
+		t.Fatalf("expected %d HTTPRoutes, got %d", len(expected), len(shards))
+	}
+	for i, shard := range shards {
+		if shard.Name != expected[i].name || len(shard.Spec.Rules) != expected[i].rules {
+			t.Errorf("expected HTTPRoute %s with %d rules, got %s with %d rules",
+				expected[i].name, expected[i].rules, shard.Name, len(shard.Spec.Rules))
+		}
+	}
+
+	last := shards[2].Spec.Rules
+	if len(last[1].Matches) != 64 || len(last[2].Matches) != 6 {
+		t.Errorf("expected the wide rule to be split into 64 and 6 matches, got %d and %d",
+			len(last[1].Matches), len(last[2].Matches))
+	}
+	if *last[1].Name != "wide" || *last[2].Name != "wide-1" {
+		t.Errorf("expected the split rules to be named wide and wide-1, got %s and %s", *last[1].Name, *last[2].Name)
+	}
+
+	// A HTTPRoute within the limits is kept as is
+	if small := shardHTTPRoute(shards[2]); len(small) != 1 || !isEqual(small[0], shards[2]) {
+		t.Errorf("expected a HTTPRoute within the limits to be unchanged")
+	}
+}
+
+func TestShardHTTPRouteTotalMatches(t *testing.T) {
+	// 150 paths consolidated over 3 Services: every rule is within the limits, but together they are not
+	var rules []gatewayv1.HTTPRouteRule
+	for service := range 3 {
+		rule := gatewayv1.HTTPRouteRule{BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{Name: gatewayv1.ObjectName(fmt.Sprintf("app-%d", service))},
+		}}}}
+		for i := range 50 {
+			rule.Matches = append(rule.Matches, gatewayv1.HTTPRouteMatch{
+				Path: &gatewayv1.HTTPPathMatch{Value: ptr.To(fmt.Sprintf("/%d", 3*i+service))},
+			})
+		}
+		rules = append(rules, rule)
+	}
+
+	shards := shardHTTPRoute(gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-example-com", Namespace: "default"},
+		Spec:       gatewayv1.HTTPRouteSpec{Rules: rules},
+	})
+	if len(shards) != 2 || len(shards[0].Spec.Rules) != 2 || len(shards[1].Spec.Rules) != 1 {
+		t.Fatalf("expected HTTPRoutes with 2 and 1 rules, got %d HTTPRoutes", len(shards))
+	}
+	for _, shard := range shards {
+		var matches int
+		for _, rule := range shard.Spec.Rules {
+			matches += len(rule.Matches)
+		}
+		if matches >= 128 {
+			t.Errorf("expected less than 128 matches in HTTPRoute %s, got %d", shard.Name, matches)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+const (
+	// skipAnnotation opts an Ingress out of the conversion, the routes generated for it before are deleted
+	skipAnnotation = DefaultAnnotationPrefix + "skip"
+	// pauseAnnotation stops the conversion of an Ingress, the routes generated for it before are kept as they are
+	pauseAnnotation = DefaultAnnotationPrefix + "pause"
+)
+
+// isSkipped returns true if the Ingress is opted out of the conversion, so it is converted to no routes at all
+func (r *IngressReconciler) isSkipped(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[r.annotation(skipAnnotation)] == "true"
+}
+
+// isPaused returns true if the Ingress is not reconciled, so its routes are neither updated nor deleted
+func (r *IngressReconciler) isPaused(ingress networkingv1.Ingress) bool {
+	return ingress.Annotations[r.annotation(pauseAnnotation)] == "true"
+}
@@ -1,11 +1,22 @@
 package controller
 
 import (
+	"slices"
 	"strings"
 
+	"k8s.io/utils/ptr"
+
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
+// sortHTTPRouteSpec orders all lists of a generated spec whose order does not depend on the Ingress, so the same
+// Ingress always results in the same spec and reconciling does not update the HTTPRoute over and over again
+func sortHTTPRouteSpec(spec *gatewayv1.HTTPRouteSpec) {
+	slices.SortStableFunc(spec.ParentRefs, compareParentRef)
+	slices.Sort(spec.Hostnames)
+	slices.SortStableFunc(spec.Rules, compareHTTPRouteRule)
+}
+
 func compareParentRef(a, b gatewayv1.ParentReference) int {
 	// Compare by group first
 	aGroup := ""
@@ -60,31 +71,92 @@ func compareParentRef(a, b gatewayv1.ParentReference) int {
 	if b.SectionName != nil {
 		bSectionName = string(*b.SectionName)
 	}
-	return strings.Compare(aSectionName, bSectionName)
+	if cmp := strings.Compare(aSectionName, bSectionName); cmp != 0 {
+		return cmp
+	}
+
+	// Compare by port
+	aPort := 0
+	if a.Port != nil {
+		aPort = int(*a.Port)
+	}
+	bPort := 0
+	if b.Port != nil {
+		bPort = int(*b.Port)
+	}
+	return aPort - bPort
 }
 
+// compareHTTPRouteRule orders rules by Ingress path precedence, so Gateways that honor the rule order route
+// like the Ingress controller did: Exact matches first, then longer paths before shorter ones.
 func compareHTTPRouteRule(a, b gatewayv1.HTTPRouteRule) int {
-	// Compare by first match's path value if exists
-	aPath := ""
-	if len(a.Matches) > 0 && a.Matches[0].Path != nil && a.Matches[0].Path.Value != nil {
-		aPath = *a.Matches[0].Path.Value
+	aPath := firstPathMatch(a)
+	bPath := firstPathMatch(b)
+
+	// Compare by match type, Exact matches take precedence
+	if cmp := isExactMatch(bPath) - isExactMatch(aPath); cmp != 0 {
+		return cmp
+	}
+
+	// Compare by path length, the longest path takes precedence
+	aValue := ""
+	if aPath.Value != nil {
+		aValue = *aPath.Value
 	}
-	bPath := ""
-	if len(b.Matches) > 0 && b.Matches[0].Path != nil && b.Matches[0].Path.Value != nil {
-		bPath = *b.Matches[0].Path.Value
+	bValue := ""
+	if bPath.Value != nil {
+		bValue = *bPath.Value
 	}
-	if cmp := strings.Compare(aPath, bPath); cmp != 0 {
+	if cmp := len(bValue) - len(aValue); cmp != 0 {
 		return cmp
 	}
 
-	// Compare by first backend's name if exists
-	aBackend := ""
-	if len(a.BackendRefs) > 0 {
-		aBackend = string(a.BackendRefs[0].Name)
+	// Compare by path value
+	if cmp := strings.Compare(aValue, bValue); cmp != 0 {
+		return cmp
 	}
-	bBackend := ""
-	if len(b.BackendRefs) > 0 {
-		bBackend = string(b.BackendRefs[0].Name)
+
+	// Compare by path type, e.g. a PathPrefix and a RegularExpression match with the same value
+	if cmp := strings.Compare(string(ptr.Deref(aPath.Type, "")), string(ptr.Deref(bPath.Type, ""))); cmp != 0 {
+		return cmp
+	}
+
+	// Compare by backends, so rules that only differ in their backends are ordered the same on every reconcile
+	return slices.CompareFunc(a.BackendRefs, b.BackendRefs, compareHTTPBackendRef)
+}
+
+// compareHTTPBackendRef orders backend refs by name first, then by the other fields of the reference and the weight
+func compareHTTPBackendRef(a, b gatewayv1.HTTPBackendRef) int {
+	if cmp := strings.Compare(string(a.Name), string(b.Name)); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(string(ptr.Deref(a.Group, "")), string(ptr.Deref(b.Group, ""))); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(string(ptr.Deref(a.Kind, "")), string(ptr.Deref(b.Kind, ""))); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(string(ptr.Deref(a.Namespace, "")), string(ptr.Deref(b.Namespace, ""))); cmp != 0 {
+		return cmp
+	}
+	if cmp := int(ptr.Deref(a.Port, 0)) - int(ptr.Deref(b.Port, 0)); cmp != 0 {
+		return cmp
+	}
+	return int(ptr.Deref(a.Weight, 0)) - int(ptr.Deref(b.Weight, 0))
+}
+
+// firstPathMatch returns the path match of the first match of the rule, or an empty match if there is none
+func firstPathMatch(rule gatewayv1.HTTPRouteRule) gatewayv1.HTTPPathMatch {
+	if len(rule.Matches) > 0 && rule.Matches[0].Path != nil {
+		return *rule.Matches[0].Path
+	}
+	return gatewayv1.HTTPPathMatch{}
+}
+
+// isExactMatch returns 1 for an Exact path match and 0 otherwise
+func isExactMatch(match gatewayv1.HTTPPathMatch) int {
+	if match.Type != nil && *match.Type == gatewayv1.PathMatchExact {
+		return 1
 	}
-	return strings.Compare(aBackend, bBackend)
+	return 0
 }
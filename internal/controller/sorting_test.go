@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestReconcileTwiceWithoutUpdates(t *testing.T) {
+	var gateways []client.Object
+	for _, name := range []string{"internal-gw", "external-gw"} {
+		gateways = append(gateways, &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "test-class",
+				Listeners: []gatewayv1.Listener{
+					{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443, Hostname: ptr.To(gatewayv1.Hostname("*.example.com"))},
+					{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+				},
+			},
+		})
+	}
+
+	// Paths that only differ in their type or backend, and hosts spread over several rules
+	path := func(value string, pathType networkingv1.PathType, service string) networkingv1.HTTPIngressPath {
+		return networkingv1.HTTPIngressPath{
+			Path:     value,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: service, Port: networkingv1.ServiceBackendPort{Number: 80},
+			}},
+		}
+	}
+	rule := func(host string, paths ...networkingv1.HTTPIngressPath) networkingv1.IngressRule {
+		return networkingv1.IngressRule{Host: host, IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+		}}
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{
+			rule("a.example.com", path("/api", networkingv1.PathTypePrefix, "b-service")),
+			rule("b.example.com", path("/", networkingv1.PathTypePrefix, "web-service")),
+			rule("a.example.com",
+				path("/api", networkingv1.PathTypeImplementationSpecific, "a-service"),
+				path("/api", networkingv1.PathTypePrefix, "a-service")),
+		}},
+	}
+
+	var updates int
+	c := fake.NewClientBuilder().
+		WithScheme(golden.Scheme).
+		WithObjects(append(gateways, ingress)...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updates++
+				return c.Update(ctx, obj, opts...)
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				updates++
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+
+	ctx := context.Background()
+	for _, routePerParent := range []bool{false, true} {
+		r := &IngressReconciler{Client: c, Scheme: golden.Scheme, RoutePerParent: routePerParent}
+		request := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(ingress)}
+		if _, err := r.Reconcile(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+		updates = 0
+		for range 3 {
+			if _, err := r.Reconcile(ctx, request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if updates != 0 {
+			t.Errorf("expected no updates when reconciling again with routePerParent=%t, got %d", routePerParent, updates)
+		}
+	}
+}
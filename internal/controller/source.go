@@ -0,0 +1,337 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// sourceRuleGroup is the API group of the backends of the Ingress paths a source maps its rules to, when the rules
+// need more than an Ingress path can express
+const sourceRuleGroup = "ingress2httproute.lion7.dev"
+
+// sourceGVKs are the kinds of the resources other than Ingresses that are converted, by mapping them to an Ingress
+// that carries the kind of its source, so the source owns the generated routes
+var sourceGVKs = []schema.GroupVersionKind{
+	OpenShiftRouteGVK, TraefikIngressRouteGVK, ContourHTTPProxyGVK, IstioVirtualServiceGVK, AmbassadorMappingGVK,
+}
+
+// envoyRetryCodes are the status codes retried for the retry conditions of Envoy that retry on status codes, which
+// Contour, Istio and Emissary pass on. Without conditions, Contour retries on 5xx.
+var envoyRetryCodes = map[string][]gatewayv1.HTTPRouteRetryStatusCode{
+	"5xx":           {500, 502, 503, 504},
+	"gateway-error": {502, 503, 504},
+}
+
+// SourceKinds returns the kinds of the resources converted besides Ingresses
+func SourceKinds() []schema.GroupVersionKind {
+	return slices.Clone(sourceGVKs)
+}
+
+// IsSourceKind returns true if the resources of the kind are converted besides Ingresses
+func IsSourceKind(gvk schema.GroupVersionKind) bool {
+	return slices.Contains(sourceGVKs, gvk)
+}
+
+// isSourceOwner returns true if the owner reference points at an Ingress or another converted source
+func isSourceOwner(apiVersion, kind string) bool {
+	if apiVersion == "networking.k8s.io/v1" && kind == "Ingress" {
+		return true
+	}
+	for _, gvk := range sourceGVKs {
+		if apiVersion == gvk.GroupVersion().String() && kind == gvk.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceRuleBackend returns the backend of the Ingress path a rule of a source is mapped to, of the kind of the source
+// rules and named after the rule, so completeSourceRules can find the rules converted from the path
+func sourceRuleBackend(kind, name string) networkingv1.IngressBackend {
+	return networkingv1.IngressBackend{Resource: &corev1.TypedLocalObjectReference{
+		APIGroup: ptr.To(sourceRuleGroup),
+		Kind:     kind,
+		Name:     name,
+	}}
+}
+
+// sourceRuleName returns the name of the rule of a source of the kind the rule was converted from, and false if it
+// was not converted from such a rule, e.g. for the rules redirecting to HTTPS, which have no backends
+func sourceRuleName(rule gatewayv1.HTTPRouteRule, kind string) (string, bool) {
+	if len(rule.BackendRefs) == 0 {
+		return "", false
+	}
+	ref := rule.BackendRefs[0].BackendObjectReference
+	if ptr.Deref(ref.Group, "") != sourceRuleGroup || ptr.Deref(ref.Kind, "") != gatewayv1.Kind(kind) {
+		return "", false
+	}
+	return string(ref.Name), true
+}
+
+// fieldSet is a set of the fields of a resource that are converted, with the converted fields of each field that is
+// only converted in part. The fields of the items of a list are those of the list.
+type fieldSet map[string]fieldSet
+
+// unconvertedFields returns the paths of the fields of the content that are not in the set of converted fields
+func unconvertedFields(content any, fields fieldSet, path string) []string {
+	var result []string
+	switch value := content.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			nested, ok := fields[key]
+			if !ok {
+				result = append(result, path+"."+key)
+			} else if nested != nil {
+				result = append(result, unconvertedFields(value[key], nested, path+"."+key)...)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			result = append(result, unconvertedFields(item, fields, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return result
+}
+
+// sourceReferenceGranted reports a Service in another namespace than the source with an Event, unless a
+// ReferenceGrant allows the HTTPRoutes of the source to reference it or one will be created by AutoGrant
+func (r *IngressReconciler) sourceReferenceGranted(ctx context.Context, source client.Object, backend gatewayv1.BackendObjectReference) error {
+	if r.CrossNamespaceBackends && r.AutoGrant {
+		return nil
+	}
+	granted, err := r.isReferenceGranted(ctx, "HTTPRoute", source.GetNamespace(), backend)
+	if err != nil || granted {
+		return err
+	}
+	r.sourceConverter(source).event(source, corev1.EventTypeWarning, string(gatewayv1.RouteReasonRefNotPermitted),
+		fmt.Sprintf("No ReferenceGrant in namespace %s allows HTTPRoutes in namespace %s to reference Service %s",
+			*backend.Namespace, source.GetNamespace(), backend.Name))
+	return nil
+}
+
+// sourceServiceName returns the name and namespace of the Service of a host a source forwards to, which is the name
+// of a Service in the namespace of the source, <name>.<namespace> or its cluster DNS name, and false otherwise
+func sourceServiceName(host, namespace string) (string, string, bool) {
+	if match := clusterServiceName.FindStringSubmatch(host); match != nil {
+		return match[1], match[3], true
+	}
+	parts := strings.Split(host, ".")
+	switch {
+	case len(parts) == 1 && len(validation.IsDNS1035Label(parts[0])) == 0:
+		return parts[0], namespace, true
+	case len(parts) == 2 && len(validation.IsDNS1035Label(parts[0])) == 0 && len(validation.IsDNS1123Label(parts[1])) == 0:
+		return parts[0], parts[1], true
+	default:
+		return "", "", false
+	}
+}
+
+// envoyRetry returns the retry of the retry conditions of Envoy, retrying on the status codes of the conditions. The
+// conditions that do not retry on status codes, such as connect-failure, are reported with an Event on the source.
+func (r *IngressReconciler) envoyRetry(source client.Object, attempts int, retryOn []string) *gatewayv1.HTTPRouteRetry {
+	var codes []gatewayv1.HTTPRouteRetryStatusCode
+	var unsupported []string
+	for _, condition := range retryOn {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+		if code, err := strconv.Atoi(condition); err == nil {
+			codes = append(codes, gatewayv1.HTTPRouteRetryStatusCode(code))
+		} else if envoyRetryCodes[condition] != nil {
+			codes = append(codes, envoyRetryCodes[condition]...)
+		} else {
+			unsupported = append(unsupported, condition)
+		}
+	}
+	if len(unsupported) > 0 {
+		r.sourceConverter(source).event(source, corev1.EventTypeWarning, "UnsupportedRetryOn",
+			fmt.Sprintf("Retry conditions %s are not status codes, the requests are not retried for them",
+				strings.Join(unsupported, ", ")))
+	}
+	slices.Sort(codes)
+	return &gatewayv1.HTTPRouteRetry{Attempts: ptr.To(attempts), Codes: slices.Compact(codes)}
+}
+
+// sourceConverter returns a copy of the reconciler that converts the Ingress mapped from the source. Its Events are
+// emitted on the source, and the features that write to the Ingress itself or relate it to other Ingresses are off.
+func (r *IngressReconciler) sourceConverter(source runtime.Object) *IngressReconciler {
+	converter := *r
+	if r.Recorder != nil {
+		converter.Recorder = sourceRecorder{EventRecorder: r.Recorder, source: source}
+	}
+	converter.IngressClasses = nil
+	converter.ConversionProfiles = false
+	converter.MergeHosts = false
+	converter.AnnotateIngress = false
+	converter.RetireSource = RetireNone
+	return &converter
+}
+
+// finalizeSource deletes the HTTPRoutes created for the deleted source outside its namespace and then removes the
+// routes finalizer, like finalizeIngress does for Ingresses
+func (r *IngressReconciler) finalizeSource(ctx context.Context, obj *unstructured.Unstructured) error {
+	if !controllerutil.ContainsFinalizer(obj, routesFinalizer) {
+		return nil
+	}
+	// Only the kind, namespace and name of the Ingress the source is mapped to identify its routes
+	ingress := networkingv1.Ingress{
+		TypeMeta:   metav1.TypeMeta{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind()},
+		ObjectMeta: metav1.ObjectMeta{Name: obj.GetName(), Namespace: obj.GetNamespace(), UID: obj.GetUID()},
+	}
+	if err := r.deletePlacedRoutes(ctx, ingress); err != nil {
+		return err
+	}
+	if r.grantsBackends() {
+		if err := r.deleteStaleReferenceGrants(ctx); err != nil {
+			return err
+		}
+	}
+	return r.removeRoutesFinalizer(ctx, obj)
+}
+
+// sourceControllerBuilder returns the builder of the controller converting the sources of the kind. The generated
+// routes and the Gateways are watched in the cluster the routes are written to, like the Ingress controller does.
+// The sources are indexed by the hosts returned by hosts, so a Gateway change only enqueues the sources with a host
+// matching one of its listeners, and by the Gateway they are pinned to.
+func (r *IngressReconciler) sourceControllerBuilder(mgr ctrl.Manager, name string, gvk schema.GroupVersionKind, hosts func(*unstructured.Unstructured) []string) (*builder.Builder, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), obj, ingressHostIndex, r.indexSourceHosts(hosts)); err != nil {
+		return nil, err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), obj, ingressGatewayIndex, r.indexPinnedGateway); err != nil {
+		return nil, err
+	}
+	list := r.sourceRequests(gvk)
+	enqueueOwner := handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(gvk.GroupKind()))
+
+	routeCache := mgr.GetCache()
+	if r.TargetCluster != nil {
+		routeCache = r.TargetCluster.GetCache()
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(obj).
+		WatchesRawSource(source.Kind[client.Object](routeCache, &gatewayv1.Gateway{}, r.gatewayHostEventHandler(list)))
+
+	// GRPCRoutes and TLSRoutes are only watched when generated, so their CRDs are not required otherwise
+	routes := []client.Object{&gatewayv1.HTTPRoute{}}
+	if r.AppProtocolBackends {
+		routes = append(routes, &gatewayv1.GRPCRoute{})
+	}
+	if r.TLSPassthroughRoutes {
+		routes = append(routes, &gatewayv1alpha2.TLSRoute{})
+	}
+	for _, route := range routes {
+		if r.TargetCluster == nil {
+			b = b.Owns(route)
+		} else {
+			b = b.WatchesRawSource(source.Kind[client.Object](r.TargetCluster.GetCache(), route, enqueueOwner))
+		}
+	}
+
+	// HTTPRoutes in the namespaces of their Gateways record their owner in an annotation
+	if r.GatewayNamespaceRoutes && r.TargetCluster == nil {
+		b = b.Watches(&gatewayv1.HTTPRoute{}, enqueueOwner)
+	}
+
+	return watchListenerSets(b, r.ListenerSets, routeCache, r.listenerSetEventHandler(list)), nil
+}
+
+// indexSourceHosts returns the function indexing a source by the keys of the hosts returned by hosts, as the Ingress
+// it is mapped to would be indexed
+func (r *IngressReconciler) indexSourceHosts(hosts func(*unstructured.Unstructured) []string) client.IndexerFunc {
+	return func(obj client.Object) []string {
+		item, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil
+		}
+		ingress := networkingv1.Ingress{}
+		for _, host := range hosts(item) {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{Host: host})
+		}
+		return r.indexRewrittenIngressHosts(&ingress)
+	}
+}
+
+// sourceRequests returns the function listing a reconcile request for each source of the kind matching the list
+// options
+func (r *IngressReconciler) sourceRequests(gvk schema.GroupVersionKind) requestLister {
+	return func(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+		items := &unstructured.UnstructuredList{}
+		items.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, items, opts...); err != nil {
+			log.FromContext(ctx).Error(err, "cannot list sources", "kind", gvk.Kind)
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(items.Items))
+		for i := range items.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&items.Items[i])})
+		}
+		return requests
+	}
+}
+
+// sourceRecorder emits the Events on the Ingress mapped from a source on the source instead
+type sourceRecorder struct {
+	record.EventRecorder
+	source runtime.Object
+}
+
+func (s sourceRecorder) Event(_ runtime.Object, eventType, reason, message string) {
+	s.EventRecorder.Event(s.source, eventType, reason, message)
+}
+
+func (s sourceRecorder) Eventf(_ runtime.Object, eventType, reason, messageFmt string, args ...any) {
+	s.EventRecorder.Eventf(s.source, eventType, reason, messageFmt, args...)
+}
+
+func (s sourceRecorder) AnnotatedEventf(_ runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...any) {
+	s.EventRecorder.AnnotatedEventf(s.source, annotations, eventType, reason, messageFmt, args...)
+}
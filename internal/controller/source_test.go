@@ -0,0 +1,217 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+// sourceTestdataDir contains the golden test cases of the resources of other ingress controllers, which the envtest
+// suite cannot apply without their CRDs
+const sourceTestdataDir = "../../testdata/sources"
+
+// sourceObject returns a resource of another ingress controller with the spec, and a UID unique to its kind and name
+func sourceObject(gvk schema.GroupVersionKind, namespace, name string, spec map[string]any) *unstructured.Unstructured {
+	source := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	source.SetGroupVersionKind(gvk)
+	source.SetNamespace(namespace)
+	source.SetName(name)
+	source.SetUID(types.UID(strings.ToLower(gvk.Kind) + "-" + namespace + "-" + name))
+	return source
+}
+
+// sourceConverter maps a resource of another ingress controller to an Ingress and converts it, like its reconciler
+type sourceConverter struct {
+	ingress   func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error)
+	convert   func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error)
+	reconcile func(r *IngressReconciler) reconcile.Reconciler
+}
+
+var sourceConverters = map[schema.GroupVersionKind]sourceConverter{
+	OpenShiftRouteGVK: {
+		ingress: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error) {
+			return (&OpenShiftRouteReconciler{IngressReconciler: r}).OpenShiftRouteIngress(ctx, source)
+		},
+		convert: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+			httpRoutes, _, err := (&OpenShiftRouteReconciler{IngressReconciler: r}).ConvertOpenShiftRoute(ctx, source, ingress, gateways)
+			return httpRoutes, err
+		},
+		reconcile: func(r *IngressReconciler) reconcile.Reconciler {
+			return &OpenShiftRouteReconciler{IngressReconciler: r}
+		},
+	},
+	TraefikIngressRouteGVK: {
+		ingress: func(_ context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error) {
+			return (&TraefikIngressRouteReconciler{IngressReconciler: r}).TraefikIngressRouteIngress(source)
+		},
+		convert: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+			return (&TraefikIngressRouteReconciler{IngressReconciler: r}).ConvertTraefikIngressRoute(ctx, source, ingress, gateways)
+		},
+		reconcile: func(r *IngressReconciler) reconcile.Reconciler {
+			return &TraefikIngressRouteReconciler{IngressReconciler: r}
+		},
+	},
+	ContourHTTPProxyGVK: {
+		ingress: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error) {
+			return (&ContourHTTPProxyReconciler{IngressReconciler: r}).ContourHTTPProxyIngress(ctx, source)
+		},
+		convert: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+			return (&ContourHTTPProxyReconciler{IngressReconciler: r}).ConvertContourHTTPProxy(ctx, source, ingress, gateways)
+		},
+		reconcile: func(r *IngressReconciler) reconcile.Reconciler {
+			return &ContourHTTPProxyReconciler{IngressReconciler: r}
+		},
+	},
+	IstioVirtualServiceGVK: {
+		ingress: func(_ context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error) {
+			return (&IstioVirtualServiceReconciler{IngressReconciler: r}).IstioVirtualServiceIngress(source)
+		},
+		convert: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+			return (&IstioVirtualServiceReconciler{IngressReconciler: r}).ConvertIstioVirtualService(ctx, source, ingress, gateways)
+		},
+		reconcile: func(r *IngressReconciler) reconcile.Reconciler {
+			return &IstioVirtualServiceReconciler{IngressReconciler: r}
+		},
+	},
+	AmbassadorMappingGVK: {
+		ingress: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured) (networkingv1.Ingress, error) {
+			return (&AmbassadorMappingReconciler{IngressReconciler: r}).AmbassadorMappingIngress(ctx, source)
+		},
+		convert: func(ctx context.Context, r *IngressReconciler, source *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+			return (&AmbassadorMappingReconciler{IngressReconciler: r}).ConvertAmbassadorMapping(ctx, source, ingress, gateways)
+		},
+		reconcile: func(r *IngressReconciler) reconcile.Reconciler {
+			return &AmbassadorMappingReconciler{IngressReconciler: r}
+		},
+	},
+}
+
+// TestSourceGoldenCases converts and reconciles the resources of other ingress controllers of each golden test case
+// with the fake client, and compares the HTTPRoutes with the expected ones
+func TestSourceGoldenCases(t *testing.T) {
+	ctx := context.Background()
+	defaults, err := golden.LoadObjects(filepath.Join(sourceTestdataDir, "..", "default.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := golden.List(sourceTestdataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			testCase, err := golden.Load(sourceTestdataDir, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(testCase.Sources()) == 0 {
+				t.Fatal("input.yaml should contain a resource of another ingress controller")
+			}
+			reconciler := &IngressReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(append(slices.Clone(defaults), testCase.Input...)...).Build(),
+				Scheme:   golden.Scheme,
+				Recorder: record.NewFakeRecorder(100),
+			}
+			if testCase.Options != nil {
+				if err := yaml.Unmarshal(testCase.Options, reconciler); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var gateways gatewayv1.GatewayList
+			if err := reconciler.List(ctx, &gateways); err != nil {
+				t.Fatal(err)
+			}
+			var converted []gatewayv1.HTTPRoute
+			for _, source := range testCase.Sources() {
+				converter, ok := sourceConverters[source.GroupVersionKind()]
+				if !ok {
+					t.Fatalf("no converter for %s", source.GroupVersionKind())
+				}
+				ingress, err := converter.ingress(ctx, reconciler, source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				routes, err := converter.convert(ctx, reconciler, source, ingress, gateways)
+				if err != nil {
+					t.Fatal(err)
+				}
+				converted = append(converted, routes...)
+			}
+
+			if golden.Update() {
+				if err := testCase.WriteOutput(converted); err != nil {
+					t.Fatal(err)
+				}
+				if testCase, err = golden.Load(sourceTestdataDir, name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expectGoldenRoutes(t, testCase, converted)
+
+			for _, source := range testCase.Sources() {
+				r := sourceConverters[source.GroupVersionKind()].reconcile(reconciler)
+				if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(source)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var created gatewayv1.HTTPRouteList
+			if err := reconciler.List(ctx, &created); err != nil {
+				t.Fatal(err)
+			}
+			expectGoldenRoutes(t, testCase, created.Items)
+		})
+	}
+}
+
+// expectGoldenRoutes compares the specs and labels of the HTTPRoutes with the expected ones of the test case
+func expectGoldenRoutes(t *testing.T, testCase *golden.Case, routes []gatewayv1.HTTPRoute) {
+	t.Helper()
+	if len(routes) != len(testCase.Output) {
+		t.Fatalf("expected %d HTTPRoutes, got %d", len(testCase.Output), len(routes))
+	}
+	for _, route := range routes {
+		expected := testCase.Expected(route.Name)
+		if expected == nil {
+			t.Errorf("unexpected HTTPRoute %s", route.Name)
+			continue
+		}
+		if !isEqual(route.Spec, expected.Spec) {
+			t.Errorf("unexpected spec of HTTPRoute %s: %+v", route.Name, route.Spec)
+		}
+		if !isEqual(route.Labels, expected.Labels) {
+			t.Errorf("unexpected labels of HTTPRoute %s: %v", route.Name, route.Labels)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// nginxWhitelistSourceRangeAnnotation is the comma-separated list of CIDRs nginx allows to access the Ingress
+	nginxWhitelistSourceRangeAnnotation = nginxAnnotationPrefix + "whitelist-source-range"
+	// nginxAllowlistSourceRangeAnnotation is the newer name of whitelist-source-range
+	nginxAllowlistSourceRangeAnnotation = nginxAnnotationPrefix + "allowlist-source-range"
+)
+
+// sourceRangeData is passed to the source range policy template
+type sourceRangeData struct {
+	// Route and Namespace are the name and namespace of the HTTPRoute the policy targets
+	Route     string
+	Namespace string
+	// Ingress is the name of the Ingress the HTTPRoute was converted from
+	Ingress string
+	// SourceRanges are the CIDRs allowed to access the HTTPRoute
+	SourceRanges []string
+}
+
+// sourceRanges returns the CIDRs of the allow-list annotation of the Ingress. Single addresses become a CIDR of
+// their own, invalid entries are left out with an Event, which only narrows the allow-list.
+func (r *IngressReconciler) sourceRanges(ingress *networkingv1.Ingress) []string {
+	value := cmp.Or(ingress.Annotations[nginxAllowlistSourceRangeAnnotation], ingress.Annotations[nginxWhitelistSourceRangeAnnotation])
+	var ranges, invalid []string
+	for _, item := range splitList(value) {
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			ranges = append(ranges, network.String())
+		} else if ip := net.ParseIP(item); ip == nil {
+			invalid = append(invalid, item)
+		} else if ip.To4() != nil {
+			ranges = append(ranges, ip.String()+"/32")
+		} else {
+			ranges = append(ranges, ip.String()+"/128")
+		}
+	}
+	if len(invalid) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "InvalidSourceRange",
+			fmt.Sprintf("Source ranges %s are not valid CIDRs or addresses and are left out of the allow-list",
+				strings.Join(invalid, ", ")))
+	}
+	return ranges
+}
+
+// SourceRangePolicies renders the SourceRangePolicyTemplate for each HTTPRoute of an Ingress with an IP allow-list,
+// as the Gateway API has no portable way to restrict the source ranges. The policies are owned like the HTTPRoutes
+// they target. Without a template, an Event is emitted instead, as the allow-list is lost.
+func (r *IngressReconciler) SourceRangePolicies(ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) ([]*unstructured.Unstructured, error) {
+	ranges := r.sourceRanges(&ingress)
+	if len(ranges) == 0 || len(httpRoutes) == 0 {
+		return nil, nil
+	}
+	if r.SourceRangePolicyTemplate == nil {
+		r.event(&ingress, corev1.EventTypeWarning, "UnsupportedSourceRange",
+			fmt.Sprintf("The allow-list of source ranges %s has no Gateway API equivalent, the HTTPRoutes accept "+
+				"requests from any source", strings.Join(ranges, ", ")))
+		return nil, nil
+	}
+
+	return renderPolicies(r.SourceRangePolicyTemplate, httpRoutes, func(httpRoute gatewayv1.HTTPRoute) any {
+		return sourceRangeData{Route: httpRoute.Name, Namespace: httpRoute.Namespace, Ingress: ingress.Name, SourceRanges: ranges}
+	})
+}
+
+// ensureSourceRangePolicies creates or updates the source range policies of the HTTPRoutes of the Ingress
+func (r *IngressReconciler) ensureSourceRangePolicies(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	policies, err := r.SourceRangePolicies(ingress, httpRoutes)
+	if err != nil {
+		return err
+	}
+	return r.ensurePolicies(ctx, ingress, policies)
+}
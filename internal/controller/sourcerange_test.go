@@ -0,0 +1,137 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+const testSourceRangePolicyTemplate = `apiVersion: security.example.com/v1
+kind: AllowList
+metadata:
+  name: "{{ .Route }}-allowlist"
+spec:
+  route: "{{ .Route }}"
+  ingress: "{{ .Ingress }}"
+  priority: 10
+  cidrs:
+{{- range .SourceRanges }}
+  - "{{ . }}"
+{{- end }}
+`
+
+func TestSourceRanges(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		nginxWhitelistSourceRangeAnnotation: "10.0.0.0/8, 192.168.1.7, 2001:db8::1, 10.1.2.3/16, office",
+	}}}
+
+	expected := []string{"10.0.0.0/8", "192.168.1.7/32", "2001:db8::1/128", "10.1.0.0/16"}
+	if ranges := r.sourceRanges(ingress); !isEqual(ranges, expected) {
+		t.Errorf("expected %v, got %v", expected, ranges)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidSourceRange") || !strings.Contains(event, "office") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestSourceRangePolicies(t *testing.T) {
+	ctx := context.Background()
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "default",
+		UID:         "1234",
+		Annotations: map[string]string{nginxAllowlistSourceRangeAnnotation: "10.0.0.0/8"},
+	}}
+	httpRoutes := []gatewayv1.HTTPRoute{{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-example-com",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{createOwnerReference(ingress)},
+	}}}
+
+	// Without a template the allow-list is only reported
+	recorder := record.NewFakeRecorder(10)
+	stored := httpRoutes[0].DeepCopy()
+	stored.UID = "5678"
+	r := &IngressReconciler{Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(stored).Build(), Recorder: recorder}
+	if policies, err := r.SourceRangePolicies(ingress, httpRoutes); err != nil || policies != nil {
+		t.Errorf("expected no policies without a template, got %v, %v", policies, err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedSourceRange") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	r.SourceRangePolicyTemplate = template.Must(template.New("policy").Option("missingkey=error").Parse(testSourceRangePolicyTemplate))
+	if err := r.ensureSourceRangePolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	policy := &unstructured.Unstructured{}
+	policy.SetAPIVersion("security.example.com/v1")
+	policy.SetKind("AllowList")
+	key := client.ObjectKey{Namespace: "default", Name: "app-example-com-allowlist"}
+	if err := r.Get(ctx, key, policy); err != nil {
+		t.Fatal(err)
+	}
+	if cidrs, _, _ := unstructured.NestedStringSlice(policy.Object, "spec", "cidrs"); !isEqual(cidrs, []string{"10.0.0.0/8"}) {
+		t.Errorf("expected the CIDRs of the allow-list, got %v", cidrs)
+	}
+	// The policy is kept when the HTTPRoute is orphaned by a retired Ingress
+	if !isEqual(policy.GetOwnerReferences(), []metav1.OwnerReference{createRouteOwnerReference(*stored)}) {
+		t.Errorf("expected the policy to be owned by the HTTPRoute, got %v", policy.GetOwnerReferences())
+	}
+
+	// A changed allow-list updates the policy
+	ingress.Annotations[nginxAllowlistSourceRangeAnnotation] = "10.0.0.0/8,172.16.0.0/12"
+	if err := r.ensureSourceRangePolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, policy); err != nil {
+		t.Fatal(err)
+	}
+	if cidrs, _, _ := unstructured.NestedStringSlice(policy.Object, "spec", "cidrs"); len(cidrs) != 2 {
+		t.Errorf("expected the policy to be updated, got %v", cidrs)
+	}
+
+	// A policy still owned by the Ingress is handed over to the HTTPRoute
+	policy.SetOwnerReferences([]metav1.OwnerReference{createOwnerReference(ingress)})
+	if err := r.Update(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureSourceRangePolicies(ctx, ingress, httpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, policy); err != nil {
+		t.Fatal(err)
+	}
+	if !isEqual(policy.GetOwnerReferences(), []metav1.OwnerReference{createRouteOwnerReference(*stored)}) {
+		t.Errorf("expected the policy to be handed over to the HTTPRoute, got %v", policy.GetOwnerReferences())
+	}
+}
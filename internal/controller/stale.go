@@ -0,0 +1,143 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// deleteStaleHTTPRoutes deletes the HTTPRoutes of the Ingress that are no longer generated for it, e.g. after one
+// of its hosts was removed or renamed. The garbage collector only deletes them together with the Ingress.
+// Merged HTTPRoutes that are still owned by other Ingresses are only released, those Ingresses then merge them again.
+func (r *IngressReconciler) deleteStaleHTTPRoutes(ctx context.Context, ingress networkingv1.Ingress, httpRoutes []gatewayv1.HTTPRoute) error {
+	var existing gatewayv1.HTTPRouteList
+	if err := r.routeClient().List(ctx, &existing, r.staleRouteListOptions(ingress)...); err != nil {
+		return err
+	}
+
+	routes := make([]client.Object, 0, len(existing.Items))
+	for i := range existing.Items {
+		routes = append(routes, &existing.Items[i])
+	}
+	names := make([]string, 0, len(httpRoutes))
+	for _, httpRoute := range httpRoutes {
+		names = append(names, client.ObjectKeyFromObject(&httpRoute).String())
+	}
+	return r.deleteStaleRoutes(ctx, ingress, "HTTPRoute", routes, names)
+}
+
+// deleteStaleGRPCRoutes deletes the GRPCRoutes of the Ingress that are no longer generated for it,
+// like deleteStaleHTTPRoutes, e.g. after the appProtocol of a backend changed
+func (r *IngressReconciler) deleteStaleGRPCRoutes(ctx context.Context, ingress networkingv1.Ingress, grpcRoutes []gatewayv1.GRPCRoute) error {
+	var existing gatewayv1.GRPCRouteList
+	if err := r.routeClient().List(ctx, &existing, r.staleRouteListOptions(ingress)...); err != nil {
+		return err
+	}
+
+	routes := make([]client.Object, 0, len(existing.Items))
+	for i := range existing.Items {
+		routes = append(routes, &existing.Items[i])
+	}
+	names := make([]string, 0, len(grpcRoutes))
+	for _, grpcRoute := range grpcRoutes {
+		names = append(names, client.ObjectKeyFromObject(&grpcRoute).String())
+	}
+	return r.deleteStaleRoutes(ctx, ingress, "GRPCRoute", routes, names)
+}
+
+// deleteStaleTLSRoutes deletes the TLSRoutes of the Ingress that are no longer generated for it,
+// like deleteStaleHTTPRoutes, e.g. after its ssl-passthrough annotation was removed
+func (r *IngressReconciler) deleteStaleTLSRoutes(ctx context.Context, ingress networkingv1.Ingress, tlsRoutes []gatewayv1alpha2.TLSRoute) error {
+	var existing gatewayv1alpha2.TLSRouteList
+	if err := r.routeClient().List(ctx, &existing, r.staleRouteListOptions(ingress)...); err != nil {
+		return err
+	}
+
+	routes := make([]client.Object, 0, len(existing.Items))
+	for i := range existing.Items {
+		routes = append(routes, &existing.Items[i])
+	}
+	names := make([]string, 0, len(tlsRoutes))
+	for _, tlsRoute := range tlsRoutes {
+		names = append(names, client.ObjectKeyFromObject(&tlsRoute).String())
+	}
+	return r.deleteStaleRoutes(ctx, ingress, "TLSRoute", routes, names)
+}
+
+// staleRouteListOptions lists the routes in the namespace of the Ingress, or in all namespaces if they are
+// created in the namespaces of their Gateways
+func (r *IngressReconciler) staleRouteListOptions(ingress networkingv1.Ingress) []client.ListOption {
+	if r.GatewayNamespaceRoutes {
+		return nil
+	}
+	return []client.ListOption{client.InNamespace(ingress.Namespace)}
+}
+
+// deleteStaleRoutes deletes or releases the routes owned by the Ingress that are not named in desired,
+// as namespace/name
+func (r *IngressReconciler) deleteStaleRoutes(ctx context.Context, ingress networkingv1.Ingress, kind string, routes []client.Object, desired []string) error {
+	logger := log.FromContext(ctx)
+	owner := createOwnerReference(ingress)
+
+	for _, route := range routes {
+		metadata := metav1.ObjectMeta{
+			Namespace:       route.GetNamespace(),
+			Annotations:     route.GetAnnotations(),
+			OwnerReferences: route.GetOwnerReferences(),
+		}
+		owned := r.isOwnedBy(metadata, owner) ||
+			isAnnotatedOwner(metadata.Annotations, ownerGroupKind(owner), ingress.Namespace, ingress.Name)
+		if !owned || slices.Contains(desired, client.ObjectKeyFromObject(route).String()) {
+			continue
+		}
+
+		if r.TargetCluster == nil && len(route.GetOwnerReferences()) > 1 {
+			patch := client.MergeFrom(route.DeepCopyObject().(client.Object))
+			route.SetOwnerReferences(slices.DeleteFunc(route.GetOwnerReferences(), func(reference metav1.OwnerReference) bool {
+				return reference.APIVersion == owner.APIVersion && reference.Kind == owner.Kind && reference.Name == owner.Name
+			}))
+			if err := r.routeClient().Patch(ctx, route, patch); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			logger.Info("released stale "+kind, "name", client.ObjectKeyFromObject(route))
+			continue
+		}
+		patch := client.MergeFrom(route.DeepCopyObject().(client.Object))
+		if releaseAnnotatedOwner(route, ownerGroupKind(owner), ingress.Namespace, ingress.Name) {
+			if err := r.routeClient().Patch(ctx, route, patch); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			logger.Info("released stale "+kind, "name", client.ObjectKeyFromObject(route))
+			continue
+		}
+
+		if err := r.routeClient().Delete(ctx, route); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		logger.Info("deleted stale "+kind, "name", client.ObjectKeyFromObject(route))
+	}
+	return nil
+}
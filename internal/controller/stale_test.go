@@ -0,0 +1,198 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+var _ = Describe("Stale HTTPRoutes", func() {
+	const namespace = "stale-namespace"
+
+	var (
+		gateway   *gatewayv1.Gateway
+		ingresses []*networkingv1.Ingress
+	)
+
+	newIngress := func(name string, hosts ...string) *networkingv1.Ingress {
+		pathType := networkingv1.PathTypePrefix
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		for _, host := range hosts {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/" + name,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: name + "-service",
+							Port: networkingv1.ServiceBackendPort{Number: 80},
+						}},
+					}},
+				}},
+			})
+		}
+		return ingress
+	}
+
+	reconcileIngresses := func(reconciler *IngressReconciler) {
+		for _, ingress := range ingresses {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	routeNames := func() []string {
+		var httpRoutes gatewayv1.HTTPRouteList
+		Expect(k8sClient.List(ctx, &httpRoutes, ctrlclient.InNamespace(namespace))).To(Succeed())
+		var names []string
+		for _, httpRoute := range httpRoutes.Items {
+			names = append(names, httpRoute.Name)
+		}
+		return names
+	}
+
+	removeHost := func(ingress *networkingv1.Ingress) {
+		Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		ingress.Spec.Rules = ingress.Spec.Rules[:1]
+		Expect(k8sClient.Update(ctx, ingress)).To(Succeed())
+	}
+
+	annotate := func(ingress *networkingv1.Ingress, key string) {
+		Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		metav1.SetMetaDataAnnotation(&ingress.ObjectMeta, key, "true")
+		Expect(k8sClient.Update(ctx, ingress)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		Expect(ctrlclient.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).To(Succeed())
+
+		hostname := gatewayv1.Hostname("*.stale.example.com")
+		gateway = &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "stale-gw", Namespace: namespace},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "test-class",
+				Listeners: []gatewayv1.Listener{{
+					Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80, Hostname: &hostname,
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, gateway)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, ingress := range ingresses {
+			Expect(k8sClient.Delete(ctx, ingress)).To(Succeed())
+		}
+		Expect(k8sClient.Delete(ctx, gateway)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &gatewayv1.HTTPRoute{}, ctrlclient.InNamespace(namespace))).To(Succeed())
+	})
+
+	It("deletes the HTTPRoute of a removed host", func() {
+		ingresses = []*networkingv1.Ingress{newIngress("app", "a.stale.example.com", "b.stale.example.com")}
+		Expect(k8sClient.Create(ctx, ingresses[0])).To(Succeed())
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com"))
+
+		removeHost(ingresses[0])
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com"))
+	})
+
+	It("keeps the HTTPRoute of a host that cannot be converted", func() {
+		ingresses = []*networkingv1.Ingress{newIngress("app", "a.stale.example.com", "b.stale.example.com")}
+		Expect(k8sClient.Create(ctx, ingresses[0])).To(Succeed())
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com"))
+
+		// The named port of b cannot be resolved without its Service, c is still converted
+		ingress := ingresses[0]
+		Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(ingress), ingress)).To(Succeed())
+		ingress.Spec.Rules[1].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, newIngress("app", "c.stale.example.com").Spec.Rules...)
+		Expect(k8sClient.Update(ctx, ingress)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(ingress)})
+		Expect(err).To(MatchError(ContainSubstring(`hostname "b.stale.example.com"`)))
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com", "app-c-stale-example-com"))
+	})
+
+	It("deletes the HTTPRoutes of a skipped Ingress", func() {
+		ingresses = []*networkingv1.Ingress{newIngress("app", "a.stale.example.com", "b.stale.example.com")}
+		Expect(k8sClient.Create(ctx, ingresses[0])).To(Succeed())
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com"))
+
+		annotate(ingresses[0], skipAnnotation)
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(BeEmpty())
+	})
+
+	It("keeps the HTTPRoutes of a paused Ingress", func() {
+		ingresses = []*networkingv1.Ingress{newIngress("app", "a.stale.example.com", "b.stale.example.com")}
+		Expect(k8sClient.Create(ctx, ingresses[0])).To(Succeed())
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com"))
+
+		annotate(ingresses[0], pauseAnnotation)
+		removeHost(ingresses[0])
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("app-a-stale-example-com", "app-b-stale-example-com"))
+	})
+
+	It("releases a merged HTTPRoute still owned by other Ingresses", func() {
+		ingresses = []*networkingv1.Ingress{
+			newIngress("web", "a.stale.example.com", "shared.stale.example.com"),
+			newIngress("api", "shared.stale.example.com"),
+		}
+		for _, ingress := range ingresses {
+			Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+		}
+		reconciler := &IngressReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), MergeHosts: true}
+
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("a-stale-example-com", "shared-stale-example-com"))
+
+		// web keeps only a.stale.example.com, api takes over the shared HTTPRoute
+		removeHost(ingresses[0])
+		reconcileIngresses(reconciler)
+		Expect(routeNames()).To(ConsistOf("a-stale-example-com", "shared-stale-example-com"))
+
+		shared := gatewayv1.HTTPRoute{}
+		Expect(k8sClient.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: "shared-stale-example-com"}, &shared)).To(Succeed())
+		Expect(shared.OwnerReferences).To(HaveLen(1))
+		Expect(shared.OwnerReferences[0].Name).To(Equal("api"))
+		Expect(shared.Spec.Rules).To(HaveLen(1))
+		Expect(shared.Spec.Rules[0].BackendRefs[0].Name).To(BeEquivalentTo("api-service"))
+	})
+})
@@ -0,0 +1,422 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// streamServicesLabel marks the TCPRoutes and UDPRoutes converted from a tcp-services or udp-services ConfigMap,
+// with the protocol as value, so the stale ones can be found in all namespaces
+const streamServicesLabel = "ingress2httproute.lion7.dev/stream-services"
+
+// streamService is an entry of a tcp-services or udp-services ConfigMap, exposing a Service port on a port of the
+// Ingress controller
+type streamService struct {
+	// Port is the port of the Ingress controller, and of the listeners the route attaches to
+	Port gatewayv1.PortNumber
+	// Namespace, Name and ServicePort are the Service port, ServicePort is a number or a port name
+	Namespace   string
+	Name        string
+	ServicePort string
+	// ProxyProtocol is true if the PROXY protocol is decoded or encoded for the Service
+	ProxyProtocol bool
+}
+
+// StreamServicesReconciler converts the tcp-services and udp-services ConfigMaps of ingress-nginx, whose
+// `port: namespace/service:port` entries expose Services on ports of the Ingress controller, to TCPRoutes and
+// UDPRoutes attached to the TCP and UDP listeners of the Gateways on those ports. The routes are created in the
+// namespaces of their Services, and record the ConfigMap in their owner annotation.
+type StreamServicesReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// TCPServices and UDPServices are the ConfigMaps to convert, a ConfigMap without a name is not converted
+	TCPServices types.NamespacedName
+	UDPServices types.NamespacedName
+	// GatewayClasses limits the Gateways the routes attach to, to those of these GatewayClasses if set
+	GatewayClasses []gatewayv1.ObjectName
+	audit.Auditor
+	// Recorder emits Events on the ConfigMaps, no Events are emitted if unset
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=tcproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=udproutes,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile converts the entries of a tcp-services or udp-services ConfigMap to routes, and deletes the routes of
+// the entries that were removed, or of all entries if the ConfigMap was deleted
+func (r *StreamServicesReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	protocol, ok := r.protocol(req.NamespacedName)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	ctx = audit.WithReason(ctx, audit.ReasonStreamServicesExposed)
+
+	configMap := corev1.ConfigMap{}
+	if err := r.Get(ctx, req.NamespacedName, &configMap); err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	var gateways gatewayv1.GatewayList
+	if err := r.List(ctx, &gateways); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var desired []client.Object
+	for _, service := range r.streamServices(&configMap, protocol) {
+		route, err := r.createRoute(ctx, &configMap, protocol, service, gateways)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if route == nil {
+			continue
+		}
+		if err := r.reconcileRoute(ctx, route); err != nil {
+			return ctrl.Result{}, err
+		}
+		desired = append(desired, route)
+	}
+
+	// Without Gateways nothing is generated, keep the routes until they are back
+	if len(gateways.Items) == 0 {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.deleteStaleRoutes(ctx, req.NamespacedName, protocol, desired)
+}
+
+// protocol returns the protocol of the routes of the ConfigMap, and false if it is not converted
+func (r *StreamServicesReconciler) protocol(name types.NamespacedName) (gatewayv1.ProtocolType, bool) {
+	switch {
+	case r.TCPServices.Name != "" && name == r.TCPServices:
+		return gatewayv1.TCPProtocolType, true
+	case r.UDPServices.Name != "" && name == r.UDPServices:
+		return gatewayv1.UDPProtocolType, true
+	default:
+		return "", false
+	}
+}
+
+// streamServices returns the entries of the ConfigMap sorted by port. Invalid entries are left out with an Event.
+func (r *StreamServicesReconciler) streamServices(configMap *corev1.ConfigMap, protocol gatewayv1.ProtocolType) []streamService {
+	var result []streamService
+	var invalid []string
+	for key, value := range configMap.Data {
+		service, ok := parseStreamService(key, value, protocol)
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf("%s: %q", key, value))
+			continue
+		}
+		result = append(result, service)
+	}
+	if len(invalid) > 0 {
+		slices.Sort(invalid)
+		r.event(configMap, corev1.EventTypeWarning, "InvalidStreamService",
+			fmt.Sprintf("Entries %s are not a port with a namespace/service:port value and are not converted",
+				strings.Join(invalid, ", ")))
+	}
+	slices.SortFunc(result, func(a, b streamService) int {
+		return int(a.Port) - int(b.Port)
+	})
+	return result
+}
+
+// parseStreamService parses an entry of a tcp-services or udp-services ConfigMap. The PROXY protocol flags of
+// ingress-nginx are only accepted for TCP.
+func parseStreamService(key, value string, protocol gatewayv1.ProtocolType) (streamService, bool) {
+	port, err := strconv.Atoi(key)
+	if err != nil || port < 1 || port > 65535 {
+		return streamService{}, false
+	}
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	namespace, name, found := strings.Cut(parts[0], "/")
+	if !found || namespace == "" || name == "" || len(parts) < 2 || parts[1] == "" {
+		return streamService{}, false
+	}
+	service := streamService{Port: gatewayv1.PortNumber(port), Namespace: namespace, Name: name, ServicePort: parts[1]}
+	for _, flag := range parts[2:] {
+		switch {
+		case flag == "PROXY" && protocol == gatewayv1.TCPProtocolType:
+			service.ProxyProtocol = true
+		case flag == "":
+		default:
+			return streamService{}, false
+		}
+	}
+	return service, true
+}
+
+// createRoute returns the TCPRoute or UDPRoute of an entry of the ConfigMap, attached to the listeners of the
+// protocol on the port of the entry, or nil if there are none or its Service port cannot be found
+func (r *StreamServicesReconciler) createRoute(ctx context.Context, configMap *corev1.ConfigMap, protocol gatewayv1.ProtocolType, service streamService, gateways gatewayv1.GatewayList) (client.Object, error) {
+	port, ok, err := r.servicePort(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		r.event(configMap, corev1.EventTypeWarning, "InvalidStreamService",
+			fmt.Sprintf("Service %s/%s of port %d has no port %s, it is not converted",
+				service.Namespace, service.Name, service.Port, service.ServicePort))
+		return nil, nil
+	}
+	if service.ProxyProtocol {
+		r.event(configMap, corev1.EventTypeWarning, "UnsupportedProxyProtocol",
+			fmt.Sprintf("The PROXY protocol of port %d has no Gateway API equivalent, it must be configured on the "+
+				"Gateway", service.Port))
+	}
+
+	namespace := corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: service.Namespace}, &namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		namespace.Name = service.Namespace
+		namespace.Labels = map[string]string{corev1.LabelMetadataName: service.Namespace}
+	}
+	parentRefs := r.streamParentRefs(namespace, protocol, service.Port, gateways)
+	if len(parentRefs) == 0 {
+		r.event(configMap, corev1.EventTypeWarning, "NoMatchingListener",
+			fmt.Sprintf("No Gateway %s listener on port %d accepts routes from namespace %s",
+				protocol, service.Port, service.Namespace))
+		return nil, nil
+	}
+
+	backendRefs := []gatewayv1.BackendRef{{
+		BackendObjectReference: gatewayv1.BackendObjectReference{
+			Group: ptr.To(gatewayv1.Group("")),
+			Kind:  ptr.To(gatewayv1.Kind("Service")),
+			Name:  gatewayv1.ObjectName(service.Name),
+			Port:  ptr.To(port),
+		},
+		Weight: ptr.To(int32(1)),
+	}}
+	metadata := metav1.ObjectMeta{
+		Name:        truncateName(fmt.Sprintf("%s-%s-%d", service.Name, strings.ToLower(string(protocol)), service.Port)),
+		Namespace:   service.Namespace,
+		Labels:      map[string]string{streamServicesLabel: strings.ToLower(string(protocol))},
+		Annotations: map[string]string{ownerAnnotation: ownerAnnotationValue(configMapGroupKind, configMap.Namespace, configMap.Name)},
+	}
+	if protocol == gatewayv1.TCPProtocolType {
+		return &gatewayv1alpha2.TCPRoute{
+			TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1alpha2.GroupVersion.String(), Kind: "TCPRoute"},
+			ObjectMeta: metadata,
+			Spec: gatewayv1alpha2.TCPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: parentRefs},
+				Rules:           []gatewayv1alpha2.TCPRouteRule{{BackendRefs: backendRefs}},
+			},
+		}, nil
+	}
+	return &gatewayv1alpha2.UDPRoute{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1alpha2.GroupVersion.String(), Kind: "UDPRoute"},
+		ObjectMeta: metadata,
+		Spec: gatewayv1alpha2.UDPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: parentRefs},
+			Rules:           []gatewayv1alpha2.UDPRouteRule{{BackendRefs: backendRefs}},
+		},
+	}, nil
+}
+
+// servicePort returns the port number of the Service port of the entry, which ingress-nginx also resolves by name
+func (r *StreamServicesReconciler) servicePort(ctx context.Context, service streamService) (gatewayv1.PortNumber, bool, error) {
+	if port, err := strconv.Atoi(service.ServicePort); err == nil {
+		return gatewayv1.PortNumber(port), port > 0 && port <= 65535, nil
+	}
+	svc := corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, &svc); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	for _, port := range svc.Spec.Ports {
+		if port.Name == service.ServicePort {
+			return gatewayv1.PortNumber(port.Port), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// streamParentRefs returns the parent refs of the listeners of the protocol on the port that accept routes from
+// the namespace
+func (r *StreamServicesReconciler) streamParentRefs(namespace corev1.Namespace, protocol gatewayv1.ProtocolType, port gatewayv1.PortNumber, gateways gatewayv1.GatewayList) []gatewayv1.ParentReference {
+	var result []gatewayv1.ParentReference
+	for _, gateway := range gateways.Items {
+		if len(r.GatewayClasses) > 0 && !slices.Contains(r.GatewayClasses, gateway.Spec.GatewayClassName) {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Protocol != protocol || listener.Port != port ||
+				!isListenerAccessibleFromNamespace(listener, gateway.Namespace, namespace) {
+				continue
+			}
+			result = append(result, createParentRef(gateway, listener))
+		}
+	}
+	slices.SortStableFunc(result, compareParentRef)
+	return result
+}
+
+// reconcileRoute creates or updates a TCPRoute or UDPRoute. A route with the name that is not owned by the
+// ConfigMap is left alone.
+func (r *StreamServicesReconciler) reconcileRoute(ctx context.Context, desired client.Object) error {
+	logger := log.FromContext(ctx)
+	kind := desired.GetObjectKind().GroupVersionKind().Kind
+	name := client.ObjectKeyFromObject(desired)
+
+	var existing client.Object = &gatewayv1alpha2.UDPRoute{}
+	if _, ok := desired.(*gatewayv1alpha2.TCPRoute); ok {
+		existing = &gatewayv1alpha2.TCPRoute{}
+	}
+	if err := r.Audited(r.Client).Get(ctx, name, existing); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := r.Audited(r.Client).Create(ctx, desired); err != nil {
+			return err
+		}
+		logger.Info("created "+kind, "name", name)
+		return nil
+	}
+
+	if _, owner, _ := parseOwnerAnnotation(desired.GetAnnotations()); !isAnnotatedOwner(existing.GetAnnotations(), configMapGroupKind, owner.Namespace, owner.Name) {
+		logger.Info(kind+" belongs to another owner", "name", name)
+		return nil
+	}
+	if isEqual(streamRouteSpec(existing), streamRouteSpec(desired)) &&
+		hasLabels(metav1.ObjectMeta{Labels: existing.GetLabels()}, desired.GetLabels()) {
+		return nil
+	}
+
+	desired.SetResourceVersion(existing.GetResourceVersion())
+	if err := r.Audited(r.Client).Update(ctx, desired); err != nil {
+		return err
+	}
+	logger.Info("updated "+kind, "name", name)
+	return nil
+}
+
+// streamRouteSpec returns the spec of a TCPRoute or UDPRoute
+func streamRouteSpec(route client.Object) any {
+	switch route := route.(type) {
+	case *gatewayv1alpha2.TCPRoute:
+		return route.Spec
+	case *gatewayv1alpha2.UDPRoute:
+		return route.Spec
+	default:
+		return nil
+	}
+}
+
+// deleteStaleRoutes deletes the routes of the protocol owned by the ConfigMap that are not desired
+func (r *StreamServicesReconciler) deleteStaleRoutes(ctx context.Context, configMap types.NamespacedName, protocol gatewayv1.ProtocolType, desired []client.Object) error {
+	logger := log.FromContext(ctx)
+	var routes []client.Object
+	selector := client.MatchingLabels{streamServicesLabel: strings.ToLower(string(protocol))}
+	if protocol == gatewayv1.TCPProtocolType {
+		var existing gatewayv1alpha2.TCPRouteList
+		if err := r.List(ctx, &existing, selector); err != nil {
+			return err
+		}
+		for i := range existing.Items {
+			routes = append(routes, &existing.Items[i])
+		}
+	} else {
+		var existing gatewayv1alpha2.UDPRouteList
+		if err := r.List(ctx, &existing, selector); err != nil {
+			return err
+		}
+		for i := range existing.Items {
+			routes = append(routes, &existing.Items[i])
+		}
+	}
+
+	for _, route := range routes {
+		if !isAnnotatedOwner(route.GetAnnotations(), configMapGroupKind, configMap.Namespace, configMap.Name) {
+			continue
+		}
+		if slices.ContainsFunc(desired, func(obj client.Object) bool {
+			return client.ObjectKeyFromObject(obj) == client.ObjectKeyFromObject(route)
+		}) {
+			continue
+		}
+		if err := r.Audited(r.Client).Delete(ctx, route); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		logger.Info("deleted stale route", "name", client.ObjectKeyFromObject(route))
+	}
+	return nil
+}
+
+// event emits an Event on the ConfigMap, if a recorder is set
+func (r *StreamServicesReconciler) event(object runtime.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StreamServicesReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every Gateway change may add or remove a listener on a port of the ConfigMaps
+	enqueueConfigMaps := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		var requests []reconcile.Request
+		for _, name := range []types.NamespacedName{r.TCPServices, r.UDPServices} {
+			if name.Name != "" {
+				requests = append(requests, reconcile.Request{NamespacedName: name})
+			}
+		}
+		return requests
+	})
+	isConfigMap := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		_, ok := r.protocol(client.ObjectKeyFromObject(obj))
+		return ok
+	})
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("streamservices").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(isConfigMap)).
+		Watches(&gatewayv1.Gateway{}, enqueueConfigMaps)
+	// The routes of a protocol are only watched when converted, so their CRD is not required otherwise
+	if r.TCPServices.Name != "" {
+		b = b.Watches(&gatewayv1alpha2.TCPRoute{}, handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(configMapGroupKind)))
+	}
+	if r.UDPServices.Name != "" {
+		b = b.Watches(&gatewayv1alpha2.UDPRoute{}, handler.EnqueueRequestsFromMapFunc(enqueueAnnotatedOwner(configMapGroupKind)))
+	}
+	return b.Complete(r)
+}
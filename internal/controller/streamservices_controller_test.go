@@ -0,0 +1,126 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestParseStreamService(t *testing.T) {
+	tests := []struct {
+		key, value string
+		protocol   gatewayv1.ProtocolType
+		expected   streamService
+		valid      bool
+	}{
+		{key: "9000", value: "default/db:5432", protocol: gatewayv1.TCPProtocolType, valid: true,
+			expected: streamService{Port: 9000, Namespace: "default", Name: "db", ServicePort: "5432"}},
+		{key: "9001", value: "default/db:postgres:PROXY", protocol: gatewayv1.TCPProtocolType, valid: true,
+			expected: streamService{Port: 9001, Namespace: "default", Name: "db", ServicePort: "postgres", ProxyProtocol: true}},
+		{key: "9002", value: "default/db:5432::PROXY", protocol: gatewayv1.TCPProtocolType, valid: true,
+			expected: streamService{Port: 9002, Namespace: "default", Name: "db", ServicePort: "5432", ProxyProtocol: true}},
+		{key: "53", value: "kube-system/dns:53:PROXY", protocol: gatewayv1.UDPProtocolType},
+		{key: "http", value: "default/db:5432", protocol: gatewayv1.TCPProtocolType},
+		{key: "70000", value: "default/db:5432", protocol: gatewayv1.TCPProtocolType},
+		{key: "9000", value: "db:5432", protocol: gatewayv1.TCPProtocolType},
+		{key: "9000", value: "default/db", protocol: gatewayv1.TCPProtocolType},
+	}
+	for _, tt := range tests {
+		service, ok := parseStreamService(tt.key, tt.value, tt.protocol)
+		if ok != tt.valid || ok && service != tt.expected {
+			t.Errorf("%s: %s: unexpected service %+v, %v", tt.key, tt.value, service, ok)
+		}
+	}
+}
+
+func TestStreamServicesReconcile(t *testing.T) {
+	ctx := context.Background()
+	tcpServices := types.NamespacedName{Namespace: "ingress-nginx", Name: "tcp-services"}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: tcpServices.Namespace, Name: tcpServices.Name},
+		Data:       map[string]string{"9000": "default/db:5432", "9001": "default/cache:6379", "invalid": "x"},
+	}
+	gateway := &gatewayv1.Gateway{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewayv1.GroupVersion.String(), Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "db", Protocol: gatewayv1.TCPProtocolType, Port: 9000},
+			{Name: "dns", Protocol: gatewayv1.UDPProtocolType, Port: 9001},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(configMap, gateway).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &StreamServicesReconciler{Client: c, TCPServices: tcpServices, Recorder: recorder}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: tcpServices}); err != nil {
+		t.Fatal(err)
+	}
+	var tcpRoutes gatewayv1alpha2.TCPRouteList
+	if err := c.List(ctx, &tcpRoutes); err != nil {
+		t.Fatal(err)
+	}
+	expected := gatewayv1alpha2.TCPRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{
+			Group: ptr.To(gatewayv1.Group(gatewayv1.GroupName)), Kind: ptr.To(gatewayv1.Kind("Gateway")),
+			Namespace: ptr.To(gatewayv1.Namespace("default")), Name: "gw", SectionName: ptr.To(gatewayv1.SectionName("db")),
+		}}},
+		Rules: []gatewayv1alpha2.TCPRouteRule{{BackendRefs: []gatewayv1.BackendRef{{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Group: ptr.To(gatewayv1.Group("")), Kind: ptr.To(gatewayv1.Kind("Service")),
+				Name: "db", Port: ptr.To(gatewayv1.PortNumber(5432)),
+			},
+			Weight: ptr.To(int32(1)),
+		}}}},
+	}
+	if len(tcpRoutes.Items) != 1 || tcpRoutes.Items[0].Name != "db-tcp-9000" || !isEqual(tcpRoutes.Items[0].Spec, expected) ||
+		tcpRoutes.Items[0].Annotations[ownerAnnotation] != "ConfigMap/ingress-nginx/tcp-services" {
+		t.Fatalf("unexpected TCPRoutes: %+v", tcpRoutes.Items)
+	}
+	for _, reason := range []string{"InvalidStreamService", "NoMatchingListener"} {
+		if event := <-recorder.Events; !strings.Contains(event, reason) {
+			t.Errorf("expected %s event, got %s", reason, event)
+		}
+	}
+
+	// The route of a removed entry is deleted
+	configMap.Data = map[string]string{}
+	if err := c.Update(ctx, configMap); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: tcpServices}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "db-tcp-9000"}, &gatewayv1alpha2.TCPRoute{})
+	if err == nil {
+		t.Error("expected the stale TCPRoute to be deleted")
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// redirectRouteSuffix is appended to the name of the HTTPRoute redirecting the HTTP listeners of a TLS host
+const redirectRouteSuffix = "-redirect"
+
+// findTLSSecret returns the name of the Secret the Ingress uses for the hostname, and whether the hostname
+// is listed under spec.tls at all. The name is empty if the Ingress controller's default certificate is used.
+func findTLSSecret(ingress networkingv1.Ingress, hostname string) (string, bool) {
+	if hostname == "" {
+		return "", false
+	}
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			if hostnamesIntersect(hostname, host) {
+				return tls.SecretName, true
+			}
+		}
+	}
+	return "", false
+}
+
+// selectTLSListeners splits the parent refs of a TLS host into the HTTPS listeners to attach to and the HTTP
+// listeners to redirect. HTTPS listeners with a certificateRef to the Secret of the Ingress are preferred, as
+// their certificate is known to cover the host; otherwise all HTTPS listeners matching the host are used.
+func selectTLSListeners(parentRefs []gatewayv1.ParentReference, gateways gatewayv1.GatewayList, ingressNamespace, secretName string) (https, http []gatewayv1.ParentReference) {
+	var covering []gatewayv1.ParentReference
+	for _, parentRef := range parentRefs {
+		gateway, listener, ok := findListener(parentRef, gateways)
+		if !ok {
+			continue
+		}
+		switch listener.Protocol {
+		case gatewayv1.HTTPSProtocolType:
+			https = append(https, parentRef)
+			if secretName != "" && hasCertificateRef(listener, gateway.Namespace, ingressNamespace, secretName) {
+				covering = append(covering, parentRef)
+			}
+		case gatewayv1.HTTPProtocolType:
+			http = append(http, parentRef)
+		}
+	}
+	if len(covering) > 0 {
+		https = covering
+	}
+	return https, http
+}
+
+// findListener returns the Gateway and listener the parent ref with a section name refers to
+func findListener(parentRef gatewayv1.ParentReference, gateways gatewayv1.GatewayList) (gatewayv1.Gateway, gatewayv1.Listener, bool) {
+	if parentRef.SectionName == nil {
+		return gatewayv1.Gateway{}, gatewayv1.Listener{}, false
+	}
+	for _, gateway := range gateways.Items {
+		if !isParentRefForGateway(parentRef, gateway) {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Name == *parentRef.SectionName {
+				return gateway, listener, true
+			}
+		}
+	}
+	return gatewayv1.Gateway{}, gatewayv1.Listener{}, false
+}
+
+// hasCertificateRef returns true if the listener terminates TLS with the Secret in the namespace of the Ingress
+func hasCertificateRef(listener gatewayv1.Listener, gatewayNamespace, ingressNamespace, secretName string) bool {
+	if listener.TLS == nil {
+		return false
+	}
+	for _, ref := range listener.TLS.CertificateRefs {
+		if ptr.Deref(ref.Group, "") != "" || ptr.Deref(ref.Kind, "Secret") != "Secret" {
+			continue
+		}
+		namespace := string(ptr.Deref(ref.Namespace, gatewayv1.Namespace(gatewayNamespace)))
+		if namespace == ingressNamespace && string(ref.Name) == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// createRedirectSpec returns the spec of a HTTPRoute that redirects all requests for the hostnames to HTTPS
+func createRedirectSpec(parentRefs []gatewayv1.ParentReference, hostnames []gatewayv1.Hostname) gatewayv1.HTTPRouteSpec {
+	return gatewayv1.HTTPRouteSpec{
+		CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: parentRefs},
+		Hostnames:       hostnames,
+		Rules: []gatewayv1.HTTPRouteRule{{
+			// The match the API server would default to, so the spec does not change when it is created
+			Matches: []gatewayv1.HTTPRouteMatch{{Path: &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+				Value: ptr.To("/"),
+			}}},
+			Filters: []gatewayv1.HTTPRouteFilter{{
+				Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+				RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+					Scheme:     ptr.To("https"),
+					StatusCode: ptr.To(301),
+				},
+			}},
+		}},
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// traefikAnnotationPrefix is the prefix of the annotations of the Traefik Ingress provider
+	traefikAnnotationPrefix = "traefik.ingress.kubernetes.io/"
+	// traefikEntryPointsAnnotation is the comma-separated list of entry points the routers of the Ingress listen on
+	traefikEntryPointsAnnotation = traefikAnnotationPrefix + "router.entrypoints"
+	// traefikPriorityAnnotation overrides the priority of the routers, which is the length of their rule by default
+	traefikPriorityAnnotation = traefikAnnotationPrefix + "router.priority"
+	// traefikMiddlewaresAnnotation is the comma-separated list of middlewares applied to the requests, each as
+	// <namespace>-<name>@<provider>
+	traefikMiddlewaresAnnotation = traefikAnnotationPrefix + "router.middlewares"
+	// traefikPathMatcherAnnotation is the matcher of the ImplementationSpecific paths, PathPrefix by default
+	traefikPathMatcherAnnotation = traefikAnnotationPrefix + "router.pathmatcher"
+
+	// traefikMiddlewareGroup is the API group of the Middleware resources of Traefik
+	traefikMiddlewareGroup = "traefik.io"
+	// traefikCRDProvider is the provider of the Middleware resources
+	traefikCRDProvider = "kubernetescrd"
+)
+
+// traefikPathMatchers maps the matchers of the pathmatcher annotation to the path type policies
+var traefikPathMatchers = map[string]PathTypePolicy{
+	"Path":       PathTypeExact,
+	"PathPrefix": PathTypePrefix,
+	"PathRegexp": PathTypeRegex,
+}
+
+// traefikPathType returns the path type policy of the pathmatcher annotation of the Ingress, and false if it has
+// none. An unknown matcher is ignored with an Event.
+func (r *IngressReconciler) traefikPathType(ingress *networkingv1.Ingress) (PathTypePolicy, bool) {
+	matcher, ok := ingress.Annotations[traefikPathMatcherAnnotation]
+	if !ok {
+		return "", false
+	}
+	policy, ok := traefikPathMatchers[matcher]
+	if !ok {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedPathMatcher",
+			fmt.Sprintf("Path matcher %q is not Path, PathPrefix or PathRegexp and is ignored", matcher))
+	}
+	return policy, ok
+}
+
+// traefikEntryPointParentRefs returns the parentRefs of the listeners named after the entry points of the Ingress,
+// as entry points are the listeners of Traefik. Without such listeners, all parentRefs are returned with an Event.
+func (r *IngressReconciler) traefikEntryPointParentRefs(ingress *networkingv1.Ingress, parentRefs []gatewayv1.ParentReference) []gatewayv1.ParentReference {
+	entryPoints := splitList(ingress.Annotations[traefikEntryPointsAnnotation])
+	if len(entryPoints) == 0 || len(parentRefs) == 0 {
+		return parentRefs
+	}
+
+	var result []gatewayv1.ParentReference
+	for _, parentRef := range parentRefs {
+		if parentRef.SectionName != nil && slices.Contains(entryPoints, string(*parentRef.SectionName)) {
+			result = append(result, parentRef)
+		}
+	}
+	if len(result) == 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedEntryPoints",
+			fmt.Sprintf("No matching Gateway listener is named after the entry points %s, the HTTPRoutes attach to "+
+				"all matching listeners", strings.Join(entryPoints, ", ")))
+		return parentRefs
+	}
+	return result
+}
+
+// traefikMiddlewareFilters returns an ExtensionRef filter for each middleware of the Ingress that is a Middleware
+// resource in its namespace, with TraefikMiddlewareFilters, as the Gateway provider of Traefik accepts them. Other
+// middlewares, e.g. of the file provider or in another namespace, are reported with an Event, as are all middlewares
+// without TraefikMiddlewareFilters.
+func (r *IngressReconciler) traefikMiddlewareFilters(ingress *networkingv1.Ingress) []gatewayv1.HTTPRouteFilter {
+	var filters []gatewayv1.HTTPRouteFilter
+	var unsupported []string
+	for _, middleware := range splitList(ingress.Annotations[traefikMiddlewaresAnnotation]) {
+		reference, provider, _ := strings.Cut(middleware, "@")
+		name, local := strings.CutPrefix(reference, ingress.Namespace+"-")
+		if !r.TraefikMiddlewareFilters || provider != traefikCRDProvider || !local || name == "" {
+			unsupported = append(unsupported, middleware)
+			continue
+		}
+		filters = append(filters, traefikMiddlewareFilter(name))
+	}
+	if len(unsupported) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedMiddlewares",
+			fmt.Sprintf("Middlewares %s cannot be referenced by the HTTPRoutes, the requests are not processed by them",
+				strings.Join(unsupported, ", ")))
+	}
+	return filters
+}
+
+// traefikMiddlewareFilter returns the ExtensionRef filter referencing the Middleware resource in the namespace of the
+// HTTPRoute
+func traefikMiddlewareFilter(name string) gatewayv1.HTTPRouteFilter {
+	return gatewayv1.HTTPRouteFilter{
+		Type: gatewayv1.HTTPRouteFilterExtensionRef,
+		ExtensionRef: &gatewayv1.LocalObjectReference{
+			Group: traefikMiddlewareGroup,
+			Kind:  "Middleware",
+			Name:  gatewayv1.ObjectName(name),
+		},
+	}
+}
+
+// warnTraefikPriority emits an Event for the router priority of the Ingress, as the rules of HTTPRoutes are ordered
+// by the precedence of the Gateway API instead
+func (r *IngressReconciler) warnTraefikPriority(ingress *networkingv1.Ingress) {
+	if priority, ok := ingress.Annotations[traefikPriorityAnnotation]; ok {
+		r.event(ingress, corev1.EventTypeWarning, "UnsupportedPriority",
+			fmt.Sprintf("Router priority %s has no Gateway API equivalent, the rules are ordered by the precedence "+
+				"of their matches", priority))
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestTraefikEntryPointParentRefs(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	parentRefs := []gatewayv1.ParentReference{
+		{Name: "gateway", SectionName: ptr.To(gatewayv1.SectionName("web"))},
+		{Name: "gateway", SectionName: ptr.To(gatewayv1.SectionName("websecure"))},
+		{Name: "other"},
+	}
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		traefikEntryPointsAnnotation: "websecure, metrics",
+	}}}
+	if result := r.traefikEntryPointParentRefs(ingress, parentRefs); !isEqual(result, parentRefs[1:2]) {
+		t.Errorf("unexpected parentRefs: %v", result)
+	}
+
+	// Without a matching listener, the HTTPRoutes attach to all listeners
+	ingress.Annotations[traefikEntryPointsAnnotation] = "metrics"
+	if result := r.traefikEntryPointParentRefs(ingress, parentRefs); !isEqual(result, parentRefs) {
+		t.Errorf("unexpected parentRefs: %v", result)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedEntryPoints") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestTraefikMiddlewareFilters(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Annotations: map[string]string{
+		traefikMiddlewaresAnnotation: "apps-strip-prefix@kubernetescrd, other-auth@kubernetescrd, compress@file",
+	}}}
+
+	// Without the option every middleware is reported
+	if filters := r.traefikMiddlewareFilters(ingress); len(filters) != 0 {
+		t.Errorf("expected no filters, got %v", filters)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedMiddlewares") || !strings.Contains(event, "apps-strip-prefix") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	r.TraefikMiddlewareFilters = true
+	expected := []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterExtensionRef,
+		ExtensionRef: &gatewayv1.LocalObjectReference{
+			Group: traefikMiddlewareGroup,
+			Kind:  "Middleware",
+			Name:  "strip-prefix",
+		},
+	}}
+	if filters := r.traefikMiddlewareFilters(ingress); !isEqual(filters, expected) {
+		t.Errorf("unexpected filters: %v", filters)
+	}
+	event := <-recorder.Events
+	if strings.Contains(event, "apps-strip-prefix") || !strings.Contains(event, "other-auth@kubernetescrd, compress@file") {
+		t.Errorf("unexpected event: %s", event)
+	}
+	if support := r.AnnotationSupport(traefikMiddlewaresAnnotation); support != AnnotationConverted {
+		t.Errorf("expected %s to be converted, got %s", traefikMiddlewaresAnnotation, support)
+	}
+}
+
+func TestTraefikPathMatcher(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder, ImplementationSpecificPathType: PathTypeRegex}
+	profile := &ConversionProfile{
+		Name: "traefik", ImplementationSpecificPathType: PathTypePrefix, AnnotationPrefixes: []string{traefikAnnotationPrefix},
+	}
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		traefikPathMatcherAnnotation: "Path",
+	}}}
+
+	if policy := r.implementationSpecificPathType(ingress, profile); policy != PathTypeExact {
+		t.Errorf("expected %s, got %s", PathTypeExact, policy)
+	}
+
+	// An unknown matcher falls back to the policy of the profile
+	ingress.Annotations[traefikPathMatcherAnnotation] = "Host"
+	if policy := r.implementationSpecificPathType(ingress, profile); policy != profile.ImplementationSpecificPathType {
+		t.Errorf("expected %s, got %s", profile.ImplementationSpecificPathType, policy)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedPathMatcher") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// The profiles of other Ingress controllers ignore the matcher
+	ingress.Annotations[traefikPathMatcherAnnotation] = "Path"
+	nginx := &ConversionProfile{Name: "nginx", ImplementationSpecificPathType: PathTypeRegex, AnnotationPrefixes: []string{nginxAnnotationPrefix}}
+	if policy := r.implementationSpecificPathType(ingress, nginx); policy != PathTypeRegex {
+		t.Errorf("expected %s, got %s", PathTypeRegex, policy)
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/internal/audit"
+)
+
+// TraefikIngressRouteGVK is the kind of the IngressRoutes of Traefik, which are converted by the
+// TraefikIngressRouteReconciler
+var TraefikIngressRouteGVK = schema.GroupVersionKind{Group: "traefik.io", Version: "v1alpha1", Kind: "IngressRoute"}
+
+const (
+	// traefikRouteKindRule is the only kind of the routes of an IngressRoute
+	traefikRouteKindRule = "Rule"
+	// traefikRouteKind is the kind of the backends of the Ingress paths the routes of an IngressRoute are mapped to,
+	// named after the index of the route and of the alternative of its match
+	traefikRouteKind = "TraefikRoute"
+)
+
+// traefikIngressRouteSpec is the part of the spec of an IngressRoute of Traefik that is converted
+type traefikIngressRouteSpec struct {
+	EntryPoints []string           `json:"entryPoints,omitempty"`
+	Routes      []traefikRoute     `json:"routes"`
+	TLS         *traefikIngressTLS `json:"tls,omitempty"`
+}
+
+type traefikRoute struct {
+	Match       string              `json:"match"`
+	Kind        string              `json:"kind,omitempty"`
+	Priority    int                 `json:"priority,omitempty"`
+	Services    []traefikService    `json:"services,omitempty"`
+	Middlewares []traefikMiddleware `json:"middlewares,omitempty"`
+}
+
+type traefikService struct {
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace,omitempty"`
+	Kind      string             `json:"kind,omitempty"`
+	Port      intstr.IntOrString `json:"port,omitempty"`
+	Weight    *int32             `json:"weight,omitempty"`
+}
+
+type traefikMiddleware struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type traefikIngressTLS struct {
+	SecretName   string `json:"secretName,omitempty"`
+	CertResolver string `json:"certResolver,omitempty"`
+}
+
+// TraefikIngressRouteReconciler converts the IngressRoutes of Traefik to HTTPRoutes. Each IngressRoute is mapped to
+// an Ingress with a path per host and alternative of the match of each of its routes, which is converted like any
+// other Ingress, so the IngressRoutes attach to the same Gateways. The rules converted from the paths then match and
+// forward the requests as the routes do. The generated HTTPRoutes are owned by the IngressRoute.
+type TraefikIngressRouteReconciler struct {
+	// IngressReconciler converts the Ingresses the IngressRoutes are mapped to, with its settings. The features that
+	// write to an Ingress, such as annotating or retiring it, do not apply to IngressRoutes.
+	*IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=traefik.io,resources=ingressroutes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=traefik.io,resources=ingressroutes/finalizers,verbs=update
+
+// Reconcile converts an IngressRoute to the HTTPRoutes that should exist for it, and deletes the stale ones. The
+// HTTPRoutes of a deleted IngressRoute are garbage collected, those in the namespaces of their Gateways are deleted
+// by its finalizer.
+func (r *TraefikIngressRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ingressRoute := &unstructured.Unstructured{}
+	ingressRoute.SetGroupVersionKind(TraefikIngressRouteGVK)
+	if err := r.Get(ctx, req.NamespacedName, ingressRoute); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !ingressRoute.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalizeSource(audit.WithReason(ctx, audit.ReasonIngressFinalized), ingressRoute)
+	}
+
+	converter := r.converter(ingressRoute)
+	ingress, err := r.TraefikIngressRouteIngress(ingressRoute)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if converter.isPaused(ingress) {
+		logger.V(1).Info("skipping paused IngressRoute")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, err := converter.listGateways(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gateways = converter.candidateGateways(gateways)
+
+	if converter.placesRoutes() {
+		if err := r.ensureRoutesFinalizer(audit.WithReason(ctx, audit.ReasonIngressConverted), ingressRoute); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	httpRoutes, convertErr := r.ConvertTraefikIngressRoute(ctx, ingressRoute, ingress, gateways)
+	return converter.applyRoutes(ctx, ingress, gateways, httpRoutes, nil, convertErr)
+}
+
+// ConvertTraefikIngressRoute maps the IngressRoute, with the Ingress returned by TraefikIngressRouteIngress, to the
+// HTTPRoutes that should exist for it, given the available Gateways. The rules converted from the paths of the
+// Ingress match the requests by the alternative of the match of their route, forward them to the Services of the
+// route by weight, and reference its Middlewares with ExtensionRef filters, with TraefikMiddlewareFilters.
+func (r *TraefikIngressRouteReconciler) ConvertTraefikIngressRoute(ctx context.Context, ingressRoute *unstructured.Unstructured, ingress networkingv1.Ingress, gateways gatewayv1.GatewayList) ([]gatewayv1.HTTPRoute, error) {
+	spec, err := decodeTraefikIngressRoute(ingressRoute)
+	if err != nil {
+		return nil, err
+	}
+	converter := r.converter(ingressRoute)
+	converter.completeSourceRules = func(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute) error {
+		backendRefs := make([][]gatewayv1.HTTPBackendRef, len(spec.Routes))
+		filters := make([][]gatewayv1.HTTPRouteFilter, len(spec.Routes))
+		for i, route := range spec.Routes {
+			if backendRefs[i], err = r.traefikBackendRefs(ctx, ingressRoute, route); err != nil {
+				return err
+			}
+			filters[i] = r.traefikRouteMiddlewareFilters(ingressRoute, route)
+		}
+
+		for i := range httpRoutes {
+			rules := httpRoutes[i].Spec.Rules
+			for j := range rules {
+				name, ok := sourceRuleName(rules[j], traefikRouteKind)
+				if !ok {
+					continue
+				}
+				route, alternative, ok := parseTraefikRouteName(name)
+				if !ok || route >= len(spec.Routes) {
+					continue
+				}
+				alternatives, err := parseTraefikRule(spec.Routes[route].Match)
+				if err != nil || alternative >= len(alternatives) {
+					continue
+				}
+				rules[j].Matches = alternatives[alternative].matches
+				rules[j].BackendRefs = slices.Clone(backendRefs[route])
+				rules[j].Filters = append(rules[j].Filters, filters[route]...)
+			}
+			slices.SortStableFunc(rules, compareHTTPRouteRule)
+		}
+		return nil
+	}
+	return converter.Convert(ctx, ingress, gateways)
+}
+
+// TraefikIngressRouteIngress returns the Ingress the IngressRoute is mapped to. It carries the kind, name and UID of
+// the IngressRoute, so the IngressRoute owns the generated HTTPRoutes, and its annotations, so the annotations of the
+// controller apply. Each alternative of the match of a route is a path for each of its hosts, or a path without a
+// host if it matches any host. The hosts are listed under spec.tls if the IngressRoute has TLS, and its entry points
+// are those of the entry points annotation of Traefik. Routes whose match cannot be converted are left out with an
+// Event.
+func (r *TraefikIngressRouteReconciler) TraefikIngressRouteIngress(ingressRoute *unstructured.Unstructured) (networkingv1.Ingress, error) {
+	spec, err := decodeTraefikIngressRoute(ingressRoute)
+	if err != nil {
+		return networkingv1.Ingress{}, err
+	}
+	converter := r.converter(ingressRoute)
+
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: TraefikIngressRouteGVK.GroupVersion().String(),
+			Kind:       TraefikIngressRouteGVK.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ingressRoute.GetName(),
+			Namespace:   ingressRoute.GetNamespace(),
+			UID:         ingressRoute.GetUID(),
+			Annotations: make(map[string]string),
+		},
+	}
+	for key, value := range ingressRoute.GetAnnotations() {
+		ingress.Annotations[key] = value
+	}
+	if len(spec.EntryPoints) > 0 {
+		ingress.Annotations[traefikEntryPointsAnnotation] = strings.Join(spec.EntryPoints, ",")
+	}
+
+	var hosts []string
+	for i, route := range spec.Routes {
+		if route.Kind != "" && route.Kind != traefikRouteKindRule {
+			continue
+		}
+		alternatives, err := parseTraefikRule(route.Match)
+		if err != nil {
+			converter.event(ingressRoute, corev1.EventTypeWarning, "UnsupportedMatch",
+				fmt.Sprintf("Route %q is not converted: %v", route.Match, err))
+			continue
+		}
+		if route.Priority != 0 {
+			converter.event(ingressRoute, corev1.EventTypeWarning, "UnsupportedPriority",
+				fmt.Sprintf("Priority %d of route %q has no Gateway API equivalent, the rules are ordered by the "+
+					"precedence of their matches", route.Priority, route.Match))
+		}
+		for j, alternative := range alternatives {
+			backend := sourceRuleBackend(traefikRouteKind, fmt.Sprintf("%d-%d", i, j))
+			for _, host := range alternative.hosts {
+				ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+					Host: host,
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: ptr.To(networkingv1.PathTypePrefix),
+							Backend:  backend,
+						}},
+					}},
+				})
+				if host != "" && !slices.Contains(hosts, host) {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+	}
+
+	if tls := spec.TLS; tls != nil {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: hosts, SecretName: tls.SecretName}}
+		if tls.CertResolver != "" {
+			converter.event(ingressRoute, corev1.EventTypeWarning, "UnconvertedCertResolver",
+				fmt.Sprintf("The certificates of resolver %s are not converted, the HTTPS listeners of the Gateways "+
+					"must serve certificates for %s", tls.CertResolver, strings.Join(hosts, ", ")))
+		}
+	}
+	return ingress, nil
+}
+
+// converter returns the reconciler converting the Ingress of the IngressRoute. The hosts of an IngressRoute with TLS
+// only attach to HTTPS listeners without redirecting to them, as the routers of Traefik only serve TLS requests then.
+func (r *TraefikIngressRouteReconciler) converter(ingressRoute *unstructured.Unstructured) *IngressReconciler {
+	converter := r.sourceConverter(ingressRoute)
+	converter.TLSListeners = true
+	converter.TLSRedirect = false
+	return converter
+}
+
+// decodeTraefikIngressRoute returns the spec of the IngressRoute
+func decodeTraefikIngressRoute(ingressRoute *unstructured.Unstructured) (traefikIngressRouteSpec, error) {
+	var spec traefikIngressRouteSpec
+	content, _, err := unstructured.NestedMap(ingressRoute.UnstructuredContent(), "spec")
+	if err != nil {
+		return spec, err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec)
+	return spec, err
+}
+
+// parseTraefikRouteName returns the index of the route and of the alternative of its match a backend of the
+// Ingress of an IngressRoute is named after
+func parseTraefikRouteName(name string) (int, int, bool) {
+	route, alternative, ok := strings.Cut(name, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	i, err := strconv.Atoi(route)
+	if err != nil {
+		return 0, 0, false
+	}
+	j, err := strconv.Atoi(alternative)
+	if err != nil {
+		return 0, 0, false
+	}
+	return i, j, true
+}
+
+// traefikBackendRefs returns the backend refs of the Services of the route, weighted if there are several. Services
+// in other namespaces and TraefikServices are left out with an Event.
+func (r *TraefikIngressRouteReconciler) traefikBackendRefs(ctx context.Context, ingressRoute *unstructured.Unstructured, route traefikRoute) ([]gatewayv1.HTTPBackendRef, error) {
+	var result []gatewayv1.HTTPBackendRef
+	for _, service := range route.Services {
+		if service.Kind != "" && service.Kind != "Service" {
+			r.converter(ingressRoute).event(ingressRoute, corev1.EventTypeWarning, "UnsupportedBackend",
+				fmt.Sprintf("Backend %s %s is not converted, only Services are", service.Kind, service.Name))
+			continue
+		}
+		if service.Namespace != "" && service.Namespace != ingressRoute.GetNamespace() {
+			r.converter(ingressRoute).event(ingressRoute, corev1.EventTypeWarning, "UnsupportedBackend",
+				fmt.Sprintf("Service %s/%s is not converted, only the Services in the namespace of the IngressRoute are",
+					service.Namespace, service.Name))
+			continue
+		}
+
+		port := networkingv1.ServiceBackendPort{Number: service.Port.IntVal}
+		if service.Port.Type == intstr.String {
+			if r.DisableServiceLookups {
+				log.FromContext(ctx).Info("cannot resolve named port without Service lookups",
+					"service", service.Name, "port", service.Port.StrVal)
+				continue
+			}
+			port = networkingv1.ServiceBackendPort{Name: service.Port.StrVal}
+		}
+		weight := r.backendWeight()
+		if len(route.Services) > 1 {
+			weight = ptr.To(ptr.Deref(service.Weight, 1))
+		}
+		backendRef, err := r.mapBackendRef(ctx, ingressRoute.GetNamespace(), networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{Name: service.Name, Port: port},
+		}, weight)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *backendRef)
+	}
+	return result, nil
+}
+
+// traefikRouteMiddlewareFilters returns an ExtensionRef filter for each Middleware of the route in the namespace of
+// the IngressRoute, with TraefikMiddlewareFilters. The other Middlewares are reported with an Event, as are all
+// Middlewares without TraefikMiddlewareFilters.
+func (r *TraefikIngressRouteReconciler) traefikRouteMiddlewareFilters(ingressRoute *unstructured.Unstructured, route traefikRoute) []gatewayv1.HTTPRouteFilter {
+	var filters []gatewayv1.HTTPRouteFilter
+	var unsupported []string
+	for _, middleware := range route.Middlewares {
+		namespace := middleware.Namespace
+		if namespace == "" {
+			namespace = ingressRoute.GetNamespace()
+		}
+		if !r.TraefikMiddlewareFilters || namespace != ingressRoute.GetNamespace() {
+			unsupported = append(unsupported, namespace+"/"+middleware.Name)
+			continue
+		}
+		filters = append(filters, traefikMiddlewareFilter(middleware.Name))
+	}
+	if len(unsupported) > 0 {
+		r.converter(ingressRoute).event(ingressRoute, corev1.EventTypeWarning, "UnsupportedMiddlewares",
+			fmt.Sprintf("Middlewares %s cannot be referenced by the HTTPRoutes, the requests are not processed by them",
+				strings.Join(unsupported, ", ")))
+	}
+	return filters
+}
+
+// traefikIngressRouteHosts returns the hosts of the matches of the routes of the IngressRoute to index it by, none
+// if it cannot be decoded
+func traefikIngressRouteHosts(ingressRoute *unstructured.Unstructured) []string {
+	spec, err := decodeTraefikIngressRoute(ingressRoute)
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, route := range spec.Routes {
+		if route.Kind != "" && route.Kind != traefikRouteKindRule {
+			continue
+		}
+		// The routes whose match cannot be parsed are not converted
+		alternatives, _ := parseTraefikRule(route.Match)
+		for _, alternative := range alternatives {
+			hosts = append(hosts, alternative.hosts...)
+		}
+	}
+	return hosts
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *TraefikIngressRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b, err := r.sourceControllerBuilder(mgr, "traefikingressroute", TraefikIngressRouteGVK, traefikIngressRouteHosts)
+	if err != nil {
+		return err
+	}
+	return b.Complete(r)
+}
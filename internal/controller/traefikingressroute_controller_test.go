@@ -0,0 +1,209 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func testTraefikIngressRouteReconciler(recorder record.EventRecorder) *TraefikIngressRouteReconciler {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "web", Port: 80}}},
+	}
+	return &TraefikIngressRouteReconciler{IngressReconciler: &IngressReconciler{
+		Client:                   fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(service).Build(),
+		Recorder:                 recorder,
+		TraefikMiddlewareFilters: true,
+	}}
+}
+
+func TestParseTraefikRule(t *testing.T) {
+	alternatives, err := parseTraefikRule("(Host(`a.example.com`) || Host(`b.example.com`)) && PathPrefix(`/api`) && " +
+		"Header(`X-Version`, `2`) && Query(`debug=true`) || Path(`/health`) && Method(`GET`, `head`)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alternatives) != 3 {
+		t.Fatalf("expected 3 alternatives, got %+v", alternatives)
+	}
+	api := gatewayv1.HTTPRouteMatch{
+		Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/api")},
+		Headers: []gatewayv1.HTTPHeaderMatch{
+			{Type: ptr.To(gatewayv1.HeaderMatchExact), Name: "X-Version", Value: "2"},
+		},
+		QueryParams: []gatewayv1.HTTPQueryParamMatch{
+			{Type: ptr.To(gatewayv1.QueryParamMatchExact), Name: "debug", Value: "true"},
+		},
+	}
+	for i, host := range []string{"a.example.com", "b.example.com"} {
+		if !isEqual(alternatives[i].hosts, []string{host}) || !isEqual(alternatives[i].matches, []gatewayv1.HTTPRouteMatch{api}) {
+			t.Errorf("unexpected alternative %d: %+v", i, alternatives[i])
+		}
+	}
+	health := &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/health")}
+	expected := traefikAlternative{hosts: []string{""}, matches: []gatewayv1.HTTPRouteMatch{
+		{Path: health, Method: ptr.To(gatewayv1.HTTPMethodGet)},
+		{Path: health, Method: ptr.To(gatewayv1.HTTPMethodHead)},
+	}}
+	if !isEqual(alternatives[2].hosts, expected.hosts) || !isEqual(alternatives[2].matches, expected.matches) {
+		t.Errorf("unexpected alternative: %+v", alternatives[2])
+	}
+
+	for _, rule := range []string{
+		"HostRegexp(`.+`)",
+		"!Path(`/admin`)",
+		"Host(`a.example.com`) && Host(`b.example.com`)",
+		"Host(`a.example.com`",
+		"Query(`debug`)",
+	} {
+		if _, err := parseTraefikRule(rule); err == nil {
+			t.Errorf("expected an error for %s", rule)
+		}
+	}
+}
+
+func TestTraefikIngressRouteIngress(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := testTraefikIngressRouteReconciler(recorder)
+	ingressRoute := sourceObject(TraefikIngressRouteGVK, "default", "app", map[string]any{
+		"entryPoints": []any{"websecure"},
+		"routes": []any{
+			map[string]any{"match": "Host(`app.example.com`) && PathPrefix(`/api`)", "kind": "Rule"},
+			map[string]any{"match": "ClientIP(`10.0.0.0/8`)", "kind": "Rule"},
+		},
+		"tls": map[string]any{"secretName": "app-tls"},
+	})
+
+	ingress, err := r.TraefikIngressRouteIngress(ingressRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := createOwnerReference(ingress); owner.Kind != "IngressRoute" || owner.APIVersion != "traefik.io/v1alpha1" ||
+		owner.UID != ingressRoute.GetUID() {
+		t.Errorf("expected the IngressRoute to own the routes, got %+v", owner)
+	}
+	if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != "app.example.com" ||
+		ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Resource.Name != "0-0" {
+		t.Errorf("unexpected rules: %+v", ingress.Spec.Rules)
+	}
+	if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != "app-tls" ||
+		!isEqual(ingress.Spec.TLS[0].Hosts, []string{"app.example.com"}) {
+		t.Errorf("unexpected tls: %+v", ingress.Spec.TLS)
+	}
+	if ingress.Annotations[traefikEntryPointsAnnotation] != "websecure" {
+		t.Errorf("unexpected annotations: %v", ingress.Annotations)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "UnsupportedMatch") {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestConvertTraefikIngressRoute(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+	r := testTraefikIngressRouteReconciler(recorder)
+	ingressRoute := sourceObject(TraefikIngressRouteGVK, "default", "app", map[string]any{
+		"routes": []any{
+			map[string]any{
+				"match": "Host(`app.example.com`) && PathPrefix(`/api`) && Header(`X-Canary`, `true`)",
+				"kind":  "Rule",
+				"services": []any{
+					map[string]any{"name": "app", "port": "web", "weight": int64(3)},
+					map[string]any{"name": "app-canary", "port": int64(8080), "weight": int64(1)},
+					map[string]any{"name": "app-wrr", "kind": "TraefikService"},
+				},
+				"middlewares": []any{
+					map[string]any{"name": "strip-prefix"},
+					map[string]any{"name": "auth", "namespace": "security"},
+				},
+			},
+		},
+	})
+	ingress, err := r.TraefikIngressRouteIngress(ingressRoute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpRoutes, err := r.ConvertTraefikIngressRoute(ctx, ingressRoute, ingress, testOpenShiftGateways())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(httpRoutes) != 1 {
+		t.Fatalf("expected 1 HTTPRoute, got %d", len(httpRoutes))
+	}
+	if owner := httpRoutes[0].OwnerReferences[0]; owner.Kind != "IngressRoute" || owner.Name != "app" {
+		t.Errorf("unexpected owner: %+v", owner)
+	}
+	rules := httpRoutes[0].Spec.Rules
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 rule, got %+v", rules)
+	}
+	expectedMatches := []gatewayv1.HTTPRouteMatch{{
+		Path: &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/api")},
+		Headers: []gatewayv1.HTTPHeaderMatch{
+			{Type: ptr.To(gatewayv1.HeaderMatchExact), Name: "X-Canary", Value: "true"},
+		},
+	}}
+	if !isEqual(rules[0].Matches, expectedMatches) {
+		t.Errorf("unexpected matches: %+v", rules[0].Matches)
+	}
+	var backends []string
+	for _, backendRef := range rules[0].BackendRefs {
+		backends = append(backends, fmt.Sprintf("%s:%d:%d", backendRef.Name, *backendRef.Port, *backendRef.Weight))
+	}
+	if !isEqual(backends, []string{"app:80:3", "app-canary:8080:1"}) {
+		t.Errorf("unexpected backends: %v", backends)
+	}
+	if len(rules[0].Filters) != 1 || rules[0].Filters[0].ExtensionRef.Name != "strip-prefix" {
+		t.Errorf("unexpected filters: %+v", rules[0].Filters)
+	}
+	for _, reason := range []string{"UnsupportedBackend", "UnsupportedMiddlewares"} {
+		if event := <-recorder.Events; !strings.Contains(event, reason) {
+			t.Errorf("expected a %s event, got %s", reason, event)
+		}
+	}
+}
+
+func TestTraefikIngressRouteHostIndex(t *testing.T) {
+	r := &IngressReconciler{}
+	ingressRoute := sourceObject(TraefikIngressRouteGVK, "default", "app", map[string]any{
+		"routes": []any{
+			map[string]any{"kind": "Rule", "match": "Host(`a.example.com`) || Host(`b.example.com`) && PathPrefix(`/b`)"},
+			map[string]any{"kind": "Rule", "match": "PathPrefix(`/any`)"},
+			map[string]any{"kind": "Rule", "match": "ClientIP(`10.0.0.0/8`) && Host(`c.example.com`)"},
+		},
+	})
+	keys := r.indexSourceHosts(traefikIngressRouteHosts)(ingressRoute)
+	if !slices.Contains(keys, "a.example.com") || !slices.Contains(keys, "b.example.com") ||
+		slices.Contains(keys, "c.example.com") {
+		t.Errorf("expected the IngressRoute to be indexed by the hosts of its converted routes, got %v", keys)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// traefikMatcher is a matcher of a rule of Traefik, e.g. Host(`example.com`)
+type traefikMatcher struct {
+	name string
+	args []string
+}
+
+// traefikAlternative is a set of requests a rule of Traefik matches: those for one of its hosts, or any host without
+// hosts, that satisfy one of its HTTPRoute matches
+type traefikAlternative struct {
+	hosts   []string
+	matches []gatewayv1.HTTPRouteMatch
+}
+
+// parseTraefikRule returns the alternatives of the requests the rule matches, one for each conjunction of matchers
+// the rule is a disjunction of. Both the matchers of Traefik v2 and v3 are supported, except for those that have no
+// HTTPRoute equivalent, such as HostRegexp and ClientIP, and negations.
+func parseTraefikRule(rule string) ([]traefikAlternative, error) {
+	tokens, err := tokenizeTraefikRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	p := &traefikRuleParser{tokens: tokens}
+	conjunctions, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	var result []traefikAlternative
+	for _, conjunction := range conjunctions {
+		alternative, err := traefikConjunctionAlternative(conjunction)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, alternative)
+	}
+	return result, nil
+}
+
+// traefikConjunctionAlternative returns the requests matching all matchers of the conjunction. The arguments of the
+// matchers of Traefik v2 that accept several, such as Host and Path, are alternatives of each other.
+func traefikConjunctionAlternative(conjunction []traefikMatcher) (traefikAlternative, error) {
+	var hosts, methods []string
+	var paths []gatewayv1.HTTPPathMatch
+	var headers []gatewayv1.HTTPHeaderMatch
+	var queryParams []gatewayv1.HTTPQueryParamMatch
+	var hasHost, hasPath, hasMethod bool
+	for _, matcher := range conjunction {
+		switch matcher.name {
+		case "Host":
+			if hasHost {
+				return traefikAlternative{}, fmt.Errorf("several Host matchers cannot be combined")
+			}
+			hasHost = true
+			for _, host := range matcher.args {
+				hosts = append(hosts, strings.ToLower(host))
+			}
+		case "Path", "PathPrefix", "PathRegexp":
+			if hasPath {
+				return traefikAlternative{}, fmt.Errorf("several path matchers cannot be combined")
+			}
+			hasPath = true
+			policy := traefikPathMatchers[matcher.name]
+			for _, path := range matcher.args {
+				paths = append(paths, gatewayv1.HTTPPathMatch{
+					Type:  ptr.To(traefikPathMatchTypes[policy]),
+					Value: ptr.To(path),
+				})
+			}
+		case "Method":
+			if hasMethod {
+				return traefikAlternative{}, fmt.Errorf("several Method matchers cannot be combined")
+			}
+			hasMethod = true
+			methods = append(methods, matcher.args...)
+		case "Header", "Headers", "HeaderRegexp", "HeadersRegexp":
+			if len(matcher.args) != 2 {
+				return traefikAlternative{}, fmt.Errorf("%s expects a header name and value", matcher.name)
+			}
+			matchType := gatewayv1.HeaderMatchExact
+			if strings.HasSuffix(matcher.name, "Regexp") {
+				matchType = gatewayv1.HeaderMatchRegularExpression
+			}
+			headers = append(headers, gatewayv1.HTTPHeaderMatch{
+				Type:  ptr.To(matchType),
+				Name:  gatewayv1.HTTPHeaderName(matcher.args[0]),
+				Value: matcher.args[1],
+			})
+		case "Query", "QueryRegexp":
+			// Query(`name`, `value`) in Traefik v3, Query(`name=value`, ...) in Traefik v2
+			pairs := [][2]string{}
+			if len(matcher.args) == 2 && !strings.Contains(matcher.args[0], "=") {
+				pairs = append(pairs, [2]string{matcher.args[0], matcher.args[1]})
+			} else {
+				for _, arg := range matcher.args {
+					name, value, ok := strings.Cut(arg, "=")
+					if !ok {
+						return traefikAlternative{}, fmt.Errorf("%s(%q) without a value is not supported", matcher.name, arg)
+					}
+					pairs = append(pairs, [2]string{name, value})
+				}
+			}
+			matchType := gatewayv1.QueryParamMatchExact
+			if matcher.name == "QueryRegexp" {
+				matchType = gatewayv1.QueryParamMatchRegularExpression
+			}
+			for _, pair := range pairs {
+				queryParams = append(queryParams, gatewayv1.HTTPQueryParamMatch{
+					Type:  ptr.To(matchType),
+					Name:  gatewayv1.HTTPHeaderName(pair[0]),
+					Value: pair[1],
+				})
+			}
+		default:
+			return traefikAlternative{}, fmt.Errorf("matcher %s has no HTTPRoute equivalent", matcher.name)
+		}
+	}
+
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	if len(paths) == 0 {
+		paths = []gatewayv1.HTTPPathMatch{{Type: ptr.To(gatewayv1.PathMatchPathPrefix), Value: ptr.To("/")}}
+	}
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	alternative := traefikAlternative{hosts: hosts}
+	for _, path := range paths {
+		for _, method := range methods {
+			match := gatewayv1.HTTPRouteMatch{
+				Path:        ptr.To(path),
+				Headers:     slices.Clone(headers),
+				QueryParams: slices.Clone(queryParams),
+			}
+			if method != "" {
+				match.Method = ptr.To(gatewayv1.HTTPMethod(strings.ToUpper(method)))
+			}
+			alternative.matches = append(alternative.matches, match)
+		}
+	}
+	return alternative, nil
+}
+
+// traefikPathMatchTypes maps the path type policies of the path matchers to the path match types
+var traefikPathMatchTypes = map[PathTypePolicy]gatewayv1.PathMatchType{
+	PathTypeExact:  gatewayv1.PathMatchExact,
+	PathTypePrefix: gatewayv1.PathMatchPathPrefix,
+	PathTypeRegex:  gatewayv1.PathMatchRegularExpression,
+}
+
+// traefikRuleParser parses the tokens of a rule to its disjunctive normal form: a disjunction of conjunctions of
+// matchers
+type traefikRuleParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *traefikRuleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *traefikRuleParser) expect(token string) error {
+	if p.peek() != token {
+		return fmt.Errorf("expected %q instead of %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+// parseOr parses the alternatives separated by ||
+func (p *traefikRuleParser) parseOr() ([][]traefikMatcher, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, right...)
+	}
+	return result, nil
+}
+
+// parseAnd parses the operands separated by &&, distributing the conjunction over their alternatives
+func (p *traefikRuleParser) parseAnd() ([][]traefikMatcher, error) {
+	result, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		var product [][]traefikMatcher
+		for _, left := range result {
+			for _, conjunction := range right {
+				product = append(product, append(slices.Clone(left), conjunction...))
+			}
+		}
+		result = product
+	}
+	return result, nil
+}
+
+// parseOperand parses a parenthesized expression or a matcher
+func (p *traefikRuleParser) parseOperand() ([][]traefikMatcher, error) {
+	switch token := p.peek(); {
+	case token == "!":
+		return nil, fmt.Errorf("negations have no HTTPRoute equivalent")
+	case token == "(":
+		p.pos++
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return result, p.expect(")")
+	case isTraefikIdentifier(token):
+		p.pos++
+		matcher := traefikMatcher{name: token}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for p.peek() != ")" {
+			if len(matcher.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg := p.peek()
+			if !strings.HasPrefix(arg, "`") && !strings.HasPrefix(arg, `"`) {
+				return nil, fmt.Errorf("expected an argument of %s instead of %q", token, arg)
+			}
+			p.pos++
+			matcher.args = append(matcher.args, arg[1:len(arg)-1])
+		}
+		p.pos++
+		if len(matcher.args) == 0 {
+			return nil, fmt.Errorf("%s has no arguments", token)
+		}
+		return [][]traefikMatcher{{matcher}}, nil
+	default:
+		return nil, fmt.Errorf("expected a matcher instead of %q", token)
+	}
+}
+
+// isTraefikIdentifier returns true if the token is the name of a matcher
+func isTraefikIdentifier(token string) bool {
+	return token != "" && strings.IndexFunc(token, func(c rune) bool { return !unicode.IsLetter(c) }) == -1
+}
+
+// tokenizeTraefikRule splits the rule into names, quoted arguments including their quotes, parentheses, commas and
+// operators
+func tokenizeTraefikRule(rule string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(rule[i:], "&&") || strings.HasPrefix(rule[i:], "||"):
+			tokens = append(tokens, rule[i:i+2])
+			i += 2
+		case c == '`' || c == '"':
+			end := strings.IndexByte(rule[i+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated argument %s", rule[i:])
+			}
+			tokens = append(tokens, rule[i:i+end+2])
+			i += end + 2
+		case unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(rule) && unicode.IsLetter(rune(rule[j])) {
+				j++
+			}
+			tokens = append(tokens, rule[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// unconvertedAnnotation lists the annotations of the Ingresses a route was generated from that are not converted,
+// so operators can audit what the route lacks at a glance
+const unconvertedAnnotation = "ingress2httproute.lion7.dev/unconverted"
+
+// unconvertedAnnotations returns the keys of the unsupported and unconvertible annotations of the Ingress, sorted
+func (r *IngressReconciler) unconvertedAnnotations(profile *ConversionProfile, ingress networkingv1.Ingress) []string {
+	var keys []string
+	for key := range ingress.Annotations {
+		if support := r.annotationSupport(profile, key); support == AnnotationUnsupported || support == AnnotationUnconvertible {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// warnUnsupportedAnnotations emits an Event listing the unsupported annotations of the Ingress, the unconvertible
+// ones have an Event of their own
+func (r *IngressReconciler) warnUnsupportedAnnotations(profile *ConversionProfile, ingress *networkingv1.Ingress) {
+	var keys []string
+	for _, key := range r.unconvertedAnnotations(profile, *ingress) {
+		if r.annotationSupport(profile, key) == AnnotationUnsupported {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		r.event(ingress, corev1.EventTypeWarning, "UnconvertedAnnotations",
+			fmt.Sprintf("Annotations %s are not converted, their behavior is lost in the HTTPRoutes",
+				strings.Join(keys, ", ")))
+	}
+}
+
+// annotateUnconverted records the unconverted annotations of the Ingresses, with the conversion profiles of their
+// IngressClasses, in the unconverted annotation of the HTTPRoutes generated from them
+func (r *IngressReconciler) annotateUnconverted(ctx context.Context, httpRoutes []gatewayv1.HTTPRoute, ingresses ...networkingv1.Ingress) error {
+	var keys []string
+	for _, ingress := range ingresses {
+		profile, err := r.conversionProfile(ctx, ingress)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, r.unconvertedAnnotations(profile, ingress)...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	value := strings.Join(slices.Compact(keys), ",")
+	for i := range httpRoutes {
+		metav1.SetMetaDataAnnotation(&httpRoutes[i].ObjectMeta, unconvertedAnnotation, value)
+	}
+	return nil
+}
+
+// syncUnconvertedAnnotation sets the unconverted annotation of the current route to that of the desired route,
+// removing it if the desired route has none, and returns true if it changed
+func syncUnconvertedAnnotation(current *metav1.ObjectMeta, desired metav1.ObjectMeta) bool {
+	value, ok := desired.Annotations[unconvertedAnnotation]
+	if currentValue, currentOk := current.Annotations[unconvertedAnnotation]; currentOk == ok && currentValue == value {
+		return false
+	}
+	if ok {
+		metav1.SetMetaDataAnnotation(current, unconvertedAnnotation, value)
+	} else {
+		delete(current.Annotations, unconvertedAnnotation)
+	}
+	return true
+}
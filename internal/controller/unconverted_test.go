@@ -0,0 +1,102 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestUnconvertedAnnotations(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-body-size":      "8m",
+		nginxServerSnippetAnnotation:                       "return 403;",
+		ingressClassAnnotation:                             "nginx",
+		routesAnnotation:                                   "app",
+		versionAnnotation:                                  "v1.0.0",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}}}
+
+	expected := []string{"nginx.ingress.kubernetes.io/proxy-body-size", nginxServerSnippetAnnotation}
+	if keys := r.unconvertedAnnotations(nil, ingress); !isEqual(keys, expected) {
+		t.Errorf("unexpected unconverted annotations: %v", keys)
+	}
+
+	r.warnUnsupportedAnnotations(nil, &ingress)
+	event := <-recorder.Events
+	if !strings.Contains(event, "UnconvertedAnnotations") ||
+		!strings.Contains(event, "nginx.ingress.kubernetes.io/proxy-body-size") ||
+		strings.Contains(event, nginxServerSnippetAnnotation) {
+		t.Errorf("unexpected event: %s", event)
+	}
+}
+
+func TestAnnotateUnconverted(t *testing.T) {
+	r := &IngressReconciler{}
+	first := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-body-size": "8m",
+	}}}
+	second := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-body-size": "16m",
+		nginxServerSnippetAnnotation:                  "return 403;",
+	}}}
+
+	httpRoutes := make([]gatewayv1.HTTPRoute, 2)
+	if err := r.annotateUnconverted(context.Background(), httpRoutes, first, second); err != nil {
+		t.Fatal(err)
+	}
+	expected := "nginx.ingress.kubernetes.io/proxy-body-size," + nginxServerSnippetAnnotation
+	for _, httpRoute := range httpRoutes {
+		if value := httpRoute.Annotations[unconvertedAnnotation]; value != expected {
+			t.Errorf("unexpected unconverted annotation: %q", value)
+		}
+	}
+
+	httpRoutes = make([]gatewayv1.HTTPRoute, 1)
+	if err := r.annotateUnconverted(context.Background(), httpRoutes, networkingv1.Ingress{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := httpRoutes[0].Annotations[unconvertedAnnotation]; ok {
+		t.Errorf("expected no unconverted annotation")
+	}
+}
+
+func TestSyncUnconvertedAnnotation(t *testing.T) {
+	current := metav1.ObjectMeta{}
+	desired := metav1.ObjectMeta{Annotations: map[string]string{unconvertedAnnotation: "a,b"}}
+
+	if !syncUnconvertedAnnotation(&current, desired) || current.Annotations[unconvertedAnnotation] != "a,b" {
+		t.Errorf("expected the annotation to be set, got %v", current.Annotations)
+	}
+	if syncUnconvertedAnnotation(&current, desired) {
+		t.Errorf("expected no change")
+	}
+	if !syncUnconvertedAnnotation(&current, metav1.ObjectMeta{}) {
+		t.Errorf("expected the annotation to be removed")
+	}
+	if _, ok := current.Annotations[unconvertedAnnotation]; ok {
+		t.Errorf("expected no annotation, got %v", current.Annotations)
+	}
+}
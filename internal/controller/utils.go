@@ -1,13 +1,22 @@
 package controller
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"slices"
 	"strings"
 
+	"golang.org/x/net/idna"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
@@ -17,18 +26,62 @@ func generateHTTPRouteName(ingressName, hostname string) string {
 	if hostname == "" {
 		return ingressName
 	} else {
-		// Replace dots and special characters with dashes for valid Kubernetes names
-		cleanHostname := strings.ReplaceAll(hostname, ".", "-")
-		cleanHostname = strings.ReplaceAll(cleanHostname, "*", "wildcard")
-		return fmt.Sprintf("%s-%s", ingressName, cleanHostname)
+		return fmt.Sprintf("%s-%s", ingressName, normalizeHostname(hostname))
 	}
 }
 
+// canonicalHostname lowercases the host and encodes its internationalized labels in punycode, the form Gateways
+// and DNS compare hostnames in. A wildcard label is kept, a host that is no valid IDNA name is only lowercased.
+func canonicalHostname(host string) string {
+	wildcard := strings.HasPrefix(host, "*.")
+	if wildcard {
+		host = host[2:]
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	} else {
+		host = strings.ToLower(host)
+	}
+	if wildcard {
+		return "*." + host
+	}
+	return host
+}
+
+// normalizeHostname replaces dots and special characters with dashes for valid Kubernetes names
+func normalizeHostname(hostname string) string {
+	cleanHostname := strings.ReplaceAll(hostname, ".", "-")
+	return strings.ReplaceAll(cleanHostname, "*", "wildcard")
+}
+
+// generateRuleName creates the name of the rule converted from a path of the Ingress, a valid sectionName
+// Following the pattern: ingressName-hostname-path-index, where index counts the paths of the hostname
+func generateRuleName(ingressName, hostname string, index int) gatewayv1.SectionName {
+	name := strings.ReplaceAll(generateHTTPRouteName(ingressName, hostname), ".", "-")
+	return gatewayv1.SectionName(truncateName(fmt.Sprintf("%s-path-%d", name, index)))
+}
+
+// generatePerParentHTTPRouteName creates a HTTPRoute name for a single parent from the name of the combined HTTPRoute
+// Following the pattern: routeName-gatewayName, or routeName-gatewayNamespace-gatewayName for other namespaces
+func generatePerParentHTTPRouteName(routeName, routeNamespace string, parentRef gatewayv1.ParentReference) string {
+	if parentRef.Namespace == nil || string(*parentRef.Namespace) == routeNamespace {
+		return fmt.Sprintf("%s-%s", routeName, parentRef.Name)
+	} else {
+		return fmt.Sprintf("%s-%s-%s", routeName, *parentRef.Namespace, parentRef.Name)
+	}
+}
+
+// createOwnerReference returns the owner reference of the routes of the Ingress. The Ingress converted from another
+// source, such as an OpenShift Route, carries the kind of the source, which then owns the routes.
 func createOwnerReference(ingress networkingv1.Ingress) metav1.OwnerReference {
 	bTrue := true
+	apiVersion, kind := "networking.k8s.io/v1", "Ingress"
+	if ingress.Kind != "" && ingress.Kind != kind {
+		apiVersion, kind = ingress.APIVersion, ingress.Kind
+	}
 	return metav1.OwnerReference{
-		APIVersion:         "networking.k8s.io/v1",
-		Kind:               "Ingress",
+		APIVersion:         apiVersion,
+		Kind:               kind,
 		Name:               ingress.Name,
 		UID:                ingress.UID,
 		Controller:         &bTrue,
@@ -36,6 +89,47 @@ func createOwnerReference(ingress networkingv1.Ingress) metav1.OwnerReference {
 	}
 }
 
+// maxNameLength is the maximum length of the name of a HTTPRoute, as it must be a DNS subdomain
+const maxNameLength = validation.DNS1123SubdomainMaxLength
+
+// nameHashLength is the number of hex characters of the hash that replaces the end of a name that is too long
+const nameHashLength = 10
+
+// truncateName shortens a generated name that exceeds the maximum length. The end of the name is replaced by a
+// hash of the full name, so the result is the same on every reconcile and differs between long names with
+// the same beginning.
+func truncateName(name string) string {
+	if len(name) <= maxNameLength {
+		return name
+	}
+	prefix := strings.TrimRight(name[:maxNameLength-nameHashLength-1], "-.")
+	return prefix + "-" + shortHash(name)
+}
+
+// shortHash returns the first hex characters of the SHA-256 hash of the value
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:nameHashLength]
+}
+
+func createHTTPRoute(name, namespace string, owners []metav1.OwnerReference, labels map[string]string, spec gatewayv1.HTTPRouteSpec) gatewayv1.HTTPRoute {
+	name = truncateName(name)
+	sortHTTPRouteSpec(&spec)
+	return gatewayv1.HTTPRoute{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gatewayv1.GroupVersion.String(),
+			Kind:       "HTTPRoute",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          labels,
+			OwnerReferences: owners,
+		},
+		Spec: spec,
+	}
+}
+
 func createParentRef(gateway gatewayv1.Gateway, listener gatewayv1.Listener) gatewayv1.ParentReference {
 	gvk := gateway.GroupVersionKind()
 	group := gatewayv1.Group(gvk.Group)
@@ -53,7 +147,7 @@ func createParentRef(gateway gatewayv1.Gateway, listener gatewayv1.Listener) gat
 }
 
 // createPathMatch creates a gateway API path match from an ingress path
-func createPathMatch(path networkingv1.HTTPIngressPath) gatewayv1.HTTPPathMatch {
+func createPathMatch(path networkingv1.HTTPIngressPath, implementationSpecific PathTypePolicy) gatewayv1.HTTPPathMatch {
 	pathMatch := gatewayv1.HTTPPathMatch{Value: &path.Path}
 
 	if path.PathType == nil {
@@ -67,20 +161,21 @@ func createPathMatch(path networkingv1.HTTPIngressPath) gatewayv1.HTTPPathMatch
 			prefix := gatewayv1.PathMatchPathPrefix
 			pathMatch.Type = &prefix
 		case networkingv1.PathTypeImplementationSpecific:
-			regex := gatewayv1.PathMatchRegularExpression
-			pathMatch.Type = &regex
+			pathMatchType := implementationSpecific.pathMatchType()
+			pathMatch.Type = &pathMatchType
 		}
 	}
 
 	return pathMatch
 }
 
-// groupRulesByHostname groups ingress rules by hostname
+// groupRulesByHostname groups ingress rules by their canonical hostname, which the grouped rules are updated to
 func groupRulesByHostname(rules []networkingv1.IngressRule) map[string][]networkingv1.IngressRule {
 	result := make(map[string][]networkingv1.IngressRule)
 
 	for _, rule := range rules {
-		hostname := rule.Host
+		hostname := canonicalHostname(rule.Host)
+		rule.Host = hostname
 		existingRules := result[hostname]
 		result[hostname] = append(existingRules, rule)
 	}
@@ -89,12 +184,21 @@ func groupRulesByHostname(rules []networkingv1.IngressRule) map[string][]network
 }
 
 // groupGatewaysByHostNameAndMapToParentRefs groups gateways by hostname and maps each listener to a parent ref
-func groupGatewaysByHostNameAndMapToParentRefs(ingressNamespace string, gateways gatewayv1.GatewayList) map[string][]gatewayv1.ParentReference {
+func groupGatewaysByHostNameAndMapToParentRefs(namespace corev1.Namespace, gateways gatewayv1.GatewayList, listenerPorts []int32, listenerProtocols []gatewayv1.ProtocolType) map[string][]gatewayv1.ParentReference {
 	result := make(map[string][]gatewayv1.ParentReference)
 
 	for _, gateway := range gateways.Items {
 		for _, listener := range gateway.Spec.Listeners {
-			if !isListenerAccessibleFromNamespace(listener, gateway.Namespace, ingressNamespace) {
+			if !isListenerAccessibleFromNamespace(listener, gateway.Namespace, namespace) {
+				continue
+			}
+			if !isListenerTLSModeCompatible(listener) {
+				continue
+			}
+			if !isListenerProtocolAllowed(listener, listenerProtocols) {
+				continue
+			}
+			if len(listenerPorts) > 0 && !slices.Contains(listenerPorts, int32(listener.Port)) {
 				continue
 			}
 
@@ -106,8 +210,12 @@ func groupGatewaysByHostNameAndMapToParentRefs(ingressNamespace string, gateways
 				hostname = string(*listener.Hostname)
 			}
 
-			existingParentRefs := result[hostname]
-			result[hostname] = append(existingParentRefs, createParentRef(gateway, listener))
+			// The listener was matched by its port, so the parent ref names the port as well
+			parentRef := createParentRef(gateway, listener)
+			if len(listenerPorts) > 0 {
+				parentRef.Port = ptr.To(listener.Port)
+			}
+			result[hostname] = append(result[hostname], parentRef)
 		}
 	}
 
@@ -115,12 +223,124 @@ func groupGatewaysByHostNameAndMapToParentRefs(ingressNamespace string, gateways
 }
 
 // isListenerAccessibleFromNamespace checks if a listener allows routes from the given namespace
-func isListenerAccessibleFromNamespace(listener gatewayv1.Listener, gatewayNamespace, ingressNamespace string) bool {
+func isListenerAccessibleFromNamespace(listener gatewayv1.Listener, gatewayNamespace string, namespace corev1.Namespace) bool {
 	nsSelector := gatewayv1.NamespacesFromSame
 	if listener.AllowedRoutes != nil && listener.AllowedRoutes.Namespaces != nil && listener.AllowedRoutes.Namespaces.From != nil {
 		nsSelector = *listener.AllowedRoutes.Namespaces.From
 	}
-	return nsSelector == gatewayv1.NamespacesFromAll || (nsSelector == gatewayv1.NamespacesFromSame && gatewayNamespace == ingressNamespace)
+	switch nsSelector {
+	case gatewayv1.NamespacesFromAll:
+		return true
+	case gatewayv1.NamespacesFromSame:
+		return gatewayNamespace == namespace.Name
+	case gatewayv1.NamespacesFromSelector:
+		if listener.AllowedRoutes.Namespaces.Selector == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(listener.AllowedRoutes.Namespaces.Selector)
+		if err != nil {
+			// The Gateway rejects routes for an invalid selector as well
+			return false
+		}
+		return selector.Matches(labels.Set(namespace.Labels))
+	default:
+		return false
+	}
+}
+
+// usesNamespaceSelector returns true if a listener of the Gateways selects the namespaces of its routes by label
+func usesNamespaceSelector(gateways gatewayv1.GatewayList) bool {
+	for _, gateway := range gateways.Items {
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.AllowedRoutes != nil && listener.AllowedRoutes.Namespaces != nil &&
+				ptr.Equal(listener.AllowedRoutes.Namespaces.From, ptr.To(gatewayv1.NamespacesFromSelector)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isListenerTLSModeCompatible checks if the TLS mode of a listener allows HTTPRoutes to attach.
+// Passthrough listeners never terminate TLS, so they can only carry TLSRoutes.
+func isListenerTLSModeCompatible(listener gatewayv1.Listener) bool {
+	if listener.TLS == nil || listener.TLS.Mode == nil {
+		// The TLS mode defaults to Terminate
+		return true
+	}
+	return *listener.TLS.Mode == gatewayv1.TLSModeTerminate
+}
+
+// isPassthroughListener checks if a listener passes TLS connections through without terminating them
+func isPassthroughListener(listener gatewayv1.Listener) bool {
+	return listener.TLS != nil && ptr.Equal(listener.TLS.Mode, ptr.To(gatewayv1.TLSModePassthrough))
+}
+
+// isShadowedListener checks if the Gateway hands the TLS connections for the hostname on the port of the listener
+// to a listener in the other TLS mode instead. Like the Gateway, the listener with the most specific hostname
+// intersecting it is preferred, and of equally specific ones the listener terminating TLS.
+func isShadowedListener(gateway gatewayv1.Gateway, listener gatewayv1.Listener, hostname string) bool {
+	if listener.Protocol != gatewayv1.HTTPSProtocolType && listener.Protocol != gatewayv1.TLSProtocolType {
+		return false
+	}
+	passthrough := isPassthroughListener(listener)
+	for _, other := range gateway.Spec.Listeners {
+		if other.Port != listener.Port || isPassthroughListener(other) == passthrough ||
+			other.Protocol != gatewayv1.HTTPSProtocolType && other.Protocol != gatewayv1.TLSProtocolType {
+			continue
+		}
+		if other.Hostname != nil && !hostnamesIntersect(hostname, string(*other.Hostname)) {
+			continue
+		}
+		specificity, otherSpecificity := listenerSpecificity(listener), listenerSpecificity(other)
+		if otherSpecificity > specificity || otherSpecificity == specificity && passthrough {
+			return true
+		}
+	}
+	return false
+}
+
+// listenerSpecificity orders listeners by how specific their hostname is: no hostname, then wildcards by their
+// number of labels, then exact hostnames
+func listenerSpecificity(listener gatewayv1.Listener) int {
+	if listener.Hostname == nil {
+		return 0
+	}
+	hostname := string(*listener.Hostname)
+	if !strings.HasPrefix(hostname, "*.") {
+		return math.MaxInt
+	}
+	return strings.Count(hostname, ".") + 1
+}
+
+// withoutShadowedListeners removes the parent refs of the listeners that do not receive the TLS connections for
+// the hostname, as a listener in the other TLS mode on the same port is preferred, see isShadowedListener
+func withoutShadowedListeners(parentRefs []gatewayv1.ParentReference, gateways gatewayv1.GatewayList, hostname string) []gatewayv1.ParentReference {
+	return slices.DeleteFunc(parentRefs, func(parentRef gatewayv1.ParentReference) bool {
+		for _, gateway := range gateways.Items {
+			if !isParentRefForGateway(parentRef, gateway) || parentRef.SectionName == nil {
+				continue
+			}
+			for _, listener := range gateway.Spec.Listeners {
+				if listener.Name == *parentRef.SectionName && isShadowedListener(gateway, listener, hostname) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// defaultListenerProtocols are the protocols of the listeners HTTPRoutes can attach to
+var defaultListenerProtocols = []gatewayv1.ProtocolType{gatewayv1.HTTPProtocolType, gatewayv1.HTTPSProtocolType}
+
+// isListenerProtocolAllowed checks if the protocol of a listener is one of the allowed protocols,
+// or HTTP or HTTPS if none are given. TCP, UDP and TLS listeners would reject HTTPRoutes.
+func isListenerProtocolAllowed(listener gatewayv1.Listener, protocols []gatewayv1.ProtocolType) bool {
+	if len(protocols) == 0 {
+		protocols = defaultListenerProtocols
+	}
+	return slices.Contains(protocols, listener.Protocol)
 }
 
 // findMatchingParentRefs finds all parentRefs that match the given hostname
@@ -128,7 +348,7 @@ func findMatchingGateways(ingressHost string, parentRefsGroupedByHostname map[st
 	var result []gatewayv1.ParentReference
 
 	for hostname, references := range parentRefsGroupedByHostname {
-		if hostname == "" || hostnameMatches(ingressHost, hostname) {
+		if hostname == "" || hostnamesIntersect(ingressHost, hostname) {
 			result = append(result, references...)
 		}
 	}
@@ -137,15 +357,185 @@ func findMatchingGateways(ingressHost string, parentRefsGroupedByHostname map[st
 	return result
 }
 
-// hostnameMatches checks if the ingress hostname matches the gateway listener hostname
-func hostnameMatches(ingressHost, listenerHost string) bool {
-	if strings.HasPrefix(listenerHost, "*.") {
-		fqdn := strings.TrimPrefix(listenerHost, "*.")
-		// Allow only subdomain matches and not exact domain matches for wildcard patterns
-		return strings.HasSuffix(ingressHost, fqdn) && !strings.EqualFold(ingressHost, fqdn)
+// collapseParentRefs replaces the per-listener parent refs of a Gateway by a single Gateway-level parent ref
+// when they cover every listener of that Gateway, as attaching to the Gateway itself is then equivalent.
+// Otherwise, the listeners are referenced by a single port-level parent ref when they are exactly the listeners of that port.
+func collapseParentRefs(parentRefs []gatewayv1.ParentReference, gateways gatewayv1.GatewayList) []gatewayv1.ParentReference {
+	var result []gatewayv1.ParentReference
+
+	for _, gateway := range gateways.Items {
+		gatewayParentRefs := make(map[gatewayv1.SectionName]gatewayv1.ParentReference)
+		for _, parentRef := range parentRefs {
+			if isParentRefForGateway(parentRef, gateway) && parentRef.SectionName != nil {
+				gatewayParentRefs[*parentRef.SectionName] = parentRef
+			}
+		}
+		if len(gatewayParentRefs) == 0 {
+			continue
+		}
+
+		// All parent refs for this gateway only differ by section name and port
+		var parentRef gatewayv1.ParentReference
+		for _, gatewayParentRef := range gatewayParentRefs {
+			parentRef = gatewayParentRef
+			parentRef.SectionName = nil
+			parentRef.Port = nil
+			break
+		}
+
+		if len(gatewayParentRefs) == len(gateway.Spec.Listeners) {
+			result = append(result, parentRef)
+			continue
+		}
+
+		// Reference the port instead when all covered listeners share a port that has no other listeners
+		if port, ok := coveredPort(gateway, gatewayParentRefs); ok {
+			parentRef.Port = &port
+			result = append(result, parentRef)
+			continue
+		}
+
+		for _, listener := range gateway.Spec.Listeners {
+			if parentRef, exists := gatewayParentRefs[listener.Name]; exists {
+				result = append(result, parentRef)
+			}
+		}
 	}
 
-	return strings.EqualFold(ingressHost, listenerHost)
+	slices.SortStableFunc(result, compareParentRef)
+	return result
+}
+
+// coveredPort returns the port of the covered listeners if they are exactly the listeners on that port
+func coveredPort(gateway gatewayv1.Gateway, covered map[gatewayv1.SectionName]gatewayv1.ParentReference) (gatewayv1.PortNumber, bool) {
+	var port gatewayv1.PortNumber
+	for _, listener := range gateway.Spec.Listeners {
+		if _, exists := covered[listener.Name]; exists {
+			if port != 0 && port != listener.Port {
+				return 0, false
+			}
+			port = listener.Port
+		}
+	}
+	for _, listener := range gateway.Spec.Listeners {
+		if _, exists := covered[listener.Name]; !exists && listener.Port == port {
+			return 0, false
+		}
+	}
+	return port, port != 0
+}
+
+// groupParentRefsByGateway splits sorted parent refs into groups that refer to the same Gateway
+func groupParentRefsByGateway(parentRefs []gatewayv1.ParentReference) [][]gatewayv1.ParentReference {
+	var result [][]gatewayv1.ParentReference
+
+	for _, parentRef := range parentRefs {
+		last := len(result) - 1
+		if last >= 0 && isSameParent(result[last][0], parentRef) {
+			result[last] = append(result[last], parentRef)
+		} else {
+			result = append(result, []gatewayv1.ParentReference{parentRef})
+		}
+	}
+
+	return result
+}
+
+// isSameParent checks if both parent refs refer to the same parent, regardless of section name or port
+func isSameParent(a, b gatewayv1.ParentReference) bool {
+	return ptr.Equal(a.Group, b.Group) && ptr.Equal(a.Kind, b.Kind) && ptr.Equal(a.Namespace, b.Namespace) && a.Name == b.Name
+}
+
+// isParentRefForGateway checks if the parent ref refers to the given gateway
+func isParentRefForGateway(parentRef gatewayv1.ParentReference, gateway gatewayv1.Gateway) bool {
+	return parentRef.Namespace != nil && string(*parentRef.Namespace) == gateway.Namespace && string(parentRef.Name) == gateway.Name
+}
+
+// hostnamesIntersect checks if an Ingress host and a listener hostname have a non-empty intersection, following
+// the Gateway API rules: a wildcard matches one or more labels of a subdomain but never the domain itself,
+// and a wildcard Ingress host also intersects the more specific listener hostnames below it.
+func hostnamesIntersect(ingressHost, listenerHost string) bool {
+	ingressHost = canonicalHostname(ingressHost)
+	listenerHost = canonicalHostname(listenerHost)
+	if ingressHost == listenerHost {
+		return true
+	}
+
+	ingressWildcard := strings.HasPrefix(ingressHost, "*.")
+	listenerWildcard := strings.HasPrefix(listenerHost, "*.")
+	switch {
+	case ingressWildcard && listenerWildcard:
+		// The intersection is the more specific of both wildcards
+		return strings.HasSuffix(ingressHost[1:], listenerHost[1:]) || strings.HasSuffix(listenerHost[1:], ingressHost[1:])
+	case listenerWildcard:
+		return strings.HasSuffix(ingressHost, listenerHost[1:])
+	case ingressWildcard:
+		return strings.HasSuffix(listenerHost, ingressHost[1:])
+	default:
+		return false
+	}
+}
+
+// wildcardHostKeyPrefix prefixes the index keys of wildcard Ingress hosts, which intersect more specific listener hostnames
+const wildcardHostKeyPrefix = "^"
+
+// indexIngressHosts returns the host index keys of all rules of an Ingress
+func indexIngressHosts(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, rule := range ingress.Spec.Rules {
+		hostKeys := hostnameIndexKeys(rule.Host)
+		if strings.HasPrefix(rule.Host, "*.") {
+			hostKeys = append(hostKeys, wildcardHostKeyPrefix+canonicalHostname(rule.Host))
+		}
+		for _, key := range hostKeys {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// hostnameIndexKeys returns the listener hostnames that match the given Ingress host: the host itself
+// and a wildcard for each of its parent domains, e.g. api.example.com, *.example.com and *.com.
+func hostnameIndexKeys(ingressHost string) []string {
+	if ingressHost == "" {
+		return nil
+	}
+
+	host := canonicalHostname(ingressHost)
+	keys := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels); i++ {
+		key := "*." + strings.Join(labels[i:], ".")
+		if key != host {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// listenerIndexKeys returns the keys to look up in the host index for a listener hostname: the hostname itself,
+// and the wildcard Ingress hosts of its parent domains, which intersect it as well.
+// Looking up these keys then yields exactly the Ingresses with a host intersecting the listener hostname.
+func listenerIndexKeys(listenerHost string) []string {
+	if listenerHost == "" {
+		return nil
+	}
+
+	host := canonicalHostname(listenerHost)
+	keys := []string{host}
+	for _, key := range hostnameIndexKeys(host) {
+		if strings.HasPrefix(key, "*.") {
+			keys = append(keys, wildcardHostKeyPrefix+key)
+		}
+	}
+	return keys
 }
 
 func isOwnedBy(metadata metav1.ObjectMeta, owner metav1.OwnerReference) bool {
@@ -157,12 +547,22 @@ func isOwnedBy(metadata metav1.ObjectMeta, owner metav1.OwnerReference) bool {
 	return false
 }
 
-func isEqual(a, b interface{}) bool {
-	if l, err := json.Marshal(a); err != nil {
-		return false
-	} else if r, err := json.Marshal(b); err != nil {
-		return false
-	} else {
-		return string(l) == string(r)
+// hasLabels returns true if all labels are set on the object
+func hasLabels(metadata metav1.ObjectMeta, labels map[string]string) bool {
+	for key, value := range labels {
+		if metadata.Labels[key] != value {
+			return false
+		}
 	}
+	return true
+}
+
+// isEqual returns true if the values are semantically equal, treating nil and empty slices and maps as equal
+func isEqual(a, b interface{}) bool {
+	return equality.Semantic.DeepEqual(a, b)
+}
+
+// isNamedServicePort returns true if the backend references a Service port by name
+func isNamedServicePort(backend networkingv1.IngressBackend) bool {
+	return backend.Service != nil && backend.Service.Port.Number == 0 && backend.Service.Port.Name != ""
 }
@@ -0,0 +1,200 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/lion7/ingress2httproute/pkg/golden"
+)
+
+func TestGenerateRuleName(t *testing.T) {
+	tests := []struct {
+		ingressName string
+		hostname    string
+		index       int
+		expected    gatewayv1.SectionName
+	}{
+		{ingressName: "app", hostname: "app.example.com", index: 0, expected: "app-app-example-com-path-0"},
+		{ingressName: "app", hostname: "*.example.com", index: 2, expected: "app-wildcard-example-com-path-2"},
+		{ingressName: "app.v2", hostname: "", index: 1, expected: "app-v2-path-1"},
+	}
+	for _, tt := range tests {
+		if name := generateRuleName(tt.ingressName, tt.hostname, tt.index); name != tt.expected {
+			t.Errorf("expected rule name %q, got %q", tt.expected, name)
+		}
+	}
+
+	long := generateRuleName(strings.Repeat("a", 200), strings.Repeat("b", 100)+".example.com", 0)
+	if errs := validation.IsDNS1123Subdomain(string(long)); len(errs) > 0 || strings.Contains(string(long), ".") {
+		t.Errorf("expected a valid sectionName, got %q: %v", long, errs)
+	}
+}
+
+func TestCanonicalHostname(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "App.Example.COM", expected: "app.example.com"},
+		{host: "bücher.example.com", expected: "xn--bcher-kva.example.com"},
+		{host: "Bücher.Example.com", expected: "xn--bcher-kva.example.com"},
+		{host: "*.Bücher.example.com", expected: "*.xn--bcher-kva.example.com"},
+		{host: "xn--bcher-kva.example.com", expected: "xn--bcher-kva.example.com"},
+		{host: "", expected: ""},
+	}
+	for _, tt := range tests {
+		if hostname := canonicalHostname(tt.host); hostname != tt.expected {
+			t.Errorf("expected hostname %q for %q, got %q", tt.expected, tt.host, hostname)
+		}
+	}
+
+	if !hostnamesIntersect("Bücher.example.com", "xn--bcher-kva.example.com") {
+		t.Errorf("expected an internationalized host to intersect with its punycode listener hostname")
+	}
+}
+
+func TestHostnamesIntersect(t *testing.T) {
+	tests := []struct {
+		ingressHost  string
+		listenerHost string
+		expected     bool
+	}{
+		{ingressHost: "app.example.com", listenerHost: "app.example.com", expected: true},
+		{ingressHost: "App.Example.com", listenerHost: "app.EXAMPLE.com", expected: true},
+		{ingressHost: "app.example.com", listenerHost: "*.example.com", expected: true},
+		{ingressHost: "API.App.Example.com", listenerHost: "*.example.com", expected: true},
+		{ingressHost: "app.example.com", listenerHost: "*.Example.COM", expected: true},
+		// A wildcard only matches on a label boundary, and never the domain itself
+		{ingressHost: "badexample.com", listenerHost: "*.example.com", expected: false},
+		{ingressHost: "example.com", listenerHost: "*.example.com", expected: false},
+		{ingressHost: "*.badexample.com", listenerHost: "*.example.com", expected: false},
+		{ingressHost: "*.example.com", listenerHost: "api.badexample.com", expected: false},
+		{ingressHost: "*.example.com", listenerHost: "api.example.com", expected: true},
+		{ingressHost: "*.api.example.com", listenerHost: "*.example.com", expected: true},
+		{ingressHost: "app.example.com", listenerHost: "other.example.com", expected: false},
+	}
+	for _, tt := range tests {
+		if result := hostnamesIntersect(tt.ingressHost, tt.listenerHost); result != tt.expected {
+			t.Errorf("expected %q and %q to intersect: %v, got %v", tt.ingressHost, tt.listenerHost, tt.expected, result)
+		}
+	}
+}
+
+func TestListenerPortParentRefs(t *testing.T) {
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{
+			{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443},
+			{Name: "https-alt", Protocol: gatewayv1.HTTPSProtocolType, Port: 8443},
+		}},
+	}}}
+	namespace := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	protocols := []gatewayv1.ProtocolType{gatewayv1.HTTPSProtocolType}
+
+	// Without eligible ports the listeners are only referenced by name
+	for _, parentRef := range groupGatewaysByHostNameAndMapToParentRefs(namespace, gateways, nil, protocols)[""] {
+		if parentRef.Port != nil {
+			t.Errorf("expected no port in %+v", parentRef)
+		}
+	}
+	parentRefs := groupGatewaysByHostNameAndMapToParentRefs(namespace, gateways, []int32{443}, protocols)[""]
+	if len(parentRefs) != 1 || *parentRefs[0].SectionName != "https" || ptr.Deref(parentRefs[0].Port, 0) != 443 {
+		t.Errorf("expected the listener matched by port to be referenced with its port, got %+v", parentRefs)
+	}
+}
+
+func TestRuleNames(t *testing.T) {
+	ctx := context.Background()
+
+	hostname := gatewayv1.Hostname("*.example.com")
+	gateways := gatewayv1.GatewayList{Items: []gatewayv1.Gateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-gw", Namespace: "default"},
+		Spec: gatewayv1.GatewaySpec{Listeners: []gatewayv1.Listener{{
+			Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80, Hostname: &hostname,
+		}}},
+	}}}
+
+	pathType := networkingv1.PathTypePrefix
+	newRule := func(host string, paths ...string) networkingv1.IngressRule {
+		rule := networkingv1.IngressRule{Host: host, IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{},
+		}}
+		for _, path := range paths {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+				Path:     path,
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+					Name: "app-service",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				}},
+			})
+		}
+		return rule
+	}
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{
+			newRule("a.example.com", "/", "/api"),
+			newRule("b.example.com", "/"),
+			newRule("a.example.com", "/static"),
+		}},
+	}
+
+	r := &IngressReconciler{
+		Client: fake.NewClientBuilder().WithScheme(golden.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		).Build(),
+		Scheme:    golden.Scheme,
+		RuleNames: true,
+	}
+	httpRoutes, err := r.Convert(ctx, ingress, gateways)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The paths of a hostname are counted in the order of the Ingress, the rules are sorted by precedence
+	expected := map[string][]string{
+		"app-a-example-com": {"app-a-example-com-path-2", "app-a-example-com-path-1", "app-a-example-com-path-0"},
+		"app-b-example-com": {"app-b-example-com-path-0"},
+	}
+	if len(httpRoutes) != len(expected) {
+		t.Fatalf("expected %d HTTPRoutes, got %d", len(expected), len(httpRoutes))
+	}
+	for _, httpRoute := range httpRoutes {
+		var names []string
+		for _, rule := range httpRoute.Spec.Rules {
+			if rule.Name != nil {
+				names = append(names, string(*rule.Name))
+			}
+		}
+		if !slices.Equal(names, expected[httpRoute.Name]) {
+			t.Errorf("expected the rules of %s to be named %v, got %v", httpRoute.Name, expected[httpRoute.Name], names)
+		}
+	}
+}
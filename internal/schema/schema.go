@@ -0,0 +1,162 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema validates Gateway API objects against the OpenAPI and CEL schemas of the
+// bundled Gateway API CRDs, the same way the API server does when they are applied.
+package schema
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	structuralpruning "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"sigs.k8s.io/yaml"
+)
+
+// Channel is a Gateway API release channel
+type Channel string
+
+const (
+	// Standard contains the stable Gateway API resources and fields
+	Standard Channel = "standard"
+	// Experimental additionally contains the experimental Gateway API resources and fields
+	Experimental Channel = "experimental"
+)
+
+// The CRDs of Gateway API v1.3.0, matching the version of the Go types
+//
+//go:embed crds
+var crds embed.FS
+
+// Validator validates objects against the CRDs of a single channel
+type Validator struct {
+	schemas map[schema.GroupVersionKind]*crdSchema
+}
+
+type crdSchema struct {
+	structural *structuralschema.Structural
+	validator  apiservervalidation.SchemaValidator
+	cel        *cel.Validator
+}
+
+// NewValidator loads the CRDs of the given channel
+func NewValidator(channel Channel) (*Validator, error) {
+	if channel != Standard && channel != Experimental {
+		return nil, fmt.Errorf("unknown channel %q, must be one of %s or %s", channel, Standard, Experimental)
+	}
+
+	dir := path.Join("crds", string(channel))
+	entries, err := fs.ReadDir(crds, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validator{schemas: make(map[schema.GroupVersionKind]*crdSchema)}
+	for _, entry := range entries {
+		data, err := fs.ReadFile(crds, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := yaml.Unmarshal(data, &crd); err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", entry.Name(), err)
+		}
+		for _, version := range crd.Spec.Versions {
+			if !version.Served || version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			s, err := newCRDSchema(version.Schema.OpenAPIV3Schema)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load schema of %s %s: %w", crd.Name, version.Name, err)
+			}
+			gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}
+			v.schemas[gvk] = s
+		}
+	}
+	return v, nil
+}
+
+func newCRDSchema(openAPISchema *apiextensionsv1.JSONSchemaProps) (*crdSchema, error) {
+	var internal apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(openAPISchema, &internal, nil); err != nil {
+		return nil, err
+	}
+	structural, err := structuralschema.NewStructural(&internal)
+	if err != nil {
+		return nil, err
+	}
+	validator, _, err := apiservervalidation.NewSchemaValidator(&internal)
+	if err != nil {
+		return nil, err
+	}
+	return &crdSchema{
+		structural: structural,
+		validator:  validator,
+		cel:        cel.NewValidator(structural, true, celconfig.PerCallLimit),
+	}, nil
+}
+
+// Validate returns the errors the API server would report when creating the object.
+// Fields that are not part of the schema, e.g. experimental fields on the standard channel,
+// are reported as well, as the API server would silently drop them.
+func (v *Validator) Validate(ctx context.Context, obj runtime.Object) (field.ErrorList, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	s, ok := v.schemas[gvk]
+	if !ok {
+		return nil, fmt.Errorf("no schema found for %s", gvk)
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	if metadata, ok := u["metadata"].(map[string]interface{}); ok {
+		name, _ := metadata["name"].(string)
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), name, msg))
+		}
+	}
+
+	// Drop server-populated fields that are never part of the output
+	delete(u, "status")
+	for _, unknown := range structuralpruning.PruneWithOptions(u, s.structural, true, structuralschema.UnknownFieldPathOptions{
+		TrackUnknownFieldPaths: true,
+	}) {
+		errs = append(errs, field.Forbidden(field.NewPath(unknown), "field is not supported by this channel"))
+	}
+
+	structuraldefaulting.Default(u, s.structural)
+	errs = append(errs, apiservervalidation.ValidateCustomResource(nil, u, s.validator)...)
+	celErrs, _ := s.cel.Validate(ctx, nil, s.structural, u, nil, celconfig.RuntimeCELCostBudget)
+	errs = append(errs, celErrs...)
+	return errs, nil
+}
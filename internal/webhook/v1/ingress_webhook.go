@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// PhaseLabel is the label on a Namespace recording how far its migration to Gateway API has progressed
+	PhaseLabel = "ingress2httproute.lion7.dev/phase"
+	// PhaseCutOver is the phase in which the traffic of a Namespace is served through the Gateways
+	PhaseCutOver = "CutOver"
+
+	// acmeSolverLabel is set by cert-manager on the temporary Ingresses that solve HTTP01 challenges
+	acmeSolverLabel = "acme.cert-manager.io/http01-solver"
+)
+
+var ingresslog = logf.Log.WithName("ingress-resource")
+
+// SetupIngressWebhookWithManager registers the webhook that freezes Ingresses in cut over Namespaces
+func SetupIngressWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&networkingv1.Ingress{}).
+		WithValidator(&IngressCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-networking-k8s-io-v1-ingress,mutating=false,failurePolicy=ignore,sideEffects=None,groups=networking.k8s.io,resources=ingresses,verbs=create,versions=v1,name=vingress-v1.kb.io,admissionReviewVersions=v1
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// IngressCustomValidator rejects new Ingresses in Namespaces whose migration has reached the CutOver phase,
+// so teams do not fall back to Ingresses after their traffic moved to the Gateways.
+type IngressCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &IngressCustomValidator{}
+
+// ValidateCreate rejects the Ingress if its Namespace is cut over
+func (v *IngressCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil, fmt.Errorf("expected an Ingress object but got %T", obj)
+	}
+
+	// cert-manager keeps creating solver Ingresses until its Issuers solve challenges through the Gateways
+	if ingress.Labels[acmeSolverLabel] == "true" {
+		return nil, nil
+	}
+
+	namespace := corev1.Namespace{}
+	if err := v.Client.Get(ctx, types.NamespacedName{Name: ingress.Namespace}, &namespace); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if namespace.Labels[PhaseLabel] != PhaseCutOver {
+		return nil, nil
+	}
+
+	ingresslog.Info("rejected Ingress in cut over namespace", "namespace", ingress.Namespace, "name", ingress.Name)
+	return nil, fmt.Errorf("namespace %s has been migrated to Gateway API, create an HTTPRoute instead of an Ingress "+
+		"(see https://gateway-api.sigs.k8s.io/api-types/httproute/)", ingress.Namespace)
+}
+
+// ValidateUpdate allows existing Ingresses to be changed, e.g. to retire them
+func (v *IngressCustomValidator) ValidateUpdate(_ context.Context, _, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete allows Ingresses to be deleted
+func (v *IngressCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
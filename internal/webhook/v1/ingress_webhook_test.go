@@ -0,0 +1,55 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateCreate(t *testing.T) {
+	validator := &IngressCustomValidator{Client: fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "migrating", Labels: map[string]string{PhaseLabel: "Shadow"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cut-over", Labels: map[string]string{PhaseLabel: PhaseCutOver}}},
+	).Build()}
+
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		rejected  bool
+	}{
+		{name: "unlabeled namespace", namespace: "default"},
+		{name: "namespace in another phase", namespace: "migrating"},
+		{name: "cut over namespace", namespace: "cut-over", rejected: true},
+		{name: "ACME solver in cut over namespace", namespace: "cut-over", labels: map[string]string{acmeSolverLabel: "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: tt.namespace, Labels: tt.labels}}
+			_, err := validator.ValidateCreate(context.Background(), ingress)
+			if rejected := err != nil; rejected != tt.rejected {
+				t.Errorf("expected rejected to be %v, got error %v", tt.rejected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2024 Gerard de Leeuw.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package golden loads the golden test cases from a testdata directory, so
+// annotation translators can be tested against the same harness as the controller.
+//
+// Each test case is a directory containing:
+//   - input.yaml: the objects to apply, including at least one Ingress or resource of another ingress controller
+//   - output.yaml: the expected HTTPRoutes
+//   - options.yaml (optional): reconciler options to apply before converting
+//
+// Running the tests with UPDATE_GOLDEN=1 rewrites output.yaml from the actual output.
+package golden
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+	gatewayxv1alpha1 "sigs.k8s.io/gateway-api/apisx/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// UpdateEnv is the environment variable that enables regenerating output.yaml files
+	UpdateEnv = "UPDATE_GOLDEN"
+
+	// PlaceholderUID replaces the owner UID in output.yaml files, as it differs on every run
+	PlaceholderUID = types.UID("12345678-1234-1234-1234-123456789012")
+
+	inputFile   = "input.yaml"
+	outputFile  = "output.yaml"
+	optionsFile = "options.yaml"
+)
+
+// Scheme contains all types that can appear in a test case
+var Scheme = runtime.NewScheme()
+
+var (
+	deserializer      = serializer.NewCodecFactory(Scheme).UniversalDeserializer()
+	yamlCommentRegexp = regexp.MustCompile("#.*")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(Scheme))
+	utilruntime.Must(gatewayv1.Install(Scheme))
+	utilruntime.Must(gatewayv1beta1.Install(Scheme))
+	utilruntime.Must(gatewayv1alpha2.Install(Scheme))
+	utilruntime.Must(gatewayv1alpha3.Install(Scheme))
+	utilruntime.Must(gatewayxv1alpha1.Install(Scheme))
+}
+
+// Case is a single golden test case
+type Case struct {
+	// Name is the name of the test case directory
+	Name string
+	// Dir is the path of the test case directory
+	Dir string
+	// Input contains the objects to apply
+	Input []client.Object
+	// Output contains the expected HTTPRoutes
+	Output []*gatewayv1.HTTPRoute
+	// Options contains the raw reconciler options, or nil if the case has none
+	Options []byte
+}
+
+// Update returns true if output.yaml files should be regenerated instead of compared
+func Update() bool {
+	return os.Getenv(UpdateEnv) == "1"
+}
+
+// List returns the names of all test cases in the testdata directory
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), inputFile)); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Load reads the test case with the given name from the testdata directory.
+// A missing output.yaml is not an error when regenerating, as it is about to be written.
+func Load(dir, name string) (*Case, error) {
+	c := &Case{Name: name, Dir: filepath.Join(dir, name)}
+
+	input, err := LoadObjects(filepath.Join(c.Dir, inputFile))
+	if err != nil {
+		return nil, err
+	}
+	c.Input = input
+
+	output, err := LoadObjects(filepath.Join(c.Dir, outputFile))
+	if err != nil && !(os.IsNotExist(err) && Update()) {
+		return nil, err
+	}
+	for _, obj := range output {
+		if route, ok := obj.(*gatewayv1.HTTPRoute); ok {
+			c.Output = append(c.Output, route)
+		}
+	}
+
+	options, err := os.ReadFile(filepath.Join(c.Dir, optionsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	c.Options = options
+
+	return c, nil
+}
+
+// LoadObjects reads all objects from a multi-document YAML file. Objects of kinds missing from Scheme, like the
+// resources of other ingress controllers, are read as unstructured objects.
+func LoadObjects(path string) ([]client.Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove any YAML comments
+	content := yamlCommentRegexp.ReplaceAllString(string(data), "")
+
+	// Split by YAML document separator
+	var objects []client.Object
+	for _, doc := range strings.Split(content, "---") {
+		doc = strings.TrimSpace(doc)
+		if doc == "" {
+			continue
+		}
+
+		obj, _, err := deserializer.Decode([]byte(doc), nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			// Decoded from JSON, numbers are integers like in the objects read from the API server
+			source := &unstructured.Unstructured{}
+			data, err := yaml.YAMLToJSON([]byte(doc))
+			if err == nil {
+				err = source.UnmarshalJSON(data)
+			}
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, source)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if clientObj, ok := obj.(client.Object); ok {
+			objects = append(objects, clientObj)
+		}
+	}
+
+	return objects, nil
+}
+
+// Ingresses returns the Ingresses of the test case input
+func (c *Case) Ingresses() []*networkingv1.Ingress {
+	var ingresses []*networkingv1.Ingress
+	for _, obj := range c.Input {
+		if ingress, ok := obj.(*networkingv1.Ingress); ok {
+			ingresses = append(ingresses, ingress)
+		}
+	}
+	return ingresses
+}
+
+// Sources returns the objects of the test case input read as unstructured objects, the resources of other ingress
+// controllers that are converted like Ingresses
+func (c *Case) Sources() []*unstructured.Unstructured {
+	var sources []*unstructured.Unstructured
+	for _, obj := range c.Input {
+		if source, ok := obj.(*unstructured.Unstructured); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// Expected returns the expected HTTPRoute with the given name, or nil if there is none
+func (c *Case) Expected(name string) *gatewayv1.HTTPRoute {
+	for _, route := range c.Output {
+		if route.Name == name {
+			return route
+		}
+	}
+	return nil
+}
+
+// WriteOutput replaces output.yaml with the given HTTPRoutes, sorted by name
+func (c *Case) WriteOutput(routes []gatewayv1.HTTPRoute) error {
+	routes = slices.Clone(routes)
+	slices.SortFunc(routes, func(a, b gatewayv1.HTTPRoute) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var buf bytes.Buffer
+	for i, route := range routes {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := marshalHTTPRoute(route)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return os.WriteFile(filepath.Join(c.Dir, outputFile), buf.Bytes(), 0o644)
+}
+
+// marshalHTTPRoute renders the HTTPRoute without status and server-populated metadata
+func marshalHTTPRoute(route gatewayv1.HTTPRoute) ([]byte, error) {
+	clean := gatewayv1.HTTPRoute{
+		ObjectMeta: goldenObjectMeta(route),
+		Spec:       route.Spec,
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&clean)
+	if err != nil {
+		return nil, err
+	}
+	obj["apiVersion"] = gatewayv1.GroupVersion.String()
+	obj["kind"] = "HTTPRoute"
+	delete(obj, "status")
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(obj)
+}
+
+// goldenObjectMeta keeps the identifying metadata and the labels of the HTTPRoute, with a stable owner UID
+func goldenObjectMeta(route gatewayv1.HTTPRoute) (meta metav1.ObjectMeta) {
+	meta.Name = route.Name
+	meta.Namespace = route.Namespace
+	meta.Labels = route.Labels
+	meta.Annotations = route.Annotations
+	for _, owner := range route.OwnerReferences {
+		owner.UID = PlaceholderUID
+		meta.OwnerReferences = append(meta.OwnerReferences, owner)
+	}
+	return meta
+}